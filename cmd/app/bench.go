@@ -0,0 +1,362 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/proxy"
+	"ZabbixAPIproxy/internal/zabbix"
+	"ZabbixAPIproxy/internal/zabbixmock"
+)
+
+// benchOptions параметры подкоманды bench
+type benchOptions struct {
+	target    string
+	token     string
+	fake      int
+	items     int
+	mix       []benchMethod
+	rps       int
+	duration  time.Duration
+	workers   int
+	limit     int
+	ignoreSSL bool
+	timeout   time.Duration
+}
+
+// benchMethod метод нагрузки и его вес в смеси
+type benchMethod struct {
+	name   string
+	weight int
+}
+
+// benchStats результаты запросов одного метода
+type benchStats struct {
+	latencies []time.Duration
+	errors    int
+}
+
+// runBench выполняет подкоманду bench: отправляет смесь запросов JSON-RPC на прокси
+// с заданной частотой и печатает перцентили задержек и статистику аллокаций.
+// Код завершения: 0 - без ошибок, 1 - есть ошибки запросов, 2 - ошибка параметров
+func runBench(args []string) int {
+	var opts benchOptions
+	var mix string
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.StringVar(&opts.target, "target", "", "Proxy URL to load")
+	fs.StringVar(&opts.token, "token", "", "Bearer token for the proxy")
+	fs.IntVar(&opts.fake, "fake", 0, "Run the proxy in-process against N built-in fake Zabbix servers instead of -target (settings from -c config if it exists)")
+	fs.IntVar(&opts.items, "items", 100, "Hosts (and items) of each fake server")
+	fs.StringVar(&mix, "mix", "host.get:1,item.get:1", "Read methods and their weights, e.g. host.get:5,item.get:3,apiinfo.version:1")
+	fs.IntVar(&opts.rps, "rps", 100, "Target requests per second")
+	fs.DurationVar(&opts.duration, "duration", 10*time.Second, "Test duration")
+	fs.IntVar(&opts.workers, "workers", 16, "Maximum concurrent requests")
+	fs.IntVar(&opts.limit, "limit", 100, "'limit' parameter of *.get requests, 0 - not set")
+	fs.BoolVar(&opts.ignoreSSL, "ignore-ssl", false, "Skip TLS verification")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "Request timeout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [-c config.yaml] bench (-target URL | -fake N) [-mix METHODS] [-rps N] [-duration D]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if (opts.target == "") == (opts.fake == 0) || opts.rps <= 0 || opts.workers <= 0 || opts.duration <= 0 {
+		fs.Usage()
+		return 2
+	}
+	var err error
+	if opts.mix, err = parseBenchMix(mix); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -mix: %v\n", err)
+		return 2
+	}
+
+	if opts.fake > 0 {
+		stop, err := startBenchProxy(&opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to start in-process proxy: %v\n", err)
+			return 2
+		}
+		defer stop()
+	}
+
+	client := &http.Client{
+		Timeout:   opts.timeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: opts.workers},
+	}
+	if opts.ignoreSSL {
+		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	stats, dropped, elapsed, mem := runBenchLoad(client, opts)
+	if reportBench(stats, dropped, elapsed, mem, opts) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// parseBenchMix разбирает смесь методов method:weight. Допускаются только читающие
+// методы, что бы нагрузка на рабочий прокси не изменяла данные Zabbix
+func parseBenchMix(mix string) ([]benchMethod, error) {
+	var methods []benchMethod
+	for _, part := range strings.Split(mix, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, w, found := strings.Cut(part, ":")
+		weight := 1
+		if found {
+			var err error
+			if weight, err = strconv.Atoi(w); err != nil || weight <= 0 {
+				return nil, fmt.Errorf("%s: weight must be a positive number", part)
+			}
+		}
+		if !strings.HasSuffix(name, ".get") && !strings.HasPrefix(name, "apiinfo.") {
+			return nil, fmt.Errorf("%s: only *.get and apiinfo.* methods are allowed", name)
+		}
+		methods = append(methods, benchMethod{name: name, weight: weight})
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no methods")
+	}
+	return methods, nil
+}
+
+// benchRequest формирует запрос метода нагрузки
+func benchRequest(method string, id int, limit int) map[string]any {
+	params := map[string]any{}
+	if strings.HasSuffix(method, ".get") && limit > 0 {
+		params["limit"] = limit
+	}
+	return map[string]any{"jsonrpc": "2.0", "method": method, "params": params, "id": id}
+}
+
+// runBenchLoad отправляет запросы с частотой rps в течение duration. Запросы, для
+// которых нет свободного исполнителя, не откладываются, а считаются пропущенными,
+// что бы медленный прокси не снижал нагрузку незаметно
+func runBenchLoad(client *http.Client, opts benchOptions) (map[string]*benchStats, int, time.Duration, runtime.MemStats) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		stats   = make(map[string]*benchStats, len(opts.mix))
+		dropped int
+		jobs    = make(chan benchRequestJob)
+	)
+	for _, m := range opts.mix {
+		stats[m.name] = &benchStats{}
+	}
+
+	for range opts.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				start := time.Now()
+				err := sendBenchRequest(client, opts, job.request)
+				latency := time.Since(start)
+
+				mu.Lock()
+				s := stats[job.method]
+				if err != nil {
+					s.errors++
+				} else {
+					s.latencies = append(s.latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	total := 0
+	for _, m := range opts.mix {
+		total += m.weight
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Second / time.Duration(opts.rps))
+	deadline := time.After(opts.duration)
+	for id := 1; ; id++ {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			ticker.Stop()
+			close(jobs)
+			wg.Wait()
+			elapsed := time.Since(start)
+			runtime.ReadMemStats(&after)
+			after.Mallocs -= before.Mallocs
+			after.TotalAlloc -= before.TotalAlloc
+			after.NumGC -= before.NumGC
+			return stats, dropped, elapsed, after
+		}
+
+		method := pickBenchMethod(opts.mix, total)
+		select {
+		case jobs <- benchRequestJob{method: method, request: benchRequest(method, id, opts.limit)}:
+		default:
+			dropped++
+		}
+	}
+}
+
+// benchRequestJob запрос для исполнителя нагрузки
+type benchRequestJob struct {
+	method  string
+	request map[string]any
+}
+
+// pickBenchMethod выбирает метод смеси с учетом весов
+func pickBenchMethod(mix []benchMethod, total int) string {
+	n := rand.IntN(total)
+	for _, m := range mix {
+		if n < m.weight {
+			return m.name
+		}
+		n -= m.weight
+	}
+	return mix[len(mix)-1].name
+}
+
+// sendBenchRequest отправляет запрос и проверяет, что ответ не содержит ошибки JSON-RPC
+func sendBenchRequest(client *http.Client, opts benchOptions, request map[string]any) error {
+	response, err := postJSONRPC(client, opts.target, opts.token, request)
+	if err != nil {
+		return err
+	}
+	if rpcErr, ok := response["error"]; ok {
+		return fmt.Errorf("JSON-RPC error: %v", rpcErr)
+	}
+	return nil
+}
+
+// reportBench печатает результаты нагрузки и возвращает количество ошибок
+func reportBench(stats map[string]*benchStats, dropped int, elapsed time.Duration, mem runtime.MemStats, opts benchOptions) int {
+	var all []time.Duration
+	errors := 0
+	fmt.Printf("%-24s %8s %7s %10s %10s %10s %10s\n", "method", "ok", "errors", "p50", "p90", "p99", "max")
+	for _, m := range opts.mix {
+		s := stats[m.name]
+		all = append(all, s.latencies...)
+		errors += s.errors
+		printBenchLine(m.name, s.latencies, s.errors)
+	}
+	printBenchLine("total", all, errors)
+
+	sent := len(all) + errors
+	fmt.Printf("\nSent %d requests in %v: %.1f req/s (target %d), %d dropped (all %d workers busy)\n",
+		sent, elapsed.Round(time.Millisecond), float64(sent)/elapsed.Seconds(), opts.rps, dropped, opts.workers)
+	if sent > 0 {
+		// При -fake в процессе работают и прокси, и фиктивные серверы, иначе - только клиент нагрузки
+		scope := "load client"
+		if opts.fake > 0 {
+			scope = "proxy, fake servers and load client"
+		}
+		fmt.Printf("Allocations (%s): %d allocs/req, %d B/req, %d GC cycles\n",
+			scope, mem.Mallocs/uint64(sent), mem.TotalAlloc/uint64(sent), mem.NumGC)
+	}
+	return errors
+}
+
+// printBenchLine печатает строку таблицы результатов
+func printBenchLine(name string, latencies []time.Duration, errors int) {
+	slices.Sort(latencies)
+	fmt.Printf("%-24s %8d %7d %10v %10v %10v %10v\n", name, len(latencies), errors,
+		percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), percentile(latencies, 100))
+}
+
+// percentile возвращает перцентиль p отсортированных задержек
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	return sorted[max(0, min(i, len(sorted)-1))].Round(time.Microsecond)
+}
+
+// startBenchProxy запускает фиктивные серверы Zabbix и прокси в процессе. Параметры
+// прокси берутся из конфига, если он есть; авторизация клиентов, HA и discovery
+// отключаются, кеш создается во временном каталоге. Адрес прокси записывается в opts.target
+func startBenchProxy(opts *benchOptions) (func(), error) {
+	if opts.fake > 9 {
+		return nil, fmt.Errorf("-fake: at most 9 servers")
+	}
+	dir, err := os.MkdirTemp("", "zabbixapiproxy-bench")
+	if err != nil {
+		return nil, err
+	}
+	// Ошибки прокси выводятся в консоль, лог в файл - во временный каталог
+	logger.InitLogger(logger.Logging{FilePath: filepath.Join(dir, "bench.log"), MaxSize: "5MB", MaxBackups: 1, ConsoleLevel: "error", FileLevel: "warning"})
+
+	var cfg config
+	if _, err := os.Stat(confPath); err == nil {
+		if err := loadConf(&cfg, confPath); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("load config %s: %w", confPath, err)
+		}
+	} else {
+		cfg.Logging.MaxSize = "5MB"
+		cfg.Global.ReadTimeout, cfg.Global.WriteTimeout, cfg.Global.IdleTimeout = "10", "10", "15"
+		setDefaultsConfParams(&cfg)
+	}
+	if cfg.Cache.AutoSave == "" {
+		cfg.Cache.AutoSave = "5m"
+	}
+	var (
+		stops []func()
+		prx   *proxy.Proxy
+	)
+	stop := func() {
+		for _, stopServer := range stops {
+			stopServer()
+		}
+		if prx != nil {
+			prx.Stop()
+		}
+		os.RemoveAll(dir)
+	}
+
+	cfg.Zabbix.Servers = nil
+	for i := 1; i <= opts.fake; i++ {
+		mock := zabbixmock.New(zabbixmock.Dataset{ID: i, Token: "bench", Generate: zabbixmock.GenerateConf{Hosts: opts.items, ItemsPerHost: 1}})
+		url, stopMock, err := mock.Start()
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		stops = append(stops, stopMock)
+		cfg.Zabbix.Servers = append(cfg.Zabbix.Servers, zabbix.ZabbixServer{ID: i, URL: url, Token: "bench"})
+	}
+	cfg.Global.HA = proxy.HAConf{}
+	cfg.Cache.DBPath = filepath.Join(dir, "Cache.db")
+	prx = proxy.InitProxy(cfg.Global, cfg.Zabbix, cfg.CircuitBreaker, cfg.Cache, excludeMethods(cfg))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	srv := &http.Server{Handler: proxy.SecurityHeaders(prx.AuthMiddleware(prx.Handler, "", "", "", ""))}
+	go srv.Serve(l)
+	stops = append(stops, func() { srv.Close() })
+	opts.target = "http://" + l.Addr().String() + "/"
+	fmt.Printf("In-process proxy %s with %d fake servers (%d hosts each)\n", opts.target, opts.fake, opts.items)
+	return stop, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"ZabbixAPIproxy/internal/proxy"
+)
+
+// runHashPassword выполняет подкоманду hash-password: читает пароль из первой строки
+// stdin (чтобы он не попал в историю команд) и печатает хеш для password_hash
+func runHashPassword() int {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nfailed to read password: %v\n", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "\npassword is empty")
+		}
+		return 1
+	}
+
+	hash, err := proxy.HashPassword(password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to hash password: %v\n", err)
+		return 1
+	}
+	fmt.Println(hash)
+	return 0
+}
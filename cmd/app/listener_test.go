@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestLimitListener тестирует, что соединение сверх лимита принимается
+// только после закрытия одного из активных
+func TestLimitListener(t *testing.T) {
+	const limit = 2
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLimitListener(inner, limit)
+	defer l.Close()
+
+	accepted := make(chan net.Conn, limit+1)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	for i := 0; i < limit+1; i++ {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+
+	var conns []net.Conn
+	for i := 0; i < limit; i++ {
+		select {
+		case c := <-accepted:
+			conns = append(conns, c)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Connection %d within the limit was not accepted", i+1)
+		}
+	}
+
+	// Соединение N+1 ожидает в очереди listener
+	select {
+	case <-accepted:
+		t.Fatal("Connection over the limit was accepted")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Закрытие активного соединения освобождает слот, повторное закрытие - нет
+	conns[0].Close()
+	conns[0].Close()
+	select {
+	case c := <-accepted:
+		defer c.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("Connection over the limit was not accepted after a slot was released")
+	}
+	select {
+	case <-accepted:
+		t.Fatal("Double close released more than one slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+	conns[1].Close()
+}
+
+// TestLimitListenerClose тестирует, что закрытие listener прерывает ожидание слота
+func TestLimitListenerClose(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLimitListener(inner, 1)
+
+	c, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	first, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		errCh <- err
+	}()
+	l.Close()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("Expected error from Accept on closed listener")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Accept is still waiting for a slot after Close")
+	}
+
+	// Без лимита listener не оборачивается
+	if newLimitListener(inner, 0) != inner {
+		t.Error("Expected listener without limit to be returned as is")
+	}
+}
@@ -8,10 +8,13 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"runtime"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -27,44 +30,76 @@ type config struct {
 
 	Zabbix         proxy.ZabbixConf `yaml:"zabbix"`
 	CircuitBreaker proxy.CBConf     `yaml:"circuit_breaker"`
+
+	Metrics proxy.MetricsConf `yaml:"metrics"`
+	Tracing proxy.TracingConf `yaml:"tracing"`
+
+	// Перезагрузка при изменении файла конфигурации
+	ConfigWatch configWatchConf `yaml:"config_watch"`
+
+	// Снимки профилей при превышении порогов горутин и памяти
+	Watchdog watchdogConf `yaml:"watchdog"`
 }
 
 var (
 	conf           config
 	confPath       string
+	mockPath       string // наборы данных фиктивных серверов Zabbix (режим -mock)
+	printVersion   bool   // вывести версию и завершиться (-v)
 	httpServer     *http.Server
+	prx            *proxy.Proxy
+	exporter       *metrics.Exporter // nil, если метрики отключены
 	version        = "dev"
 	confMutex      sync.RWMutex
 	stopMonitoring context.CancelFunc // для сохранения cancel функции
+	stopDiscovery  context.CancelFunc // остановка discovery серверов
+	stopHA         context.CancelFunc // остановка выборов лидера HA пары
+	stopWatch      context.CancelFunc // остановка отслеживания файлов конфигурации
+	stopWatchdog   context.CancelFunc // остановка watchdog горутин и памяти
+	// Запросы перезагрузки конфигурации при изменении файлов
+	reloadRequests = make(chan struct{}, 1)
 )
 
 func init() {
 	flag.StringVar(&confPath, "c", "config.yaml", "Path to Conf file")
-	v := flag.Bool("v", false, "Print version and exit")
-	flag.Parse()
-	if *v {
-		fmt.Println("Verison: ", version)
-		os.Exit(0)
+	flag.StringVar(&mockPath, "mock", "", "Run against built-in mock Zabbix servers from this YAML file instead of zabbix.servers")
+	flag.BoolVar(&printVersion, "v", false, "Print version and exit")
+}
+
+// defaultMetricsUpdateInterval период обновления метрик, если global.metrics_update_interval не задан
+const defaultMetricsUpdateInterval = 30 * time.Second
+
+// metricsUpdateInterval возвращает период обновления метрик из конфигурации
+func metricsUpdateInterval() time.Duration {
+	if conf.Global.MetricsUpdateInterval == "" {
+		return defaultMetricsUpdateInterval
 	}
+	return time.Duration(suffix.UnsafeToSeconds(conf.Global.MetricsUpdateInterval)) * time.Second
 }
 
 // startMetricsServer запускает сервер для метрик
 func startMetricsServer(mux *http.ServeMux, freq time.Duration) (stopMetricsServer func()) {
 	// Инициализируем экспортер метрик
-	exporter := metrics.NewExporter()
+	exporter = metrics.NewExporter(prx)
 	exporter.Start(freq) // Частота обновления метрик
 
-	// Инициализируем метрики в proxy package
-	proxy.InitMetrics(exporter)
+	// Передаем сборщик метрик в proxy
+	prx.SetMetrics(exporter)
 
 	mux.Handle(conf.Global.MetricPath, exporter.Handler())
 	mux.Handle("/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		report := prx.Health()
+		confMutex.RUnlock()
+		report.Version = version
+
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
-			"status":  "OK",
-			"version": version,
-		})
+		w.WriteHeader(report.HTTPStatus())
+		json.NewEncoder(w).Encode(report)
+	}))
+	mux.Handle("/health/schema", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		io.WriteString(w, proxy.HealthSchema)
 	}))
 
 	logger.Global.Infof("Metrics available at http://%s/%s", conf.Global.ListenAddr, conf.Global.MetricPath)
@@ -73,7 +108,30 @@ func startMetricsServer(mux *http.ServeMux, freq time.Duration) (stopMetricsServ
 }
 
 func main() {
+	// Флаги разбираются в main, а не в init, что бы тесты пакета принимали флаги -test.*
+	flag.Parse()
+	if printVersion {
+		fmt.Println("Verison: ", version)
+		os.Exit(0)
+	}
+
+	// Подкоманда воспроизведения захваченных запросов
+	if flag.Arg(0) == "replay" {
+		os.Exit(runReplay(flag.Args()[1:]))
+	}
+
+	// Подкоманда нагрузочного тестирования
+	if flag.Arg(0) == "bench" {
+		os.Exit(runBench(flag.Args()[1:]))
+	}
+
+	// Подкоманда вычисления хеша пароля для password_hash
+	if flag.Arg(0) == "hash-password" {
+		os.Exit(runHashPassword())
+	}
+
 	fmt.Println("Starting Zabbix API proxy version ", version)
+	proxy.Version = version
 
 	// Загружаем конфиг
 	if err := loadConf(&conf, confPath); err != nil {
@@ -84,12 +142,18 @@ func main() {
 	// Инициализируем логер
 	logger.InitLogger(conf.Logging)
 
+	// При обновлении бинарника кеш открывается после остановки предыдущего процесса
+	waitPreviousProcess(upgradeReleaseTimeout)
+
+	//Инициализируем proxy.Zbx до вывода в лог
+	prx = proxy.InitProxy(conf.Global, conf.Zabbix, conf.CircuitBreaker, conf.Cache, excludeMethods(conf))
+
 	// Создаем мультиплексор для обработки разных путей
 	mux := http.NewServeMux()
 
 	// Запускаем сбор Prometheus метрик
 	if conf.Global.MetricPath != "" {
-		stop_exporter := startMetricsServer(mux, 30*time.Second)
+		stop_exporter := startMetricsServer(mux, metricsUpdateInterval())
 		defer stop_exporter()
 	}
 
@@ -97,44 +161,153 @@ func main() {
 	if conf.Global.MonitoringInLog {
 		stopMonitoring = startMonitoring()
 	}
-
-	//Инициализируем proxy.Zbx до вывода в лог
-	proxy.InitProxy(conf.Global, conf.Zabbix, conf.CircuitBreaker, conf.Cache, conf.Logging.ExcludeRequests)
+	stopWatchdog = startWatchdog(conf.Watchdog)
 
 	logger.Global.Infof("Loaded %d servers from configuration", len(conf.Zabbix.Servers))
 
+	// Динамическое обновление списка серверов
+	stopDiscovery = prx.StartDiscovery(&confMutex)
+
+	// Выборы лидера HA пары (изменение ha.etcd требует перезапуска)
+	stopHA = prx.StartHA(&confMutex)
+
 	// Канал для graceful shutdown
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
 
 	// Основной эндпоинт API
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		confMutex.RLock()
-		proxy.AuthMiddleware(proxy.Handler, conf.Global.MetricPath, conf.Global.Login, conf.Global.Password, conf.Global.Token)(w, r)
+		prx.ServeHTTP(w, r)
+		confMutex.RUnlock()
+	})
+
+	// Списки значений переменных Grafana
+	mux.HandleFunc("/grafana/variables", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.ServeGrafanaVariables(w, r)
+		confMutex.RUnlock()
+	})
+
+	// Служебные эндпоинты
+	mux.HandleFunc("/admin/cache/flush", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.AdminMiddleware(prx.AdminCacheFlushHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.RUnlock()
+	})
+	mux.HandleFunc("/admin/cache/save", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.AdminMiddleware(prx.AdminCacheSaveHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.RUnlock()
+	})
+	mux.HandleFunc("/admin/cache/cleanup", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.AdminMiddleware(prx.AdminCacheCleanupHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.RUnlock()
+	})
+	mux.HandleFunc("/admin/recorder", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.AdminMiddleware(prx.AdminRecorderHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.RUnlock()
+	})
+	mux.HandleFunc("/admin/top", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.AdminReadMiddleware(prx.AdminTopHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.RUnlock()
+	})
+	mux.HandleFunc("/admin/status", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.AdminReadMiddleware(prx.AdminStatusHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.RUnlock()
+	})
+	mux.HandleFunc("/admin/log/level", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.AdminMiddleware(prx.AdminLogLevelHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.RUnlock()
+	})
+	mux.HandleFunc("/admin/auth/unlock", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.AdminMiddleware(prx.AdminAuthUnlockHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.RUnlock()
+	})
+	mux.HandleFunc("/admin/tokens", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.AdminReadMiddleware(prx.AdminTokensHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.RUnlock()
+	})
+	// Веб-интерфейс администратора на основе служебных эндпоинтов
+	mux.HandleFunc("/admin/ui", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.AdminReadMiddleware(prx.AdminUIHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.RUnlock()
+	})
+	// Смена роли HA открывает или закрывает кеш, поэтому выполняется под блокировкой на запись
+	mux.HandleFunc("/admin/ha", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.Lock()
+		prx.AdminMiddleware(prx.AdminHAHandler, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
+		confMutex.Unlock()
+	})
+	// Копия файла кеша для пассивного узла пары (ha.peer). Под блокировкой копия
+	// только готовится, передача пассивному узлу идет после ее снятия
+	mux.HandleFunc("/admin/ha/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		var snapshot *proxy.HASnapshot
+		confMutex.RLock()
+		prx.AdminReadMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			snapshot = prx.PrepareHASnapshot(w)
+		}, conf.Global.Login, conf.Global.AuthPassword(), conf.Global.Token)(w, r)
 		confMutex.RUnlock()
+		snapshot.Send(w)
 	})
 
+	// Описание собственных эндпоинтов proxy (OpenAPI)
+	mux.HandleFunc("/.well-known/proxy-api", func(w http.ResponseWriter, r *http.Request) {
+		confMutex.RLock()
+		prx.ProxyAPIHandler(w, r)
+		confMutex.RUnlock()
+	})
+
+	// Готовность узла принимать запросы (пассивный узел HA пары отвечает 503)
+	mux.HandleFunc("/ready", proxy.ReadyHandler)
+
 	// Настройка сервера HTTP сервера
 	httpServer = &http.Server{
-		Addr:         conf.Global.ListenAddr,
-		Handler:      mux,
-		ReadTimeout:  time.Duration(suffix.UnsafeToSeconds(conf.Global.ReadTimeout)) * time.Second,
-		WriteTimeout: time.Duration(suffix.UnsafeToSeconds(conf.Global.WriteTimeout)) * time.Second,
-		IdleTimeout:  time.Duration(suffix.UnsafeToSeconds(conf.Global.IdleTimeout)) * time.Second,
+		Addr:    conf.Global.ListenAddr,
+		Handler: proxy.SecurityHeaders(mux),
+	}
+	if conf.Global.MetricPath != "" {
+		httpServer.ConnState = metrics.TrackConnState
+	}
+	setServerLimits(httpServer)
+
+	// Открываем порт (или наследуем от предыдущего процесса) с ограничением количества соединений
+	baseListener, err := listen(conf.Global.ListenAddr)
+	if err != nil {
+		logger.Global.Errorf("Failed to listen on %s: %v", conf.Global.ListenAddr, err)
+		os.Exit(1)
+	}
+	listener := newLimitListener(baseListener, conf.Global.MaxConnections)
+	if conf.Global.MetricPath != "" {
+		listener = metrics.TrackListener(listener)
 	}
 
 	// Запуск сервера в отдельной горутине
 	serverErr := make(chan error, 1)
 	go func() {
 		logger.Global.Infof("Starting proxy on %s", conf.Global.ListenAddr)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
 			serverErr <- err
 		}
 	}()
 
+	// Перезагрузка при изменении файлов конфигурации (альтернатива SIGHUP)
+	stopWatch = startConfigWatch(conf.ConfigWatch, confPath, reloadRequests)
+
 	// Обработка сигналов
 	for {
 		select {
+		case <-reloadRequests:
+			reloadConfiguration()
+
 		case sig := <-stop:
 			switch sig {
 			case syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
@@ -145,6 +318,28 @@ func main() {
 			case syscall.SIGHUP:
 				logger.Global.Info("Received SIGHUP, reloading configuration")
 				reloadConfiguration()
+
+			case syscall.SIGUSR1:
+				logger.Global.Info("Received SIGUSR1, rotating log file")
+				if err := logger.Rotate(); err != nil {
+					logger.Global.Errorf("Log rotation failed: %v", err)
+				}
+
+			case syscall.SIGUSR2:
+				logger.Global.Info("Received SIGUSR2, upgrading binary")
+				release, err := upgradeBinary(baseListener)
+				if err != nil {
+					logger.Global.Errorf("Binary upgrade failed, continue serving: %v", err)
+					continue
+				}
+				// Перестаем принимать соединения и даем уже принятым передать запрос:
+				// запросы, прочитанные после начала Shutdown, net/http закрывает без ответа
+				listener.Close()
+				time.Sleep(upgradeDrainDelay)
+				gracefulShutdown()
+				// БД кеша закрыта, новый процесс может ее открыть
+				release.Close()
+				return
 			}
 
 		case err := <-serverErr:
@@ -157,10 +352,8 @@ func main() {
 
 func gracefulShutdown() {
 	fmt.Println("Stopping Zabbix API proxy gracefully...")
-	// Останавливаем proxy
-	proxy.StopProxy()
-
-	// Graceful shutdown HTTP сервера
+	// Graceful shutdown HTTP сервера: перестаем принимать соединения и дожидаемся
+	// выполнения текущих запросов до остановки proxy
 	if httpServer != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
@@ -170,6 +363,17 @@ func gracefulShutdown() {
 		}
 	}
 
+	// Останавливаем proxy (сохранение кеша освобождает БД для нового процесса)
+	if stopDiscovery != nil {
+		stopDiscovery()
+	}
+	prx.Stop()
+
+	// Лидерство освобождаем после сохранения кеша, что бы второй узел открыл актуальный кеш
+	if stopHA != nil {
+		stopHA()
+	}
+
 	logger.Global.Info("Server stopped gracefully")
 }
 
@@ -184,33 +388,90 @@ func reloadConfiguration() {
 	confMutex.Lock()
 	defer confMutex.Unlock()
 
-	// Останавливаем старые компоненты
-	if stopMonitoring != nil {
-		stopMonitoring()
+	// Обновляем конфигурацию. Перезапускаются только подсистемы с измененными параметрами
+	oldConf := conf
+	oldMaxConnections := conf.Global.MaxConnections
+	conf = newConf
+	var restarted []string
+
+	if !reflect.DeepEqual(oldConf.Logging, conf.Logging) {
+		logger.InitLogger(conf.Logging)
+		restarted = append(restarted, "logger")
+	}
+
+	if oldConf.Global.MonitoringInLog != conf.Global.MonitoringInLog {
+		if stopMonitoring != nil {
+			stopMonitoring()
+			stopMonitoring = nil
+		}
+		if conf.Global.MonitoringInLog {
+			stopMonitoring = startMonitoring()
+		}
+		restarted = append(restarted, "monitoring")
 	}
 
-	// Останавливаем proxy
-	proxy.StopProxy()
+	// Экспортер перезапускается с новым периодом, значения метрик сохраняются
+	if oldConf.Global.MetricsUpdateInterval != conf.Global.MetricsUpdateInterval && exporter != nil {
+		exporter.Stop()
+		exporter.Start(metricsUpdateInterval())
+		restarted = append(restarted, "metrics updater")
+	}
 
-	// Обновляем конфигурацию
-	conf = newConf
+	if !reflect.DeepEqual(oldConf.Watchdog, conf.Watchdog) {
+		if stopWatchdog != nil {
+			stopWatchdog()
+		}
+		stopWatchdog = startWatchdog(conf.Watchdog)
+		restarted = append(restarted, "watchdog")
+	}
 
-	proxy.InitProxy(conf.Global, conf.Zabbix, conf.CircuitBreaker, conf.Cache, conf.Logging.ExcludeRequests)
+	// Discovery использует список серверов конфига, поэтому перезапускается при его изменении
+	zabbixChanged := !reflect.DeepEqual(oldConf.Zabbix, conf.Zabbix)
+	if zabbixChanged && stopDiscovery != nil {
+		stopDiscovery()
+		stopDiscovery = nil
+	}
 
-	// Переинициализируем логер
-	logger.InitLogger(conf.Logging)
+	restarted = append(restarted, prx.Reload(conf.Global, conf.Zabbix, conf.CircuitBreaker, conf.Cache, excludeMethods(conf))...)
 
-	// Перезапускаем мониторинг
-	if conf.Global.MonitoringInLog {
-		stopMonitoring = startMonitoring()
+	if zabbixChanged {
+		stopDiscovery = prx.StartDiscovery(&confMutex)
+		restarted = append(restarted, "discovery")
+	}
+
+	if !reflect.DeepEqual(oldConf.ConfigWatch, conf.ConfigWatch) {
+		if stopWatch != nil {
+			stopWatch()
+		}
+		stopWatch = startConfigWatch(conf.ConfigWatch, confPath, reloadRequests)
+		restarted = append(restarted, "config watch")
 	}
 
 	//Устанавливаем таймауты httpServer
-	httpServer.ReadTimeout = time.Duration(suffix.UnsafeToSeconds(conf.Global.ReadTimeout)) * time.Second
-	httpServer.WriteTimeout = time.Duration(suffix.UnsafeToSeconds(conf.Global.WriteTimeout)) * time.Second
-	httpServer.IdleTimeout = time.Duration(suffix.UnsafeToSeconds(conf.Global.IdleTimeout)) * time.Second
+	setServerLimits(httpServer)
+	if conf.Global.MaxConnections != oldMaxConnections {
+		logger.Global.Warningf("'max_connections' change requires restart, current limit: %d", oldMaxConnections)
+	}
 
-	logger.Global.Info("Configuration reloaded successfully")
+	if len(restarted) == 0 {
+		logger.Global.Info("Configuration reloaded successfully")
+	} else {
+		logger.Global.Infof("Configuration reloaded successfully, restarted: %s", strings.Join(restarted, ", "))
+	}
+}
+
+// setServerLimits устанавливает таймауты и ограничения заголовков HTTP сервера из конфигурации
+func setServerLimits(srv *http.Server) {
+	srv.ReadTimeout = time.Duration(suffix.UnsafeToSeconds(conf.Global.ReadTimeout)) * time.Second
+	srv.WriteTimeout = time.Duration(suffix.UnsafeToSeconds(conf.Global.WriteTimeout)) * time.Second
+	srv.IdleTimeout = time.Duration(suffix.UnsafeToSeconds(conf.Global.IdleTimeout)) * time.Second
+	// Пустое значение - используется read_timeout
+	srv.ReadHeaderTimeout = time.Duration(suffix.UnsafeToSeconds(conf.Global.ReadHeaderTimeout)) * time.Second
+	// Пустое значение - значение по умолчанию net/http (1MB)
+	srv.MaxHeaderBytes = 0
+	if b, err := suffix.ToB(conf.Global.MaxHeaderBytes); err == nil {
+		srv.MaxHeaderBytes = int(b)
+	}
 }
 
 func startMonitoring() context.CancelFunc {
@@ -234,12 +495,12 @@ func startMonitoring() context.CancelFunc {
 					bToMb(m.Alloc), bToMb(m.TotalAlloc), bToMb(m.Sys), m.NumGC)
 
 				// Мониторинг кеша
-				if stats, ok := proxy.GetCacheStats(); ok {
+				if stats, ok := prx.GetCacheStats(); ok {
 					logger.Global.Infof("Cache stats: %+v", stats)
 				}
 
 				// Мониторинг HTTP клиентов
-				clientStats := proxy.GetConnectionStats()
+				clientStats := prx.GetConnectionStats()
 				logger.Global.Infof("HTTP clients stats: %+v", clientStats)
 
 				// Предупреждение при большом количестве горутин
@@ -287,6 +548,22 @@ func setDefaultsConfParams(conf *config) {
 	if conf.Logging.MaxBackups == 0 {
 		conf.Logging.MaxBackups = 3
 	}
+	if conf.Logging.MaxAge != "" {
+		if _, err := suffix.ToSeconds(conf.Logging.MaxAge); err != nil {
+			logger.Global.Errorf("convert error 'max_age' to seconds: %s", err)
+			conf.Logging.MaxAge = ""
+		}
+	}
+	switch conf.Logging.Rotate {
+	case "", logger.RotateHourly, logger.RotateDaily:
+	default:
+		logger.Global.Errorf("unknown 'logging.rotate' %q, expected hourly or daily: time-based rotation disabled", conf.Logging.Rotate)
+		conf.Logging.Rotate = ""
+	}
+	if conf.Logging.CompressLevel < 0 || conf.Logging.CompressLevel > 9 {
+		logger.Global.Errorf("'logging.compress_level' must be 1-9, got %d: default level used", conf.Logging.CompressLevel)
+		conf.Logging.CompressLevel = 0
+	}
 	if conf.Logging.FileLevel == "" {
 		conf.Logging.FileLevel = "Warning"
 	}
@@ -303,6 +580,47 @@ func setDefaultsConfParams(conf *config) {
 		logger.Global.Errorf("convert error 'idle_timeout' to seconds: %s", err)
 		conf.Global.IdleTimeout = "15"
 	}
+	if conf.Global.MetricsUpdateInterval != "" {
+		if r, err := suffix.ToSeconds(conf.Global.MetricsUpdateInterval); err != nil || r == 0 {
+			logger.Global.Errorf("invalid 'metrics_update_interval' %s, using %v", conf.Global.MetricsUpdateInterval, defaultMetricsUpdateInterval)
+			conf.Global.MetricsUpdateInterval = ""
+		}
+	}
+	if conf.Global.ReadHeaderTimeout != "" {
+		if _, err := suffix.ToSeconds(conf.Global.ReadHeaderTimeout); err != nil {
+			logger.Global.Errorf("convert error 'read_header_timeout' to seconds: %s", err)
+			conf.Global.ReadHeaderTimeout = ""
+		}
+	}
+	if conf.Global.MaxHeaderBytes != "" {
+		if _, err := suffix.ToB(conf.Global.MaxHeaderBytes); err != nil {
+			logger.Global.Errorf("convert error 'max_header_bytes' to bytes: %s", err)
+			conf.Global.MaxHeaderBytes = ""
+		}
+	}
+	conf.CircuitBreaker.SetDefaults()
+
+	if conf.Global.MaxConnections < 0 {
+		logger.Global.Errorf("'max_connections' must not be negative, got %d: limit disabled", conf.Global.MaxConnections)
+		conf.Global.MaxConnections = 0
+	}
+
+	// exclude_requests исключал методы и из логирования, и из трассировки
+	if len(conf.Logging.ExcludeRequests) > 0 {
+		logger.Global.Warningf("'logging.exclude_requests' is deprecated, use 'logging.exclude_methods' and 'tracing.exclude_methods'")
+		conf.Logging.ExcludeMethods = append(conf.Logging.ExcludeMethods, conf.Logging.ExcludeRequests...)
+		conf.Tracing.ExcludeMethods = append(conf.Tracing.ExcludeMethods, conf.Logging.ExcludeRequests...)
+		conf.Logging.ExcludeRequests = nil
+	}
+}
+
+// excludeMethods собирает перечни методов, исключаемых из логирования, метрик и трассировки
+func excludeMethods(conf config) proxy.ExcludeMethods {
+	return proxy.ExcludeMethods{
+		Log:     conf.Logging.ExcludeMethods,
+		Metrics: conf.Metrics.ExcludeMethods,
+		Tracing: conf.Tracing.ExcludeMethods,
+	}
 }
 
 func loadConf(cfg *config, cfgPath string) error {
@@ -317,10 +635,20 @@ func loadConf(cfg *config, cfgPath string) error {
 		return err
 	}
 
-	// Валидация server.id
-	for i, server := range cfg.Zabbix.Servers {
-		if server.ID < 1 || server.ID > 9 {
-			return fmt.Errorf("server[%d] id must be between 1 and 9, got %d", i, server.ID)
+	if mockPath != "" {
+		if err := applyMock(cfg); err != nil {
+			return err
+		}
+	}
+
+	// Валидация серверов: повтор ID или URL портит маппинг ProxyID
+	if err := proxy.ValidateServers(cfg.Zabbix); err != nil {
+		return fmt.Errorf("invalid zabbix servers:\n%w", err)
+	}
+
+	if cfg.Global.PasswordHash != "" {
+		if err := proxy.CheckPasswordHash(cfg.Global.PasswordHash); err != nil {
+			return fmt.Errorf("password_hash: %w", err)
 		}
 	}
 
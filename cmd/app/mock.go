@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"ZabbixAPIproxy/internal/zabbix"
+	"ZabbixAPIproxy/internal/zabbixmock"
+)
+
+// Серверы, запущенные в режиме -mock. Запускаются при первой загрузке конфига
+// и сохраняются при перезагрузке
+var mockServers []zabbix.ZabbixServer
+
+// applyMock заменяет серверы конфига фиктивными серверами Zabbix из файла mockPath.
+// Discovery отключается, что бы к фиктивным серверам не добавлялись реальные
+func applyMock(cfg *config) error {
+	if mockServers == nil {
+		datasets, err := zabbixmock.Load(mockPath)
+		if err != nil {
+			return fmt.Errorf("mock: %w", err)
+		}
+		for _, data := range datasets {
+			url, _, err := zabbixmock.New(data).Start()
+			if err != nil {
+				return fmt.Errorf("mock server %d: %w", data.ID, err)
+			}
+			// Сервер без токена запросы не проверяет, но токен в конфиге обязателен
+			token := data.Token
+			if token == "" {
+				token = "mock"
+			}
+			mockServers = append(mockServers, zabbix.ZabbixServer{ID: data.ID, URL: url, Token: token})
+			fmt.Printf("Mock Zabbix server %d: %s\n", data.ID, url)
+		}
+	}
+	cfg.Zabbix.Servers = slices.Clone(mockServers)
+	cfg.Zabbix.Discovery = zabbix.DiscoveryConf{}
+	return nil
+}
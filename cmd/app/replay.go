@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// replayRecord запрос для воспроизведения и ожидаемые ответы
+type replayRecord struct {
+	TraceID  string          `json:"trace_id"`
+	Request  map[string]any  `json:"request"`
+	Response map[string]any  `json:"response"`
+	Servers  []replayCapture `json:"servers"`
+}
+
+// replayCapture запрос к серверу и его ответ, захваченные бортовым самописцем
+type replayCapture struct {
+	ServerID int            `json:"server_id"`
+	URL      string         `json:"url"`
+	Request  map[string]any `json:"request"`
+	Response map[string]any `json:"response"`
+}
+
+// replayOptions параметры подкоманды replay
+type replayOptions struct {
+	file      string
+	target    string
+	compare   string
+	token     string
+	upstream  bool
+	ignoreSSL bool
+	timeout   time.Duration
+}
+
+// runReplay выполняет подкоманду replay и возвращает код завершения:
+// 0 - все ответы совпали, 1 - есть расхождения или ошибки, 2 - ошибка параметров
+func runReplay(args []string) int {
+	var opts replayOptions
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.StringVar(&opts.file, "f", "", "File with captured requests: /admin/recorder response, JSON array or JSON lines ('-' for stdin)")
+	fs.StringVar(&opts.target, "target", "", "Proxy URL to re-issue client requests to")
+	fs.StringVar(&opts.compare, "compare", "", "Second proxy URL to compare responses with (instead of recorded responses)")
+	fs.StringVar(&opts.token, "token", "", "Bearer token for the proxy")
+	fs.BoolVar(&opts.upstream, "upstream", false, "Re-issue captured per-server requests directly to Zabbix servers from the config")
+	fs.BoolVar(&opts.ignoreSSL, "ignore-ssl", false, "Skip TLS verification")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "Request timeout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [-c config.yaml] replay -f FILE (-target URL [-compare URL] | -upstream)\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.file == "" || (opts.target == "" && !opts.upstream) {
+		fs.Usage()
+		return 2
+	}
+
+	records, err := readReplayRecords(opts.file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", opts.file, err)
+		return 2
+	}
+
+	client := &http.Client{Timeout: opts.timeout}
+	if opts.ignoreSSL {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+
+	var failed int
+	if opts.upstream {
+		failed, err = replayUpstream(client, records)
+	} else {
+		failed = replayProxy(client, records, opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay failed: %v\n", err)
+		return 2
+	}
+
+	fmt.Printf("Replayed %d requests, %d mismatched or failed\n", len(records), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readReplayRecords читает запросы из ответа /admin/recorder, JSON массива
+// записей или запросов JSON-RPC, либо из JSON lines
+func readReplayRecords(path string) ([]replayRecord, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	var raw []json.RawMessage
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(trimmed, []byte("{")) && bytes.Contains(trimmed, []byte(`"records"`)):
+		var dump struct {
+			Records []json.RawMessage `json:"records"`
+		}
+		if err := json.Unmarshal(trimmed, &dump); err != nil {
+			return nil, err
+		}
+		raw = dump.Records
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				raw = append(raw, json.RawMessage(bytes.Clone(line)))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	records := make([]replayRecord, 0, len(raw))
+	for i, item := range raw {
+		var rec replayRecord
+		if err := json.Unmarshal(item, &rec); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		// Голый запрос JSON-RPC, а не запись самописца
+		if rec.Request == nil {
+			if err := json.Unmarshal(item, &rec.Request); err != nil {
+				return nil, fmt.Errorf("record %d: %w", i, err)
+			}
+		}
+		if rec.TraceID == "" {
+			rec.TraceID = fmt.Sprintf("#%d", i+1)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// replayProxy отправляет запросы клиентов на прокси и сравнивает ответы с
+// записанными либо с ответами второго прокси. Возвращает количество расхождений
+func replayProxy(client *http.Client, records []replayRecord, opts replayOptions) int {
+	failed := 0
+	for _, rec := range records {
+		got, err := postJSONRPC(client, opts.target, opts.token, rec.Request)
+		if err != nil {
+			fmt.Printf("[%s] %v: ERROR %v\n", rec.TraceID, rec.Request["method"], err)
+			failed++
+			continue
+		}
+
+		want := rec.Response
+		if opts.compare != "" {
+			want, err = postJSONRPC(client, opts.compare, opts.token, rec.Request)
+			if err != nil {
+				fmt.Printf("[%s] %v: ERROR %s: %v\n", rec.TraceID, rec.Request["method"], opts.compare, err)
+				failed++
+				continue
+			}
+		}
+
+		if !reportReplay(rec.TraceID, rec.Request["method"], want, got) {
+			failed++
+		}
+	}
+	return failed
+}
+
+// replayUpstream отправляет захваченные запросы напрямую серверам Zabbix из
+// конфигурации и сравнивает с записанными ответами
+func replayUpstream(client *http.Client, records []replayRecord) (int, error) {
+	if err := loadConf(&conf, confPath); err != nil {
+		return 0, fmt.Errorf("load config %s: %w", confPath, err)
+	}
+	tokens := make(map[int]string, len(conf.Zabbix.Servers))
+	urls := make(map[int]string, len(conf.Zabbix.Servers))
+	for _, srv := range conf.Zabbix.Servers {
+		tokens[srv.ID] = srv.Token
+		urls[srv.ID] = srv.URL
+	}
+
+	failed := 0
+	for _, rec := range records {
+		if len(rec.Servers) == 0 {
+			fmt.Printf("[%s] %v: SKIP no captured server requests\n", rec.TraceID, rec.Request["method"])
+			continue
+		}
+		for _, capture := range rec.Servers {
+			url, ok := urls[capture.ServerID]
+			if !ok {
+				fmt.Printf("[%s] server %d: SKIP not in config\n", rec.TraceID, capture.ServerID)
+				continue
+			}
+			// Токен в захваченном запросе скрыт, подставляем токен из конфигурации
+			capture.Request["auth"] = tokens[capture.ServerID]
+
+			got, err := postJSONRPC(client, url, "", capture.Request)
+			label := fmt.Sprintf("%s/server %d", rec.TraceID, capture.ServerID)
+			if err != nil {
+				fmt.Printf("[%s] %v: ERROR %v\n", label, capture.Request["method"], err)
+				failed++
+				continue
+			}
+			if !reportReplay(label, capture.Request["method"], capture.Response, got) {
+				failed++
+			}
+		}
+	}
+	return failed, nil
+}
+
+// postJSONRPC отправляет запрос JSON-RPC и возвращает разобранный ответ
+func postJSONRPC(client *http.Client, url, token string, request map[string]any) (map[string]any, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var response map[string]any
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// reportReplay сравнивает результаты ответов и печатает итог. Служебные поля
+// (id, meta) не сравниваются. Без ожидаемого ответа только выводится результат
+func reportReplay(label string, method any, want, got map[string]any) bool {
+	if want == nil {
+		fmt.Printf("[%s] %v: DONE (nothing to compare)\n", label, method)
+		return true
+	}
+	if reflect.DeepEqual(want["result"], got["result"]) && reflect.DeepEqual(want["error"], got["error"]) {
+		fmt.Printf("[%s] %v: OK\n", label, method)
+		return true
+	}
+
+	wantJSON, _ := json.Marshal(map[string]any{"result": want["result"], "error": want["error"]})
+	gotJSON, _ := json.Marshal(map[string]any{"result": got["result"], "error": got["error"]})
+	fmt.Printf("[%s] %v: DIFF\n  want: %s\n  got:  %s\n", label, method, wantJSON, gotJSON)
+	return false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestReadReplayRecords тестирует чтение запросов из поддерживаемых форматов файла
+func TestReadReplayRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		traces  []string
+		methods []string
+		servers []int // Количество захваченных запросов к серверам по записям
+	}{
+		{
+			name: "recorder dump",
+			data: `{"status":"OK","records":[
+				{"trace_id":"abc","request":{"jsonrpc":"2.0","method":"host.get","id":1},
+				 "response":{"jsonrpc":"2.0","result":[],"id":1},
+				 "servers":[{"server_id":1,"url":"http://zbx1","request":{"method":"host.get"},"response":{"result":[]}}]},
+				{"trace_id":"def","request":{"jsonrpc":"2.0","method":"item.get","id":2}}
+			]}`,
+			traces:  []string{"abc", "def"},
+			methods: []string{"host.get", "item.get"},
+			servers: []int{1, 0},
+		},
+		{
+			name: "JSON array of records and bare requests",
+			data: `[
+				{"trace_id":"abc","request":{"jsonrpc":"2.0","method":"host.get","id":1}},
+				{"jsonrpc":"2.0","method":"item.get","params":{},"id":2}
+			]`,
+			traces:  []string{"abc", "#2"},
+			methods: []string{"host.get", "item.get"},
+			servers: []int{0, 0},
+		},
+		{
+			name: "JSON lines",
+			data: `{"jsonrpc":"2.0","method":"host.get","id":1}
+
+{"trace_id":"xyz","request":{"jsonrpc":"2.0","method":"item.get","id":2}}
+`,
+			traces:  []string{"#1", "xyz"},
+			methods: []string{"host.get", "item.get"},
+			servers: []int{0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "records.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			records, err := readReplayRecords(path)
+			if err != nil {
+				t.Fatalf("readReplayRecords failed: %v", err)
+			}
+			if len(records) != len(tt.traces) {
+				t.Fatalf("Expected %d records, got %d", len(tt.traces), len(records))
+			}
+			for i, rec := range records {
+				if rec.TraceID != tt.traces[i] {
+					t.Errorf("Record %d: expected trace_id %s, got %s", i, tt.traces[i], rec.TraceID)
+				}
+				if rec.Request["method"] != tt.methods[i] {
+					t.Errorf("Record %d: expected method %s, got %v", i, tt.methods[i], rec.Request["method"])
+				}
+				if len(rec.Servers) != tt.servers[i] {
+					t.Errorf("Record %d: expected %d server captures, got %d", i, tt.servers[i], len(rec.Servers))
+				}
+			}
+		})
+	}
+
+	t.Run("invalid record", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "records.json")
+		if err := os.WriteFile(path, []byte("{\"method\":\"host.get\"}\nnot json\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readReplayRecords(path); err == nil || !strings.Contains(err.Error(), "record 1") {
+			t.Errorf("Expected error for record 1, got %v", err)
+		}
+	})
+}
+
+// captureStdout возвращает вывод fn в stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// TestReportReplay тестирует сравнение ответов и вывод расхождений
+func TestReportReplay(t *testing.T) {
+	want := map[string]any{"jsonrpc": "2.0", "result": []any{"1", "2"}, "id": 1.0}
+
+	var ok bool
+	out := captureStdout(t, func() {
+		ok = reportReplay("abc", "host.get", want, map[string]any{"result": []any{"1", "2"}, "id": 7.0, "meta": map[string]any{}})
+	})
+	if !ok || out != "[abc] host.get: OK\n" {
+		t.Errorf("Expected match ignoring id and meta, got %t: %q", ok, out)
+	}
+
+	out = captureStdout(t, func() {
+		ok = reportReplay("abc/server 2", "host.get", want, map[string]any{"result": []any{"1"}})
+	})
+	expected := "[abc/server 2] host.get: DIFF\n" +
+		"  want: {\"error\":null,\"result\":[\"1\",\"2\"]}\n" +
+		"  got:  {\"error\":null,\"result\":[\"1\"]}\n"
+	if ok || out != expected {
+		t.Errorf("Expected mismatch report %q, got %t: %q", expected, ok, out)
+	}
+
+	out = captureStdout(t, func() {
+		ok = reportReplay("abc", "host.get", nil, map[string]any{"result": []any{}})
+	})
+	if !ok || !strings.Contains(out, "DONE (nothing to compare)") {
+		t.Errorf("Expected nothing to compare, got %t: %q", ok, out)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	// listenFDEnv - переменная окружения с номером дескриптора унаследованного listener
+	listenFDEnv = "ZAP_LISTEN_FD"
+	// releaseFDEnv - переменная окружения с номером дескриптора канала, который
+	// предыдущий процесс закрывает после остановки (освобождения БД кеша)
+	releaseFDEnv = "ZAP_RELEASE_FD"
+	// upgradeReleaseTimeout - наибольшее ожидание остановки предыдущего процесса
+	upgradeReleaseTimeout = time.Minute
+	// upgradeGrace - время, в течение которого новый процесс не должен завершиться,
+	// чтобы обновление считалось успешным
+	upgradeGrace = 2 * time.Second
+	// upgradeDrainDelay - пауза между закрытием listener и остановкой сервера
+	upgradeDrainDelay = 500 * time.Millisecond
+)
+
+// listen открывает порт прокси или использует listener, унаследованный от
+// предыдущего процесса при обновлении бинарника
+func listen(addr string) (net.Listener, error) {
+	fdStr := os.Getenv(listenFDEnv)
+	if fdStr == "" {
+		return net.Listen("tcp", addr)
+	}
+	os.Unsetenv(listenFDEnv)
+
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value '%s': %w", listenFDEnv, fdStr, err)
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("inherit listener from fd %d: %w", fd, err)
+	}
+	logger.Global.Infof("Inherited listener on %s from previous process", l.Addr())
+	return l, nil
+}
+
+// waitPreviousProcess при обновлении бинарника ждет, пока предыдущий процесс
+// остановится и освободит БД кеша: bbolt блокирует файл, и открытие кеша до этого
+// зависло бы. Канал закрывается и при аварийном завершении предыдущего процесса
+func waitPreviousProcess(timeout time.Duration) {
+	fdStr := os.Getenv(releaseFDEnv)
+	if fdStr == "" {
+		return
+	}
+	os.Unsetenv(releaseFDEnv)
+
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil {
+		logger.Global.Errorf("Invalid %s value '%s': %v", releaseFDEnv, fdStr, err)
+		return
+	}
+	f := os.NewFile(uintptr(fd), "release")
+	defer f.Close()
+
+	released := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, f)
+		close(released)
+	}()
+	logger.Global.Info("Waiting for the previous process to release the cache")
+	select {
+	case <-released:
+		logger.Global.Info("Previous process stopped, opening the cache")
+	case <-time.After(timeout):
+		logger.Global.Warningf("Previous process did not stop in %v, opening the cache anyway", timeout)
+	}
+}
+
+// upgradeBinary запускает новый экземпляр бинарника с теми же аргументами и
+// передает ему открытый listener. Новый процесс открывает кеш только после
+// закрытия возвращаемого release (см. waitPreviousProcess): вызывающий закрывает
+// его после остановки proxy. Входящие соединения, пришедшие до готовности
+// нового процесса, ожидают в очереди сокета
+func upgradeBinary(l net.Listener) (release *os.File, err error) {
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("listener %T does not support descriptor handoff", l)
+	}
+	f, err := tl.File()
+	if err != nil {
+		return nil, fmt.Errorf("get listener descriptor: %w", err)
+	}
+	defer f.Close()
+
+	path, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("get executable path: %w", err)
+	}
+
+	wait, release, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create release pipe: %w", err)
+	}
+	defer wait.Close()
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// ExtraFiles[i] в дочернем процессе получает дескриптор 3+i
+	cmd.ExtraFiles = []*os.File{f, wait}
+	cmd.Env = append(os.Environ(), listenFDEnv+"=3", releaseFDEnv+"=4")
+
+	if err := cmd.Start(); err != nil {
+		release.Close()
+		return nil, fmt.Errorf("start new process: %w", err)
+	}
+
+	// Убеждаемся, что новый процесс не упал сразу после старта (например, из-за конфига)
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		release.Close()
+		return nil, fmt.Errorf("new process %d exited: %v", cmd.Process.Pid, err)
+	case <-time.After(upgradeGrace):
+	}
+
+	logger.Global.Infof("New process %d started (%s), handing over listener", cmd.Process.Pid, path)
+	return release, nil
+}
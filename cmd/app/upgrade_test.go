@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/cache"
+)
+
+// upgradeChildEnv путь к БД кеша для дочернего процесса TestUpgradeHelperProcess
+const upgradeChildEnv = "ZAP_TEST_UPGRADE_DB"
+
+func upgradeTestCacheCfg(path string) cache.CacheCfg {
+	return cache.CacheCfg{TTL: "1h", CleanupInterval: "1m", AutoSave: "1m", DBPath: path,
+		CachedFields: map[string]string{"host": "name"}}
+}
+
+// TestUpgradeHelperProcess новый процесс при обновлении бинарника: наследует listener,
+// ждет остановки предыдущего процесса, открывает кеш без ожидания блокировки
+// и отвечает на одно соединение
+func TestUpgradeHelperProcess(t *testing.T) {
+	dbPath := os.Getenv(upgradeChildEnv)
+	if dbPath == "" {
+		return
+	}
+	l, err := listen("")
+	if err != nil {
+		os.Exit(2)
+	}
+	waitPreviousProcess(upgradeReleaseTimeout)
+
+	c, err := cache.Open(upgradeTestCacheCfg(dbPath), 100*time.Millisecond)
+	if err != nil {
+		os.Exit(3)
+	}
+	defer c.Stop()
+
+	conn, err := l.Accept()
+	if err != nil {
+		os.Exit(4)
+	}
+	bufio.NewReader(conn).ReadString('\n')
+	io.WriteString(conn, "HTTP/1.0 200 OK\r\n\r\ncache opened")
+	conn.Close()
+	c.Stop()
+	os.Exit(0)
+}
+
+// TestUpgradeBinaryHandover тестирует порядок передачи при SIGUSR2: новый процесс
+// получает listener сразу, а кеш открывает только после остановки прежнего
+func TestUpgradeBinaryHandover(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a child process")
+	}
+	dbPath := filepath.Join(t.TempDir(), "cache.db")
+	parent, err := cache.Open(upgradeTestCacheCfg(dbPath), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestUpgradeHelperProcess$"}
+	defer func() { os.Args = args }()
+	t.Setenv(upgradeChildEnv, dbPath)
+
+	// Новый процесс ждет освобождения БД и не завершается с ошибкой открытия кеша
+	release, err := upgradeBinary(l)
+	if err != nil {
+		parent.Stop()
+		t.Fatalf("upgradeBinary failed: %v", err)
+	}
+
+	// Прежний процесс останавливается и только затем сообщает об освобождении БД
+	l.Close()
+	parent.Stop()
+	release.Close()
+
+	conn, err := net.DialTimeout("tcp", l.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("connect to the new process: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	io.WriteString(conn, "GET / HTTP/1.0\r\n\r\n")
+	resp, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read response of the new process: %v", err)
+	}
+	if want := "HTTP/1.0 200 OK\r\n\r\ncache opened"; string(resp) != want {
+		t.Errorf("Unexpected response of the new process: %q", resp)
+	}
+}
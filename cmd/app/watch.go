@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	defaultWatchInterval = 5 * time.Second
+	defaultWatchDebounce = 2 * time.Second
+)
+
+// configWatchConf автоматическая перезагрузка конфигурации при изменении файлов
+// (альтернатива SIGHUP для контейнеров)
+type configWatchConf struct {
+	Enabled  bool   `yaml:"enabled"`
+	Interval string `yaml:"interval"` // Период проверки файлов, по умолчанию 5s
+	// Перезагрузка выполняется, когда файлы не меняются в течение debounce (по умолчанию 2s),
+	// что бы не читать конфиг, записанный не полностью
+	Debounce string `yaml:"debounce"`
+	// Дополнительные файлы, например смонтированные секреты
+	Files []string `yaml:"files"`
+}
+
+// watchDuration разбирает длительность параметра config_watch
+func watchDuration(name, value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	s, err := suffix.ToSeconds(value)
+	if err != nil || s == 0 {
+		logger.Global.Errorf("invalid 'config_watch.%s' %s, using %v", name, value, def)
+		return def
+	}
+	return time.Duration(s) * time.Second
+}
+
+// filesFingerprint возвращает отпечаток содержимого файлов. Содержимое, а не время
+// изменения, сравнивается потому, что Kubernetes обновляет ConfigMap и Secret
+// заменой символической ссылки, а touch без изменений не должен вызывать перезагрузку
+func filesFingerprint(files []string) [sha256.Size]byte {
+	h := sha256.New()
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			// Отсутствующий файл тоже состояние: его появление будет изменением
+			data = []byte("\x00" + err.Error())
+		}
+		sum := sha256.Sum256(data)
+		h.Write(sum[:])
+	}
+	var fp [sha256.Size]byte
+	copy(fp[:], h.Sum(nil))
+	return fp
+}
+
+// startConfigWatch запускает опрос файла конфигурации и дополнительных файлов.
+// При изменении, после паузы debounce, в reload отправляется запрос перезагрузки,
+// которая выполняется так же, как по SIGHUP. Возвращает nil, если отслеживание отключено
+func startConfigWatch(cfg configWatchConf, confFile string, reload chan<- struct{}) context.CancelFunc {
+	if !cfg.Enabled {
+		return nil
+	}
+	interval := watchDuration("interval", cfg.Interval, defaultWatchInterval)
+	debounce := watchDuration("debounce", cfg.Debounce, defaultWatchDebounce)
+	files := append([]string{confFile}, cfg.Files...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		logger.Global.Infof("Watching configuration files %v every %v", files, interval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		applied := filesFingerprint(files)
+		seen, changedAt := applied, time.Time{}
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			fp := filesFingerprint(files)
+			if fp != seen {
+				seen, changedAt = fp, time.Now()
+			}
+			if seen == applied || time.Since(changedAt) < debounce {
+				continue
+			}
+
+			// Ошибочный конфиг не перечитывается повторно до следующего изменения
+			applied = seen
+			logger.Global.Info("Configuration files changed, reloading")
+			select {
+			case reload <- struct{}{}:
+			default:
+				// Перезагрузка уже запрошена
+			}
+		}
+	}()
+	return cancel
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/metrics"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	defaultWatchdogInterval = 30 * time.Second
+	defaultWatchdogCooldown = 10 * time.Minute
+	defaultWatchdogDir      = "./diagnostics"
+	defaultWatchdogKeep     = 10
+)
+
+// watchdogConf запись профилей горутин и кучи при превышении порогов, чтобы при
+// расследовании утечки были данные с момента всплеска
+type watchdogConf struct {
+	Enabled  bool   `yaml:"enabled"`
+	Interval string `yaml:"interval"` // Период проверки, по умолчанию 30s
+	// Пороги: количество горутин и размер кучи (например 1GB), 0 или пусто - не проверяется
+	MaxGoroutines int    `yaml:"max_goroutines"`
+	MaxHeap       string `yaml:"max_heap"`
+	Dir           string `yaml:"dir"` // Каталог снимков, по умолчанию ./diagnostics
+	// Количество хранимых снимков (по умолчанию 10), старые удаляются
+	Keep int `yaml:"keep"`
+	// Минимальный интервал между снимками по одной причине, по умолчанию 10m
+	Cooldown string `yaml:"cooldown"`
+}
+
+// watchdogDuration разбирает длительность параметра watchdog
+func watchdogDuration(name, value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	s, err := suffix.ToSeconds(value)
+	if err != nil || s == 0 {
+		logger.Global.Errorf("invalid 'watchdog.%s' %s, using %v", name, value, def)
+		return def
+	}
+	return time.Duration(s) * time.Second
+}
+
+// startWatchdog запускает проверку порогов. Возвращает nil, если watchdog отключен
+func startWatchdog(c watchdogConf) context.CancelFunc {
+	if !c.Enabled {
+		return nil
+	}
+	interval := watchdogDuration("interval", c.Interval, defaultWatchdogInterval)
+	cooldown := watchdogDuration("cooldown", c.Cooldown, defaultWatchdogCooldown)
+	var maxHeap uint64
+	if c.MaxHeap != "" {
+		b, err := suffix.ToB(c.MaxHeap)
+		if err != nil {
+			logger.Global.Errorf("invalid 'watchdog.max_heap' %s: heap threshold disabled", c.MaxHeap)
+		} else {
+			maxHeap = uint64(b)
+		}
+	}
+	if c.MaxGoroutines <= 0 && maxHeap == 0 {
+		logger.Global.Warning("Watchdog enabled without thresholds, not started")
+		return nil
+	}
+	dir := c.Dir
+	if dir == "" {
+		dir = defaultWatchdogDir
+	}
+	keep := c.Keep
+	if keep <= 0 {
+		keep = defaultWatchdogKeep
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		// Время последнего снимка по причине
+		last := make(map[string]time.Time)
+
+		check := func(reason string, exceeded bool, value string) {
+			if !exceeded || time.Since(last[reason]) < cooldown {
+				return
+			}
+			last[reason] = time.Now()
+			path, err := writeDiagnostics(dir, reason, keep)
+			if err != nil {
+				logger.Global.Errorf("Watchdog: %s threshold exceeded (%s), dump failed: %v", reason, value, err)
+				return
+			}
+			metrics.IncWatchdogDump(reason)
+			logger.Global.Warningf("Watchdog: %s threshold exceeded (%s), profiles written to %s", reason, value, path)
+		}
+
+		for {
+			select {
+			case <-ticker.C:
+				goroutines := runtime.NumGoroutine()
+				check("goroutines", c.MaxGoroutines > 0 && goroutines > c.MaxGoroutines, fmt.Sprintf("%d goroutines", goroutines))
+
+				if maxHeap > 0 {
+					var m runtime.MemStats
+					runtime.ReadMemStats(&m)
+					check("heap", m.HeapAlloc > maxHeap, fmt.Sprintf("heap %.1fMB", bToMb(m.HeapAlloc)))
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	logger.Global.Infof("Watchdog started: max_goroutines %d, max_heap %s, dumps in %s", c.MaxGoroutines, c.MaxHeap, dir)
+	return cancel
+}
+
+// writeDiagnostics записывает профили горутин и кучи в каталог снимка dir/<время>-<reason>
+// и удаляет снимки сверх keep. Возвращает путь снимка
+func writeDiagnostics(dir, reason string, keep int) (string, error) {
+	path := filepath.Join(dir, time.Now().Format("20060102-150405")+"-"+reason)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return "", err
+	}
+
+	// Стеки всех горутин в текстовом виде, heap - в формате pprof
+	profiles := []struct {
+		name  string
+		file  string
+		debug int
+	}{
+		{"goroutine", "goroutine.txt", 2},
+		{"heap", "heap.pb.gz", 0},
+	}
+	for _, p := range profiles {
+		f, err := os.Create(filepath.Join(path, p.file))
+		if err != nil {
+			return path, err
+		}
+		err = pprof.Lookup(p.name).WriteTo(f, p.debug)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return path, err
+		}
+	}
+
+	pruneDiagnostics(dir, keep)
+	return path, nil
+}
+
+// pruneDiagnostics удаляет старые снимки, оставляя keep последних. Имена снимков
+// начинаются со времени, поэтому сортируются по времени
+func pruneDiagnostics(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var dumps []string
+	for _, e := range entries {
+		if e.IsDir() && (strings.HasSuffix(e.Name(), "-goroutines") || strings.HasSuffix(e.Name(), "-heap")) {
+			dumps = append(dumps, e.Name())
+		}
+	}
+	slices.Sort(dumps)
+	for len(dumps) > keep {
+		if err := os.RemoveAll(filepath.Join(dir, dumps[0])); err != nil {
+			logger.Global.Warningf("Watchdog: failed to remove old dump %s: %v", dumps[0], err)
+		}
+		dumps = dumps[1:]
+	}
+}
@@ -3,9 +3,14 @@ package cache
 import (
 	"ZabbixAPIproxy/internal/logger"
 	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/a3ak/suffix"
@@ -13,7 +18,21 @@ import (
 )
 
 const (
+	// Корневой бакет БД. Внутри него для каждого типа кеша создается вложенный
+	// бакет с записями ProxyID -> cacheItem. Ключ bucketName в корневом бакете
+	// хранит кеш целиком в формате версии 1 и используется только для миграции
 	bucketName = "ZabbixAPIproxy"
+
+	// Бакет служебных данных кеша (версия формата, схема ProxyID)
+	metaBucketName = "meta"
+	// Бакет, в который частями записывается полная копия типа кеша перед заменой
+	// ею бакета типа в корневом бакете
+	tmpBucketName = "ZabbixAPIproxy.tmp"
+	// Ключ схемы генерации ProxyID, которой построены сохраненные маппинги
+	idSchemeKey = "id_scheme"
+
+	// Максимальное количество записей, сохраняемых в одной транзакции БД
+	saveChunkSize = 10000
 )
 
 // Структура для конфигурации кеша
@@ -23,21 +42,86 @@ type CacheCfg struct {
 	DBPath          string            `yaml:"db_path"`
 	AutoSave        string            `yaml:"auto_save"`
 	CachedFields    map[string]string `yaml:"cached_fields"`
+
+	// Схема генерации ProxyID. Используется только для отслеживания ее смены
+	IDHash      string `yaml:"id_hash"`
+	IDDigits    int    `yaml:"id_digits"`
+	IDMigration string `yaml:"id_migration"` // keep (по умолчанию) или flush
+	IDMode      string `yaml:"id_mode"`      // cache (по умолчанию) или deterministic
+	// Шаблон различаемых имен, от которых строятся ProxyID (задается proxy)
+	NameTemplate string `yaml:"-"`
 }
 
 // cacheEntry структура для кеша
 type CacheEntry struct {
 	db         *bbolt.DB
 	mu         sync.RWMutex
+	saveMu     sync.Mutex            // Сериализует сохранения, чтобы старый снимок не перезаписал новый
 	CacheType  map[string]*cacheType `json:"cacheType"`
 	cancelFunc context.CancelFunc    // Для остановки всех фоновых процессов
+	ttl        time.Duration         // TTL маппингов для очистки
+
+	// Результат последнего сохранения в БД
+	statusMu    sync.Mutex
+	lastSave    time.Time
+	lastSaveErr error
 }
 
+// SaveStatus состояние БД кеша: подключена ли БД и результат последнего сохранения
+type SaveStatus struct {
+	DBOpen bool
+	// Время последнего успешного сохранения (нулевое, если сохранений не было)
+	LastSave time.Time
+	// Ошибка последнего сохранения (nil, если оно успешно)
+	LastError error
+}
+
+// Количество шардов в каждом типе кеша. Маппинги распределяются по шардам по
+// хешу ID, чтобы параллельные запросы не конкурировали за один мьютекс
+const cacheShards = 32
+
+// Множитель хеширования Фибоначчи (2^64 / золотое сечение)
+const fibonacciMultiplier = 0x9E3779B97F4A7C15
+
 // cacheType подструктура кеша, для разделения кеша по типам
 type cacheType struct {
-	mu        sync.RWMutex
-	ProxyID   map[int]cacheItem `json:"proxyID"`  //Возвращает OrignalID
-	ReverseID map[int]reverseID `json:"ServerID"` //Возвращает ProxyID по OriginalID с учтом ServerID
+	proxyShards   []*proxyShard   //Возвращает OrignalID по ProxyID
+	reverseShards []*reverseShard //Возвращает ProxyID по OriginalID с учтом ServerID
+
+	// Счетчики попаданий в кеш по серверам: serverID -> *lookupCounters
+	counters sync.Map
+
+	// Тип кеша требуется перезаписать в БД целиком (полный сброс, миграция)
+	dirtyAll atomic.Bool
+}
+
+// proxyShard шард прямого кеша ProxyID -> cacheItem
+type proxyShard struct {
+	mu    sync.RWMutex
+	items map[int]cacheItem
+	// ProxyID, измененные с момента последнего сохранения в БД
+	dirty map[int]struct{}
+}
+
+// reverseShard шард обратного кеша OriginalID -> reverseID
+type reverseShard struct {
+	mu    sync.RWMutex
+	items map[int]reverseID
+}
+
+// lookupCounters счетчики попаданий и промахов кеша для одного сервера
+type lookupCounters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// ServerStats статистика кеша одного типа для одного сервера
+type ServerStats struct {
+	Entries    int       `json:"entries"`
+	LastUpdate time.Time `json:"last_update"`
+	Hits       uint64    `json:"hits"`
+	Misses     uint64    `json:"misses"`
+	HitRate    float64   `json:"hit_rate"`
 }
 
 // ReverseID кеш для получения ProxyID из OriginalID по ServerID
@@ -45,20 +129,66 @@ type reverseID struct {
 	ProxyID map[int]int `json:"ProxyID"` //serverID: ProxyID
 }
 
-// CacheItem хранит данные и время создания для TTL. Возвращает OriginalID для
+// CacheItem хранит данные и время обновления для TTL. Возвращает OriginalID для
 // определенного ServerID по ProxyID
 type cacheItem struct {
 	Name       string      `json:"name"`
 	OriginalID map[int]int `json:"originalID"` // serverID: OriginalID
-	CreatedAt  time.Time   `json:"createdAt"`
+	CreatedAt  time.Time   `json:"createdAt"`  // Время последнего обновления любого из маппингов
+	// Время последнего обновления маппинга каждого сервера, по нему считается TTL.
+	// Для записей старого формата отсутствует, тогда используется CreatedAt
+	UpdatedAt map[int]time.Time `json:"updatedAt,omitempty"` // serverID: UpdatedAt
+}
+
+// serverUpdatedAt возвращает время последнего обновления маппинга сервера
+func (item cacheItem) serverUpdatedAt(serverID int) time.Time {
+	if updatedAt, exists := item.UpdatedAt[serverID]; exists {
+		return updatedAt
+	}
+	return item.CreatedAt
 }
 
-// cacheEntry структура для кеша в сериализуемом виде для сохранения в БД
+// withServer возвращает копию записи с маппингом сервера, обновленным на момент now.
+// Карты копируются, т.к. исходные могут использоваться при сериализации
+func (item cacheItem) withServer(serverID, originalID int, now time.Time) cacheItem {
+	updated := cacheItem{
+		Name:       item.Name,
+		OriginalID: make(map[int]int, len(item.OriginalID)+1),
+		CreatedAt:  now,
+		UpdatedAt:  make(map[int]time.Time, len(item.OriginalID)+1),
+	}
+	maps.Copy(updated.OriginalID, item.OriginalID)
+	for srvID := range item.OriginalID {
+		updated.UpdatedAt[srvID] = item.serverUpdatedAt(srvID)
+	}
+	updated.OriginalID[serverID] = originalID
+	updated.UpdatedAt[serverID] = now
+	return updated
+}
+
+// withoutServer возвращает копию записи без маппинга сервера
+func (item cacheItem) withoutServer(serverID int) cacheItem {
+	updated := cacheItem{
+		Name:       item.Name,
+		OriginalID: make(map[int]int, len(item.OriginalID)),
+		CreatedAt:  item.CreatedAt,
+		UpdatedAt:  make(map[int]time.Time, len(item.OriginalID)),
+	}
+	for srvID, id := range item.OriginalID {
+		if srvID != serverID {
+			updated.OriginalID[srvID] = id
+			updated.UpdatedAt[srvID] = item.serverUpdatedAt(srvID)
+		}
+	}
+	return updated
+}
+
+// cacheEntry структура для кеша в сериализуемом виде (старый формат хранения в БД)
 type serializablecacheEntry struct {
 	CacheType map[string]*serializablecacheType `json:"cacheType"`
 }
 
-// cacheType подструктура кеша в сериализуемом виде для сохранения в БД
+// cacheType подструктура кеша в сериализуемом виде (старый формат хранения в БД)
 type serializablecacheType struct {
 	ProxyID   map[int]cacheItem `json:"proxyID"`
 	ReverseID map[int]reverseID `json:"ServerID"`
@@ -73,12 +203,21 @@ func (ce *CacheEntry) toSerializable() *serializablecacheEntry {
 	}
 
 	for k, v := range ce.CacheType {
-		v.mu.RLock()
-		serializable.CacheType[k] = &serializablecacheType{
-			ProxyID:   v.ProxyID,
-			ReverseID: v.ReverseID,
+		st := &serializablecacheType{
+			ProxyID:   make(map[int]cacheItem),
+			ReverseID: make(map[int]reverseID),
+		}
+		for _, shard := range v.proxyShards {
+			shard.mu.RLock()
+			maps.Copy(st.ProxyID, shard.items)
+			shard.mu.RUnlock()
 		}
-		v.mu.RUnlock()
+		for _, shard := range v.reverseShards {
+			shard.mu.RLock()
+			maps.Copy(st.ReverseID, shard.items)
+			shard.mu.RUnlock()
+		}
+		serializable.CacheType[k] = st
 	}
 
 	return serializable
@@ -93,17 +232,117 @@ func newCacheEntry() *CacheEntry {
 
 // NewCache инициализация cacheType
 func newCache() *cacheType {
-	return &cacheType{
-		ProxyID:   make(map[int]cacheItem),
-		ReverseID: make(map[int]reverseID),
+	return newShardedCache(cacheShards)
+}
+
+// newShardedCache инициализация cacheType с заданным количеством шардов
+func newShardedCache(shards int) *cacheType {
+	c := &cacheType{
+		proxyShards:   make([]*proxyShard, shards),
+		reverseShards: make([]*reverseShard, shards),
+	}
+	for i := range c.proxyShards {
+		c.proxyShards[i] = &proxyShard{
+			items: make(map[int]cacheItem),
+			dirty: make(map[int]struct{}),
+		}
+		c.reverseShards[i] = &reverseShard{
+			items: make(map[int]reverseID),
+		}
+	}
+	return c
+}
+
+// shardIndex возвращает шард для ID. Последняя цифра ProxyID - ID сервера, поэтому
+// остаток от деления самого ID собирал бы маппинги одного сервера в части шардов:
+// ID перемешивается умножением Фибоначчи, шард выбирается по старшим битам
+func shardIndex(id, shards int) int {
+	return int((uint64(id) * fibonacciMultiplier >> 32) % uint64(shards))
+}
+
+// proxyShard возвращает шард прямого кеша для ProxyID
+func (c *cacheType) proxyShard(proxyID int) *proxyShard {
+	return c.proxyShards[shardIndex(proxyID, len(c.proxyShards))]
+}
+
+// reverseShard возвращает шард обратного кеша для OriginalID
+func (c *cacheType) reverseShard(originalID int) *reverseShard {
+	return c.reverseShards[shardIndex(originalID, len(c.reverseShards))]
+}
+
+// markDirty помечает ProxyID как требующий сохранения. Вызывается под s.mu.Lock
+func (s *proxyShard) markDirty(proxyID int) {
+	s.dirty[proxyID] = struct{}{}
+}
+
+// markDirtyAll помечает тип кеша для полной перезаписи
+func (c *cacheType) markDirtyAll() {
+	c.dirtyAll.Store(true)
+}
+
+// takeDirty забирает накопленные изменения для сохранения. Возвращает признак
+// полной перезаписи и записи для сохранения; nil означает удаление ключа из БД
+func (c *cacheType) takeDirty() (bool, map[int]*cacheItem) {
+	all := c.dirtyAll.Swap(false)
+	changes := make(map[int]*cacheItem)
+
+	for _, shard := range c.proxyShards {
+		shard.mu.Lock()
+		if all {
+			for proxyID, item := range shard.items {
+				changes[proxyID] = &item
+			}
+		} else {
+			for proxyID := range shard.dirty {
+				if item, exists := shard.items[proxyID]; exists {
+					changes[proxyID] = &item
+				} else {
+					changes[proxyID] = nil
+				}
+			}
+		}
+		shard.dirty = make(map[int]struct{})
+		shard.mu.Unlock()
+	}
+
+	return all, changes
+}
+
+// restoreDirty возвращает изменения в очередь на сохранение после ошибки записи
+func (c *cacheType) restoreDirty(all bool, changes map[int]*cacheItem) {
+	if all {
+		c.markDirtyAll()
+		return
+	}
+	for proxyID := range changes {
+		shard := c.proxyShard(proxyID)
+		shard.mu.Lock()
+		shard.markDirty(proxyID)
+		shard.mu.Unlock()
+	}
+}
+
+// restoreItem помещает в кеш запись, загруженную из БД, и восстанавливает
+// для нее обратные маппинги
+func (c *cacheType) restoreItem(proxyID int, item cacheItem) {
+	shard := c.proxyShard(proxyID)
+	shard.mu.Lock()
+	shard.items[proxyID] = item
+	shard.mu.Unlock()
+
+	for serverID, originalID := range item.OriginalID {
+		c.setReverse(originalID, serverID, proxyID)
 	}
 }
 
 // Set добавляет или обновляет элемент в двунаправленном кэше
-// Производит атомарное обновление двух взаимосвязанных мап:
+// Производит обновление двух взаимосвязанных мап:
 //   - Прямое отображение: ProxyID -> CacheItem (содержит все OriginalID для этого ProxyID)
 //   - Обратное отображение: OriginalID -> ReverseID (содержит все ProxyID для этого OriginalID)
 //
+// Мапы шардированы независимо, поэтому блокировки шардов берутся поочередно,
+// а не одновременно
+//
 // Параметры:
 //   - proxyID: идентификатор в прокси-системе
 //   - OriginalID: идентификатор в оригинальной системе (Zabbix)
@@ -117,46 +356,46 @@ func (c *cacheType) Set(proxyID int, OriginalID int, SrvID int, ItemName string)
 		return
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	shard := c.proxyShard(proxyID)
+	shard.mu.Lock()
 
 	createdAt := time.Now()
+	shard.markDirty(proxyID)
 
 	// Обновление прямого кеша (ProxyID -> CacheItem)
-	if existingItem, exists := c.ProxyID[proxyID]; exists {
-		// Элемент уже существует - обновляем его
-		if existingItem.OriginalID[SrvID] == OriginalID {
-			// Значение не изменилось, только обновляем время для TTL
-			existingItem.CreatedAt = createdAt
-			c.ProxyID[proxyID] = existingItem
-		} else {
-			// Значение изменилось - создаем копию с обновленными данными
-			updatedItem := cacheItem{
-				Name:       ItemName,
-				OriginalID: make(map[int]int, len(existingItem.OriginalID)+1),
-				CreatedAt:  createdAt,
-			}
-			// Копируем существующие значения
-			maps.Copy(updatedItem.OriginalID, existingItem.OriginalID)
-
-			// Добавляем/обновляем значение для текущего сервера
-			updatedItem.OriginalID[SrvID] = OriginalID
-			c.ProxyID[proxyID] = updatedItem
+	if existingItem, exists := shard.items[proxyID]; exists {
+		// Элемент уже существует - создаем копию с обновленным маппингом и временем для TTL
+		updatedItem := existingItem.withServer(SrvID, OriginalID, createdAt)
+		if existingItem.OriginalID[SrvID] != OriginalID {
+			// Значение изменилось - обновляем и имя
+			updatedItem.Name = ItemName
 		}
+		shard.items[proxyID] = updatedItem
 	} else {
 		// Новый элемент - создаем с начальными данными
-		c.ProxyID[proxyID] = cacheItem{
+		shard.items[proxyID] = cacheItem{
 			Name:       ItemName,
 			OriginalID: map[int]int{SrvID: OriginalID},
 			CreatedAt:  createdAt,
+			UpdatedAt:  map[int]time.Time{SrvID: createdAt},
 		}
 	}
+	shard.mu.Unlock()
 
 	// Обновление обратного кеша (OriginalID -> ReverseID)
-	if existingReverse, exists := c.ReverseID[OriginalID]; exists {
+	c.setReverse(OriginalID, SrvID, proxyID)
+}
+
+// setReverse добавляет или обновляет обратный маппинг OriginalID -> ProxyID для сервера
+func (c *cacheType) setReverse(originalID, serverID, proxyID int) {
+	shard := c.reverseShard(originalID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if existingReverse, exists := shard.items[originalID]; exists {
 
 		// Обратная запись уже существует - обновляем ее
-		if existingReverse.ProxyID[SrvID] == proxyID {
+		if existingReverse.ProxyID[serverID] == proxyID {
 			// Значение не изменилось, ничего не делаем
 			return
 		}
@@ -169,12 +408,12 @@ func (c *cacheType) Set(proxyID int, OriginalID int, SrvID int, ItemName string)
 		maps.Copy(updatedReverse.ProxyID, existingReverse.ProxyID)
 
 		// Добавляем/обновляем значение для текущего сервера
-		updatedReverse.ProxyID[SrvID] = proxyID
-		c.ReverseID[OriginalID] = updatedReverse
+		updatedReverse.ProxyID[serverID] = proxyID
+		shard.items[originalID] = updatedReverse
 	} else {
 		// Новая обратная запись - создаем с начальными данными
-		c.ReverseID[OriginalID] = reverseID{
-			ProxyID: map[int]int{SrvID: proxyID},
+		shard.items[originalID] = reverseID{
+			ProxyID: map[int]int{serverID: proxyID},
 		}
 	}
 }
@@ -182,39 +421,73 @@ func (c *cacheType) Set(proxyID int, OriginalID int, SrvID int, ItemName string)
 // GetOriginalID возвращает OriginalID для заданных proxyID и ServerID
 // Возвращает (originalID, true) если найдено, (0, false) если не найдено
 func (c *cacheType) GetOriginalID(proxyID, ServerID int) (int, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	shard := c.proxyShard(proxyID)
+	shard.mu.RLock()
+	item, exists := shard.items[proxyID]
+	shard.mu.RUnlock()
 
-	item, exists := c.ProxyID[proxyID]
 	if !exists {
+		c.countLookup(ServerID, false)
 		return 0, false
 	}
 
 	originalID, exists := item.OriginalID[ServerID]
+	c.countLookup(ServerID, exists)
 	return originalID, exists
 }
 
 // GetProxyID возвращает ProxyID для заданных OriginalID и ServerID
 // Возвращает (proxyID, true) если найдено, (0, false) если не найдено
 func (c *cacheType) GetProxyID(OriginalID, ServerID int) (int, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	reverseItem, exists := c.ReverseID[OriginalID]
+	shard := c.reverseShard(OriginalID)
+	shard.mu.RLock()
+	reverseItem, exists := shard.items[OriginalID]
+	shard.mu.RUnlock()
+
 	if !exists {
+		c.countLookup(ServerID, false)
 		return 0, false
 	}
 
 	proxyID, exists := reverseItem.ProxyID[ServerID]
+	c.countLookup(ServerID, exists)
 	return proxyID, exists
 }
 
+// countLookup учитывает попадание или промах кеша для сервера
+func (c *cacheType) countLookup(serverID int, hit bool) {
+	v, _ := c.counters.LoadOrStore(serverID, &lookupCounters{})
+	counters := v.(*lookupCounters)
+	if hit {
+		counters.hits.Add(1)
+	} else {
+		counters.misses.Add(1)
+	}
+}
+
+// GetServerMappings возвращает все маппинги ProxyID -> OriginalID для сервера
+func (c *cacheType) GetServerMappings(serverID int) map[int]int {
+	mappings := make(map[int]int)
+	for _, shard := range c.proxyShards {
+		shard.mu.RLock()
+		for proxyID, item := range shard.items {
+			if originalID, exists := item.OriginalID[serverID]; exists {
+				mappings[proxyID] = originalID
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return mappings
+}
+
 // GetEntityName возвращает имя сущности по которой сгенерировано PorxyID
 // Возвращает (EntityName, true) если найдено, ("", false) если не найдено
 func (c *cacheType) GetEntityName(proxyID int) (string, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	shard := c.proxyShard(proxyID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
 
-	obj, exists := c.ProxyID[proxyID]
+	obj, exists := shard.items[proxyID]
 
 	if !exists {
 		return "", false
@@ -225,61 +498,363 @@ func (c *cacheType) GetEntityName(proxyID int) (string, bool) {
 
 // Delete удаляет элемент из кеша
 func (c *cacheType) Delete(proxyIDs []int) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	for _, id := range proxyIDs {
-		if item, exists := c.ProxyID[id]; exists {
-			// Для каждого originalID удаляем только маппинг для данного proxy id (server)
-			for _, originalID := range item.OriginalID {
-				delete(c.ReverseID, originalID)
-			}
+		shard := c.proxyShard(id)
+		shard.mu.Lock()
+		item, exists := shard.items[id]
+		if exists {
 			// Удаляем соответствующую запись в ProxyID
-			delete(c.ProxyID, id)
+			delete(shard.items, id)
+			shard.markDirty(id)
+		}
+		shard.mu.Unlock()
+
+		if !exists {
+			continue
+		}
+		// Для каждого originalID удаляем только маппинг для данного proxy id (server)
+		for _, originalID := range item.OriginalID {
+			reverse := c.reverseShard(originalID)
+			reverse.mu.Lock()
+			delete(reverse.items, originalID)
+			reverse.mu.Unlock()
+		}
+	}
+}
+
+// DeleteServerMapping удаляет маппинг ProxyID -> OriginalID только для одного сервера.
+// Запись ProxyID удаляется целиком, если других серверов в ней не осталось
+func (c *cacheType) DeleteServerMapping(proxyID, serverID int) {
+	shard := c.proxyShard(proxyID)
+	shard.mu.Lock()
+	originalID, exists := shard.deleteServer(proxyID, serverID)
+	shard.mu.Unlock()
+
+	if exists {
+		c.deleteReverse(originalID, serverID, proxyID)
+	}
+}
+
+// deleteServer удаляет маппинг сервера из записи ProxyID. Возвращает удаленный
+// OriginalID. Вызывается под s.mu.Lock
+func (s *proxyShard) deleteServer(proxyID, serverID int) (int, bool) {
+	item, exists := s.items[proxyID]
+	if !exists {
+		return 0, false
+	}
+	originalID, exists := item.OriginalID[serverID]
+	if !exists {
+		return 0, false
+	}
+
+	s.markDirty(proxyID)
+	if len(item.OriginalID) == 1 {
+		delete(s.items, proxyID)
+		return originalID, true
+	}
+
+	s.items[proxyID] = item.withoutServer(serverID)
+	return originalID, true
+}
+
+// deleteReverse удаляет обратный маппинг сервера, если он указывает на proxyID
+func (c *cacheType) deleteReverse(originalID, serverID, proxyID int) {
+	shard := c.reverseShard(originalID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	reverse, exists := shard.items[originalID]
+	if !exists || reverse.ProxyID[serverID] != proxyID {
+		return
+	}
+	if len(reverse.ProxyID) == 1 {
+		delete(shard.items, originalID)
+		return
+	}
+	updatedReverse := reverseID{ProxyID: make(map[int]int, len(reverse.ProxyID)-1)}
+	for srvID, id := range reverse.ProxyID {
+		if srvID != serverID {
+			updatedReverse.ProxyID[srvID] = id
 		}
 	}
+	shard.items[originalID] = updatedReverse
 }
 
-// Cleanup удаляет устаревшие записи
-func (c *cacheType) cleanup(ttl time.Duration) {
-	c.mu.RLock()
-	// Массив ключей для удаления, чтобы не блокировать мапы во время удаления
-	var clenaup []int
+// flushServer удаляет все маппинги указанного сервера, либо весь кеш типа при serverID == 0.
+// Возвращает количество удаленных маппингов ProxyID -> OriginalID
+func (c *cacheType) flushServer(serverID int) int {
+	removed := 0
+
+	if serverID == 0 {
+		for _, shard := range c.proxyShards {
+			shard.mu.Lock()
+			for _, item := range shard.items {
+				removed += len(item.OriginalID)
+			}
+			shard.items = make(map[int]cacheItem)
+			shard.dirty = make(map[int]struct{})
+			shard.mu.Unlock()
+		}
+		for _, shard := range c.reverseShards {
+			shard.mu.Lock()
+			shard.items = make(map[int]reverseID)
+			shard.mu.Unlock()
+		}
+		c.markDirtyAll()
+		return removed
+	}
+
+	for _, shard := range c.proxyShards {
+		shard.mu.Lock()
+		for proxyID := range shard.items {
+			if _, exists := shard.deleteServer(proxyID, serverID); exists {
+				removed++
+			}
+		}
+		shard.mu.Unlock()
+	}
+
+	for _, shard := range c.reverseShards {
+		shard.mu.Lock()
+		for originalID, reverse := range shard.items {
+			if _, exists := reverse.ProxyID[serverID]; !exists {
+				continue
+			}
+			if len(reverse.ProxyID) == 1 {
+				delete(shard.items, originalID)
+				continue
+			}
+			updatedReverse := reverseID{ProxyID: make(map[int]int, len(reverse.ProxyID)-1)}
+			for srvID, proxyID := range reverse.ProxyID {
+				if srvID != serverID {
+					updatedReverse.ProxyID[srvID] = proxyID
+				}
+			}
+			shard.items[originalID] = updatedReverse
+		}
+		shard.mu.Unlock()
+	}
+
+	return removed
+}
+
+// Flush сбрасывает маппинги кеша. Пустой cacheTypeName означает все типы кеша,
+// serverID == 0 - все серверы. Возвращает количество удаленных маппингов
+func (ce *CacheEntry) Flush(cacheTypeName string, serverID int) (int, error) {
+	ce.mu.RLock()
+	defer ce.mu.RUnlock()
+
+	if cacheTypeName != "" {
+		cache, exists := ce.CacheType[cacheTypeName]
+		if !exists {
+			return 0, fmt.Errorf("unknown cache type '%s'", cacheTypeName)
+		}
+		return cache.flushServer(serverID), nil
+	}
+
+	removed := 0
+	for _, cache := range ce.CacheType {
+		removed += cache.flushServer(serverID)
+	}
+	return removed, nil
+}
+
+// expiredMapping маппинг сервера, удаленный из прямого кеша по TTL
+type expiredMapping struct {
+	proxyID    int
+	serverID   int
+	originalID int
+}
+
+// Cleanup удаляет устаревшие маппинги. TTL считается отдельно для каждой пары
+// (ProxyID, ServerID), поэтому актуальные маппинги других серверов сохраняются.
+// Блокируется только один шард за раз, обратные записи удаляются после
+func (c *cacheType) cleanup(ttl time.Duration) int {
+	var expired []expiredMapping
 
 	now := time.Now()
-	for proxyID, item := range c.ProxyID {
-		// Если запись старше TTL, добавляем в список на удаление
-		if now.Sub(item.CreatedAt) > ttl {
-			clenaup = append(clenaup, proxyID)
+	for _, shard := range c.proxyShards {
+		shard.mu.Lock()
+		for proxyID, item := range shard.items {
+			for serverID := range item.OriginalID {
+				// Если маппинг старше TTL, удаляем его
+				if now.Sub(item.serverUpdatedAt(serverID)) <= ttl {
+					continue
+				}
+				if originalID, exists := shard.deleteServer(proxyID, serverID); exists {
+					expired = append(expired, expiredMapping{proxyID, serverID, originalID})
+				}
+			}
 		}
+		shard.mu.Unlock()
 	}
-	c.mu.RUnlock() // Разблокируем для удаления
 
 	// Удаляем соответствующие записи в ReverseID
-	c.Delete(clenaup)
+	for _, m := range expired {
+		c.deleteReverse(m.originalID, m.serverID, m.proxyID)
+	}
+	return len(expired)
+}
 
+// Cleanup немедленно удаляет устаревшие по TTL маппинги всех типов кеша, не дожидаясь
+// фоновой очистки. Возвращает количество удаленных маппингов
+func (ce *CacheEntry) Cleanup() (int, error) {
+	ce.mu.RLock()
+	defer ce.mu.RUnlock()
+
+	// Без TTL очистка удалила бы все маппинги
+	if ce.ttl <= 0 {
+		return 0, fmt.Errorf("cache ttl is not set")
+	}
+	removed := 0
+	for _, cache := range ce.CacheType {
+		removed += cache.cleanup(ce.ttl)
+	}
+	return removed, nil
 }
 
-// Save сохраняет cacheEntry в BoltDB
+// Save сохраняет в BoltDB только изменившиеся с прошлого сохранения записи кеша.
+// Каждый тип кеша хранится во вложенном бакете, каждая запись - отдельным ключом
+//
+// Записи кеша неизменяемы (при обновлении создается копия), поэтому снимок
+// изменений забирается под блокировкой шарда без глубокого копирования, а
+// сериализация и запись в БД выполняются без блокировок кеша
 func (ce *CacheEntry) save() error {
+	// БД не подключена (например, ее формат новее поддерживаемого)
+	if ce.db == nil {
+		return nil
+	}
+
+	ce.saveMu.Lock()
+	defer ce.saveMu.Unlock()
+
 	ce.mu.RLock()
-	defer ce.mu.RUnlock()
+	cacheTypes := maps.Clone(ce.CacheType)
+	ce.mu.RUnlock()
 
-	serializableCe := ce.toSerializable()
+	for cacheTypeName, cache := range cacheTypes {
+		all, changes := cache.takeDirty()
+		if !all && len(changes) == 0 {
+			continue
+		}
 
-	return ce.db.Update(func(tx *bbolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		if err := ce.saveCacheType(cacheTypeName, all, changes); err != nil {
+			cache.restoreDirty(all, changes)
+			err = fmt.Errorf("save cache type '%s': %w", cacheTypeName, err)
+			ce.setSaveResult(err)
+			return err
+		}
+	}
+
+	ce.setSaveResult(nil)
+	return nil
+}
+
+// Save немедленно сохраняет изменения кеша в БД, не дожидаясь автосохранения
+func (ce *CacheEntry) Save() error {
+	if ce.db == nil {
+		return fmt.Errorf("cache database is not open")
+	}
+	return ce.save()
+}
+
+// setSaveResult запоминает результат сохранения
+func (ce *CacheEntry) setSaveResult(err error) {
+	ce.statusMu.Lock()
+	defer ce.statusMu.Unlock()
+	ce.lastSaveErr = err
+	if err == nil {
+		ce.lastSave = time.Now()
+	}
+}
+
+// SaveStatus возвращает состояние БД кеша
+func (ce *CacheEntry) SaveStatus() SaveStatus {
+	ce.statusMu.Lock()
+	defer ce.statusMu.Unlock()
+	return SaveStatus{DBOpen: ce.db != nil, LastSave: ce.lastSave, LastError: ce.lastSaveErr}
+}
+
+// saveCacheType записывает изменения одного типа кеша в его бакет частями
+// по saveChunkSize записей, чтобы не держать одну большую транзакцию.
+// Полная копия (all) записывается во временный бакет и заменяет прежний бакет типа
+// в одной транзакции, поэтому при ошибке записи в БД остаются прежние записи
+func (ce *CacheEntry) saveCacheType(cacheTypeName string, all bool, changes map[int]*cacheItem) error {
+	parent := bucketName
+	if all {
+		parent = tmpBucketName
+	}
+	err := ce.db.Update(func(tx *bbolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(parent))
 		if err != nil {
 			return err
 		}
-		data, err := json.Marshal(serializableCe)
+
+		// Остаток прерванной полной записи
+		if all && root.Bucket([]byte(cacheTypeName)) != nil {
+			if err := root.DeleteBucket([]byte(cacheTypeName)); err != nil {
+				return err
+			}
+		}
+		_, err = root.CreateBucketIfNotExists([]byte(cacheTypeName))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	proxyIDs := slices.Collect(maps.Keys(changes))
+	for chunk := range slices.Chunk(proxyIDs, saveChunkSize) {
+		err := ce.db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket([]byte(parent)).Bucket([]byte(cacheTypeName))
+			for _, proxyID := range chunk {
+				key := proxyIDKey(proxyID)
+				item := changes[proxyID]
+				if item == nil {
+					if err := b.Delete(key); err != nil {
+						return err
+					}
+					continue
+				}
+				data, err := json.Marshal(item)
+				if err != nil {
+					return err
+				}
+				if err := b.Put(key, data); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !all {
+		return nil
+	}
+
+	return ce.db.Update(func(tx *bbolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(bucketName))
 		if err != nil {
 			return err
 		}
-		return b.Put([]byte(bucketName), data)
+		if root.Bucket([]byte(cacheTypeName)) != nil {
+			if err := root.DeleteBucket([]byte(cacheTypeName)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket([]byte(tmpBucketName)).MoveBucket([]byte(cacheTypeName), root)
 	})
 }
 
+// proxyIDKey ключ записи в БД для ProxyID
+func proxyIDKey(proxyID int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(proxyID))
+	return key
+}
+
 // StartAutoSave запускает периодическую запись кеша в БД с возможностью остановки
 func (ce *CacheEntry) startAutoSave(saveInterval time.Duration, ctx context.Context) {
 	//Если не установле интервал, то выходим
@@ -353,6 +928,7 @@ func (ce *CacheEntry) start(cleanInterval, ttl, autoSave time.Duration) {
 	//Контекст для остановки фоновых процессов
 	ctx, cancel := context.WithCancel(context.Background())
 	ce.cancelFunc = cancel
+	ce.ttl = ttl
 	ce.mu.Unlock()
 
 	// Запускаем CleanUP
@@ -383,42 +959,74 @@ func (ce *CacheEntry) Stop() {
 	}
 }
 
-// Load загружает cacheEntry из BoltDB
+// Load загружает cacheEntry из BoltDB. Перед загрузкой формат БД приводится
+// к текущей версии. Обратный кеш не хранится и восстанавливается по прямому
 func (ce *CacheEntry) load() error {
+	if err := ce.migrate(); err != nil {
+		return err
+	}
+
 	ce.mu.Lock()
 	defer ce.mu.Unlock()
 
 	return ce.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucketName))
-		if b == nil {
+		root := tx.Bucket([]byte(bucketName))
+		if root == nil {
 			return nil
 		}
 
-		data := b.Get([]byte(bucketName))
-		if data == nil {
-			return nil
-		}
-
-		// Десериализуем во временную структуру
-		var serializable serializablecacheEntry
-		if err := json.Unmarshal(data, &serializable); err != nil {
-			return err
-		}
-
-		// Вручную копируем данные
-		for cacheTypeName, serializableCache := range serializable.CacheType {
+		return root.ForEachBucket(func(name []byte) error {
+			cacheTypeName := string(name)
 			if _, exists := ce.CacheType[cacheTypeName]; !exists {
 				ce.CacheType[cacheTypeName] = newCache()
 			}
 
 			cache := ce.CacheType[cacheTypeName]
-			cache.mu.Lock()
-			cache.ProxyID = serializableCache.ProxyID
-			cache.ReverseID = serializableCache.ReverseID
-			cache.mu.Unlock()
-		}
+			return root.Bucket(name).ForEach(func(k, v []byte) error {
+				var item cacheItem
+				if err := json.Unmarshal(v, &item); err != nil {
+					return err
+				}
+				cache.restoreItem(int(binary.BigEndian.Uint64(k)), item)
+				return nil
+			})
+		})
+	})
+}
 
+// checkIDScheme сравнивает схему генерации ProxyID с сохраненной в БД.
+// При смене схемы существующие маппинги по умолчанию сохраняются (ProxyID уже
+// известных сущностей не меняются до истечения TTL), новые сущности получают
+// ID по новой схеме. С id_migration: flush кеш сбрасывается целиком
+func (ce *CacheEntry) checkIDScheme(cfg CacheCfg) error {
+	if cfg.IDHash == "" || ce.db == nil {
 		return nil
+	}
+	scheme := fmt.Sprintf("%s/%d", cfg.IDHash, cfg.IDDigits)
+	if cfg.NameTemplate != "" {
+		scheme += "/" + cfg.NameTemplate
+	}
+
+	return ce.db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte(metaBucketName))
+		if err != nil {
+			return err
+		}
+
+		stored := string(meta.Get([]byte(idSchemeKey)))
+		if stored != "" && stored != scheme {
+			switch cfg.IDMigration {
+			case "flush":
+				removed, _ := ce.Flush("", 0)
+				logger.Global.Warningf("Proxy ID scheme changed from %s to %s, cache flushed: %d mappings removed", stored, scheme, removed)
+			case "", "keep":
+				logger.Global.Warningf("Proxy ID scheme changed from %s to %s, existing mappings are kept until TTL expires", stored, scheme)
+			default:
+				logger.Global.Errorf("unknown 'id_migration' %q, existing mappings are kept", cfg.IDMigration)
+			}
+		}
+
+		return meta.Put([]byte(idSchemeKey), []byte(scheme))
 	})
 }
 
@@ -438,13 +1046,25 @@ func cacheEntryInit(cacheFileds map[string]string) *CacheEntry {
 	return cacheEntry
 }
 
-// Инициализация кеша
+// Инициализация кеша. Ошибка открытия БД завершает процесс
 func Init(cfg CacheCfg) *CacheEntry {
+	cache, err := Open(cfg, 0)
+	if err != nil {
+		logger.Global.Fatal(err)
+	}
+	return cache
+}
+
+// Open открывает БД кеша, загружает из нее маппинги и запускает фоновые процессы.
+// timeout ограничивает ожидание блокировки файла БД другим процессом (0 - без ограничения)
+func Open(cfg CacheCfg, timeout time.Duration) (*CacheEntry, error) {
 
 	// Подключаем БД
-	db, err := bbolt.Open(cfg.DBPath, 0600, nil)
+	opts := *bbolt.DefaultOptions
+	opts.Timeout = timeout
+	db, err := bbolt.Open(cfg.DBPath, 0600, &opts)
 	if err != nil {
-		logger.Global.Fatal(err)
+		return nil, fmt.Errorf("open cache database %s: %w", cfg.DBPath, err)
 	}
 
 	// Инициализируем кеш
@@ -452,10 +1072,20 @@ func Init(cfg CacheCfg) *CacheEntry {
 	cache.db = db
 
 	// Загружаем данные в кеш из БД
-	if err := cache.load(); err != nil {
+	if err := cache.load(); errors.Is(err, errSchemaTooNew) {
+		// Не перезаписываем БД более новой версии, работаем без сохранения
+		logger.Global.Errorf("Failed to load cache, persistence disabled: %v", err)
+		db.Close()
+		cache.db = nil
+	} else if err != nil {
 		logger.Global.Errorf("Failed to load cache: %v", err)
 	}
 
+	// Проверяем, что сохраненные маппинги построены текущей схемой ProxyID
+	if err := cache.checkIDScheme(cfg); err != nil {
+		logger.Global.Errorf("Failed to check proxy ID scheme: %v", err)
+	}
+
 	// Конвертируем интервалы времени
 	cleanInterval, err := suffix.ToSeconds(cfg.CleanupInterval)
 	if err != nil {
@@ -475,7 +1105,7 @@ func Init(cfg CacheCfg) *CacheEntry {
 	// Запускаем фоновые процессы кеша
 	cache.start(time.Duration(cleanInterval)*time.Second, time.Duration(ttlDuration)*time.Second, time.Duration(autoSave)*time.Second)
 
-	return cache
+	return cache, nil
 }
 
 // GetStats возвращает статистику кеша
@@ -485,10 +1115,62 @@ func (ce *CacheEntry) GetStats() map[string]int {
 
 	stats := make(map[string]int)
 	for cacheType, cache := range ce.CacheType {
-		cache.mu.RLock()
-		stats[cacheType+"_proxy_items"] = len(cache.ProxyID)
-		stats[cacheType+"_reverse_items"] = len(cache.ReverseID)
-		cache.mu.RUnlock()
+		proxyItems, reverseItems := 0, 0
+		for _, shard := range cache.proxyShards {
+			shard.mu.RLock()
+			proxyItems += len(shard.items)
+			shard.mu.RUnlock()
+		}
+		for _, shard := range cache.reverseShards {
+			shard.mu.RLock()
+			reverseItems += len(shard.items)
+			shard.mu.RUnlock()
+		}
+		stats[cacheType+"_proxy_items"] = proxyItems
+		stats[cacheType+"_reverse_items"] = reverseItems
+	}
+	return stats
+}
+
+// GetServerStats возвращает статистику кеша в разрезе типов и серверов:
+// количество маппингов, время последнего обновления и долю попаданий
+func (ce *CacheEntry) GetServerStats() map[string]map[int]ServerStats {
+	ce.mu.RLock()
+	defer ce.mu.RUnlock()
+
+	stats := make(map[string]map[int]ServerStats)
+	for cacheTypeName, cache := range ce.CacheType {
+		servers := make(map[int]ServerStats)
+
+		for _, shard := range cache.proxyShards {
+			shard.mu.RLock()
+			for _, item := range shard.items {
+				for serverID := range item.OriginalID {
+					st := servers[serverID]
+					st.Entries++
+					if updatedAt := item.serverUpdatedAt(serverID); updatedAt.After(st.LastUpdate) {
+						st.LastUpdate = updatedAt
+					}
+					servers[serverID] = st
+				}
+			}
+			shard.mu.RUnlock()
+		}
+
+		cache.counters.Range(func(key, value any) bool {
+			serverID := key.(int)
+			counters := value.(*lookupCounters)
+			st := servers[serverID]
+			st.Hits = counters.hits.Load()
+			st.Misses = counters.misses.Load()
+			if total := st.Hits + st.Misses; total > 0 {
+				st.HitRate = float64(st.Hits) / float64(total)
+			}
+			servers[serverID] = st
+			return true
+		})
+
+		stats[cacheTypeName] = servers
 	}
 	return stats
 }
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"sync"
@@ -10,6 +11,35 @@ import (
 	"go.etcd.io/bbolt"
 )
 
+// getTestItem возвращает запись прямого кеша по ProxyID
+func getTestItem(c *cacheType, proxyID int) (cacheItem, bool) {
+	shard := c.proxyShard(proxyID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	item, exists := shard.items[proxyID]
+	return item, exists
+}
+
+// reverseTestExists проверяет наличие записи обратного кеша по OriginalID
+func reverseTestExists(c *cacheType, originalID int) bool {
+	shard := c.reverseShard(originalID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	_, exists := shard.items[originalID]
+	return exists
+}
+
+// dirtyTestCount возвращает количество ProxyID, ожидающих сохранения
+func dirtyTestCount(c *cacheType) int {
+	count := 0
+	for _, shard := range c.proxyShards {
+		shard.mu.RLock()
+		count += len(shard.dirty)
+		shard.mu.RUnlock()
+	}
+	return count
+}
+
 func TestCacheType_SetAndGet(t *testing.T) {
 	cache := newCache()
 
@@ -52,18 +82,14 @@ func TestCacheType_UpdateExisting(t *testing.T) {
 	cache.Set(100, 500, 1, "HostA")
 
 	// Get initial timestamp
-	cache.mu.RLock()
-	originalItem := cache.ProxyID[100]
-	cache.mu.RUnlock()
+	originalItem, _ := getTestItem(cache, 100)
 
 	time.Sleep(10 * time.Millisecond) // Ensure different timestamp
 
 	// Update with same values (should only update timestamp)
 	cache.Set(100, 500, 1, "HostA")
 
-	cache.mu.RLock()
-	updatedItem := cache.ProxyID[100]
-	cache.mu.RUnlock()
+	updatedItem, _ := getTestItem(cache, 100)
 
 	if originalItem.CreatedAt.Equal(updatedItem.CreatedAt) {
 		t.Error("Timestamp should be updated even for same values")
@@ -113,33 +139,25 @@ func TestCacheType_Cleanup(t *testing.T) {
 	now := time.Now()
 
 	// Old item (should be cleaned up)
-	cache.mu.Lock()
-	cache.ProxyID[100] = cacheItem{
+	cache.restoreItem(100, cacheItem{
 		OriginalID: map[int]int{1: 500},
 		CreatedAt:  now.Add(-2 * time.Hour),
-	}
-	cache.ReverseID[500] = reverseID{ProxyID: map[int]int{1: 100}}
-	cache.mu.Unlock()
+	})
 
 	// Recent item (should remain)
-	cache.mu.Lock()
-	cache.ProxyID[200] = cacheItem{
+	cache.restoreItem(200, cacheItem{
 		OriginalID: map[int]int{1: 600},
 		CreatedAt:  now.Add(-30 * time.Minute),
-	}
-	cache.ReverseID[600] = reverseID{ProxyID: map[int]int{1: 200}}
-	cache.mu.Unlock()
+	})
 
 	// Run cleanup with 1 hour TTL
 	cache.cleanup(time.Hour)
 
 	// Verify results
-	cache.mu.RLock()
-	_, foundOldProxy := cache.ProxyID[100]
-	_, foundOldReverse := cache.ReverseID[500]
-	_, foundRecentProxy := cache.ProxyID[200]
-	_, foundRecentReverse := cache.ReverseID[600]
-	cache.mu.RUnlock()
+	_, foundOldProxy := getTestItem(cache, 100)
+	foundOldReverse := reverseTestExists(cache, 500)
+	_, foundRecentProxy := getTestItem(cache, 200)
+	foundRecentReverse := reverseTestExists(cache, 600)
 
 	if foundOldProxy {
 		t.Error("Old item should be cleaned up")
@@ -220,6 +238,83 @@ func TestCacheEntry_SaveAndLoad(t *testing.T) {
 	}
 }
 
+// TestCacheEntry_SaveStatus проверяет состояние БД после успешного и неудачного сохранения
+func TestCacheEntry_SaveStatus(t *testing.T) {
+	path := t.TempDir() + "/status.db"
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheEntry := newCacheEntry()
+	if status := cacheEntry.SaveStatus(); status.DBOpen || !status.LastSave.IsZero() {
+		t.Errorf("unexpected status without database: %+v", status)
+	}
+
+	cacheEntry.db = db
+	cacheEntry.CacheType["hosts"] = newCache()
+	cacheEntry.CacheType["hosts"].Set(100, 500, 1, "TestHost")
+	if err := cacheEntry.save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	saved := cacheEntry.SaveStatus()
+	if !saved.DBOpen || saved.LastSave.IsZero() || saved.LastError != nil {
+		t.Errorf("unexpected status after save: %+v", saved)
+	}
+
+	// Ошибка сохранения не сбрасывает время последнего успешного сохранения
+	db.Close()
+	cacheEntry.CacheType["hosts"].Set(200, 600, 1, "TestHost2")
+	if err := cacheEntry.save(); err == nil {
+		t.Fatal("expected save error on closed database")
+	}
+	failed := cacheEntry.SaveStatus()
+	if failed.LastError == nil || !failed.LastSave.Equal(saved.LastSave) {
+		t.Errorf("unexpected status after failed save: %+v", failed)
+	}
+}
+
+// TestCacheEntry_SaveAndCleanupOnDemand тестирует сохранение и очистку кеша по запросу
+func TestCacheEntry_SaveAndCleanupOnDemand(t *testing.T) {
+	cacheEntry := newCacheEntry()
+	cacheEntry.CacheType["hosts"] = newCache()
+	cacheEntry.CacheType["hosts"].Set(100, 500, 1, "TestHost")
+
+	if err := cacheEntry.Save(); err == nil {
+		t.Error("expected save error without database")
+	}
+	if _, err := cacheEntry.Cleanup(); err == nil {
+		t.Error("expected cleanup error without ttl")
+	}
+
+	db, err := bbolt.Open(t.TempDir()+"/ondemand.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cacheEntry.db = db
+	if err := cacheEntry.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if status := cacheEntry.SaveStatus(); status.LastSave.IsZero() {
+		t.Errorf("save time is not recorded: %+v", status)
+	}
+
+	cacheEntry.ttl = 30 * time.Millisecond
+	time.Sleep(50 * time.Millisecond)
+	cacheEntry.CacheType["hosts"].Set(200, 600, 1, "FreshHost")
+	removed, err := cacheEntry.Cleanup()
+	if err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 removed mapping, got %d", removed)
+	}
+	if _, found := cacheEntry.CacheType["hosts"].GetOriginalID(200, 1); !found {
+		t.Error("fresh mapping should be kept")
+	}
+}
+
 func TestCacheEntry_AutoSaveAndCleanup(t *testing.T) {
 	tmpFile, err := os.CreateTemp("", "testdb.*.bolt")
 	if err != nil {
@@ -352,9 +447,12 @@ func TestConcurrentAccess(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Should not panic and maintain data consistency
-	cache.mu.RLock()
-	proxyCount := len(cache.ProxyID)
-	cache.mu.RUnlock()
+	proxyCount := 0
+	for _, shard := range cache.proxyShards {
+		shard.mu.RLock()
+		proxyCount += len(shard.items)
+		shard.mu.RUnlock()
+	}
 
 	if proxyCount == 0 {
 		t.Error("Concurrent access should maintain data")
@@ -853,14 +951,11 @@ func TestGetEntityNameAfterCleanup(t *testing.T) {
 	cache := newCache()
 
 	// Добавляем устаревшую запись
-	cache.mu.Lock()
-	cache.ProxyID[100] = cacheItem{
+	cache.restoreItem(100, cacheItem{
 		Name:       "OldHost",
 		OriginalID: map[int]int{1: 500},
 		CreatedAt:  time.Now().Add(-2 * time.Hour),
-	}
-	cache.ReverseID[500] = reverseID{ProxyID: map[int]int{1: 100}}
-	cache.mu.Unlock()
+	})
 
 	// Добавляем свежую запись
 	cache.Set(200, 600, 1, "RecentHost")
@@ -981,3 +1076,550 @@ func TestGetEntityNameWithSpecialCharacters(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheEntry_Flush(t *testing.T) {
+	cacheEntry := newCacheEntry()
+	cacheEntry.CacheType["host"] = newCache()
+	cacheEntry.CacheType["group"] = newCache()
+
+	cacheEntry.CacheType["host"].Set(100, 500, 1, "HostA")
+	cacheEntry.CacheType["host"].Set(100, 501, 2, "HostA")
+	cacheEntry.CacheType["host"].Set(200, 600, 2, "HostB")
+	cacheEntry.CacheType["group"].Set(300, 700, 2, "GroupA")
+
+	// Сброс одного сервера в одном типе кеша
+	removed, err := cacheEntry.Flush("host", 2)
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 removed mappings, got %d", removed)
+	}
+
+	hosts := cacheEntry.CacheType["host"]
+	if originalID, found := hosts.GetOriginalID(100, 1); !found || originalID != 500 {
+		t.Errorf("Mapping for server 1 should remain, got %d, %v", originalID, found)
+	}
+	if _, found := hosts.GetOriginalID(100, 2); found {
+		t.Error("Mapping for server 2 should be removed")
+	}
+	if _, found := hosts.GetProxyID(600, 2); found {
+		t.Error("Reverse mapping for server 2 should be removed")
+	}
+	if _, found := hosts.GetEntityName(200); found {
+		t.Error("Entity existing only on server 2 should be removed")
+	}
+	if _, found := cacheEntry.CacheType["group"].GetOriginalID(300, 2); !found {
+		t.Error("Other cache types should not be affected")
+	}
+
+	// Сброс всех типов кеша
+	if _, err := cacheEntry.Flush("", 0); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	stats := cacheEntry.GetStats()
+	for key, count := range stats {
+		if count != 0 {
+			t.Errorf("Expected empty cache after full flush, %s = %d", key, count)
+		}
+	}
+
+	// Неизвестный тип кеша
+	if _, err := cacheEntry.Flush("unknown", 0); err == nil {
+		t.Error("Expected error for unknown cache type")
+	}
+}
+
+func TestCacheType_DeleteServerMapping(t *testing.T) {
+	cache := newCache()
+	cache.Set(100, 500, 1, "HostA")
+	cache.Set(100, 501, 2, "HostA")
+
+	cache.DeleteServerMapping(100, 2)
+
+	if _, found := cache.GetOriginalID(100, 2); found {
+		t.Error("Mapping for server 2 should be removed")
+	}
+	if _, found := cache.GetProxyID(501, 2); found {
+		t.Error("Reverse mapping for server 2 should be removed")
+	}
+	if originalID, found := cache.GetOriginalID(100, 1); !found || originalID != 500 {
+		t.Errorf("Mapping for server 1 should remain, got %d", originalID)
+	}
+
+	cache.DeleteServerMapping(100, 1)
+	if _, found := cache.GetEntityName(100); found {
+		t.Error("ProxyID without servers should be removed")
+	}
+
+	// Удаление несуществующего маппинга не должно паниковать
+	cache.DeleteServerMapping(999, 1)
+}
+
+func TestCacheEntry_GetServerStats(t *testing.T) {
+	cacheEntry := newCacheEntry()
+	cacheEntry.CacheType["host"] = newCache()
+
+	hosts := cacheEntry.CacheType["host"]
+	hosts.Set(100, 500, 1, "HostA")
+	hosts.Set(100, 501, 2, "HostA")
+	hosts.Set(200, 600, 1, "HostB")
+
+	// 2 попадания и 1 промах для сервера 1, 1 промах для сервера 2
+	hosts.GetOriginalID(100, 1)
+	hosts.GetProxyID(600, 1)
+	hosts.GetOriginalID(999, 1)
+	hosts.GetOriginalID(200, 2)
+
+	stats := cacheEntry.GetServerStats()["host"]
+
+	if stats[1].Entries != 2 || stats[2].Entries != 1 {
+		t.Errorf("Unexpected entries: server1=%d server2=%d", stats[1].Entries, stats[2].Entries)
+	}
+	if stats[1].Hits != 2 || stats[1].Misses != 1 {
+		t.Errorf("Unexpected counters for server 1: hits=%d misses=%d", stats[1].Hits, stats[1].Misses)
+	}
+	if stats[1].HitRate < 0.66 || stats[1].HitRate > 0.67 {
+		t.Errorf("Expected hit rate 2/3 for server 1, got %f", stats[1].HitRate)
+	}
+	if stats[2].HitRate != 0 {
+		t.Errorf("Expected zero hit rate for server 2, got %f", stats[2].HitRate)
+	}
+	if stats[1].LastUpdate.IsZero() {
+		t.Error("Last update should be set")
+	}
+}
+
+func TestCacheEntry_IncrementalSave(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "testdb.*.bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.Close()
+
+	db, err := bbolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cacheEntry := newCacheEntry()
+	cacheEntry.db = db
+	cacheEntry.CacheType["host"] = newCache()
+	hosts := cacheEntry.CacheType["host"]
+	hosts.Set(100, 500, 1, "HostA")
+	hosts.Set(200, 600, 1, "HostB")
+
+	if err := cacheEntry.save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if dirtyTestCount(hosts) != 0 {
+		t.Errorf("Expected no dirty entries after save, got %d", dirtyTestCount(hosts))
+	}
+
+	// Изменяется только одна запись, вторая удаляется
+	hosts.Set(100, 501, 2, "HostA")
+	hosts.Delete([]int{200})
+	if dirtyTestCount(hosts) != 2 {
+		t.Errorf("Expected 2 dirty entries, got %d", dirtyTestCount(hosts))
+	}
+	if err := cacheEntry.save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := newCacheEntry()
+	loaded.db = db
+	if err := loaded.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	loadedHosts := loaded.CacheType["host"]
+	if id, found := loadedHosts.GetOriginalID(100, 2); !found || id != 501 {
+		t.Errorf("Expected updated mapping 501, got %d, found %v", id, found)
+	}
+	if _, found := loadedHosts.GetOriginalID(200, 1); found {
+		t.Error("Deleted entry should not be loaded")
+	}
+	if proxyID, found := loadedHosts.GetProxyID(501, 2); !found || proxyID != 100 {
+		t.Errorf("Reverse mapping should be restored, got %d, found %v", proxyID, found)
+	}
+}
+
+// TestCacheEntry_FullSaveReplacesBucket тестирует полную перезапись типа кеша через временный бакет
+func TestCacheEntry_FullSaveReplacesBucket(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "testdb.*.bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.Close()
+
+	db, err := bbolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cacheEntry := newCacheEntry()
+	cacheEntry.db = db
+	cacheEntry.CacheType["host"] = newCache()
+	hosts := cacheEntry.CacheType["host"]
+	hosts.Set(100, 500, 1, "HostA")
+	hosts.Set(200, 600, 1, "HostB")
+	if err := cacheEntry.save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Остаток прерванной полной записи не попадает в бакет типа
+	err = db.Update(func(tx *bbolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(tmpBucketName))
+		if err != nil {
+			return err
+		}
+		b, err := root.CreateBucketIfNotExists([]byte("host"))
+		if err != nil {
+			return err
+		}
+		return b.Put(proxyIDKey(300), []byte(`{}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts.Delete([]int{200})
+	hosts.dirtyAll.Store(true)
+	if err := cacheEntry.save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := newCacheEntry()
+	loaded.db = db
+	if err := loaded.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	loadedHosts := loaded.CacheType["host"]
+	if id, found := loadedHosts.GetOriginalID(100, 1); !found || id != 500 {
+		t.Errorf("Expected mapping 500, got %d, found %v", id, found)
+	}
+	if _, found := loadedHosts.GetOriginalID(200, 1); found {
+		t.Error("Deleted entry should not be loaded")
+	}
+	if _, found := loadedHosts.GetOriginalID(300, 1); found {
+		t.Error("Entry of interrupted save should not be loaded")
+	}
+
+	db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(tmpBucketName)).Bucket([]byte("host")) != nil {
+			t.Error("Temporary bucket should be moved after full save")
+		}
+		return nil
+	})
+}
+
+func TestCacheEntry_LoadLegacyFormat(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "testdb.*.bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.Close()
+
+	db, err := bbolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Сохраняем кеш одним значением, как в старых версиях
+	legacy := newCacheEntry()
+	legacy.CacheType["host"] = newCache()
+	legacy.CacheType["host"].Set(100, 500, 1, "HostA")
+	data, err := json.Marshal(legacy.toSerializable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(bucketName), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheEntry := newCacheEntry()
+	cacheEntry.db = db
+	if err := cacheEntry.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if id, found := cacheEntry.CacheType["host"].GetOriginalID(100, 1); !found || id != 500 {
+		t.Errorf("Expected legacy mapping 500, got %d, found %v", id, found)
+	}
+
+	// После сохранения старый ключ удаляется, данные доступны в новом формате
+	if err := cacheEntry.save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(bucketName)).Get([]byte(bucketName)) != nil {
+			t.Error("Legacy key should be removed after save")
+		}
+		return nil
+	})
+
+	migrated := newCacheEntry()
+	migrated.db = db
+	if err := migrated.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if id, found := migrated.CacheType["host"].GetOriginalID(100, 1); !found || id != 500 {
+		t.Errorf("Expected migrated mapping 500, got %d, found %v", id, found)
+	}
+}
+
+// TestShardIndexSpread тестирует равномерное распределение ProxyID одного сервера
+// (последняя цифра ID постоянна) и OriginalID по шардам
+func TestShardIndexSpread(t *testing.T) {
+	const keys = 32000
+	shapes := map[string]func(i int) int{
+		"sequential proxy IDs of server 1": func(i int) int { return i*10 + 1 },
+		"sequential proxy IDs of server 4": func(i int) int { return i*10 + 4 },
+		"hashed proxy IDs of server 2":     func(i int) int { return (i*7919%10_000_000)*10 + 2 },
+		"original IDs":                     func(i int) int { return 10000 + i },
+	}
+	for name, id := range shapes {
+		counts := make([]int, cacheShards)
+		for i := range keys {
+			counts[shardIndex(id(i), cacheShards)]++
+		}
+		mean := keys / cacheShards
+		for shard, n := range counts {
+			if n < mean/2 || n > mean*3/2 {
+				t.Errorf("%s: shard %d has %d keys, expected about %d", name, shard, n, mean)
+			}
+		}
+	}
+
+	if shardIndex(-10, cacheShards) < 0 || shardIndex(123, 1) != 0 {
+		t.Error("shardIndex out of range")
+	}
+}
+
+// benchmarkCacheParallel смешанная нагрузка на кеш: каждая десятая операция -
+// запись, остальные - чтение. ProxyID в форме реальных (ID*10 + ID сервера).
+// Сравнение с одним шардом показывает выигрыш от шардирования при росте -cpu
+func benchmarkCacheParallel(b *testing.B, shards int) {
+	const keys = 10000
+	cache := newShardedCache(shards)
+	for i := 1; i <= keys; i++ {
+		cache.Set(i*10+1, i, 1, "Host")
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			key := i%keys + 1
+			if i%10 == 0 {
+				cache.Set(key*10+1, key, 1, "Host")
+			} else {
+				cache.GetOriginalID(key*10+1, 1)
+				cache.GetProxyID(key, 1)
+			}
+		}
+	})
+}
+
+func BenchmarkCacheType_SingleShard(b *testing.B) {
+	benchmarkCacheParallel(b, 1)
+}
+
+func BenchmarkCacheType_Sharded(b *testing.B) {
+	benchmarkCacheParallel(b, cacheShards)
+}
+
+func TestCacheType_CleanupPerServer(t *testing.T) {
+	cache := newCache()
+	now := time.Now()
+
+	// Маппинг сервера 1 устарел, маппинг сервера 2 актуален
+	cache.restoreItem(100, cacheItem{
+		Name:       "HostA",
+		OriginalID: map[int]int{1: 500, 2: 600},
+		CreatedAt:  now,
+		UpdatedAt:  map[int]time.Time{1: now.Add(-2 * time.Hour), 2: now},
+	})
+
+	cache.cleanup(time.Hour)
+
+	if _, found := cache.GetOriginalID(100, 1); found {
+		t.Error("Expired mapping for server 1 should be removed")
+	}
+	if _, found := cache.GetProxyID(500, 1); found {
+		t.Error("Expired reverse mapping for server 1 should be removed")
+	}
+	if id, found := cache.GetOriginalID(100, 2); !found || id != 600 {
+		t.Errorf("Mapping for server 2 should remain, got %d, found %v", id, found)
+	}
+	if proxyID, found := cache.GetProxyID(600, 2); !found || proxyID != 100 {
+		t.Errorf("Reverse mapping for server 2 should remain, got %d, found %v", proxyID, found)
+	}
+}
+
+func TestCacheType_SetRefreshesOnlyServerTTL(t *testing.T) {
+	cache := newCache()
+	cache.restoreItem(100, cacheItem{
+		Name:       "HostA",
+		OriginalID: map[int]int{1: 500, 2: 600},
+		CreatedAt:  time.Now().Add(-2 * time.Hour),
+	})
+
+	// Обновление маппинга сервера 2 не должно продлевать маппинг сервера 1
+	cache.Set(100, 600, 2, "HostA")
+	cache.cleanup(time.Hour)
+
+	if _, found := cache.GetOriginalID(100, 1); found {
+		t.Error("Mapping for server 1 should expire")
+	}
+	if _, found := cache.GetOriginalID(100, 2); !found {
+		t.Error("Refreshed mapping for server 2 should remain")
+	}
+}
+
+func TestCacheType_TakeDirtySnapshotIsolation(t *testing.T) {
+	cache := newCache()
+	cache.Set(100, 500, 1, "HostA")
+
+	_, changes := cache.takeDirty()
+
+	// Изменения после снимка не должны затрагивать снимок
+	cache.Set(100, 501, 1, "HostA")
+	cache.Set(100, 600, 2, "HostA")
+
+	item := changes[100]
+	if item == nil {
+		t.Fatal("Snapshot should contain proxyID 100")
+	}
+	if item.OriginalID[1] != 500 || len(item.OriginalID) != 1 {
+		t.Errorf("Snapshot was modified after take: %v", item.OriginalID)
+	}
+	if dirtyTestCount(cache) != 1 {
+		t.Errorf("Expected proxyID 100 to be dirty again, got %d dirty entries", dirtyTestCount(cache))
+	}
+}
+
+func TestCacheEntry_SaveConcurrentWithWrites(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "testdb.*.bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.Close()
+
+	db, err := bbolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cacheEntry := newCacheEntry()
+	cacheEntry.db = db
+	cacheEntry.CacheType["host"] = newCache()
+	hosts := cacheEntry.CacheType["host"]
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 2000; i++ {
+			hosts.Set(i*10+1, i, 1, "Host")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			if err := cacheEntry.save(); err != nil {
+				t.Errorf("Save failed: %v", err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	if err := cacheEntry.save(); err != nil {
+		t.Fatalf("Final save failed: %v", err)
+	}
+
+	loaded := newCacheEntry()
+	loaded.db = db
+	if err := loaded.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if stats := loaded.GetStats(); stats["host_proxy_items"] != 2000 {
+		t.Errorf("Expected 2000 saved items, got %d", stats["host_proxy_items"])
+	}
+}
+
+func TestCacheEntry_CheckIDScheme(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "testdb.*.bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.Close()
+
+	db, err := bbolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cacheEntry := newCacheEntry()
+	cacheEntry.db = db
+	cacheEntry.CacheType["host"] = newCache()
+	cacheEntry.CacheType["host"].Set(100, 500, 1, "HostA")
+
+	cfg := CacheCfg{IDHash: "fnv32a", IDDigits: 7}
+	if err := cacheEntry.checkIDScheme(cfg); err != nil {
+		t.Fatalf("checkIDScheme failed: %v", err)
+	}
+
+	// Смена схемы без flush сохраняет маппинги
+	cfg.IDDigits = 10
+	if err := cacheEntry.checkIDScheme(cfg); err != nil {
+		t.Fatalf("checkIDScheme failed: %v", err)
+	}
+	if _, found := cacheEntry.CacheType["host"].GetOriginalID(100, 1); !found {
+		t.Error("Mappings should be kept when id_migration is not set")
+	}
+
+	// Смена схемы с flush сбрасывает кеш
+	cfg.IDHash = "fnv64a"
+	cfg.IDMigration = "flush"
+	if err := cacheEntry.checkIDScheme(cfg); err != nil {
+		t.Fatalf("checkIDScheme failed: %v", err)
+	}
+	if _, found := cacheEntry.CacheType["host"].GetOriginalID(100, 1); found {
+		t.Error("Mappings should be flushed when id_migration is flush")
+	}
+
+	// Повторный запуск с той же схемой ничего не сбрасывает
+	cacheEntry.CacheType["host"].Set(200, 600, 1, "HostB")
+	if err := cacheEntry.checkIDScheme(cfg); err != nil {
+		t.Fatalf("checkIDScheme failed: %v", err)
+	}
+	if _, found := cacheEntry.CacheType["host"].GetOriginalID(200, 1); !found {
+		t.Error("Mappings should be kept when scheme is unchanged")
+	}
+
+	// Шаблон различаемых имен входит в схему
+	cfg.NameTemplate = "{name} [{server}]"
+	if err := cacheEntry.checkIDScheme(cfg); err != nil {
+		t.Fatalf("checkIDScheme failed: %v", err)
+	}
+	if _, found := cacheEntry.CacheType["host"].GetOriginalID(200, 1); found {
+		t.Error("Mappings should be flushed when name template changes")
+	}
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Версии формата хранения кеша в БД:
+//
+//	1 - весь кеш одним JSON значением под ключом bucketName
+//	2 - вложенный бакет на тип кеша, запись на каждый ProxyID
+//	3 - время обновления маппинга хранится для каждого сервера (UpdatedAt)
+const (
+	cacheSchemaVersion = 3
+	schemaVersionKey   = "schema_version"
+)
+
+// errSchemaTooNew БД записана более новой версией прокси и не может быть загружена
+var errSchemaTooNew = errors.New("cache schema version is newer than supported")
+
+// schemaMigrations шаги миграции: ключ - исходная версия, шаг переводит БД на следующую
+var schemaMigrations = map[int]func(tx *bbolt.Tx) error{
+	1: migrateV1toV2,
+	2: migrateV2toV3,
+}
+
+// storedSchemaVersion определяет версию формата БД. Для БД, созданных до
+// появления версии, она определяется по содержимому
+func storedSchemaVersion(tx *bbolt.Tx) (int, error) {
+	if meta := tx.Bucket([]byte(metaBucketName)); meta != nil {
+		if v := meta.Get([]byte(schemaVersionKey)); v != nil {
+			return strconv.Atoi(string(v))
+		}
+	}
+
+	root := tx.Bucket([]byte(bucketName))
+	if root == nil {
+		// Пустая БД
+		return cacheSchemaVersion, nil
+	}
+	if root.Get([]byte(bucketName)) != nil {
+		return 1, nil
+	}
+	return 2, nil
+}
+
+// setSchemaVersion записывает версию формата БД
+func setSchemaVersion(tx *bbolt.Tx, version int) error {
+	meta, err := tx.CreateBucketIfNotExists([]byte(metaBucketName))
+	if err != nil {
+		return err
+	}
+	return meta.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(version)))
+}
+
+// migrate приводит БД к текущей версии формата. Все шаги выполняются в одной
+// транзакции, поэтому при ошибке БД остается в исходном состоянии
+func (ce *CacheEntry) migrate() error {
+	return ce.db.Update(func(tx *bbolt.Tx) error {
+		version, err := storedSchemaVersion(tx)
+		if err != nil {
+			return fmt.Errorf("read cache schema version: %w", err)
+		}
+		if version > cacheSchemaVersion {
+			return fmt.Errorf("%w: %d > %d", errSchemaTooNew, version, cacheSchemaVersion)
+		}
+
+		for v := version; v < cacheSchemaVersion; v++ {
+			step, ok := schemaMigrations[v]
+			if !ok {
+				return fmt.Errorf("no migration for cache schema version %d", v)
+			}
+			if err := step(tx); err != nil {
+				return fmt.Errorf("migrate cache schema %d -> %d: %w", v, v+1, err)
+			}
+			logger.Global.Infof("Cache schema migrated from version %d to %d", v, v+1)
+		}
+
+		return setSchemaVersion(tx, cacheSchemaVersion)
+	})
+}
+
+// migrateV1toV2 раскладывает кеш из одного JSON значения по записям.
+// Обратный кеш не переносится, он восстанавливается по прямому при загрузке
+func migrateV1toV2(tx *bbolt.Tx) error {
+	root := tx.Bucket([]byte(bucketName))
+	data := root.Get([]byte(bucketName))
+
+	var serializable serializablecacheEntry
+	if err := json.Unmarshal(data, &serializable); err != nil {
+		return err
+	}
+
+	for cacheTypeName, serializableCache := range serializable.CacheType {
+		b, err := root.CreateBucketIfNotExists([]byte(cacheTypeName))
+		if err != nil {
+			return err
+		}
+		for proxyID, item := range serializableCache.ProxyID {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(proxyIDKey(proxyID), data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return root.Delete([]byte(bucketName))
+}
+
+// migrateV2toV3 заполняет время обновления каждого сервера из общего CreatedAt
+func migrateV2toV3(tx *bbolt.Tx) error {
+	root := tx.Bucket([]byte(bucketName))
+	if root == nil {
+		return nil
+	}
+
+	return root.ForEachBucket(func(name []byte) error {
+		b := root.Bucket(name)
+
+		updated := make(map[int]cacheItem)
+		err := b.ForEach(func(k, v []byte) error {
+			var item cacheItem
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			if item.UpdatedAt != nil {
+				return nil
+			}
+			item.UpdatedAt = make(map[int]time.Time, len(item.OriginalID))
+			for serverID := range item.OriginalID {
+				item.UpdatedAt[serverID] = item.CreatedAt
+			}
+			updated[int(binary.BigEndian.Uint64(k))] = item
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Изменять бакет во время ForEach нельзя, поэтому записываем после обхода
+		for proxyID, item := range updated {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(proxyIDKey(proxyID), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
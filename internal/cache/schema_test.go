@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// openTestDB открывает временную БД для тестов
+func openTestDB(t *testing.T) *bbolt.DB {
+	tmpFile, err := os.CreateTemp("", "testdb.*.bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+	t.Cleanup(func() { os.Remove(tmpFile.Name()) })
+
+	db, err := bbolt.Open(tmpFile.Name(), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// readSchemaVersion читает сохраненную версию формата БД
+func readSchemaVersion(t *testing.T, db *bbolt.DB) int {
+	var version int
+	err := db.View(func(tx *bbolt.Tx) error {
+		var err error
+		version, err = storedSchemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestMigrate_EmptyDatabase(t *testing.T) {
+	db := openTestDB(t)
+
+	cacheEntry := newCacheEntry()
+	cacheEntry.db = db
+	if err := cacheEntry.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if version := readSchemaVersion(t, db); version != cacheSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", cacheSchemaVersion, version)
+	}
+}
+
+func TestMigrate_V2toV3(t *testing.T) {
+	db := openTestDB(t)
+
+	// Запись версии 2: без версии в meta и без UpdatedAt
+	createdAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	data, _ := json.Marshal(cacheItem{
+		Name:       "HostA",
+		OriginalID: map[int]int{1: 500, 2: 600},
+		CreatedAt:  createdAt,
+	})
+	err := db.Update(func(tx *bbolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		if err != nil {
+			return err
+		}
+		b, err := root.CreateBucketIfNotExists([]byte("host"))
+		if err != nil {
+			return err
+		}
+		return b.Put(proxyIDKey(100), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version := readSchemaVersion(t, db); version != 2 {
+		t.Fatalf("Expected detected schema version 2, got %d", version)
+	}
+
+	cacheEntry := newCacheEntry()
+	cacheEntry.db = db
+	if err := cacheEntry.load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if version := readSchemaVersion(t, db); version != cacheSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", cacheSchemaVersion, version)
+	}
+
+	item, found := getTestItem(cacheEntry.CacheType["host"], 100)
+	if !found {
+		t.Fatal("Migrated item should be loaded")
+	}
+	for _, serverID := range []int{1, 2} {
+		if !item.UpdatedAt[serverID].Equal(createdAt) {
+			t.Errorf("Expected UpdatedAt for server %d to be %v, got %v", serverID, createdAt, item.UpdatedAt[serverID])
+		}
+	}
+}
+
+func TestMigrate_NewerVersion(t *testing.T) {
+	db := openTestDB(t)
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		return setSchemaVersion(tx, cacheSchemaVersion+1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheEntry := newCacheEntry()
+	cacheEntry.db = db
+	if err := cacheEntry.load(); !errors.Is(err, errSchemaTooNew) {
+		t.Errorf("Expected errSchemaTooNew, got %v", err)
+	}
+
+	// Версия в БД не должна понижаться
+	err = db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte(metaBucketName)).Get([]byte(schemaVersionKey))
+		if string(v) != strconv.Itoa(cacheSchemaVersion+1) {
+			t.Errorf("Schema version should stay %d, got %s", cacheSchemaVersion+1, v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// WriteSnapshot сохраняет изменения кеша и записывает в w согласованную копию БД.
+// Копия передается пассивному узлу HA пары (см. ReplaceFile)
+func (ce *CacheEntry) WriteSnapshot(w io.Writer) (int64, error) {
+	if ce.db == nil {
+		return 0, fmt.Errorf("cache database is not open")
+	}
+	if err := ce.save(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err := ce.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// ReplaceFile заменяет файл БД кеша path копией из r (см. WriteSnapshot).
+// Копия записывается во временный файл рядом с path и проверяется открытием БД,
+// поэтому прерванная или поврежденная передача не затирает прежний файл.
+// Файл path не должен быть открыт этим процессом
+func ReplaceFile(path string, r io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".sync-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("write cache snapshot: %w", err)
+	}
+
+	db, err := bbolt.Open(tmp.Name(), 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return n, fmt.Errorf("invalid cache snapshot: %w", err)
+	}
+	err = db.View(func(tx *bbolt.Tx) error {
+		// Check передает все найденные ошибки, канал читается до конца
+		var first error
+		for err := range tx.Check() {
+			if first == nil {
+				first = err
+			}
+		}
+		return first
+	})
+	db.Close()
+	if err != nil {
+		return n, fmt.Errorf("invalid cache snapshot: %w", err)
+	}
+
+	return n, os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSnapshotReplaceFile тестирует передачу кеша копией файла БД
+func TestSnapshotReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := CacheCfg{
+		TTL:             "1h",
+		CleanupInterval: "1m",
+		DBPath:          filepath.Join(dir, "active.db"),
+		AutoSave:        "30s",
+		CachedFields:    map[string]string{"host": "name"},
+	}
+
+	active := Init(cfg)
+	active.CacheType["host"].Set(100, 500, 1, "HostA")
+
+	// Копия содержит еще не сохраненные маппинги
+	var snapshot bytes.Buffer
+	if _, err := active.WriteSnapshot(&snapshot); err != nil {
+		t.Fatalf("WriteSnapshot failed: %v", err)
+	}
+	active.Stop()
+
+	replica := filepath.Join(dir, "passive.db")
+	if err := os.WriteFile(replica, []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReplaceFile(replica, &snapshot); err != nil {
+		t.Fatalf("ReplaceFile failed: %v", err)
+	}
+
+	cfg.DBPath = replica
+	passive := Init(cfg)
+	defer passive.Stop()
+	if originalID, found := passive.CacheType["host"].GetOriginalID(100, 1); !found || originalID != 500 {
+		t.Errorf("Replicated mapping: expected 500, got %d, found %v", originalID, found)
+	}
+}
+
+// TestSnapshotReplaceFileInvalid тестирует, что поврежденная копия не заменяет файл
+func TestSnapshotReplaceFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.db")
+	if err := os.WriteFile(path, []byte("previous"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReplaceFile(path, strings.NewReader("truncated snapshot")); err == nil {
+		t.Fatal("ReplaceFile should reject an invalid snapshot")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "previous" {
+		t.Errorf("Previous file was overwritten: %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Temporary file was not removed: %v", entries)
+	}
+
+	// Без БД копия не создается
+	if _, err := (&CacheEntry{}).WriteSnapshot(&bytes.Buffer{}); err == nil {
+		t.Error("WriteSnapshot should fail without a database")
+	}
+}
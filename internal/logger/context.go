@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// TraceIDField поле с ID запроса. Выводится первым в виде [trace_id],
+// как в сообщениях, где ID запроса подставлялся вручную
+const TraceIDField = "trace_id"
+
+// Fields поля, добавляемые к каждому сообщению логгера
+type Fields map[string]any
+
+type ctxKey struct{}
+
+// WithFields возвращает логгер, добавляющий поля к каждому сообщению. Поля l
+// сохраняются, одноименные заменяются. Остальные поля, кроме trace_id, выводятся
+// как key=value в порядке имен
+func (l *Logger) WithFields(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	maps.Copy(merged, l.fields)
+	maps.Copy(merged, fields)
+
+	var b strings.Builder
+	if id, ok := merged[TraceIDField]; ok {
+		fmt.Fprintf(&b, "[%v] ", id)
+	}
+	for _, k := range slices.Sorted(maps.Keys(merged)) {
+		if k != TraceIDField {
+			fmt.Fprintf(&b, "%s=%v ", k, merged[k])
+		}
+	}
+	return &Logger{Logger: l.Logger, fields: merged, prefix: b.String()}
+}
+
+// NewContext возвращает контекст с логгером запроса
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// WithContext возвращает логгер запроса из контекста или Global, если его нет
+func WithContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+		return l
+	}
+	return Global
+}
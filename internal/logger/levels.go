@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetLevels изменяет уровни логирования консоли и файла до перезагрузки конфигурации
+// или перезапуска. Пустой уровень не изменяется
+func SetLevels(console, file string) error {
+	l := Global.Logger
+	if l.LogLevelMap == nil {
+		return fmt.Errorf("logger is not initialized")
+	}
+	levels := make([]int, 2)
+	for i, level := range []string{console, file} {
+		if level == "" {
+			continue
+		}
+		n, ok := l.LogLevelMap[strings.ToLower(level)]
+		if !ok {
+			return fmt.Errorf("invalid log level: %s", level)
+		}
+		levels[i] = n
+	}
+	if console != "" {
+		l.ConsoleLogLevel = levels[0]
+	}
+	if file != "" {
+		l.FileLogLevel = levels[1]
+	}
+	return nil
+}
+
+// Levels возвращает текущие уровни логирования консоли и файла
+func Levels() (console, file string) {
+	l := Global.Logger
+	for name, n := range l.LogLevelMap {
+		if n == l.ConsoleLogLevel {
+			console = name
+		}
+		if n == l.FileLogLevel {
+			file = name
+		}
+	}
+	return console, file
+}
@@ -1,6 +1,12 @@
 package logger
 
 import (
+	"compress/gzip"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
 	"github.com/a3ak/suffix"
 	"github.com/nir0k/logger"
 )
@@ -9,42 +15,101 @@ type Logging struct {
 	FilePath        string   `yaml:"file_path"`
 	MaxSize         string   `yaml:"max_size"`
 	MaxBackups      int      `yaml:"max_backups"`
+	MaxAge          string   `yaml:"max_age"`        // Срок хранения архивных файлов (по умолчанию 7d, 0 - без ограничения)
+	Rotate          string   `yaml:"rotate"`         // Ротация по времени: hourly или daily (пусто - только по размеру)
+	Compress        *bool    `yaml:"compress"`       // Сжатие архивных файлов, по умолчанию true
+	CompressLevel   int      `yaml:"compress_level"` // Уровень сжатия gzip 1-9 (0 - по умолчанию)
 	ConsoleLevel    string   `yaml:"console_level"`
 	FileLevel       string   `yaml:"file_level"`
-	ExcludeRequests []string `yaml:"exclude_requests"`
+	ExcludeMethods  []string `yaml:"exclude_methods"`  // Методы без логирования тел запросов и ответов
+	ExcludeRequests []string `yaml:"exclude_requests"` // Устарело: logging.exclude_methods и tracing.exclude_methods
 }
 
-var Global *logger.Logger
+var Global *Logger
+
+// output файл лога текущего логгера, ротируемый по сигналу
+var (
+	outputMu sync.Mutex
+	output   *rotatingFile
+)
 
 func init() {
-	Global = &logger.Logger{}
+	Global = &Logger{Logger: &logger.Logger{}}
 }
 
 func InitLogger(conf Logging) {
+	global, file, err := newLogger(conf)
+	if err != nil {
+		panic(err)
+	}
+
+	outputMu.Lock()
+	previous := output
+	output = file
+	outputMu.Unlock()
+
+	Global = global
+	// Сообщения логгеров, созданных до перезагрузки, пишутся в прежний файл, открываемый заново
+	if previous != nil {
+		previous.Close()
+	}
+	Global.Infoln("Init LOGGER ", conf)
+}
+
+// New создает логгер по настройкам, не заменяя Global (например для логгера запроса,
+// передаваемого через NewContext). Ротация по сигналу к его файлу не применяется
+func New(conf Logging) (*Logger, error) {
+	l, _, err := newLogger(conf)
+	return l, err
+}
+
+// newLogger создает логгер и файл лога с ротацией (nil, если file_path не задан)
+func newLogger(conf Logging) (*Logger, *rotatingFile, error) {
 	consoleLevel := conf.ConsoleLevel
 	if consoleLevel == "" {
 		consoleLevel = "error"
 	}
 
+	compress := conf.Compress == nil || *conf.Compress
+	compressLevel := conf.CompressLevel
+	if compressLevel == 0 {
+		compressLevel = gzip.DefaultCompression
+	}
+	maxAge := 7 * 24 * time.Hour
+	if conf.MaxAge != "" {
+		maxAge = time.Duration(suffix.UnsafeToSeconds(conf.MaxAge)) * time.Second
+	}
+
+	// Файл пишется собственным writer с ротацией, библиотеке путь не передается
 	loggerConf := logger.LogConfig{
-		FilePath:       conf.FilePath,
-		Format:         "standard",
-		FileLevel:      conf.FileLevel,
-		ConsoleLevel:   consoleLevel,
-		ConsoleOutput:  conf.ConsoleLevel != "",
-		EnableRotation: true,
-		RotationConfig: logger.RotationConfig{
-			MaxSize:    int(suffix.UnsafeToMB(conf.MaxSize)),
-			MaxBackups: conf.MaxBackups,
-			MaxAge:     7,
-			Compress:   true,
-		},
-	}
-
-	if global, err := logger.NewLogger(loggerConf); err != nil {
-		panic(err)
-	} else {
-		Global = global
-		global.Infoln("Init LOGGER ", loggerConf)
+		Format:        "standard",
+		FileLevel:     conf.FileLevel,
+		ConsoleLevel:  consoleLevel,
+		ConsoleOutput: conf.ConsoleLevel != "",
+	}
+
+	l, err := logger.NewLogger(loggerConf)
+	if err != nil {
+		return nil, nil, err
+	}
+	var file *rotatingFile
+	if conf.FilePath != "" {
+		file, err = newRotatingFile(conf.FilePath, suffix.UnsafeToB(conf.MaxSize), conf.MaxBackups, maxAge, conf.Rotate, compress, compressLevel)
+		if err != nil {
+			return nil, nil, err
+		}
+		l.FileLogger = log.New(file, "", 0)
+	}
+	return &Logger{Logger: l}, file, nil
+}
+
+// Rotate выполняет ротацию файла лога (по сигналу SIGUSR1)
+func Rotate() error {
+	outputMu.Lock()
+	file := output
+	outputMu.Unlock()
+	if file == nil {
+		return fmt.Errorf("log file is not configured")
 	}
+	return file.Rotate()
 }
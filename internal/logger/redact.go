@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nir0k/logger"
+)
+
+// redactedSecret замена секрета в логах и ошибках
+const redactedSecret = "***"
+
+// Секреты короче не скрываются, что бы не искажать обычный текст
+const minSecretLen = 4
+
+// Известные секреты (токены серверов Zabbix), скрываемые в логах и ошибках
+var secrets atomic.Pointer[[]string]
+
+// SetSecrets задает секреты, скрываемые в логах и ошибках. Заменяет ранее заданные,
+// т.к. вызывается при каждой (пере)загрузке конфигурации
+func SetSecrets(list ...string) {
+	valid := make([]string, 0, len(list))
+	for _, s := range list {
+		if len(s) >= minSecretLen {
+			valid = append(valid, s)
+		}
+	}
+	secrets.Store(&valid)
+}
+
+// Redact заменяет в строке известные секреты
+func Redact(s string) string {
+	list := secrets.Load()
+	if list == nil {
+		return s
+	}
+	for _, secret := range *list {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, redactedSecret)
+		}
+	}
+	return s
+}
+
+// redactedError ошибка с замененными секретами. Исходная ошибка доступна через
+// errors.As/errors.Is, т.к. ее тип используется при обработке (ошибки Zabbix)
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// RedactError возвращает ошибку, текст которой не содержит известных секретов
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if redacted := Redact(msg); redacted != msg {
+		return &redactedError{err: err, msg: redacted}
+	}
+	return err
+}
+
+// Logger логгер, скрывающий известные секреты во всех сообщениях
+type Logger struct {
+	*logger.Logger
+	// Поля логгера запроса (см. WithFields) и их представление в начале сообщения
+	fields Fields
+	prefix string
+}
+
+func (l *Logger) Tracef(format string, v ...any) {
+	l.Logger.Tracef("%s", Redact(l.prefix+fmt.Sprintf(format, v...)))
+}
+
+func (l *Logger) Debugf(format string, v ...any) {
+	l.Logger.Debugf("%s", Redact(l.prefix+fmt.Sprintf(format, v...)))
+}
+
+func (l *Logger) Infof(format string, v ...any) {
+	l.Logger.Infof("%s", Redact(l.prefix+fmt.Sprintf(format, v...)))
+}
+
+func (l *Logger) Warningf(format string, v ...any) {
+	l.Logger.Warningf("%s", Redact(l.prefix+fmt.Sprintf(format, v...)))
+}
+
+func (l *Logger) Errorf(format string, v ...any) {
+	l.Logger.Errorf("%s", Redact(l.prefix+fmt.Sprintf(format, v...)))
+}
+
+func (l *Logger) Fatalf(format string, v ...any) {
+	l.Logger.Fatalf("%s", Redact(l.prefix+fmt.Sprintf(format, v...)))
+}
+
+func (l *Logger) Debug(v ...any)   { l.Logger.Debug(Redact(l.prefix + fmt.Sprint(v...))) }
+func (l *Logger) Info(v ...any)    { l.Logger.Info(Redact(l.prefix + fmt.Sprint(v...))) }
+func (l *Logger) Warning(v ...any) { l.Logger.Warning(Redact(l.prefix + fmt.Sprint(v...))) }
+func (l *Logger) Error(v ...any)   { l.Logger.Error(Redact(l.prefix + fmt.Sprint(v...))) }
+func (l *Logger) Fatal(v ...any)   { l.Logger.Fatal(Redact(l.prefix + fmt.Sprint(v...))) }
+
+func (l *Logger) Infoln(v ...any) {
+	l.Logger.Infoln(Redact(l.prefix + strings.TrimSuffix(fmt.Sprintln(v...), "\n")))
+}
+
+func (l *Logger) Warningln(v ...any) {
+	l.Logger.Warningln(Redact(l.prefix + strings.TrimSuffix(fmt.Sprintln(v...), "\n")))
+}
@@ -0,0 +1,243 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Периодичность ротации по времени
+const (
+	RotateHourly = "hourly"
+	RotateDaily  = "daily"
+)
+
+// backupTimeFormat формат времени в имени архивного файла: app-2006-01-02T15-04-05.000.log
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotatingFile файл лога с ротацией по размеру, по времени и по запросу.
+// Архивные файлы сжимаются и удаляются в фоне
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	// Размер файла, при превышении которого выполняется ротация (0 - без ограничения)
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+	// Периодичность ротации по времени (пусто - только по размеру)
+	every    string
+	compress bool
+	// Уровень сжатия gzip архивных файлов
+	compressLevel int
+
+	file *os.File
+	size int64
+	// Время следующей ротации по периоду
+	next time.Time
+
+	// Сжатие и удаление архивных файлов выполняются по одному
+	millMu sync.Mutex
+}
+
+// newRotatingFile открывает файл лога. Ошибка возвращается, если файл нельзя открыть
+func newRotatingFile(path string, maxSize int64, maxBackups int, maxAge time.Duration, every string, compress bool, compressLevel int) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:          path,
+		maxSize:       maxSize,
+		maxBackups:    maxBackups,
+		maxAge:        maxAge,
+		every:         every,
+		compress:      compress,
+		compressLevel: compressLevel,
+	}
+	if err := f.open(time.Now()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write записывает сообщение, выполняя ротацию при превышении размера или смене периода
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if f.file == nil {
+		if err := f.open(now); err != nil {
+			return 0, err
+		}
+	}
+	if (f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize) || (!f.next.IsZero() && !now.Before(f.next)) {
+		if err := f.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate выполняет ротацию независимо от размера и периода
+func (f *rotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate(time.Now())
+}
+
+// Close закрывает файл. Следующая запись открывает его снова
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// open открывает файл лога на дозапись. Период существующего файла считается от
+// времени его изменения: файл, оставшийся с прошлого периода, ротируется при первой записи
+func (f *rotatingFile) open(now time.Time) error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	start := now
+	if f.size > 0 {
+		start = info.ModTime()
+	}
+	f.next = nextRotation(start, f.every)
+	return nil
+}
+
+// rotate переименовывает текущий файл в архивный и открывает новый
+func (f *rotatingFile) rotate(now time.Time) error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	if _, err := os.Stat(f.path); err == nil {
+		if err := os.Rename(f.path, f.backupName(now)); err != nil {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	if err := f.open(now); err != nil {
+		return err
+	}
+	go f.mill(now)
+	return nil
+}
+
+// nextRotation возвращает начало следующего периода после t (нулевое время - без ротации по времени)
+func nextRotation(t time.Time, every string) time.Time {
+	switch every {
+	case RotateHourly:
+		return t.Truncate(time.Hour).Add(time.Hour)
+	case RotateDaily:
+		y, m, d := t.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+// backupName возвращает имя архивного файла для времени ротации t
+func (f *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, ext), t.Format(backupTimeFormat), ext)
+}
+
+// backup архивный файл лога
+type backup struct {
+	path string
+	time time.Time
+}
+
+// backups возвращает архивные файлы лога, начиная с новых
+func (f *rotatingFile) backups() ([]backup, error) {
+	dir := filepath.Dir(f.path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), ext) + "-"
+
+	var result []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		result = append(result, backup{path: filepath.Join(dir, name), time: t})
+	}
+	slices.SortFunc(result, func(a, b backup) int { return b.time.Compare(a.time) })
+	return result, nil
+}
+
+// mill удаляет архивные файлы сверх max_backups и старше max_age и сжимает остальные
+func (f *rotatingFile) mill(now time.Time) {
+	f.millMu.Lock()
+	defer f.millMu.Unlock()
+
+	files, err := f.backups()
+	if err != nil {
+		return
+	}
+	for i, b := range files {
+		if (f.maxBackups > 0 && i >= f.maxBackups) || (f.maxAge > 0 && now.Sub(b.time) > f.maxAge) {
+			os.Remove(b.path)
+			continue
+		}
+		if f.compress && !strings.HasSuffix(b.path, ".gz") {
+			compressFile(b.path, f.compressLevel)
+		}
+	}
+}
+
+// compressFile сжимает файл в path.gz и удаляет исходный
+func compressFile(path string, level int) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	gz, err := gzip.NewWriterLevel(dst, level)
+	if err == nil {
+		if _, err = io.Copy(gz, src); err == nil {
+			err = gz.Close()
+		}
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
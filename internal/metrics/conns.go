@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	clientConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zap_client_conns",
+		Help: "Current incoming client connections by state (new, active, idle, hijacked)",
+	}, []string{"state"})
+
+	clientConnectionEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "zap_client_conns_total",
+		Help: "Total incoming client connection events (accepted, hijacked, closed)",
+	}, []string{"event"})
+
+	connStates   = make(map[net.Conn]http.ConnState)
+	connStatesMu sync.Mutex
+)
+
+// connStateLabel возвращает метку состояния для gauge или "", если состояние не отслеживается
+func connStateLabel(state http.ConnState) string {
+	switch state {
+	case http.StateNew, http.StateActive, http.StateIdle, http.StateHijacked:
+		return state.String()
+	default:
+		return ""
+	}
+}
+
+// TrackConnState учитывает смену состояния клиентского соединения.
+// Используется как http.Server.ConnState
+func TrackConnState(c net.Conn, state http.ConnState) {
+	connStatesMu.Lock()
+	defer connStatesMu.Unlock()
+
+	if prev, ok := connStates[c]; ok {
+		clientConnections.WithLabelValues(connStateLabel(prev)).Dec()
+	}
+
+	switch state {
+	case http.StateNew:
+		clientConnectionEvents.WithLabelValues("accepted").Inc()
+	case http.StateHijacked:
+		clientConnectionEvents.WithLabelValues("hijacked").Inc()
+		// Захваченное соединение выходит из-под контроля http.Server и закрывается
+		// обработчиком. Момент закрытия известен только соединениям TrackListener
+		if _, ok := c.(*trackedConn); !ok {
+			delete(connStates, c)
+			return
+		}
+	case http.StateClosed:
+		clientConnectionEvents.WithLabelValues("closed").Inc()
+		delete(connStates, c)
+		return
+	}
+
+	connStates[c] = state
+	clientConnections.WithLabelValues(connStateLabel(state)).Inc()
+}
+
+// TrackListener оборачивает listener сервера, что бы учитывать закрытие захваченных
+// (hijacked) соединений: http.Server о нем не сообщает
+func TrackListener(l net.Listener) net.Listener {
+	return &trackedListener{Listener: l}
+}
+
+type trackedListener struct {
+	net.Listener
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &trackedConn{Conn: c}, nil
+}
+
+// trackedConn соединение клиента, закрытие которого учитывается после захвата
+type trackedConn struct {
+	net.Conn
+	closeOnce sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		connStatesMu.Lock()
+		defer connStatesMu.Unlock()
+		// Закрытие остальных соединений сообщает http.Server (StateClosed)
+		if connStates[c] == http.StateHijacked {
+			delete(connStates, c)
+			clientConnections.WithLabelValues(connStateLabel(http.StateHijacked)).Dec()
+			clientConnectionEvents.WithLabelValues("closed").Inc()
+		}
+	})
+	return err
+}
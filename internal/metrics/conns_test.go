@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// waitValue ожидает, что значение метрики станет равным want
+func waitValue(t *testing.T, name string, get func() float64, want float64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for get() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %v, expected %v", name, get(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestTrackConnState проверяет учет соединений по состояниям, включая захваченные
+func TestTrackConnState(t *testing.T) {
+	gauge := func(state string) func() float64 {
+		return func() float64 { return testutil.ToFloat64(clientConnections.WithLabelValues(state)) }
+	}
+	event := func(name string) func() float64 {
+		return func() float64 { return testutil.ToFloat64(clientConnectionEvents.WithLabelValues(name)) }
+	}
+	base := map[string]float64{}
+	for _, state := range []string{"active", "idle", "hijacked"} {
+		base[state] = gauge(state)()
+	}
+	accepted, hijacked, closed := event("accepted")(), event("hijacked")(), event("closed")()
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hijack" {
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Hijack failed: %v", err)
+				return
+			}
+			entered <- struct{}{}
+			<-release
+			buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+			buf.Flush()
+			conn.Close()
+			return
+		}
+		entered <- struct{}{}
+		<-release
+	}))
+	srv.Config.ConnState = TrackConnState
+	srv.Listener = TrackListener(srv.Listener)
+	srv.Start()
+	defer srv.Close()
+
+	send := func(conn net.Conn, path string) {
+		if _, err := conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	// Запрос выполняется - соединение active, после ответа - idle
+	conn := dial()
+	defer conn.Close()
+	send(conn, "/")
+	<-entered
+	waitValue(t, "active", gauge("active"), base["active"]+1)
+	release <- struct{}{}
+	if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil {
+		t.Fatal(err)
+	}
+	waitValue(t, "idle", gauge("idle"), base["idle"]+1)
+	waitValue(t, "active", gauge("active"), base["active"])
+
+	// Захваченное соединение учитывается до его закрытия обработчиком
+	hijackConn := dial()
+	defer hijackConn.Close()
+	send(hijackConn, "/hijack")
+	<-entered
+	waitValue(t, "hijacked", gauge("hijacked"), base["hijacked"]+1)
+	waitValue(t, "active", gauge("active"), base["active"])
+	release <- struct{}{}
+	if _, err := http.ReadResponse(bufio.NewReader(hijackConn), nil); err != nil {
+		t.Fatal(err)
+	}
+	waitValue(t, "hijacked", gauge("hijacked"), base["hijacked"])
+
+	// Закрытие клиентом idle соединения
+	conn.Close()
+	waitValue(t, "idle", gauge("idle"), base["idle"])
+
+	waitValue(t, "accepted events", event("accepted"), accepted+2)
+	waitValue(t, "hijacked events", event("hijacked"), hijacked+1)
+	waitValue(t, "closed events", event("closed"), closed+2)
+}
@@ -5,7 +5,7 @@ import (
 	"ZabbixAPIproxy/internal/proxy"
 	"context"
 	"net/http"
-	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,35 +17,7 @@ import (
 )
 
 var (
-	// Метрики runtime
-	m runtime.MemStats
-
 	// Регистрируем метрики
-	goroutinesCount = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "zap_goroutines",
-		Help: "Current number of goroutines",
-	})
-
-	memoryAlloc = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "zap_mem_alloc_bytes",
-		Help: "Bytes allocated and still in use",
-	})
-
-	memoryTotalAlloc = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "zap_memory_total_alloc_bytes",
-		Help: "Total bytes allocated",
-	})
-
-	memorySys = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "zap_memory_sys_bytes",
-		Help: "Total bytes obtained from system",
-	})
-
-	gcCount = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "zap_gc_cycles_total",
-		Help: "Total garbage collection cycles",
-	})
-
 	//Делаю Counter, т.к. в моменте тяжело поймать активные сессии. Выгоднее считать изменения во времени, например через rate
 	incomingRequests = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "zap_incoming_requests",
@@ -56,7 +28,19 @@ var (
 		Name:    "zap_request_duration_sec",
 		Help:    "Request duration to Zabbix servers",
 		Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30},
-	}, []string{"server", "method"})
+	}, []string{"server", "method", "status"})
+
+	idProcessing = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "zap_id_processing_seconds",
+		Help:    "Proxy time spent translating request and response IDs per client request",
+		Buckets: []float64{0.0001, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1},
+	}, []string{"method"})
+
+	upstreamRequestSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "zap_upstream_request_size_bytes",
+		Help:    "Estimated size of requests sent to Zabbix servers after ID translation",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 6), // 100B to ~10MB
+	}, []string{"method"})
 
 	requestStatus = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "zap_request",
@@ -68,6 +52,21 @@ var (
 		Help: "Number of items in cache by type",
 	}, []string{"cache", "type"})
 
+	cacheServerSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zap_cache_server_items",
+		Help: "Number of cache mappings by cache type and server",
+	}, []string{"cache", "server"})
+
+	cacheHitRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zap_cache_hit_ratio",
+		Help: "Cache lookup hit ratio by cache type and server",
+	}, []string{"cache", "server"})
+
+	cacheLastUpdate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zap_cache_last_update_sec",
+		Help: "Seconds since the most recent mapping update by cache type and server",
+	}, []string{"cache", "server"})
+
 	httpConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "zap_http_conns",
 		Help: "HTTP connections statistics",
@@ -76,8 +75,8 @@ var (
 	// Дополнительные метрики
 	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "zap_requests_total",
-		Help: "Total requests processed",
-	}, []string{"method", "status"})
+		Help: "Total requests processed by client (client=\"other\" beyond the first 50 clients)",
+	}, []string{"method", "status", "client"})
 
 	responseSize = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name:    "zap_response_size_bytes",
@@ -109,17 +108,86 @@ var (
 		Name: "zap_cb_transitions_total",
 		Help: "Total circuit breaker state transitions",
 	}, []string{"server"})
+
+	upstreamThrottled = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zap_upstream_throttled_sec",
+		Help: "Remaining pause of requests to a server that throttled the proxy (HTTP 429, 503 with Retry-After)",
+	}, []string{"server"})
+
+	dnsAddrs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zap_dns_addrs",
+		Help: "Number of cached DNS addresses per upstream host",
+	}, []string{"host"})
+
+	upstreamBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "zap_upstream_bytes_total",
+		Help: "Request and response body bytes exchanged with Zabbix servers by direction (sent, received)",
+	}, []string{"server", "direction"})
+
+	upstreamCertExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zap_upstream_cert_expiry_seconds",
+		Help: "Seconds until the TLS certificate of a Zabbix server expires (negative when expired)",
+	}, []string{"server"})
+
+	dnsFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "zap_dns_resolve_failures_total",
+		Help: "Total DNS resolution failures per upstream host",
+	}, []string{"host"})
+
+	queueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "zap_queue_wait_seconds",
+		Help:    "Time spent waiting for a request semaphore slot before querying Zabbix servers",
+		Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 5, 10},
+	}, []string{"server"})
+
+	memBudget = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zap_mem_budget_bytes",
+		Help: "Memory budget for upstream responses by type (limit, used)",
+	}, []string{"type"})
+
+	memBudgetWaiting = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "zap_mem_budget_waiting",
+		Help: "Upstream requests waiting for memory budget",
+	})
+
+	negativeIDs = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "zap_negative_ids",
+		Help: "ProxyIDs recently not found in cache (negative cache entries)",
+	})
+
+	haActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "zap_ha_active",
+		Help: "HA node role: 1 - active, 0 - passive (absent when HA is disabled)",
+	})
+
+	authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "zap_auth_failures_total",
+		Help: "Failed client authentications by reason (invalid_token, invalid_credentials, invalid_jwt, locked)",
+	}, []string{"reason"})
+
+	cacheReconciled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "zap_cache_reconciled_total",
+		Help: "Cache mappings processed by reconciliation job by action (checked, renamed, deleted, error)",
+	}, []string{"server", "action"})
 )
 
 // Exporter структура для управления метриками
 type Exporter struct {
-	registry   *prometheus.Registry
-	cancelFunc context.CancelFunc // Для остановки всех фоновых процессов
-	mu         sync.Mutex
+	// Proxy, статистика которого экспортируется
+	prx      *proxy.Proxy
+	registry *prometheus.Registry
+	// Результаты запросов для zap_success_ratio
+	slo *sloTracker
+	// Последние значения трафика серверов для приращения zap_upstream_bytes_total
+	traffic map[string]int
+	// Последние значения ошибок DNS для приращения zap_dns_resolve_failures_total
+	dnsFailures map[string]int64
+	cancelFunc  context.CancelFunc // Для остановки всех фоновых процессов
+	mu          sync.Mutex
 }
 
-// NewExporter создает новый экспортер
-func NewExporter() *Exporter {
+// NewExporter создает новый экспортер статистики prx
+func NewExporter(prx *proxy.Proxy) *Exporter {
 	registry := prometheus.NewRegistry()
 
 	// Регистрируем стандартные метрики Go
@@ -134,9 +202,16 @@ func NewExporter() *Exporter {
 	registry.MustRegister(gcCount)
 	registry.MustRegister(incomingRequests)
 	registry.MustRegister(requestDuration)
+	registry.MustRegister(idProcessing)
+	registry.MustRegister(upstreamRequestSize)
 	registry.MustRegister(requestStatus)
 	registry.MustRegister(cacheSize)
+	registry.MustRegister(cacheServerSize)
+	registry.MustRegister(cacheHitRatio)
+	registry.MustRegister(cacheLastUpdate)
 	registry.MustRegister(httpConnections)
+	registry.MustRegister(clientConnections)
+	registry.MustRegister(clientConnectionEvents)
 	registry.MustRegister(requestsTotal)
 	registry.MustRegister(responseSize)
 	registry.MustRegister(circuitBreakerState)
@@ -144,9 +219,28 @@ func NewExporter() *Exporter {
 	registry.MustRegister(circuitBreakerSuccesses)
 	registry.MustRegister(circuitBreakerLastFailure)
 	registry.MustRegister(circuitBreakerTransitions)
+	registry.MustRegister(upstreamThrottled)
+	registry.MustRegister(cacheReconciled)
+	registry.MustRegister(queueWait)
+	registry.MustRegister(dnsAddrs)
+	registry.MustRegister(dnsFailures)
+	registry.MustRegister(upstreamCertExpiry)
+	registry.MustRegister(upstreamBytes)
+	registry.MustRegister(memBudget)
+	registry.MustRegister(memBudgetWaiting)
+	registry.MustRegister(negativeIDs)
+	registry.MustRegister(haActive)
+	registry.MustRegister(authFailures)
+	registry.MustRegister(watchdogDumps)
+	registry.MustRegister(successRatio)
+	registry.MustRegister(windowRequests)
 
 	return &Exporter{
-		registry: registry,
+		prx:         prx,
+		registry:    registry,
+		slo:         newSLOTracker(),
+		traffic:     make(map[string]int),
+		dnsFailures: make(map[string]int64),
 	}
 }
 
@@ -202,38 +296,110 @@ func (e *Exporter) updateMetrics() {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	// Метрики runtime
-	goroutinesCount.Set(float64(runtime.NumGoroutine()))
-
-	runtime.ReadMemStats(&m)
-	memoryAlloc.Set(float64(m.Alloc))
-	memoryTotalAlloc.Set(float64(m.TotalAlloc))
-	memorySys.Set(float64(m.Sys))
-	gcCount.Add(float64(m.NumGC))
-
 	// Метрики HTTP клиентов
-	stats := proxy.GetConnectionStats()
+	stats := e.prx.GetConnectionStats()
 	for connType, count := range stats {
+		if server, ok := strings.CutPrefix(connType, proxy.UpstreamBytesSentKey); ok {
+			e.addTraffic(connType, server, "sent", count)
+			continue
+		}
+		if server, ok := strings.CutPrefix(connType, proxy.UpstreamBytesReceivedKey); ok {
+			e.addTraffic(connType, server, "received", count)
+			continue
+		}
 		httpConnections.WithLabelValues(connType).Set(float64(count))
 	}
 
+	// Метрики DNS
+	for host, st := range e.prx.GetDNSStats() {
+		dnsAddrs.WithLabelValues(host).Set(float64(st.Addrs))
+		e.addDNSFailures(host, st.Failures)
+	}
+
+	// Сроки сертификатов серверов
+	for server, st := range e.prx.GetCertStats() {
+		upstreamCertExpiry.WithLabelValues(server).Set(time.Until(st.NotAfter).Seconds())
+	}
+
+	// Метрики бюджета памяти
+	if st, ok := e.prx.GetMemBudgetStats(); ok {
+		memBudget.WithLabelValues("limit").Set(float64(st.Limit))
+		memBudget.WithLabelValues("used").Set(float64(st.Used))
+		memBudgetWaiting.Set(float64(st.Waiting))
+	}
+
+	// Кеш промахов ProxyID
+	negativeIDs.Set(float64(e.prx.GetNegativeIDCount()))
+
+	// Роль узла HA пары
+	if st := proxy.GetHAStatus(); st.Enabled {
+		if st.Active {
+			haActive.Set(1)
+		} else {
+			haActive.Set(0)
+		}
+	}
+
 	// Метрики кеша
-	if cacheStats, ok := proxy.GetCacheStats(); ok {
-		for cacheType, count := range cacheStats {
+	if cacheStats, ok := e.prx.GetCacheStats(); ok {
+		for cacheType, count := range cacheStats.Items {
 			// Разделяем тип кеша на две части: тип и подтип
 			parts := strings.SplitN(cacheType, "_", 2)
 			if len(parts) == 2 {
 				cacheSize.WithLabelValues(parts[0], parts[1]).Set(float64(count))
 			}
 		}
+
+		// Разбивка кеша по серверам
+		for cacheType, servers := range cacheStats.Servers {
+			for serverID, st := range servers {
+				server := strconv.Itoa(serverID)
+				cacheServerSize.WithLabelValues(cacheType, server).Set(float64(st.Entries))
+				cacheHitRatio.WithLabelValues(cacheType, server).Set(st.HitRate)
+				if !st.LastUpdate.IsZero() {
+					cacheLastUpdate.WithLabelValues(cacheType, server).Set(time.Since(st.LastUpdate).Seconds())
+				}
+			}
+		}
 	}
 	// Метрики Circuit Breaker
 	e.updateCircuitBreakerMetrics()
 
+	// Паузы серверов, ограничивших частоту запросов. Истекшие паузы удаляются из метрики
+	upstreamThrottled.Reset()
+	for server, pause := range e.prx.GetThrottleStats() {
+		upstreamThrottled.WithLabelValues(server).Set(pause.Seconds())
+	}
+
+	// Доля успешных запросов за скользящие окна
+	e.slo.update()
+
+}
+
+// addTraffic увеличивает счетчик трафика сервера на приращение с прошлого обновления.
+// Клиент Zabbix, пересозданный при перезагрузке конфигурации, считает трафик заново
+func (e *Exporter) addTraffic(key, server, direction string, value int) {
+	delta := value - e.traffic[key]
+	if delta < 0 {
+		delta = value
+	}
+	e.traffic[key] = value
+	upstreamBytes.WithLabelValues(server, direction).Add(float64(delta))
+}
+
+// addDNSFailures увеличивает счетчик ошибок разрешения имени хоста на приращение
+// с прошлого обновления. Пересозданный клиент Zabbix считает ошибки заново
+func (e *Exporter) addDNSFailures(host string, value int64) {
+	delta := value - e.dnsFailures[host]
+	if delta < 0 {
+		delta = value
+	}
+	e.dnsFailures[host] = value
+	dnsFailures.WithLabelValues(host).Add(float64(delta))
 }
 
 func (e *Exporter) updateCircuitBreakerMetrics() {
-	stats := proxy.GetCBStats()
+	stats := e.prx.GetCBStats()
 	if stats == nil {
 		return
 	}
@@ -311,18 +477,35 @@ func (e *Exporter) updateCircuitBreakerMetrics() {
 }
 
 // IncRequestsTotal увеличивает счетчик запросов
-func (e *Exporter) IncRequestsTotal(method, status string) {
-	requestsTotal.WithLabelValues(method, status).Inc()
+func (e *Exporter) IncRequestsTotal(method, status, client string) {
+	requestsTotal.WithLabelValues(method, status, client).Inc()
+	// Запрос клиента неудачен, если не ответил ни один сервер
+	if method == "all" {
+		e.slo.add(proxyServer, status == "error")
+	}
 }
 
 // ObserveRequestDuration записывает длительность запроса
-func (e *Exporter) ObserveRequestDuration(server, method string, duration time.Duration) {
-	requestDuration.WithLabelValues(simpleURLName(server), method).Observe(duration.Seconds())
+func (e *Exporter) ObserveRequestDuration(server, method, status string, duration time.Duration) {
+	requestDuration.WithLabelValues(simpleURLName(server), method, status).Observe(duration.Seconds())
+}
+
+// ObserveIDProcessing записывает время преобразования ID запроса
+func (e *Exporter) ObserveIDProcessing(method string, duration time.Duration) {
+	idProcessing.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// ObserveUpstreamRequestSize записывает размер запроса к серверу
+func (e *Exporter) ObserveUpstreamRequestSize(method string, size int64) {
+	upstreamRequestSize.WithLabelValues(method).Observe(float64(size))
 }
 
 // IncRequestErrors увеличивает счетчик ошибок
 func (e *Exporter) IncRequestStatus(server, rtype string) {
 	requestStatus.WithLabelValues(simpleURLName(server), rtype).Inc()
+	if counted, failed := upstreamOutcome(rtype); counted {
+		e.slo.add(simpleURLName(server), failed)
+	}
 }
 
 // ObserveResponseSize записывает размер ответа
@@ -335,6 +518,21 @@ func (e *Exporter) IncIncomingRequests(s string) {
 	incomingRequests.WithLabelValues(s).Inc()
 }
 
+// AddReconciled учитывает результат сверки кеша с сервером
+func (e *Exporter) AddReconciled(server, action string, count int) {
+	cacheReconciled.WithLabelValues(simpleURLName(server), action).Add(float64(count))
+}
+
+// ObserveQueueWait записывает время ожидания слота семафора запросов
+func (e *Exporter) ObserveQueueWait(server string, wait time.Duration) {
+	queueWait.WithLabelValues(simpleURLName(server)).Observe(wait.Seconds())
+}
+
+// IncAuthFailure учитывает отказ в авторизации клиента
+func (e *Exporter) IncAuthFailure(reason string) {
+	authFailures.WithLabelValues(reason).Inc()
+}
+
 func simpleURLName(server string) string {
 	s := strings.Split(server, "/")
 	switch len(s) {
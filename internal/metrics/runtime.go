@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	rtmetrics "runtime/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Метрики runtime читаются из runtime/metrics при каждом сборе: значения
+// не накапливаются в exporter, а накопительные метрики не пересчитываются
+const (
+	rtGoroutines = "/sched/goroutines:goroutines"
+	rtHeapAlloc  = "/memory/classes/heap/objects:bytes"
+	rtTotalAlloc = "/gc/heap/allocs:bytes"
+	rtSys        = "/memory/classes/total:bytes"
+	rtGCCycles   = "/gc/cycles/total:gc-cycles"
+)
+
+var (
+	goroutinesCount = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "zap_goroutines",
+		Help: "Current number of goroutines",
+	}, func() float64 { return readRuntimeMetric(rtGoroutines) })
+
+	memoryAlloc = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "zap_mem_alloc_bytes",
+		Help: "Bytes allocated and still in use",
+	}, func() float64 { return readRuntimeMetric(rtHeapAlloc) })
+
+	memoryTotalAlloc = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "zap_memory_total_alloc_bytes",
+		Help: "Total bytes allocated",
+	}, func() float64 { return readRuntimeMetric(rtTotalAlloc) })
+
+	memorySys = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "zap_memory_sys_bytes",
+		Help: "Total bytes obtained from system",
+	}, func() float64 { return readRuntimeMetric(rtSys) })
+
+	gcCount = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "zap_gc_cycles_total",
+		Help: "Total garbage collection cycles",
+	}, func() float64 { return readRuntimeMetric(rtGCCycles) })
+)
+
+// readRuntimeMetric возвращает значение метрики runtime/metrics name (0, если метрика не поддерживается)
+func readRuntimeMetric(name string) float64 {
+	sample := []rtmetrics.Sample{{Name: name}}
+	rtmetrics.Read(sample)
+	switch sample[0].Value.Kind() {
+	case rtmetrics.KindUint64:
+		return float64(sample[0].Value.Uint64())
+	case rtmetrics.KindFloat64:
+		return sample[0].Value.Float64()
+	default:
+		return 0
+	}
+}
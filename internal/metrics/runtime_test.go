@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"runtime"
+	rtmetrics "runtime/metrics"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gather возвращает значения метрик реестра по имени
+func gather(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, mf := range families {
+		m := mf.GetMetric()[0]
+		switch {
+		case m.GetCounter() != nil:
+			values[mf.GetName()] = m.GetCounter().GetValue()
+		case m.GetGauge() != nil:
+			values[mf.GetName()] = m.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+// readGCCycles возвращает количество циклов GC из runtime/metrics
+func readGCCycles() float64 {
+	sample := []rtmetrics.Sample{{Name: "/gc/cycles/total:gc-cycles"}}
+	rtmetrics.Read(sample)
+	return float64(sample[0].Value.Uint64())
+}
+
+// TestRuntimeMetrics_GCCycles проверяет, что zap_gc_cycles_total совпадает с runtime/metrics
+// и не растет от повторных сборов метрик
+func TestRuntimeMetrics_GCCycles(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(gcCount)
+
+	before := readGCCycles()
+	runtime.GC()
+	runtime.GC()
+	first := gather(t, reg)["zap_gc_cycles_total"]
+	after := readGCCycles()
+	if first < before+2 || first > after {
+		t.Errorf("zap_gc_cycles_total = %v, expected between %v and %v", first, before+2, after)
+	}
+
+	// Повторные сборы без GC не увеличивают счетчик
+	for i := 0; i < 5; i++ {
+		gather(t, reg)
+	}
+	second := gather(t, reg)["zap_gc_cycles_total"]
+	if current := readGCCycles(); second > current {
+		t.Errorf("zap_gc_cycles_total = %v after repeated collection, runtime reports %v", second, current)
+	}
+}
+
+// TestRuntimeMetrics_Memory проверяет метрики горутин и памяти
+func TestRuntimeMetrics_Memory(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(goroutinesCount, memoryAlloc, memoryTotalAlloc, memorySys)
+
+	values := gather(t, reg)
+	if values["zap_goroutines"] < 1 {
+		t.Errorf("zap_goroutines = %v, expected at least 1", values["zap_goroutines"])
+	}
+	if values["zap_mem_alloc_bytes"] <= 0 || values["zap_mem_alloc_bytes"] > values["zap_memory_sys_bytes"] {
+		t.Errorf("zap_mem_alloc_bytes = %v, expected positive and not above zap_memory_sys_bytes %v",
+			values["zap_mem_alloc_bytes"], values["zap_memory_sys_bytes"])
+	}
+	if values["zap_memory_total_alloc_bytes"] < values["zap_mem_alloc_bytes"] {
+		t.Errorf("zap_memory_total_alloc_bytes = %v, expected not below zap_mem_alloc_bytes %v",
+			values["zap_memory_total_alloc_bytes"], values["zap_mem_alloc_bytes"])
+	}
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// proxyServer метка server для запросов клиентов к proxy
+const proxyServer = "APIproxy"
+
+// Окна, за которые считается доля успешных запросов
+var sloWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+}
+
+const (
+	// Длительность корзины скользящего окна
+	sloBucket = 5 * time.Second
+	// Количество корзин покрывает наибольшее окно
+	sloBuckets = int(time.Hour / sloBucket)
+)
+
+var (
+	successRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zap_success_ratio",
+		Help: "Share of successful requests over a rolling window by server (server=\"APIproxy\" for client requests), 1 without requests",
+	}, []string{"server", "window"})
+
+	windowRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zap_window_requests",
+		Help: "Number of requests over a rolling window by server, the base of zap_success_ratio",
+	}, []string{"server", "window"})
+)
+
+// outcomeBucket количество запросов и неудач за sloBucket
+type outcomeBucket struct {
+	slot   int64
+	total  int64
+	failed int64
+}
+
+// outcomeWindow скользящее окно результатов запросов из корзин по sloBucket
+type outcomeWindow struct {
+	buckets [sloBuckets]outcomeBucket
+}
+
+// add учитывает результат запроса в момент now
+func (w *outcomeWindow) add(now time.Time, failed bool) {
+	slot := now.UnixNano() / int64(sloBucket)
+	b := &w.buckets[slot%int64(sloBuckets)]
+	if b.slot != slot {
+		*b = outcomeBucket{slot: slot}
+	}
+	b.total++
+	if failed {
+		b.failed++
+	}
+}
+
+// sum возвращает количество запросов и неудач за последние window
+func (w *outcomeWindow) sum(now time.Time, window time.Duration) (total, failed int64) {
+	slot := now.UnixNano() / int64(sloBucket)
+	oldest := slot - int64(window/sloBucket)
+	for _, b := range w.buckets {
+		if b.slot > oldest && b.slot <= slot {
+			total += b.total
+			failed += b.failed
+		}
+	}
+	return total, failed
+}
+
+// sloTracker результаты запросов по серверам для расчета доли успешных запросов
+type sloTracker struct {
+	mu      sync.Mutex
+	servers map[string]*outcomeWindow
+}
+
+func newSLOTracker() *sloTracker {
+	return &sloTracker{servers: make(map[string]*outcomeWindow)}
+}
+
+// add учитывает результат запроса к серверу server
+func (t *sloTracker) add(server string, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w, ok := t.servers[server]
+	if !ok {
+		w = &outcomeWindow{}
+		t.servers[server] = w
+	}
+	w.add(time.Now(), failed)
+}
+
+// update обновляет метрики доли успешных запросов
+func (t *sloTracker) update() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for server, w := range t.servers {
+		for _, window := range sloWindows {
+			total, failed := w.sum(now, window.duration)
+			ratio := 1.0
+			if total > 0 {
+				ratio = float64(total-failed) / float64(total)
+			}
+			successRatio.WithLabelValues(server, window.name).Set(ratio)
+			windowRequests.WithLabelValues(server, window.name).Set(float64(total))
+		}
+	}
+}
+
+// upstreamOutcome определяет по типу zap_request, учитывается ли ответ сервера
+// в доле успешных запросов и является ли он неудачей. Ошибки клиента (неверные
+// параметры, нет прав) - ответ исправного сервера
+func upstreamOutcome(rtype string) (counted, failed bool) {
+	switch {
+	case rtype == "success", rtype == "client_error":
+		return true, false
+	case rtype == "error", strings.HasPrefix(rtype, "invalid_"):
+		return true, true
+	default:
+		return false, false
+	}
+}
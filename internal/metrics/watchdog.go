@@ -0,0 +1,16 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var watchdogDumps = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "zap_watchdog_dumps_total",
+	Help: "Diagnostic profile dumps written by the watchdog by reason (goroutines, heap)",
+}, []string{"reason"})
+
+// IncWatchdogDump учитывает снимок профилей, записанный при превышении порога reason
+func IncWatchdogDump(reason string) {
+	watchdogDumps.WithLabelValues(reason).Inc()
+}
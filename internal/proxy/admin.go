@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdminMiddleware проверяет авторизацию для служебных эндпоинтов /admin/*
+// и разрешает только POST запросы
+func (prx *Proxy) AdminMiddleware(next http.HandlerFunc, login, password, token string) http.HandlerFunc {
+	return prx.adminMiddleware(next, login, password, token, http.MethodPost)
+}
+
+// AdminReadMiddleware проверяет авторизацию для служебных эндпоинтов только для чтения
+// (например /admin/top) и разрешает GET и POST запросы
+func (prx *Proxy) AdminReadMiddleware(next http.HandlerFunc, login, password, token string) http.HandlerFunc {
+	return prx.adminMiddleware(next, login, password, token, http.MethodGet, http.MethodPost)
+}
+
+func (prx *Proxy) adminMiddleware(next http.HandlerFunc, login, password, token string, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trace_id := uuid.New().String()
+		logger.Global.Debugf("[%s] Incoming admin request: %s %s", trace_id, r.Method, r.URL.String())
+
+		if !slices.Contains(methods, r.Method) {
+			logger.Global.Warningf("[%s] Unsupported %s admin request", trace_id, r.Method)
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Изменяющие запросы браузера с другого сайта отклоняются: браузер сам
+		// подставляет сохраненную Basic авторизацию (CSRF)
+		if r.Method != http.MethodGet && !sameOriginRequest(r) {
+			logger.Global.Warningf("[%s] Cross-site admin request rejected (Origin '%s')", trace_id, r.Header.Get("Origin"))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		// Без учетных данных API считается открытым, но служебные эндпоинты
+		// в этом случае недоступны никому
+		if !prx.adminAuthConfigured(login, password, token) {
+			logger.Global.Warningf("[%s] Admin request rejected: no admin credentials configured", trace_id)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		principal, ok := prx.authenticate(w, r, login, password, token, trace_id)
+		if !ok {
+			return
+		}
+		// Клиентам внешних источников доступны только с ролью admin (группы ldap.admin_groups)
+		if principal != nil && !principal.admin {
+			logger.Global.Warningf("[%s] Admin request is not permitted for client %s", trace_id, principal.name)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// adminAuthConfigured проверяет, что для служебных эндпоинтов задан хотя бы один
+// способ авторизации: токен, логин и пароль, jwt или ldap
+func (prx *Proxy) adminAuthConfigured(login, password, token string) bool {
+	return token != "" || (login != "" && password != "") || prx.jwt != nil || prx.ldap != nil
+}
+
+// sameOriginRequest проверяет, что запрос отправлен не со страницы другого сайта:
+// Sec-Fetch-Site (same-origin или none - адрес введен вручную) или, если браузер его
+// не передает, Origin с адресом proxy. Запросы без этих заголовков (curl, скрипты)
+// браузер со стороннего сайта отправить не может
+func sameOriginRequest(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// writeAdminResponse отправляет ответ служебного эндпоинта в JSON
+func writeAdminResponse(w http.ResponseWriter, status int, body map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// FlushCache сбрасывает маппинги кеша для типа и/или сервера.
+// Пустой cacheType - все типы, serverID == 0 - все серверы
+func (prx *Proxy) FlushCache(cacheType string, serverID int) (int, error) {
+	if prx.cache == nil {
+		return 0, fmt.Errorf("proxy cache is not initialized")
+	}
+	if serverID != 0 && !slices.Contains(prx.getAllServers(), serverID) {
+		return 0, fmt.Errorf("unknown server id %d", serverID)
+	}
+	return prx.cache.Flush(cacheType, serverID)
+}
+
+// AdminCacheFlushHandler обрабатывает POST /admin/cache/flush?type=host&server=2
+func (prx *Proxy) AdminCacheFlushHandler(w http.ResponseWriter, r *http.Request) {
+	cacheType := r.URL.Query().Get("type")
+
+	serverID := 0
+	if s := r.URL.Query().Get("server"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil || id < 1 {
+			writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": "invalid server id: " + s})
+			return
+		}
+		serverID = id
+	}
+
+	removed, err := prx.FlushCache(cacheType, serverID)
+	if err != nil {
+		logger.Global.Warningf("Cache flush failed (type='%s', server=%d): %v", cacheType, serverID, err)
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": err.Error()})
+		return
+	}
+
+	logger.Global.Infof("Cache flushed (type='%s', server=%d): %d mappings removed", cacheType, serverID, removed)
+	writeAdminResponse(w, http.StatusOK, map[string]any{
+		"status":  "OK",
+		"type":    cacheType,
+		"server":  serverID,
+		"removed": removed,
+	})
+}
+
+// AdminCacheSaveHandler обрабатывает POST /admin/cache/save: немедленное сохранение
+// кеша в БД (например перед плановым обслуживанием узла)
+func (prx *Proxy) AdminCacheSaveHandler(w http.ResponseWriter, r *http.Request) {
+	if prx.cache == nil {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": "proxy cache is not initialized"})
+		return
+	}
+
+	start := time.Now()
+	if err := prx.cache.Save(); err != nil {
+		logger.Global.Errorf("Cache save failed: %v", err)
+		writeAdminResponse(w, http.StatusInternalServerError, map[string]any{"status": "error", "error": logger.Redact(err.Error())})
+		return
+	}
+
+	logger.Global.Infof("Cache saved on admin request in %v", time.Since(start))
+	writeAdminResponse(w, http.StatusOK, map[string]any{
+		"status":      "OK",
+		"duration_ms": durationMs(time.Since(start)),
+	})
+}
+
+// AdminCacheCleanupHandler обрабатывает POST /admin/cache/cleanup: немедленное удаление
+// устаревших по TTL маппингов
+func (prx *Proxy) AdminCacheCleanupHandler(w http.ResponseWriter, r *http.Request) {
+	if prx.cache == nil {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": "proxy cache is not initialized"})
+		return
+	}
+
+	removed, err := prx.cache.Cleanup()
+	if err != nil {
+		logger.Global.Warningf("Cache cleanup failed: %v", err)
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": err.Error()})
+		return
+	}
+
+	logger.Global.Infof("Cache cleanup on admin request: %d mappings removed", removed)
+	writeAdminResponse(w, http.StatusOK, map[string]any{
+		"status":  "OK",
+		"removed": removed,
+	})
+}
+
+// AdminRecorderHandler обрабатывает POST /admin/recorder?trace_id=... и возвращает
+// захваченные бортовым самописцем запросы от новых к старым
+func (prx *Proxy) AdminRecorderHandler(w http.ResponseWriter, r *http.Request) {
+	recorder := prx.recorder
+	if recorder == nil {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": "flight recorder is disabled"})
+		return
+	}
+
+	records := recorder.list(r.URL.Query().Get("trace_id"))
+	writeAdminResponse(w, http.StatusOK, map[string]any{
+		"status":  "OK",
+		"count":   len(records),
+		"records": records,
+	})
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAdminMiddleware тестирует авторизацию и метод для служебных эндпоинтов
+func TestAdminMiddleware(t *testing.T) {
+	prx := &Proxy{}
+	next := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	middleware := prx.AdminMiddleware(next, "", "", "admin-token")
+
+	tests := []struct {
+		name           string
+		method         string
+		authHeader     string
+		expectedStatus int
+	}{
+		{name: "valid token", method: "POST", authHeader: "Bearer admin-token", expectedStatus: http.StatusOK},
+		{name: "invalid token", method: "POST", authHeader: "Bearer wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "GET not allowed", method: "GET", authHeader: "Bearer admin-token", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/cache/flush", nil)
+			req.Header.Set("Authorization", tt.authHeader)
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+// TestAdminMiddlewareNoCredentials тестирует, что без настроенной авторизации
+// служебные эндпоинты закрыты, хотя API доступен без нее
+func TestAdminMiddlewareNoCredentials(t *testing.T) {
+	prx := &Proxy{}
+	next := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	for _, middleware := range []http.HandlerFunc{
+		prx.AdminMiddleware(next, "", "", ""),
+		prx.AdminMiddleware(next, "admin", "", ""),
+		prx.AdminReadMiddleware(next, "", "", ""),
+	} {
+		req := httptest.NewRequest("POST", "/admin/cache/flush", nil)
+		recorder := httptest.NewRecorder()
+		middleware.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+	}
+}
+
+// TestAdminMiddlewareCrossSite тестирует отклонение изменяющих запросов со страниц
+// других сайтов при Basic авторизации браузера
+func TestAdminMiddlewareCrossSite(t *testing.T) {
+	prx := &Proxy{}
+	next := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	middleware := prx.AdminReadMiddleware(next, "admin", "secret", "")
+
+	tests := []struct {
+		name           string
+		method         string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{name: "script without browser headers", method: "POST", expectedStatus: http.StatusOK},
+		{name: "admin UI", method: "POST", headers: map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://proxy.local"}, expectedStatus: http.StatusOK},
+		{name: "other site", method: "POST", headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://evil.example"}, expectedStatus: http.StatusForbidden},
+		{name: "same site subdomain", method: "POST", headers: map[string]string{"Sec-Fetch-Site": "same-site"}, expectedStatus: http.StatusForbidden},
+		{name: "origin of proxy", method: "POST", headers: map[string]string{"Origin": "http://proxy.local"}, expectedStatus: http.StatusOK},
+		{name: "foreign origin", method: "POST", headers: map[string]string{"Origin": "http://evil.example"}, expectedStatus: http.StatusForbidden},
+		{name: "opaque origin", method: "POST", headers: map[string]string{"Origin": "null"}, expectedStatus: http.StatusForbidden},
+		{name: "cross-site read", method: "GET", headers: map[string]string{"Sec-Fetch-Site": "cross-site"}, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://proxy.local/admin/cache/flush", nil)
+			req.SetBasicAuth("admin", "secret")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+// TestAdminCacheFlushHandler тестирует выборочный сброс кеша
+func TestAdminCacheFlushHandler(t *testing.T) {
+	g := Global{MaxRequests: 10}
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{ID: 1}, {ID: 2}}}
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	prx.cache.CacheType["host"].Set(100, 500, 1, "HostA")
+	prx.cache.CacheType["host"].Set(100, 501, 2, "HostA")
+	prx.cache.CacheType["group"].Set(200, 600, 2, "GroupA")
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedRemove float64
+	}{
+		{name: "invalid server", query: "?server=abc", expectedStatus: http.StatusBadRequest},
+		{name: "unknown server", query: "?server=5", expectedStatus: http.StatusBadRequest},
+		{name: "unknown type", query: "?type=item", expectedStatus: http.StatusBadRequest},
+		{name: "host type for server 2", query: "?type=host&server=2", expectedStatus: http.StatusOK, expectedRemove: 1},
+		{name: "all types", query: "", expectedStatus: http.StatusOK, expectedRemove: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/admin/cache/flush"+tt.query, nil)
+			recorder := httptest.NewRecorder()
+			prx.AdminCacheFlushHandler(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			var response map[string]any
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedRemove, response["removed"])
+			}
+		})
+	}
+
+	_, found := prx.cache.CacheType["host"].GetOriginalID(100, 1)
+	assert.False(t, found, "full flush should remove all mappings")
+}
+
+// TestAdminCacheSaveAndCleanupHandlers тестирует сохранение и очистку кеша по запросу
+func TestAdminCacheSaveAndCleanupHandlers(t *testing.T) {
+	disabled := &Proxy{}
+	for _, handler := range []http.HandlerFunc{disabled.AdminCacheSaveHandler, disabled.AdminCacheCleanupHandler} {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest("POST", "/admin/cache/save", nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	}
+
+	g := Global{MaxRequests: 10}
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{ID: 1}}}
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.cache.CacheType["host"].Set(100, 500, 1, "HostA")
+
+	recorder := httptest.NewRecorder()
+	prx.AdminCacheSaveHandler(recorder, httptest.NewRequest("POST", "/admin/cache/save", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.False(t, prx.cache.SaveStatus().LastSave.IsZero())
+
+	recorder = httptest.NewRecorder()
+	prx.AdminCacheCleanupHandler(recorder, httptest.NewRequest("POST", "/admin/cache/cleanup", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, float64(0), response["removed"], "fresh mappings are kept")
+}
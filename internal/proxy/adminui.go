@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	_ "embed"
+	"net"
+	"net/http"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+)
+
+// Страница веб-интерфейса администратора (/admin/ui). Данные загружаются
+// из служебных эндпоинтов /admin/* с авторизацией браузера
+//
+//go:embed adminui.html
+var adminUIPage []byte
+
+// AdminUIHandler обрабатывает GET /admin/ui: веб-интерфейс администратора, если включен admin_ui
+func (prx *Proxy) AdminUIHandler(w http.ResponseWriter, r *http.Request) {
+	if !prx.global.AdminUI {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(adminUIPage)
+}
+
+// AdminStatusHandler обрабатывает GET /admin/status: состояние proxy для веб-интерфейса -
+// /health, Circuit Breaker серверов, статистика кеша, уровни логирования и авторизация
+func (prx *Proxy) AdminStatusHandler(w http.ResponseWriter, r *http.Request) {
+	health := prx.Health()
+	health.Version = Version
+
+	servers := make([]map[string]any, 0, len(prx.config.Servers))
+	stats := map[string]any{}
+	if prx.cb != nil {
+		stats = prx.GetCBStats()
+	}
+	for _, srv := range prx.config.Servers {
+		servers = append(servers, map[string]any{"id": srv.ID, "name": srv.Name, "circuit_breaker": stats[srv.Name]})
+	}
+
+	cacheStats := map[string]any{"enabled": false}
+	if st, ok := prx.GetCacheStats(); ok {
+		cacheStats = map[string]any{"enabled": true, "items": st.Items, "servers": st.Servers}
+	}
+
+	console, file := logger.Levels()
+	writeAdminResponse(w, http.StatusOK, map[string]any{
+		"status":  "OK",
+		"health":  health,
+		"servers": servers,
+		"cache":   cacheStats,
+		"logging": map[string]any{"console_level": console, "file_level": file},
+		"auth": map[string]any{
+			"token":          prx.global.Token != "",
+			"basic":          prx.global.Login != "" && prx.global.AuthPassword() != "",
+			"jwt":            prx.jwt != nil,
+			"ldap":           prx.ldap != nil,
+			"managed_tokens": prx.tokens != nil,
+			"locked_clients": prx.authLock.lockedClients(),
+		},
+	})
+}
+
+// AdminLogLevelHandler обрабатывает POST /admin/log/level?console=debug&file=info:
+// уровни логирования до перезагрузки конфигурации
+func (prx *Proxy) AdminLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	console, file := r.URL.Query().Get("console"), r.URL.Query().Get("file")
+	if console == "" && file == "" {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": "console or file level is required"})
+		return
+	}
+	if err := logger.SetLevels(console, file); err != nil {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": err.Error()})
+		return
+	}
+
+	console, file = logger.Levels()
+	logger.Global.Warningf("Log levels changed on admin request: console=%s, file=%s", console, file)
+	writeAdminResponse(w, http.StatusOK, map[string]any{"status": "OK", "console_level": console, "file_level": file})
+}
+
+// AdminAuthUnlockHandler обрабатывает POST /admin/auth/unlock?ip=10.0.0.5: снятие
+// блокировки адреса клиента после неудачных попыток авторизации
+func (prx *Proxy) AdminAuthUnlockHandler(w http.ResponseWriter, r *http.Request) {
+	ip := r.URL.Query().Get("ip")
+	if net.ParseIP(ip) == nil {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": "invalid ip: " + ip})
+		return
+	}
+
+	lockedUntil, locked := prx.authLock.lockedClients()[ip]
+	prx.authLock.reset(ip)
+	logger.Global.Infof("Auth lockout of %s reset on admin request", ip)
+	response := map[string]any{"status": "OK", "ip": ip, "was_locked": locked}
+	if locked {
+		response["remaining_sec"] = int(time.Until(lockedUntil).Seconds())
+	}
+	writeAdminResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAdminUIHandler тестирует выдачу веб-интерфейса только при admin_ui
+func TestAdminUIHandler(t *testing.T) {
+	prx := &Proxy{}
+	w := httptest.NewRecorder()
+	prx.AdminUIHandler(w, httptest.NewRequest("GET", "/admin/ui", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	prx.global.AdminUI = true
+	w = httptest.NewRecorder()
+	prx.AdminUIHandler(w, httptest.NewRequest("GET", "/admin/ui", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/admin/status")
+}
+
+// TestAdminStatusHandler тестирует состояние proxy для веб-интерфейса
+func TestAdminStatusHandler(t *testing.T) {
+	g := Global{MaxRequests: 5, Token: "secret-token", AuthLockout: AuthLockoutConf{MaxFailures: 1}}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.authLock.fail("10.0.0.5")
+
+	w := httptest.NewRecorder()
+	prx.AdminStatusHandler(w, httptest.NewRequest("GET", "/admin/status", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret-token")
+	assert.NotContains(t, w.Body.String(), "http://server1.com")
+
+	var status map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Len(t, status["servers"], 3)
+	assert.Equal(t, true, status["cache"].(map[string]any)["enabled"])
+	auth := status["auth"].(map[string]any)
+	assert.Equal(t, true, auth["token"])
+	assert.Contains(t, auth["locked_clients"], "10.0.0.5")
+
+	// Снятие блокировки адреса
+	w = httptest.NewRecorder()
+	prx.AdminAuthUnlockHandler(w, httptest.NewRequest("POST", "/admin/auth/unlock?ip=10.0.0.5", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"was_locked":true`)
+	assert.True(t, prx.authLock.locked("10.0.0.5").IsZero())
+
+	w = httptest.NewRecorder()
+	prx.AdminAuthUnlockHandler(w, httptest.NewRequest("POST", "/admin/auth/unlock?ip=bad", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestAdminLogLevelHandler тестирует проверку уровней логирования
+func TestAdminLogLevelHandler(t *testing.T) {
+	prx := &Proxy{}
+	for _, query := range []string{"", "?console=verbose"} {
+		w := httptest.NewRecorder()
+		prx.AdminLogLevelHandler(w, httptest.NewRequest("POST", "/admin/log/level"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+// TestLockedClients тестирует список заблокированных адресов
+func TestLockedClients(t *testing.T) {
+	now := time.Now()
+	l := newAuthLockout(AuthLockoutConf{MaxFailures: 2})
+	l.now = func() time.Time { return now }
+	l.fail("10.0.0.1")
+	l.fail("10.0.0.2")
+	l.fail("10.0.0.2")
+	assert.Equal(t, map[string]time.Time{"10.0.0.2": now.Add(defaultAuthLockout)}, l.lockedClients())
+
+	var disabled *authLockout
+	assert.Empty(t, disabled.lockedClients())
+}
@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Режимы application.get для серверов без приложений (global.application_mode)
+const (
+	// Пустой результат (по умолчанию)
+	applicationModeEmpty = "empty"
+	// Приложения синтезируются из тегов Application элементов данных, в которые
+	// Zabbix 5.4 преобразует приложения при обновлении
+	applicationModeTags = "tags"
+)
+
+const (
+	applicationTag = "Application"
+	// Оператор "равно" и логика "или" фильтра тегов item.get
+	tagOperatorEqual = 1
+	tagEvalTypeOr    = 2
+	// Максимум запомненных синтетических приложений, при превышении список очищается
+	maxSyntheticApps = 100000
+)
+
+// appRef синтетическое приложение: тег Application элементов данных узла сети сервера
+type appRef struct {
+	url    string
+	hostID string
+	name   string
+}
+
+// registerApp возвращает ID синтетического приложения и запоминает его, чтобы
+// item.get с applicationids можно было преобразовать в фильтр по тегу
+func (c *compatState) registerApp(url, hostID, name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(url + "\x00" + hostID + "\x00" + name))
+	id := strconv.FormatUint(uint64(h.Sum32()), 10)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.apps[id]; !ok && len(c.apps) >= maxSyntheticApps {
+		clear(c.apps)
+	}
+	c.apps[id] = appRef{url: url, hostID: hostID, name: name}
+	return id
+}
+
+// lookupApps возвращает синтетические приложения сервера url по ID
+func (c *compatState) lookupApps(url string, ids []string) []appRef {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var refs []appRef
+	for _, id := range ids {
+		if ref, ok := c.apps[id]; ok && ref.url == url {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// stringList приводит строку, число или список параметра запроса к списку строк
+func stringList(v any) []string {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		list := make([]string, 0, len(t))
+		for _, item := range t {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	default:
+		return []string{fmt.Sprint(t)}
+	}
+}
+
+// usesApplications сообщает, что item.get использует приложения
+func usesApplications(request map[string]any) bool {
+	params, _ := request["params"].(map[string]any)
+	_, byApps := params["applicationids"]
+	_, selectApps := params["selectApplications"]
+	return byApps || selectApps
+}
+
+// applicationsUnsupported сообщает, что сервер не поддерживает приложения
+// (Zabbix 5.4+ отклоняет параметры applicationids и selectApplications)
+func applicationsUnsupported(err error) bool {
+	if methodMissing(err) {
+		return true
+	}
+	apiErr, ok := zabbix.AsAPIError(err)
+	if !ok {
+		return false
+	}
+	text := apiErr.Message + " " + apiErr.Data
+	return strings.Contains(text, `"applicationids"`) || strings.Contains(text, `"selectApplications"`)
+}
+
+// sendItemsWithApplications выполняет item.get с приложениями. Серверу без приложений
+// запрос отправляется с фильтром по тегу Application, а приложения элементов данных
+// синтезируются из их тегов
+func (prx *Proxy) sendItemsWithApplications(ctx context.Context, srv zabbix.ZabbixServer, request map[string]any) (map[string]any, error) {
+	if !prx.compat.lacks(srv.URL, "application.get") {
+		response, err := prx.zbxClient.SendToZabbix(ctx, srv.URL, srv.IgnoreSSL, request)
+		if err == nil || !applicationsUnsupported(err) {
+			return response, err
+		}
+		prx.compat.markMissing(srv.URL, "application.get")
+		logger.WithContext(ctx).Infof("Applications are not supported by %s, using %s tags", srv.URL, applicationTag)
+	}
+
+	if mc := prx.methodMetrics("item.get"); mc != nil {
+		mc.IncRequestStatus(srv.URL, "compat_substituted")
+	}
+	return prx.itemsByApplicationTags(ctx, srv, request)
+}
+
+// itemsByApplicationTags заменяет applicationids фильтром по тегу Application,
+// а selectApplications - приложениями из тегов элементов данных
+func (prx *Proxy) itemsByApplicationTags(ctx context.Context, srv zabbix.ZabbixServer, request map[string]any) (map[string]any, error) {
+	params := maps.Clone(request["params"].(map[string]any))
+
+	if ids, ok := params["applicationids"]; ok {
+		delete(params, "applicationids")
+		refs := prx.compat.lookupApps(srv.URL, stringList(ids))
+		if len(refs) == 0 {
+			// Приложения не относятся к серверу
+			return map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": request["id"]}, nil
+		}
+		var tags []any
+		var names, hostIDs []string
+		for _, ref := range refs {
+			if !slices.Contains(names, ref.name) {
+				names = append(names, ref.name)
+				tags = append(tags, map[string]any{"tag": applicationTag, "value": ref.name, "operator": tagOperatorEqual})
+			}
+			if !slices.Contains(hostIDs, ref.hostID) {
+				hostIDs = append(hostIDs, ref.hostID)
+			}
+		}
+		params["tags"] = tags
+		params["evaltype"] = tagEvalTypeOr
+		if _, ok := params["hostids"]; !ok {
+			params["hostids"] = hostIDs
+		}
+	}
+
+	_, selectApps := params["selectApplications"]
+	if selectApps {
+		delete(params, "selectApplications")
+		if _, ok := params["selectTags"]; !ok {
+			params["selectTags"] = "extend"
+		}
+		// hostid нужен для ID синтетических приложений
+		if output, ok := params["output"].([]any); ok && !slices.Contains(output, any("hostid")) {
+			params["output"] = append(slices.Clone(output), "hostid")
+		}
+	}
+
+	translated := maps.Clone(request)
+	translated["params"] = params
+	response, err := prx.zbxClient.SendToZabbix(ctx, srv.URL, srv.IgnoreSSL, translated)
+	if err != nil || !selectApps {
+		return response, err
+	}
+
+	items, _ := response["result"].([]any)
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		hostID := fmt.Sprint(m["hostid"])
+		apps := []any{}
+		for _, name := range applicationTagValues(m["tags"]) {
+			apps = append(apps, map[string]any{"applicationid": prx.compat.registerApp(srv.URL, hostID, name), "name": name})
+		}
+		m["applications"] = apps
+	}
+	return response, nil
+}
+
+// applicationTagValues возвращает значения тегов Application без повторов
+func applicationTagValues(tags any) []string {
+	list, _ := tags.([]any)
+	var values []string
+	for _, t := range list {
+		tag, ok := t.(map[string]any)
+		if !ok || tag["tag"] != applicationTag {
+			continue
+		}
+		if value, _ := tag["value"].(string); value != "" && !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// compatApplications заменяет application.get сервера без приложений: пустой результат
+// или, в режиме application_mode: tags, приложения из тегов Application элементов данных
+func compatApplications(prx *Proxy, ctx context.Context, srv zabbix.ZabbixServer, request map[string]any) (map[string]any, error) {
+	if prx.global.ApplicationMode != applicationModeTags {
+		return compatEmptyResult(prx, ctx, srv, request)
+	}
+
+	params, _ := request["params"].(map[string]any)
+	itemParams := map[string]any{"output": []any{"itemid", "hostid"}, "selectTags": "extend"}
+	if hostIDs, ok := params["hostids"]; ok {
+		itemParams["hostids"] = hostIDs
+	}
+	itemRequest := maps.Clone(request)
+	itemRequest["method"] = "item.get"
+	itemRequest["params"] = itemParams
+	response, err := prx.zbxClient.SendToZabbix(ctx, srv.URL, srv.IgnoreSSL, itemRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Фильтры приложений: applicationids, точное имя (filter) и подстрока имени (search)
+	var appIDs, names []string
+	if ids, ok := params["applicationids"]; ok {
+		appIDs = stringList(ids)
+	}
+	if filter, ok := params["filter"].(map[string]any); ok {
+		names = stringList(filter["name"])
+	}
+	var search string
+	if s, ok := params["search"].(map[string]any); ok {
+		search, _ = s["name"].(string)
+	}
+
+	seen := make(map[string]bool)
+	apps := []any{}
+	items, _ := response["result"].([]any)
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		hostID := fmt.Sprint(m["hostid"])
+		for _, name := range applicationTagValues(m["tags"]) {
+			if names != nil && !slices.Contains(names, name) {
+				continue
+			}
+			if search != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(search)) {
+				continue
+			}
+			id := prx.compat.registerApp(srv.URL, hostID, name)
+			if seen[id] || (appIDs != nil && !slices.Contains(appIDs, id)) {
+				continue
+			}
+			seen[id] = true
+			apps = append(apps, map[string]any{"applicationid": id, "hostid": hostID, "name": name, "flags": "0", "templateids": []any{}})
+		}
+	}
+	slices.SortFunc(apps, func(a, b any) int {
+		return strings.Compare(a.(map[string]any)["name"].(string), b.(map[string]any)["name"].(string))
+	})
+	return map[string]any{"jsonrpc": "2.0", "result": apps, "id": request["id"]}, nil
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCompat_ApplicationsFromTags тестирует приложения из тегов Application (application_mode: tags)
+func TestCompat_ApplicationsFromTags(t *testing.T) {
+	items := []any{
+		map[string]any{"itemid": "1", "hostid": "10", "tags": []any{
+			map[string]any{"tag": "Application", "value": "CPU"},
+			map[string]any{"tag": "component", "value": "cpu"},
+		}},
+		map[string]any{"itemid": "2", "hostid": "10", "tags": []any{map[string]any{"tag": "Application", "value": "Memory"}}},
+		map[string]any{"itemid": "3", "hostid": "10", "tags": []any{map[string]any{"tag": "Application", "value": "CPU"}}},
+	}
+	var itemRequests []map[string]any
+	testProxy, mock := compatTestProxy(t, true, func(request map[string]any) (map[string]any, error) {
+		params := request["params"].(map[string]any)
+		switch {
+		case request["method"] == "application.get":
+			return nil, incorrectAPI
+		case params["applicationids"] != nil || params["selectApplications"] != nil:
+			return nil, &zabbix.APIError{Code: -32602, Message: "Invalid params.", Data: `Invalid parameter "/": unexpected parameter "selectApplications".`}
+		}
+		itemRequests = append(itemRequests, params)
+		return map[string]any{"jsonrpc": "2.0", "result": items, "id": request["id"]}, nil
+	})
+	defer testProxy.Cleanup()
+	testProxy.prx.global.ApplicationMode = applicationModeTags
+	srv := zabbix.ZabbixServer{URL: "http://server1.com"}
+
+	response, err := testProxy.prx.sendUpstream(context.Background(), srv, map[string]any{
+		"jsonrpc": "2.0", "method": "application.get", "id": 1,
+		"params": map[string]any{"hostids": []any{"10"}, "search": map[string]any{"name": "cp"}},
+	})
+	require.NoError(t, err)
+	apps := response["result"].([]any)
+	require.Len(t, apps, 1, "items of the same application are merged, search filters by name")
+	cpu := apps[0].(map[string]any)
+	assert.Equal(t, "CPU", cpu["name"])
+	assert.Equal(t, "10", cpu["hostid"])
+	assert.Equal(t, []any{"10"}, itemRequests[0]["hostids"])
+
+	// item.get по ID синтетического приложения - фильтр по тегу Application
+	itemRequests = nil
+	_, err = testProxy.prx.sendUpstream(context.Background(), srv, map[string]any{
+		"jsonrpc": "2.0", "method": "item.get", "id": 2,
+		"params": map[string]any{"applicationids": []any{cpu["applicationid"]}, "output": []any{"itemid"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, itemRequests, 1)
+	assert.Equal(t, []any{map[string]any{"tag": "Application", "value": "CPU", "operator": tagOperatorEqual}}, itemRequests[0]["tags"])
+	assert.Equal(t, []string{"10"}, itemRequests[0]["hostids"])
+	assert.NotContains(t, itemRequests[0], "applicationids")
+
+	// Сервер запомнен: selectApplications заменяется без ошибки сервера
+	calls := mock.CallCount
+	response, err = testProxy.prx.sendUpstream(context.Background(), srv, map[string]any{
+		"jsonrpc": "2.0", "method": "item.get", "id": 3,
+		"params": map[string]any{"selectApplications": "extend", "output": []any{"itemid"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, calls+1, mock.CallCount)
+	assert.Equal(t, []any{"itemid", "hostid"}, itemRequests[1]["output"])
+	assert.Equal(t, "extend", itemRequests[1]["selectTags"])
+	first := response["result"].([]any)[0].(map[string]any)
+	assert.Equal(t, []any{map[string]any{"applicationid": cpu["applicationid"], "name": "CPU"}}, first["applications"])
+
+	// Неизвестные приложения - пустой результат без запроса
+	calls = mock.CallCount
+	response, err = testProxy.prx.sendUpstream(context.Background(), srv, map[string]any{
+		"jsonrpc": "2.0", "method": "item.get", "id": 4,
+		"params": map[string]any{"applicationids": []any{"1"}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, response["result"])
+	assert.Equal(t, calls, mock.CallCount)
+}
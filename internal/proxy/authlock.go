@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	defaultAuthMaxFailures = 10
+	defaultAuthWindow      = time.Minute
+	defaultAuthLockout     = 5 * time.Minute
+
+	// Предел числа отслеживаемых адресов, после которого удаляются истекшие записи
+	authLockSweepSize = 10000
+)
+
+// Причины отказа в авторизации для метрики zap_auth_failures_total
+const (
+	authFailToken       = "invalid_token"
+	authFailCredentials = "invalid_credentials"
+	authFailJWT         = "invalid_jwt"
+	authFailLocked      = "locked"
+)
+
+// AuthLockoutConf временная блокировка адресов клиентов после неудачных попыток авторизации
+type AuthLockoutConf struct {
+	MaxFailures int    `yaml:"max_failures"` // Неудачных попыток до блокировки, по умолчанию 10, -1 - без блокировки
+	Window      string `yaml:"window"`       // Окно подсчета неудачных попыток, по умолчанию 1m
+	Duration    string `yaml:"duration"`     // Время блокировки, по умолчанию 5m
+}
+
+// authAttempts неудачные попытки авторизации с одного адреса
+type authAttempts struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// authLockout счетчики неудачных попыток авторизации по адресам клиентов
+type authLockout struct {
+	mu          sync.Mutex
+	maxFailures int
+	window      time.Duration
+	duration    time.Duration
+	clients     map[string]*authAttempts
+	now         func() time.Time
+}
+
+// newAuthLockout создает счетчики неудачных попыток или nil, если блокировка отключена
+func newAuthLockout(cfg AuthLockoutConf) *authLockout {
+	if cfg.MaxFailures < 0 {
+		return nil
+	}
+	maxFailures := cfg.MaxFailures
+	if maxFailures == 0 {
+		maxFailures = defaultAuthMaxFailures
+	}
+
+	return &authLockout{
+		maxFailures: maxFailures,
+		window:      authLockDuration("window", cfg.Window, defaultAuthWindow),
+		duration:    authLockDuration("duration", cfg.Duration, defaultAuthLockout),
+		clients:     make(map[string]*authAttempts),
+		now:         time.Now,
+	}
+}
+
+// authLockDuration разбирает интервал auth_lockout, при ошибке возвращает значение по умолчанию
+func authLockDuration(name, value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	s, err := suffix.ToSeconds(value)
+	if err != nil || s == 0 {
+		logger.Global.Errorf("invalid 'auth_lockout.%s' %s, using %v", name, value, def)
+		return def
+	}
+	return time.Duration(s) * time.Second
+}
+
+// remoteIP возвращает адрес клиента без порта
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// locked возвращает время окончания блокировки адреса или нулевое время
+func (l *authLockout) locked(ip string) time.Time {
+	if l == nil {
+		return time.Time{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a, ok := l.clients[ip]
+	if !ok || !l.now().Before(a.lockedUntil) {
+		return time.Time{}
+	}
+	return a.lockedUntil
+}
+
+// fail учитывает неудачную попытку и возвращает true, если адрес заблокирован
+func (l *authLockout) fail(ip string) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	a, ok := l.clients[ip]
+	if !ok {
+		if len(l.clients) >= authLockSweepSize {
+			l.sweep(now)
+		}
+		a = &authAttempts{}
+		l.clients[ip] = a
+	}
+	if now.Sub(a.windowStart) > l.window {
+		a.failures, a.windowStart = 0, now
+	}
+	a.failures++
+	if a.failures < l.maxFailures {
+		return false
+	}
+	a.failures, a.lockedUntil = 0, now.Add(l.duration)
+	return true
+}
+
+// reset сбрасывает счетчик адреса после успешной авторизации
+func (l *authLockout) reset(ip string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.clients, ip)
+}
+
+// sweep удаляет адреса без действующей блокировки и с истекшим окном подсчета
+func (l *authLockout) sweep(now time.Time) {
+	for ip, a := range l.clients {
+		if !now.Before(a.lockedUntil) && now.Sub(a.windowStart) > l.window {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// lockedClients возвращает заблокированные адреса и время окончания блокировки
+func (l *authLockout) lockedClients() map[string]time.Time {
+	locked := map[string]time.Time{}
+	if l == nil {
+		return locked
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for ip, a := range l.clients {
+		if now.Before(a.lockedUntil) {
+			locked[ip] = a.lockedUntil
+		}
+	}
+	return locked
+}
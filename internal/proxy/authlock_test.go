@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAuthLockout тестирует подсчет неудачных попыток и блокировку адреса
+func TestAuthLockout(t *testing.T) {
+	assert.Nil(t, newAuthLockout(AuthLockoutConf{MaxFailures: -1}))
+
+	l := newAuthLockout(AuthLockoutConf{})
+	assert.Equal(t, defaultAuthMaxFailures, l.maxFailures)
+	assert.Equal(t, defaultAuthWindow, l.window)
+	assert.Equal(t, defaultAuthLockout, l.duration)
+
+	l = newAuthLockout(AuthLockoutConf{MaxFailures: 3, Window: "1m", Duration: "10m"})
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	// Попытки вне окна не накапливаются
+	assert.False(t, l.fail("10.0.0.1"))
+	assert.False(t, l.fail("10.0.0.1"))
+	now = now.Add(2 * time.Minute)
+	assert.False(t, l.fail("10.0.0.1"))
+	assert.False(t, l.fail("10.0.0.1"))
+	assert.True(t, l.locked("10.0.0.1").IsZero())
+
+	assert.True(t, l.fail("10.0.0.1"))
+	assert.Equal(t, now.Add(10*time.Minute), l.locked("10.0.0.1"))
+	// Другие адреса не блокируются
+	assert.True(t, l.locked("10.0.0.2").IsZero())
+
+	now = now.Add(10 * time.Minute)
+	assert.True(t, l.locked("10.0.0.1").IsZero())
+
+	// Успешная авторизация сбрасывает счетчик
+	assert.False(t, l.fail("10.0.0.2"))
+	assert.False(t, l.fail("10.0.0.2"))
+	l.reset("10.0.0.2")
+	assert.False(t, l.fail("10.0.0.2"))
+
+	// Истекшие записи удаляются при очистке
+	now = now.Add(time.Hour)
+	l.sweep(now)
+	assert.Empty(t, l.clients)
+
+	// Без блокировки методы безопасны
+	var disabled *authLockout
+	assert.False(t, disabled.fail("10.0.0.1"))
+	assert.True(t, disabled.locked("10.0.0.1").IsZero())
+	disabled.reset("10.0.0.1")
+}
+
+// TestAuthMiddleware_Lockout тестирует блокировку клиента после подбора токена
+func TestAuthMiddleware_Lockout(t *testing.T) {
+	g := Global{MaxRequests: 5, AuthLockout: AuthLockoutConf{MaxFailures: 2, Duration: "1m"}}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.global.maxReqBodySizeInt64 = 100
+
+	metrics := NewMockMetricsCollector()
+	prx.SetMetrics(metrics)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	middleware := prx.AuthMiddleware(next, "/metrics", "", "", "secret-token")
+
+	send := func(addr, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api", strings.NewReader(`{"jsonrpc":"2.0","method":"host.get","id":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = addr
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		middleware.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, send("10.0.0.1:1000", "guess1").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("10.0.0.1:1001", "guess2").Code)
+
+	// Адрес заблокирован, даже с правильным токеном
+	w := send("10.0.0.1:1002", "secret-token")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// Другие клиенты не затронуты
+	assert.Equal(t, http.StatusOK, send("10.0.0.2:1000", "secret-token").Code)
+
+	assert.Equal(t, map[string]int{authFailToken: 2, authFailLocked: 1}, metrics.authFailures)
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+)
+
+// backgroundTasks фоновые задачи proxy, выполняющиеся вне запроса клиента: зеркалирование,
+// повторный поиск сущностей, сбор ответов после мягкого таймаута, сверка кеша и прогрев
+// соединений. Задачи читают поля proxy без блокировки конфигурации, поэтому перед
+// перезагрузкой конфигурации и остановкой proxy они прерываются и дожидаются завершения
+type backgroundTasks struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func newBackgroundTasks() *backgroundTasks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundTasks{ctx: ctx, cancel: cancel}
+}
+
+// start запускает задачу. Контекст задачи отменяется при остановке. false, если
+// задачи уже остановлены и задача не запущена. Без трекера (proxy создан не через
+// NewProxy) задача запускается без учета
+func (b *backgroundTasks) start(task func(ctx context.Context)) bool {
+	if b == nil {
+		go task(context.Background())
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped {
+		return false
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		task(b.ctx)
+	}()
+	return true
+}
+
+// stop прерывает задачи и ждет их завершения. Новые задачи после остановки не запускаются
+func (b *backgroundTasks) stop() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.stopped = true
+	b.mu.Unlock()
+	b.cancel()
+	b.wg.Wait()
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	balanceWeighted     = "weighted"
+	balanceLeastLatency = "least_latency"
+
+	// Коэффициент сглаживания EWMA задержки реплики
+	latencyEWMAAlpha = 0.3
+)
+
+// replicaState состояние одной реплики логического сервера
+type replicaState struct {
+	url     string
+	name    string // Имя Circuit Breaker и метрик (host:port)
+	weight  int
+	current int           // Текущий вес для плавного weighted round-robin
+	latency time.Duration // EWMA задержки успешных ответов, 0 - еще не измерена
+}
+
+// replicaBalancer выбирает реплику логического сервера для запроса
+type replicaBalancer struct {
+	mu       sync.Mutex
+	mode     string
+	replicas []*replicaState
+}
+
+// newReplicaBalancer создает балансировщик для сервера с репликами.
+// Основной url сервера - первая реплика. Возвращает nil, если реплик нет
+func newReplicaBalancer(srv zabbix.ZabbixServer) *replicaBalancer {
+	if len(srv.Replicas) == 0 {
+		return nil
+	}
+
+	mode := srv.Balance
+	switch mode {
+	case "":
+		mode = balanceWeighted
+	case balanceWeighted, balanceLeastLatency:
+	default:
+		logger.Global.Warningf("Server[%d]: unknown balance mode '%s', using '%s'", srv.ID, srv.Balance, balanceWeighted)
+		mode = balanceWeighted
+	}
+
+	weight := func(w int) int {
+		if w <= 0 {
+			return 1
+		}
+		return w
+	}
+
+	b := &replicaBalancer{mode: mode}
+	b.replicas = append(b.replicas, &replicaState{url: srv.URL, name: srv.Name, weight: weight(srv.Weight)})
+	for _, r := range srv.Replicas {
+		b.replicas = append(b.replicas, &replicaState{url: r.URL, name: urlHostName(r.URL), weight: weight(r.Weight)})
+	}
+	return b
+}
+
+// pick выбирает реплику среди доступных (Circuit Breaker пропускает запрос, нет паузы HTTP 429).
+// Возвращает nil, если все реплики недоступны
+func (b *replicaBalancer) pick(allow func(name string) bool) *replicaState {
+	available := make([]*replicaState, 0, len(b.replicas))
+	for _, r := range b.replicas {
+		if allow(r.name) {
+			available = append(available, r)
+		}
+	}
+	if len(available) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.mode == balanceLeastLatency {
+		// Реплики без измерений получают запрос первыми
+		best := available[0]
+		for _, r := range available[1:] {
+			if r.latency < best.latency {
+				best = r
+			}
+		}
+		return best
+	}
+
+	// Плавный weighted round-robin (как в nginx)
+	total := 0
+	var best *replicaState
+	for _, r := range available {
+		r.current += r.weight
+		total += r.weight
+		if best == nil || r.current > best.current {
+			best = r
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// observe учитывает задержку успешного ответа реплики
+func (b *replicaBalancer) observe(r *replicaState, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r.latency == 0 {
+		r.latency = d
+		return
+	}
+	r.latency = time.Duration(latencyEWMAAlpha*float64(d) + (1-latencyEWMAAlpha)*float64(r.latency))
+}
+
+// replicaNames возвращает имена Circuit Breaker реплик сервера (кроме основного url)
+func replicaNames(srv zabbix.ZabbixServer) []string {
+	names := make([]string, 0, len(srv.Replicas))
+	for _, r := range srv.Replicas {
+		names = append(names, urlHostName(r.URL))
+	}
+	return names
+}
+
+// routeReplica выбирает реплику логического сервера и возвращает копию описания
+// сервера с URL и именем реплики, чтобы метрики и Circuit Breaker велись по репликам.
+// Для сервера без реплик возвращает описание без изменений
+func (prx *Proxy) routeReplica(srv zabbix.ZabbixServer, trace_id string) (zabbix.ZabbixServer, *replicaState, error) {
+	b := prx.balancers[srv.ID]
+	if b == nil {
+		return srv, nil, nil
+	}
+
+	r := b.pick(prx.replicaAvailable)
+	if r == nil {
+		return srv, nil, fmt.Errorf("server %d: circuit breaker open or throttled for all replicas", srv.ID)
+	}
+
+	logger.Global.Debugf("[%s] Server[%d]: routing request to replica %s (%s)", trace_id, srv.ID, r.url, b.mode)
+	srv.URL = r.url
+	srv.Name = r.name
+	return srv, r, nil
+}
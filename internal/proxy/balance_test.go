@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/a3ak/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testReplicatedServer(balance string) zabbix.ZabbixServer {
+	return zabbix.ZabbixServer{
+		ID:      1,
+		URL:     "http://web1/api_jsonrpc.php",
+		Name:    "web1",
+		Weight:  3,
+		Balance: balance,
+		Replicas: []zabbix.ZabbixReplica{
+			{URL: "http://web2/api_jsonrpc.php"},
+		},
+	}
+}
+
+// TestReplicaBalancer_Weighted тестирует распределение запросов по весам
+func TestReplicaBalancer_Weighted(t *testing.T) {
+	b := newReplicaBalancer(testReplicatedServer(""))
+	require.NotNil(t, b)
+	assert.Equal(t, balanceWeighted, b.mode)
+
+	allowAll := func(string) bool { return true }
+	counts := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		counts[b.pick(allowAll).name]++
+	}
+	assert.Equal(t, 30, counts["web1"])
+	assert.Equal(t, 10, counts["web2"])
+
+	// Недоступная реплика исключается
+	onlyWeb2 := func(name string) bool { return name == "web2" }
+	assert.Equal(t, "web2", b.pick(onlyWeb2).name)
+
+	assert.Nil(t, b.pick(func(string) bool { return false }))
+}
+
+// TestReplicaBalancer_LeastLatency тестирует выбор реплики с наименьшей задержкой
+func TestReplicaBalancer_LeastLatency(t *testing.T) {
+	b := newReplicaBalancer(testReplicatedServer(balanceLeastLatency))
+	require.NotNil(t, b)
+
+	allowAll := func(string) bool { return true }
+	web1, web2 := b.replicas[0], b.replicas[1]
+
+	// Без измерений выбирается первая реплика, затем неизмеренная
+	b.observe(b.pick(allowAll), 100*time.Millisecond)
+	assert.Equal(t, web2, b.pick(allowAll))
+
+	b.observe(web2, 20*time.Millisecond)
+	assert.Equal(t, web2, b.pick(allowAll))
+
+	// EWMA сглаживает разовые выбросы
+	b.observe(web2, 200*time.Millisecond)
+	assert.Equal(t, 74*time.Millisecond, web2.latency)
+	assert.Equal(t, web2, b.pick(allowAll))
+	assert.Equal(t, 100*time.Millisecond, web1.latency)
+}
+
+// TestNewReplicaBalancer_NoReplicas тестирует сервер без реплик
+func TestNewReplicaBalancer_NoReplicas(t *testing.T) {
+	assert.Nil(t, newReplicaBalancer(zabbix.ZabbixServer{ID: 1, URL: "http://web1/api_jsonrpc.php"}))
+}
+
+// TestRouteReplica тестирует выбор реплики с учетом Circuit Breaker
+func TestRouteReplica(t *testing.T) {
+	srv := testReplicatedServer(balanceWeighted)
+	srv.Weight = 1
+	prx := &Proxy{balancers: map[int]*replicaBalancer{1: newReplicaBalancer(srv)}, cb: circuitbreaker.NewCBManager()}
+	prx.cb.InitCircuitBreakers(append([]string{"web1"}, replicaNames(srv)...), circuitbreaker.CircuitBreakerConf{
+		FailureThreshold: 1,
+		RecoveryTimeout:  time.Hour,
+	})
+
+	prx.cb.ReportFailure("web1")
+	for i := 0; i < 3; i++ {
+		routed, replica, err := prx.routeReplica(srv, "test-replica")
+		require.NoError(t, err)
+		require.NotNil(t, replica)
+		assert.Equal(t, "http://web2/api_jsonrpc.php", routed.URL)
+		assert.Equal(t, "web2", routed.Name)
+		assert.Equal(t, 1, routed.ID, "server ID must be preserved for ID translation")
+	}
+	assert.True(t, prx.serverAllowed(srv), "server with replicas is checked per replica")
+
+	prx.cb.ReportFailure("web2")
+	_, _, err := prx.routeReplica(srv, "test-replica")
+	assert.Error(t, err)
+
+	// Сервер без реплик не меняется
+	plain := zabbix.ZabbixServer{ID: 2, URL: "http://plain/api_jsonrpc.php", Name: "plain"}
+	routed, replica, err := prx.routeReplica(plain, "test-replica")
+	assert.NoError(t, err)
+	assert.Nil(t, replica)
+	assert.Equal(t, plain, routed)
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"math/rand/v2"
+	"strconv"
+)
+
+// Безопасное извлечение имени сервера (host:port или unix:путь к сокету) из URL
+func urlHostName(url string) string {
+	return zabbix.HostName(url)
+}
+
+// canaryName имя канарейки сервера в Circuit Breaker и метриках. Имя не зависит от
+// адреса canary_url, поэтому Circuit Breaker канарейки не разделяется с основным
+// сервером или канарейкой другого сервера на том же хосте
+func canaryName(serverID int) string {
+	return "canary:" + strconv.Itoa(serverID)
+}
+
+// routeCanary с вероятностью canary_percent перенаправляет запрос сервера на canary_url.
+// Возвращает копию описания сервера с подмененными URL и именем, чтобы метрики и
+// Circuit Breaker канарейки велись отдельно от основного сервера, и true, если запрос
+// перенаправлен. Если Circuit Breaker канарейки разомкнут, запрос остается на основном сервере.
+func (prx *Proxy) routeCanary(srv zabbix.ZabbixServer, request map[string]any, trace_id string) (zabbix.ZabbixServer, bool) {
+	if srv.CanaryURL == "" || srv.CanaryPercent <= 0 {
+		return srv, false
+	}
+	if srv.CanaryPercent < 100 && rand.IntN(100) >= srv.CanaryPercent {
+		return srv, false
+	}
+
+	name := canaryName(srv.ID)
+	if ok, _ := prx.cb.AllowRequest(name); !ok {
+		logger.Global.Warningf("[%s] Circuit breaker status 'open' for canary %s, using primary server %s", trace_id, srv.CanaryURL, srv.URL)
+		return srv, false
+	}
+
+	logger.Global.Debugf("[%s] Server[%d]: routing request to canary %s", trace_id, srv.ID, srv.CanaryURL)
+	srv.URL = srv.CanaryURL
+	srv.Name = name
+	if srv.CanaryToken != "" {
+		srv.Token = srv.CanaryToken
+		request["auth"] = srv.CanaryToken
+	}
+	return srv, true
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/a3ak/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRouteCanary тестирует перенаправление части трафика на canary_url
+func TestRouteCanary(t *testing.T) {
+	prx := &Proxy{cb: circuitbreaker.NewCBManager()}
+	prx.cb.InitCircuitBreakers([]string{"prod", "canary:1"}, circuitbreaker.CircuitBreakerConf{
+		FailureThreshold: 1,
+		RecoveryTimeout:  time.Hour,
+	})
+
+	base := zabbix.ZabbixServer{
+		ID:          1,
+		URL:         "http://prod/api_jsonrpc.php",
+		Name:        "prod",
+		Token:       "prod-token",
+		CanaryURL:   "http://canary:8080/api_jsonrpc.php",
+		CanaryToken: "canary-token",
+	}
+
+	t.Run("zero percent keeps primary", func(t *testing.T) {
+		srv := base
+		request := map[string]any{"auth": "prod-token"}
+		routed, canary := prx.routeCanary(srv, request, "test-canary")
+		assert.False(t, canary)
+		assert.Equal(t, base.URL, routed.URL)
+		assert.Equal(t, "prod-token", request["auth"])
+	})
+
+	t.Run("full percent routes to canary", func(t *testing.T) {
+		srv := base
+		srv.CanaryPercent = 100
+		request := map[string]any{"auth": "prod-token"}
+		routed, canary := prx.routeCanary(srv, request, "test-canary")
+		assert.True(t, canary)
+		assert.Equal(t, base.CanaryURL, routed.URL)
+		assert.Equal(t, "canary:1", routed.Name)
+		assert.Equal(t, "canary-token", request["auth"])
+		assert.Equal(t, 1, routed.ID, "server ID must be preserved for ID translation")
+	})
+
+	t.Run("open canary breaker falls back to primary", func(t *testing.T) {
+		prx.cb.ReportFailure("canary:1")
+		// Circuit Breaker канарейки не разделяется с основным сервером
+		assert.Equal(t, "closed", prx.cb.GetCircuitBreakerState("prod"))
+		srv := base
+		srv.CanaryPercent = 100
+		request := map[string]any{"auth": "prod-token"}
+		routed, _ := prx.routeCanary(srv, request, "test-canary")
+		assert.Equal(t, base.URL, routed.URL)
+		assert.Equal(t, "prod-token", request["auth"])
+	})
+}
+
+// TestURLHostName тестирует извлечение имени сервера из URL
+func TestURLHostName(t *testing.T) {
+	assert.Equal(t, "zabbix:8080", urlHostName("http://zabbix:8080/api_jsonrpc.php"))
+	assert.Equal(t, "zabbix", urlHostName("zabbix"))
+}
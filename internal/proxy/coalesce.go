@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// coalescedCall выполняющийся запрос, результат которого разделяют одинаковые запросы
+type coalescedCall struct {
+	key     string
+	done    chan struct{}
+	results any
+	errors  []string
+	dups    int
+	// Число запросов, ожидающих результат. Когда все клиенты отключились,
+	// общий запрос отменяется
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// requestGroup объединяет одинаковые одновременные запросы (singleflight):
+// к серверам уходит только первый, остальные получают его результат
+type requestGroup struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+	// Сборщик метрик proxy (nil - метрики не собираются)
+	metrics MetricsCollector
+}
+
+func newRequestGroup() *requestGroup {
+	return &requestGroup{calls: make(map[string]*coalescedCall)}
+}
+
+// do выполняет fn для ключа или ожидает результат уже выполняющегося запроса.
+// shared == true, если результат получен несколькими запросами: в этом случае
+// вызывающий получает копию, т.к. ответ дальше изменяется (drop_fields).
+// fn получает контекст, который не отменяется вместе с контекстом начавшего
+// запроса, а только после ухода всех ожидающих результат
+func (g *requestGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (any, []string)) (results any, errors []string, shared bool) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		call.dups++
+		call.waiters++
+		g.mu.Unlock()
+		stop := context.AfterFunc(ctx, func() { g.leave(call) })
+		defer stop()
+
+		if g.metrics != nil {
+			g.metrics.IncRequestStatus("APIproxy", "coalesced")
+		}
+
+		select {
+		case <-call.done:
+			return deepClone(call.results), call.errors, true
+		case <-ctx.Done():
+			return nil, contextErrors(ctx), true
+		}
+	}
+
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	call := &coalescedCall{key: key, done: make(chan struct{}), waiters: 1, cancel: cancel}
+	g.calls[key] = call
+	g.mu.Unlock()
+	stop := context.AfterFunc(ctx, func() { g.leave(call) })
+	defer stop()
+
+	call.results, call.errors = fn(callCtx)
+
+	// После удаления ключа новые запросы не присоединятся, dups окончателен
+	g.mu.Lock()
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+	dups := call.dups
+	g.mu.Unlock()
+	close(call.done)
+
+	if dups > 0 {
+		return deepClone(call.results), call.errors, true
+	}
+	return call.results, call.errors, false
+}
+
+// leave отмечает уход ожидающего запроса. Если ушли все, общий запрос
+// отменяется, а ключ освобождается, что бы новые запросы не получили прерванный результат
+func (g *requestGroup) leave(call *coalescedCall) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	call.waiters--
+	if call.waiters > 0 {
+		return
+	}
+	if g.calls[call.key] == call {
+		delete(g.calls, call.key)
+	}
+	call.cancel()
+}
+
+// coalesceKey формирует ключ запроса из метода и параметров. Набор целевых серверов
+// определяется параметрами, а запросы к серверам выполняются с токенами серверов,
+// поэтому авторизация клиента в ключ не входит
+func coalesceKey(method string, request map[string]any) (string, bool) {
+	params, err := json.Marshal(request["params"])
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(append([]byte(method+"\x00"), params...))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// processCoalesced выполняет запрос к серверам, объединяя одинаковые одновременные
+// читающие запросы. Запросы с отладкой или захватом самописцем выполняются отдельно,
+// т.к. собирают данные о своем выполнении (как и запросы с квотой server_quota - сведения
+// об усечении), а с заголовком X-Proxy-Unknown-IDs - т.к. ответ зависит не только от
+// метода и параметров
+func (prx *Proxy) processCoalesced(ctx context.Context, request map[string]any, method, trace_id string, exclusive bool) (any, []string) {
+	group := prx.coalescer
+	if exclusive || !isReadMethod(method) {
+		return prx.processAllServers(ctx, request, trace_id)
+	}
+
+	key, ok := coalesceKey(method, request)
+	if !ok {
+		return prx.processAllServers(ctx, request, trace_id)
+	}
+	// Запросы клиентов JWT объединяются только при одинаковых разрешенных серверах
+	key += principalFromContext(ctx).scope()
+
+	// С мягким таймаутом запрос выполняется в фоне и разделяется одинаковыми запросами
+	if prx.soft != nil {
+		return prx.processSoftTimeout(ctx, request, method, trace_id, key)
+	}
+	// Неполный результат при таймауте не разделяется: отчет о нем получает только один клиент
+	if group == nil || partialFromContext(ctx).returnOnTimeout() {
+		return prx.processAllServers(ctx, request, trace_id)
+	}
+
+	results, errors, shared := group.do(ctx, key, func(callCtx context.Context) (any, []string) {
+		// Общий запрос не прерывается отменой запроса, который его начал,
+		// пока результат ожидают другие клиенты
+		sharedCtx, cancel := context.WithTimeout(callCtx, time.Duration(prx.global.maxTimeoutInt64)*time.Second)
+		defer cancel()
+		return prx.processAllServers(sharedCtx, request, trace_id)
+	})
+	if shared {
+		logger.Global.Debugf("[%s] Request %s shared result with identical concurrent requests", trace_id, method)
+	}
+	return results, errors
+}
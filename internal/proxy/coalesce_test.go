@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRequestGroup_Do тестирует объединение одинаковых одновременных запросов
+func TestRequestGroup_Do(t *testing.T) {
+	g := newRequestGroup()
+	release := make(chan struct{})
+	var calls atomic.Int32
+
+	fn := func(context.Context) (any, []string) {
+		calls.Add(1)
+		<-release
+		return []any{map[string]any{"hostid": "1", "name": "host"}}, nil
+	}
+
+	const followers = 5
+	results := make([]any, followers+1)
+	shared := make([]bool, followers+1)
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _, shared[0] = g.do(context.Background(), "key", fn)
+	}()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	for i := 1; i <= followers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, shared[i] = g.do(context.Background(), "key", fn)
+		}(i)
+	}
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.calls["key"].dups == followers
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load(), "upstream must be queried once")
+	for i := range results {
+		assert.True(t, shared[i])
+		assert.Equal(t, "host", results[i].([]any)[0].(map[string]any)["name"])
+	}
+
+	// Каждый получил свою копию результата
+	delete(results[0].([]any)[0].(map[string]any), "name")
+	assert.Equal(t, "host", results[1].([]any)[0].(map[string]any)["name"])
+
+	// После завершения ключ освобождается, одиночный запрос не считается общим
+	_, _, single := g.do(context.Background(), "key", func(context.Context) (any, []string) { return nil, nil })
+	assert.False(t, single)
+	assert.Empty(t, g.calls)
+}
+
+// TestRequestGroup_FollowerTimeout тестирует отмену ожидания общего запроса
+func TestRequestGroup_FollowerTimeout(t *testing.T) {
+	g := newRequestGroup()
+	release := make(chan struct{})
+	defer close(release)
+
+	go g.do(context.Background(), "key", func(context.Context) (any, []string) {
+		<-release
+		return nil, nil
+	})
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.calls["key"] != nil
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	results, errors, _ := g.do(ctx, "key", func(context.Context) (any, []string) { return "unexpected", nil })
+	assert.Nil(t, results)
+	assert.Equal(t, []string{"request timeout"}, errors)
+}
+
+// TestRequestGroup_AllWaitersLeft тестирует отмену общего запроса после
+// отключения всех ожидающих его клиентов
+func TestRequestGroup_AllWaitersLeft(t *testing.T) {
+	g := newRequestGroup()
+	var callCtx atomic.Value
+	fn := func(ctx context.Context) (any, []string) {
+		callCtx.Store(ctx)
+		<-ctx.Done()
+		return nil, []string{errClientGone}
+	}
+
+	leaderCtx, leaderCancel := context.WithCancel(context.Background())
+	leaderDone := make(chan []string)
+	go func() {
+		_, errors, _ := g.do(leaderCtx, "key", fn)
+		leaderDone <- errors
+	}()
+	require.Eventually(t, func() bool { return callCtx.Load() != nil }, time.Second, time.Millisecond)
+
+	followerCtx, followerCancel := context.WithCancel(context.Background())
+	followerDone := make(chan []string)
+	go func() {
+		_, errors, _ := g.do(followerCtx, "key", fn)
+		followerDone <- errors
+	}()
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.calls["key"].waiters == 2
+	}, time.Second, time.Millisecond)
+
+	// Начавший запрос клиент ушел, но результат еще ожидается
+	leaderCancel()
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, callCtx.Load().(context.Context).Err())
+
+	// Ушел последний ожидающий - общий запрос отменяется, ключ освобождается
+	followerCancel()
+	assert.Equal(t, []string{errClientGone}, <-followerDone)
+	assert.Equal(t, []string{errClientGone}, <-leaderDone)
+	assert.ErrorIs(t, callCtx.Load().(context.Context).Err(), context.Canceled)
+	assert.Empty(t, g.calls)
+}
+
+// TestCoalesceKey тестирует ключ объединения запросов
+func TestCoalesceKey(t *testing.T) {
+	a, ok := coalesceKey("host.get", map[string]any{"id": 1, "params": map[string]any{"output": "extend", "hostids": []any{"1"}}})
+	require.True(t, ok)
+	b, _ := coalesceKey("host.get", map[string]any{"id": 2, "params": map[string]any{"hostids": []any{"1"}, "output": "extend"}})
+	assert.Equal(t, a, b, "request id and key order must not affect the key")
+
+	c, _ := coalesceKey("item.get", map[string]any{"params": map[string]any{"output": "extend", "hostids": []any{"1"}}})
+	assert.NotEqual(t, a, c)
+
+	d, _ := coalesceKey("host.get", map[string]any{"params": map[string]any{"output": "extend", "hostids": []any{"2"}}})
+	assert.NotEqual(t, a, d)
+}
@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Методы, которых нет в части версий Zabbix, и их замены для источника данных
+// Grafana-Zabbix (grafana_compat): application.get удален в Zabbix 5.4 (приложения
+// заменены тегами, см. application_mode), trend.get отсутствует в старых версиях
+var compatMethods = map[string]func(prx *Proxy, ctx context.Context, srv zabbix.ZabbixServer, request map[string]any) (map[string]any, error){
+	"application.get": compatApplications,
+	"trend.get":       compatTrendsFromHistory,
+}
+
+// codeMethodNotFound код ошибки JSON-RPC неизвестного метода
+const codeMethodNotFound = -32601
+
+// Типы истории числовых элементов данных, для которых Zabbix хранит тренды
+var trendHistoryTypes = []int{0, 3}
+
+// compatState серверы, в версиях которых нет методов compatMethods. Запрос к такому
+// серверу сразу заменяется, без повторной ошибки сервера. Сбрасывается при перезагрузке
+// конфигурации (например после обновления серверов)
+type compatState struct {
+	mu      sync.Mutex
+	missing map[string]bool   // URL сервера и метод
+	apps    map[string]appRef // Синтетические приложения по ID (application_mode: tags)
+}
+
+// newCompatState создает состояние совместимости или nil, если grafana_compat отключен
+func newCompatState(g Global) *compatState {
+	if !g.GrafanaCompat {
+		return nil
+	}
+	switch g.ApplicationMode {
+	case "", applicationModeEmpty, applicationModeTags:
+	default:
+		logger.Global.Errorf("invalid 'application_mode' %s, using %s", g.ApplicationMode, applicationModeEmpty)
+	}
+	return &compatState{missing: make(map[string]bool), apps: make(map[string]appRef)}
+}
+
+// lacks сообщает, что метода нет в версии сервера
+func (c *compatState) lacks(url, method string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.missing[url+" "+method]
+}
+
+// markMissing запоминает, что метода нет в версии сервера
+func (c *compatState) markMissing(url, method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.missing[url+" "+method] = true
+}
+
+// methodMissing сообщает, что сервер не знает метод: -32601 или "Incorrect API"/"Incorrect method"
+// в данных ошибки (так Zabbix отвечает на удаленные API, например application.get в 5.4+)
+func methodMissing(err error) bool {
+	apiErr, ok := zabbix.AsAPIError(err)
+	if !ok {
+		return false
+	}
+	text := apiErr.Message + " " + apiErr.Data
+	return apiErr.Code == codeMethodNotFound || strings.Contains(text, "Incorrect API") || strings.Contains(text, "Incorrect method")
+}
+
+// sendUpstream выполняет запрос к серверу. В режиме grafana_compat метод, отсутствующий
+// в версии сервера, заменяется (см. compatMethods), а сервер запоминается, чтобы
+// следующие запросы заменялись без обращения к отсутствующему методу
+func (prx *Proxy) sendUpstream(ctx context.Context, srv zabbix.ZabbixServer, request map[string]any) (map[string]any, error) {
+	method, _ := request["method"].(string)
+	if prx.compat != nil && method == "item.get" && prx.global.ApplicationMode == applicationModeTags && usesApplications(request) {
+		return prx.sendItemsWithApplications(ctx, srv, request)
+	}
+	substitute, ok := compatMethods[method]
+	if prx.compat == nil || !ok {
+		return prx.zbxClient.SendToZabbix(ctx, srv.URL, srv.IgnoreSSL, request)
+	}
+
+	if !prx.compat.lacks(srv.URL, method) {
+		response, err := prx.zbxClient.SendToZabbix(ctx, srv.URL, srv.IgnoreSSL, request)
+		if err == nil || !methodMissing(err) {
+			return response, err
+		}
+		prx.compat.markMissing(srv.URL, method)
+		logger.WithContext(ctx).Infof("%s is not supported by %s, substituting", method, srv.URL)
+	}
+
+	if mc := prx.methodMetrics(method); mc != nil {
+		mc.IncRequestStatus(srv.URL, "compat_substituted")
+	}
+	return substitute(prx, ctx, srv, request)
+}
+
+// compatEmptyResult отвечает пустым результатом (application.get в Zabbix 5.4+)
+func compatEmptyResult(_ *Proxy, _ context.Context, _ zabbix.ZabbixServer, request map[string]any) (map[string]any, error) {
+	return map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": request["id"]}, nil
+}
+
+// trendKey элемент данных и час тренда
+type trendKey struct {
+	itemID string
+	clock  int64
+}
+
+// trendValue накопленные значения часа тренда
+type trendValue struct {
+	num           int
+	min, max, sum float64
+}
+
+// compatTrendsFromHistory заменяет trend.get запросом history.get за тот же период:
+// значения истории числовых элементов данных сводятся в часовые тренды (min, avg, max)
+func compatTrendsFromHistory(prx *Proxy, ctx context.Context, srv zabbix.ZabbixServer, request map[string]any) (map[string]any, error) {
+	params, _ := request["params"].(map[string]any)
+	historyParams := map[string]any{"output": "extend", "sortfield": "clock", "sortorder": "ASC"}
+	for _, key := range []string{"itemids", "time_from", "time_till"} {
+		if v, ok := params[key]; ok {
+			historyParams[key] = v
+		}
+	}
+
+	trends := make(map[trendKey]*trendValue)
+	for _, historyType := range trendHistoryTypes {
+		historyRequest := maps.Clone(request)
+		historyRequest["method"] = "history.get"
+		historyRequest["params"] = maps.Clone(historyParams)
+		historyRequest["params"].(map[string]any)["history"] = historyType
+
+		response, err := prx.zbxClient.SendToZabbix(ctx, srv.URL, srv.IgnoreSSL, historyRequest)
+		if err != nil {
+			return nil, err
+		}
+		items, _ := response["result"].([]any)
+		for _, item := range items {
+			m, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			itemID := fmt.Sprint(m["itemid"])
+			clock, err1 := strconv.ParseInt(fmt.Sprint(m["clock"]), 10, 64)
+			value, err2 := strconv.ParseFloat(fmt.Sprint(m["value"]), 64)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			key := trendKey{itemID: itemID, clock: clock - clock%3600}
+			t, ok := trends[key]
+			if !ok {
+				t = &trendValue{min: value, max: value}
+				trends[key] = t
+			}
+			t.num++
+			t.sum += value
+			t.min = min(t.min, value)
+			t.max = max(t.max, value)
+		}
+	}
+
+	keys := slices.SortedFunc(maps.Keys(trends), func(a, b trendKey) int {
+		return cmp.Or(strings.Compare(a.itemID, b.itemID), cmp.Compare(a.clock, b.clock))
+	})
+	formatValue := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	result := make([]any, 0, len(keys))
+	for _, key := range keys {
+		t := trends[key]
+		result = append(result, map[string]any{
+			"itemid":    key.itemID,
+			"clock":     strconv.FormatInt(key.clock, 10),
+			"num":       strconv.Itoa(t.num),
+			"value_min": formatValue(t.min),
+			"value_avg": formatValue(t.sum / float64(t.num)),
+			"value_max": formatValue(t.max),
+		})
+	}
+	return map[string]any{"jsonrpc": "2.0", "result": result, "id": request["id"]}, nil
+}
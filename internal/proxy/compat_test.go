@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compatTestProxy создает proxy с одним сервером, отвечающим send
+func compatTestProxy(t *testing.T, compat bool, send func(request map[string]any) (map[string]any, error)) (*TestProxy, *MockZabbixClient) {
+	testProxy := NewTestProxy(t)
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://server1.com", ID: 1, Token: "token1"}}}
+	testProxy.Init(Global{MaxRequests: 5, GrafanaCompat: compat}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	mock := testProxy.GetMockClient()
+	mock.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		return send(request)
+	}
+	testProxy.prx.zbxClient = mock
+	return testProxy, mock
+}
+
+// incorrectAPI ошибка Zabbix 5.4+ на запрос удаленного API
+var incorrectAPI = &zabbix.APIError{Code: -32602, Message: "Invalid params.", Data: `Incorrect API "application".`}
+
+// TestCompat_ApplicationGet тестирует пустой результат application.get для серверов без приложений
+func TestCompat_ApplicationGet(t *testing.T) {
+	request := map[string]any{"jsonrpc": "2.0", "method": "application.get", "id": 1, "params": map[string]any{"hostids": []any{}}}
+	send := func(request map[string]any) (map[string]any, error) {
+		if request["method"] == "application.get" {
+			return nil, incorrectAPI
+		}
+		return map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": request["id"]}, nil
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		testProxy, _ := compatTestProxy(t, false, send)
+		defer testProxy.Cleanup()
+		_, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-compat-off")
+		assert.NotEmpty(t, errors)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		testProxy, mock := compatTestProxy(t, true, send)
+		defer testProxy.Cleanup()
+		testProxy.prx.SetMetrics(testProxy.metrics)
+
+		results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-compat")
+		assert.Empty(t, errors)
+		assert.Empty(t, results)
+		assert.Equal(t, 1, mock.CallCount)
+
+		// Сервер запомнен: повторный запрос заменяется без обращения к серверу
+		_, errors = testProxy.processAllServersWithMock(context.Background(), request, "test-compat-repeat")
+		assert.Empty(t, errors)
+		assert.Equal(t, 1, mock.CallCount)
+		assert.Equal(t, 2, testProxy.metrics.requestErrors["http://server1.com_compat_substituted"])
+	})
+}
+
+// TestCompat_TrendFallback тестирует замену trend.get часовыми трендами из history.get
+func TestCompat_TrendFallback(t *testing.T) {
+	var historyTypes []any
+	testProxy, _ := compatTestProxy(t, true, func(request map[string]any) (map[string]any, error) {
+		if request["method"] == "trend.get" {
+			return nil, &zabbix.APIError{Code: -32601, Message: "Method not found.", Data: `Incorrect method "trend.get".`}
+		}
+		params := request["params"].(map[string]any)
+		historyTypes = append(historyTypes, params["history"])
+		result := []any{}
+		if params["history"] == 0 {
+			assert.Equal(t, "1000", params["time_from"])
+			assert.Equal(t, "token1", request["auth"])
+			result = []any{
+				map[string]any{"itemid": "100", "clock": "3600", "value": "1.5"},
+				map[string]any{"itemid": "100", "clock": "5000", "value": "4.5"},
+				map[string]any{"itemid": "100", "clock": "7300", "value": "2"},
+			}
+		}
+		return map[string]any{"jsonrpc": "2.0", "result": result, "id": request["id"]}, nil
+	})
+	defer testProxy.Cleanup()
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "trend.get", "id": 1,
+		"params": map[string]any{"itemids": []any{"100"}, "time_from": "1000", "output": []any{"itemid", "clock", "value_avg"}}}
+	srv := testProxy.prx.config.Servers[0]
+	request["auth"] = srv.Token
+	response, err := testProxy.prx.sendUpstream(context.Background(), srv, request)
+	require.NoError(t, err)
+	assert.Equal(t, []any{0, 3}, historyTypes)
+	assert.Equal(t, 1, response["id"])
+	assert.Equal(t, []any{
+		map[string]any{"itemid": "100", "clock": "3600", "num": "2", "value_min": "1.5", "value_avg": "3", "value_max": "4.5"},
+		map[string]any{"itemid": "100", "clock": "7200", "num": "1", "value_min": "2", "value_avg": "2", "value_max": "2"},
+	}, response["result"])
+}
+
+// TestCompat_ItemKeyFilter тестирует, что фильтр и поиск по ключу элемента данных
+// передаются серверу без изменений
+func TestCompat_ItemKeyFilter(t *testing.T) {
+	testProxy, mock := compatTestProxy(t, true, func(request map[string]any) (map[string]any, error) {
+		return map[string]any{"jsonrpc": "2.0", "result": []any{
+			map[string]any{"itemid": "100", "key_": "system.cpu.load[all,avg1]"},
+		}, "id": request["id"]}, nil
+	})
+	defer testProxy.Cleanup()
+
+	params := map[string]any{
+		"output": []any{"itemid", "key_"},
+		"filter": map[string]any{"key_": []any{"system.cpu.load[all,avg1]"}},
+		"search": map[string]any{"key_": "system.cpu.*"}, "searchWildcardsEnabled": true,
+	}
+	request := map[string]any{"jsonrpc": "2.0", "method": "item.get", "id": 1, "params": params}
+	results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-key-filter")
+	require.Empty(t, errors)
+	assert.Len(t, results, 1)
+	assert.Equal(t, params["filter"], mock.LastRequest["params"].(map[string]any)["filter"])
+	assert.Equal(t, params["search"], mock.LastRequest["params"].(map[string]any)["search"])
+}
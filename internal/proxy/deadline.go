@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+
+	"github.com/a3ak/suffix"
+)
+
+// Запас времени по умолчанию между сроком запросов к серверам и сроком запроса клиента
+const defaultDeadlineHeadroom = time.Second
+
+// parseDeadlineHeadroom возвращает запас deadline_headroom ("0" - запросы к серверам
+// ограничены сроком запроса клиента)
+func parseDeadlineHeadroom(value string) time.Duration {
+	if value == "" {
+		return defaultDeadlineHeadroom
+	}
+	s, err := suffix.ToSeconds(value)
+	if err != nil || s < 0 {
+		logger.Global.Errorf("convert error 'deadline_headroom' to seconds: %v, using %v", err, defaultDeadlineHeadroom)
+		return defaultDeadlineHeadroom
+	}
+	return time.Duration(s) * time.Second
+}
+
+// upstreamContext возвращает контекст запросов к серверам со сроком раньше срока
+// запроса клиента на deadline_headroom: после таймаута серверов остается время
+// объединить результаты и отправить ответ. Запас не превышает половины оставшегося
+// времени, чтобы короткий таймаут не отнял все время у серверов
+func (prx *Proxy) upstreamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || prx.global.deadlineHeadroom <= 0 {
+		return context.WithCancel(ctx)
+	}
+	headroom := min(prx.global.deadlineHeadroom, time.Until(deadline)/2)
+	return context.WithDeadline(ctx, deadline.Add(-headroom))
+}
+
+// upstreamTimedOut сообщает, что запрос к серверу прерван сроком upstreamContext
+// или таймаутом запроса клиента
+func upstreamTimedOut(upstreamCtx context.Context) bool {
+	return upstreamCtx.Err() == context.DeadlineExceeded
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseDeadlineHeadroom тестирует разбор deadline_headroom
+func TestParseDeadlineHeadroom(t *testing.T) {
+	assert.Equal(t, defaultDeadlineHeadroom, parseDeadlineHeadroom(""))
+	assert.Equal(t, 3*time.Second, parseDeadlineHeadroom("3s"))
+	assert.Equal(t, time.Duration(0), parseDeadlineHeadroom("0"))
+	assert.Equal(t, defaultDeadlineHeadroom, parseDeadlineHeadroom("abc"))
+}
+
+// TestUpstreamContext тестирует срок запросов к серверам
+func TestUpstreamContext(t *testing.T) {
+	prx := &Proxy{global: Global{deadlineHeadroom: time.Second}}
+
+	t.Run("no deadline", func(t *testing.T) {
+		ctx, cancel := prx.upstreamContext(context.Background())
+		defer cancel()
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+	})
+
+	t.Run("headroom", func(t *testing.T) {
+		parent, cancelParent := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancelParent()
+		ctx, cancel := prx.upstreamContext(parent)
+		defer cancel()
+		parentDeadline, _ := parent.Deadline()
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		assert.Equal(t, parentDeadline.Add(-time.Second), deadline)
+	})
+
+	t.Run("short timeout", func(t *testing.T) {
+		// Запас не превышает половины оставшегося времени
+		parent, cancelParent := context.WithTimeout(context.Background(), time.Second)
+		defer cancelParent()
+		ctx, cancel := prx.upstreamContext(parent)
+		defer cancel()
+		parentDeadline, _ := parent.Deadline()
+		deadline, _ := ctx.Deadline()
+		assert.Greater(t, deadline.Sub(time.Now()), 400*time.Millisecond)
+		assert.True(t, deadline.Before(parentDeadline))
+	})
+}
+
+// TestProcessAllServers_DeadlineHeadroom тестирует ответ успевших серверов с ошибкой
+// таймаута медленного сервера до истечения таймаута запроса
+func TestProcessAllServers_DeadlineHeadroom(t *testing.T) {
+	prx := partialTestProxy(Global{DeadlineHeadroom: "1s"})
+	defer cleanupTestProxy(prx)
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	results, errors := prx.processAllServers(ctx, request, "test-headroom")
+	// Ответ собран до истечения таймаута запроса клиента
+	assert.NoError(t, ctx.Err())
+	list, ok := results.([]any)
+	require.True(t, ok)
+	assert.Len(t, list, 1)
+	assert.Equal(t, []string{"http://slow.com: server 2: request timeout"}, errors)
+}
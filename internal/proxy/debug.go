@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"context"
+	"maps"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Заголовок, включающий отладочную разбивку запроса по серверам в ответе
+	debugHeader = "X-Proxy-Debug"
+	// для хранения отладочной информации запроса
+	debugKey ctxKey = "debug"
+)
+
+// requestDebug отладочная разбивка обработки запроса по серверам.
+// Методы безопасны для nil, что бы не проверять включение отладки в местах вызова
+type requestDebug struct {
+	mu      sync.Mutex
+	start   time.Time
+	servers map[int]*serverDebug
+	// Элементы, удаленные как дубликаты уже полученных сущностей, по типам
+	deduplicated map[string]int
+	// Показывать адреса серверов и тексты их ошибок (см. Proxy.debugDetails)
+	details bool
+}
+
+// serverDebug тайминги и статус обработки запроса одним сервером
+type serverDebug struct {
+	ServerID     int     `json:"server_id"`
+	URL          string  `json:"url,omitempty"`
+	Status       string  `json:"status"`
+	QueueWaitMs  float64 `json:"queue_wait_ms"`
+	UpstreamMs   float64 `json:"upstream_ms"`
+	ProcessingMs float64 `json:"processing_ms"`
+	ResultCount  int     `json:"result_count"`
+	Error        string  `json:"error,omitempty"`
+	// Удаленные дубликаты по типам сущностей
+	Deduplicated map[string]int `json:"deduplicated,omitempty"`
+}
+
+// withRequestDebug включает отладку, если клиент передал X-Proxy-Debug: 1.
+// Без details в разбивке нет адресов серверов и текстов их ошибок
+func withRequestDebug(ctx context.Context, r *http.Request, details bool) (context.Context, *requestDebug) {
+	if r.Header.Get(debugHeader) != "1" {
+		return ctx, nil
+	}
+	dbg := &requestDebug{start: time.Now(), servers: make(map[int]*serverDebug), deduplicated: make(map[string]int), details: details}
+	return context.WithValue(ctx, debugKey, dbg), dbg
+}
+
+// debugDetails разрешает показывать в разбивке X-Proxy-Debug адреса серверов и тексты
+// их ошибок: только если не задан hide_info и клиент - администратор (учетные данные
+// из конфига или клиент внешнего источника с ролью admin)
+func (prx *Proxy) debugDetails(ctx context.Context) bool {
+	if prx.global.HideInfo {
+		return false
+	}
+	if p := principalFromContext(ctx); p != nil {
+		return p.admin
+	}
+	return prx.adminAuthConfigured(prx.global.Login, prx.global.AuthPassword(), prx.global.Token)
+}
+
+// debugFromContext возвращает отладочную информацию запроса или nil, если отладка не включена
+func debugFromContext(ctx context.Context) *requestDebug {
+	dbg, _ := ctx.Value(debugKey).(*requestDebug)
+	return dbg
+}
+
+// update изменяет данные сервера под блокировкой
+func (d *requestDebug) update(serverID int, url string, fn func(s *serverDebug)) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.servers[serverID]
+	if !ok {
+		s = &serverDebug{ServerID: serverID, URL: url}
+		d.servers[serverID] = s
+	}
+	fn(s)
+}
+
+// queued фиксирует время ожидания слота семафора
+func (d *requestDebug) queued(serverID int, url string, wait time.Duration) {
+	d.update(serverID, url, func(s *serverDebug) {
+		s.QueueWaitMs = durationMs(wait)
+	})
+}
+
+// upstream фиксирует время запроса к серверу и его результат
+func (d *requestDebug) upstream(serverID int, url string, latency time.Duration, err error) {
+	d.update(serverID, url, func(s *serverDebug) {
+		s.URL = url // Запрос мог уйти на canary_url
+		s.UpstreamMs = durationMs(latency)
+		if err != nil {
+			s.Status = "error"
+			// Ошибка может содержать адрес сервера и токен из запроса
+			if d.details {
+				s.Error = logger.Redact(err.Error())
+			}
+		} else {
+			s.Status = "success"
+		}
+	})
+}
+
+// processed фиксирует время преобразования ID в ответе и количество результатов
+func (d *requestDebug) processed(serverID int, url string, processing time.Duration, result any) {
+	d.update(serverID, url, func(s *serverDebug) {
+		s.ProcessingMs = durationMs(processing)
+		switch r := result.(type) {
+		case []any:
+			s.ResultCount = len(r)
+		case map[string]any:
+			s.ResultCount = len(r)
+		case nil:
+			s.ResultCount = 0
+		default:
+			s.ResultCount = 1
+		}
+	})
+}
+
+// deduplicatedEntries фиксирует элементы ответа сервера, удаленные как дубликаты: сравнивает
+// число элементов с полями дедупликации (groupid) до и после преобразования ID
+func (d *requestDebug) deduplicatedEntries(serverID int, url string, result, processed any) {
+	if d == nil {
+		return
+	}
+	before, after := countDedupEntries(result), countDedupEntries(processed)
+	d.update(serverID, url, func(s *serverDebug) {
+		for fieldType, n := range before {
+			if dropped := n - after[fieldType]; dropped > 0 {
+				if s.Deduplicated == nil {
+					s.Deduplicated = make(map[string]int)
+				}
+				s.Deduplicated[fieldType] += dropped
+				d.deduplicated[fieldType] += dropped
+			}
+		}
+	})
+}
+
+// countDedupEntries считает элементы списка с полями дедупликации по типам
+func countDedupEntries(result any) map[string]int {
+	counts := make(map[string]int)
+	items, _ := result.([]any)
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, fieldType := range dedupFileds {
+			if _, ok := m[fieldType+"id"]; ok {
+				counts[fieldType]++
+			}
+		}
+	}
+	return counts
+}
+
+// status фиксирует статус сервера, не дошедшего до запроса (circuit_open, skipped, timeout)
+func (d *requestDebug) status(serverID int, url, status string) {
+	d.update(serverID, url, func(s *serverDebug) {
+		s.Status = status
+	})
+}
+
+// meta возвращает разбивку для добавления в ответ клиенту
+func (d *requestDebug) meta() map[string]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	servers := make([]serverDebug, 0, len(d.servers))
+	for _, s := range d.servers {
+		srv := *s
+		if !d.details {
+			srv.URL = ""
+		}
+		servers = append(servers, srv)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ServerID < servers[j].ServerID })
+
+	return map[string]any{
+		"total_ms":     durationMs(time.Since(d.start)),
+		"servers":      servers,
+		"deduplicated": maps.Clone(d.deduplicated),
+	}
+}
+
+// durationMs переводит длительность в миллисекунды
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWithRequestDebug тестирует включение отладки по заголовку
+func TestWithRequestDebug(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+	ctx, dbg := withRequestDebug(context.Background(), r, true)
+	assert.Nil(t, dbg)
+	assert.Nil(t, debugFromContext(ctx))
+
+	// Методы безопасны для nil
+	dbg.queued(1, "http://zbx1", time.Millisecond)
+	dbg.status(1, "http://zbx1", "skipped")
+
+	r.Header.Set(debugHeader, "1")
+	ctx, dbg = withRequestDebug(context.Background(), r, true)
+	require.NotNil(t, dbg)
+	assert.Same(t, dbg, debugFromContext(ctx))
+}
+
+// TestProcessAllServers_Debug тестирует разбивку обработки запроса по серверам
+func TestProcessAllServers_Debug(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	mockClient := testProxy.GetMockClient()
+	mockClient.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		if url == "http://zbx2" {
+			return nil, fmt.Errorf("mock server error")
+		}
+		return map[string]any{"result": []any{
+			map[string]any{"itemid": "1"},
+			map[string]any{"itemid": "2"},
+		}}, nil
+	}
+
+	z := ZabbixConf{
+		Servers: []zabbix.ZabbixServer{
+			{URL: "http://zbx1", ID: 1, Token: "token1"},
+			{URL: "http://zbx2", ID: 2, Token: "token2"},
+		},
+	}
+	testProxy.Init(Global{MaxRequests: 5}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set(debugHeader, "1")
+	ctx, dbg := withRequestDebug(context.Background(), r, true)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "item.get", "id": 1, "params": map[string]any{}}
+	testProxy.processAllServersWithMock(ctx, request, "test-debug")
+
+	meta := dbg.meta()
+	servers, ok := meta["servers"].([]serverDebug)
+	require.True(t, ok)
+	require.Len(t, servers, 2)
+
+	assert.Equal(t, 1, servers[0].ServerID)
+	assert.Equal(t, "success", servers[0].Status)
+	assert.Equal(t, 2, servers[0].ResultCount)
+
+	assert.Equal(t, 2, servers[1].ServerID)
+	assert.Equal(t, "error", servers[1].Status)
+	assert.Equal(t, "mock server error", servers[1].Error)
+}
+
+// TestProcessAllServers_DebugDeduplicated тестирует учет удаленных дубликатов групп
+func TestProcessAllServers_DebugDeduplicated(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	mockClient := testProxy.GetMockClient()
+	mockClient.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		groupID := "5"
+		if url == "http://zbx2" {
+			groupID = "7"
+		}
+		return map[string]any{"result": []any{
+			map[string]any{"groupid": groupID, "name": "Linux servers"},
+			map[string]any{"groupid": groupID + "0", "name": "Only " + url},
+		}}, nil
+	}
+
+	z := ZabbixConf{
+		Servers: []zabbix.ZabbixServer{
+			{URL: "http://zbx1", ID: 1, Token: "token1"},
+			{URL: "http://zbx2", ID: 2, Token: "token2"},
+		},
+	}
+	testProxy.Init(Global{MaxRequests: 5, StableOrder: true}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set(debugHeader, "1")
+	ctx, dbg := withRequestDebug(context.Background(), r, true)
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "hostgroup.get", "id": 1, "params": map[string]any{}}
+	results, errors := testProxy.processAllServersWithMock(ctx, request, "test-debug-dedup")
+	require.Empty(t, errors)
+	groups := results.([]any)
+	require.Len(t, groups, 3, "same-named group of the second server is dropped")
+	for _, g := range groups {
+		assert.NotNil(t, g.(map[string]any)["groupid"])
+	}
+
+	meta := dbg.meta()
+	assert.Equal(t, map[string]int{"group": 1}, meta["deduplicated"])
+	servers := meta["servers"].([]serverDebug)
+	require.Len(t, servers, 2)
+	assert.Empty(t, servers[0].Deduplicated)
+	assert.Equal(t, map[string]int{"group": 1}, servers[1].Deduplicated)
+}
+
+// TestRequestDebugDetails тестирует, что адреса серверов и тексты ошибок видны только
+// администраторам без hide_info, а секреты в ошибках скрыты
+func TestRequestDebugDetails(t *testing.T) {
+	logger.SetSecrets("server-token")
+	defer logger.SetSecrets()
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set(debugHeader, "1")
+	upstreamErr := errors.New(`Post "http://zbx1/api_jsonrpc.php": auth server-token rejected`)
+
+	_, dbg := withRequestDebug(context.Background(), r, true)
+	dbg.upstream(1, "http://zbx1", time.Millisecond, upstreamErr)
+	servers := dbg.meta()["servers"].([]serverDebug)
+	assert.Equal(t, "http://zbx1", servers[0].URL)
+	assert.Equal(t, `Post "http://zbx1/api_jsonrpc.php": auth *** rejected`, servers[0].Error)
+
+	_, dbg = withRequestDebug(context.Background(), r, false)
+	dbg.upstream(1, "http://zbx1", time.Millisecond, upstreamErr)
+	servers = dbg.meta()["servers"].([]serverDebug)
+	assert.Equal(t, "error", servers[0].Status)
+	assert.Empty(t, servers[0].URL)
+	assert.Empty(t, servers[0].Error)
+
+	prx := &Proxy{global: Global{Token: "admin-token"}}
+	ctx := context.Background()
+	assert.True(t, prx.debugDetails(ctx), "config credentials")
+	assert.False(t, prx.debugDetails(withPrincipal(ctx, &authPrincipal{name: "grafana"})))
+	assert.True(t, prx.debugDetails(withPrincipal(ctx, &authPrincipal{name: "alice", admin: true})))
+	assert.False(t, (&Proxy{}).debugDetails(ctx), "anonymous client without auth")
+	prx.global.HideInfo = true
+	assert.False(t, prx.debugDetails(ctx), "hide_info")
+}
@@ -0,0 +1,15 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+)
+
+// errClientGone ошибка запроса, клиент которого отключился до получения ответа
+const errClientGone = "client disconnected"
+
+// clientGone сообщает, что запрос отменен отключением клиента, а не таймаутом
+// max_timeout: контекст обработчика отменяется вместе с контекстом HTTP запроса
+func clientGone(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClientDisconnect тестирует отмену запросов к серверам после отключения клиента
+func TestClientDisconnect(t *testing.T) {
+	g := Global{MaxRequests: 5, MaxTimeout: "5s", CoalesceRequests: true}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	metrics := NewMockMetricsCollector()
+	prx.SetMetrics(metrics)
+
+	var started, cancelled atomic.Int32
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		started.Add(1)
+		// Серверы отвечают дольше, чем клиент готов ждать
+		select {
+		case <-ctx.Done():
+			cancelled.Add(1)
+			return nil, ctx.Err()
+		case <-time.After(3 * time.Second):
+			return map[string]any{"result": []any{}}, nil
+		}
+	}}
+
+	// disconnect отменяет контекст клиента, когда все серверы опрашиваются
+	disconnect := func(cancel context.CancelFunc) {
+		assert.Eventually(t, func() bool { return started.Load() == 3 }, time.Second, time.Millisecond)
+		cancel()
+	}
+
+	t.Run("handler", func(t *testing.T) {
+		started.Store(0)
+		cancelled.Store(0)
+
+		body := []byte(`{"jsonrpc":"2.0","method":"host.get","params":{"output":"extend"},"id":1}`)
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), bodyKey, body))
+		req := httptest.NewRequest("POST", "/", strings.NewReader(string(body))).WithContext(ctx)
+		w := httptest.NewRecorder()
+		go disconnect(cancel)
+
+		start := time.Now()
+		prx.Handler(w, req)
+		assert.Less(t, time.Since(start), time.Second)
+		// Отключившемуся клиенту ответ не отправляется
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, 1, metrics.requestErrors["APIproxy_client_abandoned"])
+
+		// Общий запрос отменен, т.к. других ожидающих нет
+		assert.Eventually(t, func() bool { return cancelled.Load() == 3 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("process", func(t *testing.T) {
+		started.Store(0)
+		cancelled.Store(0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go disconnect(cancel)
+
+		request := map[string]any{"jsonrpc": "2.0", "method": "item.get", "id": 1, "params": map[string]any{}}
+		results, errors := prx.processAllServers(ctx, request, "test-disconnect")
+		assert.Nil(t, results)
+		assert.Equal(t, []string{errClientGone}, errors)
+		assert.Eventually(t, func() bool { return cancelled.Load() == 3 }, time.Second, 10*time.Millisecond)
+
+		// Отключение клиента не считается ошибкой серверов
+		for _, name := range []string{"server1.com", "server2.com", "server3.com"} {
+			allowed, _ := prx.cb.AllowRequest(name)
+			assert.True(t, allowed)
+		}
+		assert.Zero(t, metrics.requestErrors["http://server1.com_error"])
+	})
+}
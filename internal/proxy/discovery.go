@@ -0,0 +1,351 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/a3ak/circuitbreaker"
+	"github.com/a3ak/suffix"
+)
+
+const (
+	// Допустимый диапазон ID серверов (ID кодируется одной цифрой в ProxyID)
+	minServerID = 1
+	maxServerID = 9
+
+	defaultDiscoveryInterval     = 30 * time.Second
+	defaultDiscoveryRemovalGrace = 5 * time.Minute
+)
+
+// ID, назначенные обнаруженным серверам (URL -> ID). Хранятся между перезагрузками
+// конфигурации, чтобы ProxyID в кеше продолжали указывать на тот же сервер
+var (
+	discoveryIDs   = make(map[string]int)
+	discoveryIDsMu sync.Mutex
+)
+
+// loadDiscoveryIDs загружает назначенные ID из файла
+func loadDiscoveryIDs(path string) {
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Global.Warningf("Failed to read discovery ids file %s: %v", path, err)
+		}
+		return
+	}
+
+	ids := make(map[string]int)
+	if err := json.Unmarshal(data, &ids); err != nil {
+		logger.Global.Warningf("Invalid discovery ids file %s: %v", path, err)
+		return
+	}
+
+	discoveryIDsMu.Lock()
+	defer discoveryIDsMu.Unlock()
+	for url, id := range ids {
+		if _, ok := discoveryIDs[url]; !ok {
+			discoveryIDs[url] = id
+		}
+	}
+}
+
+// saveDiscoveryIDs сохраняет назначенные ID в файл
+func saveDiscoveryIDs(path string) {
+	if path == "" {
+		return
+	}
+	discoveryIDsMu.Lock()
+	data, err := json.MarshalIndent(discoveryIDs, "", "  ")
+	discoveryIDsMu.Unlock()
+	if err != nil {
+		logger.Global.Warningf("Failed to encode discovery ids: %v", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		logger.Global.Warningf("Failed to write discovery ids file %s: %v", path, err)
+	}
+}
+
+// assignDiscoveryIDs назначает обнаруженным серверам стабильные ID.
+// Приоритет: ID статических серверов конфига, затем ID из метаданных сервиса,
+// затем ранее назначенный ID, затем наименьший свободный. ID сервера, который
+// больше не обнаруживается, остается за ним: ProxyID в кеше кодируют ID сервера,
+// и выдача ID другому URL направила бы их на чужой сервер. Если свободных ID нет,
+// новый сервер пропускается
+func assignDiscoveryIDs(found []zabbix.DiscoveredServer, static []zabbix.ZabbixServer) []zabbix.DiscoveredServer {
+	used := make(map[int]bool)
+	staticURLs := make(map[string]bool)
+	for _, s := range static {
+		used[s.ID] = true
+		staticURLs[s.URL] = true
+	}
+
+	// Стабильный порядок и отсев серверов, уже описанных в конфиге
+	pending := make([]zabbix.DiscoveredServer, 0, len(found))
+	for _, s := range found {
+		if !staticURLs[s.URL] && !slices.ContainsFunc(pending, func(p zabbix.DiscoveredServer) bool { return p.URL == s.URL }) {
+			pending = append(pending, s)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].URL < pending[j].URL })
+
+	discoveryIDsMu.Lock()
+	defer discoveryIDsMu.Unlock()
+
+	assigned := make([]zabbix.DiscoveredServer, 0, len(pending))
+	assign := func(s zabbix.DiscoveredServer, id int) {
+		used[id] = true
+		// ID переходит к этому серверу
+		for url, old := range discoveryIDs {
+			if old == id && url != s.URL {
+				delete(discoveryIDs, url)
+			}
+		}
+		discoveryIDs[s.URL] = id
+		s.ID = id
+		assigned = append(assigned, s)
+	}
+
+	// Явный ID из метаданных и ранее назначенный ID
+	var rest []zabbix.DiscoveredServer
+	for _, s := range pending {
+		if s.ID >= minServerID && s.ID <= maxServerID && !used[s.ID] {
+			assign(s, s.ID)
+			continue
+		}
+		if s.ID != 0 {
+			logger.Global.Warningf("Discovered server %s has invalid or busy id %d, assigning another", s.URL, s.ID)
+		}
+		rest = append(rest, s)
+	}
+	pending, rest = rest, nil
+	for _, s := range pending {
+		if id, ok := discoveryIDs[s.URL]; ok && !used[id] {
+			assign(s, id)
+			continue
+		}
+		rest = append(rest, s)
+	}
+
+	// ID, закрепленные за ранее обнаруженными серверами
+	reserved := make(map[int]bool)
+	for _, id := range discoveryIDs {
+		reserved[id] = true
+	}
+
+	for _, s := range rest {
+		id := 0
+		for candidate := minServerID; candidate <= maxServerID; candidate++ {
+			if !used[candidate] && !reserved[candidate] {
+				id = candidate
+				break
+			}
+		}
+		if id == 0 {
+			logger.Global.Warningf("No free server id for discovered server %s, skipping (ids of servers that are no longer discovered stay reserved in ids_file)", s.URL)
+			continue
+		}
+		assign(s, id)
+	}
+
+	sort.Slice(assigned, func(i, j int) bool { return assigned[i].ID < assigned[j].ID })
+	return assigned
+}
+
+// discoveryRetention удерживает в списке серверы, пропавшие из discovery, на время
+// removal_grace: запросы по ProxyID из кеша продолжают направляться на сервер,
+// пока он, например, перезапускается. По истечении срока сервер удаляется из списка
+type discoveryRetention struct {
+	grace time.Duration
+	// Время, когда сервер пропал из discovery (URL -> время)
+	missing map[string]time.Time
+	now     func() time.Time
+}
+
+func newDiscoveryRetention(cfg zabbix.DiscoveryConf) *discoveryRetention {
+	grace := defaultDiscoveryRemovalGrace
+	if cfg.RemovalGrace != "" {
+		if s, err := suffix.ToSeconds(cfg.RemovalGrace); err != nil {
+			logger.Global.Errorf("invalid 'discovery.removal_grace' %s, using %v", cfg.RemovalGrace, defaultDiscoveryRemovalGrace)
+		} else {
+			grace = time.Duration(s) * time.Second
+		}
+	}
+	return &discoveryRetention{grace: grace, missing: make(map[string]time.Time), now: time.Now}
+}
+
+// retain добавляет к найденным серверам ранее обнаруженные серверы из current,
+// которые пропали из discovery не дольше removal_grace назад
+func (r *discoveryRetention) retain(found []zabbix.DiscoveredServer, current, static []zabbix.ZabbixServer) []zabbix.DiscoveredServer {
+	now := r.now()
+	present := make(map[string]bool)
+	used := make(map[int]bool)
+	for _, s := range found {
+		present[s.URL], used[s.ID] = true, true
+	}
+	for _, s := range static {
+		present[s.URL], used[s.ID] = true, true
+	}
+
+	retained := slices.Clone(found)
+	for _, s := range current {
+		if present[s.URL] {
+			delete(r.missing, s.URL)
+			continue
+		}
+		since, ok := r.missing[s.URL]
+		if !ok {
+			since = now
+			r.missing[s.URL] = now
+			if r.grace > 0 {
+				logger.Global.Infof("Discovery: server %d is gone (%s), keeping it for %v", s.ID, s.URL, r.grace)
+			}
+		}
+		// ID мог быть явно задан другому серверу в метаданных сервиса
+		if now.Sub(since) >= r.grace || used[s.ID] {
+			delete(r.missing, s.URL)
+			continue
+		}
+		retained = append(retained, zabbix.DiscoveredServer{URL: s.URL, ID: s.ID})
+	}
+
+	sort.Slice(retained, func(i, j int) bool { return retained[i].ID < retained[j].ID })
+	return retained
+}
+
+// applyDiscoveredServers обновляет список серверов proxy: статические серверы конфига
+// и обнаруженные. Возвращает true, если список изменился.
+// Вызывается под блокировкой конфигурации, когда нет активных запросов
+func (prx *Proxy) applyDiscoveredServers(static []zabbix.ZabbixServer, found []zabbix.DiscoveredServer, cfg zabbix.DiscoveryConf) bool {
+	servers := slices.Clone(static)
+	for _, s := range found {
+		servers = append(servers, zabbix.ZabbixServer{
+			URL:       s.URL,
+			ID:        s.ID,
+			Name:      urlHostName(s.URL),
+			Token:     cfg.Token,
+			IgnoreSSL: cfg.IgnoreSSL,
+		})
+	}
+
+	sameServer := func(a, b zabbix.ZabbixServer) bool { return a.ID == b.ID && a.URL == b.URL }
+	if slices.EqualFunc(servers, prx.config.Servers, sameServer) {
+		return false
+	}
+
+	// Circuit Breaker для новых серверов
+	var names []string
+	for _, s := range servers {
+		if !slices.ContainsFunc(prx.config.Servers, func(o zabbix.ZabbixServer) bool { return sameServer(o, s) }) {
+			logger.Global.Infof("Discovery: server %d added (%s)", s.ID, s.URL)
+			if prx.cb.GetCircuitBreaker(s.Name) == nil {
+				names = append(names, s.Name)
+			}
+		}
+	}
+	for _, s := range prx.config.Servers {
+		if !slices.ContainsFunc(servers, func(o zabbix.ZabbixServer) bool { return sameServer(o, s) }) {
+			logger.Global.Infof("Discovery: server %d removed (%s)", s.ID, s.URL)
+		}
+	}
+	if len(names) > 0 {
+		prx.cb.InitCircuitBreakers(names, circuitbreaker.CircuitBreakerConf(prx.cbConf))
+	}
+
+	prx.config.Servers = servers
+	return true
+}
+
+// StartDiscovery запускает периодическое обновление списка серверов из discovery.
+// locker - блокировка конфигурации, под которой выполняются запросы: список серверов
+// меняется только после завершения текущих запросов. Возвращает nil, если discovery отключен
+func (prx *Proxy) StartDiscovery(locker sync.Locker) context.CancelFunc {
+	cfg := prx.config.Discovery
+	if cfg.Provider == "" {
+		return nil
+	}
+
+	interval := defaultDiscoveryInterval
+	if cfg.Interval != "" {
+		if s, err := suffix.ToSeconds(cfg.Interval); err != nil || s == 0 {
+			logger.Global.Errorf("convert error 'discovery.interval' to seconds: %v", err)
+		} else {
+			interval = time.Duration(s) * time.Second
+		}
+	}
+
+	static := slices.Clone(prx.config.Servers)
+	loadDiscoveryIDs(cfg.IDsFile)
+	retention := newDiscoveryRetention(cfg)
+	discoverer := zabbix.NewDiscoverer(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Для Kubernetes изменения Endpoints применяются сразу, опрос остается страховкой
+	notify := make(chan struct{}, 1)
+	if cfg.Provider == "kubernetes" {
+		if err := zabbix.WatchKubernetes(ctx, cfg, notify); err != nil {
+			logger.Global.Warningf("Kubernetes watch is unavailable, polling only: %v", err)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		source := cfg.Service
+		if cfg.Provider == "kubernetes" {
+			source = cfg.LabelSelector
+		}
+		logger.Global.Infof("Discovery started: provider '%s', source '%s', interval %s", cfg.Provider, source, interval)
+		for {
+			prx.runDiscovery(ctx, locker, discoverer, static, cfg, retention, interval)
+
+			select {
+			case <-ticker.C:
+			case <-notify:
+			case <-ctx.Done():
+				logger.Global.Info("Discovery stopped")
+				return
+			}
+		}
+	}()
+	return cancel
+}
+
+// runDiscovery выполняет один цикл обновления списка серверов
+func (prx *Proxy) runDiscovery(ctx context.Context, locker sync.Locker, discoverer *zabbix.Discoverer, static []zabbix.ZabbixServer, cfg zabbix.DiscoveryConf, retention *discoveryRetention, timeout time.Duration) {
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	found, err := discoverer.Discover(reqCtx)
+	if err != nil {
+		// Сохраняем текущий список, чтобы сбой discovery не отключил серверы
+		logger.Global.Warningf("Discovery via '%s' failed, keeping current servers: %v", cfg.Provider, err)
+		return
+	}
+	found = assignDiscoveryIDs(found, static)
+
+	locker.Lock()
+	changed := false
+	// Proxy мог быть перезапущен, пока ожидали блокировку
+	if ctx.Err() == nil {
+		found = retention.retain(found, prx.config.Servers, static)
+		changed = prx.applyDiscoveredServers(static, found, cfg)
+	}
+	locker.Unlock()
+
+	if changed {
+		saveDiscoveryIDs(cfg.IDsFile)
+	}
+}
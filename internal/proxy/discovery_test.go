@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/zabbix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetDiscoveryIDs очищает назначенные discovery ID между тестами
+func resetDiscoveryIDs(t *testing.T) {
+	discoveryIDsMu.Lock()
+	discoveryIDs = make(map[string]int)
+	discoveryIDsMu.Unlock()
+	t.Cleanup(func() {
+		discoveryIDsMu.Lock()
+		discoveryIDs = make(map[string]int)
+		discoveryIDsMu.Unlock()
+	})
+}
+
+func discoveredIDs(servers []zabbix.DiscoveredServer) map[string]int {
+	ids := make(map[string]int, len(servers))
+	for _, s := range servers {
+		ids[s.URL] = s.ID
+	}
+	return ids
+}
+
+func TestAssignDiscoveryIDs_Stable(t *testing.T) {
+	resetDiscoveryIDs(t)
+	static := []zabbix.ZabbixServer{{ID: 1, URL: "https://static/api_jsonrpc.php"}}
+
+	first := assignDiscoveryIDs([]zabbix.DiscoveredServer{
+		{URL: "https://b/api_jsonrpc.php"},
+		{URL: "https://a/api_jsonrpc.php"},
+		{URL: "https://static/api_jsonrpc.php"},
+	}, static)
+	assert.Equal(t, map[string]int{
+		"https://a/api_jsonrpc.php": 2,
+		"https://b/api_jsonrpc.php": 3,
+	}, discoveredIDs(first))
+
+	// Исчезнувший сервер не сдвигает ID остальных, новый получает свободный ID
+	second := assignDiscoveryIDs([]zabbix.DiscoveredServer{
+		{URL: "https://c/api_jsonrpc.php"},
+		{URL: "https://b/api_jsonrpc.php"},
+	}, static)
+	assert.Equal(t, map[string]int{
+		"https://b/api_jsonrpc.php": 3,
+		"https://c/api_jsonrpc.php": 4,
+	}, discoveredIDs(second))
+
+	// Вернувшийся сервер получает прежний ID
+	third := assignDiscoveryIDs([]zabbix.DiscoveredServer{
+		{URL: "https://a/api_jsonrpc.php"},
+		{URL: "https://b/api_jsonrpc.php"},
+	}, static)
+	assert.Equal(t, 2, discoveredIDs(third)["https://a/api_jsonrpc.php"])
+}
+
+func TestAssignDiscoveryIDs_MetaAndExhausted(t *testing.T) {
+	resetDiscoveryIDs(t)
+	static := []zabbix.ZabbixServer{{ID: 1, URL: "https://static/api_jsonrpc.php"}}
+
+	// ID из метаданных имеет приоритет, занятый статическим сервером - игнорируется
+	servers := assignDiscoveryIDs([]zabbix.DiscoveredServer{
+		{URL: "https://a/api_jsonrpc.php", ID: 7},
+		{URL: "https://b/api_jsonrpc.php", ID: 1},
+	}, static)
+	assert.Equal(t, map[string]int{
+		"https://a/api_jsonrpc.php": 7,
+		"https://b/api_jsonrpc.php": 2,
+	}, discoveredIDs(servers))
+
+	// Свободных ID больше нет: лишние серверы пропускаются
+	var many []zabbix.DiscoveredServer
+	for _, host := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		many = append(many, zabbix.DiscoveredServer{URL: "https://" + host + "/api_jsonrpc.php"})
+	}
+	servers = assignDiscoveryIDs(many, static)
+	assert.Len(t, servers, maxServerID-1)
+}
+
+func TestAssignDiscoveryIDs_ReservedNotReused(t *testing.T) {
+	resetDiscoveryIDs(t)
+	static := []zabbix.ZabbixServer{{ID: 1, URL: "https://static/api_jsonrpc.php"}}
+
+	var all []zabbix.DiscoveredServer
+	for _, host := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		all = append(all, zabbix.DiscoveredServer{URL: "https://" + host + "/api_jsonrpc.php"})
+	}
+	require.Len(t, assignDiscoveryIDs(all, static), maxServerID-1)
+	removedID := discoveryIDs["https://a/api_jsonrpc.php"]
+
+	// Сервер a пропал, новый сервер не получает его ID: ProxyID в кеше
+	// с этим ID указывают на сервер a
+	servers := assignDiscoveryIDs(append(all[1:], zabbix.DiscoveredServer{URL: "https://new/api_jsonrpc.php"}), static)
+	assert.Len(t, servers, maxServerID-2)
+	assert.NotContains(t, discoveredIDs(servers), "https://new/api_jsonrpc.php")
+	assert.Equal(t, removedID, discoveryIDs["https://a/api_jsonrpc.php"])
+
+	// Вернувшийся сервер получает прежний ID
+	servers = assignDiscoveryIDs(all, static)
+	assert.Equal(t, removedID, discoveredIDs(servers)["https://a/api_jsonrpc.php"])
+}
+
+func TestDiscoveryRetention(t *testing.T) {
+	static := []zabbix.ZabbixServer{{ID: 1, URL: "https://static/api_jsonrpc.php"}}
+	current := append(slices.Clone(static),
+		zabbix.ZabbixServer{ID: 2, URL: "https://a/api_jsonrpc.php"},
+		zabbix.ZabbixServer{ID: 3, URL: "https://b/api_jsonrpc.php"},
+	)
+	now := time.Now()
+	r := newDiscoveryRetention(zabbix.DiscoveryConf{RemovalGrace: "5m"})
+	r.now = func() time.Time { return now }
+	onlyB := []zabbix.DiscoveredServer{{URL: "https://b/api_jsonrpc.php", ID: 3}}
+
+	// Пропавший сервер остается в списке с прежним ID
+	assert.Equal(t, map[string]int{
+		"https://a/api_jsonrpc.php": 2,
+		"https://b/api_jsonrpc.php": 3,
+	}, discoveredIDs(r.retain(onlyB, current, static)))
+
+	now = now.Add(4 * time.Minute)
+	assert.Len(t, r.retain(onlyB, current, static), 2)
+
+	// По истечении removal_grace сервер удаляется
+	now = now.Add(time.Minute)
+	assert.Equal(t, map[string]int{"https://b/api_jsonrpc.php": 3}, discoveredIDs(r.retain(onlyB, current, static)))
+	assert.Empty(t, r.missing)
+
+	// Вернувшийся сервер снова отсчитывает срок с начала
+	r.retain(onlyB, current, static)
+	r.retain([]zabbix.DiscoveredServer{{URL: "https://a/api_jsonrpc.php", ID: 2}, onlyB[0]}, current, static)
+	assert.Empty(t, r.missing)
+
+	// Без removal_grace пропавший сервер удаляется сразу
+	immediate := newDiscoveryRetention(zabbix.DiscoveryConf{RemovalGrace: "0"})
+	assert.Len(t, immediate.retain(onlyB, current, static), 1)
+	assert.Equal(t, defaultDiscoveryRemovalGrace, newDiscoveryRetention(zabbix.DiscoveryConf{}).grace)
+}
+
+func TestStartDiscovery_Consul(t *testing.T) {
+	resetDiscoveryIDs(t)
+
+	var (
+		mu       sync.Mutex
+		services = []map[string]any{
+			{"Node": map[string]any{"Address": "10.0.0.1"}, "Service": map[string]any{"Port": 443}},
+		}
+	)
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/health/service/zabbix", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("passing"))
+		assert.Equal(t, "acl", r.Header.Get("X-Consul-Token"))
+		mu.Lock()
+		defer mu.Unlock()
+		json.NewEncoder(w).Encode(services)
+	}))
+	defer consul.Close()
+
+	idsFile := filepath.Join(t.TempDir(), "ids.json")
+	z := ZabbixConf{
+		Servers: []zabbix.ZabbixServer{{ID: 1, URL: "https://static/api_jsonrpc.php"}},
+		Discovery: zabbix.DiscoveryConf{
+			Provider:     "consul",
+			Service:      "zabbix",
+			ConsulAddr:   consul.URL,
+			ConsulToken:  "acl",
+			Token:        "api-token",
+			Interval:     "1",
+			IDsFile:      idsFile,
+			RemovalGrace: "2s",
+		},
+	}
+	prx := InitProxy(Global{MaxRequests: 10}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	var confMu sync.RWMutex
+	stop := prx.StartDiscovery(&confMu)
+	require.NotNil(t, stop)
+	defer stop()
+
+	servers := func() []zabbix.ZabbixServer {
+		confMu.RLock()
+		defer confMu.RUnlock()
+		return append([]zabbix.ZabbixServer(nil), prx.config.Servers...)
+	}
+
+	require.Eventually(t, func() bool { return len(servers()) == 2 }, 3*time.Second, 20*time.Millisecond)
+	added := servers()[1]
+	assert.Equal(t, 2, added.ID)
+	assert.Equal(t, "https://10.0.0.1:443/api_jsonrpc.php", added.URL)
+	assert.Equal(t, "api-token", added.Token)
+	assert.Equal(t, "10.0.0.1:443", added.Name)
+	assert.FileExists(t, idsFile)
+
+	// Сервер пропал из Consul - остается в списке на removal_grace, затем удаляется
+	mu.Lock()
+	services = nil
+	mu.Unlock()
+	removedAt := time.Now()
+	require.Eventually(t, func() bool { return len(servers()) == 1 }, 5*time.Second, 20*time.Millisecond)
+	assert.GreaterOrEqual(t, time.Since(removedAt), time.Second)
+	assert.Equal(t, 1, servers()[0].ID)
+}
+
+func TestStartDiscovery_Disabled(t *testing.T) {
+	prx := InitProxy(Global{MaxRequests: 10}, ZabbixConf{}, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	var confMu sync.Mutex
+	assert.Nil(t, prx.StartDiscovery(&confMu))
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ZabbixAPIproxy/internal/zabbix"
+	"ZabbixAPIproxy/internal/zabbixmock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startMockServers запускает фиктивные серверы Zabbix и возвращает конфиг прокси для них
+func startMockServers(t *testing.T, datasets ...zabbixmock.Dataset) ZabbixConf {
+	t.Helper()
+	var cfg ZabbixConf
+	for _, data := range datasets {
+		url, stop, err := zabbixmock.New(data).Start()
+		require.NoError(t, err)
+		t.Cleanup(stop)
+		cfg.Servers = append(cfg.Servers, zabbix.ZabbixServer{ID: data.ID, URL: url, Token: data.Token})
+	}
+	return cfg
+}
+
+// callProxy отправляет запрос JSON-RPC через обработчик прокси и возвращает результат
+func callProxy(t *testing.T, prx *Proxy, method string, params map[string]any) []any {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": method, "params": params, "id": 1})
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	prx.AuthMiddleware(prx.Handler, "/metrics", "", "", "")(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Nil(t, response["error"])
+	result, _ := response["result"].([]any)
+	return result
+}
+
+// TestEndToEnd_ZabbixMock тестирует преобразование ID и объединение ответов
+// через HTTP клиент Zabbix и фиктивные серверы
+func TestEndToEnd_ZabbixMock(t *testing.T) {
+	shared := map[string]any{"hostid": "10084", "host": "Zabbix server", "name": "Zabbix server"}
+	cfg := startMockServers(t,
+		zabbixmock.Dataset{ID: 1, Token: "token1",
+			Hosts: []map[string]any{shared},
+			Items: []map[string]any{{"itemid": "30001", "hostid": "10084", "name": "CPU"}},
+		},
+		zabbixmock.Dataset{ID: 2, Token: "token2",
+			Hosts: []map[string]any{shared, {"hostid": "10085", "host": "db", "name": "db"}},
+			Items: []map[string]any{
+				{"itemid": "30001", "hostid": "10084", "name": "Memory"},
+				{"itemid": "30002", "hostid": "10085", "name": "Disk"},
+			},
+		},
+	)
+	prx := InitProxy(Global{MaxRequests: 5}, cfg, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.global.maxReqBodySizeInt64 = 1 << 20
+
+	// ID узлов заменены на ProxyID, одноименный узел разных серверов получает один ProxyID
+	hosts := callProxy(t, prx, "host.get", map[string]any{})
+	require.Len(t, hosts, 3)
+	proxyIDs := map[string]any{}
+	for _, h := range hosts {
+		host := h.(map[string]any)
+		assert.NotEqual(t, "10084", host["hostid"])
+		proxyIDs[host["host"].(string)] = host["hostid"]
+	}
+	require.Len(t, proxyIDs, 2)
+
+	// Запрос по ProxyID общего узла получают оба сервера, элементы данных объединяются
+	items := callProxy(t, prx, "item.get", map[string]any{"hostids": []any{proxyIDs["Zabbix server"]}})
+	var names []any
+	itemIDs := map[any]bool{}
+	for _, i := range items {
+		item := i.(map[string]any)
+		names = append(names, item["name"])
+		itemIDs[item["itemid"]] = true
+		assert.Equal(t, proxyIDs["Zabbix server"], item["hostid"])
+	}
+	assert.ElementsMatch(t, []any{"CPU", "Memory"}, names)
+	// Одинаковые ID элементов данных разных серверов различаются после преобразования
+	assert.Len(t, itemIDs, 2)
+
+	// Узел только второго сервера: запрос получает только второй сервер
+	items = callProxy(t, prx, "item.get", map[string]any{"hostids": []any{proxyIDs["db"]}})
+	require.Len(t, items, 1)
+	assert.Equal(t, "Disk", items[0].(map[string]any)["name"])
+}
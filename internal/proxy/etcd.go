@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// etcdElection выборы лидера HA пары через JSON API etcd v3: лидер создает
+// ключ с арендой (lease) и продлевает ее, пока работает. Если лидер не продлил
+// аренду за TTL, ключ удаляется и его захватывает второй узел
+type etcdElection struct {
+	endpoints []string
+	key       string
+	node      string
+	ttl       time.Duration
+	client    *http.Client
+
+	mu    sync.Mutex
+	lease int64 // Аренда ключа лидера, 0 - узел не лидер
+}
+
+// run участвует в выборах до отмены контекста и сообщает о смене роли.
+// Если узел не смог стать активным (setActive вернул false), он уступает
+// лидерство и участвует в выборах снова
+func (e *etcdElection) run(ctx context.Context, setActive func(active bool) bool) {
+	if e.client == nil {
+		// Запрос должен завершиться до истечения аренды
+		e.client = &http.Client{Timeout: e.ttl / 3}
+	}
+
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	leader := false
+	for {
+		if won := e.step(ctx, leader); won != leader {
+			if ctx.Err() != nil {
+				return
+			}
+			if setActive(won) || !won {
+				leader = won
+			} else {
+				e.resign()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// step продлевает аренду лидера или пытается захватить ключ лидера.
+// Возвращает true, если узел является лидером
+func (e *etcdElection) step(ctx context.Context, leader bool) bool {
+	if leader {
+		if err := e.keepAlive(ctx, e.currentLease()); err != nil {
+			logger.Global.Errorf("HA: failed to renew leadership: %v", err)
+			e.setLease(0)
+			return false
+		}
+		return true
+	}
+
+	lease, err := e.grant(ctx)
+	if err != nil {
+		logger.Global.Errorf("HA: etcd lease grant failed: %v", err)
+		return false
+	}
+	won, err := e.campaign(ctx, lease)
+	if err != nil || !won {
+		if err != nil {
+			logger.Global.Errorf("HA: etcd campaign failed: %v", err)
+		}
+		e.revoke(ctx, lease)
+		return false
+	}
+	e.setLease(lease)
+	return true
+}
+
+// resign освобождает ключ лидера, что бы второй узел не ждал истечения аренды
+func (e *etcdElection) resign() {
+	lease := e.currentLease()
+	if lease == 0 {
+		return
+	}
+	e.setLease(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	e.revoke(ctx, lease)
+}
+
+func (e *etcdElection) currentLease() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lease
+}
+
+func (e *etcdElection) setLease(lease int64) {
+	e.mu.Lock()
+	e.lease = lease
+	e.mu.Unlock()
+}
+
+// grant создает аренду с TTL выборов
+func (e *etcdElection) grant(ctx context.Context) (int64, error) {
+	var resp struct {
+		ID    string `json:"ID"`
+		Error string `json:"error"`
+	}
+	if err := e.call(ctx, "/v3/lease/grant", map[string]any{"TTL": int64(e.ttl.Seconds())}, &resp); err != nil {
+		return 0, err
+	}
+	if resp.Error != "" {
+		return 0, fmt.Errorf("%s", resp.Error)
+	}
+	return strconv.ParseInt(resp.ID, 10, 64)
+}
+
+// campaign создает ключ лидера с арендой, если ключа еще нет
+func (e *etcdElection) campaign(ctx context.Context, lease int64) (bool, error) {
+	key := base64.StdEncoding.EncodeToString([]byte(e.key))
+	txn := map[string]any{
+		"compare": []any{map[string]any{"key": key, "target": "CREATE", "result": "EQUAL", "create_revision": "0"}},
+		"success": []any{map[string]any{"request_put": map[string]any{
+			"key":   key,
+			"value": base64.StdEncoding.EncodeToString([]byte(e.node)),
+			"lease": strconv.FormatInt(lease, 10),
+		}}},
+	}
+	var resp struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := e.call(ctx, "/v3/kv/txn", txn, &resp); err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+// keepAlive продлевает аренду лидера
+func (e *etcdElection) keepAlive(ctx context.Context, lease int64) error {
+	var resp struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}
+	if err := e.call(ctx, "/v3/lease/keepalive", map[string]any{"ID": strconv.FormatInt(lease, 10)}, &resp); err != nil {
+		return err
+	}
+	// Истекшая аренда продлевается с TTL 0
+	if ttl, _ := strconv.Atoi(resp.Result.TTL); ttl <= 0 {
+		return fmt.Errorf("lease %d expired", lease)
+	}
+	return nil
+}
+
+// revoke удаляет аренду вместе с ключом лидера
+func (e *etcdElection) revoke(ctx context.Context, lease int64) {
+	if err := e.call(ctx, "/v3/lease/revoke", map[string]any{"ID": strconv.FormatInt(lease, 10)}, nil); err != nil {
+		logger.Global.Warningf("HA: failed to revoke etcd lease %d: %v", lease, err)
+	}
+}
+
+// call выполняет запрос к первому доступному endpoint etcd
+func (e *etcdElection) call(ctx context.Context, path string, body any, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, endpoint := range e.endpoints {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+path, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := e.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("etcd %s HTTP %d: %s", endpoint, resp.StatusCode, strings.TrimSpace(string(respBody)))
+			continue
+		}
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(respBody, out)
+	}
+	return lastErr
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"maps"
+)
+
+// Метод подтверждения событий (проблем)
+const eventAcknowledge = "event.acknowledge"
+
+// normalizeAcknowledge приводит eventids запроса event.acknowledge к списку: Zabbix
+// принимает и один ID, а запрос по ID направляется серверам только по спискам ID.
+// Так подтверждение по ProxyID события получает только исходный сервер события
+func normalizeAcknowledge(request map[string]any) map[string]any {
+	if method, _ := request["method"].(string); method != eventAcknowledge {
+		return request
+	}
+	params, ok := request["params"].(map[string]any)
+	if !ok {
+		return request
+	}
+	switch v := params["eventids"].(type) {
+	case string, float64:
+		normalized := maps.Clone(request)
+		params = maps.Clone(params)
+		params["eventids"] = []any{v}
+		normalized["params"] = params
+		return normalized
+	}
+	return request
+}
+
+// acknowledgedEventIDs заменяет оригинальные ID подтвержденных событий в ответе
+// event.acknowledge сервера serverID на ProxyID, по которым клиент их получил
+func acknowledgedEventIDs(method string, result any, serverID int) {
+	if method != eventAcknowledge {
+		return
+	}
+	m, ok := result.(map[string]any)
+	if !ok {
+		return
+	}
+	ids, ok := m["eventids"].([]any)
+	if !ok {
+		return
+	}
+	for i, id := range ids {
+		ids[i] = simpleModifyID(id, serverID)
+	}
+}
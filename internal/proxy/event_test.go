@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProcessAllServers_EventAcknowledge тестирует подтверждение событий только на исходных серверах
+func TestProcessAllServers_EventAcknowledge(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	var mu sync.Mutex
+	sent := map[string]any{}
+	mockClient := testProxy.GetMockClient()
+	mockClient.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		eventIDs := request["params"].(map[string]any)["eventids"].([]any)
+		sent[url] = eventIDs
+		return map[string]any{"result": map[string]any{"eventids": slices.Clone(eventIDs)}}, nil
+	}
+	testProxy.Init(Global{MaxRequests: 5}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	// Один ID события: подтверждение получает только сервер события
+	request := map[string]any{"jsonrpc": "2.0", "method": "event.acknowledge", "id": 1, "params": map[string]any{"eventids": "1231", "action": 6, "message": "NOC"}}
+	results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-ack")
+	require.Empty(t, errors)
+	assert.Equal(t, map[string]any{"http://server1.com": []any{123}}, sent)
+	assert.Equal(t, map[string]any{"eventids": []any{1231}}, results)
+	assert.Equal(t, "1231", request["params"].(map[string]any)["eventids"], "client request is not modified")
+
+	// События разных серверов: ID ответов серверов объединяются
+	sent = map[string]any{}
+	request = map[string]any{"jsonrpc": "2.0", "method": "event.acknowledge", "id": 2, "params": map[string]any{"eventids": []any{"1231", "4562"}, "action": 2}}
+	results, errors = testProxy.processAllServersWithMock(context.Background(), request, "test-ack-multi")
+	require.Empty(t, errors)
+	assert.Len(t, sent, 2)
+	assert.NotContains(t, sent, "http://server3.com")
+	assert.ElementsMatch(t, []any{1231, 4562}, results.(map[string]any)["eventids"])
+}
+
+// TestNormalizeAcknowledge тестирует приведение eventids к списку
+func TestNormalizeAcknowledge(t *testing.T) {
+	request := map[string]any{"method": "event.acknowledge", "params": map[string]any{"eventids": float64(1231)}}
+	assert.Equal(t, []any{float64(1231)}, normalizeAcknowledge(request)["params"].(map[string]any)["eventids"])
+
+	request = map[string]any{"method": "event.get", "params": map[string]any{"eventids": "1231"}}
+	assert.Equal(t, "1231", normalizeAcknowledge(request)["params"].(map[string]any)["eventids"])
+}
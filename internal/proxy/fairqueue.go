@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const clientKey ctxKey = "client"
+
+// fairWaiter запрос, ожидающий слот семафора
+type fairWaiter struct {
+	ready chan struct{}
+}
+
+// fairSemaphore распределяет слоты общего семафора запросов между клиентами
+// по очереди (round-robin по очередям клиентов), что бы один активный клиент
+// не занимал все слоты при достижении max_requests
+type fairSemaphore struct {
+	mu  sync.Mutex
+	sem chan struct{}
+	// Очереди ожидающих запросов по клиентам
+	queues map[string][]*fairWaiter
+	// Клиенты с ожидающими запросами в порядке обслуживания
+	order []string
+	next  int
+}
+
+func newFairSemaphore(sem chan struct{}) *fairSemaphore {
+	return &fairSemaphore{sem: sem, queues: make(map[string][]*fairWaiter)}
+}
+
+// acquire занимает слот для запроса клиента, ожидая своей очереди до отмены контекста
+func (s *fairSemaphore) acquire(ctx context.Context, client string) error {
+	s.mu.Lock()
+	// Без очереди слот занимается сразу
+	if len(s.order) == 0 {
+		select {
+		case s.sem <- struct{}{}:
+			s.mu.Unlock()
+			return nil
+		default:
+		}
+	}
+
+	w := &fairWaiter{ready: make(chan struct{})}
+	if len(s.queues[client]) == 0 {
+		s.order = append(s.order, client)
+	}
+	s.queues[client] = append(s.queues[client], w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		removed := s.remove(client, w)
+		s.mu.Unlock()
+		// Слот был передан одновременно с отменой, возвращаем его
+		if !removed {
+			s.release()
+		}
+		return ctx.Err()
+	}
+}
+
+// release освобождает слот или передает его следующему клиенту в очереди
+func (s *fairSemaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.order) == 0 {
+		<-s.sem
+		return
+	}
+
+	if s.next >= len(s.order) {
+		s.next = 0
+	}
+	client := s.order[s.next]
+	w := s.queues[client][0]
+	s.queues[client] = s.queues[client][1:]
+	if len(s.queues[client]) == 0 {
+		delete(s.queues, client)
+		s.order = append(s.order[:s.next], s.order[s.next+1:]...)
+	} else {
+		s.next++
+	}
+	// Слот остается занятым и переходит ожидающему запросу
+	close(w.ready)
+}
+
+// remove удаляет ожидающий запрос из очереди клиента. Возвращает false,
+// если запроса в очереди уже нет (слот передан)
+func (s *fairSemaphore) remove(client string, w *fairWaiter) bool {
+	queue := s.queues[client]
+	for i, qw := range queue {
+		if qw != w {
+			continue
+		}
+		s.queues[client] = append(queue[:i], queue[i+1:]...)
+		if len(s.queues[client]) == 0 {
+			delete(s.queues, client)
+			for j, c := range s.order {
+				if c == client {
+					s.order = append(s.order[:j], s.order[j+1:]...)
+					if j < s.next {
+						s.next--
+					}
+					break
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// waiting возвращает количество ожидающих запросов
+func (s *fairSemaphore) waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, q := range s.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// requestClient определяет клиента запроса для справедливой очереди:
+// клиент JWT или LDAP, токен из заголовка или запроса, логин Basic авторизации
+// или адрес клиента
+func requestClient(r *http.Request, request map[string]any) string {
+	if p := principalFromContext(r.Context()); p != nil {
+		return "principal:" + p.name
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		return "token:" + token
+	}
+	// Токен, выданный прокси на user.login, одинаков у всех клиентов
+	if auth, ok := request["auth"].(string); ok && auth != "" && auth != loginToken {
+		return "token:" + auth
+	}
+	if login, _, ok := r.BasicAuth(); ok {
+		return "login:" + login
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// withClient сохраняет клиента запроса в контексте
+func withClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey, client)
+}
+
+// clientFromContext возвращает клиента запроса (пусто, если не определен)
+func clientFromContext(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey).(string)
+	return client
+}
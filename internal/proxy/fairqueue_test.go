@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFairSemaphore_RoundRobin тестирует поочередную выдачу слотов клиентам
+func TestFairSemaphore_RoundRobin(t *testing.T) {
+	s := newFairSemaphore(make(chan struct{}, 1))
+	require.NoError(t, s.acquire(context.Background(), "chatty"))
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	enqueue := func(client string) {
+		queued := s.waiting()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, s.acquire(context.Background(), client))
+			mu.Lock()
+			order = append(order, client)
+			mu.Unlock()
+			s.release()
+		}()
+		// Ставим запросы в очередь строго по порядку
+		require.Eventually(t, func() bool { return s.waiting() == queued+1 }, time.Second, time.Millisecond)
+	}
+
+	enqueue("chatty")
+	enqueue("chatty")
+	enqueue("chatty")
+	enqueue("quiet")
+
+	s.release()
+	wg.Wait()
+
+	assert.Equal(t, []string{"chatty", "quiet", "chatty", "chatty"}, order)
+	assert.Equal(t, 0, len(s.sem))
+}
+
+// TestFairSemaphore_Cancel тестирует отмену ожидания слота
+func TestFairSemaphore_Cancel(t *testing.T) {
+	s := newFairSemaphore(make(chan struct{}, 1))
+	require.NoError(t, s.acquire(context.Background(), "a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.acquire(ctx, "b"), context.DeadlineExceeded)
+	assert.Equal(t, 0, s.waiting())
+	assert.Empty(t, s.order)
+
+	// Слот освобождается, а не передается отмененному запросу
+	s.release()
+	assert.Equal(t, 0, len(s.sem))
+	require.NoError(t, s.acquire(context.Background(), "b"))
+}
+
+// TestRequestClient тестирует определение клиента запроса
+func TestRequestClient(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	assert.Equal(t, "addr:10.0.0.1", requestClient(r, map[string]any{}))
+	assert.Equal(t, "addr:10.0.0.1", requestClient(r, map[string]any{"auth": loginToken}))
+	assert.Equal(t, "token:abc", requestClient(r, map[string]any{"auth": "abc"}))
+
+	r.SetBasicAuth("grafana", "secret")
+	assert.Equal(t, "login:grafana", requestClient(r, map[string]any{}))
+
+	r.Header.Set("Authorization", "Bearer xyz")
+	assert.Equal(t, "token:xyz", requestClient(r, map[string]any{"auth": "abc"}))
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"strings"
+)
+
+// applyDropFields удаляет из объединенного результата поля, заданные в drop_fields для метода.
+// Путь поля задается через точку, например "hosts.description" удалит description
+// у каждого элемента вложенного массива hosts.
+func (prx *Proxy) applyDropFields(method string, data any) any {
+	paths, ok := prx.global.DropFields[method]
+	if !ok || len(paths) == 0 {
+		return data
+	}
+	for _, path := range paths {
+		dropField(data, strings.Split(path, "."))
+	}
+	return data
+}
+
+// dropField рекурсивно удаляет поле по пути из map или каждого элемента массива
+func dropField(data any, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	switch v := data.(type) {
+	case []any:
+		for _, item := range v {
+			dropField(item, path)
+		}
+	case map[string]any:
+		if len(path) == 1 {
+			delete(v, path[0])
+			return
+		}
+		if nested, ok := v[path[0]]; ok {
+			dropField(nested, path[1:])
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestApplyDropFields тестирует удаление полей из результата по конфигу drop_fields
+func TestApplyDropFields(t *testing.T) {
+	prx := &Proxy{global: Global{DropFields: map[string][]string{
+		"item.get":    {"description"},
+		"trigger.get": {"expression", "hosts.description"},
+	}}}
+
+	t.Run("top level field", func(t *testing.T) {
+		data := []any{
+			map[string]any{"itemid": "1", "description": "long text"},
+			map[string]any{"itemid": "2"},
+		}
+		result := prx.applyDropFields("item.get", data).([]any)
+		assert.Equal(t, map[string]any{"itemid": "1"}, result[0])
+		assert.Equal(t, map[string]any{"itemid": "2"}, result[1])
+	})
+
+	t.Run("nested field", func(t *testing.T) {
+		data := []any{
+			map[string]any{
+				"triggerid":  "1",
+				"expression": "last(/host/key)>0",
+				"hosts": []any{
+					map[string]any{"hostid": "10", "description": "host text"},
+				},
+			},
+		}
+		result := prx.applyDropFields("trigger.get", data).([]any)
+		trigger := result[0].(map[string]any)
+		assert.NotContains(t, trigger, "expression")
+		assert.Equal(t, map[string]any{"hostid": "10"}, trigger["hosts"].([]any)[0])
+	})
+
+	t.Run("method without config is untouched", func(t *testing.T) {
+		data := []any{map[string]any{"hostid": "1", "description": "keep"}}
+		result := prx.applyDropFields("host.get", data).([]any)
+		assert.Equal(t, "keep", result[0].(map[string]any)["description"])
+	})
+}
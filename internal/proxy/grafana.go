@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	defaultVariablesTTL        = 5 * time.Minute
+	defaultVariablesMaxEntries = 500
+)
+
+// GrafanaVariablesConf настройки POST /grafana/variables
+type GrafanaVariablesConf struct {
+	TTL        string `yaml:"ttl"`         // Время хранения списка, по умолчанию 5m
+	MaxEntries int    `yaml:"max_entries"` // Максимум хранимых списков, по умолчанию 500
+}
+
+// variablesQuery упрощенный запрос списка значений переменной Grafana:
+// тип сущности (host, group) и шаблон имени (* - любые символы)
+type variablesQuery struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// variableValue значение переменной: имя сущности и ее ProxyID
+type variableValue struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// variableStore хранит объединенные списки значений переменных. Одинаковые
+// одновременные запросы (загрузка дашборда многими пользователями) выполняются один раз
+type variableStore struct {
+	lists *pageStore
+	group *requestGroup
+}
+
+// newVariableStore создает хранилище списков переменных
+func newVariableStore(cfg GrafanaVariablesConf) *variableStore {
+	ttl := defaultVariablesTTL
+	if cfg.TTL != "" {
+		if s, err := suffix.ToSeconds(cfg.TTL); err != nil || s == 0 {
+			logger.Global.Errorf("invalid 'grafana_variables.ttl' %s, using %v", cfg.TTL, defaultVariablesTTL)
+		} else {
+			ttl = time.Duration(s) * time.Second
+		}
+	}
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultVariablesMaxEntries
+	}
+
+	return &variableStore{
+		lists: &pageStore{ttl: ttl, maxSets: maxEntries, sets: make(map[string]*pageSet), now: time.Now},
+		group: newRequestGroup(),
+	}
+}
+
+// ServeGrafanaVariables обрабатывает POST /grafana/variables с телом {"type": "host", "name": "web*"}
+// и возвращает объединенные со всех серверов пары имя/ProxyID без повторов. Запрос
+// преобразуется в host.get (hostgroup.get) и проходит ту же авторизацию, что и запросы API,
+// а результат хранится grafana_variables.ttl
+func (prx *Proxy) ServeGrafanaVariables(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, status, err := readRequestBody(r, prx.global.maxReqBodySizeInt64)
+	if err != nil {
+		logger.Global.Errorf("Error reading variables query: %v", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	var query variablesQuery
+	if err := json.Unmarshal(body, &query); err != nil {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": "invalid JSON: " + err.Error()})
+		return
+	}
+	request, err := prx.variablesRequest(query)
+	if err != nil {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": err.Error()})
+		return
+	}
+
+	// Авторизация, проверка разрешенных методов и режим HA - как у запроса API
+	rpcBody, _ := json.Marshal(request)
+	r.Body = io.NopCloser(bytes.NewReader(rpcBody))
+	r.ContentLength = int64(len(rpcBody))
+	r.Header.Del("Content-Encoding")
+	g := prx.global
+	prx.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		prx.variablesHandler(w, r, query, request)
+	}, g.MetricPath, g.Login, g.AuthPassword(), g.Token)(w, r)
+}
+
+// variablesRequest строит запрос списка сущностей по упрощенному запросу
+func (prx *Proxy) variablesRequest(query variablesQuery) (map[string]any, error) {
+	method, ok := entityGetMethods[query.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown type '%s', expected one of %v", query.Type, slices.Sorted(maps.Keys(entityGetMethods)))
+	}
+	nameField := cmp.Or(prx.cachedFields[query.Type], "name")
+
+	params := map[string]any{"output": []any{query.Type + "id", nameField}}
+	if query.Name != "" && query.Name != "*" {
+		params["search"] = map[string]any{nameField: query.Name}
+		params["searchWildcardsEnabled"] = true
+	}
+	return map[string]any{"jsonrpc": "2.0", "method": method, "params": params, "id": 1}, nil
+}
+
+// variablesHandler возвращает список значений переменной из хранилища или запрашивает его у серверов
+func (prx *Proxy) variablesHandler(w http.ResponseWriter, r *http.Request, query variablesQuery, request map[string]any) {
+	ctx := r.Context()
+	trace_id, _ := ctx.Value(traceIDKey).(string)
+	log := logger.WithContext(ctx)
+	store := prx.variables
+
+	key := query.Type + "\x00" + query.Name + principalFromContext(ctx).scope()
+	if values, ok := store.lists.get(key); ok {
+		log.Debugf("Variables %s '%s' served from cache", query.Type, query.Name)
+		writeVariables(w, query, values, true, nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(prx.global.maxTimeoutInt64)*time.Second)
+	defer cancel()
+	ctx = withClient(ctx, requestClient(r, request))
+
+	results, errors, _ := store.group.do(ctx, key, func(ctx context.Context) (any, []string) {
+		results, errors := prx.processAllServers(ctx, request, trace_id)
+		values := variableValues(results, query.Type+"id", cmp.Or(prx.cachedFields[query.Type], "name"))
+		// Неполный список (часть серверов не ответила) не сохраняется
+		if len(errors) == 0 {
+			store.lists.put(key, values)
+		}
+		return values, errors
+	})
+	values, _ := results.([]any)
+
+	if len(values) == 0 && len(errors) > 0 {
+		log.Errorf("Variables %s '%s': all requests failed: %v", query.Type, query.Name, errors)
+		writeAdminResponse(w, http.StatusBadGateway, map[string]any{"status": "error", "error": "all upstream requests failed", "errors": errors})
+		return
+	}
+	log.Infof("Variables %s '%s': %d values", query.Type, query.Name, len(values))
+	writeVariables(w, query, values, false, errors)
+}
+
+// variableValues извлекает из объединенного результата пары имя/ProxyID без повторов,
+// отсортированные по имени
+func variableValues(results any, idField, nameField string) []any {
+	items, _ := results.([]any)
+	seen := make(map[variableValue]bool, len(items))
+	values := make([]variableValue, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := m[nameField].(string)
+		v := variableValue{Name: name, ID: fmt.Sprint(m[idField])}
+		if m[idField] == nil || seen[v] {
+			continue
+		}
+		seen[v] = true
+		values = append(values, v)
+	}
+	slices.SortFunc(values, func(a, b variableValue) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.ID, b.ID))
+	})
+
+	list := make([]any, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return list
+}
+
+// writeVariables отправляет список значений переменной
+func writeVariables(w http.ResponseWriter, query variablesQuery, values []any, cached bool, errors []string) {
+	body := map[string]any{
+		"status": "OK",
+		"type":   query.Type,
+		"name":   query.Name,
+		"cached": cached,
+		"count":  len(values),
+		"data":   values,
+	}
+	if len(errors) > 0 {
+		body["errors"] = errors
+	}
+	writeAdminResponse(w, http.StatusOK, body)
+}
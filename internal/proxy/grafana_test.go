@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServeGrafanaVariables тестирует объединенные списки значений переменных Grafana
+func TestServeGrafanaVariables(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{
+		{URL: "http://server1.com", ID: 1, Token: "token1"},
+		{URL: "http://server2.com", ID: 2, Token: "token2"},
+	}}
+	prx := testProxy.Init(Global{MaxRequests: 5, Token: "secret"}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	mock := testProxy.GetMockClient()
+	mock.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		result := []any{
+			map[string]any{"hostid": "10001", "name": "web1"},
+			map[string]any{"hostid": "10002", "name": "db1"},
+		}
+		if url == "http://server2.com" {
+			result = []any{
+				map[string]any{"hostid": "20001", "name": "web1"},
+				map[string]any{"hostid": "20002", "name": "web2"},
+			}
+		}
+		return map[string]any{"jsonrpc": "2.0", "result": result, "id": request["id"]}, nil
+	}
+	prx.zbxClient = mock
+
+	send := func(method, body, token string) (*httptest.ResponseRecorder, map[string]any) {
+		req := httptest.NewRequest(method, "/grafana/variables", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		prx.ServeGrafanaVariables(w, req)
+		var response map[string]any
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	w, response := send("POST", `{"type":"host","name":"*"}`, "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, false, response["cached"])
+	data := response["data"].([]any)
+	require.Len(t, data, 3, "same-named hosts of different servers are merged")
+	names := make([]string, len(data))
+	for i, v := range data {
+		names[i] = v.(map[string]any)["name"].(string)
+		assert.NotEmpty(t, v.(map[string]any)["id"])
+	}
+	assert.Equal(t, []string{"db1", "web1", "web2"}, names)
+	params := mock.LastRequest["params"].(map[string]any)
+	assert.NotContains(t, params, "search", "* matches all names without search")
+
+	// Повторный запрос выдается из хранилища без запросов к серверам
+	calls := mock.CallCount
+	w, response = send("POST", `{"type":"host","name":"*"}`, "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, response["cached"])
+	assert.Len(t, response["data"], 3)
+	assert.Equal(t, calls, mock.CallCount)
+
+	// Шаблон имени передается серверам как поиск с подстановкой
+	w, _ = send("POST", `{"type":"host","name":"web*"}`, "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	params = mock.LastRequest["params"].(map[string]any)
+	assert.Equal(t, map[string]any{"name": "web*"}, params["search"])
+	assert.Equal(t, true, params["searchWildcardsEnabled"])
+
+	w, response = send("POST", `{"type":"item","name":"*"}`, "secret")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, response["error"], "unknown type")
+
+	w, _ = send("POST", `{"type":"host"}`, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w, _ = send("GET", "", "secret")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
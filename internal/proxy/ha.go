@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	haRoleActive  = "active"
+	haRolePassive = "passive"
+
+	defaultHAKey         = "/zabbix-api-proxy/leader"
+	defaultHATTL         = 10 * time.Second
+	defaultHAOpenTimeout = 5 * time.Second
+)
+
+// HAConf настройки пары active/passive (warm standby). Узлы используют общий
+// файл кеша (cache.db_path на общем томе) или пассивный узел копирует его с
+// активного (peer). Пассивный узел не открывает кеш и отвечает 503 на /ready
+// и запросы API, пока не станет активным
+type HAConf struct {
+	Role string `yaml:"role"` // Роль при запуске: active или passive, пусто - HA отключен
+	// Ожидание освобождения файла кеша прежним активным узлом при переходе в active,
+	// по умолчанию 5s. Если файл не освободился, узел остается пассивным
+	OpenTimeout string `yaml:"open_timeout"`
+
+	// Репликация кеша без общего тома: пассивный узел каждые sync_interval
+	// (по умолчанию 30s) копирует файл кеша с peer (адрес второго узла пары),
+	// авторизуясь токеном peer_token его служебных эндпоинтов
+	Peer         string `yaml:"peer"`
+	PeerToken    string `yaml:"peer_token"`
+	SyncInterval string `yaml:"sync_interval"`
+
+	// Выборы лидера через etcd. Если заданы, роль определяется выборами,
+	// ручное переключение через /admin/ha недоступно
+	Etcd EtcdElectionConf `yaml:"etcd"`
+}
+
+// EtcdElectionConf настройки выборов лидера через etcd (JSON API v3)
+type EtcdElectionConf struct {
+	Endpoints []string `yaml:"endpoints"`
+	Key       string   `yaml:"key"`     // По умолчанию /zabbix-api-proxy/leader
+	TTL       string   `yaml:"ttl"`     // TTL аренды лидера, по умолчанию 10s
+	NodeID    string   `yaml:"node_id"` // По умолчанию имя хоста
+}
+
+// haState состояние узла. Не зависит от prx и сохраняется при перезагрузке конфига
+var haState struct {
+	mu       sync.Mutex
+	enabled  bool
+	started  bool // Начальная роль уже применена
+	active   bool
+	election bool
+	// Ожидание блокировки файла кеша при переходе в active
+	openTimeout time.Duration
+}
+
+// initHA применяет настройки HA. Начальная роль применяется только при первом
+// запуске: при перезагрузке конфига узел сохраняет текущую роль
+func initHA(cfg HAConf) {
+	haState.mu.Lock()
+	defer haState.mu.Unlock()
+
+	haState.election = len(cfg.Etcd.Endpoints) > 0
+	haState.openTimeout = defaultHAOpenTimeout
+	if cfg.OpenTimeout != "" {
+		if s, err := suffix.ToSeconds(cfg.OpenTimeout); err != nil || s == 0 {
+			logger.Global.Errorf("invalid 'ha.open_timeout' %s, using %v", cfg.OpenTimeout, defaultHAOpenTimeout)
+		} else {
+			haState.openTimeout = time.Duration(s) * time.Second
+		}
+	}
+	switch cfg.Role {
+	case "":
+		haState.enabled, haState.started, haState.active = false, false, true
+		return
+	case haRoleActive, haRolePassive:
+	default:
+		logger.Global.Errorf("unknown ha.role '%s', using '%s'", cfg.Role, haRolePassive)
+		cfg.Role = haRolePassive
+	}
+
+	haState.enabled = true
+	if !haState.started {
+		haState.started = true
+		// До выборов узел всегда пассивен, что бы не было двух активных
+		haState.active = cfg.Role == haRoleActive && !haState.election
+		logger.Global.Infof("HA mode enabled, node is %s", haRoleName(haState.active))
+	}
+}
+
+func haRoleName(active bool) string {
+	if active {
+		return haRoleActive
+	}
+	return haRolePassive
+}
+
+// IsReady возвращает true, если узел обслуживает запросы (HA отключен или узел активен)
+func IsReady() bool {
+	haState.mu.Lock()
+	defer haState.mu.Unlock()
+	return !haState.enabled || haState.active
+}
+
+// HAStatus состояние узла HA пары
+type HAStatus struct {
+	Enabled  bool
+	Active   bool
+	Election bool
+}
+
+// GetHAStatus возвращает состояние узла HA пары
+func GetHAStatus() HAStatus {
+	haState.mu.Lock()
+	defer haState.mu.Unlock()
+	return HAStatus{Enabled: haState.enabled, Active: haState.active, Election: haState.election}
+}
+
+// setHAActive переводит узел в active или passive. Фоновые задачи перед сменой
+// роли завершаются. При переходе в active открывается кеш, сохраненный прежним
+// активным узлом (если он не освободил файл за ha.open_timeout, узел остается
+// пассивным), при переходе в passive кеш сохраняется и закрывается, и узел
+// начинает копировать кеш с ha.peer. Вызывается под блокировкой конфигурации
+func (prx *Proxy) setHAActive(active bool) error {
+	haState.mu.Lock()
+	defer haState.mu.Unlock()
+
+	if !haState.enabled {
+		return fmt.Errorf("HA mode is disabled")
+	}
+	if haState.active == active {
+		return nil
+	}
+
+	// Фоновые задачи читают кеш без блокировки конфигурации, а репликация кеша
+	// заменяет его файл, поэтому задачи прерываются и завершаются до открытия
+	// или закрытия кеша (как при перезагрузке конфига)
+	prx.background.stop()
+	prx.background = newBackgroundTasks()
+
+	if active {
+		// Прежний активный узел может еще удерживать файл кеша: ожидание ограничено,
+		// что бы не блокировать запросы под блокировкой конфигурации
+		if err := prx.startCache(haState.openTimeout); err != nil {
+			prx.startHASync()
+			return fmt.Errorf("node stays %s: %w", haRolePassive, err)
+		}
+	} else {
+		if prx.stopReconcile != nil {
+			prx.stopReconcile()
+			prx.stopReconcile = nil
+		}
+		prx.StopCacheDB()
+		prx.cache = nil
+		prx.startHASync()
+	}
+	haState.active = active
+	logger.Global.Warningf("HA: node is now %s", haRoleName(active))
+	return nil
+}
+
+// ReadyHandler обрабатывает /ready: 200 для активного узла, 503 для пассивного
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	if !IsReady() {
+		status = http.StatusServiceUnavailable
+	}
+	st := GetHAStatus()
+	role := haRoleName(st.Active)
+	if !st.Enabled {
+		role = "standalone"
+	}
+	writeAdminResponse(w, status, map[string]any{"status": http.StatusText(status), "role": role})
+}
+
+// AdminHAHandler обрабатывает POST /admin/ha?action=promote|demote.
+// Должен вызываться под блокировкой конфигурации на запись
+func (prx *Proxy) AdminHAHandler(w http.ResponseWriter, r *http.Request) {
+	if GetHAStatus().Election {
+		writeAdminResponse(w, http.StatusConflict, map[string]any{"status": "error", "error": "role is managed by etcd leader election"})
+		return
+	}
+
+	var err error
+	switch action := r.URL.Query().Get("action"); action {
+	case "promote":
+		err = prx.setHAActive(true)
+	case "demote":
+		err = prx.setHAActive(false)
+	default:
+		err = fmt.Errorf("unknown action '%s', expected promote or demote", action)
+	}
+	if err != nil {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": err.Error()})
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, map[string]any{"status": "OK", "role": haRoleName(GetHAStatus().Active)})
+}
+
+// StartHA запускает выборы лидера через etcd, если они настроены.
+// Смена роли выполняется под locker, что бы не пересекаться с перезагрузкой конфига
+func (prx *Proxy) StartHA(locker sync.Locker) context.CancelFunc {
+	locker.Lock()
+	cfg := prx.global.HA
+	locker.Unlock()
+
+	if cfg.Role == "" || len(cfg.Etcd.Endpoints) == 0 {
+		return nil
+	}
+
+	ttl := defaultHATTL
+	if cfg.Etcd.TTL != "" {
+		if s, err := suffix.ToSeconds(cfg.Etcd.TTL); err != nil || s < 2 {
+			logger.Global.Errorf("invalid 'ha.etcd.ttl' %s, using %v", cfg.Etcd.TTL, defaultHATTL)
+		} else {
+			ttl = time.Duration(s) * time.Second
+		}
+	}
+	key := cfg.Etcd.Key
+	if key == "" {
+		key = defaultHAKey
+	}
+	node := cfg.Etcd.NodeID
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+
+	election := &etcdElection{endpoints: cfg.Etcd.Endpoints, key: key, node: node, ttl: ttl}
+	ctx, cancel := context.WithCancel(context.Background())
+	go election.run(ctx, func(active bool) bool {
+		locker.Lock()
+		defer locker.Unlock()
+		// Выборы могли быть остановлены, пока ожидалась блокировка
+		if ctx.Err() != nil {
+			return false
+		}
+		if err := prx.setHAActive(active); err != nil {
+			logger.Global.Errorf("HA: failed to change role: %v", err)
+			return false
+		}
+		return true
+	})
+	logger.Global.Infof("HA: leader election started (etcd key %s, node %s, ttl %v)", key, node, ttl)
+
+	// Остановка может вызываться под locker, поэтому не ждет завершения выборов
+	return func() {
+		cancel()
+		election.resign()
+	}
+}
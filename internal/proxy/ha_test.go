@@ -0,0 +1,252 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+// TestHA_PromoteDemote тестирует ручное переключение роли узла
+func TestHA_PromoteDemote(t *testing.T) {
+	g := Global{MaxRequests: 10, HA: HAConf{Role: haRolePassive}}
+	prx := InitProxy(g, ZabbixConf{}, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer func() {
+		cleanupTestProxy(prx)
+		initHA(HAConf{})
+	}()
+
+	// Пассивный узел не открывает кеш и не готов
+	assert.False(t, IsReady())
+	assert.Nil(t, prx.cache)
+
+	ready := httptest.NewRecorder()
+	ReadyHandler(ready, httptest.NewRequest("GET", "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, ready.Code)
+
+	api := httptest.NewRecorder()
+	prx.AuthMiddleware(prx.Handler, "/metrics", "", "", "")(api, httptest.NewRequest("POST", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, api.Code)
+
+	admin := httptest.NewRecorder()
+	prx.AdminHAHandler(admin, httptest.NewRequest("POST", "/admin/ha?action=promote", nil))
+	require.Equal(t, http.StatusOK, admin.Code)
+	assert.True(t, IsReady())
+	assert.NotNil(t, prx.cache)
+
+	// Перезагрузка конфига сохраняет текущую роль
+	prx.Stop()
+	prx = InitProxy(g, ZabbixConf{}, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	assert.True(t, IsReady())
+	assert.NotNil(t, prx.cache)
+
+	// Фоновая задача, использующая кеш, завершается до его закрытия
+	bgStarted, bgFinished := make(chan struct{}), make(chan struct{})
+	require.True(t, prx.background.start(func(ctx context.Context) {
+		close(bgStarted)
+		<-ctx.Done()
+		close(bgFinished)
+	}))
+	<-bgStarted
+
+	admin = httptest.NewRecorder()
+	prx.AdminHAHandler(admin, httptest.NewRequest("POST", "/admin/ha?action=demote", nil))
+	require.Equal(t, http.StatusOK, admin.Code)
+	assert.False(t, IsReady())
+	assert.Nil(t, prx.cache)
+	select {
+	case <-bgFinished:
+	default:
+		t.Fatal("background task is still running after demote")
+	}
+	// После перехода в passive фоновые задачи снова запускаются
+	assert.True(t, prx.background.start(func(ctx context.Context) {}))
+
+	admin = httptest.NewRecorder()
+	prx.AdminHAHandler(admin, httptest.NewRequest("POST", "/admin/ha?action=restart", nil))
+	assert.Equal(t, http.StatusBadRequest, admin.Code)
+}
+
+// TestHA_PromoteLockedCache тестирует, что узел остается пассивным, если прежний
+// активный узел не освободил файл кеша за ha.open_timeout
+func TestHA_PromoteLockedCache(t *testing.T) {
+	cacheCfg := initTestCache()
+	cacheCfg.DBPath = filepath.Join(t.TempDir(), "cache.db")
+	g := Global{MaxRequests: 10, HA: HAConf{Role: haRolePassive, OpenTimeout: "1s"}}
+	prx := InitProxy(g, ZabbixConf{}, CBConf{}, CacheConf(cacheCfg), ExcludeMethods{})
+	defer func() {
+		prx.Stop()
+		initHA(HAConf{})
+	}()
+
+	// Файл кеша удерживает прежний активный узел
+	held, err := bbolt.Open(cacheCfg.DBPath, 0600, nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	assert.Error(t, prx.setHAActive(true))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.False(t, IsReady())
+	assert.Nil(t, prx.cache)
+
+	// После освобождения файла узел становится активным
+	require.NoError(t, held.Close())
+	require.NoError(t, prx.setHAActive(true))
+	assert.True(t, IsReady())
+	assert.NotNil(t, prx.cache)
+}
+
+// TestHA_Disabled тестирует узел без HA
+func TestHA_Disabled(t *testing.T) {
+	initHA(HAConf{})
+	assert.True(t, IsReady())
+	assert.Error(t, (&Proxy{}).setHAActive(false))
+
+	ready := httptest.NewRecorder()
+	ReadyHandler(ready, httptest.NewRequest("GET", "/ready", nil))
+	assert.Equal(t, http.StatusOK, ready.Code)
+
+	var body map[string]any
+	require.NoError(t, json.NewDecoder(ready.Body).Decode(&body))
+	assert.Equal(t, "standalone", body["role"])
+}
+
+// fakeEtcd минимальная реализация JSON API etcd v3 для выборов лидера
+type fakeEtcd struct {
+	mu        sync.Mutex
+	nextLease int64
+	leases    map[int64]bool
+	owner     int64 // Аренда ключа лидера, 0 - ключа нет
+	value     string
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var req map[string]any
+	json.NewDecoder(r.Body).Decode(&req)
+	leaseID := func(v any) int64 {
+		id, _ := strconv.ParseInt(v.(string), 10, 64)
+		return id
+	}
+
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		f.nextLease++
+		f.leases[f.nextLease] = true
+		json.NewEncoder(w).Encode(map[string]any{"ID": strconv.FormatInt(f.nextLease, 10), "TTL": "3"})
+	case "/v3/kv/txn":
+		if f.owner != 0 {
+			json.NewEncoder(w).Encode(map[string]any{"succeeded": false})
+			return
+		}
+		put := req["success"].([]any)[0].(map[string]any)["request_put"].(map[string]any)
+		value, _ := base64.StdEncoding.DecodeString(put["value"].(string))
+		f.owner, f.value = leaseID(put["lease"]), string(value)
+		json.NewEncoder(w).Encode(map[string]any{"succeeded": true})
+	case "/v3/lease/keepalive":
+		ttl := "0"
+		if f.leases[leaseID(req["ID"])] {
+			ttl = "3"
+		}
+		json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{"TTL": ttl}})
+	case "/v3/lease/revoke":
+		id := leaseID(req["ID"])
+		delete(f.leases, id)
+		if f.owner == id {
+			f.owner, f.value = 0, ""
+		}
+		json.NewEncoder(w).Encode(map[string]any{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// expire имитирует истечение аренды лидера
+func (f *fakeEtcd) expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.leases, f.owner)
+	f.owner, f.value = 0, ""
+}
+
+// TestEtcdElection тестирует захват, удержание и потерю лидерства
+func TestEtcdElection(t *testing.T) {
+	etcd := &fakeEtcd{leases: make(map[int64]bool)}
+	server := httptest.NewServer(etcd)
+	defer server.Close()
+
+	newNode := func(name string) *etcdElection {
+		return &etcdElection{endpoints: []string{server.URL}, key: defaultHAKey, node: name, ttl: 3 * time.Second, client: server.Client()}
+	}
+	a, b := newNode("a"), newNode("b")
+	ctx := context.Background()
+
+	assert.True(t, a.step(ctx, false))
+	assert.Equal(t, "a", etcd.value)
+	assert.False(t, b.step(ctx, false), "key is held by another node")
+	assert.Len(t, etcd.leases, 1, "lease of the losing node is revoked")
+
+	assert.True(t, a.step(ctx, true), "leader renews its lease")
+
+	// Лидер теряет аренду и уступает ключ
+	etcd.expire()
+	assert.False(t, a.step(ctx, true))
+	assert.Zero(t, a.currentLease())
+	assert.True(t, b.step(ctx, false))
+
+	// Отказ от лидерства освобождает ключ сразу
+	b.resign()
+	assert.Empty(t, etcd.value)
+	assert.True(t, a.step(ctx, false))
+}
+
+// TestEtcdElectionPromoteFailed тестирует, что лидер, не ставший активным,
+// уступает ключ и участвует в выборах снова
+func TestEtcdElectionPromoteFailed(t *testing.T) {
+	etcd := &fakeEtcd{leases: make(map[int64]bool)}
+	server := httptest.NewServer(etcd)
+	defer server.Close()
+
+	e := &etcdElection{endpoints: []string{server.URL}, key: defaultHAKey, node: "a", ttl: 3 * time.Second, client: server.Client()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := make(chan bool, 10)
+	attempt := 0
+	go e.run(ctx, func(active bool) bool {
+		attempt++
+		calls <- active
+		return attempt > 1
+	})
+
+	// Первая попытка стать активным неудачна - ключ освобождается
+	require.True(t, <-calls)
+	assert.Eventually(t, func() bool {
+		etcd.mu.Lock()
+		defer etcd.mu.Unlock()
+		return etcd.value == ""
+	}, time.Second, 10*time.Millisecond)
+
+	// Следующие выборы снова выигрываются, и узел становится активным
+	select {
+	case active := <-calls:
+		assert.True(t, active)
+	case <-time.After(3 * time.Second):
+		t.Fatal("node did not campaign again")
+	}
+	etcd.mu.Lock()
+	defer etcd.mu.Unlock()
+	assert.Equal(t, "a", etcd.value)
+}
@@ -2,12 +2,18 @@ package proxy
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,18 +32,32 @@ const (
 	bodyKey ctxBody = "requestBody"
 	// для хранения trace_id
 	traceIDKey ctxKey = "trace_id"
+
+	// Токен, возвращаемый клиентам на user.login
+	loginToken = "faketoken123"
 )
 
+// ServeHTTP обрабатывает запрос клиента к API с авторизацией из конфигурации proxy.
+// При перезагрузке конфигурации вызывается под той же блокировкой, что и Reload
+func (prx *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g := prx.global
+	prx.AuthMiddleware(prx.idempotent(prx.Handler), g.MetricPath, g.Login, g.AuthPassword(), g.Token)(w, r)
+}
+
 // AuthMiddleware теперь возвращает http.Handler вместо http.HandlerFunc
-func AuthMiddleware(next http.HandlerFunc, metricPath, login, password, token string) http.HandlerFunc {
+func (prx *Proxy) AuthMiddleware(next http.HandlerFunc, metricPath, login, password, token string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		//Инкриментируем метрику активных запросов к APIProxy
-		if metricsCollector != nil {
-			metricsCollector.IncIncomingRequests("APIproxy")
+		if prx.metrics != nil {
+			prx.metrics.IncIncomingRequests("APIproxy")
 		}
 
 		if r.URL.Path == "/favicon.ico" {
-			faviconHandler(w)
+			if prx.global.HideInfo {
+				http.NotFound(w, r)
+				return
+			}
+			prx.serveFavicon(w)
 			return
 		}
 
@@ -47,16 +67,38 @@ func AuthMiddleware(next http.HandlerFunc, metricPath, login, password, token st
 			return
 		}
 
+		// Пассивный узел HA пары не обслуживает запросы API
+		if !IsReady() {
+			http.Error(w, "Service Unavailable: passive HA node", http.StatusServiceUnavailable)
+			return
+		}
+
 		// Создаем trace_id на самом верхнем уровне
+		// Логгер запроса добавляет trace_id ко всем сообщениям обработки запроса
 		trace_id := uuid.New().String()
-		ctx := context.WithValue(r.Context(), traceIDKey, trace_id)
+		log := logger.Global.WithFields(logger.Fields{logger.TraceIDField: trace_id})
+		ctx := logger.NewContext(context.WithValue(r.Context(), traceIDKey, trace_id), log)
 		r = r.WithContext(ctx)
 
-		logger.Global.Debugf("[%s] Incoming request: %s %s", trace_id, r.Method, r.URL.Path)
+		log.Debugf("Incoming request: %s %s", r.Method, r.URL.Path)
 
 		// Проверяем метод
 		if r.Method == "GET" && r.URL.Path == "/" {
-			logger.Global.Debugf("[%s] Handling root request", trace_id)
+			log.Debugf("Handling root request")
+			if prx.global.HideInfo {
+				http.NotFound(w, r)
+				return
+			}
+			// Страница статуса для человека
+			if landing := prx.global.LandingPage; landing.Enabled {
+				if landing.Auth {
+					if _, ok := prx.authenticate(w, r, login, password, token, trace_id); !ok {
+						return
+					}
+				}
+				prx.serveLandingPage(w)
+				return
+			}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(map[string]any{
 				"jsonrpc": "2.0",
@@ -67,7 +109,7 @@ func AuthMiddleware(next http.HandlerFunc, metricPath, login, password, token st
 		}
 
 		if r.Method == "GET" || r.Method == "PUT" || r.Method == "DELETE" {
-			logger.Global.Warningf("[%s] Unsupported GET, PUT, DELETE request", trace_id)
+			log.Warningf("Unsupported GET, PUT, DELETE request")
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			return
 		}
@@ -75,29 +117,30 @@ func AuthMiddleware(next http.HandlerFunc, metricPath, login, password, token st
 		// Проверяем Content-Type
 		contentType := r.Header.Get("Content-Type")
 		if !strings.Contains(contentType, "application/json") {
-			logger.Global.Errorf("[%s] Invalid Content-Type: %s", trace_id, contentType)
+			log.Errorf("Invalid Content-Type: %s", contentType)
 			http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
 			return
 		}
 
 		// Проверяем размер тела
 		if r.ContentLength > prx.global.maxReqBodySizeInt64 {
-			logger.Global.Errorf("[%s] Request body too large: %d bytes", trace_id, r.ContentLength)
+			log.Errorf("Request body too large: %d bytes", r.ContentLength)
 			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
 			return
 		}
 
 		// Читаем тело с ограничением размера
-		body, err := io.ReadAll(io.LimitReader(r.Body, prx.global.maxReqBodySizeInt64))
+		body, status, err := readRequestBody(r, prx.global.maxReqBodySizeInt64)
 		if err != nil {
-			logger.Global.Errorf("[%s] Error reading body: %v", trace_id, err)
-			http.Error(w, "Bad request", http.StatusBadRequest)
+			log.Errorf("Error reading body: %v", err)
+			http.Error(w, http.StatusText(status), status)
 			return
 		}
 		defer r.Body.Close()
 
 		// Восстанавливаем тело для последующих обработчиков
 		r.Body = io.NopCloser(bytes.NewBuffer(body))
+		r.Header.Del("Content-Encoding")
 
 		// Сохраняем тело в контекст для использования в handler
 		ctx = context.WithValue(r.Context(), bodyKey, body)
@@ -105,14 +148,14 @@ func AuthMiddleware(next http.HandlerFunc, metricPath, login, password, token st
 
 		var request map[string]any
 		if err := json.Unmarshal(body, &request); err != nil {
-			logger.Global.Errorf("[%s] Error parsing JSON: %v", trace_id, err)
+			log.Errorf("Error parsing JSON: %v", err)
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
 
 		// Валидация базовой структуры JSON-RPC
 		if request["jsonrpc"] != "2.0" {
-			logger.Global.Errorf("[%s] Invalid JSON-RPC version", trace_id)
+			log.Errorf("Invalid JSON-RPC version")
 			http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
 			return
 		}
@@ -120,8 +163,8 @@ func AuthMiddleware(next http.HandlerFunc, metricPath, login, password, token st
 		// Обработка специальных методов
 		if method, ok := request["method"].(string); ok {
 			switch {
-			case strings.HasSuffix(method, ".create"):
-				logger.Global.Debugf("[%s] Blocking create method: %s", trace_id, method)
+			case strings.HasSuffix(method, ".create") && !prx.createAllowed(r, method):
+				log.Debugf("Blocking create method: %s", method)
 				w.Header().Set("Content-Type", "application/json")
 				json.NewEncoder(w).Encode(map[string]any{
 					"jsonrpc": "2.0",
@@ -135,17 +178,17 @@ func AuthMiddleware(next http.HandlerFunc, metricPath, login, password, token st
 				return
 
 			case method == "user.login":
-				logger.Global.Debugf("[%s] Handling login", trace_id)
+				log.Debugf("Handling login")
 				w.Header().Set("Content-Type", "application/json")
 				json.NewEncoder(w).Encode(map[string]any{
 					"jsonrpc": "2.0",
-					"result":  "faketoken123",
+					"result":  loginToken,
 					"id":      request["id"],
 				})
 				return
 
 			case method == "apiinfo.version":
-				logger.Global.Debugf("[%s] Handling version request", trace_id)
+				log.Debugf("Handling version request")
 				w.Header().Set("Content-Type", "application/json")
 				json.NewEncoder(w).Encode(map[string]any{
 					"jsonrpc": "2.0",
@@ -153,25 +196,25 @@ func AuthMiddleware(next http.HandlerFunc, metricPath, login, password, token st
 					"id":      request["id"],
 				})
 				return
-			}
-		}
 
-		// Аутентификация
-		if token != "" {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader != "Bearer "+token {
-				logger.Global.Errorf("[%s] Invalid token from %s", trace_id, r.RemoteAddr)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			case prx.global.ReadOnly && !isReadMethod(method):
+				log.Warningf("Read-only mode, blocking method: %s", method)
+				writeRPCError(w, request["id"], -32601, "Method not allowed.", "Proxy is in read-only mode. Method '"+method+"' is not permitted.")
 				return
 			}
-		} else if login != "" && password != "" {
-			getLogin, getPass, ok := r.BasicAuth()
-			if !ok || getLogin != login || getPass != password {
-				logger.Global.Errorf("[%s] Invalid credentials from %s", trace_id, r.RemoteAddr)
-				w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		}
+
+		principal, ok := prx.authenticate(w, r, login, password, token, trace_id)
+		if !ok {
+			return
+		}
+		if principal != nil {
+			if method, _ := request["method"].(string); !principal.methodAllowed(method) {
+				log.Warningf("Method %s is not allowed for client %s", method, principal.name)
+				writeRPCError(w, request["id"], -32601, "Method not allowed.", "Method '"+method+"' is not permitted for client '"+principal.name+"'.")
 				return
 			}
+			r = r.WithContext(withPrincipal(r.Context(), principal))
 		}
 
 		// Передаем управление следующему handler
@@ -179,6 +222,213 @@ func AuthMiddleware(next http.HandlerFunc, metricPath, login, password, token st
 	}
 }
 
+// authenticate проверяет авторизацию клиента: токен, выпущенный через /admin/tokens,
+// токен издателя (JWT или introspection), Basic авторизация пользователя каталога LDAP
+// (логин, отличный от login) или токен и Basic авторизация из конфига. Возвращает клиента
+// внешнего источника (nil для учетных данных из конфига) и false, если запрос отклонен
+func (prx *Proxy) authenticate(w http.ResponseWriter, r *http.Request, login, password, token, trace_id string) (*authPrincipal, bool) {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if principal := prx.tokens.principal(bearer); principal != nil {
+			ip := remoteIP(r)
+			if prx.authLocked(w, ip, trace_id) {
+				return nil, false
+			}
+			prx.authLock.reset(ip)
+			return principal, true
+		}
+		if prx.jwt != nil && prx.jwt.accepts(bearer, token) {
+			principal := prx.checkJWT(w, r, bearer, trace_id)
+			return principal, principal != nil
+		}
+	}
+	if user, _, ok := r.BasicAuth(); ok && prx.ldap != nil && user != login {
+		principal := prx.checkLDAP(w, r, trace_id)
+		return principal, principal != nil
+	}
+	return nil, prx.checkAuth(w, r, login, password, token, trace_id)
+}
+
+// checkAuth проверяет токен или Basic авторизацию клиента. password - пароль
+// в открытом виде или его хеш (см. Global.AuthPassword). Если заданы только jwt,
+// ldap или tokens_file, запросы без их учетных данных отклоняются.
+// При неудаче отправляет клиенту 401 (429 для заблокированного адреса) и возвращает false
+func (prx *Proxy) checkAuth(w http.ResponseWriter, r *http.Request, login, password, token, trace_id string) bool {
+	log := logger.WithContext(r.Context())
+	if token == "" && (login == "" || password == "") && prx.jwt == nil && prx.ldap == nil && prx.tokens == nil {
+		return true
+	}
+
+	ip := remoteIP(r)
+	if prx.authLocked(w, ip, trace_id) {
+		return false
+	}
+
+	// Сравнение за постоянное время, чтобы не раскрывать токен и пароль по времени ответа
+	reason := ""
+	switch {
+	case token != "":
+		authHeader := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(authHeader), []byte("Bearer "+token)) != 1 {
+			log.Errorf("Invalid token from %s", r.RemoteAddr)
+			reason = authFailToken
+		}
+	case login != "" && password != "":
+		getLogin, getPass, ok := r.BasicAuth()
+		loginOK := subtle.ConstantTimeCompare([]byte(getLogin), []byte(login)) == 1
+		if !ok || !verifyPassword(getPass, password) || !loginOK {
+			log.Errorf("Invalid credentials from %s", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			reason = authFailCredentials
+		}
+	case prx.ldap != nil:
+		log.Errorf("Missing credentials from %s", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		reason = authFailCredentials
+	case prx.jwt != nil:
+		log.Errorf("Missing JWT from %s", r.RemoteAddr)
+		reason = authFailJWT
+	default:
+		log.Errorf("Invalid token from %s", r.RemoteAddr)
+		reason = authFailToken
+	}
+
+	if reason == "" {
+		prx.authLock.reset(ip)
+		return true
+	}
+	prx.authRejected(w, ip, reason, trace_id)
+	return false
+}
+
+// checkJWT проверяет JWT клиента. При неудаче отправляет клиенту 401
+// (429 для заблокированного адреса) и возвращает nil
+func (prx *Proxy) checkJWT(w http.ResponseWriter, r *http.Request, bearer, trace_id string) *authPrincipal {
+	log := logger.WithContext(r.Context())
+	ip := remoteIP(r)
+	if prx.authLocked(w, ip, trace_id) {
+		return nil
+	}
+
+	principal, err := prx.jwt.verify(bearer)
+	if err != nil {
+		log.Errorf("Invalid JWT from %s: %v", r.RemoteAddr, err)
+		prx.authRejected(w, ip, authFailJWT, trace_id)
+		return nil
+	}
+	prx.authLock.reset(ip)
+	log.Debugf("JWT client: %s", principal.name)
+	return principal
+}
+
+// checkLDAP проверяет Basic авторизацию пользователя каталога. При неверных
+// учетных данных отправляет клиенту 401 (429 для заблокированного адреса),
+// при недоступности каталога 503 и возвращает nil
+func (prx *Proxy) checkLDAP(w http.ResponseWriter, r *http.Request, trace_id string) *authPrincipal {
+	log := logger.WithContext(r.Context())
+	ip := remoteIP(r)
+	if prx.authLocked(w, ip, trace_id) {
+		return nil
+	}
+
+	login, pass, _ := r.BasicAuth()
+	principal, err := prx.ldap.authenticate(r.Context(), login, pass)
+	switch {
+	case errors.Is(err, errInvalidCredentials):
+		log.Errorf("LDAP authentication failed from %s: %v", r.RemoteAddr, err)
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		prx.authRejected(w, ip, authFailCredentials, trace_id)
+		return nil
+	case err != nil:
+		// Недоступность каталога не считается неудачной попыткой клиента
+		log.Errorf("LDAP authentication of %s unavailable: %v", login, err)
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return nil
+	}
+	prx.authLock.reset(ip)
+	log.Debugf("LDAP client: %s (admin: %v)", principal.name, principal.admin)
+	return principal
+}
+
+// authLocked отвечает 429, если адрес клиента заблокирован после неудачных попыток
+func (prx *Proxy) authLocked(w http.ResponseWriter, ip, trace_id string) bool {
+	until := prx.authLock.locked(ip)
+	if until.IsZero() {
+		return false
+	}
+	logger.Global.Warningf("[%s] Authentication locked for %s until %s", trace_id, ip, until.Format(time.RFC3339))
+	prx.authFailed(authFailLocked)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	return true
+}
+
+// authRejected учитывает неудачную попытку авторизации и отвечает 401
+func (prx *Proxy) authRejected(w http.ResponseWriter, ip, reason, trace_id string) {
+	prx.authFailed(reason)
+	if prx.authLock.fail(ip) {
+		logger.Global.Warningf("[%s] Too many failed authentication attempts from %s, locked for %v", trace_id, ip, prx.authLock.duration)
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// authFailed учитывает отказ в авторизации в метриках
+func (prx *Proxy) authFailed(reason string) {
+	if prx.metrics != nil {
+		prx.metrics.IncAuthFailure(reason)
+	}
+}
+
+// isReadMethod проверяет, что метод не изменяет данные в Zabbix (*.get и apiinfo.*)
+func isReadMethod(method string) bool {
+	return strings.HasSuffix(method, ".get") || strings.HasPrefix(method, "apiinfo.")
+}
+
+// writeRPCError отправляет клиенту ошибку в формате JSON-RPC
+func writeRPCError(w http.ResponseWriter, id any, code int, message, data string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+			"data":    data,
+		},
+		"id": id,
+	})
+}
+
+// readRequestBody читает тело запроса, сжатое клиентом (Content-Encoding: gzip)
+// распаковывает. Ограничение limit действует и на распакованное тело, что бы
+// сжатый запрос не обходил max_req_body_size. При ошибке возвращает статус ответа
+func readRequestBody(r *http.Request, limit int64) ([]byte, int, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		body, err := io.ReadAll(io.LimitReader(r.Body, limit))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return body, 0, nil
+
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(io.LimitReader(r.Body, limit))
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		body, err := io.ReadAll(io.LimitReader(gz, limit+1))
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		if int64(len(body)) > limit {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("decompressed body exceeds %d bytes", limit)
+		}
+		return body, 0, nil
+
+	default:
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported Content-Encoding '%s'", encoding)
+	}
+}
+
 // Иконка для браузера, что бы убарть из лога паразитный трафки с ошибками
 func faviconHandler(w http.ResponseWriter) {
 	// Base64 encoded 16x16 PNG favicon
@@ -190,20 +440,22 @@ func faviconHandler(w http.ResponseWriter) {
 }
 
 // Handler теперь получает тело из контекста
-func Handler(w http.ResponseWriter, r *http.Request) {
+func (prx *Proxy) Handler(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 	trace_id, ok := r.Context().Value(traceIDKey).(string)
 	if !ok {
 		trace_id = uuid.New().String()
+		r = r.WithContext(logger.NewContext(r.Context(), logger.Global.WithFields(logger.Fields{logger.TraceIDField: trace_id})))
 	}
+	log := logger.WithContext(r.Context())
 
 	defer r.Body.Close()
 
-	logger.Global.Debugf("[%s] Incoming HTTP request: %s %s", trace_id, r.Method, r.URL.Path)
+	log.Debugf("Incoming HTTP request: %s %s", r.Method, r.URL.Path)
 
 	// Проверяем загружены ли серверы
 	if len(prx.config.Servers) == 0 {
-		logger.Global.Errorf("[%s] No servers configured in Zbx.Servers", trace_id)
+		log.Errorf("No servers configured in Zbx.Servers")
 		http.Error(w, "No servers configured", http.StatusInternalServerError)
 		return
 	}
@@ -211,45 +463,161 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	// Получаем тело из контекста вместо повторного чтения
 	body, ok := r.Context().Value(bodyKey).([]byte)
 	if !ok || body == nil {
-		logger.Global.Errorf("[%s] Body not found in context", trace_id)
+		log.Errorf("Body not found in context")
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
 	var request map[string]any
 	if err := json.Unmarshal(body, &request); err != nil {
-		logger.Global.Errorf("[%s] Error parsing JSON: %v", trace_id, err)
+		log.Errorf("Error parsing JSON: %v", err)
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
 	method, ok := request["method"].(string)
 	if !ok {
-		logger.Global.Errorf("[%s] Method not specified", trace_id)
+		log.Errorf("Method not specified")
 		http.Error(w, "Method required", http.StatusBadRequest)
 		return
 	}
 
-	if !slices.Contains(prx.excludeRequests, method) {
-		logger.Global.Debugf("[%s] Request: %s", trace_id, prettyJSON(request))
+	if !slices.Contains(prx.exclude.Log, method) {
+		log.Debugf("Request: %s", prx.prettyJSON(request))
 	}
 
-	logger.Global.Infof("[%s] Processing: %s", trace_id, method)
+	log.Infof("Processing: %s", method)
 
 	// КРИТИЧЕСКИ ВАЖНО: Добавляем контекст с таймаутом
 	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(prx.global.maxTimeoutInt64)*time.Second)
 	defer cancel()
 
-	results, errors := processAllServers(ctx, request, trace_id)
+	// Отладочная разбивка по серверам по заголовку X-Proxy-Debug: 1
+	ctx, dbg := withRequestDebug(ctx, r, prx.debugDetails(r.Context()))
 
-	if isEmpty(results) && len(errors) > 0 {
-		logger.Global.Errorf("[%s] All requests failed", trace_id)
+	// Поведение для неизвестных ID по заголовку X-Proxy-Unknown-IDs
+	ctx, unknownIDsSet := withUnknownIDs(ctx, r)
+
+	// Клиент запроса для справедливого распределения слотов max_requests
+	ctx = withClient(ctx, requestClient(r, request))
+
+	// Квота элементов одного сервера в объединенном результате
+	ctx, quota := prx.withServerQuota(ctx, method)
+
+	// Отчет о серверах, не ответивших до таймаута, при возврате неполного результата
+	ctx, partial := prx.withPartialReport(ctx)
+
+	// Резерв бюджета памяти освобождается после отправки ответа клиенту
+	ctx, memRes := prx.withMemReservation(ctx)
+	defer memRes.release()
+
+	// Захват запроса бортовым самописцем
+	recorder := prx.recorder
+	var rec *flightRecord
+	if !slices.Contains(prx.exclude.Tracing, method) {
+		ctx, rec = recorder.start(ctx, r, trace_id, method, request)
+	}
+
+	// Постраничная выдача по заголовкам X-Proxy-Page-Size/X-Proxy-Page-Offset или X-Proxy-Cursor
+	page, err := prx.parsePageRequest(r, method, request)
+	if err != nil {
+		log.Warningf("%v", err)
+		writeRPCError(w, request["id"], -32602, "Invalid params.", err.Error())
+		return
+	}
+
+	// Согласованная запись на несколько серверов по заголовку X-Proxy-Write-Mode: coordinated
+	// и proxy.maintenance.createAll
+	write, err := prx.parseCoordinatedWrite(r, request, trace_id)
+	if err != nil {
+		log.Warningf("%v", err)
+		writeRPCError(w, request["id"], -32602, "Invalid params.", err.Error())
+		return
+	}
+
+	var (
+		results any
+		errors  []string
+	)
+	// Следующие страницы выдаются из сохраненного полного результата
+	cached, fromCache := page.cached()
+	if fromCache {
+		results = cached
+		if mc := prx.methodMetrics(method); mc != nil {
+			mc.IncRequestStatus("APIproxy", "page_cached")
+		}
+	} else if page != nil && page.cursor {
+		log.Warningf("Page cursor expired")
+		writeRPCError(w, request["id"], -32602, "Invalid params.", "Page cursor expired. Request the first page again.")
+		return
+	} else if write != nil {
+		// Согласованная запись применяется к серверам по одному
+		results, errors = prx.processCoordinatedWrite(ctx, request, trace_id, write)
+	} else {
+		// Одинаковые одновременные запросы разделяют один запрос к серверам
+		results, errors = prx.processCoalesced(ctx, request, method, trace_id, dbg != nil || rec != nil || unknownIDsSet || quota != nil)
+	}
+
+	// Клиент отключился, незавершенные запросы к серверам отменены. Ответ отправлять некому
+	if slices.Contains(errors, errClientGone) {
+		log.Warningf("Client disconnected, upstream requests cancelled")
+		if mc := prx.methodMetrics(method); mc != nil {
+			mc.IncRequestStatus("APIproxy", "client_abandoned")
+		}
+		rec.finish(nil, errors)
+		recorder.add(rec)
+		return
+	}
+
+	// Объединенный результат превысил max_resp_body_size
+	if slices.Contains(errors, errRespTooLarge) {
+		if mc := prx.methodMetrics(method); mc != nil {
+			mc.IncRequestStatus("APIproxy", "resp_too_large")
+		}
+		rec.finish(nil, errors)
+		recorder.add(rec)
+		prx.writeRespTooLarge(w, request["id"])
+		return
+	}
+
+	// Частично примененная запись: ошибка с отчетом о серверах, требующих ручного отката
+	if write.failed() {
+		log.Errorf("Coordinated write failed, rollback required on servers %v", write.rollbackRequired())
+		if mc := prx.methodMetrics(method); mc != nil {
+			mc.IncRequestStatus("APIproxy", "coordinated_write_failed")
+		}
+		response := map[string]any{
+			"jsonrpc": "2.0",
+			"error":   write.rpcError(),
+			"id":      request["id"],
+			"meta":    map[string]any{"write_report": write.meta()},
+		}
+		rec.finish(response, errors)
+		recorder.add(rec)
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if isEmpty(results) && len(errors) > 0 {
+		log.Errorf("All requests failed")
+		rpcErr, retryAt := prx.upstreamError(errors)
+		response := map[string]any{
 			"jsonrpc": "2.0",
-			"error":   errors,
+			"error":   rpcErr,
 			"id":      request["id"],
-		})
+		}
+		// Все серверы пропущены Circuit Breaker - сообщаем клиенту, когда повторить запрос
+		if !retryAt.IsZero() {
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(time.Until(retryAt).Seconds())))))
+		}
+		if dbg != nil {
+			response["meta"] = map[string]any{"proxy_debug": dbg.meta()}
+		}
+		rec.finish(response, errors)
+		recorder.add(rec)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 		return
 	}
 
@@ -257,26 +625,62 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		results = []any{}
 	}
 
+	// Удаляем тяжелые поля, не нужные клиентам. Сохраненный результат уже обработан
+	if !fromCache {
+		results = prx.applyDropFields(method, results)
+	}
+
+	meta := map[string]any{}
+	if page != nil {
+		var pageMeta map[string]any
+		if results, pageMeta = page.apply(results, fromCache); pageMeta != nil {
+			meta["pagination"] = pageMeta
+		}
+	}
+
 	response := map[string]any{
 		"jsonrpc": "2.0",
 		"result":  results,
 		"id":      request["id"],
 	}
+	if dbg != nil {
+		meta["proxy_debug"] = dbg.meta()
+	}
+	if write != nil {
+		meta["write_report"] = write.meta()
+	}
+	if quota.truncated() {
+		meta["server_quota"] = quota.meta()
+		if mc := prx.methodMetrics(method); mc != nil {
+			mc.IncRequestStatus("APIproxy", "quota_truncated")
+		}
+	}
+	if partial.partial() {
+		meta["partial"] = partial.meta(errors)
+		if mc := prx.methodMetrics(method); mc != nil {
+			mc.IncRequestStatus("APIproxy", "partial_timeout")
+		}
+	}
+	if len(meta) > 0 {
+		response["meta"] = meta
+	}
+	rec.finish(response, errors)
+	recorder.add(rec)
 
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
-		logger.Global.Errorf("[%s] Error marshaling response: %v", trace_id, err)
+		log.Errorf("Error marshaling response: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if _, err := w.Write(responseBytes); err != nil {
-		logger.Global.Errorf("[%s] Error writing response: %v", trace_id, err)
+		log.Errorf("Error writing response: %v", err)
 	}
 
-	if !slices.Contains(prx.excludeRequests, method) {
-		logger.Global.Debugf("[%s] Response: %s", trace_id, prettyJSON(response))
+	if !slices.Contains(prx.exclude.Log, method) {
+		log.Debugf("Response: %s", prx.prettyJSON(response))
 	}
 
 	// Увеличиваем счетчик запросов
@@ -287,12 +691,14 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		} else if len(errors) < len(prx.config.Servers) {
 			status = "halfError"
 		}
-		if metricsCollector != nil {
-			metricsCollector.IncRequestsTotal(method, status)
-			metricsCollector.IncRequestsTotal("all", status)
-			metricsCollector.ObserveResponseSize(len(responseBytes))
-			metricsCollector.ObserveRequestDuration("APIproxy", method, time.Since(startTime))
+		client := prx.usage.label(clientFromContext(ctx))
+		prx.usage.add(client, method, status == "error", time.Since(startTime))
+		if mc := prx.methodMetrics(method); mc != nil {
+			mc.IncRequestsTotal(method, status, client)
+			mc.IncRequestsTotal("all", status, client)
+			mc.ObserveResponseSize(len(responseBytes))
+			mc.ObserveRequestDuration("APIproxy", method, status, time.Since(startTime))
 		}
-		logger.Global.Infof("[%s] Completed by status '%s' in %v", trace_id, status, time.Since(startTime))
+		log.Infof("Completed by status '%s' in %v", status, time.Since(startTime))
 	}()
 }
@@ -1,6 +1,8 @@
 package proxy
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
 	"io"
@@ -15,7 +17,8 @@ import (
 
 // TestAuthMiddleware_PathHandling тестирует обработку специальных путей
 func TestAuthMiddleware_PathHandling(t *testing.T) {
-	prx.global.maxReqBodySizeInt64 = 100
+	// Все запросы приходят с одного адреса, блокировка после неудачных попыток не нужна
+	prx := &Proxy{global: Global{maxReqBodySizeInt64: 100}}
 
 	tests := []struct {
 		name           string
@@ -75,7 +78,7 @@ func TestAuthMiddleware_PathHandling(t *testing.T) {
 				w.WriteHeader(http.StatusOK)
 			})
 
-			middleware := AuthMiddleware(nextHandler, "/metrics", "admin", "password", "test-token")
+			middleware := prx.AuthMiddleware(nextHandler, "/metrics", "admin", "password", "test-token")
 
 			var bodyReader io.Reader
 			if tt.body != "" {
@@ -101,7 +104,11 @@ func TestAuthMiddleware_PathHandling(t *testing.T) {
 
 // TestAuthMiddleware_Authentication тестирует различные методы аутентификации
 func TestAuthMiddleware_Authentication(t *testing.T) {
-	prx.global.maxReqBodySizeInt64 = 100
+	// Все запросы приходят с одного адреса, блокировка после неудачных попыток не нужна
+	prx := &Proxy{global: Global{maxReqBodySizeInt64: 100}}
+
+	hash, err := HashPassword("password123")
+	require.NoError(t, err)
 
 	tests := []struct {
 		name           string
@@ -149,6 +156,30 @@ func TestAuthMiddleware_Authentication(t *testing.T) {
 			expectedStatus: http.StatusUnauthorized,
 			description:    "Должен отвергнуть с неправильным паролем",
 		},
+		{
+			name:           "valid basic auth with password hash",
+			login:          "admin",
+			password:       hash,
+			authHeader:     "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:password123")),
+			expectedStatus: http.StatusOK,
+			description:    "Должен пропустить с паролем, соответствующим хешу",
+		},
+		{
+			name:           "invalid basic auth with password hash",
+			login:          "admin",
+			password:       hash,
+			authHeader:     "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:wrongpass")),
+			expectedStatus: http.StatusUnauthorized,
+			description:    "Должен отвергнуть пароль, не соответствующий хешу",
+		},
+		{
+			name:           "hash is not accepted as password",
+			login:          "admin",
+			password:       hash,
+			authHeader:     "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:"+hash)),
+			expectedStatus: http.StatusUnauthorized,
+			description:    "Должен отвергнуть сам хеш в качестве пароля",
+		},
 		{
 			name:           "no authentication required when empty credentials",
 			login:          "",
@@ -168,7 +199,7 @@ func TestAuthMiddleware_Authentication(t *testing.T) {
 				w.WriteHeader(http.StatusOK)
 			})
 
-			middleware := AuthMiddleware(nextHandler, "/metrics", tt.login, tt.password, tt.token)
+			middleware := prx.AuthMiddleware(nextHandler, "/metrics", tt.login, tt.password, tt.token)
 
 			// Создаем валидный JSON-RPC запрос
 			requestBody := `{"jsonrpc":"2.0","method":"host.get","id":1}`
@@ -194,8 +225,8 @@ func TestAuthMiddleware_Authentication(t *testing.T) {
 
 // TestAuthMiddleware_SpecialMethods тестирует обработку специальных методов
 func TestAuthMiddleware_SpecialMethods(t *testing.T) {
-	prx.global.maxReqBodySizeInt64 = 100
-	prx.config.APIversion = "6.0.0"
+	// Все запросы приходят с одного адреса, блокировка после неудачных попыток не нужна
+	prx := &Proxy{global: Global{maxReqBodySizeInt64: 100}, config: ZabbixConf{APIversion: "6.0.0"}}
 
 	tests := []struct {
 		name           string
@@ -253,7 +284,7 @@ func TestAuthMiddleware_SpecialMethods(t *testing.T) {
 			})
 
 			// Middleware с аутентификацией
-			middleware := AuthMiddleware(nextHandler, "/metrics", "user", "pass", "token")
+			middleware := prx.AuthMiddleware(nextHandler, "/metrics", "user", "pass", "token")
 
 			requestBody := `{"jsonrpc":"2.0","method":"` + tt.method + `","id":1}`
 			req := httptest.NewRequest("POST", "/api", strings.NewReader(requestBody))
@@ -292,7 +323,7 @@ func TestAuthMiddleware_SpecialMethods(t *testing.T) {
 
 // TestAuthMiddleware_JSONValidation тестирует валидацию JSON
 func TestAuthMiddleware_JSONValidation(t *testing.T) {
-	prx.global.maxReqBodySizeInt64 = 100
+	prx := &Proxy{global: Global{maxReqBodySizeInt64: 100}}
 
 	tests := []struct {
 		name           string
@@ -360,7 +391,7 @@ func TestAuthMiddleware_JSONValidation(t *testing.T) {
 				w.WriteHeader(http.StatusOK)
 			})
 
-			middleware := AuthMiddleware(nextHandler, "/metrics", "admin", "123", "")
+			middleware := prx.AuthMiddleware(nextHandler, "/metrics", "admin", "123", "")
 
 			req := httptest.NewRequest("POST", "/api", strings.NewReader(tt.body))
 			req.Header.Set("Content-Type", tt.contentType)
@@ -379,9 +410,60 @@ func TestAuthMiddleware_JSONValidation(t *testing.T) {
 	}
 }
 
+// TestAuthMiddleware_ContentEncoding тестирует прием сжатого тела запроса
+func TestAuthMiddleware_ContentEncoding(t *testing.T) {
+	prx := &Proxy{global: Global{maxReqBodySizeInt64: 100}}
+
+	gzipped := func(s string) string {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(s))
+		gz.Close()
+		return buf.String()
+	}
+	valid := `{"jsonrpc":"2.0","method":"host.get","id":1}`
+
+	tests := []struct {
+		name           string
+		body           string
+		encoding       string
+		expectedStatus int
+	}{
+		{"identity", valid, "identity", http.StatusOK},
+		{"gzip", gzipped(valid), "gzip", http.StatusOK},
+		{"x-gzip", gzipped(valid), "X-Gzip", http.StatusOK},
+		{"corrupted gzip", valid, "gzip", http.StatusBadRequest},
+		// Сжатое тело меньше предела, распакованное - больше
+		{"gzip bomb", gzipped(`{"jsonrpc":"2.0","params":"` + strings.Repeat("a", 1000) + `"}`), "gzip", http.StatusRequestEntityTooLarge},
+		{"unknown encoding", valid, "br", http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byte
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = io.ReadAll(r.Body)
+				assert.Empty(t, r.Header.Get("Content-Encoding"))
+			})
+			middleware := prx.AuthMiddleware(nextHandler, "/metrics", "", "", "")
+
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", tt.encoding)
+			recorder := httptest.NewRecorder()
+			middleware.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, valid, string(got))
+			}
+		})
+	}
+}
+
 // TestAuthMiddleware_MethodHandling тестирует обработку HTTP методов
 func TestAuthMiddleware_MethodHandling(t *testing.T) {
-	prx.global.maxReqBodySizeInt64 = 100
+	prx := &Proxy{global: Global{maxReqBodySizeInt64: 100}}
 
 	tests := []struct {
 		name           string
@@ -452,7 +534,7 @@ func TestAuthMiddleware_MethodHandling(t *testing.T) {
 				w.WriteHeader(http.StatusOK)
 			})
 
-			middleware := AuthMiddleware(nextHandler, "/metrics", "", "", "token123")
+			middleware := prx.AuthMiddleware(nextHandler, "/metrics", "", "", "token123")
 
 			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
 			if tt.method == "POST" && tt.body != "" {
@@ -482,3 +564,51 @@ func TestFaviconHandler(t *testing.T) {
 	// Проверяем что возвращаются какие-то данные
 	assert.True(t, recorder.Body.Len() > 0, "Favicon should return some data")
 }
+
+// TestAuthMiddleware_ReadOnly тестирует режим только для чтения
+func TestAuthMiddleware_ReadOnly(t *testing.T) {
+	prx := &Proxy{global: Global{maxReqBodySizeInt64: 1024, ReadOnly: true}}
+
+	tests := []struct {
+		name        string
+		method      string
+		expectBlock bool
+	}{
+		{name: "get method allowed", method: "host.get", expectBlock: false},
+		{name: "apiinfo allowed", method: "apiinfo.version", expectBlock: false},
+		{name: "update blocked", method: "host.update", expectBlock: true},
+		{name: "delete blocked", method: "item.delete", expectBlock: true},
+		{name: "massadd blocked", method: "hostgroup.massadd", expectBlock: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextCalled := false
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+				w.WriteHeader(http.StatusOK)
+			})
+
+			middleware := prx.AuthMiddleware(nextHandler, "/metrics", "", "", "")
+
+			requestBody := `{"jsonrpc":"2.0","method":"` + tt.method + `","id":1}`
+			req := httptest.NewRequest("POST", "/", strings.NewReader(requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+
+			middleware.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			if tt.expectBlock {
+				assert.False(t, nextCalled)
+				var response map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				rpcErr, ok := response["error"].(map[string]any)
+				require.True(t, ok, "response must contain JSON-RPC error")
+				assert.Equal(t, float64(-32601), rpcErr["code"])
+			} else if tt.method != "apiinfo.version" {
+				assert.True(t, nextCalled)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/cache"
+	"ZabbixAPIproxy/internal/logger"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	defaultHASyncInterval = 30 * time.Second
+	// Путь копии кеша на активном узле пары
+	haSnapshotPath = "/admin/ha/snapshot"
+)
+
+// AdminHASnapshotHandler обрабатывает GET /admin/ha/snapshot: сохраняет кеш и отдает
+// согласованную копию его файла. Пассивный узел пары копирует ее вместо общего тома
+func (prx *Proxy) AdminHASnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	prx.PrepareHASnapshot(w).Send(w)
+}
+
+// HASnapshot копия файла кеша во временном файле. Готовится под блокировкой
+// конфигурации, а передается после ее снятия, что бы медленный пассивный узел
+// не задерживал перезагрузку конфига и смену роли
+type HASnapshot struct {
+	file  *os.File
+	size  int64
+	start time.Time
+}
+
+// PrepareHASnapshot сохраняет кеш и копирует его файл во временный рядом с
+// cache.db_path. При ошибке отвечает клиенту и возвращает nil
+func (prx *Proxy) PrepareHASnapshot(w http.ResponseWriter) *HASnapshot {
+	if prx.cache == nil {
+		writeAdminResponse(w, http.StatusConflict, map[string]any{"status": "error", "error": "cache is not open on this node"})
+		return nil
+	}
+
+	start := time.Now()
+	path := prx.cacheCfg.DBPath
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".snapshot-*")
+	if err == nil {
+		var n int64
+		if n, err = prx.cache.WriteSnapshot(file); err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+			if err == nil {
+				return &HASnapshot{file: file, size: n, start: start}
+			}
+		}
+		file.Close()
+		os.Remove(file.Name())
+	}
+	logger.Global.Errorf("HA: cache snapshot failed: %v", err)
+	http.Error(w, "cache snapshot failed", http.StatusInternalServerError)
+	return nil
+}
+
+// Send передает копию кеша клиенту и удаляет временный файл. nil - ответ уже отправлен
+func (s *HASnapshot) Send(w http.ResponseWriter) {
+	if s == nil {
+		return
+	}
+	defer os.Remove(s.file.Name())
+	defer s.file.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(s.size, 10))
+	// Ответ уже начат: при ошибке клиент получит обрыв
+	if n, err := io.Copy(w, s.file); err != nil {
+		logger.Global.Errorf("HA: cache snapshot transfer failed after %d bytes: %v", n, err)
+		return
+	}
+	logger.Global.Debugf("HA: cache snapshot of %d bytes sent in %v", s.size, time.Since(s.start))
+}
+
+// startHASync запускает фоновое копирование кеша с активного узла пары (ha.peer).
+// Вызывается только для пассивного узла: задача прерывается при смене роли
+func (prx *Proxy) startHASync() {
+	cfg := prx.global.HA
+	if cfg.Role == "" || cfg.Peer == "" || prx.cacheCfg.IDMode == idModeDeterministic || !prx.idRewrite() {
+		return
+	}
+
+	interval := defaultHASyncInterval
+	if cfg.SyncInterval != "" {
+		if s, err := suffix.ToSeconds(cfg.SyncInterval); err != nil || s == 0 {
+			logger.Global.Errorf("invalid 'ha.sync_interval' %s, using %v", cfg.SyncInterval, defaultHASyncInterval)
+		} else {
+			interval = time.Duration(s) * time.Second
+		}
+	}
+
+	client := &http.Client{}
+	prx.background.start(func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := prx.pullHACache(ctx, client, interval); err != nil && ctx.Err() == nil {
+				logger.Global.Warningf("HA: cache sync from %s failed: %v", cfg.Peer, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	logger.Global.Infof("HA: passive node copies the cache from %s every %v", cfg.Peer, interval)
+}
+
+// pullHACache копирует файл кеша с активного узла пары. Копия ограничена timeout
+func (prx *Proxy) pullHACache(ctx context.Context, client *http.Client, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(prx.global.HA.Peer, "/")+haSnapshotPath, nil)
+	if err != nil {
+		return err
+	}
+	if token := prx.global.HA.PeerToken; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	start := time.Now()
+	n, err := cache.ReplaceFile(prx.cacheCfg.DBPath, resp.Body)
+	if err != nil {
+		return err
+	}
+	logger.Global.Debugf("HA: cache of %d bytes copied from %s in %v", n, prx.global.HA.Peer, time.Since(start))
+	return nil
+}
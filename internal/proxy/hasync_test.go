@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/cache"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHASync тестирует копирование кеша пассивным узлом с активного без общего тома
+func TestHASync(t *testing.T) {
+	dir := t.TempDir()
+
+	// Активный узел отдает копию кеша по токену служебных эндпоинтов
+	activeCfg := initTestCache()
+	activeCfg.DBPath = filepath.Join(dir, "active.db")
+	active := InitProxy(Global{MaxRequests: 10}, ZabbixConf{}, CBConf{}, CacheConf(activeCfg), ExcludeMethods{})
+	defer active.Stop()
+	active.cache.CacheType["host"].Set(100, 500, 1, "HostA")
+	peer := httptest.NewServer(active.AdminReadMiddleware(active.AdminHASnapshotHandler, "", "", "peer-token"))
+	defer peer.Close()
+
+	passiveCfg := initTestCache()
+	passiveCfg.DBPath = filepath.Join(dir, "passive.db")
+	g := Global{MaxRequests: 10, HA: HAConf{Role: haRolePassive, Peer: peer.URL, PeerToken: "peer-token", SyncInterval: "1s"}}
+	passive := InitProxy(g, ZabbixConf{}, CBConf{}, CacheConf(passiveCfg), ExcludeMethods{})
+	defer func() {
+		passive.Stop()
+		initHA(HAConf{})
+	}()
+	require.False(t, IsReady())
+
+	// Пассивный узел копирует кеш, не открывая его
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(passiveCfg.DBPath)
+		return err == nil
+	}, 3*time.Second, 20*time.Millisecond)
+	assert.Nil(t, passive.cache)
+
+	// После перехода в active узел работает с маппингами прежнего активного узла
+	require.NoError(t, passive.setHAActive(true))
+	require.NotNil(t, passive.cache)
+	originalID, found := passive.cache.CacheType["host"].GetOriginalID(100, 1)
+	assert.True(t, found)
+	assert.Equal(t, 500, originalID)
+}
+
+// TestHASnapshotHandler тестирует отказ в копии кеша на узле без открытого кеша
+func TestHASnapshotHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&Proxy{}).AdminHASnapshotHandler(w, httptest.NewRequest("GET", haSnapshotPath, nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// TestHASnapshotAfterUnlock тестирует передачу копии кеша, подготовленной до
+// закрытия кеша (передача идет после снятия блокировки конфигурации)
+func TestHASnapshotAfterUnlock(t *testing.T) {
+	dir := t.TempDir()
+	cfg := initTestCache()
+	cfg.DBPath = filepath.Join(dir, "active.db")
+	prx := InitProxy(Global{MaxRequests: 10}, ZabbixConf{}, CBConf{}, CacheConf(cfg), ExcludeMethods{})
+	prx.cache.CacheType["host"].Set(100, 500, 1, "HostA")
+
+	w := httptest.NewRecorder()
+	snapshot := prx.PrepareHASnapshot(w)
+	require.NotNil(t, snapshot)
+	// Кеш закрывается перезагрузкой конфига или сменой роли до начала передачи
+	prx.Stop()
+
+	snapshot.Send(w)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+
+	replica := filepath.Join(dir, "passive.db")
+	_, err := cache.ReplaceFile(replica, w.Body)
+	require.NoError(t, err)
+	cfg.DBPath = replica
+	passive := cache.Init(cache.CacheCfg(cfg))
+	defer passive.Stop()
+	originalID, found := passive.CacheType["host"].GetOriginalID(100, 1)
+	assert.True(t, found)
+	assert.Equal(t, 500, originalID)
+
+	// Временный файл копии удален
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.NotContains(t, e.Name(), ".snapshot-")
+	}
+
+	// Без подготовленной копии ответ уже отправлен
+	(*HASnapshot)(nil).Send(w)
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"ZabbixAPIproxy/internal/logger"
+
+	"github.com/a3ak/suffix"
+)
+
+// SecurityHeadersConf заголовки безопасности ответов прокси
+type SecurityHeadersConf struct {
+	// max-age заголовка Strict-Transport-Security (например 365d), пусто - не отправлять.
+	// Включать, только если клиенты обращаются к прокси по HTTPS (через балансировщик)
+	HSTS                  string `yaml:"hsts"`
+	HSTSIncludeSubdomains bool   `yaml:"hsts_include_subdomains"`
+	// Дополнительные заголовки, например X-Frame-Options: DENY.
+	// Пустое значение отключает заголовок по умолчанию (X-Content-Type-Options)
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Заголовки безопасности ответов, обновляются при перезагрузке конфига
+var securityHeaders atomic.Pointer[http.Header]
+
+// newSecurityHeaders формирует заголовки безопасности из конфига
+func newSecurityHeaders(cfg SecurityHeadersConf) http.Header {
+	h := http.Header{}
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	if cfg.HSTS != "" {
+		if s, err := suffix.ToSeconds(cfg.HSTS); err != nil {
+			logger.Global.Errorf("invalid 'security_headers.hsts' %s, Strict-Transport-Security disabled", cfg.HSTS)
+		} else {
+			hsts := fmt.Sprintf("max-age=%d", s)
+			if cfg.HSTSIncludeSubdomains {
+				hsts += "; includeSubDomains"
+			}
+			h.Set("Strict-Transport-Security", hsts)
+		}
+	}
+
+	for name, value := range cfg.Headers {
+		if value == "" {
+			h.Del(name)
+			continue
+		}
+		h.Set(name, value)
+	}
+	return h
+}
+
+// SecurityHeaders добавляет заголовки безопасности ко всем ответам. Заголовок
+// Server прокси не отправляет (net/http его не добавляет), заголовки серверов
+// Zabbix клиенту не передаются
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := securityHeaders.Load(); h != nil {
+			for name := range *h {
+				w.Header().Set(name, h.Get(name))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
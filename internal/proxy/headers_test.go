@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSecurityHeaders тестирует заголовки безопасности ответов
+func TestSecurityHeaders(t *testing.T) {
+	g := Global{MaxRequests: 5, SecurityHeaders: SecurityHeadersConf{
+		HSTS:                  "365d",
+		HSTSIncludeSubdomains: true,
+		Headers:               map[string]string{"X-Frame-Options": "DENY"},
+	}}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	handler := SecurityHeaders(prx.AuthMiddleware(prx.Handler, "/metrics", "", "", ""))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Empty(t, w.Header().Get("Server"))
+	assert.Contains(t, w.Body.String(), "Zabbix API Proxy")
+
+	// По умолчанию только X-Content-Type-Options, пустое значение отключает заголовок
+	h := newSecurityHeaders(SecurityHeadersConf{})
+	assert.Equal(t, http.Header{"X-Content-Type-Options": {"nosniff"}}, h)
+	h = newSecurityHeaders(SecurityHeadersConf{HSTS: "bad", Headers: map[string]string{"x-content-type-options": ""}})
+	assert.Empty(t, h)
+}
+
+// TestHideInfo тестирует отключение ответа с информацией о прокси
+func TestHideInfo(t *testing.T) {
+	prx := InitProxy(Global{MaxRequests: 5, HideInfo: true}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	handler := prx.AuthMiddleware(prx.Handler, "/metrics", "", "", "")
+	for _, path := range []string{"/", "/favicon.ico"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.NotContains(t, w.Body.String(), "Zabbix", path)
+	}
+}
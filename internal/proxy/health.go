@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+)
+
+// Состояния /health и его проверок
+const (
+	HealthOK       = "OK"
+	HealthDegraded = "DEGRADED"
+	HealthDown     = "DOWN"
+	// Зависимость не используется (например кеш в прозрачном режиме или на пассивном узле HA)
+	HealthDisabled = "DISABLED"
+)
+
+// Проверяемые зависимости
+const (
+	healthCache           = "cache"
+	healthCircuitBreakers = "circuit_breakers"
+)
+
+var healthChecks = []string{healthCache, healthCircuitBreakers}
+
+// HealthConf настройки /health
+type HealthConf struct {
+	// Критичные зависимости (cache, circuit_breakers): их сбой делает общее состояние DOWN
+	// (HTTP 503), сбой остальных - DEGRADED. По умолчанию критичных зависимостей нет
+	Critical []string `yaml:"critical"`
+}
+
+// HealthCheck состояние зависимости
+type HealthCheck struct {
+	Status   string         `json:"status"`
+	Critical bool           `json:"critical"`
+	Error    string         `json:"error,omitempty"`
+	Details  map[string]any `json:"details,omitempty"`
+}
+
+// HealthReport ответ /health. Формат описан в HealthSchema
+type HealthReport struct {
+	Status           string                 `json:"status"`
+	Version          string                 `json:"version,omitempty"`
+	StartedAt        time.Time              `json:"started_at"`
+	UptimeSec        int64                  `json:"uptime_sec"`
+	ConfigReloadedAt *time.Time             `json:"config_reloaded_at,omitempty"`
+	Checks           map[string]HealthCheck `json:"checks"`
+}
+
+// HealthSchema JSON Schema ответа /health
+const HealthSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "ZabbixAPIproxy health",
+  "type": "object",
+  "required": ["status", "started_at", "uptime_sec", "checks"],
+  "properties": {
+    "status": {"enum": ["OK", "DEGRADED", "DOWN"]},
+    "version": {"type": "string"},
+    "started_at": {"type": "string", "format": "date-time"},
+    "uptime_sec": {"type": "integer", "minimum": 0},
+    "config_reloaded_at": {"type": "string", "format": "date-time"},
+    "checks": {
+      "type": "object",
+      "additionalProperties": {
+        "type": "object",
+        "required": ["status", "critical"],
+        "properties": {
+          "status": {"enum": ["OK", "DEGRADED", "DOWN", "DISABLED"]},
+          "critical": {"type": "boolean"},
+          "error": {"type": "string"},
+          "details": {"type": "object"}
+        }
+      }
+    }
+  }
+}
+`
+
+// validateHealthConf предупреждает о неизвестных зависимостях в health.critical
+func validateHealthConf(c HealthConf) {
+	for _, name := range c.Critical {
+		if !slices.Contains(healthChecks, name) {
+			logger.Global.Warningf("Unknown dependency '%s' in 'health.critical', expected one of %v", name, healthChecks)
+		}
+	}
+}
+
+// Health возвращает состояние proxy и его зависимостей
+func (prx *Proxy) Health() HealthReport {
+	report := HealthReport{
+		Status:    HealthOK,
+		StartedAt: prx.startedAt,
+		UptimeSec: int64(time.Since(prx.startedAt).Seconds()),
+		Checks: map[string]HealthCheck{
+			healthCache:           prx.cacheHealth(),
+			healthCircuitBreakers: prx.circuitBreakerHealth(),
+		},
+	}
+	if !prx.reloadedAt.IsZero() {
+		report.ConfigReloadedAt = &prx.reloadedAt
+	}
+
+	for name, check := range report.Checks {
+		check.Critical = slices.Contains(prx.global.Health.Critical, name)
+		report.Checks[name] = check
+		switch {
+		case check.Status != HealthDegraded && check.Status != HealthDown:
+		case check.Critical:
+			report.Status = HealthDown
+		case report.Status == HealthOK:
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
+
+// HTTPStatus возвращает код ответа /health: 503, если отказала критичная зависимость
+func (r HealthReport) HTTPStatus() int {
+	if r.Status == HealthDown {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// cacheHealth проверяет БД кеша: подключена ли она и успешно ли последнее сохранение
+func (prx *Proxy) cacheHealth() HealthCheck {
+	if prx.cache == nil {
+		return HealthCheck{Status: HealthDisabled}
+	}
+	st := prx.cache.SaveStatus()
+	check := HealthCheck{Status: HealthOK, Details: map[string]any{"db_open": st.DBOpen}}
+	if !st.LastSave.IsZero() {
+		check.Details["last_save"] = st.LastSave
+	}
+	switch {
+	case !st.DBOpen:
+		// Кеш работает в памяти, маппинги не переживут перезапуск
+		check.Status = HealthDegraded
+		check.Error = "cache database is not open"
+	case st.LastError != nil:
+		check.Status = HealthDegraded
+		check.Error = logger.Redact(st.LastError.Error())
+	}
+	return check
+}
+
+// circuitBreakerHealth сводка состояний Circuit Breaker серверов: DEGRADED, если часть
+// открыта, DOWN - если открыты все
+func (prx *Proxy) circuitBreakerHealth() HealthCheck {
+	if prx.cb == nil {
+		return HealthCheck{Status: HealthDisabled}
+	}
+	counts := map[string]any{"closed": 0, "open": 0, "half_open": 0}
+	total := 0
+	for _, data := range prx.GetCBStats() {
+		stats, ok := data.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch stats["state"] {
+		case "closed":
+			counts["closed"] = counts["closed"].(int) + 1
+		case "open":
+			counts["open"] = counts["open"].(int) + 1
+		case "half-open":
+			counts["half_open"] = counts["half_open"].(int) + 1
+		default:
+			continue
+		}
+		total++
+	}
+
+	check := HealthCheck{Status: HealthOK, Details: counts}
+	switch open := counts["open"].(int); {
+	case total == 0:
+		check.Status = HealthDisabled
+	case open == total:
+		check.Status = HealthDown
+		check.Error = "all circuit breakers are open"
+	case open > 0:
+		check.Status = HealthDegraded
+	}
+	return check
+}
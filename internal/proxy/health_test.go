@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/a3ak/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHealth тестирует состояние зависимостей и общее состояние /health
+func TestHealth(t *testing.T) {
+	newProxy := func(critical ...string) *Proxy {
+		prx := &Proxy{cb: circuitbreaker.NewCBManager(), startedAt: time.Now().Add(-time.Minute)}
+		prx.global.Health.Critical = critical
+		prx.cb.InitCircuitBreakers([]string{"server1", "server2"}, circuitbreaker.CircuitBreakerConf{
+			FailureThreshold: 1,
+			RecoveryTimeout:  time.Hour,
+		})
+		return prx
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		report := newProxy().Health()
+		assert.Equal(t, HealthOK, report.Status)
+		assert.Equal(t, http.StatusOK, report.HTTPStatus())
+		assert.GreaterOrEqual(t, report.UptimeSec, int64(60))
+		assert.Nil(t, report.ConfigReloadedAt)
+		assert.Equal(t, HealthDisabled, report.Checks[healthCache].Status)
+		cb := report.Checks[healthCircuitBreakers]
+		assert.Equal(t, HealthOK, cb.Status)
+		assert.Equal(t, 2, cb.Details["closed"])
+	})
+
+	t.Run("non-critical failure degrades", func(t *testing.T) {
+		prx := newProxy()
+		prx.cb.ReportFailure("server1")
+		report := prx.Health()
+		assert.Equal(t, HealthDegraded, report.Status)
+		assert.Equal(t, http.StatusOK, report.HTTPStatus())
+		assert.Equal(t, HealthDegraded, report.Checks[healthCircuitBreakers].Status)
+		assert.False(t, report.Checks[healthCircuitBreakers].Critical)
+
+		prx.cb.ReportFailure("server2")
+		report = prx.Health()
+		assert.Equal(t, HealthDegraded, report.Status, "non-critical dependency never makes proxy down")
+		assert.Equal(t, HealthDown, report.Checks[healthCircuitBreakers].Status)
+	})
+
+	t.Run("critical failure is down", func(t *testing.T) {
+		prx := newProxy(healthCircuitBreakers)
+		prx.cb.ReportFailure("server1")
+		report := prx.Health()
+		assert.Equal(t, HealthDown, report.Status)
+		assert.Equal(t, http.StatusServiceUnavailable, report.HTTPStatus())
+		assert.True(t, report.Checks[healthCircuitBreakers].Critical)
+	})
+}
+
+// TestHealth_CacheAndReload тестирует проверку кеша и время перезагрузки конфигурации
+func TestHealth_CacheAndReload(t *testing.T) {
+	cacheCfg := CacheConf(initTestCache())
+	cacheCfg.DBPath = filepath.Join(t.TempDir(), "cache.db")
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://server1.com", ID: 1, Token: "token1"}}}
+	g := Global{MaxRequests: 5, Health: HealthConf{Critical: []string{healthCache}}}
+	prx := InitProxy(g, z, CBConf{}, cacheCfg, ExcludeMethods{})
+	defer prx.Stop()
+
+	report := prx.Health()
+	assert.Equal(t, HealthOK, report.Status)
+	check := report.Checks[healthCache]
+	assert.Equal(t, HealthOK, check.Status)
+	assert.True(t, check.Critical)
+	assert.Equal(t, true, check.Details["db_open"])
+
+	started := report.StartedAt
+	prx.Reload(g, z, CBConf{}, cacheCfg, ExcludeMethods{})
+	report = prx.Health()
+	assert.Equal(t, started, report.StartedAt, "start time is kept across reload")
+	require.NotNil(t, report.ConfigReloadedAt)
+	assert.False(t, report.ConfigReloadedAt.Before(started))
+
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(data, &body))
+	for _, field := range []string{"status", "started_at", "uptime_sec", "config_reloaded_at", "checks"} {
+		assert.Contains(t, body, field)
+	}
+	assert.True(t, json.Valid([]byte(HealthSchema)))
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"fmt"
+)
+
+// Ключи одной логической сущности в результатах методов при host_merge:
+// узел сети - по ProxyID, элемент данных - по ProxyID узла сети и ключу элемента
+var hostMergeKeys = map[string][]string{
+	"host.get": {"hostid"},
+	"item.get": {"hostid", "key_"},
+}
+
+// mergeDuplicateHosts объединяет одноименные узлы сети разных серверов (host_merge):
+// одноименные узлы уже имеют общий ProxyID, поэтому в результате остается первый
+// узел с этим ProxyID и первый элемент данных с тем же ключом на этом узле.
+// Запросы по ProxyID узла получают все серверы, на которых он есть
+func (prx *Proxy) mergeDuplicateHosts(method string, results []any) []any {
+	fields, ok := hostMergeKeys[method]
+	if !prx.global.HostMerge || !ok {
+		return results
+	}
+
+	seen := make(map[string]bool, len(results))
+	merged := results[:0]
+	for _, item := range results {
+		m, ok := item.(map[string]any)
+		if !ok {
+			merged = append(merged, item)
+			continue
+		}
+		key, complete := "", true
+		for _, field := range fields {
+			v, ok := m[field]
+			if !ok {
+				complete = false
+				break
+			}
+			key += fmt.Sprint(v) + "\x00"
+		}
+		// Элементы без полей ключа (output без hostid) не объединяются
+		if !complete {
+			merged = append(merged, item)
+			continue
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, item)
+	}
+	clear(results[len(merged):])
+	return merged
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProcessAllServers_HostMerge тестирует объединение одноименных узлов сети серверов
+func TestProcessAllServers_HostMerge(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	mockClient := testProxy.GetMockClient()
+	mockClient.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		hostID, itemID := "101", "1001"
+		if url == "http://zbx2" {
+			hostID, itemID = "202", "2002"
+		}
+		if request["method"] == "item.get" {
+			return map[string]any{"result": []any{
+				map[string]any{"itemid": itemID, "hostid": hostID, "key_": "system.cpu.load"},
+				map[string]any{"itemid": itemID + "1", "hostid": hostID, "key_": "agent.ping." + url},
+			}}, nil
+		}
+		return map[string]any{"result": []any{map[string]any{"hostid": hostID, "name": "web1"}}}, nil
+	}
+
+	z := ZabbixConf{
+		Servers: []zabbix.ZabbixServer{
+			{URL: "http://zbx1", ID: 1, Token: "token1"},
+			{URL: "http://zbx2", ID: 2, Token: "token2"},
+		},
+	}
+	testProxy.Init(Global{MaxRequests: 5, StableOrder: true, HostMerge: true}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+	results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-host-merge")
+	require.Empty(t, errors)
+	hosts := results.([]any)
+	require.Len(t, hosts, 1, "same-named hosts are one logical host")
+	hostID := hosts[0].(map[string]any)["hostid"]
+
+	// Элементы данных логического узла: одинаковые ключи серверов объединены
+	calls := mockClient.CallCount
+	request = map[string]any{"jsonrpc": "2.0", "method": "item.get", "id": 2, "params": map[string]any{"hostids": []any{hostID}}}
+	results, errors = testProxy.processAllServersWithMock(context.Background(), request, "test-host-merge-items")
+	require.Empty(t, errors)
+	keys := []string{}
+	for _, item := range results.([]any) {
+		m := item.(map[string]any)
+		assert.Equal(t, hostID, m["hostid"])
+		keys = append(keys, m["key_"].(string))
+	}
+	assert.ElementsMatch(t, []string{"system.cpu.load", "agent.ping.http://zbx1", "agent.ping.http://zbx2"}, keys)
+	assert.Equal(t, calls+2, mockClient.CallCount, "ProxyID of the logical host is sent to both servers")
+}
+
+// TestMergeDuplicateHosts тестирует объединение только при host_merge и полном ключе
+func TestMergeDuplicateHosts(t *testing.T) {
+	items := func() []any {
+		return []any{
+			map[string]any{"hostid": "10", "key_": "a"},
+			map[string]any{"hostid": "10", "key_": "a"},
+			map[string]any{"itemid": "5"},
+			map[string]any{"itemid": "6"},
+		}
+	}
+	prx := &Proxy{}
+	assert.Len(t, prx.mergeDuplicateHosts("item.get", items()), 4, "host_merge disabled")
+
+	prx.global.HostMerge = true
+	assert.Len(t, prx.mergeDuplicateHosts("item.get", items()), 3, "items without key fields are kept")
+	assert.Len(t, prx.mergeDuplicateHosts("trigger.get", items()), 4)
+}
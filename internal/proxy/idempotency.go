@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	// Заголовок с ключом идемпотентности изменяющего запроса
+	idempotencyKeyHeader = "X-Idempotency-Key"
+	// Заголовок ответа, повторенного по ключу идемпотентности
+	idempotentReplayHeader = "X-Idempotent-Replay"
+
+	defaultIdempotencyTTL     = 10 * time.Minute
+	defaultIdempotencyMaxKeys = 10000
+)
+
+// IdempotencyConf настройки ключей идемпотентности изменяющих запросов
+type IdempotencyConf struct {
+	Enabled bool   `yaml:"enabled"`
+	TTL     string `yaml:"ttl"`      // Время хранения ответа, по умолчанию 10m
+	MaxKeys int    `yaml:"max_keys"` // Максимум хранимых ответов, по умолчанию 10000
+}
+
+// idempotentResponse ответ изменяющего запроса, повторяемый по ключу идемпотентности
+type idempotentResponse struct {
+	// Метод и параметры запроса: ключ нельзя использовать для другого запроса
+	fingerprint string
+	status      int
+	header      http.Header
+	body        []byte
+}
+
+// idempotencyStore хранит ответы изменяющих запросов по ключам идемпотентности.
+// Повтор, пришедший до завершения исходного запроса, ожидает его ответ
+type idempotencyStore struct {
+	responses *pageStore
+	group     *requestGroup
+}
+
+// newIdempotencyStore создает хранилище ответов или nil, если ключи идемпотентности отключены
+func newIdempotencyStore(cfg IdempotencyConf) *idempotencyStore {
+	if !cfg.Enabled {
+		return nil
+	}
+	ttl := defaultIdempotencyTTL
+	if cfg.TTL != "" {
+		if s, err := suffix.ToSeconds(cfg.TTL); err != nil || s == 0 {
+			logger.Global.Errorf("invalid 'idempotency.ttl' %s, using %v", cfg.TTL, defaultIdempotencyTTL)
+		} else {
+			ttl = time.Duration(s) * time.Second
+		}
+	}
+	maxKeys := cfg.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultIdempotencyMaxKeys
+	}
+
+	return &idempotencyStore{
+		responses: &pageStore{ttl: ttl, maxSets: maxKeys, sets: make(map[string]*pageSet), now: time.Now},
+		group:     newRequestGroup(),
+	}
+}
+
+// responseCapture сохраняет ответ обработчика для повторов
+type responseCapture struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) Header() http.Header { return c.header }
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	return c.body.Write(b)
+}
+
+// idempotent выполняет изменяющий запрос с заголовком X-Idempotency-Key один раз:
+// повтор с тем же ключом в течение idempotency.ttl получает сохраненный ответ, а не
+// изменяет сущности повторно (например после таймаута proxy на стороне клиента).
+// Ключ действует в пределах клиента. Ответы с ошибкой не сохраняются.
+// Запрос по ключу доводится до конца и сохраняется, даже если клиент отключился
+func (prx *Proxy) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := prx.idempotency
+		idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+		body, _ := r.Context().Value(bodyKey).([]byte)
+		if store == nil || idempotencyKey == "" || body == nil {
+			next(w, r)
+			return
+		}
+		var request map[string]any
+		if err := json.Unmarshal(body, &request); err != nil {
+			next(w, r)
+			return
+		}
+		method, _ := request["method"].(string)
+		if isReadMethod(method) {
+			next(w, r)
+			return
+		}
+		fingerprint, ok := coalesceKey(method, request)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		log := logger.WithContext(r.Context())
+		sum := sha256.Sum256([]byte(requestClient(r, request) + "\x00" + idempotencyKey))
+		key := hex.EncodeToString(sum[:]) + principalFromContext(r.Context()).scope()
+
+		replayed := true
+		resp, found := store.get(key)
+		if !found {
+			// Изменяющий запрос не прерывается отключением клиента: иначе ключ освободился бы
+			// до сохранения ответа, и повтор клиента изменил бы сущности второй раз.
+			// Выполнение ограничено собственным таймаутом max_timeout
+			writeCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), time.Duration(prx.global.maxTimeoutInt64)*time.Second)
+			defer cancel()
+			results, _, _ := store.group.do(writeCtx, key, func(ctx context.Context) (any, []string) {
+				// Повтор мог дождаться ответа, сохраненного перед его приходом
+				if resp, ok := store.get(key); ok {
+					return resp, nil
+				}
+				replayed = false
+				capture := &responseCapture{header: make(http.Header)}
+				next(capture, r.WithContext(ctx))
+				resp := &idempotentResponse{fingerprint: fingerprint, status: capture.status, header: capture.header, body: capture.body.Bytes()}
+				if succeeded(resp) {
+					store.responses.put(key, []any{resp})
+				}
+				return resp, nil
+			})
+			resp, found = results.(*idempotentResponse)
+		}
+		if !found {
+			// Истек таймаут ожидания исходного запроса
+			writeRPCError(w, request["id"], -32603, "Internal error.", "Request with the same idempotency key did not complete.")
+			return
+		}
+
+		if resp.fingerprint != fingerprint {
+			log.Warningf("Idempotency key reused for a different %s request", method)
+			writeRPCError(w, request["id"], -32602, "Invalid params.", "Idempotency key was already used for a different request.")
+			return
+		}
+
+		respBody := resp.body
+		if replayed {
+			log.Infof("Replaying %s response for idempotency key", method)
+			if mc := prx.methodMetrics(method); mc != nil {
+				mc.IncRequestStatus("APIproxy", "idempotent_replay")
+			}
+			w.Header().Set(idempotentReplayHeader, "true")
+			respBody = withResponseID(respBody, request["id"])
+		}
+		maps.Copy(w.Header(), resp.header)
+		w.WriteHeader(resp.status)
+		w.Write(respBody)
+	}
+}
+
+// get возвращает сохраненный ответ по ключу
+func (s *idempotencyStore) get(key string) (*idempotentResponse, bool) {
+	stored, ok := s.responses.get(key)
+	if !ok || len(stored) == 0 {
+		return nil, false
+	}
+	resp, ok := stored[0].(*idempotentResponse)
+	return resp, ok
+}
+
+// succeeded сообщает, что запрос выполнен хотя бы одним сервером: ответ с result.
+// Повтор запроса, завершившегося ошибкой, выполняется заново
+func succeeded(resp *idempotentResponse) bool {
+	if resp.status != http.StatusOK {
+		return false
+	}
+	var body map[string]any
+	if err := json.Unmarshal(resp.body, &body); err != nil {
+		return false
+	}
+	_, ok := body["result"]
+	return ok
+}
+
+// withResponseID заменяет id JSON-RPC сохраненного ответа на id повторного запроса
+func withResponseID(body []byte, id any) []byte {
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	response["id"] = id
+	if b, err := json.Marshal(response); err == nil {
+		return b
+	}
+	return body
+}
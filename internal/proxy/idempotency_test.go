@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIdempotent тестирует повтор ответа изменяющего запроса по ключу идемпотентности
+func TestIdempotent(t *testing.T) {
+	prx := &Proxy{
+		global:      Global{maxReqBodySizeInt64: 1024},
+		idempotency: newIdempotencyStore(IdempotencyConf{Enabled: true}),
+	}
+
+	calls := 0
+	fail := false
+	next := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var request map[string]any
+		json.Unmarshal(r.Context().Value(bodyKey).([]byte), &request)
+		w.Header().Set("Content-Type", "application/json")
+		if fail {
+			writeRPCError(w, request["id"], -32500, "Application error.", "upstream failed")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "result": map[string]any{"hostids": []any{fmt.Sprint(calls)}}, "id": request["id"]})
+	}
+	handler := prx.AuthMiddleware(prx.idempotent(next), "/metrics", "", "", "")
+
+	send := func(body, key string) (*httptest.ResponseRecorder, map[string]any) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var response map[string]any
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+	update := `{"jsonrpc":"2.0","method":"host.update","params":{"hostid":"10","status":1},"id":%d}`
+
+	w, first := send(fmt.Sprintf(update, 1), "key-1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(idempotentReplayHeader))
+	assert.Equal(t, 1, calls)
+
+	// Повтор получает сохраненный ответ со своим id без повторного выполнения
+	w, retry := send(fmt.Sprintf(update, 2), "key-1")
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "true", w.Header().Get(idempotentReplayHeader))
+	assert.Equal(t, first["result"], retry["result"])
+	assert.Equal(t, float64(2), retry["id"])
+
+	// Ключ другого запроса отклоняется
+	_, response := send(`{"jsonrpc":"2.0","method":"host.update","params":{"hostid":"11"},"id":3}`, "key-1")
+	assert.Equal(t, 1, calls)
+	assert.Contains(t, response["error"].(map[string]any)["data"], "different request")
+
+	// Без ключа и для читающих методов запрос выполняется каждый раз
+	send(fmt.Sprintf(update, 4), "")
+	send(`{"jsonrpc":"2.0","method":"host.get","params":{},"id":5}`, "key-2")
+	send(`{"jsonrpc":"2.0","method":"host.get","params":{},"id":6}`, "key-2")
+	assert.Equal(t, 4, calls)
+
+	// Ответ с ошибкой не сохраняется: повтор выполняется заново
+	fail = true
+	send(fmt.Sprintf(update, 7), "key-3")
+	fail = false
+	_, response = send(fmt.Sprintf(update, 8), "key-3")
+	assert.Equal(t, 6, calls)
+	assert.Contains(t, response, "result")
+}
+
+// TestIdempotentClientDisconnect тестирует, что отключение клиента не прерывает
+// изменяющий запрос по ключу, а повтор клиента получает его ответ без повторного выполнения
+func TestIdempotentClientDisconnect(t *testing.T) {
+	prx := &Proxy{
+		global:      Global{maxReqBodySizeInt64: 1024, maxTimeoutInt64: 5},
+		idempotency: newIdempotencyStore(IdempotencyConf{Enabled: true}),
+	}
+
+	var calls atomic.Int32
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	writeErr := make(chan error, 2)
+	next := func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		started <- struct{}{}
+		<-release
+		writeErr <- r.Context().Err()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "result": map[string]any{"hostids": []any{"10"}}, "id": 1})
+	}
+	handler := prx.AuthMiddleware(prx.idempotent(next), "/metrics", "", "", "")
+
+	send := func(ctx context.Context, id int) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","method":"host.update","params":{"hostid":"10","status":1},"id":%d}`, id)
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Клиент отключается, пока запрос выполняется
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		send(ctx, 1)
+	}()
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+
+	// Повтор приходит до завершения исходного запроса и ожидает его ответ
+	retried := make(chan *httptest.ResponseRecorder)
+	go func() { retried <- send(context.Background(), 2) }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	require.NoError(t, <-writeErr)
+	<-first
+	w := <-retried
+	assert.Equal(t, "true", w.Header().Get(idempotentReplayHeader))
+	assert.Contains(t, w.Body.String(), `"hostids":["10"]`)
+
+	// Повтор после завершения получает сохраненный ответ
+	w = send(context.Background(), 3)
+	assert.Equal(t, "true", w.Header().Get(idempotentReplayHeader))
+	assert.Equal(t, int32(1), calls.Load())
+}
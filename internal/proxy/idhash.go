@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"hash/fnv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	defaultIDHash   = "fnv32a"
+	defaultIDDigits = 7
+	// ProxyID = hash % 10^digits * 10 должен точно представляться в float64 (JSON)
+	maxIDDigits = 14
+
+	// Режимы адресации: ProxyID по имени сущности через кеш или
+	// детерминированный ProxyID = originalID*10 + serverID без кеша
+	idModeCache         = "cache"
+	idModeDeterministic = "deterministic"
+)
+
+// Поддерживаемые алгоритмы хеширования имени сущности для генерации ProxyID
+var idHashFuncs = map[string]func(string) uint64{
+	"fnv32a": func(s string) uint64 {
+		h := fnv.New32a()
+		h.Write([]byte(s))
+		return uint64(h.Sum32())
+	},
+	"fnv64": func(s string) uint64 {
+		h := fnv.New64()
+		h.Write([]byte(s))
+		return h.Sum64()
+	},
+	"fnv64a": func(s string) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(s))
+		return h.Sum64()
+	},
+	"xxhash": xxhash.Sum64String,
+}
+
+// pow10 возвращает 10 в степени n
+func pow10(n int) int {
+	r := 1
+	for range n {
+		r *= 10
+	}
+	return r
+}
+
+// setIDScheme настраивает алгоритм хеширования и ширину пространства ProxyID.
+// Нормализованные значения записываются в конфиг кеша, чтобы кеш мог отследить
+// смену схемы для уже сохраненных маппингов
+func (prx *Proxy) setIDScheme(cacheCfg *CacheConf) {
+	if cacheCfg.IDHash == "" {
+		cacheCfg.IDHash = defaultIDHash
+	}
+	if _, ok := idHashFuncs[cacheCfg.IDHash]; !ok {
+		logger.Global.Errorf("unknown 'id_hash' %q, using default: %s", cacheCfg.IDHash, defaultIDHash)
+		cacheCfg.IDHash = defaultIDHash
+	}
+
+	if cacheCfg.IDDigits == 0 {
+		cacheCfg.IDDigits = defaultIDDigits
+	}
+	if cacheCfg.IDDigits < 1 || cacheCfg.IDDigits > maxIDDigits {
+		logger.Global.Errorf("'id_digits' must be between 1 and %d, got %d, using default: %d", maxIDDigits, cacheCfg.IDDigits, defaultIDDigits)
+		cacheCfg.IDDigits = defaultIDDigits
+	}
+
+	switch cacheCfg.IDMode {
+	case "":
+		cacheCfg.IDMode = idModeCache
+	case idModeCache, idModeDeterministic:
+	default:
+		logger.Global.Errorf("unknown 'id_mode' %q, using default: %s", cacheCfg.IDMode, idModeCache)
+		cacheCfg.IDMode = idModeCache
+	}
+
+	prx.idHash = idHashFuncs[cacheCfg.IDHash]
+	prx.idSpace = pow10(cacheCfg.IDDigits)
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"sync"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetIDScheme_Defaults(t *testing.T) {
+	prx := &Proxy{}
+	cfg := CacheConf{}
+	prx.setIDScheme(&cfg)
+
+	assert.Equal(t, defaultIDHash, cfg.IDHash)
+	assert.Equal(t, defaultIDDigits, cfg.IDDigits)
+	assert.Equal(t, 10000000, prx.idSpace)
+
+	// Схема по умолчанию совпадает с прежней генерацией FNV-32a
+	h := fnv.New32a()
+	h.Write([]byte("host"))
+	assert.Equal(t, uint64(h.Sum32()), prx.idHash("host"))
+}
+
+func TestSetIDScheme_XXHash(t *testing.T) {
+	prx := &Proxy{}
+	cfg := CacheConf{IDHash: "xxhash", IDDigits: 10}
+	prx.setIDScheme(&cfg)
+
+	assert.Equal(t, "xxhash", cfg.IDHash)
+	assert.Equal(t, xxhash.Sum64String("host"), prx.idHash("host"))
+	assert.Equal(t, 10000000000, prx.idSpace)
+}
+
+func TestSetIDScheme_Invalid(t *testing.T) {
+	prx := &Proxy{}
+	cfg := CacheConf{IDHash: "md5", IDDigits: 20}
+	prx.setIDScheme(&cfg)
+
+	assert.Equal(t, defaultIDHash, cfg.IDHash)
+	assert.Equal(t, defaultIDDigits, cfg.IDDigits)
+}
+
+func TestGenerateProxyID_ConfiguredScheme(t *testing.T) {
+	cacheCfg := CacheConf(initTestCache())
+	cacheCfg.IDHash = "fnv64a"
+	cacheCfg.IDDigits = 12
+	prx := InitProxy(Global{MaxRequests: 10}, ZabbixConf{}, CBConf{}, cacheCfg, ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	result, err := prx.generateProxyID("host", map[string]any{"hostid": 100, "name": "big-install-host"}, 1)
+	require.NoError(t, err)
+
+	h := fnv.New64a()
+	h.Write([]byte("big-install-host"))
+	expected := int(h.Sum64()%1000000000000) * 10
+	assert.Equal(t, expected, result)
+}
+
+func TestSetIDScheme_IDMode(t *testing.T) {
+	prx := &Proxy{}
+	cfg := CacheConf{IDMode: "random"}
+	prx.setIDScheme(&cfg)
+	assert.Equal(t, idModeCache, cfg.IDMode)
+
+	cfg = CacheConf{IDMode: idModeDeterministic}
+	prx.setIDScheme(&cfg)
+	assert.Equal(t, idModeDeterministic, cfg.IDMode)
+}
+
+func TestDeterministicIDMode(t *testing.T) {
+	cacheCfg := CacheConf(initTestCache())
+	cacheCfg.IDMode = idModeDeterministic
+	prx := InitProxy(Global{MaxRequests: 10}, ZabbixConf{}, CBConf{}, cacheCfg, ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	// Кеш не открывается
+	assert.Nil(t, prx.cache)
+
+	// ProxyID хостов и групп - функция только originalID и serverID
+	data := map[string]any{"hostid": "100", "name": "host-a", "groups": []any{map[string]any{"groupid": "5", "name": "Linux"}}}
+	uniq := map[string]map[any]bool{}
+	result := prx.processResponseIDs(data, 2, uniq, &sync.RWMutex{}, 1).(map[string]any)
+	assert.Equal(t, "1002", result["hostid"])
+	assert.Equal(t, "52", result["groups"].([]any)[0].(map[string]any)["groupid"])
+
+	// Обратное преобразование не требует кеша
+	assert.Equal(t, 2, getServerFromID("1002"))
+	assert.Equal(t, 100, convertGrafanaIDToOriginal("1002", 2))
+
+	// ProxyID с нулем в конце без кеша не разрешаются
+	assert.Nil(t, prx.convertProxyIDToOriginal("1230", 2, "hostids"))
+}
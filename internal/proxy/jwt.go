@@ -0,0 +1,533 @@
+package proxy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	principalKey ctxKey = "principal"
+
+	defaultJWKSRefresh = time.Hour
+	// Минимальный интервал внепланового обновления JWKS при неизвестном kid
+	jwksMinRefresh = time.Minute
+	// Допустимое расхождение часов с издателем при проверке exp и nbf
+	jwtLeeway    = 30 * time.Second
+	jwksTimeout  = 10 * time.Second
+	jwksMaxBytes = 1 << 20
+)
+
+// JWTConf авторизация клиентов по JWT, подписанным издателем с ключами из JWKS
+type JWTConf struct {
+	JWKSURL         string `yaml:"jwks_url"`
+	Issuer          string `yaml:"issuer"`           // Обязательное значение iss, пусто - не проверяется
+	Audience        string `yaml:"audience"`         // Обязательное значение в aud, пусто - не проверяется
+	RefreshInterval string `yaml:"refresh_interval"` // Период обновления ключей, по умолчанию 1h
+	// Claims с именем клиента (по умолчанию sub), разрешенными серверами (ID, имя или URL)
+	// и методами (шаблоны path.Match). Вложенные claims указываются через точку.
+	// Если claim серверов или методов задан, но отсутствует в токене - доступ запрещен
+	NameClaim    string `yaml:"name_claim"`
+	ServersClaim string `yaml:"servers_claim"`
+	MethodsClaim string `yaml:"methods_claim"`
+
+	// OIDC: адреса jwks_uri и introspection_endpoint из issuer/.well-known/openid-configuration
+	Discovery bool `yaml:"discovery"`
+	// Проверка непрозрачных токенов (RFC 7662) с учетными данными прокси у IdP
+	IntrospectionURL      string `yaml:"introspection_url"`
+	ClientID              string `yaml:"client_id"`
+	ClientSecret          string `yaml:"client_secret"`
+	IntrospectionCacheTTL string `yaml:"introspection_cache_ttl"` // По умолчанию 1m
+	// Разрешенные методы по scope токена (шаблоны path.Match)
+	ScopeMethods map[string][]string `yaml:"scope_methods"`
+}
+
+// authPrincipal клиент, прошедший авторизацию у внешнего источника (JWT, IdP, LDAP)
+type authPrincipal struct {
+	name string
+	// Разрешенные серверы и методы, nil - без ограничения
+	servers []string
+	methods []string
+	// Доступ к служебным эндпоинтам /admin/*
+	admin bool
+}
+
+// jwtVerifier проверяет JWT клиентов. Ключи JWKS загружаются при первом запросе
+// и обновляются по истечении refresh или при появлении неизвестного kid.
+// Непрозрачные токены проверяются у IdP (introspection)
+type jwtVerifier struct {
+	conf    JWTConf
+	refresh time.Duration
+	client  *http.Client
+	now     func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+
+	// Адреса IdP, полученные discovery
+	oidc oidcEndpoints
+	// Результаты introspection по SHA-256 токена
+	introspected *principalCache
+}
+
+// newJWTVerifier создает проверку JWT или nil, если не заданы jwks_url,
+// introspection_url или discovery издателя
+func newJWTVerifier(cfg JWTConf) *jwtVerifier {
+	if cfg.JWKSURL == "" && cfg.IntrospectionURL == "" && !(cfg.Discovery && cfg.Issuer != "") {
+		return nil
+	}
+	if cfg.NameClaim == "" {
+		cfg.NameClaim = "sub"
+	}
+
+	refresh := defaultJWKSRefresh
+	if cfg.RefreshInterval != "" {
+		if s, err := suffix.ToSeconds(cfg.RefreshInterval); err != nil || s == 0 {
+			logger.Global.Errorf("invalid 'jwt.refresh_interval' %s, using %v", cfg.RefreshInterval, defaultJWKSRefresh)
+		} else {
+			refresh = time.Duration(s) * time.Second
+		}
+	}
+
+	return &jwtVerifier{
+		conf:         cfg,
+		refresh:      refresh,
+		client:       &http.Client{Timeout: jwksTimeout},
+		now:          time.Now,
+		introspected: newPrincipalCache("jwt.introspection_cache_ttl", cfg.IntrospectionCacheTTL),
+	}
+}
+
+// isJWT проверяет, что Bearer токен имеет вид JWT (header.payload.signature)
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// accepts проверяет, что Bearer токен проверяется издателем, а не сравнивается
+// со статическим токеном прокси: JWT или, при настроенной introspection, любой другой
+func (v *jwtVerifier) accepts(bearer, token string) bool {
+	if isJWT(bearer) {
+		return true
+	}
+	if !v.introspects() {
+		return false
+	}
+	return token == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1
+}
+
+// verify проверяет токен и возвращает клиента: JWT - по подписи ключами JWKS,
+// непрозрачный токен (или JWT без JWKS) - запросом introspection к IdP
+func (v *jwtVerifier) verify(token string) (*authPrincipal, error) {
+	if !isJWT(token) || v.jwksURL() == "" {
+		if !v.introspects() {
+			return nil, errors.New("malformed token")
+		}
+		return v.introspect(token)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid signature encoding")
+	}
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	if err := v.checkClaims(claims, true); err != nil {
+		return nil, err
+	}
+	return v.principal(claims)
+}
+
+// decodeJWTPart декодирует часть токена в base64url JSON
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature проверяет подпись ключом издателя. Поддерживаются RS256/384/512
+// и ES256/384/512, алгоритмы none и HS* отклоняются
+func (v *jwtVerifier) verifySignature(alg, kid, signed string, sig []byte) error {
+	var h hash.Hash
+	var ch crypto.Hash
+	switch alg[min(len(alg), 2):] {
+	case "256":
+		h, ch = sha256.New(), crypto.SHA256
+	case "384":
+		h, ch = sha512.New384(), crypto.SHA384
+	case "512":
+		h, ch = sha512.New(), crypto.SHA512
+	}
+	if h == nil || (!strings.HasPrefix(alg, "RS") && !strings.HasPrefix(alg, "ES")) {
+		return fmt.Errorf("unsupported algorithm '%s'", alg)
+	}
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	keys, err := v.signingKeys(kid)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		switch pub := key.(type) {
+		case *rsa.PublicKey:
+			if strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(pub, ch, digest, sig) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			if strings.HasPrefix(alg, "ES") && len(sig) == 2*size {
+				r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+				if ecdsa.Verify(pub, digest, r, s) {
+					return nil
+				}
+			}
+		}
+	}
+	return errors.New("invalid signature")
+}
+
+// signingKeys возвращает ключ с указанным kid (без kid - все ключи издателя).
+// Ключи загружаются заново по истечении refresh_interval или для неизвестного kid
+func (v *jwtVerifier) signingKeys(kid string) ([]crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	_, known := v.keys[kid]
+	stale := now.Sub(v.fetchedAt) > v.refresh
+	if v.keys == nil || stale || (kid != "" && !known && now.Sub(v.fetchedAt) > jwksMinRefresh) {
+		keys, err := v.fetchKeys()
+		if err != nil {
+			// Издатель недоступен - проверяем ранее загруженными ключами
+			logger.Global.Errorf("Failed to fetch JWKS from %s: %v", v.jwksURL(), err)
+			if v.keys == nil {
+				return nil, errors.New("signing keys unavailable")
+			}
+		} else {
+			v.keys = keys
+		}
+		v.fetchedAt = now
+	}
+
+	if kid != "" {
+		key, ok := v.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id '%s'", kid)
+		}
+		return []crypto.PublicKey{key}, nil
+	}
+	keys := make([]crypto.PublicKey, 0, len(v.keys))
+	for _, key := range v.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// jsonWebKey открытый ключ из JWKS (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchKeys загружает ключи подписи издателя. Ключи неподдерживаемых типов пропускаются
+func (v *jwtVerifier) fetchKeys() (map[string]crypto.PublicKey, error) {
+	resp, err := v.client.Get(v.jwksURL())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, jwksMaxBytes)).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			logger.Global.Warningf("JWKS key '%s' skipped: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey разбирает открытый ключ RSA или EC
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, errN := b64.DecodeString(k.N)
+		e, errE := b64.DecodeString(k.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, errX := b64.DecodeString(k.X)
+		y, errY := b64.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid EC key")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		// Точка должна лежать на кривой
+		if _, err := pub.ECDH(); err != nil {
+			return nil, errors.New("invalid EC key")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type '%s'", k.Kty)
+}
+
+// checkClaims проверяет срок действия, издателя и получателя токена. Срок действия
+// обязателен для JWT, в ответе introspection его может не быть
+func (v *jwtVerifier) checkClaims(claims map[string]any, requireExp bool) error {
+	now := v.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok && requireExp {
+		return errors.New("missing exp claim")
+	}
+	if ok && now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not yet valid")
+	}
+	if v.conf.Issuer != "" && claims["iss"] != v.conf.Issuer {
+		return fmt.Errorf("unexpected issuer '%v'", claims["iss"])
+	}
+	if v.conf.Audience != "" && !claimContains(claims["aud"], v.conf.Audience) {
+		return errors.New("token audience mismatch")
+	}
+	return nil
+}
+
+// principal формирует клиента из claims токена
+func (v *jwtVerifier) principal(claims map[string]any) (*authPrincipal, error) {
+	p := &authPrincipal{}
+	name, _ := claimValue(claims, v.conf.NameClaim)
+	switch n := name.(type) {
+	case string:
+		p.name = n
+	case float64:
+		p.name = strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	// У токенов client credentials сервисных учетных записей sub может не быть
+	if p.name == "" {
+		p.name, _ = claims["client_id"].(string)
+	}
+	if p.name == "" {
+		return nil, fmt.Errorf("missing %s claim", v.conf.NameClaim)
+	}
+	if v.conf.ServersClaim != "" {
+		servers, _ := claimValue(claims, v.conf.ServersClaim)
+		p.servers = claimList(servers)
+	}
+	if v.conf.MethodsClaim != "" {
+		methods, _ := claimValue(claims, v.conf.MethodsClaim)
+		p.methods = claimList(methods)
+	}
+	if len(v.conf.ScopeMethods) > 0 {
+		p.methods = append(slices.Clip(p.methods), scopeMethods(claims, v.conf.ScopeMethods)...)
+		if p.methods == nil {
+			p.methods = []string{}
+		}
+	}
+	return p, nil
+}
+
+// claimValue возвращает значение claim, вложенные claims указываются через точку
+func claimValue(claims map[string]any, name string) (any, bool) {
+	var value any = claims
+	for _, key := range strings.Split(name, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// claimList приводит claim к списку строк: массив или строка со значениями,
+// разделенными пробелами или запятыми (как scope). Отсутствующий claim - пустой список
+func claimList(value any) []string {
+	list := []string{}
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			if f, ok := item.(float64); ok {
+				list = append(list, strconv.FormatFloat(f, 'f', -1, 64))
+			} else if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+	case string:
+		list = append(list, strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })...)
+	case float64:
+		list = append(list, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return list
+}
+
+// claimContains проверяет наличие значения в claim (строка или массив строк)
+func claimContains(claim any, want string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == want
+	case []any:
+		for _, item := range v {
+			if item == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withPrincipal сохраняет клиента внешней авторизации в контексте
+func withPrincipal(ctx context.Context, p *authPrincipal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// principalFromContext возвращает клиента внешней авторизации или nil
+func principalFromContext(ctx context.Context) *authPrincipal {
+	p, _ := ctx.Value(principalKey).(*authPrincipal)
+	return p
+}
+
+// methodAllowed проверяет, что клиенту разрешен метод
+func (p *authPrincipal) methodAllowed(method string) bool {
+	if p == nil || p.methods == nil {
+		return true
+	}
+	for _, pattern := range p.methods {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// serverAllowed проверяет, что клиенту разрешен сервер (по ID, имени или URL)
+func (p *authPrincipal) serverAllowed(srv zabbix.ZabbixServer) bool {
+	if p == nil || p.servers == nil {
+		return true
+	}
+	for _, s := range p.servers {
+		if s == strconv.Itoa(srv.ID) || s == srv.Name || s == srv.URL {
+			return true
+		}
+	}
+	return false
+}
+
+// restricted проверяет, что клиенту доступны не все серверы
+func (p *authPrincipal) restricted() bool {
+	return p != nil && p.servers != nil
+}
+
+// scope возвращает суффикс ключей общих результатов (объединение запросов, страницы),
+// чтобы клиенты с разными разрешенными серверами не получали чужие результаты
+func (p *authPrincipal) scope() string {
+	if !p.restricted() {
+		return ""
+	}
+	servers := slices.Sorted(slices.Values(p.servers))
+	sum := sha256.Sum256([]byte(strings.Join(servers, "\x00")))
+	return "@" + hex.EncodeToString(sum[:8])
+}
+
+// filterServers оставляет разрешенные клиенту серверы из списка ID серверов servers
+func (p *authPrincipal) filterServers(servers []zabbix.ZabbixServer, ids []int) []int {
+	if !p.restricted() {
+		return ids
+	}
+	allowed := make([]int, 0, len(ids))
+	for _, id := range ids {
+		i := slices.IndexFunc(servers, func(s zabbix.ZabbixServer) bool { return s.ID == id })
+		if i >= 0 && p.serverAllowed(servers[i]) {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed
+}
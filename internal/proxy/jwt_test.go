@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIssuer издатель JWT с ключами RSA и EC для тестов
+type testIssuer struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	// Идентификатор ключа RSA в JWKS (смена имитирует ротацию ключей)
+	rsaKid  atomic.Value
+	fetches atomic.Int32
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	iss := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	iss.rsaKid.Store("rsa1")
+	b64 := base64.RawURLEncoding
+	iss.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iss.fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]any{
+			{"kty": "RSA", "kid": iss.rsaKid.Load(), "use": "sig", "n": b64.EncodeToString(rsaKey.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))), "y": b64.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		}})
+	}))
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+// sign формирует JWT с указанными алгоритмом, kid и claims
+func (iss *testIssuer) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	b64 := base64.RawURLEncoding
+	header := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, iss.ecKey, digest[:])
+		require.NoError(t, err)
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		sig = []byte("signature")
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+// testClaims возвращает действующие claims для тестового издателя
+func testClaims(extra map[string]any) map[string]any {
+	claims := map[string]any{
+		"sub": "grafana",
+		"iss": "https://sso.example.com",
+		"aud": []any{"zabbix-proxy", "other"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return claims
+}
+
+// TestJWTVerifier тестирует проверку подписи и claims JWT
+func TestJWTVerifier(t *testing.T) {
+	iss := newTestIssuer(t)
+	v := newJWTVerifier(JWTConf{
+		JWKSURL:      iss.server.URL,
+		Issuer:       "https://sso.example.com",
+		Audience:     "zabbix-proxy",
+		ServersClaim: "zabbix.servers",
+		MethodsClaim: "scope",
+	})
+	require.NotNil(t, v)
+	assert.Nil(t, newJWTVerifier(JWTConf{}))
+
+	t.Run("valid", func(t *testing.T) {
+		p, err := v.verify(iss.sign(t, "RS256", "rsa1", testClaims(map[string]any{
+			"zabbix": map[string]any{"servers": []any{1, "server3.com"}},
+			"scope":  "host.get item.*",
+		})))
+		require.NoError(t, err)
+		assert.Equal(t, &authPrincipal{name: "grafana", servers: []string{"1", "server3.com"}, methods: []string{"host.get", "item.*"}}, p)
+
+		// Подпись EC, ключ без kid подбирается среди ключей издателя
+		p, err = v.verify(iss.sign(t, "ES256", "", testClaims(map[string]any{"scope": []any{"*.get"}})))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"*.get"}, p.methods)
+		// Claim серверов отсутствует - серверы не разрешены
+		assert.Equal(t, []string{}, p.servers)
+	})
+
+	invalid := map[string]string{
+		"expired":        iss.sign(t, "RS256", "rsa1", testClaims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"not yet valid":  iss.sign(t, "RS256", "rsa1", testClaims(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"missing exp":    iss.sign(t, "RS256", "rsa1", testClaims(map[string]any{"exp": nil})),
+		"wrong issuer":   iss.sign(t, "RS256", "rsa1", testClaims(map[string]any{"iss": "https://evil.example.com"})),
+		"wrong audience": iss.sign(t, "RS256", "rsa1", testClaims(map[string]any{"aud": "other"})),
+		"missing sub":    iss.sign(t, "RS256", "rsa1", testClaims(map[string]any{"sub": nil})),
+		"alg none":       iss.sign(t, "none", "", testClaims(nil)),
+		"alg HS256":      iss.sign(t, "HS256", "hmac", testClaims(nil)),
+		"wrong key type": iss.sign(t, "RS256", "ec1", testClaims(nil)),
+		"unknown kid":    iss.sign(t, "RS256", "rsa2", testClaims(nil)),
+		"malformed":      "a.b.c",
+	}
+	for name, token := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := v.verify(token)
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		token := iss.sign(t, "RS256", "rsa1", testClaims(nil))
+		parts := strings.Split(token, ".")
+		c, _ := json.Marshal(testClaims(map[string]any{"sub": "admin"}))
+		_, err := v.verify(parts[0] + "." + base64.RawURLEncoding.EncodeToString(c) + "." + parts[2])
+		assert.EqualError(t, err, "invalid signature")
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		now := time.Now()
+		v.now = func() time.Time { return now }
+		fetches := iss.fetches.Load()
+		iss.rsaKid.Store("rsa2")
+		token := iss.sign(t, "RS256", "rsa2", testClaims(nil))
+
+		// Неизвестный kid не вызывает загрузку чаще jwksMinRefresh
+		v.fetchedAt = now
+		_, err := v.verify(token)
+		assert.Error(t, err)
+		assert.Equal(t, fetches, iss.fetches.Load())
+
+		now = now.Add(jwksMinRefresh + time.Second)
+		_, err = v.verify(token)
+		assert.NoError(t, err)
+		assert.Equal(t, fetches+1, iss.fetches.Load())
+	})
+}
+
+// TestJWTPrincipal тестирует ограничения клиента JWT по методам и серверам
+func TestJWTPrincipal(t *testing.T) {
+	prx := InitProxy(Global{MaxRequests: 5}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	var unrestricted *authPrincipal
+	assert.True(t, unrestricted.methodAllowed("host.update"))
+	assert.Equal(t, []int{1, 2, 3}, unrestricted.filterServers(prx.config.Servers, []int{1, 2, 3}))
+	assert.Empty(t, unrestricted.scope())
+
+	p := &authPrincipal{name: "grafana", servers: []string{"3", "server1.com"}, methods: []string{"*.get"}}
+	assert.True(t, p.methodAllowed("host.get"))
+	assert.False(t, p.methodAllowed("host.update"))
+	assert.Equal(t, []int{1, 3}, p.filterServers(prx.config.Servers, []int{1, 2, 3}))
+
+	// Ключ общих результатов зависит только от набора разрешенных серверов
+	same := &authPrincipal{name: "other", servers: []string{"server1.com", "3"}}
+	assert.Equal(t, p.scope(), same.scope())
+	assert.NotEqual(t, p.scope(), (&authPrincipal{servers: []string{"3"}}).scope())
+}
+
+// TestAuthMiddleware_JWT тестирует доступ клиента с JWT к API
+func TestAuthMiddleware_JWT(t *testing.T) {
+	iss := newTestIssuer(t)
+	g := Global{MaxRequests: 5, MaxTimeout: "5s", JWT: JWTConf{
+		JWKSURL:      iss.server.URL,
+		Issuer:       "https://sso.example.com",
+		ServersClaim: "servers",
+		MethodsClaim: "methods",
+	}}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.global.maxReqBodySizeInt64 = 1000
+
+	var mu sync.Mutex
+	var called []string
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		mu.Lock()
+		called = append(called, url)
+		mu.Unlock()
+		return map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": 1}, nil
+	}}
+
+	middleware := prx.AuthMiddleware(prx.Handler, "/metrics", "", "", "")
+	send := func(auth, method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"`+method+`","params":{},"id":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		middleware.ServeHTTP(w, req)
+		return w
+	}
+
+	token := iss.sign(t, "RS256", "rsa1", testClaims(map[string]any{
+		"servers": []any{1, "http://server3.com"},
+		"methods": []any{"host.get"},
+	}))
+
+	// Запрос отправлен только на разрешенные серверы
+	w := send("Bearer "+token, "host.get")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"result":[]`)
+	slices.Sort(called)
+	assert.Equal(t, []string{"http://server1.com", "http://server3.com"}, called)
+
+	// Метод не разрешен
+	w = send("Bearer "+token, "item.get")
+	assert.Contains(t, w.Body.String(), "is not permitted for client 'grafana'")
+
+	// Недействительный токен и запрос без JWT отклоняются
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer "+token+"x", "host.get").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("", "host.get").Code)
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+
+	"ZabbixAPIproxy/internal/logger"
+)
+
+// Version версия proxy для страницы статуса, задается при запуске
+var Version = "dev"
+
+// LandingPageConf настройки страницы статуса на GET /
+type LandingPageConf struct {
+	// HTML страница статуса вместо ответа JSON
+	Enabled bool `yaml:"enabled"`
+	// Заголовок страницы, по умолчанию Zabbix API Proxy
+	Title string `yaml:"title"`
+	// Страница доступна только после авторизации, как запросы API
+	Auth bool `yaml:"auth"`
+	// Файл иконки (.ico, .png) вместо встроенной
+	Favicon string `yaml:"favicon"`
+}
+
+const defaultLandingTitle = "Zabbix API Proxy"
+
+// landingServer сервер на странице статуса: только имя и состояние Circuit Breaker
+type landingServer struct {
+	Name  string
+	State string
+}
+
+// landingPage данные страницы статуса
+type landingPage struct {
+	Title      string
+	Version    string
+	Health     HealthReport
+	Servers    []landingServer
+	MetricPath string
+}
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+td, th { padding: 4px 12px; border-bottom: 1px solid #ddd; text-align: left; }
+.OK, .closed { color: #2a7d2a; }
+.DEGRADED, .half-open { color: #b07d00; }
+.DOWN, .open { color: #c0392b; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Version: {{.Version}}</p>
+<p>Status: <b class="{{.Health.Status}}">{{.Health.Status}}</b>, uptime {{.Health.UptimeSec}}s</p>
+<h2>Servers</h2>
+<table>
+<tr><th>Name</th><th>Circuit breaker</th></tr>
+{{range .Servers}}<tr><td>{{.Name}}</td><td class="{{.State}}">{{.State}}</td></tr>
+{{end}}</table>
+<h2>Links</h2>
+<ul>
+<li><a href="/health">/health</a></li>
+<li><a href="/ready">/ready</a></li>
+{{if .MetricPath}}<li><a href="{{.MetricPath}}">{{.MetricPath}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// loadFavicon читает файл иконки landing_page.favicon. nil - используется встроенная иконка
+func loadFavicon(path string) []byte {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Global.Errorf("Failed to read 'landing_page.favicon' %s, using built-in icon: %v", path, err)
+		return nil
+	}
+	return data
+}
+
+// serveFavicon отдает иконку из landing_page.favicon или встроенную
+func (prx *Proxy) serveFavicon(w http.ResponseWriter) {
+	if prx.favicon == nil {
+		faviconHandler(w)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(prx.favicon))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(prx.favicon)
+}
+
+// serveLandingPage отдает HTML страницу статуса: версия, имена серверов с состоянием
+// Circuit Breaker, общее состояние и ссылки на /health и метрики. URL и токены серверов
+// не показываются
+func (prx *Proxy) serveLandingPage(w http.ResponseWriter) {
+	cfg := prx.global.LandingPage
+	page := landingPage{
+		Title:      cfg.Title,
+		Version:    Version,
+		Health:     prx.Health(),
+		MetricPath: prx.global.MetricPath,
+	}
+	if page.Title == "" {
+		page.Title = defaultLandingTitle
+	}
+	if page.MetricPath != "" && !strings.HasPrefix(page.MetricPath, "/") {
+		page.MetricPath = "/" + page.MetricPath
+	}
+
+	stats := map[string]any{}
+	if prx.cb != nil {
+		stats = prx.GetCBStats()
+	}
+	for _, srv := range prx.config.Servers {
+		server := landingServer{Name: srv.Name, State: "unknown"}
+		if s, ok := stats[srv.Name].(map[string]any); ok {
+			if state, ok := s["state"].(string); ok {
+				server.State = state
+			}
+		}
+		page.Servers = append(page.Servers, server)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := landingTemplate.Execute(w, page); err != nil {
+		logger.Global.Errorf("Error rendering landing page: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLandingPage тестирует страницу статуса на GET /
+func TestLandingPage(t *testing.T) {
+	g := Global{MaxRequests: 5, MetricPath: "metrics", LandingPage: LandingPageConf{Enabled: true, Title: "NOC <proxy>"}}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	w := httptest.NewRecorder()
+	prx.AuthMiddleware(prx.Handler, "/metrics", "", "", "")(w, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	body := w.Body.String()
+	assert.Contains(t, body, "NOC &lt;proxy&gt;")
+	assert.Contains(t, body, "server1.com")
+	assert.Contains(t, body, `href="/metrics"`)
+	assert.NotContains(t, body, "http://server1.com", "server URLs are not shown")
+	assert.NotContains(t, body, "token1")
+
+	// Страница с авторизацией отклоняет запрос без учетных данных
+	prx.global.LandingPage.Auth = true
+	w = httptest.NewRecorder()
+	prx.AuthMiddleware(prx.Handler, "/metrics", "admin", "secret", "")(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Body.String(), "server1.com")
+}
+
+// TestServeFavicon тестирует иконку из landing_page.favicon
+func TestServeFavicon(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "icon.png")
+	icon := []byte("\x89PNG\r\n\x1a\n0000")
+	require.NoError(t, os.WriteFile(path, icon, 0o600))
+
+	prx := &Proxy{favicon: loadFavicon(path)}
+	w := httptest.NewRecorder()
+	prx.serveFavicon(w)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, icon, w.Body.Bytes())
+
+	// Недоступный файл - встроенная иконка
+	prx = &Proxy{favicon: loadFavicon(filepath.Join(t.TempDir(), "missing.ico"))}
+	w = httptest.NewRecorder()
+	prx.serveFavicon(w)
+	assert.Equal(t, "image/x-icon", w.Header().Get("Content-Type"))
+}
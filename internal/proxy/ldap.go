@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+
+	"github.com/a3ak/suffix"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	defaultLDAPUserFilter     = "(uid=%s)"
+	defaultLDAPGroupAttribute = "memberOf"
+	defaultLDAPTimeout        = 5 * time.Second
+)
+
+// errInvalidCredentials неверный логин или пароль пользователя каталога
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// Методы, разрешенные группам read_groups
+var readOnlyMethods = []string{"*.get", "apiinfo.*"}
+
+// LDAPConf Basic авторизация пользователей каталога LDAP/AD
+type LDAPConf struct {
+	URL       string `yaml:"url"`        // ldap://host:389 или ldaps://host:636
+	StartTLS  bool   `yaml:"start_tls"`  // StartTLS для ldap://
+	IgnoreSSL bool   `yaml:"ignore_ssl"` // Не проверять сертификат сервера
+	// Учетная запись для поиска пользователей, пусто - анонимный поиск
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	// Фильтр поиска пользователя, %s - логин (по умолчанию (uid=%s), для AD (sAMAccountName=%s))
+	UserFilter string `yaml:"user_filter"`
+	// Атрибут пользователя со списком групп (по умолчанию memberOf) или фильтр
+	// поиска групп пользователя, %s - DN пользователя, например (member=%s)
+	GroupAttribute string `yaml:"group_attribute"`
+	GroupFilter    string `yaml:"group_filter"`
+	// Группы ролей: DN или CN группы
+	ReadGroups  []string `yaml:"read_groups"`
+	AdminGroups []string `yaml:"admin_groups"`
+	CacheTTL    string   `yaml:"cache_ttl"` // Время хранения успешной проверки, по умолчанию 1m
+	Timeout     string   `yaml:"timeout"`   // По умолчанию 5s
+}
+
+// ldapAuth проверка логина и пароля привязкой (bind) к каталогу
+type ldapAuth struct {
+	conf     LDAPConf
+	timeout  time.Duration
+	tlsConf  *tls.Config
+	verified *principalCache
+	now      func() time.Time
+}
+
+// newLDAPAuth создает проверку пользователей каталога или nil, если url не задан
+func newLDAPAuth(cfg LDAPConf) *ldapAuth {
+	if cfg.URL == "" {
+		return nil
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = defaultLDAPUserFilter
+	}
+	if _, err := ldap.CompileFilter(strings.ReplaceAll(cfg.UserFilter, "%s", "x")); err != nil || strings.Count(cfg.UserFilter, "%s") != 1 {
+		logger.Global.Errorf("invalid 'ldap.user_filter' %s, using %s", cfg.UserFilter, defaultLDAPUserFilter)
+		cfg.UserFilter = defaultLDAPUserFilter
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = defaultLDAPGroupAttribute
+	}
+	if len(cfg.ReadGroups) == 0 && len(cfg.AdminGroups) == 0 {
+		logger.Global.Warningf("ldap: read_groups and admin_groups are empty, directory users will be denied")
+	}
+
+	timeout := defaultLDAPTimeout
+	if cfg.Timeout != "" {
+		if s, err := suffix.ToSeconds(cfg.Timeout); err != nil || s == 0 {
+			logger.Global.Errorf("invalid 'ldap.timeout' %s, using %v", cfg.Timeout, defaultLDAPTimeout)
+		} else {
+			timeout = time.Duration(s) * time.Second
+		}
+	}
+
+	// Имя сервера для проверки сертификата при StartTLS
+	tlsConf := &tls.Config{InsecureSkipVerify: cfg.IgnoreSSL}
+	if u, err := url.Parse(cfg.URL); err == nil {
+		tlsConf.ServerName = u.Hostname()
+	}
+
+	return &ldapAuth{
+		conf:     cfg,
+		timeout:  timeout,
+		tlsConf:  tlsConf,
+		verified: newPrincipalCache("ldap.cache_ttl", cfg.CacheTTL),
+		now:      time.Now,
+	}
+}
+
+// dial подключается к серверу по URL ldap:// или ldaps://. Для ldap:// со start_tls
+// соединение переводится в TLS до передачи учетных данных. Соединение закрывается
+// при отмене ctx
+func (l *ldapAuth) dial(ctx context.Context) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: l.timeout}
+	conn, err := ldap.DialURL(l.conf.URL, ldap.DialWithTLSDialer(l.tlsConf, dialer))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(l.timeout)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	if l.conf.StartTLS && strings.HasPrefix(l.conf.URL, "ldap://") {
+		if err := conn.StartTLS(l.tlsConf); err != nil {
+			stop()
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// ldapRejected проверяет, что операция отклонена сервером с кодом результата
+// (sizeLimitExceeded, noSuchObject...), а не прервана ошибкой соединения
+// или клиента (коды go-ldap от ErrorNetwork)
+func ldapRejected(err error) bool {
+	var lerr *ldap.Error
+	return errors.As(err, &lerr) && lerr.ResultCode < ldap.ErrorNetwork
+}
+
+// search ищет записи в поддереве baseDN по фильтру и возвращает указанные атрибуты
+func (l *ldapAuth) search(conn *ldap.Conn, filter string, attrs []string, sizeLimit int) ([]*ldap.Entry, error) {
+	res, err := conn.Search(ldap.NewSearchRequest(l.conf.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		sizeLimit, int(l.timeout/time.Second), false, filter, attrs, nil))
+	if err != nil {
+		return nil, err
+	}
+	return res.Entries, nil
+}
+
+// authenticate проверяет логин и пароль пользователя и определяет его роль по группам.
+// Отказ сервера при поиске и привязке пользователя (в том числе неоднозначный логин
+// или отсутствующий base_dn) - ошибка errInvalidCredentials, ошибки соединения
+// и привязки учетной записи прокси - недоступность каталога
+func (l *ldapAuth) authenticate(ctx context.Context, login, password string) (*authPrincipal, error) {
+	// Привязка с пустым паролем анонимна и всегда успешна (RFC 4513 5.1.2)
+	if login == "" || password == "" {
+		return nil, fmt.Errorf("%w: empty login or password", errInvalidCredentials)
+	}
+	key := sha256.Sum256([]byte(login + "\x00" + password))
+	if p, ok := l.verified.get(key, l.now()); ok {
+		return p, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP connect: %w", err)
+	}
+	defer conn.Close()
+
+	if l.conf.BindDN != "" {
+		if err := conn.Bind(l.conf.BindDN, l.conf.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP service bind: %w", err)
+		}
+	}
+
+	entries, err := l.search(conn, fmt.Sprintf(l.conf.UserFilter, ldap.EscapeFilter(login)), []string{l.conf.GroupAttribute}, 2)
+	if ldapRejected(err) {
+		return nil, fmt.Errorf("%w: user %s search rejected: %v", errInvalidCredentials, login, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LDAP user search: %w", err)
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("%w: user %s not found or ambiguous", errInvalidCredentials, login)
+	}
+	user := entries[0]
+
+	groups := user.GetEqualFoldAttributeValues(l.conf.GroupAttribute)
+	if l.conf.GroupFilter != "" {
+		found, err := l.search(conn, strings.ReplaceAll(l.conf.GroupFilter, "%s", ldap.EscapeFilter(user.DN)), []string{"cn"}, 0)
+		if ldapRejected(err) {
+			return nil, fmt.Errorf("%w: group search of user %s rejected: %v", errInvalidCredentials, login, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("LDAP group search: %w", err)
+		}
+		for _, g := range found {
+			groups = append(groups, g.DN)
+		}
+	}
+
+	// Пароль проверяется привязкой от имени пользователя
+	if err := conn.Bind(user.DN, password); err != nil {
+		if ldapRejected(err) {
+			return nil, fmt.Errorf("%w: bind of user %s rejected: %v", errInvalidCredentials, login, err)
+		}
+		return nil, fmt.Errorf("LDAP user bind: %w", err)
+	}
+
+	p := &authPrincipal{name: login}
+	switch {
+	case ldapMember(groups, l.conf.AdminGroups):
+		p.admin = true
+	case ldapMember(groups, l.conf.ReadGroups):
+		p.methods = readOnlyMethods
+	default:
+		return nil, fmt.Errorf("%w: user %s is not a member of any allowed group", errInvalidCredentials, login)
+	}
+
+	l.verified.put(key, p, l.now().Add(l.verified.ttl), l.now())
+	return p, nil
+}
+
+// ldapMember проверяет, что пользователь входит в одну из групп. Группа конфига
+// сравнивается с DN группы или, если задана без '=', с ее CN (без учета регистра)
+func ldapMember(groups, allowed []string) bool {
+	for _, g := range groups {
+		cn := ""
+		if first, _, _ := strings.Cut(g, ","); strings.HasPrefix(strings.ToLower(first), "cn=") {
+			cn = first[3:]
+		}
+		for _, a := range allowed {
+			if strings.EqualFold(a, g) || (!strings.Contains(a, "=") && strings.EqualFold(a, cn)) {
+				return true
+			}
+		}
+	}
+	return false
+}
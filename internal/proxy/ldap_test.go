@@ -0,0 +1,315 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLDAPServer каталог LDAP для тестов: простая привязка и поиск
+// по фильтрам равенства (в том числе внутри &)
+type testLDAPServer struct {
+	url     string
+	binds   atomic.Int32
+	passwd  map[string]string              // DN - пароль
+	entries map[string]map[string][]string // DN - атрибуты
+}
+
+func newTestLDAPServer(t *testing.T) *testLDAPServer {
+	s := &testLDAPServer{
+		passwd: map[string]string{
+			"cn=proxy,dc=example,dc=com":            "svc",
+			"uid=alice,ou=people,dc=example,dc=com": "alice-pass",
+			"uid=bob,ou=people,dc=example,dc=com":   "bob-pass",
+			"uid=carol,ou=people,dc=example,dc=com": "carol-pass",
+			"uid=dave,ou=people,dc=example,dc=com":  "dave-pass",
+		},
+		entries: map[string]map[string][]string{
+			"uid=alice,ou=people,dc=example,dc=com": {"uid": {"alice"}, "memberOf": {"cn=zabbix-admins,ou=groups,dc=example,dc=com"}},
+			"uid=bob,ou=people,dc=example,dc=com":   {"uid": {"bob"}, "memberOf": {"cn=Zabbix-Readers,ou=groups,dc=example,dc=com"}},
+			"uid=carol,ou=people,dc=example,dc=com": {"uid": {"carol"}, "memberOf": {"cn=staff,ou=groups,dc=example,dc=com"}},
+			// Неоднозначный логин: записей с uid=dave больше предела поиска пользователя
+			"uid=dave,ou=people,dc=example,dc=com":     {"uid": {"dave"}, "memberOf": {"cn=zabbix-admins,ou=groups,dc=example,dc=com"}},
+			"cn=dave,ou=contractors,dc=example,dc=com": {"uid": {"dave"}, "memberOf": {"cn=zabbix-admins,ou=groups,dc=example,dc=com"}},
+			"cn=dave,ou=service,dc=example,dc=com":     {"uid": {"dave"}, "memberOf": {"cn=zabbix-admins,ou=groups,dc=example,dc=com"}},
+			"cn=zabbix-readers,ou=groups,dc=example,dc=com": {"cn": {"zabbix-readers"}, "member": {
+				"uid=carol,ou=people,dc=example,dc=com",
+			}},
+		},
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	s.url = "ldap://" + ln.Addr().String()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// testLDAPResult LDAPResult ответа с кодом результата
+func testLDAPResult(tag ber.Tag, code int) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return p
+}
+
+// testLDAPEntry SearchResultEntry с атрибутами записи
+func testLDAPEntry(dn string, attrs map[string][]string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+	list := ber.NewSequence("")
+	for name, values := range attrs {
+		attr := ber.NewSequence("")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	p.AppendChild(list)
+	return p
+}
+
+// serve обрабатывает сеанс клиента
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	bound := ""
+	for {
+		msg, err := ber.ReadPacket(conn)
+		if err != nil || len(msg.Children) < 2 {
+			return
+		}
+		id, op := msg.Children[0].Value, msg.Children[1]
+		reply := func(ops ...*ber.Packet) {
+			for _, o := range ops {
+				env := ber.NewSequence("")
+				env.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+				env.AppendChild(o)
+				conn.Write(env.Bytes())
+			}
+		}
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			s.binds.Add(1)
+			dn, password := op.Children[1].Value.(string), op.Children[2].Data.String()
+			if p, ok := s.passwd[dn]; ok && p == password {
+				bound = dn
+				reply(testLDAPResult(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess))
+			} else {
+				reply(testLDAPResult(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials))
+			}
+		case ldap.ApplicationSearchRequest:
+			if bound == "" {
+				reply(testLDAPResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			base, sizeLimit := op.Children[0].Value.(string), int(op.Children[3].Value.(int64))
+			baseExists := false
+			var found []*ber.Packet
+			for dn, attrs := range s.entries {
+				if !strings.HasSuffix(dn, base) {
+					continue
+				}
+				baseExists = true
+				if testLDAPEval(op.Children[6], attrs) {
+					found = append(found, testLDAPEntry(dn, attrs))
+				}
+			}
+			switch {
+			case !baseExists:
+				reply(testLDAPResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject))
+			case sizeLimit > 0 && len(found) > sizeLimit:
+				reply(append(found[:sizeLimit], testLDAPResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded))...)
+			default:
+				reply(append(found, testLDAPResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))...)
+			}
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+// testLDAPEval проверяет запись фильтром равенства или их конъюнкцией
+func testLDAPEval(f *ber.Packet, attrs map[string][]string) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, p := range f.Children {
+			if !testLDAPEval(p, attrs) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterEqualityMatch:
+		for name, values := range attrs {
+			if !strings.EqualFold(name, f.Children[0].Data.String()) {
+				continue
+			}
+			for _, v := range values {
+				if strings.EqualFold(v, f.Children[1].Data.String()) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// testLDAPConf настройки проверки пользователей тестового каталога
+func testLDAPConf(url string) LDAPConf {
+	return LDAPConf{
+		URL:          url,
+		BindDN:       "cn=proxy,dc=example,dc=com",
+		BindPassword: "svc",
+		BaseDN:       "dc=example,dc=com",
+		ReadGroups:   []string{"zabbix-readers"},
+		AdminGroups:  []string{"cn=zabbix-admins,ou=groups,dc=example,dc=com"},
+	}
+}
+
+// TestLDAPAuth тестирует проверку пароля привязкой и роли по группам
+func TestLDAPAuth(t *testing.T) {
+	srv := newTestLDAPServer(t)
+	assert.Nil(t, newLDAPAuth(LDAPConf{}))
+	l := newLDAPAuth(testLDAPConf(srv.url))
+	require.NotNil(t, l)
+	ctx := context.Background()
+
+	// Группа администраторов по DN
+	p, err := l.authenticate(ctx, "alice", "alice-pass")
+	require.NoError(t, err)
+	assert.Equal(t, &authPrincipal{name: "alice", admin: true}, p)
+	assert.True(t, p.methodAllowed("host.update"))
+
+	// Группа чтения по CN без учета регистра
+	p, err = l.authenticate(ctx, "bob", "bob-pass")
+	require.NoError(t, err)
+	assert.False(t, p.admin)
+	assert.True(t, p.methodAllowed("host.get"))
+	assert.False(t, p.methodAllowed("host.update"))
+
+	// Пользователь без разрешенных групп, неверный и пустой пароль, неизвестный пользователь
+	for _, c := range [][2]string{{"carol", "carol-pass"}, {"bob", "wrong"}, {"bob", ""}, {"mallory", "x"}, {"*", "bob-pass"}} {
+		_, err = l.authenticate(ctx, c[0], c[1])
+		assert.ErrorIs(t, err, errInvalidCredentials, c[0])
+	}
+
+	// Группы по фильтру поиска групп
+	conf := testLDAPConf(srv.url)
+	conf.GroupFilter = "(member=%s)"
+	p, err = newLDAPAuth(conf).authenticate(ctx, "carol", "carol-pass")
+	require.NoError(t, err)
+	assert.Equal(t, readOnlyMethods, p.methods)
+
+	// Повторная проверка из кеша без обращения к каталогу
+	binds := srv.binds.Load()
+	_, err = l.authenticate(ctx, "alice", "alice-pass")
+	require.NoError(t, err)
+	assert.Equal(t, binds, srv.binds.Load())
+	now := time.Now().Add(defaultPrincipalTTL)
+	l.now = func() time.Time { return now }
+	_, err = l.authenticate(ctx, "alice", "alice-pass")
+	require.NoError(t, err)
+	assert.Greater(t, srv.binds.Load(), binds)
+
+	// Неверная учетная запись прокси и недоступный каталог не являются ошибкой пользователя
+	conf = testLDAPConf(srv.url)
+	conf.BindPassword = "wrong"
+	_, err = newLDAPAuth(conf).authenticate(ctx, "alice", "alice-pass")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errInvalidCredentials)
+	_, err = newLDAPAuth(testLDAPConf("ldap://127.0.0.1:1")).authenticate(ctx, "alice", "alice-pass")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errInvalidCredentials)
+
+	// Отказ сервера при поиске пользователя - неверные учетные данные, а не недоступность каталога:
+	// неоднозначный логин (sizeLimitExceeded) и отсутствующий base_dn (noSuchObject)
+	_, err = l.authenticate(ctx, "dave", "dave-pass")
+	assert.ErrorIs(t, err, errInvalidCredentials)
+	assert.ErrorContains(t, err, "Size Limit Exceeded")
+	conf = testLDAPConf(srv.url)
+	conf.BaseDN = "ou=missing,dc=example,dc=com"
+	_, err = newLDAPAuth(conf).authenticate(ctx, "alice", "alice-pass")
+	assert.ErrorIs(t, err, errInvalidCredentials)
+
+	// Некорректный user_filter заменяется фильтром по умолчанию
+	conf = testLDAPConf(srv.url)
+	conf.UserFilter = "(uid=%s"
+	assert.Equal(t, defaultLDAPUserFilter, newLDAPAuth(conf).conf.UserFilter)
+}
+
+// TestAuthMiddleware_LDAP тестирует доступ пользователей каталога к API и /admin/*
+func TestAuthMiddleware_LDAP(t *testing.T) {
+	srv := newTestLDAPServer(t)
+	g := Global{MaxRequests: 5, MaxTimeout: "5s", LDAP: testLDAPConf(srv.url)}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.global.maxReqBodySizeInt64 = 1000
+	prx.authLock = nil
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		return map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": 1}, nil
+	}}
+
+	middleware := prx.AuthMiddleware(prx.Handler, "/metrics", "admin", "static", "")
+	send := func(login, password, method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"`+method+`","params":{},"id":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		if login != "" {
+			req.SetBasicAuth(login, password)
+		}
+		w := httptest.NewRecorder()
+		middleware.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("bob", "bob-pass", "host.get")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"result":[]`)
+	assert.Contains(t, send("bob", "bob-pass", "host.update").Body.String(), "is not permitted for client 'bob'")
+	assert.Contains(t, send("alice", "alice-pass", "host.update").Body.String(), `"result":[]`)
+
+	// Учетные данные из конфига по-прежнему принимаются
+	assert.Equal(t, http.StatusOK, send("admin", "static", "host.get").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("bob", "wrong", "host.get").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("", "", "host.get").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("dave", "dave-pass", "host.get").Code)
+
+	// /admin/* доступен только группам admin_groups
+	admin := prx.AdminMiddleware(func(w http.ResponseWriter, r *http.Request) {}, "admin", "static", "")
+	sendAdmin := func(login, password string) int {
+		req := httptest.NewRequest("POST", "/admin/cache/flush", nil)
+		req.SetBasicAuth(login, password)
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, sendAdmin("alice", "alice-pass"))
+	assert.Equal(t, http.StatusOK, sendAdmin("admin", "static"))
+	assert.Equal(t, http.StatusForbidden, sendAdmin("bob", "bob-pass"))
+
+	// Недоступный каталог
+	prx.ldap = newLDAPAuth(testLDAPConf("ldap://127.0.0.1:1"))
+	assert.Equal(t, http.StatusServiceUnavailable, send("bob", "bob-pass", "host.get").Code)
+}
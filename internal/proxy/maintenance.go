@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"maps"
+)
+
+// Метод proxy: одно окно обслуживания на всех серверах (заморозка изменений по всему парку)
+const maintenanceCreateAll = "proxy.maintenance.createAll"
+
+// Поля узлов сети и групп окна обслуживания: списки ID (Zabbix до 6.0)
+// и списки объектов hosts/groups (Zabbix 6.0+)
+var (
+	maintenanceIDFields     = []string{"hostids", "groupids"}
+	maintenanceObjectFields = map[string]string{"hosts": "hostid", "groups": "groupid"}
+)
+
+// maintenanceForServer возвращает подготовку запроса proxy.maintenance.createAll к серверу:
+// maintenance.create с узлами сети и группами этого сервера. ProxyID списков hostids/groupids
+// остаются в запросе и преобразуются при отправке, ID объектов hosts/groups заменяются
+// оригинальными ID сервера. Сервер без узлов сети и групп окна пропускается
+func (prx *Proxy) maintenanceForServer(request map[string]any, trace_id string) func(serverID int) (map[string]any, bool) {
+	params, _ := request["params"].(map[string]any)
+	return func(serverID int) (map[string]any, bool) {
+		u := &upstreamRequest{prx: prx, serverID: serverID}
+		serverParams := maps.Clone(params)
+		if serverParams == nil {
+			serverParams = map[string]any{}
+		}
+		targets := 0
+
+		for _, field := range maintenanceIDFields {
+			ids, ok := params[field].([]any)
+			if !ok {
+				continue
+			}
+			var own []any
+			for _, id := range ids {
+				if originalID, ok := u.resolve(field, id, trace_id); ok && originalID != nil {
+					own = append(own, id)
+				}
+			}
+			if len(own) == 0 {
+				delete(serverParams, field)
+				continue
+			}
+			serverParams[field] = own
+			targets += len(own)
+		}
+
+		for field, idField := range maintenanceObjectFields {
+			objects, ok := params[field].([]any)
+			if !ok {
+				continue
+			}
+			var own []any
+			for _, obj := range objects {
+				m, ok := obj.(map[string]any)
+				if !ok {
+					continue
+				}
+				if originalID, ok := u.resolve(idField, m[idField], trace_id); ok && originalID != nil {
+					object := maps.Clone(m)
+					object[idField] = originalID
+					own = append(own, object)
+				}
+			}
+			if len(own) == 0 {
+				delete(serverParams, field)
+				continue
+			}
+			serverParams[field] = own
+			targets += len(own)
+		}
+
+		if targets == 0 {
+			return nil, false
+		}
+		serverRequest := maps.Clone(request)
+		serverRequest["method"] = "maintenance.create"
+		serverRequest["params"] = serverParams
+		return serverRequest, true
+	}
+}
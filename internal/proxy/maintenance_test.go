@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMaintenanceCreateAll тестирует создание окна обслуживания на всех серверах
+func TestMaintenanceCreateAll(t *testing.T) {
+	g := Global{MaxRequests: 5, CoordinatedWrites: CoordinatedWritesConf{Enabled: true, AllowCreate: true}}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.global.maxReqBodySizeInt64 = 1 << 20
+	prx.SetMetrics(NewMockMetricsCollector())
+
+	var mu sync.Mutex
+	sent := map[string]map[string]any{}
+	prx.zbxClient = &MockZabbixClient{SendFunc: func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "maintenance.create", request["method"])
+		sent[url] = request["params"].(map[string]any)
+		return map[string]any{"result": map[string]any{"maintenanceids": []any{"7"}}}, nil
+	}}
+
+	// Grafana ID: оригинальный ID * 10 + ID сервера
+	body := `{"jsonrpc":"2.0","method":"proxy.maintenance.createAll","id":1,"params":{
+		"name":"freeze","active_since":1700000000,"active_till":1700086400,
+		"hostids":["1011","2022"],"groups":[{"groupid":"501"},{"groupid":"601"}]}}`
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	prx.AuthMiddleware(prx.Handler, "/metrics", "", "", "")(w, req)
+
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+	require.Nil(t, response["error"])
+	assert.Len(t, response["result"].(map[string]any)["maintenanceids"], 2)
+
+	// Каждый сервер получает только свои узлы сети и группы с оригинальными ID
+	require.Len(t, sent, 2, "server 3 has no hosts or groups of the window")
+	assert.Equal(t, []any{101}, sent["http://server1.com"]["hostids"])
+	assert.Equal(t, []any{map[string]any{"groupid": 50}, map[string]any{"groupid": 60}}, sent["http://server1.com"]["groups"])
+	assert.Equal(t, []any{202}, sent["http://server2.com"]["hostids"])
+	assert.NotContains(t, sent["http://server2.com"], "groups")
+	assert.Equal(t, "freeze", sent["http://server2.com"]["name"])
+
+	report := response["meta"].(map[string]any)["write_report"].(map[string]any)
+	assert.Equal(t, "complete", report["status"])
+	assert.Equal(t, writeNotApplicable, report["servers"].([]any)[2].(map[string]any)["status"])
+}
+
+// TestMaintenanceCreateAll_Disabled тестирует отказ без coordinated_writes.allow_create
+func TestMaintenanceCreateAll_Disabled(t *testing.T) {
+	prx := InitProxy(Global{MaxRequests: 5}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.global.maxReqBodySizeInt64 = 1 << 20
+	mock := &MockZabbixClient{}
+	prx.zbxClient = mock
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"proxy.maintenance.createAll","params":{"hostids":["1011"]},"id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	prx.AuthMiddleware(prx.Handler, "/metrics", "", "", "")(w, req)
+	assert.Contains(t, w.Body.String(), "coordinated_writes.allow_create")
+	assert.Zero(t, mock.CallCount)
+}
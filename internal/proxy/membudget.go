@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	memBudgetKey ctxKey = "mem_budget"
+
+	// Оценка размера ответа сервера, для которого еще нет измерений
+	defaultRespEstimate = 1 << 20
+	// Коэффициент сглаживания EWMA наблюдаемых размеров ответов
+	respSizeEWMAAlpha = 0.3
+)
+
+// memBudget ограничивает суммарный объем ответов серверов, одновременно
+// находящихся в памяти. Запрос к серверу резервирует оценку размера ответа
+// и ждет, пока в бюджете не освободится место
+type memBudget struct {
+	mu      sync.Mutex
+	limit   int64
+	used    int64
+	waiting int
+	// Закрывается и пересоздается при каждом освобождении бюджета
+	changed chan struct{}
+	// Сглаженные размеры ответов по методу и серверу
+	estimates map[string]int64
+}
+
+// MemBudgetStats состояние бюджета памяти
+type MemBudgetStats struct {
+	Limit   int64
+	Used    int64
+	Waiting int
+}
+
+func newMemBudget(limit int64) *memBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &memBudget{limit: limit, changed: make(chan struct{}), estimates: make(map[string]int64)}
+}
+
+// acquire резервирует n байт, ожидая освобождения бюджета до отмены контекста.
+// Запрос больше всего бюджета выполняется, только когда бюджет свободен
+func (b *memBudget) acquire(ctx context.Context, n int64) error {
+	n = min(n, b.limit)
+	b.mu.Lock()
+	for b.used > 0 && b.used+n > b.limit {
+		wait := b.changed
+		b.waiting++
+		b.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			b.mu.Lock()
+			b.waiting--
+			b.mu.Unlock()
+			return ctx.Err()
+		}
+
+		b.mu.Lock()
+		b.waiting--
+	}
+	b.used += n
+	b.mu.Unlock()
+	return nil
+}
+
+// grow учитывает уже выделенную память сверх резерва без ожидания
+func (b *memBudget) grow(n int64) {
+	b.mu.Lock()
+	b.used += n
+	b.mu.Unlock()
+}
+
+// release возвращает n байт в бюджет и будит ожидающих
+func (b *memBudget) release(n int64) {
+	if n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	close(b.changed)
+	b.changed = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// estimate возвращает ожидаемый размер ответа сервера на метод
+func (b *memBudget) estimate(method, url string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.estimates[method+"\x00"+url]; ok {
+		return e
+	}
+	return defaultRespEstimate
+}
+
+// observe учитывает фактический размер ответа сервера на метод
+func (b *memBudget) observe(method, url string, size int64) {
+	key := method + "\x00" + url
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.estimates[key]; ok {
+		size = int64(respSizeEWMAAlpha*float64(size) + (1-respSizeEWMAAlpha)*float64(e))
+	}
+	b.estimates[key] = size
+}
+
+func (b *memBudget) stats() MemBudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return MemBudgetStats{Limit: b.limit, Used: b.used, Waiting: b.waiting}
+}
+
+// memReservation резерв бюджета памяти одного клиентского запроса.
+// Освобождается после отправки ответа клиенту. Методы безопасны для nil
+type memReservation struct {
+	mu     sync.Mutex
+	budget *memBudget
+	bytes  int64
+}
+
+// withMemReservation создает резерв запроса, если бюджет памяти настроен
+func (prx *Proxy) withMemReservation(ctx context.Context) (context.Context, *memReservation) {
+	if prx.memBudget == nil {
+		return ctx, nil
+	}
+	res := &memReservation{budget: prx.memBudget}
+	return context.WithValue(ctx, memBudgetKey, res), res
+}
+
+// memReservationFromContext возвращает резерв запроса или nil, если бюджет не настроен
+func memReservationFromContext(ctx context.Context) *memReservation {
+	res, _ := ctx.Value(memBudgetKey).(*memReservation)
+	return res
+}
+
+// reserve резервирует оценку размера ответа сервера перед запросом к нему
+func (r *memReservation) reserve(ctx context.Context, method, url string) (int64, error) {
+	if r == nil {
+		return 0, nil
+	}
+	n := min(r.budget.estimate(method, url), r.budget.limit)
+	if err := r.budget.acquire(ctx, n); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	r.bytes += n
+	r.mu.Unlock()
+	return n, nil
+}
+
+// settle приводит резерв к фактическому размеру ответа сервера
+func (r *memReservation) settle(method, url string, reserved, actual int64) {
+	if r == nil {
+		return
+	}
+	r.budget.observe(method, url, actual)
+	if actual <= reserved {
+		return
+	}
+	// Ответ уже в памяти, учитываем превышение без ожидания
+	r.budget.grow(actual - reserved)
+	r.mu.Lock()
+	r.bytes += actual - reserved
+	r.mu.Unlock()
+}
+
+// release освобождает весь резерв запроса
+func (r *memReservation) release() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	n := r.bytes
+	r.bytes = 0
+	r.mu.Unlock()
+	r.budget.release(n)
+}
+
+// Состояние бюджета памяти
+func (prx *Proxy) GetMemBudgetStats() (MemBudgetStats, bool) {
+	if prx.memBudget == nil {
+		return MemBudgetStats{}, false
+	}
+	return prx.memBudget.stats(), true
+}
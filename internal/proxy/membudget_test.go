@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMemBudget_AcquireRelease тестирует ожидание освобождения бюджета памяти
+func TestMemBudget_AcquireRelease(t *testing.T) {
+	b := newMemBudget(100)
+	require.NotNil(t, b)
+	assert.Nil(t, newMemBudget(0))
+
+	require.NoError(t, b.acquire(context.Background(), 60))
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- b.acquire(context.Background(), 60) }()
+
+	require.Eventually(t, func() bool { return b.stats().Waiting == 1 }, time.Second, time.Millisecond)
+	select {
+	case <-acquired:
+		t.Fatal("acquire must wait while budget is exhausted")
+	default:
+	}
+
+	b.release(60)
+	require.NoError(t, <-acquired)
+	assert.Equal(t, MemBudgetStats{Limit: 100, Used: 60}, b.stats())
+
+	// Запрос больше всего бюджета ограничивается размером бюджета
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, b.acquire(ctx, 1000), context.DeadlineExceeded)
+	assert.Equal(t, 0, b.stats().Waiting)
+
+	b.release(60)
+	require.NoError(t, b.acquire(context.Background(), 1000))
+	assert.Equal(t, int64(100), b.stats().Used)
+}
+
+// TestMemReservation тестирует резерв запроса по оценке и фактическому размеру ответа
+func TestMemReservation(t *testing.T) {
+	b := newMemBudget(10 << 20)
+	res := &memReservation{budget: b}
+
+	reserved, err := res.reserve(context.Background(), "item.get", "http://server1.com")
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultRespEstimate), reserved)
+
+	// Ответ больше оценки учитывается полностью, оценка запоминается
+	res.settle("item.get", "http://server1.com", reserved, 3<<20)
+	assert.Equal(t, int64(3<<20), b.stats().Used)
+	assert.Equal(t, int64(3<<20), b.estimate("item.get", "http://server1.com"))
+
+	// Оценка сглаживается EWMA
+	res.settle("item.get", "http://server1.com", 0, 1<<20)
+	assert.Equal(t, int64(2516582), b.estimate("item.get", "http://server1.com"))
+
+	res.release()
+	assert.Equal(t, int64(0), b.stats().Used)
+
+	// Без настроенного бюджета резерв не создается
+	var none *memReservation
+	reserved, err = none.reserve(context.Background(), "item.get", "http://server1.com")
+	assert.NoError(t, err)
+	assert.Zero(t, reserved)
+	none.settle("item.get", "http://server1.com", 0, 100)
+	none.release()
+}
@@ -1,22 +1,42 @@
 package proxy
 
 import (
+	"slices"
 	"time"
 )
 
 // Добавляем интерфейс для метрик в структуру Handler
 type MetricsCollector interface {
-	IncRequestsTotal(method, status string)
+	// client - имя клиента из ограниченного набора (other для клиентов сверх него)
+	IncRequestsTotal(method, status, client string)
 	ObserveResponseSize(size int)
-	ObserveRequestDuration(server, method string, duration time.Duration)
+	// status - success, error, client_error, invalid_*; для запросов клиентов (server
+	// APIproxy) - статус запроса (success, halfError, error)
+	ObserveRequestDuration(server, method, status string, duration time.Duration)
+	// ObserveIDProcessing записывает время преобразования ID запроса и ответов proxy
+	ObserveIDProcessing(method string, duration time.Duration)
+	// ObserveUpstreamRequestSize записывает оценку размера запроса к серверу после преобразования ID
+	ObserveUpstreamRequestSize(method string, size int64)
 	IncRequestStatus(server, rtype string)
 	IncIncomingRequests(server string)
+	AddReconciled(server, action string, count int)
+	ObserveQueueWait(server string, wait time.Duration)
+	IncAuthFailure(reason string)
 }
 
-// Глобальная переменная для метрик
-var metricsCollector MetricsCollector
+// SetMetrics задает сборщик метрик proxy. Сохраняется при перезагрузке конфигурации
+func (prx *Proxy) SetMetrics(collector MetricsCollector) {
+	prx.metrics = collector
+	if prx.coalescer != nil {
+		prx.coalescer.metrics = collector
+	}
+}
 
-// InitMetrics инициализирует сборщик метрик
-func InitMetrics(collector MetricsCollector) {
-	metricsCollector = collector
+// methodMetrics возвращает сборщик метрик для запроса метода
+// или nil, если метрики не собираются или метод исключен из метрик
+func (prx *Proxy) methodMetrics(method string) MetricsCollector {
+	if prx.metrics == nil || slices.Contains(prx.exclude.Metrics, method) {
+		return nil
+	}
+	return prx.metrics
 }
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"context"
+	"time"
+)
+
+// mirrorRequest асинхронно дублирует запрос на тестовый Zabbix (mirror_to).
+// Ответ отбрасывается, ошибки только логируются и учитываются в метриках.
+// Зеркалируются только читающие методы, чтобы не изменить данные на тестовом сервере.
+func (prx *Proxy) mirrorRequest(srv zabbix.ZabbixServer, request map[string]any, trace_id string) {
+	if srv.MirrorTo == "" {
+		return
+	}
+	method, _ := request["method"].(string)
+	if !isReadMethod(method) {
+		return
+	}
+
+	// Ограничиваем количество одновременных зеркальных запросов, лишние отбрасываем
+	semaphore := prx.mirrorSemaphore
+	select {
+	case semaphore <- struct{}{}:
+	default:
+		logger.Global.Debugf("[%s] Mirror queue is full, dropping request to %s", trace_id, srv.MirrorTo)
+		if prx.metrics != nil {
+			prx.metrics.IncRequestStatus(srv.MirrorTo, "mirror_dropped")
+		}
+		return
+	}
+
+	// Клонируем запрос, т.к. исходный будет возвращен в пул.
+	// Токен рабочего сервера никогда не уходит на тестовый: без mirror_token auth удаляется
+	mirrored := deepClone(request).(map[string]any)
+	if srv.MirrorToken != "" {
+		mirrored["auth"] = srv.MirrorToken
+	} else {
+		delete(mirrored, "auth")
+	}
+
+	started := prx.background.start(func(bg context.Context) {
+		defer func() { <-semaphore }()
+		defer returnToPool(mirrored)
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Global.Errorf("panic in mirror goroutine: %v", r)
+			}
+		}()
+
+		// Зеркальный запрос не зависит от жизни клиентского запроса и прерывается остановкой proxy
+		ctx, cancel := context.WithTimeout(bg, time.Duration(prx.global.maxTimeoutInt64)*time.Second)
+		defer cancel()
+
+		startTime := time.Now()
+		if _, err := prx.zbxClient.SendToZabbix(ctx, srv.MirrorTo, srv.IgnoreSSL, mirrored); err != nil {
+			logger.Global.Warningf("[%s] Mirror request to %s failed: %v", trace_id, srv.MirrorTo, err)
+			if prx.metrics != nil {
+				prx.metrics.IncRequestStatus(srv.MirrorTo, "mirror_error")
+				prx.metrics.ObserveRequestDuration(srv.MirrorTo, method, "error", time.Since(startTime))
+			}
+			return
+		}
+
+		if prx.metrics != nil {
+			prx.metrics.IncRequestStatus(srv.MirrorTo, "mirror_success")
+			prx.metrics.ObserveRequestDuration(srv.MirrorTo, method, "success", time.Since(startTime))
+		}
+		logger.Global.Tracef("[%s] Mirror response from %s in %v", trace_id, srv.MirrorTo, time.Since(startTime))
+	})
+	if !started {
+		<-semaphore
+		returnToPool(mirrored)
+	}
+}
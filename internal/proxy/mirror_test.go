@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMirrorRequest тестирует асинхронное дублирование запросов на тестовый сервер
+func TestMirrorRequest(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		mirrored []string
+		done     = make(chan struct{}, 10)
+	)
+
+	mockClient := &MockZabbixClient{
+		SendFunc: func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+			mu.Lock()
+			mirrored = append(mirrored, url+"|"+request["auth"].(string))
+			mu.Unlock()
+			done <- struct{}{}
+			return map[string]any{"result": []any{}}, nil
+		},
+	}
+
+	prx := &Proxy{zbxClient: mockClient, mirrorSemaphore: make(chan struct{}, 2), global: Global{maxTimeoutInt64: 5}}
+
+	srv := zabbix.ZabbixServer{ID: 1, URL: "http://prod/api_jsonrpc.php", Token: "prod", MirrorTo: "http://staging/api_jsonrpc.php", MirrorToken: "staging"}
+
+	// Читающий метод зеркалируется с токеном тестового сервера
+	prx.mirrorRequest(srv, map[string]any{"method": "host.get", "auth": "prod"}, "test-mirror")
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("mirror request was not sent")
+	}
+
+	// Изменяющий метод не зеркалируется
+	prx.mirrorRequest(srv, map[string]any{"method": "host.update", "auth": "prod"}, "test-mirror")
+
+	// Без mirror_to ничего не отправляется
+	srv.MirrorTo = ""
+	prx.mirrorRequest(srv, map[string]any{"method": "host.get", "auth": "prod"}, "test-mirror")
+
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"http://staging/api_jsonrpc.php|staging"}, mirrored)
+}
+
+// TestMirrorRequestPinsSemaphore тестирует, что зеркальный запрос освобождает слот
+// в том семафоре, где его занял, даже если семафор заменен во время запроса
+func TestMirrorRequestPinsSemaphore(t *testing.T) {
+	release := make(chan struct{})
+	mockClient := &MockZabbixClient{
+		SendFunc: func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+			<-release
+			return map[string]any{"result": []any{}}, nil
+		},
+	}
+
+	original := make(chan struct{}, 1)
+	prx := &Proxy{zbxClient: mockClient, mirrorSemaphore: original, global: Global{maxTimeoutInt64: 5}}
+	srv := zabbix.ZabbixServer{ID: 1, MirrorTo: "http://staging/api_jsonrpc.php", MirrorToken: "staging"}
+
+	prx.mirrorRequest(srv, map[string]any{"method": "host.get"}, "test-mirror")
+	require.Equal(t, 1, len(original))
+
+	prx.mirrorSemaphore = make(chan struct{}, 1)
+	close(release)
+	assert.Eventually(t, func() bool { return len(original) == 0 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, len(prx.mirrorSemaphore))
+}
+
+// TestMirrorRequestWithoutToken тестирует, что без mirror_token токен рабочего
+// сервера не отправляется на тестовый
+func TestMirrorRequestWithoutToken(t *testing.T) {
+	sent := make(chan map[string]any, 1)
+	mockClient := &MockZabbixClient{
+		SendFunc: func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+			sent <- deepClone(request).(map[string]any)
+			return map[string]any{"result": []any{}}, nil
+		},
+	}
+
+	prx := &Proxy{zbxClient: mockClient, mirrorSemaphore: make(chan struct{}, 1), global: Global{maxTimeoutInt64: 5}}
+	srv := zabbix.ZabbixServer{ID: 1, URL: "http://prod/api_jsonrpc.php", Token: "prod", MirrorTo: "http://staging/api_jsonrpc.php"}
+
+	request := map[string]any{"method": "host.get", "auth": "prod"}
+	prx.mirrorRequest(srv, request, "test-mirror")
+	select {
+	case mirrored := <-sent:
+		assert.NotContains(t, mirrored, "auth")
+	case <-time.After(2 * time.Second):
+		t.Fatal("mirror request was not sent")
+	}
+	// Исходный запрос к рабочему серверу не изменяется
+	assert.Equal(t, "prod", request["auth"])
+}
@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const defaultNameTemplate = "{name} [{server}]"
+
+// Вложенные списки сущностей в результатах (selectHosts, selectHostGroups...)
+var nestedEntityKeys = map[string]string{"hosts": "host", "groups": "group", "hostgroups": "group"}
+
+// NameDisambiguationConf различение одноименных узлов сети и групп разных серверов.
+// Без него сущности с одинаковым именем получают общий ProxyID и объединяются
+type NameDisambiguationConf struct {
+	Enabled  bool     `yaml:"enabled"`
+	Template string   `yaml:"template"` // Шаблон имени, по умолчанию "{name} [{server}]"
+	Types    []string `yaml:"types"`    // Типы сущностей, по умолчанию host и group
+}
+
+// nameDisambiguation добавляет к именам сущностей сервер по шаблону и восстанавливает
+// имена сервера в фильтрах запросов
+type nameDisambiguation struct {
+	template string
+	// Поля имен различаемых типов сущностей
+	fields map[string]string
+	// Метка сервера для {server} (имя сервера или его ID) и разбор имени сервера по шаблону
+	labels   map[int]string
+	patterns map[int]*regexp.Regexp
+}
+
+// newNameDisambiguation создает различение имен или nil, если оно отключено
+func newNameDisambiguation(cfg NameDisambiguationConf, servers []zabbix.ZabbixServer, nameFields map[string]string) *nameDisambiguation {
+	if !cfg.Enabled {
+		return nil
+	}
+	template := cfg.Template
+	if template == "" {
+		template = defaultNameTemplate
+	}
+	if !strings.Contains(template, "{name}") || !strings.Contains(template, "{server}") {
+		logger.Global.Errorf("invalid 'name_disambiguation.template' %q: {name} and {server} are required, using %q", template, defaultNameTemplate)
+		template = defaultNameTemplate
+	}
+
+	types := cfg.Types
+	if len(types) == 0 {
+		types = []string{"host", "group"}
+	}
+	n := &nameDisambiguation{
+		template: template,
+		fields:   make(map[string]string),
+		labels:   make(map[int]string),
+		patterns: make(map[int]*regexp.Regexp),
+	}
+	for _, t := range types {
+		if field, ok := nameFields[t]; ok {
+			n.fields[t] = field
+		} else {
+			logger.Global.Errorf("unknown 'name_disambiguation.types' %q, expected one of %v", t, slices.Sorted(maps.Keys(nameFields)))
+		}
+	}
+
+	quoted := regexp.QuoteMeta(template)
+	for _, srv := range servers {
+		label := srv.Name
+		if label == "" {
+			label = strconv.Itoa(srv.ID)
+		}
+		n.labels[srv.ID] = label
+		expr := strings.ReplaceAll(quoted, regexp.QuoteMeta("{name}"), "(.+)")
+		expr = strings.ReplaceAll(expr, regexp.QuoteMeta("{server}"), regexp.QuoteMeta(label))
+		n.patterns[srv.ID] = regexp.MustCompile("^" + expr + "$")
+	}
+	return n
+}
+
+// display возвращает имя сущности сервера в объединенном результате
+func (n *nameDisambiguation) display(cacheType, name string, serverID int) string {
+	if n == nil || name == "" {
+		return name
+	}
+	if _, ok := n.fields[cacheType]; !ok {
+		return name
+	}
+	label, ok := n.labels[serverID]
+	if !ok {
+		label = strconv.Itoa(serverID)
+	}
+	return strings.NewReplacer("{name}", name, "{server}", label).Replace(n.template)
+}
+
+// original возвращает имя сущности на сервере serverID по имени из объединенного результата.
+// own == false, если имя с меткой другого сервера. Имя без метки возвращается без изменений
+func (n *nameDisambiguation) original(name string, serverID int) (string, bool) {
+	if pattern, ok := n.patterns[serverID]; ok {
+		if m := pattern.FindStringSubmatch(name); m != nil {
+			return m[1], true
+		}
+	}
+	for id, pattern := range n.patterns {
+		if id != serverID && pattern.MatchString(name) {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// rename добавляет сервер к именам сущностей результата: элементам результата
+// host.get (hostgroup.get) и вложенным спискам hosts, groups, hostgroups
+func (n *nameDisambiguation) rename(method string, result any, serverID int) {
+	if n == nil {
+		return
+	}
+	for cacheType, getMethod := range entityGetMethods {
+		if getMethod == method {
+			n.renameList(cacheType, result, serverID)
+		}
+	}
+	n.renameNested(result, serverID)
+}
+
+// renameList добавляет сервер к именам списка сущностей типа cacheType
+func (n *nameDisambiguation) renameList(cacheType string, list any, serverID int) {
+	field, ok := n.fields[cacheType]
+	if !ok {
+		return
+	}
+	items, _ := list.([]any)
+	for _, item := range items {
+		if m, ok := item.(map[string]any); ok {
+			if name, ok := m[field].(string); ok {
+				m[field] = n.display(cacheType, name, serverID)
+			}
+		}
+	}
+}
+
+// renameNested ищет вложенные списки сущностей в элементах результата
+func (n *nameDisambiguation) renameNested(result any, serverID int) {
+	items, _ := result.([]any)
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		for key, value := range m {
+			if cacheType, ok := nestedEntityKeys[key]; ok {
+				n.renameList(cacheType, value, serverID)
+				n.renameNested(value, serverID)
+			}
+		}
+	}
+}
+
+// localize заменяет в filter и search запроса host.get (hostgroup.get) имена
+// из объединенного результата именами сервера. Параметры клиента не изменяются.
+// Возвращает false, если все имена фильтра относятся к другим серверам
+func (n *nameDisambiguation) localize(method string, params map[string]any, serverID int) (map[string]any, bool) {
+	if n == nil || params == nil {
+		return params, true
+	}
+	var field string
+	for cacheType, getMethod := range entityGetMethods {
+		if getMethod == method {
+			field = n.fields[cacheType]
+		}
+	}
+	if field == "" {
+		return params, true
+	}
+
+	localized, cloned := params, false
+	for _, key := range []string{"filter", "search"} {
+		cond, ok := params[key].(map[string]any)
+		if !ok || cond[field] == nil {
+			continue
+		}
+		var value any
+		switch v := cond[field].(type) {
+		case string:
+			name, own := n.original(v, serverID)
+			if !own {
+				return nil, false
+			}
+			value = name
+		case []any:
+			var names []any
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					names = append(names, item)
+					continue
+				}
+				if name, own := n.original(s, serverID); own {
+					names = append(names, name)
+				}
+			}
+			if len(names) == 0 {
+				return nil, false
+			}
+			value = names
+		default:
+			continue
+		}
+
+		if !cloned {
+			localized, cloned = maps.Clone(params), true
+		}
+		cond = maps.Clone(cond)
+		cond[field] = value
+		localized[key] = cond
+	}
+	return localized, true
+}
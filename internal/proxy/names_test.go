@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNameDisambiguation тестирует имена с сервером и их разбор в фильтрах
+func TestNameDisambiguation(t *testing.T) {
+	servers := []zabbix.ZabbixServer{{ID: 1, Name: "msk"}, {ID: 2}}
+	fields := map[string]string{"host": "name", "group": "name"}
+	assert.Nil(t, newNameDisambiguation(NameDisambiguationConf{}, servers, fields))
+
+	n := newNameDisambiguation(NameDisambiguationConf{Enabled: true, Types: []string{"host"}}, servers, fields)
+	require.NotNil(t, n)
+	assert.Equal(t, "web1 [msk]", n.display("host", "web1", 1))
+	assert.Equal(t, "web1 [2]", n.display("host", "web1", 2), "server without name is labeled by ID")
+	assert.Equal(t, "Linux", n.display("group", "Linux", 1), "group is not in types")
+
+	name, own := n.original("web1 [msk]", 1)
+	assert.True(t, own)
+	assert.Equal(t, "web1", name)
+	_, own = n.original("web1 [msk]", 2)
+	assert.False(t, own, "name of another server")
+	name, own = n.original("web1", 2)
+	assert.True(t, own)
+	assert.Equal(t, "web1", name, "name without label is kept")
+
+	params := map[string]any{"filter": map[string]any{"name": []any{"web1 [msk]", "db1 [2]"}}}
+	localized, ok := n.localize("host.get", params, 1)
+	require.True(t, ok)
+	assert.Equal(t, []any{"web1"}, localized["filter"].(map[string]any)["name"])
+	assert.Equal(t, []any{"web1 [msk]", "db1 [2]"}, params["filter"].(map[string]any)["name"], "client params are not changed")
+
+	_, ok = n.localize("host.get", map[string]any{"search": map[string]any{"name": "db1 [2]"}}, 1)
+	assert.False(t, ok)
+
+	custom := newNameDisambiguation(NameDisambiguationConf{Enabled: true, Template: "{server}/{name}"}, servers, fields)
+	assert.Equal(t, "msk/Linux", custom.display("group", "Linux", 1))
+	name, _ = custom.original("msk/Linux", 1)
+	assert.Equal(t, "Linux", name)
+
+	invalid := newNameDisambiguation(NameDisambiguationConf{Enabled: true, Template: "{name}"}, servers, fields)
+	assert.Equal(t, defaultNameTemplate, invalid.template)
+}
+
+// TestProcessAllServers_NameDisambiguation тестирует различение одноименных узлов сети серверов
+func TestProcessAllServers_NameDisambiguation(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	var mu sync.Mutex
+	calls := make(map[string]map[string]any)
+	mockClient := testProxy.GetMockClient()
+	mockClient.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		mu.Lock()
+		calls[url] = request["params"].(map[string]any)
+		mu.Unlock()
+		hostID := "101"
+		if url == "http://zbx2" {
+			hostID = "202"
+		}
+		return map[string]any{"result": []any{map[string]any{"hostid": hostID, "name": "web1"}}}, nil
+	}
+
+	z := ZabbixConf{
+		Servers: []zabbix.ZabbixServer{
+			{URL: "http://zbx1", ID: 1, Token: "token1", Name: "zbx1"},
+			{URL: "http://zbx2", ID: 2, Token: "token2", Name: "zbx2"},
+		},
+	}
+	g := Global{MaxRequests: 5, StableOrder: true, NameDisambiguation: NameDisambiguationConf{Enabled: true}}
+	testProxy.Init(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+	results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-names")
+	require.Empty(t, errors)
+	hosts := results.([]any)
+	require.Len(t, hosts, 2)
+	first, second := hosts[0].(map[string]any), hosts[1].(map[string]any)
+	assert.Equal(t, "web1 [zbx1]", first["name"])
+	assert.Equal(t, "web1 [zbx2]", second["name"])
+	assert.NotEqual(t, first["hostid"], second["hostid"], "same-named hosts get separate ProxyIDs")
+
+	// Фильтр по имени с сервером отправляется только этому серверу с его именем
+	clear(calls)
+	request = map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 2, "params": map[string]any{
+		"filter": map[string]any{"name": "web1 [zbx2]"},
+	}}
+	results, errors = testProxy.processAllServersWithMock(context.Background(), request, "test-names-filter")
+	require.Empty(t, errors)
+	require.Len(t, results, 1)
+	assert.NotContains(t, calls, "http://zbx1")
+	assert.Equal(t, map[string]any{"name": "web1"}, calls["http://zbx2"]["filter"])
+}
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a3ak/suffix"
+)
+
+// Время хранения промахов по умолчанию
+const defaultNegativeIDTTL = 30 * time.Second
+
+// negativeKey ProxyID, не найденный в кеше для сервера
+type negativeKey struct {
+	cacheType string
+	proxyID   int
+	serverID  int
+}
+
+// negativeIDCache запоминает ProxyID, которых нет в кеше для сервера
+// (например удаленные хосты), что бы повторные запросы по ним не рассылались
+// на сервер. Запись удаляется по TTL или при появлении маппинга
+type negativeIDCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[negativeKey]time.Time // Время истечения записи
+	now     func() time.Time
+}
+
+// newNegativeIDCache создает кеш промахов или nil, если negative_id_ttl равен 0
+func newNegativeIDCache(ttl string) *negativeIDCache {
+	d := defaultNegativeIDTTL
+	if ttl != "" {
+		s, err := suffix.ToSeconds(ttl)
+		if err != nil {
+			logger.Global.Errorf("convert error 'negative_id_ttl' to seconds: %v, using %v", err, defaultNegativeIDTTL)
+		} else {
+			d = time.Duration(s) * time.Second
+		}
+	}
+	if d <= 0 {
+		return nil
+	}
+	return &negativeIDCache{ttl: d, entries: make(map[negativeKey]time.Time), now: time.Now}
+}
+
+// negativeKeyFor формирует ключ по полю запроса (hostids, groupid ...)
+func negativeKeyFor(idField string, proxyID any, serverID int) (negativeKey, bool) {
+	id, ok := toIntID(proxyID)
+	if !ok {
+		return negativeKey{}, false
+	}
+	cacheType := strings.TrimSuffix(strings.TrimSuffix(idField, "ids"), "id")
+	return negativeKey{cacheType: cacheType, proxyID: id, serverID: serverID}, true
+}
+
+// add запоминает промах ProxyID для сервера
+func (c *negativeIDCache) add(idField string, proxyID any, serverID int) {
+	if c == nil {
+		return
+	}
+	key, ok := negativeKeyFor(idField, proxyID, serverID)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	// Удаляем истекшие записи, что бы кеш не рос при переборе несуществующих ID
+	if len(c.entries) >= 1024 {
+		for k, exp := range c.entries {
+			if now.After(exp) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = now.Add(c.ttl)
+}
+
+// missing проверяет, что ProxyID недавно не был найден в кеше для сервера
+func (c *negativeIDCache) missing(idField string, proxyID any, serverID int) bool {
+	if c == nil {
+		return false
+	}
+	key, ok := negativeKeyFor(idField, proxyID, serverID)
+	if !ok {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	exp, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if c.now().After(exp) {
+		delete(c.entries, key)
+		return false
+	}
+	return true
+}
+
+// forget удаляет промах при появлении маппинга ProxyID для сервера
+func (c *negativeIDCache) forget(cacheType string, proxyID, serverID int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.entries, negativeKey{cacheType: cacheType, proxyID: proxyID, serverID: serverID})
+	c.mu.Unlock()
+}
+
+// size возвращает количество записей кеша промахов
+func (c *negativeIDCache) size() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// knownIDsMissing проверяет, что все ID запроса, относящиеся к серверу,
+// являются ProxyID из кеша промахов. Такой запрос к серверу не отправляется
+func (prx *Proxy) knownIDsMissing(request map[string]any, idFields []string, serverID int) bool {
+	if prx.negativeIDs == nil {
+		return false
+	}
+	params, ok := request["params"].(map[string]any)
+	if !ok {
+		return false
+	}
+
+	checked := 0
+	for _, idField := range idFields {
+		ids, ok := params[idField].([]any)
+		if !ok {
+			ids = []any{params[idField]}
+		}
+		for _, id := range ids {
+			switch getServerFromID(id) {
+			case serverID:
+				return false
+			case 0:
+				if !prx.negativeIDs.missing(idField, id, serverID) {
+					return false
+				}
+				checked++
+			}
+		}
+	}
+	return checked > 0
+}
+
+// GetNegativeIDCount возвращает количество ProxyID в кеше промахов
+func (prx *Proxy) GetNegativeIDCount() int {
+	return prx.negativeIDs.size()
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNegativeIDCache тестирует хранение промахов ProxyID
+func TestNegativeIDCache(t *testing.T) {
+	assert.Nil(t, newNegativeIDCache("0"))
+
+	c := newNegativeIDCache("")
+	require.NotNil(t, c)
+	assert.Equal(t, defaultNegativeIDTTL, c.ttl)
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.add("hostids", "12340", 1)
+	assert.True(t, c.missing("hostids", "12340", 1))
+	assert.True(t, c.missing("hostid", 12340.0, 1))
+	assert.False(t, c.missing("hostids", "12340", 2))
+	assert.False(t, c.missing("groupids", "12340", 1))
+
+	// Появление маппинга удаляет промах
+	c.forget("host", 12340, 1)
+	assert.False(t, c.missing("hostids", "12340", 1))
+
+	// Промах истекает по TTL
+	c.add("hostids", "12340", 1)
+	now = now.Add(defaultNegativeIDTTL + time.Second)
+	assert.False(t, c.missing("hostids", "12340", 1))
+	assert.Zero(t, c.size())
+}
+
+// TestProcessAllServers_NegativeIDCache тестирует, что сервер не опрашивается
+// повторно по ProxyID, которого нет в его кеше
+func TestProcessAllServers_NegativeIDCache(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	g := Global{MaxRequests: 10, MaxTimeout: "5s"}
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{
+		{ID: 1, URL: "http://zbx1/api_jsonrpc.php"},
+		{ID: 2, URL: "http://zbx2/api_jsonrpc.php"},
+	}}
+	prx := testProxy.Init(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	// Хост известен только серверу 1
+	proxyID, err := prx.generateProxyID("host", map[string]any{"hostid": "100", "name": "deleted-host"}, 1)
+	require.NoError(t, err)
+
+	request := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "host.get",
+		"params":  map[string]any{"hostids": []any{proxyID}},
+		"id":      1,
+	}
+	mock := testProxy.GetMockClient()
+	// Сервер возвращает запрошенные хосты, что бы маппинги не считались устаревшими
+	mock.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, req map[string]any) (map[string]any, error) {
+		var result []any
+		for _, id := range req["params"].(map[string]any)["hostids"].([]any) {
+			result = append(result, map[string]any{"hostid": id, "name": "deleted-host"})
+		}
+		return map[string]any{"jsonrpc": "2.0", "result": result, "id": req["id"]}, nil
+	}
+
+	// Сервер 2 пропускается после промаха в кеше
+	testProxy.processAllServersWithMock(context.Background(), deepClone(request).(map[string]any), "trace-1")
+	assert.Equal(t, 1, mock.CallCount)
+	assert.Zero(t, testProxy.GetMockMetrics().requestErrors["http://zbx2/api_jsonrpc.php_unknown_id_cached"])
+
+	// Повторно сервер 2 отсекается до занятия слота семафора
+	testProxy.processAllServersWithMock(context.Background(), deepClone(request).(map[string]any), "trace-2")
+	assert.Equal(t, 2, mock.CallCount)
+	assert.Equal(t, 1, testProxy.GetMockMetrics().requestErrors["http://zbx2/api_jsonrpc.php_unknown_id_cached"])
+	assert.Equal(t, 1, prx.GetNegativeIDCount())
+
+	// После появления маппинга сервер снова опрашивается
+	_, err = prx.generateProxyID("host", map[string]any{"hostid": "200", "name": "deleted-host"}, 2)
+	require.NoError(t, err)
+	testProxy.processAllServersWithMock(context.Background(), deepClone(request).(map[string]any), "trace-3")
+	assert.Equal(t, 4, mock.CallCount)
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	defaultPrincipalTTL = time.Minute
+	// Предел числа запомненных учетных данных: при его достижении удаляются
+	// истекшие, а если их не хватило - произвольные записи до 90% предела
+	principalCacheMaxSize = 10000
+)
+
+// oidcEndpoints адреса IdP из документа discovery издателя
+type oidcEndpoints struct {
+	mu            sync.Mutex
+	fetched       bool
+	stale         bool // Introspection не удалась, документ загружается заново
+	fetchedAt     time.Time
+	attemptedAt   time.Time
+	jwksURI       string
+	introspection string
+}
+
+// discover загружает документ discovery издателя и обновляет его по истечении
+// refresh_interval или после ошибки introspection. Загрузка повторяется не чаще
+// jwksMinRefresh, при ошибке используются ранее полученные адреса
+func (v *jwtVerifier) discover() (jwksURI, introspection string) {
+	if !v.conf.Discovery || v.conf.Issuer == "" {
+		return "", ""
+	}
+	e := &v.oidc
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := v.now()
+	due := !e.fetched || e.stale || now.Sub(e.fetchedAt) > v.refresh
+	if due && (e.attemptedAt.IsZero() || now.Sub(e.attemptedAt) > jwksMinRefresh) {
+		e.attemptedAt = now
+		if err := v.fetchDiscovery(e); err != nil {
+			logger.Global.Errorf("OIDC discovery for %s failed: %v", v.conf.Issuer, err)
+		} else {
+			e.fetched, e.stale, e.fetchedAt = true, false, now
+		}
+	}
+	return e.jwksURI, e.introspection
+}
+
+// fetchDiscovery загружает issuer/.well-known/openid-configuration
+func (v *jwtVerifier) fetchDiscovery(e *oidcEndpoints) error {
+	resp, err := v.client.Get(strings.TrimSuffix(v.conf.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		JWKSURI               string `json:"jwks_uri"`
+		IntrospectionEndpoint string `json:"introspection_endpoint"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, jwksMaxBytes)).Decode(&doc); err != nil {
+		return err
+	}
+	// Документ должен принадлежать настроенному издателю (OpenID Connect Discovery 4.3)
+	if doc.Issuer != v.conf.Issuer {
+		return fmt.Errorf("issuer mismatch '%s'", doc.Issuer)
+	}
+	e.jwksURI, e.introspection = doc.JWKSURI, doc.IntrospectionEndpoint
+	return nil
+}
+
+// jwksURL возвращает адрес ключей издателя: jwks_url или jwks_uri из discovery
+func (v *jwtVerifier) jwksURL() string {
+	if v.conf.JWKSURL != "" {
+		return v.conf.JWKSURL
+	}
+	jwks, _ := v.discover()
+	return jwks
+}
+
+// introspectionURL возвращает адрес introspection: introspection_url
+// или introspection_endpoint из discovery
+func (v *jwtVerifier) introspectionURL() string {
+	if v.conf.IntrospectionURL != "" {
+		return v.conf.IntrospectionURL
+	}
+	_, introspection := v.discover()
+	return introspection
+}
+
+// rediscover помечает документ discovery устаревшим, если адрес introspection
+// получен из него: IdP мог сменить endpoint
+func (v *jwtVerifier) rediscover() {
+	if v.conf.IntrospectionURL != "" {
+		return
+	}
+	v.oidc.mu.Lock()
+	v.oidc.stale = true
+	v.oidc.mu.Unlock()
+}
+
+// introspects проверяет, что токены можно проверить у IdP. Через discovery
+// introspection используется, только если заданы учетные данные прокси
+func (v *jwtVerifier) introspects() bool {
+	return v.conf.IntrospectionURL != "" || (v.conf.ClientID != "" && v.introspectionURL() != "")
+}
+
+// introspect проверяет токен запросом к IdP (RFC 7662). Активные токены
+// запоминаются до истечения introspection_cache_ttl или срока действия токена
+func (v *jwtVerifier) introspect(token string) (*authPrincipal, error) {
+	key := sha256.Sum256([]byte(token))
+	if p, ok := v.introspected.get(key, v.now()); ok {
+		return p, nil
+	}
+
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest("POST", v.introspectionURL(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.conf.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.conf.ClientID), url.QueryEscape(v.conf.ClientSecret))
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		v.rediscover()
+		return nil, fmt.Errorf("introspection failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		v.rediscover()
+		return nil, fmt.Errorf("introspection failed: unexpected status %s", resp.Status)
+	}
+
+	var claims map[string]any
+	if err := json.NewDecoder(io.LimitReader(resp.Body, jwksMaxBytes)).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("introspection failed: %w", err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, errors.New("token is not active")
+	}
+	if err := v.checkClaims(claims, false); err != nil {
+		return nil, err
+	}
+	p, err := v.principal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := v.now().Add(v.introspected.ttl)
+	if exp, ok := claims["exp"].(float64); ok {
+		expires = minTime(expires, time.Unix(int64(exp), 0))
+	}
+	v.introspected.put(key, p, expires, v.now())
+	return p, nil
+}
+
+// scopeMethods возвращает методы, разрешенные scope токена (claim scope
+// строкой через пробел или scp массивом)
+func scopeMethods(claims map[string]any, mapping map[string][]string) []string {
+	scopes := claimList(claims["scope"])
+	if len(scopes) == 0 {
+		scopes = claimList(claims["scp"])
+	}
+	methods := []string{}
+	for _, scope := range scopes {
+		methods = append(methods, mapping[scope]...)
+	}
+	return methods
+}
+
+// minTime возвращает более раннее время
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// cachedPrincipal результат проверки учетных данных клиента
+type cachedPrincipal struct {
+	principal *authPrincipal
+	expires   time.Time
+}
+
+// principalCache результаты проверки учетных данных (токенов у IdP, паролей в LDAP)
+// по их SHA-256, чтобы не обращаться к внешнему источнику на каждый запрос
+type principalCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[[sha256.Size]byte]cachedPrincipal
+}
+
+// newPrincipalCache создает кеш с временем хранения ttl (параметр name конфига)
+func newPrincipalCache(name, ttl string) *principalCache {
+	c := &principalCache{ttl: defaultPrincipalTTL, entries: make(map[[sha256.Size]byte]cachedPrincipal)}
+	if ttl != "" {
+		if s, err := suffix.ToSeconds(ttl); err != nil {
+			logger.Global.Errorf("invalid '%s' %s, using %v", name, ttl, defaultPrincipalTTL)
+		} else {
+			c.ttl = time.Duration(s) * time.Second
+		}
+	}
+	return c
+}
+
+// get возвращает клиента для ранее проверенных учетных данных
+func (c *principalCache) get(key [sha256.Size]byte, now time.Time) (*authPrincipal, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.entries[key]
+	if !ok || !now.Before(t.expires) {
+		return nil, false
+	}
+	return t.principal, true
+}
+
+// put запоминает клиента проверенных учетных данных, ttl 0 - не запоминать.
+// Размер кеша ограничен principalCacheMaxSize
+func (c *principalCache) put(key [sha256.Size]byte, p *authPrincipal, expires, now time.Time) {
+	if c.ttl == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= principalCacheMaxSize {
+		for k, t := range c.entries {
+			if !now.Before(t.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < principalCacheMaxSize*9/10 {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedPrincipal{principal: p, expires: expires}
+}
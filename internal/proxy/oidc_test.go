@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIdP провайдер OIDC с discovery и introspection для тестов
+type testIdP struct {
+	server         *httptest.Server
+	issuer         string
+	introspections atomic.Int32
+}
+
+func newTestIdP(t *testing.T, jwksURI string) *testIdP {
+	idp := &testIdP{}
+	// Активные непрозрачные токены и их claims
+	tokens := map[string]map[string]any{
+		"svc-read":  {"active": true, "client_id": "backup-script", "scope": "openid zabbix:read"},
+		"svc-write": {"active": true, "sub": "deployer", "scope": "zabbix:read zabbix:hosts", "exp": float64(time.Now().Add(time.Hour).Unix())},
+		"svc-none":  {"active": true, "client_id": "reporting", "scope": "openid"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 idp.issuer,
+			"jwks_uri":               jwksURI,
+			"introspection_endpoint": idp.server.URL + "/introspect",
+		})
+	})
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		idp.introspections.Add(1)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "zabbix-proxy" || secret != "s3cret" {
+			http.Error(w, "invalid_client", http.StatusUnauthorized)
+			return
+		}
+		claims, ok := tokens[r.PostFormValue("token")]
+		if !ok {
+			claims = map[string]any{"active": false}
+		}
+		json.NewEncoder(w).Encode(claims)
+	})
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// TestOIDCDiscovery тестирует получение адресов IdP из документа discovery
+func TestOIDCDiscovery(t *testing.T) {
+	iss := newTestIssuer(t)
+	idp := newTestIdP(t, iss.server.URL)
+
+	v := newJWTVerifier(JWTConf{Issuer: idp.issuer, Discovery: true, ClientID: "zabbix-proxy", ClientSecret: "s3cret"})
+	require.NotNil(t, v)
+	assert.Equal(t, iss.server.URL, v.jwksURL())
+	assert.Equal(t, idp.server.URL+"/introspect", v.introspectionURL())
+	assert.True(t, v.introspects())
+
+	// JWT проверяется по ключам из jwks_uri
+	p, err := v.verify(iss.sign(t, "RS256", "rsa1", testClaims(map[string]any{"iss": idp.issuer})))
+	require.NoError(t, err)
+	assert.Equal(t, "grafana", p.name)
+
+	// Документ другого издателя не принимается, повтор не чаще jwksMinRefresh
+	idp.issuer = "https://evil.example.com"
+	v = newJWTVerifier(JWTConf{Issuer: idp.server.URL, Discovery: true})
+	now := time.Now()
+	v.now = func() time.Time { return now }
+	assert.Empty(t, v.jwksURL())
+	idp.issuer = idp.server.URL
+	assert.Empty(t, v.jwksURL())
+	now = now.Add(jwksMinRefresh + time.Second)
+	assert.Equal(t, iss.server.URL, v.jwksURL())
+	// Без учетных данных прокси introspection из discovery не используется
+	assert.False(t, v.introspects())
+}
+
+// TestOIDCDiscoveryRefresh тестирует обновление документа discovery по истечении
+// refresh_interval и после ошибки introspection
+func TestOIDCDiscoveryRefresh(t *testing.T) {
+	var discoveries atomic.Int32
+	var down atomic.Bool
+	var endpoint atomic.Value
+	endpoint.Store("/introspect")
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		discoveries.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 server.URL,
+			"introspection_endpoint": server.URL + endpoint.Load().(string),
+		})
+	})
+	mux.HandleFunc("/introspect-v2", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"active": true, "iss": server.URL, "client_id": "backup-script"})
+	})
+
+	v := newJWTVerifier(JWTConf{Issuer: server.URL, Discovery: true, ClientID: "zabbix-proxy", ClientSecret: "s3cret", RefreshInterval: "10m"})
+	require.NotNil(t, v)
+	now := time.Now()
+	v.now = func() time.Time { return now }
+	assert.Equal(t, server.URL+"/introspect", v.introspectionURL())
+	assert.Equal(t, int32(1), discoveries.Load())
+
+	// IdP сменил endpoint: старый отвечает 404, документ загружается заново,
+	// но не чаще jwksMinRefresh
+	endpoint.Store("/introspect-v2")
+	_, err := v.verify("svc-read")
+	assert.ErrorContains(t, err, "404")
+	assert.Equal(t, server.URL+"/introspect", v.introspectionURL())
+	now = now.Add(jwksMinRefresh + time.Second)
+	p, err := v.verify("svc-read")
+	require.NoError(t, err)
+	assert.Equal(t, "backup-script", p.name)
+	assert.Equal(t, int32(2), discoveries.Load())
+
+	// До истечения refresh_interval документ не загружается
+	now = now.Add(5 * time.Minute)
+	v.introspectionURL()
+	assert.Equal(t, int32(2), discoveries.Load())
+
+	// По истечении refresh_interval документ обновляется, при ошибке
+	// сохраняются прежние адреса
+	endpoint.Store("/introspect-v3")
+	now = now.Add(6 * time.Minute)
+	assert.Equal(t, server.URL+"/introspect-v3", v.introspectionURL())
+	assert.Equal(t, int32(3), discoveries.Load())
+	down.Store(true)
+	now = now.Add(11 * time.Minute)
+	assert.Equal(t, server.URL+"/introspect-v3", v.introspectionURL())
+	assert.Equal(t, int32(3), discoveries.Load())
+}
+
+// TestOIDCIntrospection тестирует проверку непрозрачных токенов сервисных
+// учетных записей и права по scope
+func TestOIDCIntrospection(t *testing.T) {
+	idp := newTestIdP(t, "")
+	v := newJWTVerifier(JWTConf{
+		IntrospectionURL: idp.server.URL + "/introspect",
+		ClientID:         "zabbix-proxy",
+		ClientSecret:     "s3cret",
+		ScopeMethods: map[string][]string{
+			"zabbix:read":  {"*.get", "apiinfo.*"},
+			"zabbix:hosts": {"host.*"},
+		},
+	})
+	require.NotNil(t, v)
+
+	// Статический токен прокси сравнивается как раньше, остальные проверяются у IdP
+	assert.False(t, v.accepts("static-token", "static-token"))
+	assert.True(t, v.accepts("svc-read", "static-token"))
+	assert.True(t, v.accepts("svc-read", ""))
+
+	// Имя клиента client credentials берется из client_id
+	p, err := v.verify("svc-read")
+	require.NoError(t, err)
+	assert.Equal(t, &authPrincipal{name: "backup-script", methods: []string{"*.get", "apiinfo.*"}}, p)
+	assert.True(t, p.methodAllowed("host.get"))
+	assert.False(t, p.methodAllowed("host.update"))
+
+	// Повторная проверка из кеша
+	_, err = v.verify("svc-read")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), idp.introspections.Load())
+
+	p, err = v.verify("svc-write")
+	require.NoError(t, err)
+	assert.Equal(t, "deployer", p.name)
+	assert.True(t, p.methodAllowed("host.update"))
+
+	// Scope без сопоставленных методов - методы не разрешены
+	p, err = v.verify("svc-none")
+	require.NoError(t, err)
+	assert.False(t, p.methodAllowed("host.get"))
+
+	_, err = v.verify("revoked")
+	assert.EqualError(t, err, "token is not active")
+
+	// Неверные учетные данные прокси у IdP
+	v.conf.ClientSecret = "wrong"
+	_, err = v.verify("svc-write-2")
+	assert.ErrorContains(t, err, "401")
+}
+
+// TestPrincipalCache тестирует время хранения результатов проверки учетных данных
+func TestPrincipalCache(t *testing.T) {
+	c := newPrincipalCache("test", "")
+	assert.Equal(t, defaultPrincipalTTL, c.ttl)
+
+	now := time.Now()
+	key := [32]byte{1}
+	p := &authPrincipal{name: "svc"}
+	c.put(key, p, now.Add(time.Minute), now)
+	got, ok := c.get(key, now)
+	assert.True(t, ok)
+	assert.Same(t, p, got)
+	_, ok = c.get(key, now.Add(time.Minute))
+	assert.False(t, ok)
+
+	// ttl 0 - результаты не запоминаются
+	c = newPrincipalCache("test", "0")
+	c.put(key, p, now.Add(time.Minute), now)
+	_, ok = c.get(key, now)
+	assert.False(t, ok)
+
+	// Размер кеша ограничен: сначала удаляются истекшие записи, затем произвольные
+	c = newPrincipalCache("test", "")
+	for i := 0; i < principalCacheMaxSize; i++ {
+		expires := now.Add(time.Minute)
+		if i%2 == 0 {
+			expires = now
+		}
+		c.put([32]byte{byte(i), byte(i >> 8), 2}, p, expires, now)
+	}
+	assert.Len(t, c.entries, principalCacheMaxSize)
+	c.put(key, p, now.Add(time.Minute), now)
+	assert.Len(t, c.entries, principalCacheMaxSize/2+1)
+
+	for i := 0; len(c.entries) < principalCacheMaxSize; i++ {
+		c.put([32]byte{byte(i), byte(i >> 8), 3}, p, now.Add(time.Minute), now)
+	}
+	// Обновление существующей записи не вытесняет другие
+	c.put(key, p, now.Add(time.Minute), now)
+	assert.Len(t, c.entries, principalCacheMaxSize)
+	c.put([32]byte{2}, p, now.Add(time.Minute), now)
+	assert.Less(t, len(c.entries), principalCacheMaxSize*9/10+1)
+	_, ok = c.get([32]byte{2}, now)
+	assert.True(t, ok)
+}
@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	pageSizeHeader   = "X-Proxy-Page-Size"
+	pageOffsetHeader = "X-Proxy-Page-Offset"
+	pageCursorHeader = "X-Proxy-Cursor"
+
+	defaultPageTTL     = time.Minute
+	defaultPageMaxSets = 100
+)
+
+// PaginationConf настройки постраничной выдачи объединенных результатов
+type PaginationConf struct {
+	Enabled     bool   `yaml:"enabled"`
+	TTL         string `yaml:"ttl"`           // Время хранения полного результата, по умолчанию 1m
+	MaxSets     int    `yaml:"max_sets"`      // Максимум хранимых результатов, по умолчанию 100
+	MaxPageSize int    `yaml:"max_page_size"` // Максимальный размер страницы, 0 - без ограничения
+}
+
+// pageSet полный объединенный результат, из которого выдаются страницы
+type pageSet struct {
+	results []any
+	expires time.Time
+}
+
+// pageStore хранит полные результаты запросов, выдаваемых постранично,
+// что бы следующие страницы не запрашивались у серверов заново
+type pageStore struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	maxSets     int
+	maxPageSize int
+	sets        map[string]*pageSet
+	now         func() time.Time
+}
+
+// newPageStore создает хранилище страниц или nil, если пагинация отключена
+func newPageStore(cfg PaginationConf) *pageStore {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	ttl := defaultPageTTL
+	if cfg.TTL != "" {
+		if s, err := suffix.ToSeconds(cfg.TTL); err != nil || s == 0 {
+			logger.Global.Errorf("invalid 'pagination.ttl' %s, using %v", cfg.TTL, defaultPageTTL)
+		} else {
+			ttl = time.Duration(s) * time.Second
+		}
+	}
+	maxSets := cfg.MaxSets
+	if maxSets <= 0 {
+		maxSets = defaultPageMaxSets
+	}
+
+	return &pageStore{
+		ttl:         ttl,
+		maxSets:     maxSets,
+		maxPageSize: max(cfg.MaxPageSize, 0),
+		sets:        make(map[string]*pageSet),
+		now:         time.Now,
+	}
+}
+
+// get возвращает сохраненный результат, если он не истек
+func (s *pageStore) get(key string) ([]any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set, ok := s.sets[key]
+	if !ok {
+		return nil, false
+	}
+	if s.now().After(set.expires) {
+		delete(s.sets, key)
+		return nil, false
+	}
+	return set.results, true
+}
+
+// put сохраняет результат. При переполнении удаляются истекшие результаты,
+// а затем результат, истекающий раньше остальных
+func (s *pageStore) put(key string, results []any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if _, ok := s.sets[key]; !ok && len(s.sets) >= s.maxSets {
+		oldest := ""
+		for k, set := range s.sets {
+			if now.After(set.expires) {
+				delete(s.sets, k)
+			} else if oldest == "" || set.expires.Before(s.sets[oldest].expires) {
+				oldest = k
+			}
+		}
+		if len(s.sets) >= s.maxSets {
+			delete(s.sets, oldest)
+		}
+	}
+	s.sets[key] = &pageSet{results: results, expires: now.Add(s.ttl)}
+}
+
+// pageRequest запрошенная клиентом страница результата
+type pageRequest struct {
+	key    string
+	offset int
+	size   int
+	// Страница запрошена по курсору предыдущей страницы
+	cursor bool
+	// Хранилище полных результатов proxy, обрабатывающего запрос
+	pages *pageStore
+}
+
+// parsePageRequest разбирает заголовки пагинации. Возвращает nil, если
+// пагинация отключена, метод не читающий или клиент не запросил страницу
+func (prx *Proxy) parsePageRequest(r *http.Request, method string, request map[string]any) (*pageRequest, error) {
+	if prx.pages == nil || !isReadMethod(method) {
+		return nil, nil
+	}
+
+	if cursor := r.Header.Get(pageCursorHeader); cursor != "" {
+		page, err := decodeCursor(cursor, prx.pages.maxPageSize)
+		if err != nil {
+			return nil, err
+		}
+		// Курсор результата, полученного для других разрешенных серверов
+		if scope := principalFromContext(r.Context()).scope(); !strings.HasSuffix(page.key, scope) {
+			return nil, fmt.Errorf("invalid %s", pageCursorHeader)
+		}
+		page.pages = prx.pages
+		return page, nil
+	}
+
+	sizeHeader := r.Header.Get(pageSizeHeader)
+	if sizeHeader == "" {
+		return nil, nil
+	}
+	size, err := strconv.Atoi(sizeHeader)
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("invalid %s: %s", pageSizeHeader, sizeHeader)
+	}
+	if prx.pages.maxPageSize > 0 {
+		size = min(size, prx.pages.maxPageSize)
+	}
+
+	offset := 0
+	if h := r.Header.Get(pageOffsetHeader); h != "" {
+		if offset, err = strconv.Atoi(h); err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid %s: %s", pageOffsetHeader, h)
+		}
+	}
+
+	key, ok := coalesceKey(method, request)
+	if !ok {
+		return nil, nil
+	}
+	return &pageRequest{key: key + principalFromContext(r.Context()).scope(), offset: offset, size: size, pages: prx.pages}, nil
+}
+
+// cached возвращает сохраненный полный результат для страницы. Первая страница
+// всегда запрашивается у серверов, что бы клиент получал свежие данные
+func (p *pageRequest) cached() ([]any, bool) {
+	if p == nil || (!p.cursor && p.offset == 0) {
+		return nil, false
+	}
+	return p.pages.get(p.key)
+}
+
+// apply сохраняет полный результат (если он получен от серверов) и возвращает
+// запрошенную страницу с описанием для meta ответа. Постранично выдаются только массивы
+func (p *pageRequest) apply(results any, fromCache bool) (any, map[string]any) {
+	list, ok := results.([]any)
+	if !ok {
+		return results, nil
+	}
+	if !fromCache {
+		p.pages.put(p.key, list)
+	}
+
+	total := len(list)
+	start := min(p.offset, total)
+	end := min(start+p.size, total)
+	meta := map[string]any{"total": total, "offset": start, "page_size": p.size}
+	if end < total {
+		meta["next_cursor"] = encodeCursor(p.key, end, p.size)
+	}
+	return list[start:end], meta
+}
+
+// encodeCursor формирует курсор следующей страницы
+func encodeCursor(key string, offset, size int) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%s:%d:%d", key, offset, size))
+}
+
+// decodeCursor разбирает курсор страницы. Размер страницы из курсора, как и из
+// заголовка, ограничивается maxPageSize (0 - без ограничения)
+func decodeCursor(cursor string, maxPageSize int) (*pageRequest, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", pageCursorHeader)
+	}
+	parts := strings.Split(string(data), ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid %s", pageCursorHeader)
+	}
+	offset, err1 := strconv.Atoi(parts[1])
+	size, err2 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || offset < 0 || size <= 0 {
+		return nil, fmt.Errorf("invalid %s", pageCursorHeader)
+	}
+	if maxPageSize > 0 {
+		size = min(size, maxPageSize)
+	}
+	return &pageRequest{key: parts[0], offset: offset, size: size, cursor: true}, nil
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPageStore тестирует хранение полных результатов и их вытеснение
+func TestPageStore(t *testing.T) {
+	assert.Nil(t, newPageStore(PaginationConf{}))
+
+	s := newPageStore(PaginationConf{Enabled: true, MaxSets: 2})
+	require.NotNil(t, s)
+	assert.Equal(t, defaultPageTTL, s.ttl)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	s.put("a", []any{1})
+	now = now.Add(time.Second)
+	s.put("b", []any{2})
+	s.put("c", []any{3})
+
+	// Вытесняется результат, истекающий раньше остальных
+	_, ok := s.get("a")
+	assert.False(t, ok)
+	res, ok := s.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, []any{3}, res)
+
+	now = now.Add(defaultPageTTL + time.Second)
+	_, ok = s.get("c")
+	assert.False(t, ok)
+}
+
+// TestPageCursor тестирует кодирование курсора страницы
+func TestPageCursor(t *testing.T) {
+	page, err := decodeCursor(encodeCursor("abc", 20, 10), 0)
+	require.NoError(t, err)
+	assert.Equal(t, &pageRequest{key: "abc", offset: 20, size: 10, cursor: true}, page)
+
+	// Размер из подделанного курсора не превышает max_page_size
+	page, err = decodeCursor(encodeCursor("abc", 20, 1000000), 100)
+	require.NoError(t, err)
+	assert.Equal(t, 100, page.size)
+	page, err = decodeCursor(encodeCursor("abc", 20, 10), 100)
+	require.NoError(t, err)
+	assert.Equal(t, 10, page.size)
+
+	_, err = decodeCursor("not a cursor", 0)
+	assert.Error(t, err)
+}
+
+// TestHandler_Pagination тестирует постраничную выдачу объединенного результата
+func TestHandler_Pagination(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://server1.com", ID: 1, Token: "token1", Name: "server1"}}}
+	g := Global{MaxRequests: 5, Pagination: PaginationConf{Enabled: true}}
+	prx := testProxy.Init(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	mock := testProxy.GetMockClient()
+	mock.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, req map[string]any) (map[string]any, error) {
+		var result []any
+		for i := 1; i <= 5; i++ {
+			result = append(result, map[string]any{"itemid": fmt.Sprint(i), "name": fmt.Sprintf("item-%d", i)})
+		}
+		return map[string]any{"jsonrpc": "2.0", "result": result, "id": req["id"]}, nil
+	}
+	prx.zbxClient = mock
+
+	body := []byte(`{"jsonrpc":"2.0","method":"item.get","params":{"output":"extend"},"id":1}`)
+	call := func(headers map[string]string) map[string]any {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+		req = req.WithContext(context.WithValue(req.Context(), bodyKey, body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		prx.Handler(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// Первая страница запрашивается у серверов
+	resp := call(map[string]string{pageSizeHeader: "2"})
+	assert.Len(t, resp["result"], 2)
+	meta := resp["meta"].(map[string]any)["pagination"].(map[string]any)
+	assert.Equal(t, 5.0, meta["total"])
+
+	// Следующие страницы выдаются по курсору из сохраненного результата
+	var ids []any
+	for _, item := range resp["result"].([]any) {
+		ids = append(ids, item.(map[string]any)["itemid"])
+	}
+	for meta["next_cursor"] != nil {
+		resp = call(map[string]string{pageCursorHeader: meta["next_cursor"].(string)})
+		for _, item := range resp["result"].([]any) {
+			ids = append(ids, item.(map[string]any)["itemid"])
+		}
+		meta = resp["meta"].(map[string]any)["pagination"].(map[string]any)
+	}
+	assert.Equal(t, []any{"11", "21", "31", "41", "51"}, ids)
+	assert.Equal(t, 1, mock.CallCount)
+
+	// Страница по смещению также берется из сохраненного результата
+	resp = call(map[string]string{pageSizeHeader: "2", pageOffsetHeader: "4"})
+	assert.Len(t, resp["result"], 1)
+	assert.Equal(t, 1, mock.CallCount)
+
+	// Курсор с размером больше max_page_size выдает страницу не больше max_page_size
+	resp = call(map[string]string{pageSizeHeader: "2"})
+	page, err := decodeCursor(resp["meta"].(map[string]any)["pagination"].(map[string]any)["next_cursor"].(string), 0)
+	require.NoError(t, err)
+	prx.pages.maxPageSize = 2
+	resp = call(map[string]string{pageCursorHeader: encodeCursor(page.key, 0, 1000)})
+	assert.Len(t, resp["result"], 2)
+	assert.Equal(t, 2.0, resp["meta"].(map[string]any)["pagination"].(map[string]any)["page_size"])
+
+	// Истекший курсор
+	prx.pages = newPageStore(g.Pagination)
+	resp = call(map[string]string{pageCursorHeader: encodeCursor("gone", 2, 2)})
+	assert.NotNil(t, resp["error"])
+}
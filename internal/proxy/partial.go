@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// для хранения отчета о серверах, не ответивших до истечения таймаута запроса
+const partialKey ctxKey = "partial_timeout"
+
+// Ошибка сервера, не ответившего до истечения таймаута запроса
+const errServerTimeout = "request timeout"
+
+// partialReport серверы, не ответившие до истечения таймаута запроса, когда
+// клиенту возвращаются результаты успевших серверов (partial_on_timeout, soft_timeout)
+type partialReport struct {
+	mu       sync.Mutex
+	timedOut []int
+	// Результаты успевших серверов возвращаются по истечении таймаута запроса
+	onTimeout bool
+}
+
+// withPartialReport сохраняет в контексте отчет о неполном результате, если включен
+// partial_on_timeout или soft_timeout
+func (prx *Proxy) withPartialReport(ctx context.Context) (context.Context, *partialReport) {
+	if !prx.global.PartialOnTimeout && prx.soft == nil {
+		return ctx, nil
+	}
+	report := &partialReport{onTimeout: prx.global.PartialOnTimeout}
+	return context.WithValue(ctx, partialKey, report), report
+}
+
+// partialFromContext возвращает отчет о неполном результате (nil, если partial_on_timeout выключен)
+func partialFromContext(ctx context.Context) *partialReport {
+	report, _ := ctx.Value(partialKey).(*partialReport)
+	return report
+}
+
+// returnOnTimeout сообщает, что по истечении таймаута возвращаются результаты успевших серверов
+func (p *partialReport) returnOnTimeout() bool {
+	return p != nil && p.onTimeout
+}
+
+// add отмечает серверы, не ответившие до истечения таймаута
+func (p *partialReport) add(servers []int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timedOut = append(p.timedOut, servers...)
+}
+
+// partial сообщает, что результат не содержит ответов части серверов
+func (p *partialReport) partial() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.timedOut) > 0
+}
+
+// meta возвращает сведения о неполном результате для meta.partial ответа
+func (p *partialReport) meta(errors []string) map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	servers := slices.Clone(p.timedOut)
+	slices.Sort(servers)
+	servers = slices.Compact(servers)
+	return map[string]any{"timed_out_servers": servers, "errors": errors}
+}
+
+// timedOutServers возвращает серверы, запрошенные или ожидавшие очереди, но не ответившие
+func timedOutServers(queued, launched []int, answered map[int]bool) []int {
+	timedOut := slices.Clone(queued)
+	for _, id := range launched {
+		if !answered[id] {
+			timedOut = append(timedOut, id)
+		}
+	}
+	return timedOut
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// partialTestProxy создает proxy с быстрым (1) и медленным (2) серверами.
+// Без запаса deadline_headroom медленный сервер прерывается таймаутом запроса
+func partialTestProxy(g Global) *Proxy {
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{
+		{URL: "http://fast.com", ID: 1, Token: "token1", Name: "fast"},
+		{URL: "http://slow.com", ID: 2, Token: "token2", Name: "slow"},
+	}}
+	g.MaxRequests = 5
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		if url == "http://slow.com" {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return map[string]any{"jsonrpc": "2.0", "result": []any{map[string]any{"hostid": "10"}}}, nil
+	}}
+	return prx
+}
+
+// TestProcessAllServers_PartialOnTimeout тестирует возврат результатов успевших серверов при таймауте
+func TestProcessAllServers_PartialOnTimeout(t *testing.T) {
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+
+	t.Run("disabled", func(t *testing.T) {
+		prx := partialTestProxy(Global{DeadlineHeadroom: "0"})
+		defer cleanupTestProxy(prx)
+
+		ctx, report := prx.withPartialReport(context.Background())
+		assert.Nil(t, report)
+		ctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+		defer cancel()
+
+		results, errors := prx.processAllServers(ctx, request, "test-partial-off")
+		assert.Nil(t, results)
+		assert.Equal(t, []string{"request timeout"}, errors)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		prx := partialTestProxy(Global{DeadlineHeadroom: "0", PartialOnTimeout: true})
+		defer cleanupTestProxy(prx)
+
+		ctx, report := prx.withPartialReport(context.Background())
+		require.NotNil(t, report)
+		ctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+		defer cancel()
+
+		results, errors := prx.processAllServers(ctx, request, "test-partial")
+		list, ok := results.([]any)
+		require.True(t, ok)
+		require.Len(t, list, 1)
+		assert.Equal(t, "101", list[0].(map[string]any)["hostid"])
+		assert.Equal(t, []string{"http://slow.com: server 2: request timeout"}, errors)
+
+		assert.True(t, report.partial())
+		assert.Equal(t, map[string]any{"timed_out_servers": []int{2}, "errors": errors}, report.meta(errors))
+	})
+
+	// Единственный сервер отмечается в отчете так же, как при нескольких серверах
+	t.Run("single server", func(t *testing.T) {
+		prx := partialTestProxy(Global{DeadlineHeadroom: "0", PartialOnTimeout: true})
+		defer cleanupTestProxy(prx)
+		prx.config.Servers = prx.config.Servers[1:]
+
+		ctx, report := prx.withPartialReport(context.Background())
+		ctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+		defer cancel()
+
+		results, errors := prx.processAllServers(ctx, request, "test-partial-single")
+		assert.Empty(t, results)
+		assert.NotNil(t, results)
+		assert.Equal(t, []string{"http://slow.com: server 2: request timeout"}, errors)
+		assert.Equal(t, []int{2}, report.meta(errors)["timed_out_servers"])
+	})
+}
+
+// TestTimedOutServers тестирует выбор серверов, не ответивших до таймаута
+func TestTimedOutServers(t *testing.T) {
+	assert.Equal(t, []int{3, 2}, timedOutServers([]int{3}, []int{1, 2}, map[int]bool{1: true}))
+	assert.Empty(t, timedOutServers(nil, []int{1, 2}, map[int]bool{1: true, 2: true}))
+
+	var report *partialReport
+	assert.False(t, report.partial())
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/zabbix"
+	"slices"
+)
+
+// Поле с сервером-источником в элементах ответа методов pass_through_methods
+const serverAnnotationField = "zabbix_server"
+
+// isPassThrough проверяет, что ответ метода передается клиенту без преобразования ID
+func (prx *Proxy) isPassThrough(method string) bool {
+	return slices.Contains(prx.global.PassThroughMethods, method)
+}
+
+// idRewrite проверяет, что ID ответов преобразуются в ProxyID (id_rewrite не отключен)
+func (prx *Proxy) idRewrite() bool {
+	return prx.global.IDRewrite == nil || *prx.global.IDRewrite
+}
+
+// annotateServer добавляет в элементы ответа сервер, с которого они получены.
+// ID в таких ответах остаются оригинальными и в кеш не попадают, поэтому
+// клиенту нужен сервер, что бы отличить одинаковые ID разных серверов
+func annotateServer(result any, srv zabbix.ZabbixServer) any {
+	items, ok := result.([]any)
+	if !ok {
+		return result
+	}
+	for _, item := range items {
+		if m, ok := item.(map[string]any); ok {
+			m[serverAnnotationField] = map[string]any{"id": srv.ID, "name": srv.Name}
+		}
+	}
+	return result
+}
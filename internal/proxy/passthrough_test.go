@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProcessAllServers_PassThrough тестирует передачу ответа без преобразования ID
+func TestProcessAllServers_PassThrough(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://server1.com", ID: 1, Token: "token1", Name: "server1"}}}
+	g := Global{MaxRequests: 5, PassThroughMethods: []string{"valuemap.get"}}
+	prx := testProxy.Init(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	// Имя в ответе valuemap.get - имя карты значений, а не хоста
+	testProxy.GetMockClient().SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"result":  []any{map[string]any{"valuemapid": "7", "hostid": "10084", "name": "Service state"}},
+			"id":      request["id"],
+		}, nil
+	}
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "valuemap.get", "id": 1, "params": map[string]any{}}
+	results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-pass-through")
+	require.Empty(t, errors)
+
+	item := results.([]any)[0].(map[string]any)
+	assert.Equal(t, "7", item["valuemapid"])
+	assert.Equal(t, "10084", item["hostid"])
+	assert.Equal(t, map[string]any{"id": 1, "name": "server1.com"}, item[serverAnnotationField])
+
+	// Кеш хостов не засоряется именем карты значений
+	proxyID, _ := prx.cache.CacheType["host"].GetProxyID(10084, 1)
+	assert.Zero(t, proxyID)
+
+	// Остальные методы по-прежнему преобразуют ID
+	request = map[string]any{"jsonrpc": "2.0", "method": "item.get", "id": 1, "params": map[string]any{}}
+	results, _ = testProxy.processAllServersWithMock(context.Background(), request, "test-regular")
+	item = results.([]any)[0].(map[string]any)
+	assert.Equal(t, "71", item["valuemapid"])
+	assert.NotContains(t, item, serverAnnotationField)
+}
+
+// TestProcessAllServers_IDRewriteDisabled тестирует прозрачный режим без преобразования ID
+func TestProcessAllServers_IDRewriteDisabled(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://server1.com", ID: 1, Token: "token1", Name: "server1"}}}
+	rewrite := false
+	g := Global{MaxRequests: 5, IDRewrite: &rewrite}
+	prx := testProxy.Init(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	assert.Nil(t, prx.cache)
+
+	var sent map[string]any
+	testProxy.GetMockClient().SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		sent = deepClone(request).(map[string]any)
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"result":  []any{map[string]any{"itemid": "23", "hostid": "10084", "name": "CPU"}},
+			"id":      request["id"],
+		}, nil
+	}
+
+	// ID запроса передаются серверу без изменений, ID ответа возвращаются оригинальными
+	request := map[string]any{"jsonrpc": "2.0", "method": "item.get", "id": 1, "params": map[string]any{"hostids": []any{"10084"}}}
+	results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-transparent")
+	require.Empty(t, errors)
+	require.NotNil(t, sent)
+	assert.Equal(t, []any{"10084"}, sent["params"].(map[string]any)["hostids"])
+
+	item := results.([]any)[0].(map[string]any)
+	assert.Equal(t, "23", item["itemid"])
+	assert.Equal(t, "10084", item["hostid"])
+	assert.NotContains(t, item, serverAnnotationField)
+}
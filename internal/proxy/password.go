@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Хеш пароля хранится в формате bcrypt ($2a$, $2b$, $2y$) или argon2 в формате PHC:
+// $argon2id$v=19$m=<память КиБ>,t=<итерации>,p=<потоки>$<соль>$<хеш>,
+// соль и хеш в base64 без выравнивания. hash-password выдает argon2id
+const (
+	argon2idPrefix = "$argon2id$"
+	argon2iPrefix  = "$argon2i$"
+
+	// Параметры argon2id для новых хешей (RFC 9106)
+	argon2Memory  = 64 * 1024
+	argon2Time    = 3
+	argon2Threads = 4
+	argon2KeySize = 32
+	argon2Salt    = 16
+)
+
+// phcB64 кодировка соли и хеша argon2
+var phcB64 = base64.RawStdEncoding
+
+// verifiedPasswords пароли, уже проверенные по хешу. bcrypt и argon2 намеренно
+// медленные, а Basic авторизация проверяется на каждом запросе, поэтому успешная
+// проверка запоминается в виде SHA-256 пароля
+var verifiedPasswords sync.Map // хеш из конфига -> [sha256.Size]byte
+
+// argon2Hash разобранный хеш argon2
+type argon2Hash struct {
+	id      bool // argon2id, иначе argon2i
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	sum     []byte
+}
+
+// CheckPasswordHash проверяет формат хеша пароля из конфига (password_hash)
+func CheckPasswordHash(hash string) error {
+	switch {
+	case isBcryptHash(hash):
+		_, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+		return nil
+	case strings.HasPrefix(hash, "$argon2"):
+		_, err := parseArgon2Hash(hash)
+		return err
+	case strings.HasPrefix(hash, "$pbkdf2-sha256$"):
+		return errors.New("pbkdf2-sha256 hashes are no longer supported, generate a new hash with hash-password")
+	default:
+		return errors.New("unknown password hash format, expected bcrypt ($2a$...) or argon2 ($argon2id$...)")
+	}
+}
+
+// isBcryptHash проверяет префикс хеша bcrypt
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// isPasswordHash отличает хеш пароля (password_hash) от пароля в открытом виде
+func isPasswordHash(s string) bool {
+	return isBcryptHash(s) || strings.HasPrefix(s, argon2idPrefix) || strings.HasPrefix(s, argon2iPrefix)
+}
+
+// parseArgon2Hash разбирает хеш argon2id или argon2i. argon2d не поддерживается
+func parseArgon2Hash(hash string) (argon2Hash, error) {
+	var h argon2Hash
+	var rest string
+	switch {
+	case strings.HasPrefix(hash, argon2idPrefix):
+		h.id, rest = true, strings.TrimPrefix(hash, argon2idPrefix)
+	case strings.HasPrefix(hash, argon2iPrefix):
+		rest = strings.TrimPrefix(hash, argon2iPrefix)
+	default:
+		return h, errors.New("unsupported argon2 variant, expected argon2id or argon2i")
+	}
+
+	parts := strings.Split(rest, "$")
+	if len(parts) != 4 {
+		return h, errors.New("invalid argon2 hash: expected version, parameters, salt and checksum")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return h, fmt.Errorf("unsupported argon2 version '%s', expected v=%d", parts[0], argon2.Version)
+	}
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil ||
+		h.memory == 0 || h.time == 0 || h.threads == 0 {
+		return h, fmt.Errorf("invalid argon2 parameters '%s'", parts[1])
+	}
+	var err error
+	if h.salt, err = phcB64.DecodeString(parts[2]); err != nil || len(h.salt) == 0 {
+		return h, errors.New("invalid argon2 hash salt")
+	}
+	if h.sum, err = phcB64.DecodeString(parts[3]); err != nil || len(h.sum) == 0 {
+		return h, errors.New("invalid argon2 hash checksum")
+	}
+	return h, nil
+}
+
+// key вычисляет хеш пароля с параметрами h
+func (h argon2Hash) key(password string) []byte {
+	if h.id {
+		return argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.sum)))
+	}
+	return argon2.Key([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.sum)))
+}
+
+// HashPassword возвращает хеш argon2id пароля для параметра password_hash
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2Salt)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	sum := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeySize)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		argon2Memory, argon2Time, argon2Threads, phcB64.EncodeToString(salt), phcB64.EncodeToString(sum)), nil
+}
+
+// verifyPassword проверяет пароль клиента за постоянное время. expected - пароль
+// из конфига в открытом виде или его хеш (password_hash)
+func verifyPassword(password, expected string) bool {
+	if !isPasswordHash(expected) {
+		return subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+	}
+
+	digest := sha256.Sum256([]byte(password))
+	if v, ok := verifiedPasswords.Load(expected); ok {
+		cached := v.([sha256.Size]byte)
+		return subtle.ConstantTimeCompare(digest[:], cached[:]) == 1
+	}
+
+	if isBcryptHash(expected) {
+		if bcrypt.CompareHashAndPassword([]byte(expected), []byte(password)) != nil {
+			return false
+		}
+	} else {
+		h, err := parseArgon2Hash(expected)
+		if err != nil || subtle.ConstantTimeCompare(h.key(password), h.sum) != 1 {
+			return false
+		}
+	}
+	verifiedPasswords.Store(expected, digest)
+	return true
+}
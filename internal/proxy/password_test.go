@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestVerifyPasswordExternalHashes тестирует проверку хешей, созданных другими
+// инструментами: bcrypt (htpasswd, passlib) и argon2id (argon2-cffi)
+func TestVerifyPasswordExternalHashes(t *testing.T) {
+	tests := []struct {
+		hash, password string
+	}{
+		{"$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", "allmine"},
+		{"$argon2id$v=19$m=65536,t=3,p=4$MIIRqgvgQbgj220jfp0MPA$YfwJSVjtjSU0zzV/P3S9nnQ/USre2wvJMjfCIjrTQbg", "correct horse battery staple"},
+	}
+	for _, tt := range tests {
+		assert.NoError(t, CheckPasswordHash(tt.hash))
+		assert.False(t, verifyPassword(tt.password+"x", tt.hash), tt.hash)
+		assert.True(t, verifyPassword(tt.password, tt.hash), tt.hash)
+		assert.False(t, verifyPassword("", tt.hash), tt.hash)
+	}
+}
+
+// TestHashPassword тестирует формирование и проверку хеша пароля
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("s3cret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$"))
+	assert.NoError(t, CheckPasswordHash(hash))
+
+	// Соль случайная - хеши одного пароля различаются
+	other, err := HashPassword("s3cret")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+
+	assert.True(t, verifyPassword("s3cret", hash))
+	// Повторная проверка использует запомненный результат
+	assert.True(t, verifyPassword("s3cret", hash))
+	assert.False(t, verifyPassword("s3cret2", hash))
+	assert.False(t, verifyPassword("", hash))
+
+	// Пароль в открытом виде
+	assert.True(t, verifyPassword("s3cret", "s3cret"))
+	assert.False(t, verifyPassword("s3cre", "s3cret"))
+}
+
+// TestCheckPasswordHash тестирует отклонение неподдерживаемых и поврежденных хешей
+func TestCheckPasswordHash(t *testing.T) {
+	tests := map[string]string{
+		"$2b$12$R9h/cIPz0gi.URNNX3kh2O":                "invalid bcrypt hash",
+		"$argon2d$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA":  "argon2id or argon2i",
+		"$argon2id$v=16$m=65536,t=3,p=4$c2FsdA$aGFzaA": "version",
+		"$argon2id$v=19$m=0,t=3,p=4$c2FsdA$aGFzaA":     "parameters",
+		"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA":        "expected version",
+		"$argon2id$v=19$m=65536,t=3,p=4$!!$aGFzaA":     "salt",
+		"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$":       "checksum",
+		"$pbkdf2-sha256$100000$c2FsdA$aGFzaA":          "no longer supported",
+		"plaintext":                                    "unknown",
+	}
+	for hash, want := range tests {
+		err := CheckPasswordHash(hash)
+		if assert.Error(t, err, hash) {
+			assert.Contains(t, err.Error(), want, hash)
+		}
+	}
+}
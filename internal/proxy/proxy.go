@@ -7,10 +7,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"reflect"
 	"runtime"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/a3ak/circuitbreaker"
@@ -26,12 +29,39 @@ type CacheConf cache.CacheCfg
 // Структура для конфигурации zabbix server
 type ZabbixConf zabbix.Zabbix
 
+// Структура для конфигурации метрик
+type MetricsConf struct {
+	// Методы, по которым не собираются метрики запросов
+	ExcludeMethods []string `yaml:"exclude_methods"`
+}
+
+// Структура для конфигурации трассировки
+type TracingConf struct {
+	// Методы, для которых не логируется обмен с серверами и не работает самописец
+	ExcludeMethods []string `yaml:"exclude_methods"`
+}
+
+// ExcludeMethods методы, исключаемые из логирования, метрик и трассировки
+type ExcludeMethods struct {
+	Log     []string
+	Metrics []string
+	Tracing []string
+}
+
 // Структура для конфигурации proxy
 type Global struct {
 	ListenAddr string `yaml:"listen_addr"`
 	Token      string `yaml:"token"`
 	Login      string `yaml:"login"`
 	Password   string `yaml:"password"`
+	// Хеш пароля вместо password (bcrypt или argon2), чтобы конфиг не содержал пароль
+	PasswordHash string `yaml:"password_hash"`
+	// Временная блокировка адресов клиентов после неудачных попыток авторизации
+	AuthLockout AuthLockoutConf `yaml:"auth_lockout"`
+	// Авторизация клиентов по JWT издателя (SSO)
+	JWT JWTConf `yaml:"jwt"`
+	// Basic авторизация пользователей каталога LDAP/AD
+	LDAP LDAPConf `yaml:"ldap"`
 
 	ReadTimeout     string `yaml:"read_timeout"`
 	WriteTimeout    string `yaml:"write_timeout"`
@@ -39,42 +69,247 @@ type Global struct {
 	MaxTimeout      string `yaml:"max_timeout"`
 	maxTimeoutInt64 int64
 
+	// Ограничения входящих соединений (защита от slowloris и медленных клиентов)
+	ReadHeaderTimeout string `yaml:"read_header_timeout"`
+	MaxHeaderBytes    string `yaml:"max_header_bytes"`
+	MaxConnections    int    `yaml:"max_connections"`
+
 	MaxReqBodySize      string `yaml:"max_req_body_size"`
 	MaxRequests         int    `yaml:"max_requests"`
 	maxReqBodySizeInt64 int64
 
+	// Лимит размера объединенного результата для клиента, пусто - без ограничения
+	MaxRespBodySize      string `yaml:"max_resp_body_size"`
+	maxRespBodySizeInt64 int64
+
+	// Лимит размера запроса к одному серверу после преобразования ID, по умолчанию 4MB, 0 - без ограничения
+	MaxUpstreamReqSize      string `yaml:"max_upstream_req_size"`
+	maxUpstreamReqSizeInt64 int64
+
+	// Бюджет памяти под одновременно обрабатываемые ответы серверов, пусто - без ограничения
+	MemoryBudget string `yaml:"memory_budget"`
+
 	MetricPath      string `yaml:"metric_path"`
 	MonitoringInLog bool   `yaml:"monitoring_in_log"`
+	// Период обновления метрик, собираемых опросом (кеш, Circuit Breaker, соединения), по умолчанию 30s
+	MetricsUpdateInterval string `yaml:"metrics_update_interval"`
+
+	// Заголовки безопасности ответов (Strict-Transport-Security, X-Content-Type-Options)
+	SecurityHeaders SecurityHeadersConf `yaml:"security_headers"`
+	// Не отвечать на GET / и /favicon.ico информацией о прокси (404)
+	HideInfo bool `yaml:"hide_info"`
+	// HTML страница статуса на GET / и иконка
+	LandingPage LandingPageConf `yaml:"landing_page"`
+	// Веб-интерфейс администратора /admin/ui
+	AdminUI bool `yaml:"admin_ui"`
+	// Файл токенов API, выпускаемых и отзываемых через /admin/tokens (веб-интерфейс администратора)
+	TokensFile string `yaml:"tokens_file"`
+
+	// Режим только для чтения: пропускаются только методы *.get и apiinfo.*
+	ReadOnly bool `yaml:"read_only"`
+
+	// Поля, удаляемые из результата перед отправкой клиенту: метод -> список путей
+	DropFields map[string][]string `yaml:"drop_fields"`
+
+	// Повторно искать сущность по имени после удаления устаревшего маппинга из кеша
+	ReresolveStale bool `yaml:"reresolve_stale"`
+
+	// Время хранения ProxyID, не найденных в кеше для сервера, 0 - не хранить (по умолчанию 30s)
+	NegativeIDTTL string `yaml:"negative_id_ttl"`
+
+	// Интервал фоновой сверки маппингов кеша с серверами
+	ReconcileInterval string `yaml:"reconcile_interval"`
+
+	// Стратегии рассылки запросов по методам, применяется первая подходящая запись
+	Routing []RouteConf `yaml:"routing"`
+
+	// Методы, ответы которых передаются без преобразования ID и без записи в кеш,
+	// с указанием сервера в каждом элементе (например usermacro.get, valuemap.get)
+	PassThroughMethods []string `yaml:"pass_through_methods"`
+
+	// Преобразование ID (ProxyID), по умолчанию true. false - прозрачный режим для одного
+	// сервера: ID передаются без изменений, кеш не используется
+	IDRewrite *bool `yaml:"id_rewrite"`
+
+	// Детерминированный порядок объединения: по ID сервера, затем в порядке ответа сервера
+	StableOrder bool `yaml:"stable_order"`
+
+	// Объединение одинаковых одновременных читающих запросов (singleflight)
+	CoalesceRequests bool `yaml:"coalesce_requests"`
+
+	// Совместимость с источником данных Grafana-Zabbix: замена методов, отсутствующих
+	// в версии сервера (application.get, trend.get)
+	GrafanaCompat bool `yaml:"grafana_compat"`
+	// Замена приложений для серверов Zabbix 5.4+ в режиме grafana_compat:
+	// empty (по умолчанию) - пустой результат, tags - приложения из тегов Application
+	ApplicationMode string `yaml:"application_mode"`
+
+	// Постраничная выдача объединенных результатов по заголовкам X-Proxy-Page-*
+	Pagination PaginationConf `yaml:"pagination"`
+
+	// Квота элементов одного сервера в объединенном результате
+	ServerQuota ServerQuotaConf `yaml:"server_quota"`
+
+	// Различение одноименных узлов сети и групп разных серверов
+	NameDisambiguation NameDisambiguationConf `yaml:"name_disambiguation"`
+
+	// Одноименные узлы сети разных серверов - один логический узел с общими элементами данных
+	HostMerge bool `yaml:"host_merge"`
+
+	// Списки значений переменных Grafana (POST /grafana/variables)
+	GrafanaVariables GrafanaVariablesConf `yaml:"grafana_variables"`
+
+	// Ключи идемпотентности изменяющих запросов (заголовок X-Idempotency-Key)
+	Idempotency IdempotencyConf `yaml:"idempotency"`
+
+	// Согласованная запись на несколько серверов с отчетом о ручном откате (X-Proxy-Write-Mode)
+	CoordinatedWrites CoordinatedWritesConf `yaml:"coordinated_writes"`
+
+	// Ответ на запрос по ID, не относящимся ни к одному серверу: error (по умолчанию) или empty
+	UnknownIDs string `yaml:"unknown_ids"`
+
+	// Шаблоны имен полей (path.Match, без учета регистра), скрываемых в логах запросов
+	// и ответов на любой вложенности. Пароли и секреты скрываются всегда
+	RedactFields []string `yaml:"redact_fields"`
+
+	// Бортовой самописец: захват запросов и ответов для воспроизведения ошибок
+	FlightRecorder FlightRecorderConf `yaml:"flight_recorder"`
+
+	// Пара active/passive (warm standby)
+	HA HAConf `yaml:"ha"`
+
+	// Критичность зависимостей для общего состояния /health
+	Health HealthConf `yaml:"health"`
+
+	// Пауза в запросах к серверам, ограничившим частоту (HTTP 429, 503 с Retry-After)
+	RetryAfter RetryAfterConf `yaml:"retry_after"`
+
+	// При таймауте запроса ко всем серверам возвращать результаты успевших серверов
+	// с ошибками таймаута остальных в meta.partial вместо ошибки
+	PartialOnTimeout bool `yaml:"partial_on_timeout"`
+
+	// На сколько запросы к серверам завершаются раньше таймаута запроса клиента,
+	// чтобы осталось время объединить и отправить ответ. По умолчанию 1s, 0 - без запаса
+	DeadlineHeadroom string `yaml:"deadline_headroom"`
+	deadlineHeadroom time.Duration
+
+	// Мягкий таймаут читающих запросов: клиент получает результаты успевших серверов,
+	// а сбор ответов продолжается в фоне до жесткого таймаута (по умолчанию max_timeout).
+	// Полный результат отдается одинаковым запросам в течение soft_timeout_ttl (по умолчанию 1m)
+	SoftTimeout    string `yaml:"soft_timeout"`
+	HardTimeout    string `yaml:"hard_timeout"`
+	SoftTimeoutTTL string `yaml:"soft_timeout_ttl"`
+
+	// Сколько после soft_timeout_ttl устаревший результат отдается сразу, пока
+	// он обновляется в фоне (stale-while-revalidate). По умолчанию 0 - не отдается
+	StaleWhileRevalidate string `yaml:"stale_while_revalidate"`
 }
 
-// Структура Proxy
-type proxy struct {
+// Proxy экземпляр прокси: конфигурация, кеш, клиенты серверов и состояние подсистем.
+// Создается InitProxy
+type Proxy struct {
+	// Иконка из landing_page.favicon (nil - встроенная)
+	favicon []byte
+
 	// Имена ID сущностей для которых требуется генерация ID и поле по которому генерируется хеш
 	cachedFields map[string]string
+	// Хеш имени сущности и размер пространства ProxyID (10^digits)
+	idHash  func(string) uint64
+	idSpace int
 
-	// перечень методов которые требуется исключить из Trace логирования
-	excludeRequests []string
+	// Перечни методов, исключаемых из логирования, метрик и трассировки
+	exclude ExcludeMethods
 
 	// Переменная для кеша
-	cache *cache.CacheEntry
+	cache    *cache.CacheEntry
+	cacheCfg CacheConf
+
+	// Бортовой самописец (nil, если не настроен)
+	recorder *flightRecorder
 
 	// Переменная для Circuit Breaker
-	cb *circuitbreaker.CBManager
+	cb     *circuitbreaker.CBManager
+	cbConf CBConf
+
+	// Объединение одинаковых одновременных запросов (nil - отключено)
+	coalescer *requestGroup
+	// Мягкий и жесткий таймауты запросов (nil, если soft_timeout не задан)
+	soft *softTimeouts
+	// Проверенная таблица маршрутизации методов
+	routes []RouteConf
+	// Шаблоны полей, скрываемых в логах
+	redactFields []string
+	// Полные результаты для постраничной выдачи (nil, если пагинация отключена)
+	pages *pageStore
+	// Списки значений переменных Grafana
+	variables *variableStore
+	// Ответы изменяющих запросов по ключам идемпотентности (nil, если отключено)
+	idempotency *idempotencyStore
+	// Методы, отсутствующие в версиях серверов (nil, если grafana_compat отключен)
+	compat *compatState
+	// Различение одноименных сущностей разных серверов (nil, если отключено)
+	names *nameDisambiguation
+
+	// Неудачные попытки авторизации по адресам клиентов (nil - без блокировки)
+	authLock *authLockout
+	// Проверка JWT клиентов (nil - JWT не принимаются)
+	jwt *jwtVerifier
+	// Проверка пользователей каталога (nil - LDAP не используется)
+	ldap *ldapAuth
+	// Токены API, выпущенные через /admin/tokens (nil - tokens_file не задан)
+	tokens *tokenStore
+
+	// Бюджет памяти под ответы серверов (nil - отключен)
+	memBudget *memBudget
+
+	// Статистика запросов клиентов для /admin/top и метки client в метриках
+	usage *clientUsage
+
+	// Балансировщики серверов с репликами (по ID сервера)
+	balancers map[int]*replicaBalancer
+
+	// Ограничители частоты запросов к серверам (по ID сервера)
+	rateLimiters map[int]*tokenBucket
+	// ProxyID, недавно не найденные в кеше (nil, если отключено)
+	negativeIDs *negativeIDCache
+	// Паузы серверов, ограничивших частоту запросов (HTTP 429)
+	throttle *upstreamThrottle
 
 	// Глобальный конфиг proxy
 	global Global
 
 	// Список zabbix серверов из конфига
 	config ZabbixConf
+	// Конфиг серверов в исходном виде, без обнаруженных discovery (для перезагрузки)
+	configured ZabbixConf
 
 	// Добавляем переменную для лимита одновременных запросов
 	requestSemaphore chan struct{}
+	// Справедливое распределение слотов requestSemaphore между клиентами
+	scheduler *fairSemaphore
+
+	// Лимит одновременных зеркальных запросов (mirror_to)
+	mirrorSemaphore chan struct{}
 
 	zbxClient zabbix.ZabbixClient
+
+	// Остановка фоновой сверки кеша
+	stopReconcile context.CancelFunc
+	// Остановка прогрева соединений (nil, если прогрев отключен)
+	stopWarmUp context.CancelFunc
+	// Фоновые задачи, останавливаемые перед перезагрузкой конфигурации
+	background *backgroundTasks
+
+	// Сборщик метрик (nil - метрики не собираются)
+	metrics MetricsCollector
+
+	// Время запуска и последней перезагрузки конфигурации (для /health)
+	startedAt  time.Time
+	reloadedAt time.Time
 }
 
 // Инициализация первичных параметров proxy
-func NewProxy(g Global, z ZabbixConf, excludeLog []string) proxy {
+func NewProxy(g Global, z ZabbixConf, exclude ExcludeMethods) Proxy {
 
 	// Защита от zero value MaxRequests
 	maxRequests := g.MaxRequests
@@ -83,47 +318,196 @@ func NewProxy(g Global, z ZabbixConf, excludeLog []string) proxy {
 		logger.Global.Warningf("max_requests is 0 or negative, using default: 100")
 	}
 
-	return proxy{cachedFields: map[string]string{"host": "name", "group": "name"},
-		requestSemaphore: make(chan struct{}, maxRequests),
+	var coalescer *requestGroup
+	if g.CoalesceRequests {
+		coalescer = newRequestGroup()
+	}
+
+	var budget int64
+	if g.MemoryBudget != "" {
+		b, err := suffix.ToB(g.MemoryBudget)
+		if err != nil {
+			logger.Global.Errorf("convert error 'memory_budget' to bytes: %v", err)
+		}
+		budget = b
+	}
+
+	requestSemaphore := make(chan struct{}, maxRequests)
+
+	cachedFields := map[string]string{"host": "name", "group": "name"}
+
+	return Proxy{cachedFields: cachedFields,
+		favicon:          loadFavicon(g.LandingPage.Favicon),
+		requestSemaphore: requestSemaphore,
+		scheduler:        newFairSemaphore(requestSemaphore),
+		mirrorSemaphore:  make(chan struct{}, maxRequests),
 		global:           g,
 		config:           z,
-		excludeRequests:  excludeLog,
+		exclude:          exclude,
+		recorder:         newFlightRecorder(g.FlightRecorder),
+		idHash:           idHashFuncs[defaultIDHash],
+		idSpace:          pow10(defaultIDDigits),
+		balancers:        make(map[int]*replicaBalancer),
+		rateLimiters:     make(map[int]*tokenBucket),
+		negativeIDs:      newNegativeIDCache(g.NegativeIDTTL),
+		throttle:         newUpstreamThrottle(g.RetryAfter),
+		coalescer:        coalescer,
+		pages:            newPageStore(g.Pagination),
+		variables:        newVariableStore(g.GrafanaVariables),
+		idempotency:      newIdempotencyStore(g.Idempotency),
+		compat:           newCompatState(g),
+		names:            newNameDisambiguation(g.NameDisambiguation, z.Servers, cachedFields),
+		usage:            newClientUsage(),
+		authLock:         newAuthLockout(g.AuthLockout),
+		jwt:              newJWTVerifier(g.JWT),
+		ldap:             newLDAPAuth(g.LDAP),
+		tokens:           newTokenStore(g.TokensFile),
+		routes:           checkRoutes(g.Routing),
+		redactFields:     checkRedactFields(g.RedactFields),
+		memBudget:        newMemBudget(budget),
+		background:       newBackgroundTasks(),
 	}
 }
 
-var (
-	prx proxy
-)
+// AuthPassword возвращает пароль Basic авторизации клиентов: хеш из password_hash,
+// если задан, иначе password
+func (g Global) AuthPassword() string {
+	if g.PasswordHash != "" {
+		return g.PasswordHash
+	}
+	return g.Password
+}
+
+// configSecrets возвращает токены серверов Zabbix и учетные данные клиентов из конфига
+func configSecrets(g Global, cfg ZabbixConf) []string {
+	secrets := []string{g.Token, g.Password, g.JWT.ClientSecret, g.LDAP.BindPassword, g.HA.PeerToken, cfg.Discovery.Token, cfg.Discovery.ConsulToken}
+	for _, srv := range cfg.Servers {
+		secrets = append(secrets, srv.Token, srv.MirrorToken, srv.CanaryToken)
+	}
+	return secrets
+}
+
+// InitProxy создает и инициализирует proxy. Экземпляры независимы: в одном процессе
+// можно запустить несколько proxy с разными конфигурациями. Общими остаются роль
+// узла HA и заголовки безопасности ответов
+func InitProxy(g Global, cfg ZabbixConf, cbConf CBConf, cacheCfg CacheConf, exclude ExcludeMethods) *Proxy {
+	prx := &Proxy{}
+	prx.initProxy(g, cfg, cbConf, cacheCfg, exclude, nil)
+	return prx
+}
+
+// initProxy инициализирует proxy. При перезагрузке конфигурации old - прежнее состояние,
+// его подсистемы с неизменными параметрами переносятся в новое (см. Reload).
+// Возвращает перезапущенные подсистемы прежнего proxy
+func (prx *Proxy) initProxy(g Global, cfg ZabbixConf, cbConf CBConf, cacheCfg CacheConf, exclude ExcludeMethods, old *Proxy) []string {
+	var restarted []string
 
-// Инициализация Proxy
-func InitProxy(g Global, cfg ZabbixConf, cbConf CBConf, cacheCfg CacheConf, excludeLog []string) {
+	// Имена серверов задаются в копии списка, конфиг вызывающего не изменяется
+	configured := cfg
+	cfg.Servers = slices.Clone(cfg.Servers)
 
 	//Инициализвция нового прохи
-	prx = NewProxy(g, cfg, excludeLog)
+	*prx = NewProxy(g, cfg, exclude)
+	prx.configured = configured
+	if old != nil {
+		prx.keepState(old)
+	} else {
+		prx.startedAt = time.Now()
+	}
+	validateHealthConf(g.Health)
+
+	// Токены и пароли не должны попадать в логи и ошибки
+	logger.SetSecrets(configSecrets(g, cfg)...)
+
+	headers := newSecurityHeaders(g.SecurityHeaders)
+	securityHeaders.Store(&headers)
 
 	// Подготовка имен серверов и инициализация клиента Zabbix
 	zbxNames := make([]string, 0, len(cfg.Servers))
 	for i := range cfg.Servers {
-		// Безопасное извлечение имени из URL
-		if urlParts := strings.Split(cfg.Servers[i].URL, "/"); len(urlParts) > 2 {
-			cfg.Servers[i].Name = urlParts[2]
-			zbxNames = append(zbxNames, urlParts[2])
+		// Безопасное извлечение имени из URL (host:port или unix:путь к сокету)
+		if name := urlHostName(cfg.Servers[i].URL); name != cfg.Servers[i].URL {
+			cfg.Servers[i].Name = name
+			zbxNames = append(zbxNames, name)
 		} else {
 			zbxNames = append(zbxNames, cfg.Servers[i].URL)
 		}
+
+		// Для канарейки заводим отдельный Circuit Breaker
+		if cfg.Servers[i].CanaryURL != "" {
+			zbxNames = append(zbxNames, canaryName(cfg.Servers[i].ID))
+		}
+
+		// Статистика реплик и очередь ограничителя неизменного сервера сохраняются
+		unchanged := old.unchangedServer(configured.Servers[i])
+
+		// Для каждой реплики - свой Circuit Breaker
+		if b := newReplicaBalancer(cfg.Servers[i]); b != nil {
+			if unchanged && old.balancers[cfg.Servers[i].ID] != nil {
+				b = old.balancers[cfg.Servers[i].ID]
+			}
+			prx.balancers[cfg.Servers[i].ID] = b
+			zbxNames = append(zbxNames, replicaNames(cfg.Servers[i])...)
+		}
+
+		if tb := newTokenBucket(cfg.Servers[i]); tb != nil {
+			if unchanged && old.rateLimiters[cfg.Servers[i].ID] != nil {
+				tb = old.rateLimiters[cfg.Servers[i].ID]
+			}
+			prx.rateLimiters[cfg.Servers[i].ID] = tb
+		}
 	}
 
-	// Инициализация клиента Zabbix
-	client, err := zabbix.Init(zabbix.Zabbix(cfg))
-	if err != nil {
-		logger.Global.Warningf("zabbix_client initiation error: %v", err)
+	// Серверы, обнаруженные discovery, сохраняются, пока список серверов конфига не изменился
+	if old != nil && reflect.DeepEqual(old.configured, configured) {
+		prx.config = old.config
+		for _, s := range old.config.Servers {
+			if !slices.Contains(zbxNames, s.Name) {
+				zbxNames = append(zbxNames, s.Name)
+			}
+		}
 	}
-	prx.zbxClient = client
 
-	prx.cb = circuitbreaker.NewCBManager()
+	// Инициализация клиента Zabbix. Пулы соединений сохраняются, если не изменились лимиты и DNS
+	if old != nil && old.zbxClient != nil && reflect.DeepEqual(old.configured.Limits, cfg.Limits) && reflect.DeepEqual(old.configured.DNS, cfg.DNS) && reflect.DeepEqual(old.configured.Redirects, cfg.Redirects) && old.configured.TLS == cfg.TLS {
+		prx.zbxClient = old.zbxClient
+	} else {
+		if old != nil && old.zbxClient != nil {
+			old.zbxClient.Close()
+			restarted = append(restarted, "zabbix client")
+		}
+		client, err := zabbix.Init(zabbix.Zabbix(cfg))
+		if err != nil {
+			logger.Global.Warningf("zabbix_client initiation error: %v", err)
+		}
+		prx.zbxClient = client
+	}
 
-	//Инициализируем circutibreakers
-	prx.cb.InitCircuitBreakers(zbxNames, circuitbreaker.CircuitBreakerConf(cbConf))
+	// Прогрев соединений: после перезагрузки - с новым клиентом и новыми серверами
+	if old != nil && old.stopWarmUp != nil {
+		old.stopWarmUp()
+	}
+	prx.stopWarmUp = prx.startWarmUp()
+
+	//Инициализируем circutibreakers. При неизменных параметрах состояние
+	//существующих Circuit Breaker сохраняется, создаются только новые
+	prx.cbConf = cbConf
+	if old != nil && old.cb != nil && old.cbConf == cbConf {
+		prx.cb = old.cb
+		var added []string
+		for _, name := range zbxNames {
+			if prx.cb.GetCircuitBreaker(name) == nil {
+				added = append(added, name)
+			}
+		}
+		prx.cb.InitCircuitBreakers(added, circuitbreaker.CircuitBreakerConf(cbConf))
+	} else {
+		if old != nil {
+			restarted = append(restarted, "circuit breakers")
+		}
+		prx.cb = circuitbreaker.NewCBManager()
+		prx.cb.InitCircuitBreakers(zbxNames, circuitbreaker.CircuitBreakerConf(cbConf))
+	}
 
 	//Обрабаотываем лимит на размер тела входящего запроса
 	prx.global.maxReqBodySizeInt64 = 15 * 1024 * 1024 // 15MB максимальный размер тела по умолчанию
@@ -137,6 +521,25 @@ func InitProxy(g Global, cfg ZabbixConf, cbConf CBConf, cacheCfg CacheConf, excl
 		}
 	}
 
+	//Обрабатываем лимит на размер объединенного ответа клиенту (0 - без ограничения)
+	if prx.global.MaxRespBodySize != "" {
+		if b, err := suffix.ToB(prx.global.MaxRespBodySize); err != nil {
+			logger.Global.Errorf("convert error 'max_resp_body_size' to bytes: %v", err)
+		} else {
+			prx.global.maxRespBodySizeInt64 = b
+		}
+	}
+
+	//Обрабатываем лимит на размер запроса к серверу
+	prx.global.maxUpstreamReqSizeInt64 = defaultMaxUpstreamReqSize
+	if prx.global.MaxUpstreamReqSize != "" {
+		if b, err := suffix.ToB(prx.global.MaxUpstreamReqSize); err != nil {
+			logger.Global.Errorf("convert error 'max_upstream_req_size' to bytes: %v", err)
+		} else {
+			prx.global.maxUpstreamReqSizeInt64 = b
+		}
+	}
+
 	//Обрабатываем лимит на таймаут входящего запроса
 	prx.global.maxTimeoutInt64 = 31 // 31s по умолчанию
 	if prx.global.MaxTimeout != "" {
@@ -147,14 +550,98 @@ func InitProxy(g Global, cfg ZabbixConf, cbConf CBConf, cacheCfg CacheConf, excl
 		}
 	}
 
+	prx.global.deadlineHeadroom = parseDeadlineHeadroom(prx.global.DeadlineHeadroom)
+	prx.soft = newSoftTimeouts(prx.global, time.Duration(prx.global.maxTimeoutInt64)*time.Second)
+
+	prx.global.UnknownIDs = checkUnknownIDs(prx.global.UnknownIDs)
+
 	//Инициализируем кеш
+	prx.setIDScheme(&cacheCfg)
+	// В детерминированном режиме все ID преобразуются без кеша, как некешируемые
+	if cacheCfg.IDMode == idModeDeterministic {
+		prx.cachedFields = map[string]string{}
+		logger.Global.Infof("Deterministic ProxyID mode: cache is disabled")
+	}
+	if !prx.idRewrite() {
+		prx.cachedFields = map[string]string{}
+		if len(cfg.Servers) > 1 {
+			logger.Global.Warningf("'id_rewrite' is disabled with %d servers: IDs of different servers may collide", len(cfg.Servers))
+		}
+		logger.Global.Infof("Transparent mode: IDs are not rewritten, cache is disabled")
+	}
+	// Различаемые имена участвуют в генерации ProxyID, смена шаблона меняет схему ID
+	if len(prx.cachedFields) == 0 {
+		prx.names = nil
+	} else if prx.names != nil {
+		cacheCfg.NameTemplate = prx.names.template
+	}
+	if prx.names != nil && prx.global.HostMerge {
+		logger.Global.Warningf("'host_merge' has no effect with 'name_disambiguation': same-named hosts get separate ProxyIDs")
+	}
 	cacheCfg.CachedFields = prx.cachedFields
-	prx.cache = cache.Init(cache.CacheCfg(cacheCfg))
+	prx.cacheCfg = cacheCfg
+
+	// Пассивный узел HA пары открывает кеш только при переходе в active
+	initHA(g.HA)
+
+	// Открытый кеш с неизменными параметрами не закрывается
+	if old != nil && old.cache != nil && reflect.DeepEqual(old.cacheCfg, cacheCfg) {
+		prx.cache = old.cache
+		// Сверка прежнего proxy остановлена вместе с его фоновыми задачами (см. Reload)
+		prx.stopReconcile = prx.startCacheReconcile()
+		if old.global.ReconcileInterval != g.ReconcileInterval {
+			restarted = append(restarted, "cache reconcile")
+		}
+		return restarted
+	}
+
+	if old != nil && old.cache != nil {
+		if old.stopReconcile != nil {
+			old.stopReconcile()
+		}
+		old.cache.Stop()
+		restarted = append(restarted, "cache")
+	}
+	if IsReady() {
+		if err := prx.startCache(0); err != nil {
+			logger.Global.Fatal(err)
+		}
+	} else {
+		prx.startHASync()
+	}
+	return restarted
+}
 
+// startCache открывает кеш и запускает фоновую сверку кеша с серверами.
+// timeout ограничивает ожидание блокировки файла БД другим процессом (0 - без ограничения)
+func (prx *Proxy) startCache(timeout time.Duration) error {
+	if prx.cacheCfg.IDMode == idModeDeterministic || !prx.idRewrite() {
+		return nil
+	}
+	c, err := cache.Open(cache.CacheCfg(prx.cacheCfg), timeout)
+	if err != nil {
+		return err
+	}
+	prx.cache = c
+	prx.stopReconcile = prx.startCacheReconcile()
+	return nil
+}
+
+// startCacheReconcile запускает фоновую сверку кеша с интервалом reconcile_interval
+func (prx *Proxy) startCacheReconcile() context.CancelFunc {
+	if prx.global.ReconcileInterval == "" {
+		return nil
+	}
+	s, err := suffix.ToSeconds(prx.global.ReconcileInterval)
+	if err != nil {
+		logger.Global.Errorf("convert error 'reconcile_interval' to seconds: %v", err)
+		return nil
+	}
+	return prx.startReconcile(time.Duration(s) * time.Second)
 }
 
 // Останавливаем кеш
-func StopCacheDB() {
+func (prx *Proxy) StopCacheDB() {
 	// Останавливаем фоновые процессы кеша
 	if prx.cache != nil {
 		prx.cache.Stop()
@@ -162,13 +649,32 @@ func StopCacheDB() {
 }
 
 // Останавливаем proxy
-func StopProxy() {
-	StopCacheDB()
+func (prx *Proxy) Stop() {
+	prx.background.stop()
+	if prx.stopWarmUp != nil {
+		prx.stopWarmUp()
+		prx.stopWarmUp = nil
+	}
+	if prx.stopReconcile != nil {
+		prx.stopReconcile()
+		prx.stopReconcile = nil
+	}
+	prx.StopCacheDB()
 	prx.zbxClient.Close()
 }
 
+// serverAllowed проверяет Circuit Breaker сервера. Для сервера с репликами
+// проверка выполняется при выборе реплики
+func (prx *Proxy) serverAllowed(srv zabbix.ZabbixServer) bool {
+	if prx.balancers[srv.ID] != nil {
+		return true
+	}
+	ok, _ := prx.cb.AllowRequest(srv.Name)
+	return ok
+}
+
 // Получаем массив серверов их конфига
-func getAllServers() []int {
+func (prx *Proxy) getAllServers() []int {
 	servers := make([]int, 0, len(prx.config.Servers))
 	for _, s := range prx.config.Servers {
 		servers = append(servers, s.ID)
@@ -177,17 +683,20 @@ func getAllServers() []int {
 }
 
 // Получаем список серверов, ID которых заначатся в запросах
-func getTargetServers(request map[string]any) []int {
+func (prx *Proxy) getTargetServers(request map[string]any) []int {
 	serverMap := make(map[int]bool)
 	if params, ok := request["params"].(map[string]any); ok {
 		if extractServersFromParams(params, serverMap) {
-			return getAllServers()
+			return prx.getAllServers()
 		}
 	}
 
+	// ID серверов, которых нет в конфиге (устаревшая переменная Grafana), не учитываются
 	servers := make([]int, 0, len(serverMap))
-	for serverID := range serverMap {
-		servers = append(servers, serverID)
+	for _, serverID := range prx.getAllServers() {
+		if serverMap[serverID] {
+			servers = append(servers, serverID)
+		}
 	}
 	return servers
 }
@@ -220,8 +729,25 @@ func extractServersFromParams(params map[string]any, serverMap map[int]bool) boo
 	return false
 }
 
+// ProcessAllServers выполняет запрос JSON-RPC на серверах Zabbix без авторизации
+// клиента. Возвращает объединенный результат и ошибки серверов
+func (prx *Proxy) ProcessAllServers(ctx context.Context, request map[string]any, trace_id string) (any, []string) {
+	return prx.processAllServers(ctx, request, trace_id)
+}
+
+// requestLogger возвращает логгер запроса из контекста. Запросы без логгера
+// (например, из тестов) получают логгер с trace_id
+func requestLogger(ctx context.Context, trace_id string) *logger.Logger {
+	if log := logger.WithContext(ctx); log != logger.Global {
+		return log
+	}
+	return logger.Global.WithFields(logger.Fields{logger.TraceIDField: trace_id})
+}
+
 // Главный процесс proxy
-func processAllServers(ctx context.Context, request map[string]any, trace_id string) (any, []string) {
+func (prx *Proxy) processAllServers(ctx context.Context, request map[string]any, trace_id string) (any, []string) {
+	// Логгер запроса. Сообщения о запросах к серверам дополняются номером сервера
+	log := requestLogger(ctx, trace_id)
 	var (
 		wg                sync.WaitGroup
 		mu                sync.Mutex
@@ -231,57 +757,413 @@ func processAllServers(ctx context.Context, request map[string]any, trace_id str
 		uniqMu            sync.RWMutex
 		errors            []string
 		cancelCtx, cancel = context.WithCancel(ctx)
+		// Фиксируем семафор, т.к. при перезагрузке конфига prx пересоздается,
+		// а горутины должны освободить слот в том же семафоре, где его заняли
+		semaphore = prx.scheduler
+		// Клиент, в чьей очереди ожидаются слоты семафора
+		client = clientFromContext(ctx)
+		// Отладочная разбивка по серверам (nil, если не запрошена клиентом)
+		dbg = debugFromContext(ctx)
+		// Захват запроса бортовым самописцем (nil, если запрос не в выборке)
+		rec = recordFromContext(ctx)
+		// Лимит и накопленный размер объединенного результата
+		respLimit = prx.global.maxRespBodySizeInt64
+		respSize  int64
+		// Резерв бюджета памяти запроса (nil, если бюджет не настроен)
+		memRes = memReservationFromContext(ctx)
+		// При stable_order ответы обрабатываются и объединяются после получения всех
+		stable  = prx.global.StableOrder
+		pending []serverResult
+		// Квота элементов серверов (nil, если не применяется к методу)
+		quota = quotaFromContext(ctx)
+		// При чередовании списки серверов объединяются после получения всех
+		interleave = quota.interleave(prx)
+		lists      [][]any
+		// Отчет о неполном результате (nil, если при таймауте результаты не возвращаются)
+		partial = partialFromContext(ctx)
+		// Запросы снимка результата к мягкому таймауту (nil, если не применяется)
+		progress = progressFromContext(ctx)
+		// Запрошенные серверы, серверы, не дождавшиеся очереди, и ответившие серверы
+		launched, queueTimedOut []int
+		answered                = make(map[int]bool)
 	)
 	defer cancel()
+	// Запросы к серверам завершаются раньше запроса клиента на deadline_headroom
+	upstreamCtx, upstreamCancel := prx.upstreamContext(cancelCtx)
+	defer upstreamCancel()
+
+	method, _ := request["method"].(string)
+	// Сборщик метрик запроса (nil, если метод исключен из метрик)
+	mc := prx.methodMetrics(method)
+	// Логирование обмена с серверами, если метод не исключен из трассировки
+	traced := !slices.Contains(prx.exclude.Tracing, method)
+
+	request = normalizeAcknowledge(request)
+	req := prx.newRPCRequest(request)
+	// В прозрачном режиме ID не указывают на сервер, запрос получают все серверы
+	rewrite := prx.idRewrite()
+	if !rewrite {
+		req.idFields = nil
+	}
+	// Суммарное время преобразования ID запроса и ответов серверов
+	var idProcessing atomic.Int64
+	if mc != nil && rewrite {
+		defer func() { mc.ObserveIDProcessing(method, time.Duration(idProcessing.Load())) }()
+	}
+	isIDRequest, idFields := req.byIDs(), req.idFields
+	log.Tracef("IDbased request: %t. Fields: [%s]", isIDRequest, idFields)
 
-	isIDRequest, idFields := isIDBasedRequest(request)
-	logger.Global.Tracef("[%s] IDbased request: %t. Fields: [%s]", trace_id, isIDRequest, idFields)
+	// Стратегия рассылки метода
+	route := prx.methodRoute(method)
+	firstSuccess := route.Strategy == strategyFirstSuccess
+	firstNonEmpty := route.Strategy == strategyFirstNonEmpty
+	// Получен непустой ответ (first_non_empty)
+	var found atomic.Bool
 
 	var targetServers []int
-	if isIDRequest {
-		targetServers = getTargetServers(request)
+	if isIDRequest && route.Strategy != strategyAll {
+		targetServers = prx.getTargetServers(request)
 		if len(targetServers) == 0 {
-			logger.Global.Warningf("[%s] No target servers for ID-based request", trace_id)
+			// Как Zabbix для несуществующих ID - пустой результат
+			if prx.unknownIDsResult(ctx) {
+				log.Debugf("No target servers for ID-based request, returning empty result")
+				return []any{}, nil
+			}
+			log.Warningf("No target servers for ID-based request")
 			return nil, []string{"no target servers for ID-based request"}
 		}
-		logger.Global.Debugf("[%s] ID-Based. Target servers for %s: %v", trace_id, idFields, targetServers)
+		log.Debugf("ID-Based. Target servers for %s: %v", idFields, targetServers)
 	} else {
-		targetServers = getAllServers()
-		logger.Global.Debugf("[%s] Not ID-Based. Target servers for %s: all servers", trace_id, idFields)
+		targetServers = prx.getAllServers()
+		log.Debugf("Not ID-Based. Target servers for %s: all servers", idFields)
+	}
+
+	// Клиенту JWT доступны только разрешенные серверы
+	if p := principalFromContext(ctx); p.restricted() {
+		targetServers = p.filterServers(prx.config.Servers, targetServers)
+		if len(targetServers) == 0 {
+			log.Warningf("No servers allowed for client %s", p.name)
+			return nil, []string{"no servers allowed for client " + p.name}
+		}
+	}
+
+	// Согласованная запись адресована одному серверу за раз
+	if servers, ok := targetServersFromContext(ctx); ok {
+		targetServers = slices.DeleteFunc(targetServers, func(id int) bool { return !slices.Contains(servers, id) })
+		if len(targetServers) == 0 {
+			log.Debugf("Request is not applicable to servers %v", servers)
+			return []any{}, nil
+		}
+	}
+
+	if route.Strategy != strategyTargeted {
+		var err error
+		if targetServers, err = prx.routeServers(route, targetServers); err != nil {
+			log.Errorf("Routing %s (%s): %v", method, route.Strategy, err)
+			return nil, []string{err.Error()}
+		}
+		log.Debugf("Strategy %s for %s. Target servers: %v", route.Strategy, method, targetServers)
+	}
+
+	// Запрос к единственному серверу выполняется без горутины, результат не объединяется.
+	// Неполный результат по таймауту и снимки к мягкому таймауту формирует цикл сбора ответов
+	single := len(targetServers) == 1 && !partial.returnOnTimeout() && progress == nil
+	if single {
+		stable = false
 	}
 
 	// Канал для результатов
 	resultCh := make(chan serverResult, len(targetServers))
 	errCh := make(chan serverError, len(targetServers))
 
+	// Запрос к серверу srv. Результат или ошибка отправляются в resultCh или errCh
+	query := func(srv zabbix.ZabbixServer) {
+		srvLog := log.WithFields(logger.Fields{"server": srv.ID})
+
+		// Подготовка запроса: ID запроса заменяются оригинальными ID сервера
+		resolveStart := time.Now()
+		upstream, ok := req.forServer(srv.ID, trace_id)
+		idProcessing.Add(int64(time.Since(resolveStart)))
+		if !ok {
+			srvLog.Debugf("No matching IDs")
+			dbg.status(srv.ID, srv.URL, "skipped")
+			return
+		}
+		resolved := upstream.resolved
+		serverRequest := req.message(upstream, srv.Token)
+
+		// Запрос с раздутыми параметрами не рассылается серверам
+		reqSize := jsonSize(serverRequest)
+		if mc != nil {
+			mc.ObserveUpstreamRequestSize(method, reqSize)
+		}
+		if limit := prx.global.maxUpstreamReqSizeInt64; limit > 0 && reqSize > limit {
+			srvLog.Warningf("Request size %d bytes exceeds max_upstream_req_size %d bytes, skipping", reqSize, limit)
+			dbg.status(srv.ID, srv.URL, "request_too_large")
+			if mc != nil {
+				mc.IncRequestStatus(srv.URL, "request_too_large")
+			}
+			errCh <- serverError{serverID: srv.ID, url: srv.URL, err: reqTooLarge(reqSize, limit)}
+			return
+		}
+
+		if traced {
+			srvLog.Debugf("Sending to %s", srv.URL)
+		}
+
+		// Дублируем запрос на тестовый сервер, если он задан
+		prx.mirrorRequest(srv, serverRequest, trace_id)
+
+		// Выбираем реплику логического сервера
+		srv, replica, err := prx.routeReplica(srv, trace_id)
+		if err != nil {
+			srvLog.Warningf("%v, skipping", err)
+			dbg.status(srv.ID, srv.URL, "circuit_open")
+			errCh <- serverError{serverID: srv.ID, url: srv.URL, err: logger.Redact(err.Error())}
+			return
+		}
+
+		// Часть трафика сервера отправляем на canary_url
+		srv, canary := prx.routeCanary(srv, serverRequest, trace_id)
+
+		// Ждем очереди ограничителя частоты запросов к серверу
+		if delay, err := prx.rateLimiters[srv.ID].wait(cancelCtx); err != nil {
+			srvLog.Warningf("Rate limit exceeded (queue delay %v), skipping", delay)
+			dbg.status(srv.ID, srv.URL, "rate_limited")
+			if mc != nil {
+				mc.IncRequestStatus(srv.URL, "rate_limited")
+			}
+			errCh <- serverError{serverID: srv.ID, url: srv.URL, err: errRateLimited.Error()}
+			return
+		} else if delay > 0 && mc != nil {
+			mc.IncRequestStatus(srv.URL, "rate_delayed")
+		}
+
+		// Резервируем память под ответ, ожидая освобождения бюджета
+		reserved, err := memRes.reserve(cancelCtx, method, srv.URL)
+		if err != nil {
+			srvLog.Warningf("Memory budget exhausted, skipping")
+			dbg.status(srv.ID, srv.URL, "memory_budget")
+			if mc != nil {
+				mc.IncRequestStatus(srv.URL, "mem_budget_rejected")
+			}
+			errCh <- serverError{serverID: srv.ID, url: srv.URL, err: "memory budget exhausted"}
+			return
+		}
+
+		// Инкриментируем активную сессию на сервер в метрике
+		if mc != nil {
+			mc.IncIncomingRequests(srv.Name)
+		}
+		startTime := time.Now()
+
+		// Делаем запрос к Zabbix Server. Клиент Zabbix логирует с номером сервера
+		response, err := prx.sendUpstream(logger.NewContext(upstreamCtx, srvLog), srv, serverRequest)
+		dbg.upstream(srv.ID, srv.URL, time.Since(startTime), err)
+		rec.server(srv.ID, srv.URL, serverRequest, response, err)
+		if err != nil {
+			// Запрос отменен прокси (получен ответ first_success или объединение прервано)
+			// или клиент отключился, это не ошибка сервера
+			if cancelCtx.Err() != nil && (ctx.Err() == nil || clientGone(ctx)) {
+				dbg.status(srv.ID, srv.URL, "cancelled")
+				return
+			}
+
+			status := "error"
+			errMsg := logger.Redact(err.Error())
+			if upstreamTimedOut(upstreamCtx) {
+				// Сервер не ответил до срока запросов к серверам. Остаток времени
+				// запроса клиента уходит на объединение ответов остальных серверов
+				prx.cb.ReportFailure(srv.Name)
+				dbg.status(srv.ID, srv.URL, "timeout")
+				status = "timeout"
+				errMsg = fmt.Sprintf("server %d: %s", srv.ID, errServerTimeout)
+				partial.add([]int{srv.ID})
+			} else if throttled, ok := zabbix.AsThrottledError(err); ok {
+				// Сервер исправен и просит снизить частоту запросов - откладываем запросы
+				// к нему, не отмечая неудачу в Circuit Breaker
+				pause := prx.throttle.backoff(srv.Name, throttled.RetryAfter)
+				srvLog.Warningf("Server throttles requests (HTTP %d), pausing for %v", throttled.StatusCode, pause)
+				dbg.status(srv.ID, srv.URL, "throttled")
+				status = "throttled"
+			} else if apiErr, ok := zabbix.AsAPIError(err); ok && apiErr.Permanent() {
+				// Сервер исправен и отклонил запрос (неверные параметры, нет прав) -
+				// это ошибка клиента, Circuit Breaker ее не учитывает
+				prx.cb.ReportSuccess(srv.Name)
+				status = "client_error"
+			} else {
+				// Отмечаем неудачу в Circuit Breaker. Непригодный ответ (HTML вместо JSON-RPC,
+				// чужой id) - признак неисправного frontend, он также открывает Circuit Breaker
+				prx.cb.ReportFailure(srv.Name)
+				if reason, ok := zabbix.InvalidResponseReason(err); ok {
+					status = "invalid_" + reason
+					dbg.status(srv.ID, srv.URL, "invalid_response")
+				}
+			}
+			//Отмечаем неудачу в метрике
+			if mc != nil {
+				mc.IncRequestStatus(srv.URL, status)
+				mc.ObserveRequestDuration(srv.URL, req.method, status, time.Since(startTime))
+			}
+
+			srvLog.Errorf("Error requesting %s: %v", srv.URL, err)
+			errCh <- serverError{serverID: srv.ID, url: srv.URL, err: errMsg}
+
+			// Сущность не найдена на сервере - ее маппинг из кеша мог устареть
+			if stale := notFoundResolvedIDs(err, resolved); len(stale) > 0 {
+				prx.evictStaleMappings(srv, stale, trace_id)
+			}
+			return
+		}
+		// Отмечаем успех в метрике
+		if mc != nil {
+			mc.IncRequestStatus(srv.URL, "success")
+		}
+
+		// Отмечаем успех в Circuit Breaker
+		prx.cb.ReportSuccess(srv.Name)
+		// Время ответа канарейки не учитывается в выборе реплики
+		if replica != nil && !canary {
+			prx.balancers[srv.ID].observe(replica, time.Since(startTime))
+		}
+
+		// Отмечаем успех в метрике
+		if mc != nil {
+			mc.ObserveRequestDuration(srv.URL, req.method, "success", time.Since(startTime))
+		}
+		if traced {
+			srvLog.Debugf("Response in %v", time.Since(startTime))
+		}
+
+		if result, ok := response["result"]; ok {
+			var size int64
+			if memRes != nil || respLimit > 0 {
+				size = jsonSize(result)
+			}
+			memRes.settle(method, srv.URL, reserved, size)
+
+			if firstNonEmpty && !isEmpty(result) {
+				found.Store(true)
+			}
+
+			// Сущности, запрошенные по ProxyID, но отсутствующие в ответе, считаем устаревшими
+			if stale := missingResolvedIDs(req.method, req.params, result, resolved); len(stale) > 0 {
+				prx.evictStaleMappings(srv, stale, trace_id)
+			}
+
+			// ID не преобразуются, в элементы добавляется сервер
+			if prx.isPassThrough(method) {
+				resultCh <- serverResult{result: annotateServer(result, srv), serverID: srv.ID, url: srv.URL, size: size, processed: true}
+				return
+			}
+			if !rewrite {
+				resultCh <- serverResult{result: result, serverID: srv.ID, url: srv.URL, size: size, processed: true}
+				return
+			}
+
+			// Подтвержденные события возвращаются с ProxyID
+			acknowledgedEventIDs(method, result, srv.ID)
+
+			// Одноименные сущности разных серверов различаются по имени (и ProxyID)
+			prx.names.rename(method, result, srv.ID)
+
+			// Дубликаты отбрасываются в порядке обработки, поэтому при stable_order
+			// ответ обрабатывается после получения всех ответов в порядке ID серверов
+			if stable {
+				resultCh <- serverResult{result: result, serverID: srv.ID, url: srv.URL, size: size}
+				return
+			}
+
+			processingStart := time.Now()
+			processedResult := prx.processResponseIDs(result, srv.ID, uniqProxyIDs, &uniqMu, 0)
+			idProcessing.Add(int64(time.Since(processingStart)))
+			dbg.processed(srv.ID, srv.URL, time.Since(processingStart), result)
+			dbg.deduplicatedEntries(srv.ID, srv.URL, result, processedResult)
+			resultCh <- serverResult{result: processedResult, serverID: srv.ID, url: srv.URL, size: size, processed: true}
+		}
+	}
+
 	// Ограничиваем количество одновременных запросов
 	for _, server := range prx.config.Servers {
 		if !slices.Contains(targetServers, server.ID) {
 			continue
 		}
 
+		// Все ID запроса для сервера недавно не найдены в кеше - не опрашиваем сервер
+		if isIDRequest && prx.knownIDsMissing(request, idFields, server.ID) {
+			log.WithFields(logger.Fields{"server": server.ID}).Debugf("Requested ProxyIDs are unknown (negative cache), skipping")
+			dbg.status(server.ID, server.URL, "skipped")
+			if mc != nil {
+				mc.IncRequestStatus(server.URL, "unknown_id_cached")
+			}
+			continue
+		}
+
 		//Ожидаем освобождение ресурса для запуска горутины
-		select {
-		case prx.requestSemaphore <- struct{}{}:
-			// Проверяем Circuit Breaker
-			if ok, _ := prx.cb.AllowRequest(server.Name); !ok {
-				<-prx.requestSemaphore // Освободить слот
+		queueStart := time.Now()
+		acquired := semaphore.acquire(cancelCtx, client) == nil
 
-				logger.Global.Warningf("[%s] Circuit breaker status 'open' for server %s, skipping", trace_id, server.URL)
-				errCh <- serverError{url: server.URL, err: fmt.Sprintf("server %d: circuit breaker open", server.ID)}
+		queueWait := time.Since(queueStart)
+		dbg.queued(server.ID, server.URL, queueWait)
+		if mc != nil {
+			mc.ObserveQueueWait(server.URL, queueWait)
+		}
+
+		if !acquired {
+			// Клиент отключился, не дождавшись слота, - это не ошибка сервера
+			if clientGone(ctx) {
+				dbg.status(server.ID, server.URL, "cancelled")
 				continue
 			}
-
-			// Получили слот, запускаем обработку
-			wg.Add(1)
-
-		case <-cancelCtx.Done():
+			dbg.status(server.ID, server.URL, "timeout")
 			// Отмечаем неудачу в Circuit Breaker
 			prx.cb.ReportFailure(server.Name)
+			queueTimedOut = append(queueTimedOut, server.ID)
 			// Контекст отменен, выходим
 			continue
 		}
 
+		// Проверяем Circuit Breaker (для сервера с репликами - при выборе реплики)
+		if !prx.serverAllowed(server) {
+			semaphore.release() // Освободить слот
+
+			log.Warningf("Circuit breaker status 'open' for server %s, skipping", server.URL)
+			dbg.status(server.ID, server.URL, "circuit_open")
+			errCh <- serverError{serverID: server.ID, url: server.URL, err: fmt.Sprintf("server %d: circuit breaker open", server.ID)}
+			continue
+		}
+
+		// Сервер ограничил частоту запросов - ждем окончания паузы
+		if pause, ok := prx.serverThrottled(server); ok {
+			semaphore.release() // Освободить слот
+
+			log.Warningf("Server %s throttles requests, skipping for %v", server.URL, pause.Round(time.Second))
+			dbg.status(server.ID, server.URL, "throttled")
+			if mc != nil {
+				mc.IncRequestStatus(server.URL, "throttled_skipped")
+			}
+			errCh <- serverError{serverID: server.ID, url: server.URL, err: fmt.Sprintf("server %d: throttled, retry after %v", server.ID, pause.Round(time.Second))}
+			continue
+		}
+
+		// Единственный сервер опрашивается без горутины
+		if single {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						logger.Global.Errorf("panic in request: %v", r)
+					}
+				}()
+				defer semaphore.release()
+				query(server)
+			}()
+			continue
+		}
+
+		// Получили слот, запускаем обработку
+		wg.Add(1)
+		launched = append(launched, server.ID)
+
 		// Запускае горутину для запроса ZBX серверу
 		go func(srv zabbix.ZabbixServer) {
 			defer wg.Done()
@@ -291,195 +1173,357 @@ func processAllServers(ctx context.Context, request map[string]any, trace_id str
 				}
 			}()
 
-			defer func() { <-prx.requestSemaphore }()
-
-			// Выполняем глубокое клонирование запроса
-			serverRequest := deepClone(request).(map[string]any)
-
-			// Возвращаем ресурс
-			defer returnToPool(serverRequest)
-
-			// Подставляем токен сервера в завпрос
-			serverRequest["auth"] = srv.Token
-			//Подготовка запроса
-			if isIDRequest {
-
-				for _, idField := range idFields {
-					//switch v := serverParams[idField].(type) {
-					switch v := (serverRequest["params"]).(map[string]any)[idField].(type) {
-					case []any:
-						var filtered []any
-						for _, id := range v {
-							if sid := getServerFromID(id); sid == srv.ID {
-								if originalID := convertGrafanaIDToOriginal(id, srv.ID); originalID != nil {
-									filtered = append(filtered, originalID)
-								}
-							} else if sid == 0 {
-								logger.Global.Tracef("[%s] Server[%d]: ID[%v] is ProxyID", trace_id, srv.ID, id)
-								if originalID := convertProxyIDToOriginal(id, srv.ID, idField); originalID != nil {
-									filtered = append(filtered, originalID)
-								}
-							}
-						}
-						if len(filtered) == 0 {
-							logger.Global.Debugf("[%s] No matching IDs for server %d", trace_id, srv.ID)
-							return
-						}
-						(serverRequest["params"]).(map[string]any)[idField] = filtered
-					case any:
-						if sid := getServerFromID(v); sid == srv.ID {
-							if originalID := convertGrafanaIDToOriginal(v, srv.ID); originalID != nil {
-								(serverRequest["params"]).(map[string]any)[idField] = originalID
-							}
-						} else if sid == 0 {
-							logger.Global.Tracef("[%s] Single ID[%v] is ProxyID", trace_id, v)
-							if originalID := convertProxyIDToOriginal(v, srv.ID, idField); originalID != nil {
-								(serverRequest["params"]).(map[string]any)[idField] = originalID
-							}
-						} else {
-							logger.Global.Debugf("[%s] ID does not belong to server %d", trace_id, srv.ID)
-							return
-						}
-					}
-				}
-			}
+			defer semaphore.release()
 
-			if !slices.Contains(prx.excludeRequests, serverRequest["method"].(string)) {
-				logger.Global.Debugf("[%s] Sending to server[%d]: %s", trace_id, srv.ID, srv.URL)
-			}
+			query(srv)
+		}(server)
 
-			// Инкриментируем активную сессию на сервер в метрике
-			if metricsCollector != nil {
-				metricsCollector.IncIncomingRequests(srv.Name)
+		// Последовательный опрос: следующий сервер только если ответ пустой
+		if firstNonEmpty && route.Sequential {
+			wg.Wait()
+			if found.Load() {
+				break
 			}
-			startTime := time.Now()
+		}
+	}
 
-			// Делаем запрос к Zabbix Server
-			response, err := prx.zbxClient.SendToZabbix(cancelCtx, srv.URL, srv.IgnoreSSL, serverRequest)
-			if err != nil {
-				// Отмечаем неудачу в Circuit Breaker
-				prx.cb.ReportFailure(srv.Name)
-				//Отмечаем неудачу в метрике
-				if metricsCollector != nil {
-					metricsCollector.IncRequestStatus(srv.URL, "error")
-				}
+	if single {
+		return singleServerResult(ctx, cancelCtx, resultCh, errCh, respLimit, quota)
+	}
 
-				logger.Global.Errorf("[%s] Error requesting %s: %v", trace_id, srv.URL, err)
-				errCh <- serverError{url: srv.URL, err: err.Error()}
-				return
-			}
-			// Отмечаем успех в метрике
-			if metricsCollector != nil {
-				metricsCollector.IncRequestStatus(srv.URL, "success")
-			}
+	// Ждем завершения всех горутин или отмены контекста
+	go func() {
+		wg.Wait()
+		close(resultCh)
+		close(errCh)
+	}()
 
-			// Отмечаем успех в Circuit Breaker
-			prx.cb.ReportSuccess(srv.Name)
+	// Объединение результата сервера с общим результатом
+	merge := func(result any) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = mergeResult(results, resultsMap, result)
+	}
 
-			// Отмечаем успех в метрике
-			if metricsCollector != nil {
-				metricsCollector.ObserveRequestDuration(srv.URL, serverRequest["method"].(string), time.Since(startTime))
+	// Результат, собранный к мягкому таймауту. Отложенные ответы обрабатываются
+	// и ограничиваются квотой сразу и при завершении повторно не обрабатываются
+	snapshot := func() softSnapshot {
+		for i, result := range pending {
+			if !result.processed {
+				pending[i].result = prx.processResponseIDs(result.result, result.serverID, uniqProxyIDs, &uniqMu, 0)
+				pending[i].processed = true
+			}
+			if !result.limited {
+				pending[i].result = quota.limit(result.serverID, pending[i].result)
+				pending[i].limited = true
 			}
-			if !slices.Contains(prx.excludeRequests, serverRequest["method"].(string)) {
-				logger.Global.Debugf("[%s] Response from server [%d] in %v", trace_id, srv.ID, time.Since(startTime))
+		}
+		sorted := slices.Clone(pending)
+		slices.SortFunc(sorted, func(a, b serverResult) int { return a.serverID - b.serverID })
+
+		mu.Lock()
+		list := slices.Clone(results)
+		object := maps.Clone(resultsMap)
+		errs := slices.Clone(errors)
+		mu.Unlock()
+
+		var snapLists [][]any
+		for _, result := range sorted {
+			if l, ok := result.result.([]any); ok && interleave {
+				snapLists = append(snapLists, l)
+				continue
 			}
+			list = mergeResult(list, object, result.result)
+		}
+		if len(snapLists) > 0 {
+			list = mergeResult(list, object, interleaveLists(snapLists))
+		}
 
-			if result, ok := response["result"]; ok {
-				processedResult := processResponseIDs(result, srv.ID, uniqProxyIDs, &uniqMu, 0)
-				resultCh <- serverResult{result: processedResult, serverID: srv.ID}
+		snap := softSnapshot{errors: errs, pending: timedOutServers(queueTimedOut, launched, answered)}
+		for _, srv := range prx.config.Servers {
+			if slices.Contains(snap.pending, srv.ID) {
+				snap.errors = append(snap.errors, fmt.Sprintf("%s: server %d: %s", srv.URL, srv.ID, errServerTimeout))
 			}
-		}(server)
+		}
+		if len(list) > 0 {
+			snap.results = prx.mergeDuplicateHosts(method, deepClone(list).([]any))
+		} else {
+			snap.results = deepClone(object)
+		}
+		return snap
 	}
 
-	// Ждем завершения всех горутин или отмены контекста
-	go func() {
-		wg.Wait()
-		close(resultCh)
-		close(errCh)
-	}()
+	// Учет ответа сервера. Возвращает false, если объединенный результат превысил лимит
+	collect := func(result serverResult) bool {
+		answered[result.serverID] = true
+		// Прерываем объединение, пока результат не исчерпал память
+		respSize += result.size
+		if respLimit > 0 && respSize > respLimit {
+			log.Warningf("Combined result exceeds max_resp_body_size (%d bytes), aborting", respLimit)
+			return false
+		}
+
+		if stable || interleave {
+			pending = append(pending, result)
+		} else {
+			merge(quota.limit(result.serverID, result.result))
+		}
+		return true
+	}
+	collectError := func(err serverError) {
+		answered[err.serverID] = true
+		mu.Lock()
+		errors = append(errors, err.url+": "+err.err)
+		mu.Unlock()
+	}
 
 	// Собираем результаты
+	finished := false
 	for {
 		select {
 		case <-cancelCtx.Done():
-			// Таймаут или отмена
-			errors = append(errors, "request timeout")
-			return nil, errors
+			// Таймаут или отключение клиента. Отмена cancelCtx прерывает
+			// незавершенные запросы к серверам
+			if clientGone(ctx) {
+				errors = append(errors, errClientGone)
+				return nil, errors
+			}
+			if !partial.returnOnTimeout() {
+				errors = append(errors, errServerTimeout)
+				return nil, errors
+			}
+
+			// Возвращаем результаты успевших серверов: забираем уже полученные ответы,
+			// для остальных серверов - ошибки таймаута
+			for drained := false; !drained && (resultCh != nil || errCh != nil); {
+				select {
+				case result, ok := <-resultCh:
+					if !ok {
+						resultCh = nil
+					} else if !collect(result) {
+						return nil, []string{errRespTooLarge}
+					}
+				case err, ok := <-errCh:
+					if !ok {
+						errCh = nil
+					} else {
+						collectError(err)
+					}
+				default:
+					drained = true
+				}
+			}
+			timedOut := timedOutServers(queueTimedOut, launched, answered)
+			for _, srv := range prx.config.Servers {
+				if slices.Contains(timedOut, srv.ID) {
+					errors = append(errors, fmt.Sprintf("%s: server %d: %s", srv.URL, srv.ID, errServerTimeout))
+				}
+			}
+			partial.add(timedOut)
+			log.Warningf("Request timeout, returning partial result without servers %v", timedOut)
+			finished = true
 
 		case result, ok := <-resultCh:
 			if !ok {
 				resultCh = nil
 			} else {
-				mu.Lock()
-				switch r := result.result.(type) {
-				case []any:
-					results = append(results, r...)
-				case map[string]any:
-					for key, val := range r {
-						resultsMap[key] = val
-					}
+				if !collect(result) {
+					return nil, []string{errRespTooLarge}
+				}
+
+				// Первый успешный (непустой) ответ, остальные запросы отменяем
+				if firstSuccess || (firstNonEmpty && !isEmpty(result.result)) {
+					log.Debugf("First %s from server[%d], cancelling other requests", route.Strategy, result.serverID)
+					cancel()
+					finished = true
 				}
-				mu.Unlock()
 			}
 
 		case err, ok := <-errCh:
 			if !ok {
 				errCh = nil
 			} else {
-				mu.Lock()
-				errors = append(errors, err.url+": "+err.err)
-				mu.Unlock()
+				collectError(err)
 			}
+
+		case reply := <-progress.snapshots():
+			reply <- snapshot()
 		}
 
-		if resultCh == nil && errCh == nil {
+		if finished || (resultCh == nil && errCh == nil) {
 			break
 		}
 	}
 
+	// Обрабатываем и объединяем ответы в порядке ID серверов
+	slices.SortFunc(pending, func(a, b serverResult) int { return a.serverID - b.serverID })
+	for _, result := range pending {
+		processedResult := result.result
+		if !result.processed {
+			processingStart := time.Now()
+			processedResult = prx.processResponseIDs(result.result, result.serverID, uniqProxyIDs, &uniqMu, 0)
+			idProcessing.Add(int64(time.Since(processingStart)))
+			dbg.processed(result.serverID, result.url, time.Since(processingStart), result.result)
+			dbg.deduplicatedEntries(result.serverID, result.url, result.result, processedResult)
+		}
+		if !result.limited {
+			processedResult = quota.limit(result.serverID, processedResult)
+		}
+		if list, ok := processedResult.([]any); ok && interleave {
+			lists = append(lists, list)
+			continue
+		}
+		merge(processedResult)
+	}
+	if len(lists) > 0 {
+		merge(interleaveLists(lists))
+	}
+
 	if len(results) > 0 {
-		return results, errors
+		return prx.mergeDuplicateHosts(method, results), errors
 	}
 	return resultsMap, errors
 }
 
+// mergeResult объединяет результат сервера со списком list или объектом object
+// и возвращает список
+func mergeResult(list []any, object map[string]any, result any) []any {
+	switch r := result.(type) {
+	case []any:
+		list = append(list, r...)
+	case map[string]any:
+		for key, val := range r {
+			// Списки ID ответов изменяющих методов ({"eventids": [...]}) разных серверов складываются
+			ids, isList := val.([]any)
+			merged, ok := object[key].([]any)
+			if isList && ok && strings.HasSuffix(key, "ids") {
+				object[key] = slices.Concat(merged, ids)
+				continue
+			}
+			object[key] = val
+		}
+	}
+	return list
+}
+
+// singleServerResult возвращает результат запроса к единственному серверу без объединения.
+// Результат совпадает с результатом общего пути: непустой список или объект, иначе пустой объект.
+// Квота элементов сервера применяется так же, как при объединении
+func singleServerResult(ctx, cancelCtx context.Context, resultCh chan serverResult, errCh chan serverError, respLimit int64, quota *quotaReport) (any, []string) {
+	var result serverResult
+	select {
+	case result = <-resultCh:
+	default:
+		// Таймаут или отключение клиента, ошибка сервера - их следствие
+		if cancelCtx.Err() != nil {
+			return nil, contextErrors(ctx)
+		}
+	}
+
+	var errors []string
+	for len(errCh) > 0 {
+		err := <-errCh
+		errors = append(errors, err.url+": "+err.err)
+	}
+
+	if respLimit > 0 && result.size > respLimit {
+		return nil, []string{errRespTooLarge}
+	}
+	switch r := quota.limit(result.serverID, result.result).(type) {
+	case []any:
+		if len(r) > 0 {
+			return r, errors
+		}
+	case map[string]any:
+		return r, errors
+	}
+	return map[string]any{}, errors
+}
+
 // Вспомогательные структуры для каналов
 type serverResult struct {
 	result   any
 	serverID int
+	url      string
+	// ID в результате уже преобразованы
+	processed bool
+	// Квота элементов сервера уже применена (снимок к мягкому таймауту)
+	limited bool
+	size    int64 // Оценка размера результата в JSON (при max_resp_body_size или memory_budget)
 }
 
 type serverError struct {
-	url string
-	err string
+	serverID int
+	url      string
+	err      string
 }
 
+// Префиксы ключей трафика серверов в GetConnectionStats, за префиксом - имя сервера (host:port)
+const (
+	UpstreamBytesSentKey     = "upstream_bytes_sent/"
+	UpstreamBytesReceivedKey = "upstream_bytes_received/"
+)
+
 // Мониторинг состояния
-func GetConnectionStats() map[string]int {
+func (prx *Proxy) GetConnectionStats() map[string]int {
 
 	stats := make(map[string]int)
 	stats["active_goroutines"] = runtime.NumGoroutine()
 	stats["active_requests"] = len(prx.requestSemaphore)
+	if prx.scheduler != nil {
+		stats["queued_requests"] = prx.scheduler.waiting()
+	}
 	stats["http_clients"] = prx.zbxClient.GetClientsCount()
 
+	// Трафик серверов (тела запросов и ответов) для распределения затрат и планирования емкости
+	for server, st := range prx.zbxClient.GetTrafficStats() {
+		stats[UpstreamBytesSentKey+server] = int(st.Sent)
+		stats[UpstreamBytesReceivedKey+server] = int(st.Received)
+	}
+
 	return stats
 }
 
+// Состояние разрешения DNS имен серверов Zabbix
+func (prx *Proxy) GetDNSStats() map[string]zabbix.DNSStats {
+	if prx.zbxClient == nil {
+		return nil
+	}
+	return prx.zbxClient.GetDNSStats()
+}
+
+// Сертификаты серверов Zabbix по host:port (имени сервера)
+func (prx *Proxy) GetCertStats() map[string]zabbix.CertStats {
+	if prx.zbxClient == nil {
+		return nil
+	}
+	return prx.zbxClient.GetCertStats()
+}
+
+// Статистика кеша: общее количество записей по типам и разбивка по серверам
+type CacheStats struct {
+	Items   map[string]int
+	Servers map[string]map[int]cache.ServerStats
+}
+
 // Состояние кеша Proxy
-func GetCacheStats() (map[string]int, bool) {
+func (prx *Proxy) GetCacheStats() (CacheStats, bool) {
 	if prx.cache != nil {
-		return prx.cache.GetStats(), true
+		return CacheStats{
+			Items:   prx.cache.GetStats(),
+			Servers: prx.cache.GetServerStats(),
+		}, true
 	}
-	return nil, false
+	return CacheStats{}, false
 }
 
 // Cостояние Circuit Breaker
-func GetCBStats() map[string]any {
+func (prx *Proxy) GetCBStats() map[string]any {
 	return prx.cb.GetCircuitBreakerStats()
 }
 
 // Подготовка читаемого JSON для вывода в лог
-func prettyJSON(data any) string {
+func (prx *Proxy) prettyJSON(data any) string {
 	// Создаем временную функцию для маскировки auth-токена
 	maskAuth := func(auth string) string {
 		if len(auth) <= 10 {
@@ -489,6 +1533,13 @@ func prettyJSON(data any) string {
 		return auth[:3] + strings.Repeat("*", len(auth)-6) + auth[len(auth)-3:]
 	}
 
+	// Скрываем пароли, секреты и поля redact_fields на любой вложенности
+	patterns := prx.redactFields
+	if patterns == nil {
+		patterns = defaultRedactFields
+	}
+	data = redact(data, patterns)
+
 	// Конвертируем данные в map, если это возможно
 	if m, ok := data.(map[string]any); ok {
 		// Создаем копию map, чтобы не изменять оригинал
@@ -3,7 +3,6 @@ package proxy
 import (
 	"ZabbixAPIproxy/internal/logger"
 	"fmt"
-	"hash/fnv"
 	"maps"
 	"slices"
 	"strconv"
@@ -17,6 +16,9 @@ var (
 	dedupFileds = []string{"group"}
 )
 
+// duplicateEntry значение ID-поля элемента-дубликата: элемент удаляется из результата
+type duplicateEntry struct{}
+
 // Проверка на пустоту
 func isEmpty(data any) bool {
 	switch v := data.(type) {
@@ -68,7 +70,7 @@ func simpleModifyID(id any, serverID int) any {
 }
 
 // generateProxyID генерирует ProxyID на основе имени сущности и записываем данные в кеш
-func generateProxyID(fieldType string, data map[string]any, serverID int) (any, error) {
+func (prx *Proxy) generateProxyID(fieldType string, data map[string]any, serverID int) (any, error) {
 	// Забираем из структуры поле с ID для даноого типа
 	if origID, ok := data[fieldType+"id"]; ok {
 		var intOrigID int     //Для преобразованного в INT значения OriginID
@@ -105,12 +107,10 @@ func generateProxyID(fieldType string, data map[string]any, serverID int) (any,
 				switch v := m.(type) {
 				case string:
 					//Генерируем кеш от имени объекта
-					h := fnv.New32a()
-					h.Write([]byte(v))
 
-					//Забираем 7 последник цифр и умножаем на 10, что бы получить PorxyID с 0 в конце для более простой идентификации ProxyID
-					digits := 10000000 // 10 в 7 степени
-					proxyID = int(h.Sum32()) % digits * 10
+					//Забираем последние id_digits цифр (по умолчанию 7) и умножаем на 10, что бы получить PorxyID с 0 в конце для более простой идентификации ProxyID
+					digits := prx.idSpace
+					proxyID = int(prx.idHash(v)%uint64(digits)) * 10
 
 					// Проверка коллизий
 					// 5 попыток победить коллизию
@@ -128,14 +128,13 @@ func generateProxyID(fieldType string, data map[string]any, serverID int) (any,
 						}
 
 						// Коллизия! Генерируем уникальный ID с добавлением serverID
-						h.Reset()
-						h.Write([]byte("col" + strconv.Itoa(i) + v))
 						digits /= 10
-						proxyID = int(h.Sum32()) % digits * 10
+						proxyID = int(prx.idHash("col"+strconv.Itoa(i)+v)%uint64(max(digits, 1))) * 10
 					}
 
 					//Пооизводим запись в кеш
 					prx.cache.CacheType[fieldType].Set(proxyID, intOrigID, serverID, v)
+					prx.negativeIDs.forget(fieldType, proxyID, serverID)
 
 					logger.Global.Tracef(`Generated proxyID[%d] for id '%s' based on the field 'name': %s. Recrod to the cash: %d -> {%d: %d}`, proxyID, fieldType, v, proxyID, serverID, intOrigID)
 				}
@@ -155,9 +154,19 @@ func generateProxyID(fieldType string, data map[string]any, serverID int) (any,
 	return 0, fmt.Errorf("failed to generate proxy ID for type %s", fieldType)
 }
 
-func convertProxyIDToOriginal(id any, serverID int, cacheType string) any {
+func (prx *Proxy) convertProxyIDToOriginal(id any, serverID int, cacheType string) any {
 	cacheType = strings.TrimSuffix(cacheType, "ids")
 	cacheType = strings.TrimSuffix(cacheType, "id")
+	// Без кеша (детерминированный режим, пассивный узел) ProxyID не разрешаются
+	if prx.cache == nil {
+		return nil
+	}
+	// ID некешируемых сущностей (interfaceids, proxyids Zabbix прокси и т.п.)
+	// всегда содержат номер сервера и не могут быть ProxyID
+	if _, ok := prx.cache.CacheType[cacheType]; !ok {
+		logger.Global.Debugf("For Server[%d] ID %v of non-cached type '%s' is not a ProxyID", serverID, id, cacheType)
+		return nil
+	}
 	switch proxyID := id.(type) {
 	case float64:
 		intproxyID := int(proxyID)
@@ -249,17 +258,10 @@ func isIDBasedRequest(request map[string]any) (bool, []string) {
 // Если ключ карты(словаря) является ID, то модифицируем его по простому принципу *10+serverID
 func ifIDBasedResponseSimpleModify(data map[string]any, serverID int) {
 	var keys []string
-	var isKeyDigits bool
 
+	// Модифицируем только ключи из цифр, порядок обхода map не должен влиять на результат
 	for i := range data {
-		if isKeyDigits {
-			keys = append(keys, i)
-		} else {
-			if !isPureDigitString(i) {
-				return
-			}
-
-			isKeyDigits = true
+		if isPureDigitString(i) {
 			keys = append(keys, i)
 		}
 	}
@@ -326,7 +328,7 @@ func convertGrafanaIDToOriginal(id any, serverID int) any {
 // mu - RWMutex для безопасной работы с картой уникальных ID в конкурентной среде
 // deepLevel - уровень вложенности (0 - верхний уровень, где нужно удалять дубликаты)
 // возвращает обработанные данные с подставленными proxy ID или nil для фильтрации дубликатов
-func processResponseIDs(data any, serverID int, uniqProxyID map[string]map[any]bool, mu *sync.RWMutex, deepLevel int) any {
+func (prx *Proxy) processResponseIDs(data any, serverID int, uniqProxyID map[string]map[any]bool, mu *sync.RWMutex, deepLevel int) any {
 	switch v := data.(type) {
 	case []any:
 		//Массив отфильтрованных данных
@@ -334,7 +336,7 @@ func processResponseIDs(data any, serverID int, uniqProxyID map[string]map[any]b
 
 		// Обрабатываем слайс, удаляем элементы, если shouldDelete = true
 		for _, item := range v {
-			if processResponseIDs(item, serverID, uniqProxyID, mu, deepLevel+1) != nil {
+			if prx.processResponseIDs(item, serverID, uniqProxyID, mu, deepLevel+1) != nil {
 				filtered = append(filtered, item)
 			}
 		}
@@ -348,10 +350,14 @@ func processResponseIDs(data any, serverID int, uniqProxyID map[string]map[any]b
 		for key, value := range v {
 			if isIDField(key) {
 				// Если поле является ID-полем (оканчивается на "id" но не просто "id")
-				v[key] = processIDField(key, value, v, serverID, uniqProxyID, mu, deepLevel)
+				id := prx.processIDField(key, value, v, serverID, uniqProxyID, mu, deepLevel)
+				if _, dup := id.(duplicateEntry); dup {
+					return nil
+				}
+				v[key] = id
 
 			} else {
-				processResponseIDs(value, serverID, uniqProxyID, mu, deepLevel+1)
+				prx.processResponseIDs(value, serverID, uniqProxyID, mu, deepLevel+1)
 			}
 		}
 		return v
@@ -371,14 +377,14 @@ func isIDField(key string) bool {
 // value - текущее значение поля
 // data - вся map данных (нужна для генерации proxy ID)
 // возвращает обработанное значение ID (proxy ID или модифицированный оригинальный ID)
-func processIDField(key string, value any, data map[string]any, serverID int, uniqProxyID map[string]map[any]bool, mu *sync.RWMutex, deepLevel int) any {
+func (prx *Proxy) processIDField(key string, value any, data map[string]any, serverID int, uniqProxyID map[string]map[any]bool, mu *sync.RWMutex, deepLevel int) any {
 	// Извлекаем тип сущности из имени поля (например "host" из "hostid")
 	fieldType := strings.TrimSuffix(key, "id")
 
 	// Проверяем нужно ли для этого типа сущности использовать кешированные proxy ID
 	if _, ok := prx.cachedFields[fieldType]; ok {
 		// Для кешируемых сущностей генерируем proxy ID на основе имени
-		return processCachedIDField(fieldType, value, data, serverID, uniqProxyID, mu, deepLevel)
+		return prx.processCachedIDField(fieldType, value, data, serverID, uniqProxyID, mu, deepLevel)
 	}
 	// Для некешируемых сущностей используем простое преобразование ID
 	return simpleModifyID(value, serverID)
@@ -388,22 +394,26 @@ func processIDField(key string, value any, data map[string]any, serverID int, un
 // fieldType - тип сущности (например "host", "group")
 // value - текущее значение ID поля
 // data - вся map данных (нужна для доступа к полю имени для генерации хеша)
-// возвращает сгенерированный proxy ID или оригинальное значение в случае ошибки
-func processCachedIDField(fieldType string, value any, data map[string]any, serverID int, uniqProxyID map[string]map[any]bool, mu *sync.RWMutex, deepLevel int) any {
+// возвращает сгенерированный proxy ID, оригинальное значение в случае ошибки или
+// duplicateEntry для повторной сущности
+func (prx *Proxy) processCachedIDField(fieldType string, value any, data map[string]any, serverID int, uniqProxyID map[string]map[any]bool, mu *sync.RWMutex, deepLevel int) any {
 	// Генерируем proxy ID на основе имени сущности
-	id, err := generateProxyID(fieldType, data, serverID)
+	id, err := prx.generateProxyID(fieldType, data, serverID)
 	if err != nil {
-		// В случае ошибки генерации логируем ошибку и возвращаем оригинальное значение
-		logger.Global.Errorf("server[%d]: ProxyID generation failed for %s: %v", serverID, fieldType, err)
-		return value
+		// Ссылка на сущность без ее имени (например hostid в интерфейсе хоста из
+		// hostinterface.get), которой еще нет в кеше. Возвращаем ID с номером сервера:
+		// оригинальный ID был бы принят в следующих запросах за ID другого сервера
+		logger.Global.Warningf("server[%d]: ProxyID generation failed for %s: %v, using server ID suffix", serverID, fieldType, err)
+		return simpleModifyID(value, serverID)
 	}
 
 	// Проверяем нужно ли проверять дубликаты для этого типа сущности на текущем уровне вложенности
 	if deepLevel == 1 && slices.Contains(dedupFileds, fieldType) {
 		// Для group сущностей на верхнем уровне проверяем дубликаты
 		if isDuplicateID(id, fieldType, uniqProxyID, mu) {
-			// Если дубликат найден - возвращаем nil для фильтрации элемента
-			return nil
+			// Если дубликат найден - элемент удаляется из результата
+			logger.Global.Tracef("server[%d]: duplicate %s ProxyID %v dropped", serverID, fieldType, id)
+			return duplicateEntry{}
 		}
 		// Помечаем ID как обработанный чтобы предотвратить будущие дубликаты
 		markIDAsProcessed(id, fieldType, uniqProxyID, mu)
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"maps"
 	"os"
 	"strconv"
 	"sync"
@@ -18,20 +19,14 @@ func initTestCache() cacheConfig {
 		CleanupInterval: "1m",
 		DBPath:          ":memory:",
 		AutoSave:        "30s",
-		CachedFields:    prx.cachedFields,
 	}
 
 	return cfg
 }
 
-func stopTestProxy() {
-	StopProxy()
-	defer os.Remove(":memory:")
-}
-
 // Функция для очистки тестового proxy
-func cleanupTestProxy() {
-	StopProxy()
+func cleanupTestProxy(prx *Proxy) {
+	prx.Stop()
 	os.Remove(":memory:")
 }
 
@@ -120,8 +115,8 @@ func TestGenerateProxyID(t *testing.T) {
 	// Инициализируем proxy для теста
 	g := Global{MaxRequests: 10}
 	z := ZabbixConf{}
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer stopTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	serverID := 3
 
@@ -165,7 +160,7 @@ func TestGenerateProxyID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := generateProxyID(tt.fieldType, tt.data, serverID)
+			result, err := prx.generateProxyID(tt.fieldType, tt.data, serverID)
 
 			if tt.expectError {
 				if err == nil {
@@ -191,8 +186,8 @@ func TestConvertProxyIDToOriginal(t *testing.T) {
 	// Инициализируем proxy для теста
 	g := Global{MaxRequests: 10}
 	z := ZabbixConf{}
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer stopTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	serverID := 2
 	// Добавляем тестовые данные в кеш
@@ -212,11 +207,14 @@ func TestConvertProxyIDToOriginal(t *testing.T) {
 		{"string proxy ID found", "123450", serverID, "host", "100", true},
 		{"proxy ID not found", 999999, serverID, "host", nil, false},
 		{"wrong server ID", 123450, 999, "host", nil, false},
+		// ID Zabbix прокси и интерфейсов не являются ProxyID, кеша для них нет
+		{"zabbix proxy ID", "123450", serverID, "proxyids", nil, false},
+		{"interface ID", 123450, serverID, "interfaceid", nil, false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := convertProxyIDToOriginal(tt.proxyID, tt.serverID, tt.cacheType)
+			result := prx.convertProxyIDToOriginal(tt.proxyID, tt.serverID, tt.cacheType)
 
 			if tt.shouldFind {
 				if result == nil {
@@ -333,8 +331,8 @@ func TestProcessResponseIDs(t *testing.T) {
 	// Инициализируем proxy для теста
 	g := Global{MaxRequests: 10}
 	z := ZabbixConf{}
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer stopTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	serverID := 1
 	uniqProxyID := make(map[string]map[any]bool)
@@ -370,7 +368,7 @@ func TestProcessResponseIDs(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := processResponseIDs(tt.input, serverID, uniqProxyID, mu, 0)
+			result := prx.processResponseIDs(tt.input, serverID, uniqProxyID, mu, 0)
 
 			// Для сложных структур нужна более детальная проверка
 			if result == nil {
@@ -380,6 +378,53 @@ func TestProcessResponseIDs(t *testing.T) {
 	}
 }
 
+// TestProcessResponseIDs_InterfacesAndProxies тестирует преобразование ID
+// интерфейсов хостов и Zabbix прокси
+func TestProcessResponseIDs_InterfacesAndProxies(t *testing.T) {
+	prx := InitProxy(Global{MaxRequests: 10}, ZabbixConf{}, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	serverID := 1
+	uniqProxyID := make(map[string]map[any]bool)
+	mu := &sync.RWMutex{}
+
+	// hostinterface.get: хоста еще нет в кеше, имени хоста в ответе нет
+	interfaces := prx.processResponseIDs([]any{
+		map[string]any{"interfaceid": "5", "hostid": "10084", "ip": "127.0.0.1"},
+	}, serverID, uniqProxyID, mu, 0).([]any)
+	iface := interfaces[0].(map[string]any)
+	if iface["interfaceid"] != "51" {
+		t.Errorf("interfaceid: expected 51, got %v", iface["interfaceid"])
+	}
+	// Оригинальный ID хоста был бы принят за ID сервера 4
+	if iface["hostid"] != "100841" {
+		t.Errorf("hostid: expected 100841, got %v", iface["hostid"])
+	}
+	if originalID := convertGrafanaIDToOriginal(iface["hostid"], serverID); originalID != 10084 {
+		t.Errorf("hostid should resolve back to 10084, got %v", originalID)
+	}
+
+	// proxy.get и ссылки хостов на Zabbix прокси (proxyid, proxy_hostid в Zabbix < 7.0)
+	proxies := prx.processResponseIDs([]any{
+		map[string]any{"proxyid": "3", "name": "zbx-proxy", "hosts": []any{map[string]any{"hostid": "10085", "name": "h1"}}},
+	}, serverID, uniqProxyID, mu, 0).([]any)
+	zbxProxy := proxies[0].(map[string]any)
+	if zbxProxy["proxyid"] != "31" {
+		t.Errorf("proxyid: expected 31, got %v", zbxProxy["proxyid"])
+	}
+	if _, ok := prx.cache.CacheType["proxy"]; ok {
+		t.Error("Zabbix proxies must not be cached by name")
+	}
+
+	hosts := prx.processResponseIDs([]any{
+		map[string]any{"hostid": "10086", "name": "h2", "proxyid": "3", "proxy_hostid": "3"},
+	}, serverID, uniqProxyID, mu, 0).([]any)
+	host := hosts[0].(map[string]any)
+	if host["proxyid"] != "31" || host["proxy_hostid"] != "31" {
+		t.Errorf("host proxy references: expected 31, got %v and %v", host["proxyid"], host["proxy_hostid"])
+	}
+}
+
 // TestGetServerFromID тестирует функцию getServerFromID
 func TestGetServerFromID(t *testing.T) {
 	tests := []struct {
@@ -477,13 +522,26 @@ func TestIDBasedResponseSimpleModify(t *testing.T) {
 	}
 }
 
+// TestIDBasedResponseSimpleModifyMixedKeys тестирует, что результат для ключей
+// разного вида не зависит от порядка обхода map
+func TestIDBasedResponseSimpleModifyMixedKeys(t *testing.T) {
+	expected := map[string]any{"1002": "a", "2002": "b", "3002": "c", "name": "d", "text": "e", "x1": "f"}
+	for range 50 {
+		data := map[string]any{"100": "a", "200": "b", "300": "c", "name": "d", "text": "e", "x1": "f"}
+		ifIDBasedResponseSimpleModify(data, 2)
+		if !maps.Equal(data, expected) {
+			t.Fatalf("Expected %v, got %v", expected, data)
+		}
+	}
+}
+
 // TestGenerateProxyIDCollisions тестирует механизм разрешения коллизий
 func TestGenerateProxyIDCollisions(t *testing.T) {
 	// Инициализируем proxy для теста
 	g := Global{MaxRequests: 10}
 	z := ZabbixConf{}
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer stopTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	serverID := 3
 	fieldType := "host"
@@ -506,7 +564,7 @@ func TestGenerateProxyIDCollisions(t *testing.T) {
 			"name":   name,
 		}
 
-		result, err := generateProxyID(fieldType, data, serverID)
+		result, err := prx.generateProxyID(fieldType, data, serverID)
 		if err != nil {
 			t.Errorf("Failed to generate proxy ID for '%s': %v", name, err)
 			continue
@@ -550,8 +608,8 @@ func TestGenerateProxyIDForcedCollision(t *testing.T) {
 	// Инициализируем proxy для теста
 	g := Global{MaxRequests: 10}
 	z := ZabbixConf{}
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer stopTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	serverID := 3
 	fieldType := "host"
@@ -563,7 +621,7 @@ func TestGenerateProxyIDForcedCollision(t *testing.T) {
 		"name":   name1,
 	}
 
-	result1, err := generateProxyID(fieldType, data1, serverID)
+	result1, err := prx.generateProxyID(fieldType, data1, serverID)
 	if err != nil {
 		t.Fatalf("First generation failed: %v", err)
 	}
@@ -592,7 +650,7 @@ func TestGenerateProxyIDForcedCollision(t *testing.T) {
 		"name":   name2,
 	}
 
-	result2, err := generateProxyID(fieldType, data2, serverID)
+	result2, err := prx.generateProxyID(fieldType, data2, serverID)
 	if err != nil {
 		t.Fatalf("Second generation with collision failed: %v", err)
 	}
@@ -623,8 +681,8 @@ func TestGenerateProxyIDMultipleCollisions(t *testing.T) {
 	// Инициализируем proxy для теста
 	g := Global{MaxRequests: 10}
 	z := ZabbixConf{}
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer stopTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	serverID := 3
 	fieldType := "host"
@@ -636,7 +694,7 @@ func TestGenerateProxyIDMultipleCollisions(t *testing.T) {
 		"name":   baseName,
 	}
 
-	baseResult, err := generateProxyID(fieldType, baseData, serverID)
+	baseResult, err := prx.generateProxyID(fieldType, baseData, serverID)
 	if err != nil {
 		t.Fatalf("Base generation failed: %v", err)
 	}
@@ -664,7 +722,7 @@ func TestGenerateProxyIDMultipleCollisions(t *testing.T) {
 		"name":   newName,
 	}
 
-	newResult, err := generateProxyID(fieldType, newData, serverID)
+	newResult, err := prx.generateProxyID(fieldType, newData, serverID)
 	if err != nil {
 		// Если после 5 попыток коллизия не разрешилась - это ожидаемо
 		t.Logf("Multiple collisions exhausted attempts as expected: %v", err)
@@ -692,8 +750,8 @@ func TestGenerateProxyIDWithExistingCache(t *testing.T) {
 	// Инициализируем proxy для теста
 	g := Global{MaxRequests: 10}
 	z := ZabbixConf{}
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer stopTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	serverID := 3
 	fieldType := "host"
@@ -704,7 +762,7 @@ func TestGenerateProxyIDWithExistingCache(t *testing.T) {
 		"name":   "test-host-1",
 	}
 
-	result1, err := generateProxyID(fieldType, data1, serverID)
+	result1, err := prx.generateProxyID(fieldType, data1, serverID)
 	if err != nil {
 		t.Fatalf("First generation failed: %v", err)
 	}
@@ -715,7 +773,7 @@ func TestGenerateProxyIDWithExistingCache(t *testing.T) {
 		"name":   "test-host-1",
 	}
 
-	result2, err := generateProxyID(fieldType, data2, serverID+1)
+	result2, err := prx.generateProxyID(fieldType, data2, serverID+1)
 	if err != nil {
 		t.Fatalf("Second generation failed: %v", err)
 	}
@@ -731,7 +789,7 @@ func TestGenerateProxyIDWithExistingCache(t *testing.T) {
 		"name":   "test-host-2",
 	}
 
-	result3, err := generateProxyID(fieldType, data3, serverID)
+	result3, err := prx.generateProxyID(fieldType, data3, serverID)
 	if err != nil {
 		t.Fatalf("Third generation failed: %v", err)
 	}
@@ -746,8 +804,8 @@ func TestGenerateProxyIDMultipleServers(t *testing.T) {
 	// Инициализируем proxy для теста
 	g := Global{MaxRequests: 10}
 	z := ZabbixConf{}
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer stopTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	fieldType := "host"
 	hostName := "multi-server-host"
@@ -762,7 +820,7 @@ func TestGenerateProxyIDMultipleServers(t *testing.T) {
 			"name":   hostName,
 		}
 
-		result, err := generateProxyID(fieldType, data, serverID)
+		result, err := prx.generateProxyID(fieldType, data, serverID)
 		if err != nil {
 			t.Errorf("Failed to generate ID for server %d: %v", serverID, err)
 			continue
@@ -793,7 +851,7 @@ func TestGenerateProxyIDMultipleServers(t *testing.T) {
 			"hostid": serverID * 100,
 		}
 
-		result, err := generateProxyID(fieldType, data, serverID)
+		result, err := prx.generateProxyID(fieldType, data, serverID)
 		if err != nil {
 			t.Errorf("Failed to get cached ID for server %d: %v", serverID, err)
 			continue
@@ -810,8 +868,8 @@ func TestGenerateProxyIDStringResult(t *testing.T) {
 	// Инициализируем proxy для теста
 	g := Global{MaxRequests: 10}
 	z := ZabbixConf{}
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer stopTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	serverID := 3
 	fieldType := "host"
@@ -822,7 +880,7 @@ func TestGenerateProxyIDStringResult(t *testing.T) {
 		"name":   "string-id-host",
 	}
 
-	result, err := generateProxyID(fieldType, data, serverID)
+	result, err := prx.generateProxyID(fieldType, data, serverID)
 	if err != nil {
 		t.Fatalf("Generation with string ID failed: %v", err)
 	}
@@ -848,8 +906,8 @@ func TestGenerateProxyIDEdgeCases(t *testing.T) {
 	// Инициализируем proxy для теста
 	g := Global{MaxRequests: 10}
 	z := ZabbixConf{}
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer stopTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	serverID := 3
 	fieldType := "host"
@@ -893,7 +951,7 @@ func TestGenerateProxyIDEdgeCases(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := generateProxyID(fieldType, tt.data, serverID)
+			result, err := prx.generateProxyID(fieldType, tt.data, serverID)
 
 			if tt.expectError {
 				if err == nil {
@@ -2,12 +2,19 @@ package proxy
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"ZabbixAPIproxy/internal/logger"
 	"ZabbixAPIproxy/internal/zabbix"
 
 	"github.com/a3ak/circuitbreaker"
@@ -19,6 +26,7 @@ import (
 type MockZabbixClient struct {
 	mu          sync.Mutex
 	SendFunc    func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error)
+	WarmUpFunc  func(ctx context.Context, url string, ignoreSSL bool, conns int) (int, error)
 	CallCount   int
 	LastRequest map[string]any
 }
@@ -46,29 +54,55 @@ func (m *MockZabbixClient) SendToZabbix(ctx context.Context, url string, ignoreS
 
 func (m *MockZabbixClient) Close()               {}
 func (m *MockZabbixClient) GetClientsCount() int { return 0 }
+func (m *MockZabbixClient) GetDNSStats() map[string]zabbix.DNSStats {
+	return nil
+}
+func (m *MockZabbixClient) GetCertStats() map[string]zabbix.CertStats {
+	return nil
+}
+func (m *MockZabbixClient) GetTrafficStats() map[string]zabbix.TrafficStats {
+	return nil
+}
+func (m *MockZabbixClient) WarmUp(ctx context.Context, url string, ignoreSSL bool, conns int) (int, error) {
+	if m.WarmUpFunc != nil {
+		return m.WarmUpFunc(ctx, url, ignoreSSL, conns)
+	}
+	return conns, nil
+}
 
 // MockMetricsCollector для тестов
 type MockMetricsCollector struct {
-	mu               sync.Mutex
-	requestsTotal    map[string]int
-	responseSizes    []int
-	requestDurations []time.Duration
-	requestErrors    map[string]int
-	activeRequests   int
+	mu                   sync.Mutex
+	requestsTotal        map[string]int
+	clientRequests       map[string]int
+	responseSizes        []int
+	requestDurations     []time.Duration
+	durationStatuses     map[string]int
+	idProcessing         []time.Duration
+	upstreamRequestSizes []int64
+	requestErrors        map[string]int
+	activeRequests       int
+	queueWaits           map[string]int
+	authFailures         map[string]int
 }
 
 func NewMockMetricsCollector() *MockMetricsCollector {
 	return &MockMetricsCollector{
-		requestsTotal: make(map[string]int),
-		requestErrors: make(map[string]int),
+		requestsTotal:    make(map[string]int),
+		clientRequests:   make(map[string]int),
+		durationStatuses: make(map[string]int),
+		requestErrors:    make(map[string]int),
+		queueWaits:       make(map[string]int),
+		authFailures:     make(map[string]int),
 	}
 }
 
-func (m *MockMetricsCollector) IncRequestsTotal(method, status string) {
+func (m *MockMetricsCollector) IncRequestsTotal(method, status, client string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	key := fmt.Sprintf("%s_%s", method, status)
 	m.requestsTotal[key]++
+	m.clientRequests[client]++
 }
 
 func (m *MockMetricsCollector) ObserveResponseSize(size int) {
@@ -77,10 +111,23 @@ func (m *MockMetricsCollector) ObserveResponseSize(size int) {
 	m.responseSizes = append(m.responseSizes, size)
 }
 
-func (m *MockMetricsCollector) ObserveRequestDuration(server, method string, duration time.Duration) {
+func (m *MockMetricsCollector) ObserveRequestDuration(server, method, status string, duration time.Duration) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.requestDurations = append(m.requestDurations, duration)
+	m.durationStatuses[server+"_"+status]++
+}
+
+func (m *MockMetricsCollector) ObserveIDProcessing(method string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.idProcessing = append(m.idProcessing, duration)
+}
+
+func (m *MockMetricsCollector) ObserveUpstreamRequestSize(method string, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.upstreamRequestSizes = append(m.upstreamRequestSizes, size)
 }
 
 func (m *MockMetricsCollector) IncRequestStatus(server, errorType string) {
@@ -96,6 +143,25 @@ func (m *MockMetricsCollector) IncIncomingRequests(server string) {
 	m.activeRequests++
 }
 
+func (m *MockMetricsCollector) AddReconciled(server, action string, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := fmt.Sprintf("reconcile_%s_%s", server, action)
+	m.requestErrors[key] += count
+}
+
+func (m *MockMetricsCollector) ObserveQueueWait(server string, wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queueWaits[server]++
+}
+
+func (m *MockMetricsCollector) IncAuthFailure(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.authFailures[reason]++
+}
+
 func (m *MockMetricsCollector) GetRequestsTotal(method, status string) int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -108,6 +174,7 @@ type TestProxy struct {
 	t           *testing.T
 	zbxClient   *MockZabbixClient
 	metrics     *MockMetricsCollector
+	prx         *Proxy
 	initialized bool
 }
 
@@ -125,33 +192,24 @@ func (tp *TestProxy) processAllServersWithMock(ctx context.Context, request map[
 		tp.t.Fatal("TestProxy not initialized. Call Init() first.")
 	}
 
-	// Сохраняем оригинальные зависимости
-	originalClient := prx.zbxClient
-	originalMetrics := metricsCollector
-
 	// Подменяем зависимости для теста
-	prx.zbxClient = tp.zbxClient
-	metricsCollector = tp.metrics
-
-	// Восстанавливаем оригинальные зависимости после завершения
-	defer func() {
-		prx.zbxClient = originalClient
-		metricsCollector = originalMetrics
-	}()
+	tp.prx.zbxClient = tp.zbxClient
+	tp.prx.SetMetrics(tp.metrics)
 
-	return processAllServers(ctx, request, trace_id)
+	return tp.prx.processAllServers(ctx, request, trace_id)
 }
 
-func (tp *TestProxy) Init(g Global, z ZabbixConf, cbConf CBConf, cacheCfg CacheConf, excludeLog []string) {
+func (tp *TestProxy) Init(g Global, z ZabbixConf, cbConf CBConf, cacheCfg CacheConf, exclude ExcludeMethods) *Proxy {
 	// Инициализируем proxy с тестовыми настройками
-	InitProxy(g, z, cbConf, cacheCfg, excludeLog)
+	tp.prx = InitProxy(g, z, cbConf, cacheCfg, exclude)
 
 	tp.initialized = true
+	return tp.prx
 }
 
 func (tp *TestProxy) Cleanup() {
 	if tp.initialized {
-		StopProxy()
+		tp.prx.Stop()
 		tp.initialized = false
 	}
 
@@ -206,19 +264,58 @@ func TestInitProxy(t *testing.T) {
 		AutoSave:        "30s",
 	}
 
-	excludeLog := []string{"apiinfo.version", "user.login"}
+	exclude := ExcludeMethods{Log: []string{"apiinfo.version", "user.login"}, Metrics: []string{"user.login"}}
 
-	InitProxy(g, z, cbConf, cacheCfg, excludeLog)
+	prx := InitProxy(g, z, cbConf, cacheCfg, exclude)
 
 	// Проверяем инициализацию
 	assert.NotNil(t, prx.cache)
 	assert.Equal(t, 2, len(prx.config.Servers))
 	assert.Equal(t, 10, cap(prx.requestSemaphore))
-	assert.Equal(t, []string{"apiinfo.version", "user.login"}, prx.excludeRequests)
+	assert.Equal(t, exclude, prx.exclude)
 	assert.NotNil(t, prx.zbxClient)
 
 	// Cleanup
-	cleanupTestProxy()
+	cleanupTestProxy(prx)
+}
+
+// TestInitProxy_Instances тестирует независимые экземпляры proxy в одном процессе
+func TestInitProxy_Instances(t *testing.T) {
+	newInstance := func(token, name string) *Proxy {
+		cacheCfg := CacheConf(initTestCache())
+		cacheCfg.DBPath = filepath.Join(t.TempDir(), "cache.db")
+		z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://" + name, ID: 1, Token: "token"}}}
+		prx := InitProxy(Global{MaxRequests: 5, Token: token}, z, CBConf{}, cacheCfg, ExcludeMethods{})
+		prx.global.maxReqBodySizeInt64 = 1024
+		prx.zbxClient = &MockZabbixClient{SendFunc: func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+			return map[string]any{"result": []any{map[string]any{"hostid": "10084", "name": name}}}, nil
+		}}
+		return prx
+	}
+	first, second := newInstance("token-a", "first"), newInstance("token-b", "second")
+	defer first.Stop()
+	defer second.Stop()
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "params": map[string]any{}, "id": 1}
+	for prx, name := range map[*Proxy]string{first: "first", second: "second"} {
+		results, errors := prx.ProcessAllServers(context.Background(), deepClone(request).(map[string]any), "test-instances")
+		require.Empty(t, errors)
+		require.Len(t, results, 1)
+		assert.Equal(t, name, results.([]any)[0].(map[string]any)["name"])
+	}
+
+	// Каждый экземпляр проверяет токен из своей конфигурации
+	call := func(prx *Proxy, token string) int {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"host.get","params":{},"id":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		prx.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, call(first, "token-a"))
+	assert.Equal(t, http.StatusUnauthorized, call(first, "token-b"))
+	assert.Equal(t, http.StatusOK, call(second, "token-b"))
 }
 
 // TestInitProxy_DefaultMaxRequests тестирует дефолтное значение MaxRequests
@@ -231,13 +328,13 @@ func TestInitProxy_DefaultMaxRequests(t *testing.T) {
 		Servers: []zabbix.ZabbixServer{},
 	}
 
-	InitProxy(g, z, CBConf{}, CacheConf{
+	prx := InitProxy(g, z, CBConf{}, CacheConf{
 		TTL:             "1h",
 		CleanupInterval: "5m",
 		DBPath:          ":memory:",
 		AutoSave:        "30s",
-	}, []string{})
-	defer cleanupTestProxy()
+	}, ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
 	// Проверяем, что MaxRequests стал 100 (дефолт)
 	assert.Equal(t, 100, cap(prx.requestSemaphore))
@@ -253,10 +350,10 @@ func TestGetAllServers(t *testing.T) {
 		},
 	}
 
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer cleanupTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
-	servers := getAllServers()
+	servers := prx.getAllServers()
 	assert.ElementsMatch(t, []int{1, 2, 3}, servers)
 }
 
@@ -294,6 +391,15 @@ func TestGetTargetServers(t *testing.T) {
 			},
 			expected: []int{1, 2}, // All servers
 		},
+		{
+			name: "server not in config",
+			request: map[string]any{
+				"params": map[string]any{
+					"hostids": []any{"10009"}, // Server ID 9
+				},
+			},
+			expected: []int{},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -305,10 +411,10 @@ func TestGetTargetServers(t *testing.T) {
 				},
 			}
 
-			InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-			defer cleanupTestProxy()
+			prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+			defer cleanupTestProxy(prx)
 
-			servers := getTargetServers(tc.request)
+			servers := prx.getTargetServers(tc.request)
 			assert.ElementsMatch(t, tc.expected, servers)
 		})
 	}
@@ -350,7 +456,7 @@ func TestProcessAllServers_Success(t *testing.T) {
 		AutoSave:        "30s",
 	}
 
-	testProxy.Init(g, z, cbConf, cacheCfg, []string{})
+	testProxy.Init(g, z, cbConf, cacheCfg, ExcludeMethods{})
 
 	cb := circuitbreaker.NewCBManager()
 	// Initialize circuit breakers
@@ -381,6 +487,14 @@ func TestProcessAllServers_Success(t *testing.T) {
 	mockClient := testProxy.GetMockClient()
 	assert.NotNil(t, mockClient)
 	assert.Greater(t, mockClient.CallCount, 0)
+
+	// Время ожидания семафора учтено для целевого сервера
+	testProxy.metrics.mu.Lock()
+	defer testProxy.metrics.mu.Unlock()
+	assert.Equal(t, 1, testProxy.metrics.queueWaits["http://server1.com"])
+	// Длительность ответа учтена со статусом, время преобразования ID - один раз на запрос
+	assert.Equal(t, 1, testProxy.metrics.durationStatuses["http://server1.com_success"])
+	assert.Len(t, testProxy.metrics.idProcessing, 1)
 }
 
 // TestProcessAllServers_Timeout тестирует обработку таймаутов
@@ -405,8 +519,10 @@ func TestProcessAllServers_Timeout(t *testing.T) {
 		RecoveryTimeout:  30 * time.Second,
 	}
 
+	// Без запаса deadline_headroom запрос к серверу прерывается таймаутом запроса
 	g := Global{
-		MaxRequests: 5,
+		MaxRequests:      5,
+		DeadlineHeadroom: "0",
 	}
 
 	z := ZabbixConf{
@@ -422,7 +538,7 @@ func TestProcessAllServers_Timeout(t *testing.T) {
 		},
 	}
 
-	testProxy.Init(g, z, cbConf, CacheConf(initTestCache()), []string{})
+	testProxy.Init(g, z, cbConf, CacheConf(initTestCache()), ExcludeMethods{})
 	cb := circuitbreaker.NewCBManager()
 	//Initialize circuit breakers
 	cb.InitCircuitBreakers([]string{"slow-server"}, circuitbreaker.CircuitBreakerConf{
@@ -476,7 +592,7 @@ func TestProcessAllServers_Error(t *testing.T) {
 		},
 	}
 
-	testProxy.Init(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
+	testProxy.Init(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
 
 	cb := circuitbreaker.NewCBManager()
 	// Initialize circuit breakers
@@ -503,6 +619,189 @@ func TestProcessAllServers_Error(t *testing.T) {
 	assert.Contains(t, errors[0], "mock server error")
 }
 
+// TestProcessAllServers_InvalidResponse тестирует учет непригодных ответов сервера
+func TestProcessAllServers_InvalidResponse(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	mockClient := testProxy.GetMockClient()
+	mockClient.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		return nil, &zabbix.InvalidResponseError{Reason: zabbix.InvalidID, Detail: "invalid JSON-RPC response: id 2, expected 1"}
+	}
+
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://server1.com", ID: 1, Token: "token1"}}}
+	prx := testProxy.Init(Global{MaxRequests: 5}, z, CBConf{FailureThreshold: 2, RecoveryTimeout: 30 * time.Second}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+	for i := 0; i < 2; i++ {
+		_, errors := testProxy.processAllServersWithMock(context.Background(), deepClone(request).(map[string]any), "test-invalid")
+		require.NotEmpty(t, errors)
+	}
+
+	// Непригодные ответы учитываются отдельно от прочих ошибок и открывают Circuit Breaker
+	metrics := testProxy.GetMockMetrics()
+	assert.Equal(t, 2, metrics.requestErrors["http://server1.com_invalid_id"])
+	assert.Zero(t, metrics.requestErrors["http://server1.com_error"])
+	allowed, _ := prx.cb.AllowRequest("server1.com")
+	assert.False(t, allowed)
+}
+
+// TestProcessAllServers_ZabbixError тестирует учет ошибок Zabbix в Circuit Breaker:
+// ошибки запроса клиента не открывают его, сбои сервера - открывают
+func TestProcessAllServers_ZabbixError(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{
+		{URL: "http://server1.com", ID: 1, Token: "token1"},
+		{URL: "http://server2.com", ID: 2, Token: "token2"},
+	}}
+	prx := testProxy.Init(Global{MaxRequests: 5}, z, CBConf{FailureThreshold: 2, RecoveryTimeout: 30 * time.Second}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	mockClient := testProxy.GetMockClient()
+	mockClient.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		if url == "http://server1.com" {
+			return nil, &zabbix.APIError{Code: -32602, Message: "Invalid params.",
+				Object: map[string]any{"code": -32602.0, "message": "Invalid params.", "data": "No permissions to referred object or it does not exist!"}}
+		}
+		return nil, &zabbix.APIError{Code: -32500, Message: "Application error.", Data: "SQL statement execution has failed.",
+			Object: map[string]any{"code": -32500.0, "message": "Application error.", "data": "SQL statement execution has failed."}}
+	}
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+	for i := 0; i < 3; i++ {
+		_, errors := testProxy.processAllServersWithMock(context.Background(), deepClone(request).(map[string]any), "test-zabbix-error")
+		require.NotEmpty(t, errors)
+	}
+
+	metrics := testProxy.GetMockMetrics()
+	assert.Equal(t, 3, metrics.requestErrors["http://server1.com_client_error"])
+	assert.Zero(t, metrics.requestErrors["http://server1.com_error"])
+	// Длительность неудачных запросов учитывается со статусом ошибки
+	assert.Equal(t, 3, metrics.durationStatuses["http://server1.com_client_error"])
+	assert.Equal(t, 2, metrics.durationStatuses["http://server2.com_error"])
+	allowed, _ := prx.cb.AllowRequest("server1.com")
+	assert.True(t, allowed)
+	allowed, _ = prx.cb.AllowRequest("server2.com")
+	assert.False(t, allowed)
+}
+
+// TestUpstreamTokensRedacted тестирует, что токены серверов не попадают
+// в логи, ответы клиентам и записи самописца
+func TestUpstreamTokensRedacted(t *testing.T) {
+	const token = "upstream-secret-token"
+
+	// Логгер запроса передается через контекст: logger.Global читают фоновые процессы других тестов
+	logFile := filepath.Join(t.TempDir(), "proxy.log")
+	fileLogger, err := logger.New(logger.Logging{FilePath: logFile, FileLevel: "trace"})
+	require.NoError(t, err)
+
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+	g := Global{MaxRequests: 5, FlightRecorder: FlightRecorderConf{Size: 10, SampleRatio: 1}}
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://server1.com", ID: 1, Token: token}}}
+	prx := testProxy.Init(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer logger.SetSecrets()
+
+	// Сервер отклоняет запрос, приводя его в ошибке вместе с токеном
+	var sentAuth any
+	mock := testProxy.GetMockClient()
+	mock.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, req map[string]any) (map[string]any, error) {
+		sentAuth = req["auth"]
+		return nil, fmt.Errorf("upstream rejected request %v", req)
+	}
+	prx.zbxClient = mock
+
+	body := []byte(`{"jsonrpc":"2.0","method":"host.get","params":{},"id":1}`)
+	ctx := context.WithValue(context.Background(), traceIDKey, "trace-redact")
+	ctx = logger.NewContext(ctx, fileLogger.WithFields(logger.Fields{logger.TraceIDField: "trace-redact"}))
+	req := httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+	req = req.WithContext(context.WithValue(ctx, bodyKey, body))
+	w := httptest.NewRecorder()
+	prx.Handler(w, req)
+
+	require.Equal(t, token, sentAuth)
+	assert.Contains(t, w.Body.String(), "upstream rejected request")
+	assert.NotContains(t, w.Body.String(), token)
+
+	records, err := json.Marshal(prx.recorder.list(""))
+	require.NoError(t, err)
+	assert.Contains(t, string(records), "upstream rejected request")
+	assert.NotContains(t, string(records), token)
+
+	logs, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(logs), "upstream rejected request")
+	assert.NotContains(t, string(logs), token)
+}
+
+// TestRequestLogger тестирует, что логи клиента Zabbix получают trace_id
+// и ID сервера из логгера запроса
+func TestRequestLogger(t *testing.T) {
+	// Логгер запроса передается через контекст: logger.Global читают фоновые процессы других тестов
+	logFile := filepath.Join(t.TempDir(), "proxy.log")
+	fileLogger, err := logger.New(logger.Logging{FilePath: logFile, FileLevel: "trace"})
+	require.NoError(t, err)
+
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://server1.com", ID: 1, Token: "token1"}}}
+	prx := testProxy.Init(Global{MaxRequests: 5}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	mock := testProxy.GetMockClient()
+	mock.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, req map[string]any) (map[string]any, error) {
+		logger.WithContext(ctx).Warningf("mock upstream call")
+		return map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": 1}, nil
+	}
+	prx.zbxClient = mock
+
+	body := []byte(`{"jsonrpc":"2.0","method":"host.get","params":{},"id":1}`)
+	ctx := context.WithValue(context.Background(), traceIDKey, "trace-ctx")
+	ctx = logger.NewContext(ctx, fileLogger.WithFields(logger.Fields{logger.TraceIDField: "trace-ctx"}))
+	req := httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+	req = req.WithContext(context.WithValue(ctx, bodyKey, body))
+	w := httptest.NewRecorder()
+	prx.Handler(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	logs, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(logs), "[trace-ctx] server=1 mock upstream call")
+	assert.Contains(t, string(logs), "[trace-ctx] Incoming HTTP request")
+}
+
+// TestProcessAllServers_ExcludedFromMetrics тестирует исключение метода из метрик
+func TestProcessAllServers_ExcludedFromMetrics(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	z := ZabbixConf{
+		Servers: []zabbix.ZabbixServer{
+			{URL: "http://server1.com", ID: 1, Token: "token1", Name: "server1"},
+		},
+	}
+	testProxy.Init(Global{MaxRequests: 5}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{Metrics: []string{"hostgroup.get"}})
+
+	send := func(method string) {
+		request := map[string]any{
+			"jsonrpc": "2.0",
+			"method":  method,
+			"id":      1,
+			"params":  map[string]any{},
+		}
+		_, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-exclude")
+		require.Empty(t, errors)
+	}
+
+	send("hostgroup.get")
+	assert.Empty(t, testProxy.metrics.queueWaits, "excluded method must not be counted")
+	assert.Empty(t, testProxy.metrics.requestDurations)
+
+	send("host.get")
+	assert.Equal(t, 1, testProxy.metrics.queueWaits["http://server1.com"])
+	assert.Len(t, testProxy.metrics.requestDurations, 1)
+}
+
 // TestExtractServersFromParams тестирует извлечение серверов из параметров
 func TestExtractServersFromParams(t *testing.T) {
 	testCases := []struct {
@@ -557,10 +856,10 @@ func TestGetConnectionStats(t *testing.T) {
 		},
 	}
 
-	InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), []string{})
-	defer cleanupTestProxy()
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
 
-	stats := GetConnectionStats()
+	stats := prx.GetConnectionStats()
 
 	assert.Contains(t, stats, "active_goroutines")
 	assert.Contains(t, stats, "active_requests")
@@ -573,6 +872,7 @@ func TestGetConnectionStats(t *testing.T) {
 
 // TestPrettyJSON тестирует форматирование JSON с маскировкой токенов
 func TestPrettyJSON(t *testing.T) {
+	prx := &Proxy{}
 	testCases := []struct {
 		name     string
 		input    map[string]any
@@ -598,11 +898,20 @@ func TestPrettyJSON(t *testing.T) {
 			contains: []string{"method", "host.get", "*****"},
 			excludes: []string{"short"},
 		},
+		{
+			name: "redact nested password",
+			input: map[string]any{
+				"method": "user.update",
+				"params": map[string]any{"userid": "1", "passwd": "user-password"},
+			},
+			contains: []string{"user.update", redactedValue},
+			excludes: []string{"user-password"},
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := prettyJSON(tc.input)
+			result := prx.prettyJSON(tc.input)
 			assert.NotEmpty(t, result)
 
 			for _, contain := range tc.contains {
@@ -649,13 +958,13 @@ func TestStopProxy(t *testing.T) {
 		AutoSave:        "30s",
 	}
 
-	InitProxy(g, z, CBConf{}, cacheCfg, []string{})
+	prx := InitProxy(g, z, CBConf{}, cacheCfg, ExcludeMethods{})
 
 	// Verify cache is initialized
 	assert.NotNil(t, prx.cache)
 
 	// Stop proxy
-	StopProxy()
+	prx.Stop()
 
 	// Verify semaphore is closed (нужно аккуратно проверять, так как close делает канал непригодным для использования)
 	// Вместо этого проверим, что основные структуры очищены
@@ -684,3 +993,109 @@ func TestReturnToPool(t *testing.T) {
 	returnToPool(obj)
 	// Mainly testing that it doesn't panic
 }
+
+// TestProcessAllServers_StableOrder тестирует объединение ответов в порядке ID серверов
+func TestProcessAllServers_StableOrder(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	// Сервер 2 в конфиге первым, что бы его ответ обычно приходил раньше
+	z := ZabbixConf{
+		Servers: []zabbix.ZabbixServer{
+			{URL: "http://server2.com", ID: 2, Token: "token2", Name: "server2"},
+			{URL: "http://server1.com", ID: 1, Token: "token1", Name: "server1"},
+		},
+	}
+	testProxy.Init(Global{MaxRequests: 5, StableOrder: true}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	mock := testProxy.GetMockClient()
+	mock.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"result": []any{
+				map[string]any{"itemid": "1", "name": url + "-a"},
+				map[string]any{"itemid": "2", "name": url + "-b"},
+			},
+			"id": request["id"],
+		}, nil
+	}
+
+	for i := 0; i < 10; i++ {
+		request := map[string]any{"jsonrpc": "2.0", "method": "item.get", "id": 1, "params": map[string]any{}}
+		results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-stable")
+		require.Empty(t, errors)
+
+		var names []any
+		for _, item := range results.([]any) {
+			names = append(names, item.(map[string]any)["name"])
+		}
+		assert.Equal(t, []any{"http://server1.com-a", "http://server1.com-b", "http://server2.com-a", "http://server2.com-b"}, names)
+	}
+}
+
+// TestProcessAllServers_SingleServer тестирует запрос к единственному целевому серверу без объединения
+func TestProcessAllServers_SingleServer(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+	testProxy.Init(Global{MaxRequests: 5}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	var sent []map[string]any
+	var mu sync.Mutex
+	testProxy.GetMockClient().SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		mu.Lock()
+		sent = append(sent, deepClone(request).(map[string]any))
+		mu.Unlock()
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"result":  []any{map[string]any{"hostid": "1000", "name": "host"}},
+			"id":      request["id"],
+		}, nil
+	}
+
+	// ID сервера 1: запрос подготавливается в копии, запрос клиента не изменяется
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{"hostids": []any{"10001"}}}
+	results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-single")
+	require.Empty(t, errors)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "token1", sent[0]["auth"])
+	assert.Equal(t, []any{1000}, sent[0]["params"].(map[string]any)["hostids"])
+	assert.NotContains(t, request, "auth")
+	assert.Equal(t, []any{"10001"}, request["params"].(map[string]any)["hostids"])
+
+	// ID ответа преобразованы так же, как при объединении ответов нескольких серверов
+	item := results.([]any)[0].(map[string]any)
+	assert.NotEqual(t, "1000", item["hostid"])
+	assert.Equal(t, "host", item["name"])
+
+	// Пустой ответ - пустой объект, как в общем пути
+	testProxy.GetMockClient().SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		return map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": request["id"]}, nil
+	}
+	results, errors = testProxy.processAllServersWithMock(context.Background(), request, "test-single-empty")
+	assert.Empty(t, errors)
+	assert.Equal(t, map[string]any{}, results)
+}
+
+// BenchmarkProcessAllServers сравнивает запрос к одному серверу и к нескольким серверам
+func BenchmarkProcessAllServers(b *testing.B) {
+	prx := InitProxy(Global{MaxRequests: 10}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.cachedFields = map[string]string{}
+	prx.zbxClient = &MockZabbixClient{SendFunc: func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		items := make([]any, 20)
+		for i := range items {
+			items[i] = map[string]any{"itemid": strconv.Itoa(i), "name": "item"}
+		}
+		return map[string]any{"jsonrpc": "2.0", "result": items, "id": request["id"]}, nil
+	}}
+
+	for name, ids := range map[string][]any{"single": {"10001"}, "all": {"10001", "10002", "10003"}} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				request := map[string]any{"jsonrpc": "2.0", "method": "item.get", "id": 1, "params": map[string]any{"hostids": ids}}
+				prx.processAllServers(context.Background(), request, "bench")
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Аутентификация эндпоинтов proxy
+const (
+	apiAuthNone  = "none"  // Без авторизации
+	apiAuthAPI   = "api"   // Как запросы API (токен, Basic, JWT, LDAP)
+	apiAuthAdmin = "admin" // Как служебные эндпоинты (клиенты внешних источников - с ролью admin)
+)
+
+// apiEndpoint собственный эндпоинт proxy в описании /.well-known/proxy-api
+type apiEndpoint struct {
+	path    string
+	method  string
+	summary string
+	auth    string
+	query   []string
+	// Эндпоинт доступен при текущей конфигурации, nil - всегда
+	enabled func(prx *Proxy) bool
+}
+
+// apiExtension заголовок или метод JSON-RPC, расширяющий Zabbix API
+type apiExtension struct {
+	name        string
+	description string
+	enabled     func(prx *Proxy) bool
+}
+
+func metricsEnabled(prx *Proxy) bool { return prx.global.MetricPath != "" }
+
+var proxyEndpoints = []apiEndpoint{
+	{path: "/", method: "post", summary: "Zabbix JSON-RPC API of all servers", auth: apiAuthAPI},
+	{path: "/", method: "get", summary: "Proxy info (landing_page: HTML status page)", auth: apiAuthNone,
+		enabled: func(prx *Proxy) bool { return !prx.global.HideInfo }},
+	{path: "/health", method: "get", summary: "Proxy and dependency health", auth: apiAuthNone, enabled: metricsEnabled},
+	{path: "/health/schema", method: "get", summary: "JSON Schema of /health", auth: apiAuthNone, enabled: metricsEnabled},
+	{path: "/ready", method: "get", summary: "Readiness (503 on a passive HA node)", auth: apiAuthNone},
+	{path: "/grafana/variables", method: "post", summary: "Grafana variable values", auth: apiAuthAPI},
+	{path: "/admin/cache/flush", method: "post", summary: "Flush cache mappings", auth: apiAuthAdmin, query: []string{"type", "server"}},
+	{path: "/admin/cache/save", method: "post", summary: "Save the cache to the database", auth: apiAuthAdmin},
+	{path: "/admin/cache/cleanup", method: "post", summary: "Evict expired cache mappings", auth: apiAuthAdmin},
+	{path: "/admin/recorder", method: "post", summary: "Flight recorder captures", auth: apiAuthAdmin, query: []string{"trace_id"},
+		enabled: func(prx *Proxy) bool { return prx.recorder != nil }},
+	{path: "/admin/top", method: "get", summary: "Heaviest clients and methods", auth: apiAuthAdmin, query: []string{"minutes", "limit", "sort"}},
+	{path: "/admin/ha", method: "post", summary: "Switch HA role", auth: apiAuthAdmin, query: []string{"role"},
+		enabled: func(prx *Proxy) bool { return prx.global.HA.Role != "" }},
+	{path: "/admin/ha/snapshot", method: "get", summary: "Cache file copy for the passive HA node", auth: apiAuthAdmin,
+		enabled: func(prx *Proxy) bool { return prx.global.HA.Role != "" }},
+	{path: "/admin/status", method: "get", summary: "Proxy state for the admin UI", auth: apiAuthAdmin},
+	{path: "/admin/log/level", method: "post", summary: "Change log levels", auth: apiAuthAdmin, query: []string{"console", "file"}},
+	{path: "/admin/auth/unlock", method: "post", summary: "Lift an address auth lockout", auth: apiAuthAdmin, query: []string{"ip"}},
+	{path: "/admin/tokens", method: "get", summary: "Issued API tokens", auth: apiAuthAdmin,
+		enabled: func(prx *Proxy) bool { return prx.tokens != nil }},
+	{path: "/admin/tokens", method: "post", summary: "Create or revoke an API token", auth: apiAuthAdmin,
+		query: []string{"action", "name", "read_only"}, enabled: func(prx *Proxy) bool { return prx.tokens != nil }},
+	{path: "/admin/ui", method: "get", summary: "Admin web UI", auth: apiAuthAdmin,
+		enabled: func(prx *Proxy) bool { return prx.global.AdminUI }},
+	{path: "/.well-known/proxy-api", method: "get", summary: "This description", auth: apiAuthNone},
+}
+
+var proxyExtensions = []apiExtension{
+	{name: debugHeader, description: "Per-server breakdown in meta.proxy_debug"},
+	{name: unknownIDsHeader, description: "Unknown ID behaviour: error or empty"},
+	{name: pageSizeHeader, description: "Page size of merged results",
+		enabled: func(prx *Proxy) bool { return prx.global.Pagination.Enabled }},
+	{name: pageOffsetHeader, description: "Page offset of merged results",
+		enabled: func(prx *Proxy) bool { return prx.global.Pagination.Enabled }},
+	{name: pageCursorHeader, description: "Cursor of the next page",
+		enabled: func(prx *Proxy) bool { return prx.global.Pagination.Enabled }},
+	{name: idempotencyKeyHeader, description: "Idempotency key of a write request",
+		enabled: func(prx *Proxy) bool { return prx.idempotency != nil }},
+	{name: writeModeHeader, description: "coordinated: multi-server write with rollback report",
+		enabled: func(prx *Proxy) bool { return prx.global.CoordinatedWrites.Enabled }},
+	{name: writeServersHeader, description: "Server IDs of a coordinated write",
+		enabled: func(prx *Proxy) bool { return prx.global.CoordinatedWrites.Enabled }},
+}
+
+var proxyMethods = []apiExtension{
+	{name: maintenanceCreateAll, description: "Create a maintenance window on all servers",
+		enabled: func(prx *Proxy) bool {
+			return prx.global.CoordinatedWrites.Enabled && prx.global.CoordinatedWrites.AllowCreate
+		}},
+}
+
+// APIDescription описывает собственные эндпоинты proxy, заголовки и методы расширений
+// в формате OpenAPI 3: автоматизация и веб-интерфейс узнают возможности версии proxy.
+// Перечисляются только эндпоинты и расширения, доступные при текущей конфигурации
+func (prx *Proxy) APIDescription() map[string]any {
+	authConfigured := prx.global.Token != "" || (prx.global.Login != "" && prx.global.AuthPassword() != "") || prx.jwt != nil || prx.ldap != nil || prx.tokens != nil
+
+	paths := map[string]any{}
+	for _, e := range proxyEndpoints {
+		if e.enabled != nil && !e.enabled(prx) {
+			continue
+		}
+		op := map[string]any{"summary": e.summary, "x-proxy-auth": e.auth}
+		if e.auth == apiAuthNone || !authConfigured {
+			op["security"] = []any{}
+		}
+		if len(e.query) > 0 {
+			params := make([]any, 0, len(e.query))
+			for _, name := range e.query {
+				params = append(params, map[string]any{"name": name, "in": "query", "schema": map[string]any{"type": "string"}})
+			}
+			op["parameters"] = params
+		}
+		op["responses"] = map[string]any{"200": map[string]any{"description": "OK"}}
+
+		item, _ := paths[e.path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[e.path] = item
+		}
+		item[e.method] = op
+	}
+	if metricsEnabled(prx) {
+		path := "/" + strings.TrimPrefix(prx.global.MetricPath, "/")
+		paths[path] = map[string]any{"get": map[string]any{
+			"summary":      "Prometheus metrics",
+			"x-proxy-auth": apiAuthNone,
+			"security":     []any{},
+			"responses":    map[string]any{"200": map[string]any{"description": "OK"}},
+		}}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": "ZabbixAPIproxy", "version": Version},
+		"paths":   paths,
+		"security": []any{
+			map[string]any{"bearer": []any{}},
+			map[string]any{"basic": []any{}},
+		},
+		"components": map[string]any{"securitySchemes": map[string]any{
+			"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			"basic":  map[string]any{"type": "http", "scheme": "basic"},
+		}},
+		"x-proxy-extensions": map[string]any{
+			"headers": enabledExtensions(prx, proxyExtensions),
+			"methods": enabledExtensions(prx, proxyMethods),
+		},
+	}
+}
+
+// enabledExtensions возвращает расширения, доступные при текущей конфигурации
+func enabledExtensions(prx *Proxy, extensions []apiExtension) []any {
+	list := []any{}
+	for _, ext := range extensions {
+		if ext.enabled == nil || ext.enabled(prx) {
+			list = append(list, map[string]any{"name": ext.name, "description": ext.description})
+		}
+	}
+	return list
+}
+
+// ProxyAPIHandler обрабатывает GET /.well-known/proxy-api. При hide_info - 404
+func (prx *Proxy) ProxyAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if prx.global.HideInfo {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prx.APIDescription())
+}
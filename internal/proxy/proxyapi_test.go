@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProxyAPIHandler тестирует описание эндпоинтов proxy по текущей конфигурации
+func TestProxyAPIHandler(t *testing.T) {
+	g := Global{MaxRequests: 5, MetricPath: "metrics", Token: "secret", AdminUI: true,
+		CoordinatedWrites: CoordinatedWritesConf{Enabled: true, AllowCreate: true}}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	w := httptest.NewRecorder()
+	prx.ProxyAPIHandler(w, httptest.NewRequest("GET", "/.well-known/proxy-api", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+	paths := doc["paths"].(map[string]any)
+	assert.Contains(t, paths, "/metrics")
+	assert.Contains(t, paths, "/admin/ui")
+	assert.NotContains(t, paths, "/admin/recorder", "flight recorder is disabled")
+	assert.NotContains(t, paths, "/admin/ha", "HA is disabled")
+
+	// Открытые эндпоинты отмечены пустым security, API требует авторизации
+	assert.Equal(t, []any{}, paths["/health"].(map[string]any)["get"].(map[string]any)["security"])
+	assert.NotContains(t, paths["/"].(map[string]any)["post"], "security")
+
+	ext := doc["x-proxy-extensions"].(map[string]any)
+	assert.Contains(t, ext["methods"], map[string]any{"name": maintenanceCreateAll, "description": "Create a maintenance window on all servers"})
+	names := []string{}
+	for _, h := range ext["headers"].([]any) {
+		names = append(names, h.(map[string]any)["name"].(string))
+	}
+	assert.Contains(t, names, writeModeHeader)
+	assert.NotContains(t, names, pageSizeHeader, "pagination is disabled")
+
+	prx.global.HideInfo = true
+	w = httptest.NewRecorder()
+	prx.ProxyAPIHandler(w, httptest.NewRequest("GET", "/.well-known/proxy-api", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// для хранения отчета об ограничении результатов серверов
+const serverQuotaKey ctxKey = "server_quota"
+
+// ServerQuotaConf ограничение доли одного сервера в объединенном результате, что бы
+// сервер с намного большим числом сущностей не вытеснял остальные и не перегружал UI
+type ServerQuotaConf struct {
+	MaxItems   int      `yaml:"max_items"`  // Максимум элементов списка от одного сервера, 0 - без ограничения
+	Interleave bool     `yaml:"interleave"` // Чередование элементов серверов вместо объединения по серверам
+	Methods    []string `yaml:"methods"`    // Методы, к которым применяется квота, пусто - все методы
+}
+
+// applies сообщает, что квота настроена и применяется к методу
+func (q ServerQuotaConf) applies(method string) bool {
+	if q.MaxItems <= 0 && !q.Interleave {
+		return false
+	}
+	return len(q.Methods) == 0 || slices.Contains(q.Methods, method)
+}
+
+// quotaReport отброшенные квотой элементы по серверам запроса
+type quotaReport struct {
+	mu       sync.Mutex
+	maxItems int
+	dropped  map[int]int // ID сервера и число отброшенных элементов
+}
+
+// withServerQuota сохраняет в контексте отчет квоты, если квота применяется к методу
+func (prx *Proxy) withServerQuota(ctx context.Context, method string) (context.Context, *quotaReport) {
+	if !prx.global.ServerQuota.applies(method) {
+		return ctx, nil
+	}
+	report := &quotaReport{maxItems: prx.global.ServerQuota.MaxItems, dropped: make(map[int]int)}
+	return context.WithValue(ctx, serverQuotaKey, report), report
+}
+
+// quotaFromContext возвращает отчет квоты запроса (nil, если квота не применяется)
+func quotaFromContext(ctx context.Context) *quotaReport {
+	report, _ := ctx.Value(serverQuotaKey).(*quotaReport)
+	return report
+}
+
+// limit отбрасывает элементы списка сверх квоты сервера
+func (q *quotaReport) limit(serverID int, result any) any {
+	list, ok := result.([]any)
+	if q == nil || q.maxItems <= 0 || !ok || len(list) <= q.maxItems {
+		return result
+	}
+	q.mu.Lock()
+	q.dropped[serverID] += len(list) - q.maxItems
+	q.mu.Unlock()
+	return list[:q.maxItems]
+}
+
+// interleave сообщает, что элементы серверов объединяются поочередно
+func (q *quotaReport) interleave(prx *Proxy) bool {
+	return q != nil && prx.global.ServerQuota.Interleave
+}
+
+// truncated сообщает, что квота отбросила часть элементов
+func (q *quotaReport) truncated() bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.dropped) > 0
+}
+
+// meta возвращает сведения об усечении для meta.server_quota ответа
+func (q *quotaReport) meta() map[string]any {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dropped := make(map[string]any, len(q.dropped))
+	for id, n := range q.dropped {
+		dropped[strconv.Itoa(id)] = n
+	}
+	return map[string]any{"truncated": true, "max_items": q.maxItems, "dropped": dropped}
+}
+
+// interleaveLists объединяет списки серверов поочередно: первые элементы всех серверов,
+// затем вторые и т.д., так что начало результата содержит элементы каждого сервера
+func interleaveLists(lists [][]any) []any {
+	total, longest := 0, 0
+	for _, list := range lists {
+		total += len(list)
+		longest = max(longest, len(list))
+	}
+	merged := make([]any, 0, total)
+	for i := range longest {
+		for _, list := range lists {
+			if i < len(list) {
+				merged = append(merged, list[i])
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServerQuotaConf_Applies тестирует выбор методов, к которым применяется квота
+func TestServerQuotaConf_Applies(t *testing.T) {
+	assert.False(t, ServerQuotaConf{}.applies("host.get"))
+	assert.True(t, ServerQuotaConf{MaxItems: 10}.applies("host.get"))
+	assert.True(t, ServerQuotaConf{Interleave: true}.applies("host.get"))
+
+	q := ServerQuotaConf{MaxItems: 10, Methods: []string{"host.get"}}
+	assert.True(t, q.applies("host.get"))
+	assert.False(t, q.applies("item.get"))
+}
+
+// TestInterleaveLists тестирует поочередное объединение списков серверов
+func TestInterleaveLists(t *testing.T) {
+	merged := interleaveLists([][]any{{"a1", "a2", "a3"}, {"b1"}, {"c1", "c2"}})
+	assert.Equal(t, []any{"a1", "b1", "c1", "a2", "c2", "a3"}, merged)
+	assert.Empty(t, interleaveLists(nil))
+}
+
+// TestProcessAllServers_ServerQuota тестирует ограничение и чередование элементов серверов
+func TestProcessAllServers_ServerQuota(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	mockClient := testProxy.GetMockClient()
+	mockClient.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		result := []any{map[string]any{"hostid": "1", "server": "small"}}
+		if url == "http://zbx1" {
+			result = []any{
+				map[string]any{"hostid": "1", "server": "big"},
+				map[string]any{"hostid": "2", "server": "big"},
+				map[string]any{"hostid": "3", "server": "big"},
+			}
+		}
+		return map[string]any{"result": result}, nil
+	}
+
+	z := ZabbixConf{
+		Servers: []zabbix.ZabbixServer{
+			{URL: "http://zbx1", ID: 1, Token: "token1"},
+			{URL: "http://zbx2", ID: 2, Token: "token2"},
+		},
+	}
+	g := Global{MaxRequests: 5, ServerQuota: ServerQuotaConf{MaxItems: 2, Interleave: true, Methods: []string{"host.get"}}}
+	prx := testProxy.Init(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx, quota := prx.withServerQuota(ctx, "host.get")
+	require.NotNil(t, quota)
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+	results, errors := testProxy.processAllServersWithMock(ctx, request, "test-quota")
+	require.Empty(t, errors)
+
+	list := results.([]any)
+	require.Len(t, list, 3, "big server is capped at max_items")
+	servers := make([]string, len(list))
+	for i, item := range list {
+		servers[i] = item.(map[string]any)["server"].(string)
+	}
+	assert.Equal(t, []string{"big", "small", "big"}, servers, "servers are interleaved")
+
+	require.True(t, quota.truncated())
+	meta := quota.meta()
+	assert.Equal(t, 2, meta["max_items"])
+	assert.Equal(t, map[string]any{"1": 1}, meta["dropped"])
+
+	// Метод вне списка квоты не ограничивается
+	_, other := prx.withServerQuota(context.Background(), "item.get")
+	assert.Nil(t, other)
+	assert.False(t, other.truncated())
+}
+
+// TestProcessAllServers_ServerQuotaSingleServer тестирует квоту при запросе к единственному серверу
+func TestProcessAllServers_ServerQuotaSingleServer(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	mockClient := testProxy.GetMockClient()
+	mockClient.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		return map[string]any{"result": []any{
+			map[string]any{"hostid": "1"},
+			map[string]any{"hostid": "2"},
+			map[string]any{"hostid": "3"},
+		}}, nil
+	}
+
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://zbx1", ID: 1, Token: "token1"}}}
+	g := Global{MaxRequests: 5, ServerQuota: ServerQuotaConf{MaxItems: 2}}
+	prx := testProxy.Init(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx, quota := prx.withServerQuota(ctx, "host.get")
+	require.NotNil(t, quota)
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+	results, errors := testProxy.processAllServersWithMock(ctx, request, "test-quota-single")
+	require.Empty(t, errors)
+
+	assert.Len(t, results, 2)
+	require.True(t, quota.truncated())
+	assert.Equal(t, map[string]any{"1": 1}, quota.meta()["dropped"])
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/a3ak/suffix"
+)
+
+// Максимальное ожидание токена по умолчанию
+const defaultRateMaxDelay = time.Second
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+// tokenBucket ограничивает частоту запросов к серверу. Запросы сверх
+// доступных токенов ждут в очереди не дольше maxDelay, остальные отклоняются
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64 // Токенов в секунду
+	burst    float64
+	tokens   float64 // Отрицательное значение - токены, обещанные ожидающим
+	last     time.Time
+	maxDelay time.Duration
+	now      func() time.Time
+}
+
+// newTokenBucket создает ограничитель для сервера или nil, если rate_limit не задан
+func newTokenBucket(srv zabbix.ZabbixServer) *tokenBucket {
+	if srv.RateLimit <= 0 {
+		return nil
+	}
+
+	burst := float64(srv.RateBurst)
+	if burst <= 0 {
+		burst = max(1, srv.RateLimit)
+	}
+
+	maxDelay := defaultRateMaxDelay
+	if srv.RateMaxDelay != "" {
+		if d, err := suffix.ToSeconds(srv.RateMaxDelay); err != nil {
+			logger.Global.Errorf("Server[%d]: convert error 'rate_max_delay' to seconds: %v", srv.ID, err)
+		} else {
+			maxDelay = time.Duration(d) * time.Second
+		}
+	}
+
+	return &tokenBucket{
+		rate:     srv.RateLimit,
+		burst:    burst,
+		tokens:   burst,
+		last:     time.Now(),
+		maxDelay: maxDelay,
+		now:      time.Now,
+	}
+}
+
+// reserve забирает токен и возвращает время ожидания до его появления.
+// Возвращает false без изменения состояния, если ожидание больше maxDelay
+func (b *tokenBucket) reserve() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > b.maxDelay {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// cancel возвращает токен запроса, не дождавшегося своей очереди
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens = min(b.burst, b.tokens+1)
+	b.mu.Unlock()
+}
+
+// wait ожидает токен для запроса к серверу. Возвращает время ожидания
+// и errRateLimited, если очередь длиннее maxDelay
+func (b *tokenBucket) wait(ctx context.Context) (time.Duration, error) {
+	if b == nil {
+		return 0, nil
+	}
+
+	delay, ok := b.reserve()
+	if !ok {
+		return delay, errRateLimited
+	}
+	if delay == 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		b.cancel()
+		return delay, ctx.Err()
+	}
+}
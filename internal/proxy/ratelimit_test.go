@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTokenBucket_Reserve тестирует выдачу токенов и очередь ограничителя
+func TestTokenBucket_Reserve(t *testing.T) {
+	assert.Nil(t, newTokenBucket(zabbix.ZabbixServer{ID: 1}))
+
+	tb := newTokenBucket(zabbix.ZabbixServer{ID: 1, RateLimit: 10, RateBurst: 2, RateMaxDelay: "1s"})
+	require.NotNil(t, tb)
+	now := time.Now()
+	tb.now = func() time.Time { return now }
+	tb.last = now
+
+	// Корзина позволяет всплеск без ожидания
+	for i := 0; i < 2; i++ {
+		delay, ok := tb.reserve()
+		assert.True(t, ok)
+		assert.Zero(t, delay)
+	}
+
+	// Дальше запросы встают в очередь с шагом 1/rate
+	for i := 1; i <= 10; i++ {
+		delay, ok := tb.reserve()
+		require.True(t, ok)
+		assert.Equal(t, time.Duration(i)*100*time.Millisecond, delay)
+	}
+
+	// Очередь длиннее rate_max_delay отклоняется без изменения состояния
+	_, ok := tb.reserve()
+	assert.False(t, ok)
+	assert.InDelta(t, -10, tb.tokens, 1e-9)
+
+	// Токены восполняются со временем
+	now = now.Add(2 * time.Second)
+	delay, ok := tb.reserve()
+	assert.True(t, ok)
+	assert.Zero(t, delay)
+}
+
+// TestTokenBucket_Wait тестирует ожидание токена и отмену ожидания
+func TestTokenBucket_Wait(t *testing.T) {
+	var none *tokenBucket
+	delay, err := none.wait(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, delay)
+
+	tb := newTokenBucket(zabbix.ZabbixServer{ID: 1, RateLimit: 20, RateBurst: 1})
+	_, err = tb.wait(context.Background())
+	require.NoError(t, err)
+
+	start := time.Now()
+	delay, err = tb.wait(context.Background())
+	require.NoError(t, err)
+	assert.Greater(t, delay, time.Duration(0))
+	assert.GreaterOrEqual(t, time.Since(start), delay)
+
+	// Токен отмененного ожидания возвращается в корзину
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = tb.wait(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Greater(t, tb.tokens, -1.0)
+}
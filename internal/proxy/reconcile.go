@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"context"
+	"strconv"
+	"time"
+)
+
+// reconcileReport результат сверки кеша с одним сервером
+type reconcileReport struct {
+	Checked int
+	Renamed int
+	Deleted int
+	Errors  int
+}
+
+// startReconcile запускает периодическую сверку маппингов кеша с серверами
+func (prx *Proxy) startReconcile(interval time.Duration) context.CancelFunc {
+	if interval == 0 {
+		logger.Global.Infoln("Reconcile interval is not set. The running of the process will not be done.")
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	prx.background.start(func(bg context.Context) {
+		defer context.AfterFunc(bg, cancel)()
+		logger.Global.Info("Reconcile worker started")
+		defer logger.Global.Info("Reconcile worker stopped")
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				prx.reconcileAllServers(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	return cancel
+}
+
+// reconcileAllServers сверяет кеш со всеми серверами, у которых замкнут Circuit Breaker.
+// Состояние только проверяется: фоновая сверка не переводит Circuit Breaker в half-open
+// и не занимает пробные запросы, результат которых ему не сообщается
+func (prx *Proxy) reconcileAllServers(ctx context.Context) {
+	for _, srv := range prx.config.Servers {
+		if state := prx.cb.GetCircuitBreakerState(srv.Name); state != "closed" && state != "disabled" {
+			logger.Global.Debugf("Reconcile: circuit breaker is %s for %s, skipping", state, srv.URL)
+			continue
+		}
+
+		report := prx.reconcileServer(ctx, srv)
+		logger.Global.Infof("Reconcile server[%d] %s: checked=%d renamed=%d deleted=%d errors=%d",
+			srv.ID, srv.URL, report.Checked, report.Renamed, report.Deleted, report.Errors)
+
+		if prx.metrics != nil {
+			prx.metrics.AddReconciled(srv.URL, "checked", report.Checked)
+			prx.metrics.AddReconciled(srv.URL, "renamed", report.Renamed)
+			prx.metrics.AddReconciled(srv.URL, "deleted", report.Deleted)
+			prx.metrics.AddReconciled(srv.URL, "error", report.Errors)
+		}
+	}
+}
+
+// reconcileServer запрашивает с сервера имена и ID кешируемых сущностей и исправляет кеш:
+// удаляет маппинги удаленных сущностей и перегенерирует ProxyID для переименованных
+func (prx *Proxy) reconcileServer(ctx context.Context, srv zabbix.ZabbixServer) reconcileReport {
+	var report reconcileReport
+	if prx.cache == nil {
+		return report
+	}
+
+	for cacheType, method := range entityGetMethods {
+		cache, ok := prx.cache.CacheType[cacheType]
+		if !ok {
+			continue
+		}
+		mappings := cache.GetServerMappings(srv.ID)
+		if len(mappings) == 0 {
+			continue
+		}
+
+		nameField := prx.cachedFields[cacheType]
+		reqCtx, cancel := context.WithTimeout(ctx, time.Duration(prx.global.maxTimeoutInt64)*time.Second)
+		response, err := prx.zbxClient.SendToZabbix(reqCtx, srv.URL, srv.IgnoreSSL, map[string]any{
+			"jsonrpc": "2.0",
+			"method":  method,
+			"params":  map[string]any{"output": []string{cacheType + "id", nameField}},
+			"auth":    srv.Token,
+			"id":      1,
+		})
+		cancel()
+		if err != nil {
+			logger.Global.Warningf("Reconcile server[%d]: %s failed: %v", srv.ID, method, err)
+			report.Errors++
+			continue
+		}
+
+		// Актуальные имена сущностей на сервере: OriginalID -> имя
+		upstream := make(map[int]string)
+		items, _ := response["result"].([]any)
+		for _, item := range items {
+			if m, ok := item.(map[string]any); ok {
+				if id, ok := toIntID(m[cacheType+"id"]); ok {
+					name, _ := m[nameField].(string)
+					upstream[id] = prx.names.display(cacheType, name, srv.ID)
+				}
+			}
+		}
+
+		for proxyID, originalID := range mappings {
+			report.Checked++
+			name, exists := upstream[originalID]
+			if !exists {
+				// Сущность удалена на сервере
+				cache.DeleteServerMapping(proxyID, srv.ID)
+				report.Deleted++
+				logger.Global.Debugf("Reconcile server[%d]: %s %d deleted upstream, ProxyID %d evicted", srv.ID, cacheType, originalID, proxyID)
+				continue
+			}
+
+			if cachedName, _ := cache.GetEntityName(proxyID); cachedName != name {
+				// Сущность переименована - ProxyID строится от имени, поэтому генерируем заново
+				cache.DeleteServerMapping(proxyID, srv.ID)
+				data := map[string]any{cacheType + "id": strconv.Itoa(originalID), nameField: name}
+				if _, err := prx.generateProxyID(cacheType, data, srv.ID); err != nil {
+					logger.Global.Warningf("Reconcile server[%d]: regenerate ProxyID for %s '%s' failed: %v", srv.ID, cacheType, name, err)
+					report.Errors++
+					continue
+				}
+				report.Renamed++
+				logger.Global.Debugf("Reconcile server[%d]: %s %d renamed '%s' -> '%s'", srv.ID, cacheType, originalID, cachedName, name)
+			}
+		}
+	}
+	return report
+}
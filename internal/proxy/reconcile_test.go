@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/a3ak/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReconcileServer тестирует сверку маппингов кеша с сервером
+func TestReconcileServer(t *testing.T) {
+	g := Global{MaxRequests: 10}
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{ID: 1, URL: "http://server1"}}}
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	originalClient := prx.zbxClient
+	prx.zbxClient = &MockZabbixClient{
+		SendFunc: func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+			assert.Equal(t, "host.get", request["method"])
+			return map[string]any{"result": []any{
+				map[string]any{"hostid": "10084", "name": "HostA-renamed"},
+				map[string]any{"hostid": "10086", "name": "HostC"},
+			}}, nil
+		},
+	}
+	defer func() { prx.zbxClient = originalClient }()
+
+	hosts := prx.cache.CacheType["host"]
+	hosts.Set(100, 10084, 1, "HostA")
+	hosts.Set(200, 10085, 1, "HostB")
+	hosts.Set(300, 10086, 1, "HostC")
+
+	report := prx.reconcileServer(context.Background(), z.Servers[0])
+
+	assert.Equal(t, reconcileReport{Checked: 3, Renamed: 1, Deleted: 1}, report)
+
+	// Удаленная сущность исчезла из кеша
+	_, found := hosts.GetOriginalID(200, 1)
+	assert.False(t, found)
+
+	// Неизмененная сущность осталась
+	originalID, found := hosts.GetOriginalID(300, 1)
+	assert.True(t, found)
+	assert.Equal(t, 10086, originalID)
+
+	// Переименованная сущность получила новый ProxyID от нового имени
+	_, found = hosts.GetOriginalID(100, 1)
+	assert.False(t, found)
+	newProxyID, found := hosts.GetProxyID(10084, 1)
+	assert.True(t, found)
+	name, _ := hosts.GetEntityName(newProxyID)
+	assert.Equal(t, "HostA-renamed", name)
+}
+
+// TestReconcileAllServersCircuitBreaker тестирует, что сверка пропускает серверы
+// с незамкнутым Circuit Breaker и не меняет его состояние
+func TestReconcileAllServersCircuitBreaker(t *testing.T) {
+	g := Global{MaxRequests: 10}
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{
+		{ID: 1, URL: "http://server1", Name: "server1"},
+		{ID: 2, URL: "http://server2", Name: "server2"},
+	}}
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	prx.cb.InitCircuitBreakers([]string{"server1", "server2"}, circuitbreaker.CircuitBreakerConf{
+		FailureThreshold: 1,
+		RecoveryTimeout:  time.Nanosecond,
+		HalfOpenPrc:      100,
+	})
+	prx.cb.ReportFailure("server1")
+	time.Sleep(time.Millisecond)
+
+	var urls []string
+	originalClient := prx.zbxClient
+	prx.zbxClient = &MockZabbixClient{
+		SendFunc: func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+			urls = append(urls, url)
+			return map[string]any{"result": []any{}}, nil
+		},
+	}
+	defer func() { prx.zbxClient = originalClient }()
+
+	hosts := prx.cache.CacheType["host"]
+	hosts.Set(100, 10084, 1, "HostA")
+	hosts.Set(200, 10085, 2, "HostB")
+
+	prx.reconcileAllServers(context.Background())
+
+	// Сверка выполнена только для сервера с замкнутым Circuit Breaker,
+	// разомкнутый Circuit Breaker не переведен в half-open
+	assert.Equal(t, []string{"http://server2"}, urls)
+	assert.Equal(t, "open", prx.cb.GetCircuitBreakerState("server1"))
+	assert.Equal(t, "closed", prx.cb.GetCircuitBreakerState("server2"))
+}
@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// для хранения записи бортового самописца
+const recordKey ctxKey = "flight_record"
+
+// FlightRecorderConf настройки бортового самописца: полный захват запросов для
+// воспроизведения ошибок преобразования ID
+type FlightRecorderConf struct {
+	// Количество последних захваченных запросов в кольцевом буфере
+	Size int `yaml:"size"`
+	// Доля захватываемых запросов от 0 до 1
+	SampleRatio float64 `yaml:"sample_ratio"`
+	// Токены клиентов (Bearer или поле auth JSON-RPC), запросы которых захватываются всегда
+	Tokens []string `yaml:"tokens"`
+}
+
+// flightRecord полный захват одного запроса клиента
+type flightRecord struct {
+	mu sync.Mutex
+	// После завершения запись не изменяется и читается без блокировки
+	finished bool
+
+	TraceID    string          `json:"trace_id"`
+	Time       time.Time       `json:"time"`
+	Method     string          `json:"method"`
+	Request    any             `json:"request"`
+	Servers    []serverCapture `json:"servers"`
+	Response   any             `json:"response"`
+	Errors     []string        `json:"errors,omitempty"`
+	DurationMs float64         `json:"duration_ms"`
+}
+
+// serverCapture запрос к серверу и его ответ до преобразования ID
+type serverCapture struct {
+	ServerID int    `json:"server_id"`
+	URL      string `json:"url"`
+	Request  any    `json:"request"`
+	Response any    `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// flightRecorder кольцевой буфер последних захваченных запросов
+type flightRecorder struct {
+	mu      sync.Mutex
+	records []*flightRecord
+	next    int
+	full    bool
+
+	ratio  float64
+	tokens []string
+}
+
+// newFlightRecorder создает самописец. Возвращает nil, если захват не настроен
+func newFlightRecorder(conf FlightRecorderConf) *flightRecorder {
+	if conf.Size <= 0 || (conf.SampleRatio <= 0 && len(conf.Tokens) == 0) {
+		return nil
+	}
+	return &flightRecorder{
+		records: make([]*flightRecord, conf.Size),
+		ratio:   conf.SampleRatio,
+		tokens:  conf.Tokens,
+	}
+}
+
+// sampled решает, захватывать ли запрос
+func (fr *flightRecorder) sampled(r *http.Request, request map[string]any) bool {
+	if len(fr.tokens) > 0 {
+		if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" && slices.Contains(fr.tokens, token) {
+			return true
+		}
+		if auth, ok := request["auth"].(string); ok && slices.Contains(fr.tokens, auth) {
+			return true
+		}
+	}
+	return fr.ratio > 0 && rand.Float64() < fr.ratio
+}
+
+// start начинает захват запроса, если он попал в выборку
+func (fr *flightRecorder) start(ctx context.Context, r *http.Request, trace_id, method string, request map[string]any) (context.Context, *flightRecord) {
+	if fr == nil || !fr.sampled(r, request) {
+		return ctx, nil
+	}
+	rec := &flightRecord{
+		TraceID: trace_id,
+		Time:    time.Now(),
+		Method:  method,
+		Request: redactAuth(deepClone(request)),
+	}
+	return context.WithValue(ctx, recordKey, rec), rec
+}
+
+// add помещает завершенную запись в буфер, вытесняя самую старую
+func (fr *flightRecorder) add(rec *flightRecord) {
+	if fr == nil || rec == nil {
+		return
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.records[fr.next] = rec
+	fr.next = (fr.next + 1) % len(fr.records)
+	if fr.next == 0 {
+		fr.full = true
+	}
+}
+
+// list возвращает записи от новых к старым, при непустом trace_id - только его запись
+func (fr *flightRecorder) list(trace_id string) []*flightRecord {
+	if fr == nil {
+		return nil
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	count := fr.next
+	if fr.full {
+		count = len(fr.records)
+	}
+
+	records := make([]*flightRecord, 0, count)
+	for i := 1; i <= count; i++ {
+		rec := fr.records[(fr.next-i+len(fr.records))%len(fr.records)]
+		if trace_id == "" || rec.TraceID == trace_id {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+// recordFromContext возвращает запись захватываемого запроса или nil
+func recordFromContext(ctx context.Context) *flightRecord {
+	rec, _ := ctx.Value(recordKey).(*flightRecord)
+	return rec
+}
+
+// server сохраняет запрос к серверу и ответ до преобразования ID.
+// Данные клонируются, т.к. запрос возвращается в пул, а ответ изменяется при обработке
+func (rec *flightRecord) server(serverID int, url string, request map[string]any, response map[string]any, err error) {
+	if rec == nil {
+		return
+	}
+	capture := serverCapture{
+		ServerID: serverID,
+		URL:      url,
+		Request:  redactAuth(deepClone(request)),
+	}
+	if response != nil {
+		capture.Response = deepClone(response)
+	}
+	if err != nil {
+		capture.Error = logger.Redact(err.Error())
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	// Ответ сервера пришел после таймаута запроса клиента
+	if rec.finished {
+		return
+	}
+	rec.Servers = append(rec.Servers, capture)
+}
+
+// finish сохраняет ответ клиенту и длительность обработки
+func (rec *flightRecord) finish(response any, errors []string) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.Response = deepClone(response)
+	rec.Errors = errors
+	rec.DurationMs = durationMs(time.Since(rec.Time))
+	rec.finished = true
+	slices.SortFunc(rec.Servers, func(a, b serverCapture) int { return a.ServerID - b.ServerID })
+}
+
+// redactAuth скрывает токен в клонированном запросе
+func redactAuth(request any) any {
+	if m, ok := request.(map[string]any); ok {
+		if _, exists := m["auth"]; exists {
+			m["auth"] = "***"
+		}
+	}
+	return request
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewFlightRecorder тестирует включение самописца по конфигурации
+func TestNewFlightRecorder(t *testing.T) {
+	assert.Nil(t, newFlightRecorder(FlightRecorderConf{}))
+	assert.Nil(t, newFlightRecorder(FlightRecorderConf{Size: 10}))
+	assert.Nil(t, newFlightRecorder(FlightRecorderConf{SampleRatio: 1}))
+	assert.NotNil(t, newFlightRecorder(FlightRecorderConf{Size: 10, SampleRatio: 0.5}))
+	assert.NotNil(t, newFlightRecorder(FlightRecorderConf{Size: 10, Tokens: []string{"t"}}))
+
+	// Методы безопасны для nil
+	var fr *flightRecorder
+	ctx, rec := fr.start(context.Background(), httptest.NewRequest("POST", "/", nil), "id", "host.get", map[string]any{})
+	assert.Nil(t, rec)
+	assert.Nil(t, recordFromContext(ctx))
+	fr.add(rec)
+	assert.Empty(t, fr.list(""))
+}
+
+// TestFlightRecorder_Sampling тестирует захват по токену клиента
+func TestFlightRecorder_Sampling(t *testing.T) {
+	fr := newFlightRecorder(FlightRecorderConf{Size: 10, Tokens: []string{"debug-token"}})
+
+	r := httptest.NewRequest("POST", "/", nil)
+	_, rec := fr.start(context.Background(), r, "1", "host.get", map[string]any{"auth": "other"})
+	assert.Nil(t, rec, "request with unknown token should not be sampled")
+
+	_, rec = fr.start(context.Background(), r, "2", "host.get", map[string]any{"auth": "debug-token"})
+	require.NotNil(t, rec, "request with JSON-RPC auth token should be sampled")
+	assert.Equal(t, "***", rec.Request.(map[string]any)["auth"])
+
+	r.Header.Set("Authorization", "Bearer debug-token")
+	_, rec = fr.start(context.Background(), r, "3", "host.get", map[string]any{})
+	assert.NotNil(t, rec, "request with Bearer token should be sampled")
+}
+
+// TestFlightRecorder_RingBuffer тестирует вытеснение старых записей и порядок выдачи
+func TestFlightRecorder_RingBuffer(t *testing.T) {
+	fr := newFlightRecorder(FlightRecorderConf{Size: 3, SampleRatio: 1})
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		_, rec := fr.start(context.Background(), httptest.NewRequest("POST", "/", nil), id, "host.get", map[string]any{})
+		rec.finish(map[string]any{"result": []any{}}, nil)
+		fr.add(rec)
+	}
+
+	records := fr.list("")
+	require.Len(t, records, 3)
+	assert.Equal(t, "d", records[0].TraceID)
+	assert.Equal(t, "c", records[1].TraceID)
+	assert.Equal(t, "b", records[2].TraceID)
+
+	assert.Len(t, fr.list("c"), 1)
+	assert.Empty(t, fr.list("a"))
+}
+
+// TestFlightRecord_Server тестирует захват запросов к серверам
+func TestFlightRecord_Server(t *testing.T) {
+	fr := newFlightRecorder(FlightRecorderConf{Size: 3, SampleRatio: 1})
+	_, rec := fr.start(context.Background(), httptest.NewRequest("POST", "/", nil), "trace", "host.get", map[string]any{})
+
+	serverRequest := map[string]any{"method": "host.get", "auth": "server-token"}
+	response := map[string]any{"result": []any{map[string]any{"hostid": "10"}}}
+	rec.server(2, "http://zbx2", serverRequest, nil, errors.New("timeout"))
+	rec.server(1, "http://zbx1", serverRequest, response, nil)
+
+	// Изменение исходных данных не влияет на захват
+	serverRequest["method"] = "changed"
+	response["result"] = nil
+
+	rec.finish(map[string]any{"result": []any{}}, []string{"http://zbx2: timeout"})
+	// Ответ после завершения не сохраняется
+	rec.server(3, "http://zbx3", serverRequest, response, nil)
+
+	require.Len(t, rec.Servers, 2)
+	assert.Equal(t, 1, rec.Servers[0].ServerID)
+	assert.Equal(t, "***", rec.Servers[0].Request.(map[string]any)["auth"])
+	assert.Equal(t, "host.get", rec.Servers[0].Request.(map[string]any)["method"])
+	assert.NotNil(t, rec.Servers[0].Response.(map[string]any)["result"])
+	assert.Equal(t, "timeout", rec.Servers[1].Error)
+}
+
+// TestAdminRecorderHandler тестирует выдачу захваченных запросов
+func TestAdminRecorderHandler(t *testing.T) {
+	prx := &Proxy{}
+	w := httptest.NewRecorder()
+	prx.AdminRecorderHandler(w, httptest.NewRequest("POST", "/admin/recorder", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	prx.recorder = newFlightRecorder(FlightRecorderConf{Size: 3, SampleRatio: 1})
+	_, rec := prx.recorder.start(context.Background(), httptest.NewRequest("POST", "/", nil), "trace-1", "host.get", map[string]any{})
+	rec.finish(map[string]any{"result": []any{}}, nil)
+	prx.recorder.add(rec)
+
+	w = httptest.NewRecorder()
+	prx.AdminRecorderHandler(w, httptest.NewRequest("POST", "/admin/recorder?trace_id=trace-1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, float64(1), body["count"])
+}
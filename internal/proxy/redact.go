@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"path"
+	"strings"
+)
+
+// redactedValue значение, которым в логах заменяются скрытые поля
+const redactedValue = "[REDACTED]"
+
+// Поля, скрываемые в логах всегда: пароли пользователей (user.update, user.create)
+// и секреты. Шаблоны redact_fields дополняют этот список
+var defaultRedactFields = []string{"*passwd*", "*password*", "*secret*"}
+
+// macroTypeSecret тип секретного макроса Zabbix, значение которого не выводится
+const macroTypeSecret = 1
+
+// checkRedactFields проверяет шаблоны redact_fields, ошибочные пропускаются
+func checkRedactFields(patterns []string) []string {
+	valid := make([]string, 0, len(defaultRedactFields)+len(patterns))
+	valid = append(valid, defaultRedactFields...)
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if _, err := path.Match(p, ""); err != nil || p == "" {
+			logger.Global.Errorf("redact_fields: invalid pattern '%s', skipped", p)
+			continue
+		}
+		valid = append(valid, p)
+	}
+	return valid
+}
+
+// redactField проверяет, что поле должно быть скрыто (без учета регистра)
+func redactField(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// redact возвращает копию значения для вывода в лог со скрытыми полями
+// на любой вложенности. Исходное значение не изменяется
+func redact(v any, patterns []string) any {
+	switch val := v.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(val))
+		for k, item := range val {
+			if redactField(k, patterns) {
+				result[k] = redactedValue
+			} else {
+				result[k] = redact(item, patterns)
+			}
+		}
+		// Значение секретного макроса (usermacro.*)
+		if _, ok := val["macro"]; ok && isSecretMacro(val["type"]) {
+			if _, ok := val["value"]; ok {
+				result["value"] = redactedValue
+			}
+		}
+		return result
+	case []any:
+		result := make([]any, len(val))
+		for i, item := range val {
+			result[i] = redact(item, patterns)
+		}
+		return result
+	}
+	return v
+}
+
+// isSecretMacro проверяет тип макроса: в запросе число, в ответе Zabbix строка
+func isSecretMacro(t any) bool {
+	switch v := t.(type) {
+	case float64:
+		return int(v) == macroTypeSecret
+	case int:
+		return v == macroTypeSecret
+	case string:
+		return v == "1"
+	}
+	return false
+}
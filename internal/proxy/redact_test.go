@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCheckRedactFields тестирует проверку шаблонов redact_fields
+func TestCheckRedactFields(t *testing.T) {
+	patterns := checkRedactFields([]string{"Description", "[", "*_key"})
+	assert.Equal(t, append(append([]string{}, defaultRedactFields...), "description", "*_key"), patterns)
+}
+
+// TestRedact тестирует скрытие полей на любой вложенности
+func TestRedact(t *testing.T) {
+	patterns := checkRedactFields([]string{"psk*"})
+	request := map[string]any{
+		"method": "user.update",
+		"params": map[string]any{
+			"userid":         "1",
+			"passwd":         "new-password",
+			"current_passwd": "old-password",
+			"medias":         []any{map[string]any{"sendto": "admin@example.com"}},
+		},
+	}
+
+	redacted := redact(request, patterns).(map[string]any)
+	params := redacted["params"].(map[string]any)
+	assert.Equal(t, redactedValue, params["passwd"])
+	assert.Equal(t, redactedValue, params["current_passwd"])
+	assert.Equal(t, "1", params["userid"])
+	assert.Equal(t, "admin@example.com", params["medias"].([]any)[0].(map[string]any)["sendto"])
+
+	// Исходный запрос не изменяется
+	assert.Equal(t, "new-password", request["params"].(map[string]any)["passwd"])
+
+	// Вложенные поля из redact_fields и секретные макросы
+	hosts := []any{map[string]any{
+		"host":             "web-01",
+		"tls_psk_identity": "id",
+		"PSK":              "0123456789abcdef",
+		"macros": []any{
+			map[string]any{"macro": "{$DB_PASS}", "value": "s3cret", "type": 1.0},
+			map[string]any{"macro": "{$PORT}", "value": "5432", "type": "0"},
+			map[string]any{"macro": "{$API_KEY}", "value": "key", "type": "1"},
+		},
+	}}
+	host := redact(hosts, patterns).([]any)[0].(map[string]any)
+	assert.Equal(t, redactedValue, host["PSK"])
+	assert.Equal(t, "id", host["tls_psk_identity"])
+	macros := host["macros"].([]any)
+	assert.Equal(t, redactedValue, macros[0].(map[string]any)["value"])
+	assert.Equal(t, "5432", macros[1].(map[string]any)["value"])
+	assert.Equal(t, redactedValue, macros[2].(map[string]any)["value"])
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"reflect"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+)
+
+// Reload применяет новую конфигурацию, перезапуская только затронутые подсистемы:
+// клиент Zabbix с пулами соединений, Circuit Breaker с их состоянием, кеш и состояние
+// авторизации сохраняются, если их параметры не изменились. Вызывается под
+// блокировкой конфигурации. Фоновые задачи читают поля proxy без этой блокировки,
+// поэтому прерываются и завершаются до повторной инициализации. Возвращает
+// перезапущенные подсистемы
+func (prx *Proxy) Reload(g Global, cfg ZabbixConf, cbConf CBConf, cacheCfg CacheConf, exclude ExcludeMethods) []string {
+	prx.background.stop()
+	old := *prx
+	return prx.initProxy(g, cfg, cbConf, cacheCfg, exclude, &old)
+}
+
+// unchangedServer проверяет, что сервер задан в прежней конфигурации так же
+func (p *Proxy) unchangedServer(srv zabbix.ZabbixServer) bool {
+	if p == nil {
+		return false
+	}
+	for _, o := range p.configured.Servers {
+		if o.ID == srv.ID {
+			return reflect.DeepEqual(o, srv)
+		}
+	}
+	return false
+}
+
+// keepState переносит из прежнего proxy сборщик метрик и подсистемы с неизменными
+// параметрами: блокировки адресов, ключи издателя JWT и проверенные учетные данные, выпущенные токены API, захваченные
+// самописцем запросы, курсоры постраничной выдачи и списки переменных Grafana. Статистика запросов клиентов и время запуска
+// сохраняются всегда
+func (p *Proxy) keepState(old *Proxy) {
+	p.SetMetrics(old.metrics)
+	p.usage = old.usage
+	p.startedAt, p.reloadedAt = old.startedAt, time.Now()
+	if old.global.AuthLockout == p.global.AuthLockout {
+		p.authLock = old.authLock
+	}
+	if reflect.DeepEqual(old.global.JWT, p.global.JWT) {
+		p.jwt = old.jwt
+	}
+	if reflect.DeepEqual(old.global.LDAP, p.global.LDAP) {
+		p.ldap = old.ldap
+	}
+	if old.global.TokensFile == p.global.TokensFile {
+		p.tokens = old.tokens
+	}
+	if reflect.DeepEqual(old.global.FlightRecorder, p.global.FlightRecorder) {
+		p.recorder = old.recorder
+	}
+	if reflect.DeepEqual(old.global.Pagination, p.global.Pagination) {
+		p.pages = old.pages
+	}
+	if old.global.GrafanaVariables == p.global.GrafanaVariables {
+		p.variables = old.variables
+	}
+	// Повтор после перезагрузки конфигурации не должен выполнить запрос повторно
+	if old.global.Idempotency == p.global.Idempotency {
+		p.idempotency = old.idempotency
+	}
+}
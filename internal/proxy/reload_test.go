@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/a3ak/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReloadProxy тестирует перезапуск только измененных подсистем при перезагрузке конфигурации
+func TestReloadProxy(t *testing.T) {
+	g := Global{MaxRequests: 5}
+	cbConf := CBConf{FailureThreshold: 1, RecoveryTimeout: time.Minute}
+	prx := InitProxy(g, routingServers(), cbConf, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	require.NotNil(t, prx.cache)
+
+	// Сервер, добавленный discovery, и открытый Circuit Breaker
+	discovered := zabbix.ZabbixServer{ID: 4, URL: "http://server4.com", Name: "server4.com"}
+	prx.config.Servers = append(prx.config.Servers, discovered)
+	prx.cb.InitCircuitBreakers([]string{"server4.com"}, circuitbreaker.CircuitBreakerConf(cbConf))
+	prx.cb.ReportFailure("server1.com")
+	require.Equal(t, "open", prx.cb.GetCircuitBreakerState("server1.com"))
+
+	client, cb, cacheDB, authLock := prx.zbxClient, prx.cb, prx.cache, prx.authLock
+
+	t.Run("unchanged", func(t *testing.T) {
+		g.ReadOnly = true
+		restarted := prx.Reload(g, routingServers(), cbConf, CacheConf(initTestCache()), ExcludeMethods{})
+		assert.Empty(t, restarted)
+		assert.True(t, prx.global.ReadOnly)
+		assert.Same(t, client, prx.zbxClient)
+		assert.Same(t, cb, prx.cb)
+		assert.Same(t, cacheDB, prx.cache)
+		assert.Same(t, authLock, prx.authLock)
+		assert.Equal(t, "open", prx.cb.GetCircuitBreakerState("server1.com"))
+		assert.Contains(t, prx.config.Servers, discovered)
+	})
+
+	t.Run("circuit breaker and limits", func(t *testing.T) {
+		cfg := routingServers()
+		cfg.Limits.MaxRequestsByZBX = 10
+		cbConf.FailureThreshold = 3
+		restarted := prx.Reload(g, cfg, cbConf, CacheConf(initTestCache()), ExcludeMethods{})
+		assert.ElementsMatch(t, []string{"zabbix client", "circuit breakers"}, restarted)
+		assert.NotSame(t, client, prx.zbxClient)
+		assert.NotSame(t, cb, prx.cb)
+		assert.Same(t, cacheDB, prx.cache)
+		assert.Equal(t, "closed", prx.cb.GetCircuitBreakerState("server1.com"))
+		// Список серверов изменился - обнаруженные серверы заново получит discovery
+		assert.NotContains(t, prx.config.Servers, discovered)
+		assert.Equal(t, "disabled", prx.cb.GetCircuitBreakerState("server4.com"))
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		cfg := routingServers()
+		cfg.Limits.MaxRequestsByZBX = 10
+		cacheCfg := CacheConf(initTestCache())
+		cacheCfg.TTL = "2d"
+		restarted := prx.Reload(g, cfg, cbConf, cacheCfg, ExcludeMethods{})
+		assert.Equal(t, []string{"cache"}, restarted)
+		assert.NotSame(t, cacheDB, prx.cache)
+		assert.NotNil(t, prx.cache)
+	})
+
+	// Конфиг вызывающего не изменяется при инициализации
+	cfg := routingServers()
+	prx.Reload(g, cfg, cbConf, CacheConf(initTestCache()), ExcludeMethods{})
+	assert.Empty(t, cfg.Servers[0].Name)
+	assert.Equal(t, "server1.com", prx.config.Servers[0].Name)
+}
+
+// TestReloadStopsBackgroundTasks тестирует прерывание фоновых задач до повторной инициализации proxy
+func TestReloadStopsBackgroundTasks(t *testing.T) {
+	g := Global{MaxRequests: 5, MaxTimeout: "30s"}
+	cfg := ZabbixConf{Servers: []zabbix.ZabbixServer{{ID: 1, URL: "http://server1.com", MirrorTo: "http://staging.com"}}}
+	prx := InitProxy(g, cfg, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	started, finished := make(chan struct{}), make(chan struct{})
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		close(started)
+		<-ctx.Done()
+		close(finished)
+		return nil, ctx.Err()
+	}}
+
+	prx.mirrorRequest(prx.config.Servers[0], map[string]any{"method": "host.get"}, "test-reload")
+	<-started
+
+	prx.Reload(g, cfg, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	select {
+	case <-finished:
+	default:
+		t.Fatal("mirror request is still running after reload")
+	}
+}
+
+// TestProcessAllServersPinsSemaphore тестирует, что запрос освобождает слот в том
+// семафоре, где его занял, даже если семафор заменен во время запроса
+func TestProcessAllServersPinsSemaphore(t *testing.T) {
+	prx := InitProxy(Global{MaxRequests: 5}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	original := prx.requestSemaphore
+	var swap sync.Once
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		// Пока запрос выполняется, семафор заменяется (как при перезагрузке конфига)
+		swap.Do(func() {
+			replaced := make(chan struct{}, 5)
+			prx.requestSemaphore, prx.scheduler = replaced, newFairSemaphore(replaced)
+		})
+		return map[string]any{"jsonrpc": "2.0", "result": []any{}}, nil
+	}}
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+	_, errors := prx.processAllServers(context.Background(), request, "test-semaphore")
+	assert.Empty(t, errors)
+	assert.Equal(t, 0, len(original))
+	assert.Equal(t, 0, len(prx.requestSemaphore))
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"maps"
+
+	"ZabbixAPIproxy/internal/logger"
+)
+
+// rpcRequest запрос клиента, разобранный один раз для всех серверов.
+// Запрос клиента не изменяется: запросы к серверам собираются в upstreamRequest
+type rpcRequest struct {
+	// Экземпляр proxy, через кеш которого преобразуются ProxyID
+	prx    *Proxy
+	raw    map[string]any
+	method string
+	// Параметры запроса (nil, если params не объект)
+	params map[string]any
+	// Поля params с ID сущностей (hostids, itemids...), пусто - запрос не по ID
+	idFields []string
+}
+
+// newRPCRequest разбирает запрос клиента
+func (prx *Proxy) newRPCRequest(request map[string]any) *rpcRequest {
+	r := &rpcRequest{prx: prx, raw: request}
+	r.method, _ = request["method"].(string)
+	r.params, _ = request["params"].(map[string]any)
+	if ok, fields := isIDBasedRequest(request); ok {
+		r.idFields = fields
+	}
+	return r
+}
+
+// byIDs проверяет, что запрос адресован сущностям по ID
+func (r *rpcRequest) byIDs() bool {
+	return len(r.idFields) > 0
+}
+
+// upstreamRequest запрос к одному серверу
+type upstreamRequest struct {
+	prx      *Proxy
+	serverID int
+	// Параметры с оригинальными ID сервера. Вложенные значения, кроме полей ID,
+	// общие с запросом клиента и не изменяются
+	params map[string]any
+	// ProxyID, преобразованные через кеш, для проверки на устаревшие маппинги
+	resolved []resolvedID
+}
+
+// forServer подготавливает запрос к серверу serverID: ID заменяются оригинальными ID
+// сервера, чужие ID отбрасываются. Возвращает false, если в запросе по ID нет ID сервера
+// или все имена фильтра относятся к другим серверам
+func (r *rpcRequest) forServer(serverID int, trace_id string) (*upstreamRequest, bool) {
+	u := &upstreamRequest{prx: r.prx, serverID: serverID, params: r.params}
+	// Имена из объединенного результата (name_disambiguation) заменяются именами сервера
+	params, ok := r.prx.names.localize(r.method, r.params, serverID)
+	if !ok {
+		return nil, false
+	}
+	u.params = params
+	if !r.byIDs() || r.params == nil {
+		return u, true
+	}
+
+	u.params = maps.Clone(u.params)
+	for _, field := range r.idFields {
+		switch v := r.params[field].(type) {
+		case nil:
+		case []any:
+			var filtered []any
+			for _, id := range v {
+				if originalID, own := u.resolve(field, id, trace_id); own && originalID != nil {
+					filtered = append(filtered, originalID)
+				}
+			}
+			if len(filtered) == 0 {
+				return nil, false
+			}
+			u.params[field] = filtered
+		default:
+			originalID, own := u.resolve(field, v, trace_id)
+			if !own {
+				return nil, false
+			}
+			if originalID != nil {
+				u.params[field] = originalID
+			}
+		}
+	}
+	return u, true
+}
+
+// resolve преобразует ID запроса в оригинальный ID сервера. own - ID относится к серверу
+// (Grafana ID сервера или ProxyID), originalID - nil, если преобразовать не удалось
+func (u *upstreamRequest) resolve(field string, id any, trace_id string) (originalID any, own bool) {
+	switch sid := getServerFromID(id); sid {
+	case u.serverID:
+		return convertGrafanaIDToOriginal(id, u.serverID), true
+	case 0:
+		logger.Global.Tracef("[%s] Server[%d]: ID[%v] is ProxyID", trace_id, u.serverID, id)
+		if originalID = u.prx.convertProxyIDToOriginal(id, u.serverID, field); originalID != nil {
+			u.resolved = appendResolvedID(u.resolved, field, id, originalID)
+		} else {
+			u.prx.negativeIDs.add(field, id, u.serverID)
+		}
+		return originalID, true
+	default:
+		return nil, false
+	}
+}
+
+// message формирует тело запроса к серверу с токеном token
+func (r *rpcRequest) message(u *upstreamRequest, token string) map[string]any {
+	m := maps.Clone(r.raw)
+	if u.params != nil {
+		m["params"] = u.params
+	}
+	m["auth"] = token
+	return m
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRPCRequest_ForServer тестирует подготовку запросов к серверам из запроса клиента
+func TestRPCRequest_ForServer(t *testing.T) {
+	prx := InitProxy(Global{MaxRequests: 5, NegativeIDTTL: "1m"}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.cache.CacheType["host"].Set(123450, 100, 1, "test-host")
+
+	filter := map[string]any{"status": "0"}
+	request := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "item.get",
+		"id":      7,
+		"params":  map[string]any{"hostids": []any{"123450", "50001", "60002"}, "filter": filter},
+	}
+	req := prx.newRPCRequest(request)
+	require.True(t, req.byIDs())
+	assert.Equal(t, "item.get", req.method)
+
+	t.Run("proxy and grafana ids", func(t *testing.T) {
+		u, ok := req.forServer(1, "test")
+		require.True(t, ok)
+		assert.Equal(t, []any{"100", 5000}, u.params["hostids"])
+		assert.Equal(t, []resolvedID{{cacheType: "host", proxyID: 123450, originalID: 100}}, u.resolved)
+
+		message := req.message(u, "token1")
+		assert.Equal(t, "token1", message["auth"])
+		assert.Equal(t, 7, message["id"])
+		assert.Equal(t, filter, message["params"].(map[string]any)["filter"])
+	})
+
+	t.Run("unknown proxy id", func(t *testing.T) {
+		u, ok := req.forServer(2, "test")
+		require.True(t, ok)
+		assert.Equal(t, []any{6000}, u.params["hostids"])
+		assert.Empty(t, u.resolved)
+		// ProxyID, не найденный в кеше сервера, запоминается
+		assert.True(t, prx.knownIDsMissing(map[string]any{"params": map[string]any{"hostids": []any{"123450"}}}, []string{"hostids"}, 2))
+	})
+
+	t.Run("no ids of server", func(t *testing.T) {
+		request := map[string]any{"method": "item.get", "params": map[string]any{"hostids": []any{"50001"}}}
+		_, ok := prx.newRPCRequest(request).forServer(3, "test")
+		assert.False(t, ok)
+	})
+
+	t.Run("not by ids", func(t *testing.T) {
+		request := map[string]any{"method": "apiinfo.version", "params": []any{}}
+		req := prx.newRPCRequest(request)
+		assert.False(t, req.byIDs())
+		u, ok := req.forServer(3, "test")
+		require.True(t, ok)
+		message := req.message(u, "token3")
+		assert.Equal(t, []any{}, message["params"])
+		assert.Equal(t, "token3", message["auth"])
+	})
+
+	// Запрос клиента не изменяется
+	assert.Equal(t, map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "item.get",
+		"id":      7,
+		"params":  map[string]any{"hostids": []any{"123450", "50001", "60002"}, "filter": map[string]any{"status": "0"}},
+	}, request)
+}
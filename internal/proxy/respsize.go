@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// errRespTooLarge ошибка объединения результата, превысившего max_resp_body_size
+const errRespTooLarge = "response too large"
+
+// defaultMaxUpstreamReqSize лимит размера запроса к серверу, если max_upstream_req_size не задан
+const defaultMaxUpstreamReqSize = 4 * 1024 * 1024
+
+// reqTooLarge ошибка сервера, которому не отправлен запрос больше max_upstream_req_size
+func reqTooLarge(size, limit int64) string {
+	return fmt.Sprintf("request too large: %d bytes exceeds the proxy limit of %d bytes", size, limit)
+}
+
+// jsonSize оценивает размер значения в JSON без сериализации.
+// Оценка приблизительная (экранирование и запись чисел не учитываются),
+// но достаточна для ограничения объема объединяемого результата
+func jsonSize(v any) int64 {
+	switch t := v.(type) {
+	case map[string]any:
+		n := int64(2)
+		for k, val := range t {
+			n += int64(len(k)) + 4 + jsonSize(val)
+		}
+		return n
+	case []any:
+		n := int64(2)
+		for _, val := range t {
+			n += jsonSize(val) + 1
+		}
+		return n
+	case string:
+		return int64(len(t)) + 2
+	case nil:
+		return 4
+	case bool:
+		return 5
+	default:
+		return 8
+	}
+}
+
+// writeRespTooLarge сообщает клиенту, что результат превысил max_resp_body_size
+func (prx *Proxy) writeRespTooLarge(w http.ResponseWriter, id any) {
+	writeRPCError(w, id, -32500, "Response too large.",
+		"Combined result exceeds the proxy limit of "+strconv.FormatInt(prx.global.maxRespBodySizeInt64, 10)+
+			" bytes. Narrow the request with filters, hostids/groupids, a shorter 'output' list or 'limit'.")
+}
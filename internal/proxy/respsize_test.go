@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestJSONSize тестирует оценку размера результата в JSON
+func TestJSONSize(t *testing.T) {
+	value := []any{
+		map[string]any{"hostid": "10001", "name": "test-host", "status": "0", "tags": []any{}},
+		map[string]any{"hostid": "10002", "name": "other-host", "status": "1", "inventory": nil},
+	}
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+
+	// Оценка близка к реальному размеру
+	assert.InDelta(t, len(data), jsonSize(value), float64(len(data))/10)
+}
+
+// TestProcessAllServers_RespTooLarge тестирует прерывание объединения большого результата
+func TestProcessAllServers_RespTooLarge(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	z := ZabbixConf{
+		Servers: []zabbix.ZabbixServer{
+			{URL: "http://server1.com", ID: 1, Token: "token1", Name: "server1"},
+			{URL: "http://server2.com", ID: 2, Token: "token2", Name: "server2"},
+		},
+	}
+	request := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "host.get",
+		"id":      1,
+		"params":  map[string]any{},
+	}
+
+	// Результат одного сервера (~50 байт) помещается в лимит, двух - нет
+	prx := testProxy.Init(Global{MaxRequests: 5, MaxRespBodySize: "80B"}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-too-large")
+	assert.Nil(t, results)
+	assert.Equal(t, []string{errRespTooLarge}, errors)
+
+	prx.global.maxRespBodySizeInt64 = 1024
+	results, errors = testProxy.processAllServersWithMock(context.Background(), request, "test-fits")
+	assert.Empty(t, errors)
+	assert.Len(t, results, 2)
+}
+
+// TestProcessAllServers_ReqTooLarge тестирует отказ в отправке серверам слишком большого запроса
+func TestProcessAllServers_ReqTooLarge(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	z := ZabbixConf{
+		Servers: []zabbix.ZabbixServer{
+			{URL: "http://server1.com", ID: 1, Token: "token1", Name: "server1"},
+			{URL: "http://server2.com", ID: 2, Token: "token2", Name: "server2"},
+		},
+	}
+	request := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "host.get",
+		"id":      1,
+		"params":  map[string]any{"search": map[string]any{"name": strings.Repeat("x", 200)}},
+	}
+
+	// По умолчанию действует лимит 4MB
+	prx := testProxy.Init(Global{MaxRequests: 5}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	prx.SetMetrics(testProxy.metrics)
+	assert.Equal(t, int64(defaultMaxUpstreamReqSize), prx.global.maxUpstreamReqSizeInt64)
+	results, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-req-fits")
+	assert.Empty(t, errors)
+	assert.Len(t, results, 2)
+	assert.Len(t, testProxy.metrics.upstreamRequestSizes, 2)
+	calls := testProxy.GetMockClient().CallCount
+
+	prx.global.maxUpstreamReqSizeInt64 = 100
+	results, errors = testProxy.processAllServersWithMock(context.Background(), request, "test-req-too-large")
+	assert.Empty(t, results)
+	require.Len(t, errors, 2)
+	assert.Contains(t, errors[0], "request too large")
+	assert.Equal(t, calls, testProxy.GetMockClient().CallCount, "oversized request is not sent upstream")
+	assert.Equal(t, 1, testProxy.metrics.requestErrors["http://server1.com_request_too_large"])
+}
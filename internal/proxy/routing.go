@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"fmt"
+	"math/rand/v2"
+	"path"
+	"slices"
+)
+
+// Стратегии рассылки запроса по серверам
+const (
+	strategyAll           = "all"             // Все серверы, независимо от ID в запросе
+	strategyTargeted      = "targeted"        // Серверы из ID запроса, без ID - все (по умолчанию)
+	strategyFirstSuccess  = "first_success"   // Целевые серверы, ответ первого успешного
+	strategyFirstNonEmpty = "first_non_empty" // Целевые серверы, ответ первого непустого (проверка существования)
+	strategyPrimaryOnly   = "primary_only"    // Только основной сервер
+	strategyRandomOne     = "random_one"      // Один случайный из целевых серверов
+)
+
+var routeStrategies = []string{strategyAll, strategyTargeted, strategyFirstSuccess, strategyFirstNonEmpty, strategyPrimaryOnly, strategyRandomOne}
+
+// RouteConf стратегия рассылки для методов, подходящих под шаблон
+type RouteConf struct {
+	Method   string `yaml:"method"`   // Шаблон метода: apiinfo.version, host.*, *.get
+	Strategy string `yaml:"strategy"` // all, targeted, first_success, first_non_empty, primary_only, random_one
+	Server   int    `yaml:"server"`   // Основной сервер для primary_only, по умолчанию первый в конфиге
+	// Для first_non_empty: опрашивать серверы по очереди в порядке конфига, а не параллельно
+	Sequential bool `yaml:"sequential"`
+}
+
+// checkRoutes проверяет таблицу маршрутизации, ошибочные записи пропускаются
+func checkRoutes(routes []RouteConf) []RouteConf {
+	valid := make([]RouteConf, 0, len(routes))
+	for _, r := range routes {
+		if _, err := path.Match(r.Method, ""); err != nil || r.Method == "" {
+			logger.Global.Errorf("routing: invalid method pattern '%s', route skipped", r.Method)
+			continue
+		}
+		if !slices.Contains(routeStrategies, r.Strategy) {
+			logger.Global.Errorf("routing: unknown strategy '%s' for '%s', route skipped", r.Strategy, r.Method)
+			continue
+		}
+		valid = append(valid, r)
+	}
+	return valid
+}
+
+// methodRoute возвращает первую подходящую под метод запись таблицы маршрутизации
+func (prx *Proxy) methodRoute(method string) RouteConf {
+	for _, r := range prx.routes {
+		if ok, _ := path.Match(r.Method, method); ok {
+			return r
+		}
+	}
+	return RouteConf{Method: method, Strategy: strategyTargeted}
+}
+
+// routeServers применяет стратегию к целевым серверам запроса
+func (prx *Proxy) routeServers(route RouteConf, targets []int) ([]int, error) {
+	switch route.Strategy {
+	case strategyAll:
+		return prx.getAllServers(), nil
+
+	case strategyPrimaryOnly:
+		primary := route.Server
+		if primary == 0 && len(prx.config.Servers) > 0 {
+			primary = prx.config.Servers[0].ID
+		}
+		for _, s := range prx.config.Servers {
+			if s.ID == primary {
+				return []int{primary}, nil
+			}
+		}
+		return nil, fmt.Errorf("primary server %d is not configured", primary)
+
+	case strategyRandomOne:
+		// Выбираем из серверов, принимающих запросы
+		var allowed []int
+		for _, s := range prx.config.Servers {
+			if slices.Contains(targets, s.ID) && prx.serverAllowed(s) {
+				allowed = append(allowed, s.ID)
+			}
+		}
+		if len(allowed) == 0 {
+			allowed = targets
+		}
+		if len(allowed) == 0 {
+			return nil, nil
+		}
+		return []int{allowed[rand.IntN(len(allowed))]}, nil
+	}
+	return targets, nil
+}
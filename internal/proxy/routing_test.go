@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrentClient клиент Zabbix, отвечающий на запросы параллельно
+type concurrentClient struct {
+	MockZabbixClient
+	send func(ctx context.Context, url string) (map[string]any, error)
+}
+
+func (c *concurrentClient) SendToZabbix(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+	return c.send(ctx, url)
+}
+
+func routingServers() ZabbixConf {
+	return ZabbixConf{Servers: []zabbix.ZabbixServer{
+		{URL: "http://server1.com", ID: 1, Token: "token1"},
+		{URL: "http://server2.com", ID: 2, Token: "token2"},
+		{URL: "http://server3.com", ID: 3, Token: "token3"},
+	}}
+}
+
+// TestCheckRoutes тестирует проверку таблицы маршрутизации
+func TestCheckRoutes(t *testing.T) {
+	routes := checkRoutes([]RouteConf{
+		{Method: "apiinfo.version", Strategy: strategyFirstSuccess},
+		{Method: "host.get", Strategy: "broadcast"},
+		{Method: "[", Strategy: strategyAll},
+		{Method: "*.get", Strategy: strategyAll},
+	})
+	require.Len(t, routes, 2)
+	assert.Equal(t, "apiinfo.version", routes[0].Method)
+	assert.Equal(t, "*.get", routes[1].Method)
+}
+
+// TestRouteServers тестирует выбор серверов по стратегии
+func TestRouteServers(t *testing.T) {
+	g := Global{MaxRequests: 5, Routing: []RouteConf{
+		{Method: "apiinfo.*", Strategy: strategyFirstSuccess},
+		{Method: "host.get", Strategy: strategyTargeted},
+		{Method: "*.get", Strategy: strategyAll},
+	}}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	// Применяется первая подходящая запись
+	assert.Equal(t, strategyFirstSuccess, prx.methodRoute("apiinfo.version").Strategy)
+	assert.Equal(t, strategyTargeted, prx.methodRoute("host.get").Strategy)
+	assert.Equal(t, strategyAll, prx.methodRoute("item.get").Strategy)
+	assert.Equal(t, strategyTargeted, prx.methodRoute("event.acknowledge").Strategy)
+
+	servers, err := prx.routeServers(RouteConf{Strategy: strategyAll}, []int{2})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, servers)
+
+	servers, err = prx.routeServers(RouteConf{Strategy: strategyPrimaryOnly}, []int{2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, servers)
+
+	servers, err = prx.routeServers(RouteConf{Strategy: strategyPrimaryOnly, Server: 3}, []int{1})
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, servers)
+
+	_, err = prx.routeServers(RouteConf{Strategy: strategyPrimaryOnly, Server: 9}, []int{1})
+	assert.Error(t, err)
+
+	for i := 0; i < 20; i++ {
+		servers, err = prx.routeServers(RouteConf{Strategy: strategyRandomOne}, []int{2, 3})
+		require.NoError(t, err)
+		require.Len(t, servers, 1)
+		assert.Contains(t, []int{2, 3}, servers[0])
+	}
+}
+
+// TestProcessAllServers_FirstSuccess тестирует возврат первого успешного ответа
+// и отмену остальных запросов
+func TestProcessAllServers_FirstSuccess(t *testing.T) {
+	g := Global{MaxRequests: 5, MaxTimeout: "5s", Routing: []RouteConf{{Method: "item.get", Strategy: strategyFirstSuccess}}}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	var cancelled atomic.Int32
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		if url == "http://server2.com" {
+			return map[string]any{"result": []any{map[string]any{"itemid": "5"}}}, nil
+		}
+		// Остальные серверы отвечают только после отмены
+		select {
+		case <-ctx.Done():
+			cancelled.Add(1)
+			return nil, ctx.Err()
+		case <-time.After(3 * time.Second):
+			return map[string]any{"result": []any{map[string]any{"itemid": "6"}}}, nil
+		}
+	}}
+
+	start := time.Now()
+	request := map[string]any{"jsonrpc": "2.0", "method": "item.get", "id": 1, "params": map[string]any{}}
+	results, errors := prx.processAllServers(context.Background(), request, "test-first-success")
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Empty(t, errors)
+	assert.Equal(t, []any{map[string]any{"itemid": "52"}}, results)
+
+	// Отмененные запросы не считаются ошибками серверов
+	assert.Eventually(t, func() bool { return cancelled.Load() == 2 }, time.Second, 10*time.Millisecond)
+	allowed, _ := prx.cb.AllowRequest("server1.com")
+	assert.True(t, allowed)
+}
+
+// TestProcessAllServers_FirstNonEmpty тестирует возврат первого непустого ответа
+func TestProcessAllServers_FirstNonEmpty(t *testing.T) {
+	prx := InitProxy(Global{MaxRequests: 5, MaxTimeout: "5s"}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	var calls atomic.Int32
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		calls.Add(1)
+		switch url {
+		case "http://server1.com":
+			return map[string]any{"result": []any{}}, nil
+		case "http://server2.com":
+			return map[string]any{"result": []any{map[string]any{"hostid": "10084", "name": "web-01"}}}, nil
+		}
+		// Третий сервер отвечает только после отмены
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+
+	for _, sequential := range []bool{false, true} {
+		t.Run(map[bool]string{false: "parallel", true: "sequential"}[sequential], func(t *testing.T) {
+			prx.routes = checkRoutes([]RouteConf{{Method: "host.get", Strategy: strategyFirstNonEmpty, Sequential: sequential}})
+			calls.Store(0)
+
+			start := time.Now()
+			request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1,
+				"params": map[string]any{"filter": map[string]any{"name": "web-01"}, "limit": 1}}
+			results, errors := prx.processAllServers(context.Background(), request, "test-first-non-empty")
+			assert.Less(t, time.Since(start), time.Second)
+			assert.Empty(t, errors)
+			require.Len(t, results, 1)
+			assert.Equal(t, "web-01", results.([]any)[0].(map[string]any)["name"])
+
+			if sequential {
+				// До третьего сервера очередь не дошла
+				assert.Equal(t, int32(2), calls.Load())
+			} else {
+				assert.Eventually(t, func() bool { return calls.Load() == 3 }, time.Second, 10*time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Коды ошибок JSON-RPC прокси, когда ни один сервер не ответил
+// (диапазон -32000..-32099 зарезервирован для ошибок реализации)
+const (
+	codeUpstreamError = -32000
+	codeCircuitOpen   = -32001 // Все серверы пропущены из-за открытого Circuit Breaker
+)
+
+// reasonCircuitOpen причина ошибки сервера, пропущенного Circuit Breaker
+const reasonCircuitOpen = "circuit_open"
+
+// defaultRecoveryTimeout время до пробного запроса, если recovery_timeout не задан
+// (значение по умолчанию библиотеки circuitbreaker)
+const defaultRecoveryTimeout = 30 * time.Second
+
+// serverFailure ошибка одного сервера в ответе клиенту
+type serverFailure struct {
+	Server  string `json:"server"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Для пропущенного Circuit Breaker сервера: причина и время, когда
+	// будет пропущен пробный запрос (RFC 3339)
+	Reason     string `json:"reason,omitempty"`
+	RetryAfter string `json:"retry_after,omitempty"`
+}
+
+// parseServerError разбирает ошибку сервера вида "url: текст". Для ошибки,
+// которой ответил Zabbix, возвращается и ее исходный объект
+func (prx *Proxy) parseServerError(e string) (serverFailure, map[string]any) {
+	server, text, ok := strings.Cut(e, ": ")
+	if !ok {
+		// Ошибка прокси, не относящаяся к серверу (таймаут запроса)
+		server, text = "APIproxy", e
+	}
+	failure := serverFailure{Server: server, Code: codeUpstreamError, Message: text}
+
+	if strings.Contains(text, "circuit breaker open") {
+		failure.Reason = reasonCircuitOpen
+		if retry, ok := prx.circuitRetryAt(server); ok {
+			failure.RetryAfter = retry.UTC().Format(time.RFC3339)
+		}
+		return failure, nil
+	}
+
+	if !strings.HasPrefix(text, "{") {
+		return failure, nil
+	}
+	var obj map[string]any
+	if json.Unmarshal([]byte(text), &obj) != nil {
+		return failure, nil
+	}
+	code, ok := obj["code"].(float64)
+	if !ok {
+		return failure, nil
+	}
+	failure.Code = int(code)
+	message, _ := obj["message"].(string)
+	if data, _ := obj["data"].(string); data != "" {
+		message = strings.TrimSpace(message + " " + data)
+	}
+	failure.Message = message
+	return failure, obj
+}
+
+// circuitRetryAt возвращает время, когда открытый Circuit Breaker сервера (для сервера
+// с репликами - ближайшей реплики) пропустит пробный запрос
+func (prx *Proxy) circuitRetryAt(url string) (time.Time, bool) {
+	if prx.cb == nil {
+		return time.Time{}, false
+	}
+
+	var names []string
+	for _, srv := range prx.config.Servers {
+		if srv.URL != url {
+			continue
+		}
+		if b := prx.balancers[srv.ID]; b != nil {
+			for _, r := range b.replicas {
+				names = append(names, r.name)
+			}
+		} else {
+			names = append(names, srv.Name)
+		}
+	}
+
+	recovery := prx.cbConf.RecoveryTimeout
+	if recovery <= 0 {
+		recovery = defaultRecoveryTimeout
+	}
+
+	var earliest time.Time
+	stats := prx.cb.GetCircuitBreakerStats()
+	for _, name := range names {
+		st, ok := stats[name].(map[string]any)
+		if !ok || st["state"] != "open" {
+			continue
+		}
+		last, _ := st["last_failure_time"].(time.Time)
+		if retry := last.Add(recovery); earliest.IsZero() || retry.Before(earliest) {
+			earliest = retry
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
+
+// upstreamError формирует объект ошибки JSON-RPC, когда не ответил ни один сервер.
+// Ошибку единственного сервера, которой ответил Zabbix, клиент получает в исходном
+// виде, как от самого Zabbix. Иначе код и сообщение берутся из первой ошибки Zabbix,
+// а в data перечисляются ошибки всех серверов. Если все серверы пропущены Circuit
+// Breaker, возвращается также ближайшее время повтора (иначе нулевое)
+func (prx *Proxy) upstreamError(errors []string) (map[string]any, time.Time) {
+	failures := make([]serverFailure, 0, len(errors))
+	var zbxErr map[string]any
+	var retryAt time.Time
+	allOpen := len(errors) > 0
+	for _, e := range errors {
+		failure, obj := prx.parseServerError(e)
+		failures = append(failures, failure)
+		if zbxErr == nil {
+			zbxErr = obj
+		}
+		if failure.Reason != reasonCircuitOpen {
+			allOpen = false
+		} else if retry, err := time.Parse(time.RFC3339, failure.RetryAfter); err == nil && (retryAt.IsZero() || retry.Before(retryAt)) {
+			retryAt = retry
+		}
+	}
+
+	if len(errors) == 1 && zbxErr != nil {
+		return zbxErr, time.Time{}
+	}
+
+	code, message := codeUpstreamError, "All upstream servers failed."
+	switch {
+	case zbxErr != nil:
+		code = int(zbxErr["code"].(float64))
+		if m, ok := zbxErr["message"].(string); ok {
+			message = m
+		}
+	case allOpen:
+		code, message = codeCircuitOpen, "Circuit breaker open for all servers."
+	default:
+		retryAt = time.Time{}
+	}
+	return map[string]any{
+		"code":    code,
+		"message": message,
+		"data":    failures,
+	}, retryAt
+}
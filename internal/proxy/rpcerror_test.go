@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUpstreamError тестирует формирование ошибки JSON-RPC при отказе всех серверов
+func TestUpstreamError(t *testing.T) {
+	// Circuit Breaker серверов закрыт
+	prx := InitProxy(Global{MaxRequests: 5}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	upstreamError := func(errors []string) map[string]any {
+		rpcErr, retryAt := prx.upstreamError(errors)
+		assert.True(t, retryAt.IsZero())
+		return rpcErr
+	}
+
+	zbxErr := `{"code":-32602,"data":"No permissions to referred object or it does not exist!","message":"Invalid params."}`
+
+	// Ошибка единственного сервера от Zabbix возвращается в исходном виде
+	assert.Equal(t, map[string]any{
+		"code":    -32602.0,
+		"message": "Invalid params.",
+		"data":    "No permissions to referred object or it does not exist!",
+	}, upstreamError([]string{"http://server1.com: " + zbxErr}))
+
+	// Без ошибок Zabbix - общий код прокси и ошибки по серверам
+	assert.Equal(t, map[string]any{
+		"code":    codeUpstreamError,
+		"message": "All upstream servers failed.",
+		"data": []serverFailure{
+			{Server: "http://server1.com", Code: codeUpstreamError, Message: "connection refused"},
+			{Server: "APIproxy", Code: codeUpstreamError, Message: "request timeout"},
+		},
+	}, upstreamError([]string{"http://server1.com: connection refused", "request timeout"}))
+
+	// Код и сообщение берутся из ошибки Zabbix
+	assert.Equal(t, map[string]any{
+		"code":    -32602,
+		"message": "Invalid params.",
+		"data": []serverFailure{
+			{Server: "http://server1.com", Code: codeUpstreamError, Message: "server 1: circuit breaker open", Reason: reasonCircuitOpen},
+			{Server: "http://server2.com", Code: -32602, Message: "Invalid params. No permissions to referred object or it does not exist!"},
+		},
+	}, upstreamError([]string{"http://server1.com: server 1: circuit breaker open", "http://server2.com: " + zbxErr}))
+}
+
+// TestHandler_AllServersFailed тестирует ответ клиенту при отказе всех серверов
+func TestHandler_AllServersFailed(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	prx := testProxy.Init(Global{MaxRequests: 5}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	mock := testProxy.GetMockClient()
+	mock.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, req map[string]any) (map[string]any, error) {
+		if url == "http://server2.com" {
+			return nil, &zabbix.APIError{Code: -32500, Object: map[string]any{"code": -32500.0, "message": "Application error.", "data": "SQL statement execution has failed."}}
+		}
+		return nil, errors.New("connection refused")
+	}
+	prx.zbxClient = mock
+
+	body := []byte(`{"jsonrpc":"2.0","method":"host.get","params":{},"id":7}`)
+	req := httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+	req = req.WithContext(context.WithValue(req.Context(), bodyKey, body))
+	w := httptest.NewRecorder()
+	prx.Handler(w, req)
+
+	var resp struct {
+		ID    float64 `json:"id"`
+		Error struct {
+			Code    int             `json:"code"`
+			Message string          `json:"message"`
+			Data    []serverFailure `json:"data"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 7.0, resp.ID)
+	assert.Equal(t, -32500, resp.Error.Code)
+	assert.Equal(t, "Application error.", resp.Error.Message)
+	assert.ElementsMatch(t, []serverFailure{
+		{Server: "http://server1.com", Code: codeUpstreamError, Message: "connection refused"},
+		{Server: "http://server2.com", Code: -32500, Message: "Application error. SQL statement execution has failed."},
+		{Server: "http://server3.com", Code: codeUpstreamError, Message: "connection refused"},
+	}, resp.Error.Data)
+}
+
+// TestHandler_CircuitOpen тестирует время повтора в ответе, когда все серверы
+// пропущены Circuit Breaker
+func TestHandler_CircuitOpen(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	cb := CBConf{FailureThreshold: 1, RecoveryTimeout: time.Minute}
+	prx := testProxy.Init(Global{MaxRequests: 5}, routingServers(), cb, CacheConf(initTestCache()), ExcludeMethods{})
+	for _, name := range []string{"server1.com", "server2.com", "server3.com"} {
+		prx.cb.ReportFailure(name)
+	}
+	prx.zbxClient = testProxy.GetMockClient()
+
+	body := []byte(`{"jsonrpc":"2.0","method":"host.get","params":{},"id":1}`)
+	req := httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+	req = req.WithContext(context.WithValue(req.Context(), bodyKey, body))
+	w := httptest.NewRecorder()
+	prx.Handler(w, req)
+
+	assert.Zero(t, testProxy.GetMockClient().CallCount)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	var resp struct {
+		Error struct {
+			Code int             `json:"code"`
+			Data []serverFailure `json:"data"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, codeCircuitOpen, resp.Error.Code)
+	require.Len(t, resp.Error.Data, 3)
+	for _, f := range resp.Error.Data {
+		assert.Equal(t, reasonCircuitOpen, f.Reason)
+		retry, err := time.Parse(time.RFC3339, f.RetryAfter)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), retry, 2*time.Second)
+	}
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+
+	"github.com/a3ak/suffix"
+)
+
+// для передачи запросов снимка результата в processAllServers
+const progressKey ctxKey = "soft_timeout_progress"
+
+// Время, в течение которого собранный в фоне результат отдается одинаковым запросам
+const defaultSoftTimeoutTTL = time.Minute
+
+// softSnapshot результат, собранный к мягкому таймауту, и серверы, ответ которых еще ожидается
+type softSnapshot struct {
+	results any
+	errors  []string
+	pending []int
+}
+
+// softProgress канал запросов снимка результата выполняющегося запроса.
+// Снимок формирует цикл сбора ответов processAllServers
+type softProgress struct {
+	requests chan chan softSnapshot
+}
+
+// progressFromContext возвращает канал запросов снимка (nil, если мягкий таймаут не применяется)
+func progressFromContext(ctx context.Context) *softProgress {
+	progress, _ := ctx.Value(progressKey).(*softProgress)
+	return progress
+}
+
+// snapshots возвращает канал запросов снимка (nil-канал не выбирается в select)
+func (p *softProgress) snapshots() chan chan softSnapshot {
+	if p == nil {
+		return nil
+	}
+	return p.requests
+}
+
+// softCall запрос, выполняющийся в фоне до жесткого таймаута
+type softCall struct {
+	done     chan struct{}
+	progress *softProgress
+	results  any
+	errors   []string
+}
+
+// softEntry полный результат, собранный в фоне после мягкого таймаута
+type softEntry struct {
+	results any
+	errors  []string
+	expires time.Time
+}
+
+// softTimeouts мягкий и жесткий таймауты запросов: по soft_timeout клиент получает
+// результаты успевших серверов, а сбор ответов продолжается в фоне до hard_timeout.
+// Полный результат отдается одинаковым запросам в течение soft_timeout_ttl, а затем
+// еще stale_while_revalidate, пока он обновляется в фоне
+type softTimeouts struct {
+	soft  time.Duration
+	hard  time.Duration
+	ttl   time.Duration
+	stale time.Duration
+
+	mu      sync.Mutex
+	calls   map[string]*softCall
+	results map[string]softEntry
+	now     func() time.Time
+}
+
+// newSoftTimeouts возвращает nil, если soft_timeout не задан или не меньше жесткого таймаута.
+// stale_while_revalidate применяется только к результатам soft_timeout
+func newSoftTimeouts(g Global, maxTimeout time.Duration) *softTimeouts {
+	if g.SoftTimeout == "" {
+		if g.StaleWhileRevalidate != "" {
+			logger.Global.Warningf("'stale_while_revalidate' has no effect without 'soft_timeout'")
+		}
+		return nil
+	}
+	duration := func(name, value string, def time.Duration) time.Duration {
+		if value == "" {
+			return def
+		}
+		s, err := suffix.ToSeconds(value)
+		if err != nil || s < 0 {
+			logger.Global.Errorf("convert error '%s' to seconds: %v, using %v", name, err, def)
+			return def
+		}
+		return time.Duration(s) * time.Second
+	}
+
+	st := &softTimeouts{
+		soft:    duration("soft_timeout", g.SoftTimeout, 0),
+		hard:    duration("hard_timeout", g.HardTimeout, maxTimeout),
+		ttl:     duration("soft_timeout_ttl", g.SoftTimeoutTTL, defaultSoftTimeoutTTL),
+		stale:   duration("stale_while_revalidate", g.StaleWhileRevalidate, 0),
+		calls:   make(map[string]*softCall),
+		results: make(map[string]softEntry),
+		now:     time.Now,
+	}
+	if st.soft <= 0 || st.soft >= st.hard {
+		logger.Global.Errorf("soft_timeout %v must be less than hard_timeout %v, soft timeout is disabled", st.soft, st.hard)
+		if g.StaleWhileRevalidate != "" {
+			logger.Global.Warningf("'stale_while_revalidate' has no effect without 'soft_timeout'")
+		}
+		return nil
+	}
+	if st.soft >= maxTimeout {
+		logger.Global.Warningf("soft_timeout %v is not less than max_timeout %v, clients time out before partial results", st.soft, maxTimeout)
+	}
+	return st
+}
+
+// join возвращает сохраненный результат (nil, если его нет) и выполняющийся запрос по ключу.
+// Для свежего результата запрос не возвращается, для устаревшего в пределах
+// stale_while_revalidate - возвращается запрос его обновления. leader == true,
+// если запрос создан и его нужно запустить
+func (st *softTimeouts) join(key string) (call *softCall, entry *softEntry, leader bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := st.now()
+	if e, ok := st.results[key]; ok {
+		if now.Before(e.expires) {
+			return nil, &e, false
+		}
+		if now.Before(e.expires.Add(st.stale)) {
+			entry = &e
+		} else {
+			delete(st.results, key)
+		}
+	}
+	if call, ok := st.calls[key]; ok {
+		return call, entry, false
+	}
+	call = &softCall{done: make(chan struct{}), progress: &softProgress{requests: make(chan chan softSnapshot)}}
+	st.calls[key] = call
+	return call, entry, true
+}
+
+// finish завершает запрос. Полный результат без ошибок сохраняется для одинаковых запросов
+func (st *softTimeouts) finish(key string, call *softCall, results any, errors []string) {
+	call.results, call.errors = results, errors
+
+	st.mu.Lock()
+	delete(st.calls, key)
+	now := st.now()
+	for k, entry := range st.results {
+		if !now.Before(entry.expires.Add(st.stale)) {
+			delete(st.results, k)
+		}
+	}
+	// Неудачное обновление не заменяет устаревший результат
+	if len(errors) == 0 {
+		st.results[key] = softEntry{results: results, errors: errors, expires: now.Add(st.ttl)}
+	}
+	st.mu.Unlock()
+	close(call.done)
+}
+
+// snapshot запрашивает результат, собранный на текущий момент. false, если запрос уже завершен
+func (call *softCall) snapshot(ctx context.Context) (softSnapshot, bool) {
+	reply := make(chan softSnapshot, 1)
+	select {
+	case call.progress.requests <- reply:
+		return <-reply, true
+	case <-call.done:
+	case <-ctx.Done():
+	}
+	return softSnapshot{}, false
+}
+
+// processSoftTimeout выполняет читающий запрос с мягким таймаутом. Запрос к серверам
+// выполняется в фоне до hard_timeout и разделяется одинаковыми запросами. Клиент,
+// не дождавшийся полного результата за soft_timeout, получает собранную часть,
+// а серверы без ответа отмечаются в отчете о неполном результате
+func (prx *Proxy) processSoftTimeout(ctx context.Context, request map[string]any, method, trace_id, key string) (any, []string) {
+	st := prx.soft
+	mc := prx.methodMetrics(method)
+
+	call, entry, leader := st.join(key)
+	if leader {
+		prx.startSoftCall(ctx, key, call, request, trace_id)
+	}
+	if entry != nil {
+		// Устаревший результат отдается сразу, пока запрос его обновления выполняется в фоне
+		status := "soft_timeout_cached"
+		if call != nil {
+			status = "stale_served"
+			logger.Global.Debugf("[%s] Request %s answered with stale result, refreshing in background", trace_id, method)
+		} else {
+			logger.Global.Debugf("[%s] Request %s answered with result completed in background", trace_id, method)
+		}
+		if mc != nil {
+			mc.IncRequestStatus("APIproxy", status)
+		}
+		return deepClone(entry.results), entry.errors
+	}
+	if !leader && mc != nil {
+		mc.IncRequestStatus("APIproxy", "coalesced")
+	}
+
+	timer := time.NewTimer(st.soft)
+	defer timer.Stop()
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, contextErrors(ctx)
+	case <-timer.C:
+		if snap, ok := call.snapshot(ctx); ok {
+			logger.Global.Warningf("[%s] Soft timeout %v, returning partial result without servers %v", trace_id, st.soft, snap.pending)
+			if mc != nil {
+				mc.IncRequestStatus("APIproxy", "soft_timeout")
+			}
+			partialFromContext(ctx).add(snap.pending)
+			return snap.results, snap.errors
+		}
+		if ctx.Err() != nil {
+			return nil, contextErrors(ctx)
+		}
+	}
+	return deepClone(call.results), call.errors
+}
+
+// startSoftCall запускает запрос к серверам в фоне. Фоновый запрос не прерывается уходом
+// клиента и ограничен жестким таймаутом, но прерывается перезагрузкой конфигурации.
+// Отчет о неполном результате и резерв памяти клиента ему не передаются
+func (prx *Proxy) startSoftCall(ctx context.Context, key string, call *softCall, request map[string]any, trace_id string) {
+	st := prx.soft
+	bgCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), st.hard)
+	bgCtx = context.WithValue(bgCtx, progressKey, call.progress)
+	bgCtx = context.WithValue(bgCtx, partialKey, (*partialReport)(nil))
+	bgCtx = context.WithValue(bgCtx, memBudgetKey, (*memReservation)(nil))
+	bgCtx, memRes := prx.withMemReservation(bgCtx)
+	started := prx.background.start(func(bg context.Context) {
+		defer context.AfterFunc(bg, cancel)()
+		defer cancel()
+		defer memRes.release()
+		results, errors := prx.processAllServers(bgCtx, request, trace_id)
+		st.finish(key, call, results, errors)
+	})
+	if !started {
+		cancel()
+		memRes.release()
+		st.finish(key, call, nil, []string{errServerTimeout})
+	}
+}
+
+// contextErrors ошибка запроса, прерванного отключением клиента или таймаутом
+func contextErrors(ctx context.Context) []string {
+	if clientGone(ctx) {
+		return []string{errClientGone}
+	}
+	return []string{errServerTimeout}
+}
@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewSoftTimeouts тестирует разбор soft_timeout и hard_timeout
+func TestNewSoftTimeouts(t *testing.T) {
+	assert.Nil(t, newSoftTimeouts(Global{}, 30*time.Second))
+	// Мягкий таймаут не меньше жесткого - отключен
+	assert.Nil(t, newSoftTimeouts(Global{SoftTimeout: "30s"}, 30*time.Second))
+	assert.Nil(t, newSoftTimeouts(Global{SoftTimeout: "10s", HardTimeout: "5s"}, 30*time.Second))
+
+	st := newSoftTimeouts(Global{SoftTimeout: "5s"}, 30*time.Second)
+	require.NotNil(t, st)
+	assert.Equal(t, 5*time.Second, st.soft)
+	assert.Equal(t, 30*time.Second, st.hard)
+	assert.Equal(t, defaultSoftTimeoutTTL, st.ttl)
+
+	st = newSoftTimeouts(Global{SoftTimeout: "5s", HardTimeout: "2m", SoftTimeoutTTL: "10m"}, 30*time.Second)
+	require.NotNil(t, st)
+	assert.Equal(t, 2*time.Minute, st.hard)
+	assert.Equal(t, 10*time.Minute, st.ttl)
+}
+
+// TestSoftTimeouts_Cache тестирует хранение полного результата
+func TestSoftTimeouts_Cache(t *testing.T) {
+	st := newSoftTimeouts(Global{SoftTimeout: "1s", SoftTimeoutTTL: "1m"}, 30*time.Second)
+	now := time.Now()
+	st.now = func() time.Time { return now }
+
+	call, entry, leader := st.join("key")
+	assert.Nil(t, entry)
+	assert.True(t, leader)
+	// Одинаковый запрос присоединяется к выполняющемуся
+	joined, _, leader := st.join("key")
+	assert.Same(t, call, joined)
+	assert.False(t, leader)
+
+	st.finish("key", call, []any{"a"}, nil)
+	call, entry, _ = st.join("key")
+	assert.Nil(t, call)
+	require.NotNil(t, entry)
+	assert.Equal(t, []any{"a"}, entry.results)
+
+	// Результат с ошибками не сохраняется
+	call, _, _ = st.join("failed")
+	st.finish("failed", call, []any{"a"}, []string{"http://server1.com: error"})
+	_, entry, leader = st.join("failed")
+	assert.Nil(t, entry)
+	assert.True(t, leader)
+
+	// Устаревший результат не возвращается
+	now = now.Add(2 * time.Minute)
+	_, entry, leader = st.join("key")
+	assert.Nil(t, entry)
+	assert.True(t, leader)
+}
+
+// TestSoftTimeouts_StaleWhileRevalidate тестирует выдачу устаревшего результата на время обновления
+func TestSoftTimeouts_StaleWhileRevalidate(t *testing.T) {
+	st := newSoftTimeouts(Global{SoftTimeout: "1s", SoftTimeoutTTL: "1m", StaleWhileRevalidate: "5m"}, 30*time.Second)
+	require.NotNil(t, st)
+	assert.Equal(t, 5*time.Minute, st.stale)
+	now := time.Now()
+	st.now = func() time.Time { return now }
+
+	call, _, _ := st.join("key")
+	st.finish("key", call, []any{"a"}, nil)
+
+	// Устаревший результат отдается, первый запрос запускает обновление
+	now = now.Add(2 * time.Minute)
+	refresh, entry, leader := st.join("key")
+	require.NotNil(t, entry)
+	assert.Equal(t, []any{"a"}, entry.results)
+	require.NotNil(t, refresh)
+	assert.True(t, leader)
+	// Следующие запросы не запускают повторное обновление
+	joined, entry, leader := st.join("key")
+	assert.NotNil(t, entry)
+	assert.Same(t, refresh, joined)
+	assert.False(t, leader)
+
+	// Неудачное обновление не заменяет устаревший результат, следующий запрос повторяет обновление
+	st.finish("key", refresh, nil, []string{"request timeout"})
+	refresh, entry, leader = st.join("key")
+	require.NotNil(t, entry)
+	assert.Equal(t, []any{"a"}, entry.results)
+	assert.True(t, leader)
+	st.finish("key", refresh, nil, []string{"request timeout"})
+
+	// За пределами stale_while_revalidate результат не отдается
+	now = now.Add(5 * time.Minute)
+	_, entry, leader = st.join("key")
+	assert.Nil(t, entry)
+	assert.True(t, leader)
+}
+
+// TestProcessSoftTimeout тестирует неполный результат по мягкому таймауту
+// и полный результат, собранный в фоне, для следующего запроса
+func TestProcessSoftTimeout(t *testing.T) {
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{
+		{URL: "http://fast.com", ID: 1, Token: "token1", Name: "fast"},
+		{URL: "http://slow.com", ID: 2, Token: "token2", Name: "slow"},
+	}}
+	g := Global{MaxRequests: 5, MaxTimeout: "10s", SoftTimeout: "1s", HardTimeout: "5s", DeadlineHeadroom: "0"}
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	require.NotNil(t, prx.soft)
+
+	metrics := NewMockMetricsCollector()
+	prx.SetMetrics(metrics)
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		if url == "http://slow.com" {
+			select {
+			case <-time.After(1500 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return map[string]any{"jsonrpc": "2.0", "result": []any{map[string]any{"hostid": "10"}}}, nil
+	}}
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+	run := func() (any, []string, *partialReport) {
+		ctx, report := prx.withPartialReport(context.Background())
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		results, errors := prx.processCoalesced(ctx, request, "host.get", "test-soft", false)
+		return results, errors, report
+	}
+
+	start := time.Now()
+	results, errors, report := run()
+	assert.Less(t, time.Since(start), 1400*time.Millisecond)
+	list, ok := results.([]any)
+	require.True(t, ok)
+	assert.Len(t, list, 1)
+	assert.Equal(t, []string{"http://slow.com: server 2: request timeout"}, errors)
+	assert.True(t, report.partial())
+	assert.Equal(t, []int{2}, report.meta(errors)["timed_out_servers"])
+	assert.Equal(t, 1, metrics.requestErrors["APIproxy_soft_timeout"])
+
+	// Сбор ответов завершается в фоне, следующий запрос получает полный результат
+	assert.Eventually(t, func() bool {
+		prx.soft.mu.Lock()
+		defer prx.soft.mu.Unlock()
+		return len(prx.soft.results) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	start = time.Now()
+	results, errors, report = run()
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	list, ok = results.([]any)
+	require.True(t, ok)
+	assert.Len(t, list, 2)
+	assert.Empty(t, errors)
+	assert.False(t, report.partial())
+	assert.Equal(t, 1, metrics.requestErrors["APIproxy_soft_timeout_cached"])
+}
+
+// TestProcessSoftTimeout_SingleServer тестирует мягкий таймаут запроса к единственному серверу
+func TestProcessSoftTimeout_SingleServer(t *testing.T) {
+	prx := partialTestProxy(Global{MaxTimeout: "10s", SoftTimeout: "1s", HardTimeout: "5s", DeadlineHeadroom: "0"})
+	defer cleanupTestProxy(prx)
+	require.NotNil(t, prx.soft)
+	prx.config.Servers = prx.config.Servers[1:]
+
+	ctx, report := prx.withPartialReport(context.Background())
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+
+	start := time.Now()
+	_, errors := prx.processCoalesced(ctx, request, "host.get", "test-soft-single", false)
+	assert.Less(t, time.Since(start), 1400*time.Millisecond)
+	assert.Equal(t, []string{"http://slow.com: server 2: request timeout"}, errors)
+	assert.Equal(t, []int{2}, report.meta(errors)["timed_out_servers"])
+}
+
+// TestProcessSoftTimeout_ServerQuota тестирует квоту элементов в результате,
+// собранном к мягкому таймауту
+func TestProcessSoftTimeout_ServerQuota(t *testing.T) {
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{
+		{URL: "http://fast.com", ID: 1, Token: "token1", Name: "fast"},
+		{URL: "http://slow.com", ID: 2, Token: "token2", Name: "slow"},
+	}}
+	g := Global{MaxRequests: 5, MaxTimeout: "10s", SoftTimeout: "1s", HardTimeout: "5s", DeadlineHeadroom: "0",
+		StableOrder: true, ServerQuota: ServerQuotaConf{MaxItems: 2}}
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		if url == "http://slow.com" {
+			select {
+			case <-time.After(1500 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return map[string]any{"jsonrpc": "2.0", "result": []any{map[string]any{"hostid": "20"}}}, nil
+		}
+		return map[string]any{"jsonrpc": "2.0", "result": []any{
+			map[string]any{"hostid": "10"}, map[string]any{"hostid": "11"}, map[string]any{"hostid": "12"},
+		}}, nil
+	}}
+
+	ctx, _ := prx.withPartialReport(context.Background())
+	ctx, quota := prx.withServerQuota(ctx, "host.get")
+	require.NotNil(t, quota)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+
+	results, _ := prx.processCoalesced(ctx, request, "host.get", "test-soft-quota", false)
+	assert.Len(t, results, 2, "fast server is capped at max_items in the partial result")
+	require.True(t, quota.truncated())
+	assert.Equal(t, map[string]any{"1": 1}, quota.meta()["dropped"])
+
+	// Завершение сбора в фоне не учитывает отброшенные элементы повторно
+	assert.Eventually(t, func() bool {
+		prx.soft.mu.Lock()
+		defer prx.soft.mu.Unlock()
+		return len(prx.soft.results) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, map[string]any{"1": 1}, quota.meta()["dropped"])
+	prx.soft.mu.Lock()
+	defer prx.soft.mu.Unlock()
+	for _, entry := range prx.soft.results {
+		assert.Len(t, entry.results, 3)
+	}
+}
@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// Методы получения сущностей для кешируемых типов
+	entityGetMethods = map[string]string{"host": "host.get", "group": "hostgroup.get"}
+
+	// Ошибка Zabbix об отсутствии сущности: 'Host with ID "10084" does not exist.'.
+	// Общая ошибка "No permissions to referred object or it does not exist!" означает
+	// и отсутствие прав, поэтому маппинги по ней не удаляются
+	notFoundPattern = regexp.MustCompile(`(?i)\b(host group|hostgroup|host) with ID "?(\d+)"? does not exist`)
+
+	// Тип кеша по сущности из ошибки Zabbix
+	notFoundTypes = map[string]string{"host": "host", "host group": "group", "hostgroup": "group"}
+
+	// Параметры запроса получения сущностей, не сужающие выборку по ID
+	nonSelectingParams = map[string]bool{"output": true, "sortfield": true, "sortorder": true, "preservekeys": true, "limitSelects": true}
+)
+
+// resolvedID ProxyID, преобразованный в OriginalID через кеш
+type resolvedID struct {
+	cacheType  string
+	proxyID    int
+	originalID int
+}
+
+// appendResolvedID запоминает преобразованный через кеш ProxyID
+func appendResolvedID(resolved []resolvedID, idField string, proxyID, originalID any) []resolvedID {
+	pID, ok1 := toIntID(proxyID)
+	oID, ok2 := toIntID(originalID)
+	if !ok1 || !ok2 {
+		return resolved
+	}
+	cacheType := strings.TrimSuffix(strings.TrimSuffix(idField, "ids"), "id")
+	return append(resolved, resolvedID{cacheType: cacheType, proxyID: pID, originalID: oID})
+}
+
+// toIntID приводит ID из запроса или ответа к int
+func toIntID(id any) (int, bool) {
+	switch v := id.(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// notFoundResolvedIDs возвращает преобразованные через кеш ID сущности, об отсутствии
+// которой сообщила ошибка Zabbix. Транспортные ошибки (HTTP 404) и ошибки прав не учитываются
+func notFoundResolvedIDs(err error, resolved []resolvedID) []resolvedID {
+	apiErr, ok := zabbix.AsAPIError(err)
+	if !ok {
+		return nil
+	}
+	m := notFoundPattern.FindStringSubmatch(apiErr.Data)
+	if m == nil {
+		return nil
+	}
+	cacheType := notFoundTypes[strings.ToLower(m[1])]
+	originalID, _ := strconv.Atoi(m[2])
+
+	var missing []resolvedID
+	for _, r := range resolved {
+		if r.cacheType == cacheType && r.originalID == originalID {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// selectsOnlyByIDs проверяет, что запрос получения сущности ограничен только списком ID
+// (hostids в host.get): фильтры, поиск, limit и флаги выборки тоже могут исключить сущность
+func selectsOnlyByIDs(cacheType string, params map[string]any) bool {
+	for key := range params {
+		if key == cacheType+"ids" || nonSelectingParams[key] || strings.HasPrefix(key, "select") {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// missingResolvedIDs возвращает преобразованные через кеш ID, которых нет в ответе
+// метода получения этой сущности (например hostids в host.get), если запрос выбирает
+// сущности только по ID
+func missingResolvedIDs(method string, params map[string]any, result any, resolved []resolvedID) []resolvedID {
+	items, ok := result.([]any)
+	if !ok || len(resolved) == 0 {
+		return nil
+	}
+
+	var missing []resolvedID
+	for _, r := range resolved {
+		if entityGetMethods[r.cacheType] != method || !selectsOnlyByIDs(r.cacheType, params) {
+			continue
+		}
+		found := false
+		for _, item := range items {
+			if m, ok := item.(map[string]any); ok {
+				if id, ok := toIntID(m[r.cacheType+"id"]); ok && id == r.originalID {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// evictStaleMappings удаляет подозрительные маппинги сервера из кеша и,
+// если включен reresolve_stale, в фоне ищет сущность по имени заново
+func (prx *Proxy) evictStaleMappings(srv zabbix.ZabbixServer, stale []resolvedID, trace_id string) {
+	if prx.cache == nil {
+		return
+	}
+	for _, r := range stale {
+		cache, ok := prx.cache.CacheType[r.cacheType]
+		if !ok {
+			continue
+		}
+		name, _ := cache.GetEntityName(r.proxyID)
+		cache.DeleteServerMapping(r.proxyID, srv.ID)
+		logger.Global.Warningf("[%s] Server[%d]: stale mapping %s ProxyID %d -> OriginalID %d ('%s') evicted from cache", trace_id, srv.ID, r.cacheType, r.proxyID, r.originalID, name)
+
+		if prx.global.ReresolveStale && name != "" {
+			prx.background.start(func(ctx context.Context) {
+				prx.reresolveByName(ctx, srv, r, name, trace_id)
+			})
+		}
+	}
+}
+
+// reresolveByName ищет сущность на сервере по имени и восстанавливает маппинг с новым OriginalID
+func (prx *Proxy) reresolveByName(ctx context.Context, srv zabbix.ZabbixServer, r resolvedID, name, trace_id string) {
+	method, ok := entityGetMethods[r.cacheType]
+	if !ok {
+		return
+	}
+	nameField := prx.cachedFields[r.cacheType]
+	// В кеше имя с сервером (name_disambiguation), сервер ищет по своему имени
+	display := name
+	if n := prx.names; n != nil {
+		name, _ = n.original(display, srv.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(prx.global.maxTimeoutInt64)*time.Second)
+	defer cancel()
+
+	request := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params": map[string]any{
+			"output": []string{r.cacheType + "id", nameField},
+			"filter": map[string]any{nameField: name},
+		},
+		"auth": srv.Token,
+		"id":   1,
+	}
+
+	response, err := prx.zbxClient.SendToZabbix(ctx, srv.URL, srv.IgnoreSSL, request)
+	if err != nil {
+		logger.Global.Warningf("[%s] Server[%d]: re-resolve %s '%s' failed: %v", trace_id, srv.ID, r.cacheType, name, err)
+		return
+	}
+
+	items, _ := response["result"].([]any)
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok || m[nameField] != name {
+			continue
+		}
+		if originalID, ok := toIntID(m[r.cacheType+"id"]); ok {
+			prx.cache.CacheType[r.cacheType].Set(r.proxyID, originalID, srv.ID, display)
+			prx.negativeIDs.forget(r.cacheType, r.proxyID, srv.ID)
+			logger.Global.Infof("[%s] Server[%d]: %s '%s' re-resolved, ProxyID %d -> OriginalID %d", trace_id, srv.ID, r.cacheType, name, r.proxyID, originalID)
+			return
+		}
+	}
+	logger.Global.Infof("[%s] Server[%d]: %s '%s' not found on re-resolve", trace_id, srv.ID, r.cacheType, name)
+}
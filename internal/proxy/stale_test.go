@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMissingResolvedIDs тестирует поиск запрошенных по ProxyID сущностей, отсутствующих в ответе
+func TestMissingResolvedIDs(t *testing.T) {
+	resolved := []resolvedID{
+		{cacheType: "host", proxyID: 100, originalID: 10084},
+		{cacheType: "host", proxyID: 200, originalID: 10085},
+		{cacheType: "group", proxyID: 300, originalID: 5},
+	}
+	result := []any{map[string]any{"hostid": "10084", "name": "HostA"}}
+	params := map[string]any{"hostids": []any{"100", "200"}, "output": "extend", "selectInterfaces": "extend"}
+
+	missing := missingResolvedIDs("host.get", params, result, resolved)
+	assert.Equal(t, []resolvedID{{cacheType: "host", proxyID: 200, originalID: 10085}}, missing)
+
+	// Для методов других сущностей пустой ответ не означает устаревший маппинг
+	assert.Empty(t, missingResolvedIDs("item.get", params, []any{}, resolved))
+
+	// Сущность могла быть исключена фильтром, поиском, limit или флагами выборки
+	for _, key := range []string{"filter", "search", "limit", "monitored_hosts", "templated_hosts", "groupids", "editable"} {
+		narrowed := map[string]any{"hostids": []any{"100", "200"}, key: true}
+		assert.Empty(t, missingResolvedIDs("host.get", narrowed, result, resolved), key)
+	}
+}
+
+// TestNotFoundResolvedIDs тестирует выбор маппингов по ошибке отсутствия сущности
+func TestNotFoundResolvedIDs(t *testing.T) {
+	resolved := []resolvedID{
+		{cacheType: "host", proxyID: 100, originalID: 10084},
+		{cacheType: "host", proxyID: 200, originalID: 10085},
+		{cacheType: "group", proxyID: 300, originalID: 10084},
+	}
+
+	notFound := &zabbix.APIError{Code: -32602, Message: "Invalid params.", Data: `Host with ID "10084" does not exist.`}
+	assert.Equal(t, []resolvedID{{cacheType: "host", proxyID: 100, originalID: 10084}}, notFoundResolvedIDs(notFound, resolved))
+
+	groupNotFound := &zabbix.APIError{Code: -32602, Message: "Invalid params.", Data: `Host group with ID "10084" does not exist.`}
+	assert.Equal(t, []resolvedID{{cacheType: "group", proxyID: 300, originalID: 10084}}, notFoundResolvedIDs(groupNotFound, resolved))
+
+	// Ошибка прав и транспортные ошибки не означают отсутствие сущности
+	noPermissions := &zabbix.APIError{Code: -32500, Message: "Application error.", Data: "No permissions to referred object or it does not exist!"}
+	assert.Empty(t, notFoundResolvedIDs(noPermissions, resolved))
+	assert.Empty(t, notFoundResolvedIDs(errors.New("HTTP 404: Not Found"), resolved))
+}
+
+// TestEvictStaleMappings тестирует удаление устаревшего маппинга и повторный поиск по имени
+func TestEvictStaleMappings(t *testing.T) {
+	g := Global{MaxRequests: 10, ReresolveStale: true}
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{ID: 1, URL: "http://server1"}}}
+	prx := InitProxy(g, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+
+	done := make(chan struct{}, 1)
+	originalClient := prx.zbxClient
+	prx.zbxClient = &MockZabbixClient{
+		SendFunc: func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+			defer func() { done <- struct{}{} }()
+			params := request["params"].(map[string]any)
+			assert.Equal(t, map[string]any{"name": "HostA"}, params["filter"])
+			return map[string]any{"result": []any{map[string]any{"hostid": "20001", "name": "HostA"}}}, nil
+		},
+	}
+	defer func() { prx.zbxClient = originalClient }()
+
+	hosts := prx.cache.CacheType["host"]
+	hosts.Set(100, 10084, 1, "HostA")
+
+	prx.evictStaleMappings(z.Servers[0], []resolvedID{{cacheType: "host", proxyID: 100, originalID: 10084}}, "test-stale")
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("re-resolve request was not sent")
+	}
+
+	assert.Eventually(t, func() bool {
+		originalID, found := hosts.GetOriginalID(100, 1)
+		return found && originalID == 20001
+	}, time.Second, 10*time.Millisecond, "mapping should be re-resolved to the new OriginalID")
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"sync"
+	"time"
+
+	"github.com/a3ak/suffix"
+)
+
+const (
+	// Пауза после HTTP 429 без Retry-After
+	defaultRetryAfter = 5 * time.Second
+	// Наибольшая пауза, которую может запросить сервер
+	defaultMaxRetryAfter = 5 * time.Minute
+)
+
+// RetryAfterConf пауза в запросах к серверу, ограничившему частоту (HTTP 429 или 503 с Retry-After)
+type RetryAfterConf struct {
+	Default string `yaml:"default"` // Пауза без заголовка Retry-After, по умолчанию 5s
+	Max     string `yaml:"max"`     // Ограничение паузы из Retry-After, по умолчанию 5m
+}
+
+// upstreamThrottle серверы (и реплики), ограничившие частоту запросов proxy, по имени
+// Circuit Breaker. До истечения паузы запросы на них не отправляются. Ограничение
+// частоты - не неисправность, поэтому Circuit Breaker его не учитывает
+type upstreamThrottle struct {
+	mu         sync.Mutex
+	until      map[string]time.Time
+	defaultDur time.Duration
+	maxDur     time.Duration
+	now        func() time.Time
+}
+
+func newUpstreamThrottle(conf RetryAfterConf) *upstreamThrottle {
+	duration := func(name, value string, def time.Duration) time.Duration {
+		if value == "" {
+			return def
+		}
+		s, err := suffix.ToSeconds(value)
+		if err != nil || s <= 0 {
+			logger.Global.Errorf("convert error 'retry_after.%s' to seconds: %v, using %v", name, err, def)
+			return def
+		}
+		return time.Duration(s) * time.Second
+	}
+	return &upstreamThrottle{
+		until:      make(map[string]time.Time),
+		defaultDur: duration("default", conf.Default, defaultRetryAfter),
+		maxDur:     duration("max", conf.Max, defaultMaxRetryAfter),
+		now:        time.Now,
+	}
+}
+
+// backoff откладывает запросы к серверу name на паузу из Retry-After и возвращает ее
+func (t *upstreamThrottle) backoff(name string, retryAfter time.Duration) time.Duration {
+	d := retryAfter
+	if d <= 0 {
+		d = t.defaultDur
+	}
+	d = min(d, t.maxDur)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until := t.now().Add(d)
+	if until.After(t.until[name]) {
+		t.until[name] = until
+	}
+	return d
+}
+
+// throttled возвращает оставшуюся паузу сервера name
+func (t *upstreamThrottle) throttled(name string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.until[name]
+	if !ok {
+		return 0, false
+	}
+	left := until.Sub(t.now())
+	if left <= 0 {
+		delete(t.until, name)
+		return 0, false
+	}
+	return left, true
+}
+
+// remaining возвращает оставшиеся паузы серверов
+func (t *upstreamThrottle) remaining() map[string]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	result := make(map[string]time.Duration, len(t.until))
+	for name, until := range t.until {
+		if left := until.Sub(now); left > 0 {
+			result[name] = left
+		} else {
+			delete(t.until, name)
+		}
+	}
+	return result
+}
+
+// serverThrottled проверяет паузу сервера. Для сервера с репликами
+// проверка выполняется при выборе реплики
+func (prx *Proxy) serverThrottled(srv zabbix.ZabbixServer) (time.Duration, bool) {
+	if prx.throttle == nil || prx.balancers[srv.ID] != nil {
+		return 0, false
+	}
+	return prx.throttle.throttled(srv.Name)
+}
+
+// replicaAvailable проверяет, что Circuit Breaker реплики пропускает запрос и у нее нет паузы
+func (prx *Proxy) replicaAvailable(name string) bool {
+	if ok, _ := prx.cb.AllowRequest(name); !ok {
+		return false
+	}
+	if prx.throttle != nil {
+		if _, throttled := prx.throttle.throttled(name); throttled {
+			return false
+		}
+	}
+	return true
+}
+
+// GetThrottleStats возвращает оставшиеся паузы серверов, ограничивших частоту запросов,
+// по имени сервера (реплики)
+func (prx *Proxy) GetThrottleStats() map[string]time.Duration {
+	if prx.throttle == nil {
+		return nil
+	}
+	return prx.throttle.remaining()
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUpstreamThrottle тестирует паузы серверов после HTTP 429
+func TestUpstreamThrottle(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	th := newUpstreamThrottle(RetryAfterConf{Default: "10s", Max: "1m"})
+	th.now = func() time.Time { return now }
+
+	_, ok := th.throttled("web1")
+	assert.False(t, ok)
+
+	assert.Equal(t, 10*time.Second, th.backoff("web1", 0), "without Retry-After the default pause is used")
+	assert.Equal(t, time.Minute, th.backoff("web2", time.Hour), "pause is capped by max")
+
+	// Более короткая пауза не сокращает текущую
+	th.backoff("web2", time.Second)
+	left, ok := th.throttled("web2")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, left)
+
+	now = now.Add(15 * time.Second)
+	_, ok = th.throttled("web1")
+	assert.False(t, ok)
+	assert.Equal(t, map[string]time.Duration{"web2": 45 * time.Second}, th.remaining())
+}
+
+// TestProcessAllServers_Throttled тестирует пропуск сервера, ограничившего частоту запросов
+func TestProcessAllServers_Throttled(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	mockClient := testProxy.GetMockClient()
+	mockClient.SendFunc = func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[url]++
+		if url == "http://server2.com" {
+			return nil, &zabbix.ThrottledError{StatusCode: 429, RetryAfter: 30 * time.Second, Detail: "HTTP 429: Too Many Requests"}
+		}
+		return map[string]any{"result": []any{}}, nil
+	}
+	prx := testProxy.Init(Global{MaxRequests: 5}, routingServers(), CBConf{FailureThreshold: 1, RecoveryTimeout: time.Hour}, CacheConf(initTestCache()), ExcludeMethods{})
+	server2 := prx.config.Servers[1]
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1, "params": map[string]any{}}
+	_, errors := testProxy.processAllServersWithMock(context.Background(), request, "test-throttle")
+	require.Len(t, errors, 1)
+
+	// Ограничение частоты не открывает Circuit Breaker, но запросы к серверу откладываются
+	assert.True(t, prx.serverAllowed(server2))
+	pause, ok := prx.serverThrottled(server2)
+	require.True(t, ok)
+	assert.InDelta(t, 30*time.Second, pause, float64(time.Second))
+	assert.Contains(t, prx.GetThrottleStats(), server2.Name)
+
+	_, errors = testProxy.processAllServersWithMock(context.Background(), request, "test-throttle-skip")
+	require.Len(t, errors, 1)
+	assert.Contains(t, errors[0], "throttled")
+	assert.Equal(t, 1, calls["http://server2.com"])
+	assert.Equal(t, 2, calls["http://server1.com"])
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Допустимое имя выпускаемого токена API
+var tokenNameRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// managedToken токен API, выпущенный через /admin/tokens. Сам токен не хранится,
+// только его SHA-256: токен показывается один раз при выпуске
+type managedToken struct {
+	Name      string    `json:"name"`
+	Hash      string    `json:"sha256"`
+	ReadOnly  bool      `json:"read_only"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// tokenStore токены API, которыми управляет администратор без правки конфига
+// (веб-интерфейс /admin/ui). Хранятся в файле tokens_file
+type tokenStore struct {
+	path string
+
+	mu     sync.RWMutex
+	tokens map[string]managedToken // SHA-256 токена -> токен
+}
+
+// newTokenStore загружает выпущенные токены или возвращает nil, если tokens_file не задан
+func newTokenStore(path string) *tokenStore {
+	if path == "" {
+		return nil
+	}
+	s := &tokenStore{path: path, tokens: make(map[string]managedToken)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Global.Errorf("Failed to read tokens file %s: %v", path, err)
+		}
+		return s
+	}
+	var tokens []managedToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		logger.Global.Errorf("Invalid tokens file %s: %v", path, err)
+		return s
+	}
+	for _, t := range tokens {
+		s.tokens[t.Hash] = t
+	}
+	return s
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// principal возвращает клиента выпущенного токена или nil, если токен не выпускался.
+// Токен с read_only получает только методы *.get и apiinfo.*
+func (s *tokenStore) principal(token string) *authPrincipal {
+	if s == nil || token == "" {
+		return nil
+	}
+	s.mu.RLock()
+	t, ok := s.tokens[tokenHash(token)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	p := &authPrincipal{name: t.Name}
+	if t.ReadOnly {
+		p.methods = readOnlyMethods
+	}
+	return p
+}
+
+// create выпускает токен с именем name и возвращает его
+func (s *tokenStore) create(name string, readOnly bool) (string, error) {
+	if !tokenNameRe.MatchString(name) {
+		return "", fmt.Errorf("invalid token name '%s': 1-64 letters, digits, '.', '_' or '-'", name)
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if t.Name == name {
+			return "", fmt.Errorf("token '%s' already exists", name)
+		}
+	}
+	hash := tokenHash(token)
+	s.tokens[hash] = managedToken{Name: name, Hash: hash, ReadOnly: readOnly, CreatedAt: time.Now().UTC()}
+	if err := s.save(); err != nil {
+		delete(s.tokens, hash)
+		return "", err
+	}
+	return token, nil
+}
+
+// revoke отзывает токен с именем name. false, если такого токена нет
+func (s *tokenStore) revoke(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.tokens {
+		if t.Name != name {
+			continue
+		}
+		delete(s.tokens, hash)
+		if err := s.save(); err != nil {
+			s.tokens[hash] = t
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// list возвращает выпущенные токены без их хешей, по имени
+func (s *tokenStore) list() []map[string]any {
+	s.mu.RLock()
+	tokens := make([]managedToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(tokens, func(a, b managedToken) int { return strings.Compare(a.Name, b.Name) })
+	list := make([]map[string]any, 0, len(tokens))
+	for _, t := range tokens {
+		list = append(list, map[string]any{"name": t.Name, "read_only": t.ReadOnly, "created_at": t.CreatedAt})
+	}
+	return list
+}
+
+// save записывает токены в файл через временный файл. Вызывается под s.mu
+func (s *tokenStore) save() error {
+	tokens := make([]managedToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+	slices.SortFunc(tokens, func(a, b managedToken) int { return strings.Compare(a.Name, b.Name) })
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write tokens file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write tokens file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write tokens file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("write tokens file: %w", err)
+	}
+	return nil
+}
+
+// AdminTokensHandler обрабатывает /admin/tokens: GET - список выпущенных токенов API,
+// POST ?action=create&name=ci&read_only=true - выпуск токена (показывается один раз),
+// POST ?action=revoke&name=ci - отзыв токена
+func (prx *Proxy) AdminTokensHandler(w http.ResponseWriter, r *http.Request) {
+	store := prx.tokens
+	if store == nil {
+		writeAdminResponse(w, http.StatusNotFound, map[string]any{"status": "error", "error": "token management is disabled (tokens_file is not set)"})
+		return
+	}
+	if r.Method == http.MethodGet {
+		writeAdminResponse(w, http.StatusOK, map[string]any{"status": "OK", "tokens": store.list()})
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	switch action := r.URL.Query().Get("action"); action {
+	case "create":
+		readOnly := r.URL.Query().Get("read_only") == "true"
+		token, err := store.create(name, readOnly)
+		if err != nil {
+			writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": err.Error()})
+			return
+		}
+		logger.Global.Infof("API token '%s' created on admin request (read_only=%t)", name, readOnly)
+		writeAdminResponse(w, http.StatusOK, map[string]any{"status": "OK", "name": name, "read_only": readOnly, "token": token})
+	case "revoke":
+		revoked, err := store.revoke(name)
+		if err != nil {
+			writeAdminResponse(w, http.StatusInternalServerError, map[string]any{"status": "error", "error": err.Error()})
+			return
+		}
+		if !revoked {
+			writeAdminResponse(w, http.StatusNotFound, map[string]any{"status": "error", "error": "unknown token: " + name})
+			return
+		}
+		logger.Global.Infof("API token '%s' revoked on admin request", name)
+		writeAdminResponse(w, http.StatusOK, map[string]any{"status": "OK", "name": name})
+	default:
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": fmt.Sprintf("unknown action '%s', expected create or revoke", action)})
+	}
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTokenStore тестирует выпуск, отзыв и хранение токенов API
+func TestTokenStore(t *testing.T) {
+	assert.Nil(t, newTokenStore(""))
+	assert.Nil(t, (*tokenStore)(nil).principal("x"))
+
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s := newTokenStore(path)
+	require.NotNil(t, s)
+
+	ci, err := s.create("ci", false)
+	require.NoError(t, err)
+	grafana, err := s.create("grafana", true)
+	require.NoError(t, err)
+	assert.NotEqual(t, ci, grafana)
+
+	_, err = s.create("ci", true)
+	assert.Error(t, err, "duplicate name")
+	_, err = s.create("bad name", false)
+	assert.Error(t, err, "invalid name")
+
+	assert.Equal(t, &authPrincipal{name: "ci"}, s.principal(ci))
+	assert.Equal(t, &authPrincipal{name: "grafana", methods: readOnlyMethods}, s.principal(grafana))
+	assert.Nil(t, s.principal("unknown"))
+
+	// В файле хранятся только хеши токенов
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), ci)
+	assert.Contains(t, string(data), tokenHash(ci))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Токены переживают перезапуск
+	s = newTokenStore(path)
+	assert.Equal(t, &authPrincipal{name: "ci"}, s.principal(ci))
+
+	revoked, err := s.revoke("ci")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = s.revoke("ci")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	assert.Nil(t, newTokenStore(path).principal(ci))
+
+	list := s.list()
+	require.Len(t, list, 1)
+	assert.Equal(t, "grafana", list[0]["name"])
+	assert.Equal(t, true, list[0]["read_only"])
+}
+
+// TestAdminTokensHandler тестирует управление токенами через /admin/tokens
+// и доступ к API по выпущенному токену
+func TestAdminTokensHandler(t *testing.T) {
+	g := Global{MaxRequests: 5, MaxTimeout: "5s", TokensFile: filepath.Join(t.TempDir(), "tokens.json")}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.global.maxReqBodySizeInt64 = 1000
+	prx.authLock = nil
+	prx.zbxClient = &concurrentClient{send: func(ctx context.Context, url string) (map[string]any, error) {
+		return map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": 1}, nil
+	}}
+
+	admin := prx.AdminReadMiddleware(prx.AdminTokensHandler, "", "", "admin-token")
+	sendAdmin := func(method, query string) (int, map[string]any) {
+		req := httptest.NewRequest(method, "/admin/tokens"+query, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	code, body := sendAdmin("POST", "?action=create&name=grafana&read_only=true")
+	require.Equal(t, http.StatusOK, code)
+	token, _ := body["token"].(string)
+	require.NotEmpty(t, token)
+
+	code, body = sendAdmin("GET", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, body, "token")
+	assert.Len(t, body["tokens"], 1)
+
+	code, _ = sendAdmin("POST", "?action=create&name=grafana")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = sendAdmin("POST", "?action=rotate&name=grafana")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	middleware := prx.AuthMiddleware(prx.Handler, "/metrics", "", "", "")
+	send := func(bearer, method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"`+method+`","params":{},"id":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		middleware.ServeHTTP(w, req)
+		return w
+	}
+
+	// С tokens_file API требует выпущенный токен, токен только для чтения не изменяет данные
+	assert.Contains(t, send(token, "host.get").Body.String(), `"result":[]`)
+	assert.Contains(t, send(token, "host.update").Body.String(), "is not permitted for client 'grafana'")
+	assert.Equal(t, http.StatusUnauthorized, send("", "host.get").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("wrong", "host.get").Code)
+
+	// Выпущенный токен не дает доступа к /admin/*
+	req := httptest.NewRequest("GET", "/admin/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	code, _ = sendAdmin("POST", "?action=revoke&name=grafana")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = sendAdmin("POST", "?action=revoke&name=grafana")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, http.StatusUnauthorized, send(token, "host.get").Code)
+
+	// Без tokens_file управление токенами отключено
+	prx.tokens = nil
+	code, _ = sendAdmin("GET", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
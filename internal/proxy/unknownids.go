@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"context"
+	"net/http"
+)
+
+const (
+	// Заголовок, переопределяющий unknown_ids для запроса
+	unknownIDsHeader = "X-Proxy-Unknown-IDs"
+	// для хранения поведения запроса с неизвестными ID
+	unknownIDsKey ctxKey = "unknown_ids"
+
+	unknownIDsError = "error" // Ошибка "no target servers" (по умолчанию)
+	unknownIDsEmpty = "empty" // Пустой результат, как у Zabbix для несуществующих ID
+)
+
+// checkUnknownIDs проверяет значение unknown_ids
+func checkUnknownIDs(mode string) string {
+	switch mode {
+	case "", unknownIDsError:
+		return unknownIDsError
+	case unknownIDsEmpty:
+		return mode
+	}
+	logger.Global.Errorf("invalid 'unknown_ids' %s, using %s", mode, unknownIDsError)
+	return unknownIDsError
+}
+
+// withUnknownIDs сохраняет в контексте поведение, заданное клиентом заголовком
+// X-Proxy-Unknown-IDs. Неверное значение заголовка игнорируется
+func withUnknownIDs(ctx context.Context, r *http.Request) (context.Context, bool) {
+	switch mode := r.Header.Get(unknownIDsHeader); mode {
+	case unknownIDsError, unknownIDsEmpty:
+		return context.WithValue(ctx, unknownIDsKey, mode), true
+	}
+	return ctx, false
+}
+
+// unknownIDsResult сообщает, что запрос по ID, не относящимся ни к одному серверу
+// (например устаревшая переменная Grafana), возвращает пустой результат, а не ошибку
+func (prx *Proxy) unknownIDsResult(ctx context.Context) bool {
+	if mode, ok := ctx.Value(unknownIDsKey).(string); ok {
+		return mode == unknownIDsEmpty
+	}
+	return prx.global.UnknownIDs == unknownIDsEmpty
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCheckUnknownIDs тестирует проверку значения unknown_ids
+func TestCheckUnknownIDs(t *testing.T) {
+	assert.Equal(t, unknownIDsError, checkUnknownIDs(""))
+	assert.Equal(t, unknownIDsEmpty, checkUnknownIDs("empty"))
+	assert.Equal(t, unknownIDsError, checkUnknownIDs("ignore"))
+}
+
+// TestProcessAllServers_UnknownIDs тестирует ответ на запрос по ID, не относящимся
+// ни к одному серверу
+func TestProcessAllServers_UnknownIDs(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+
+	prx := testProxy.Init(Global{MaxRequests: 5}, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+
+	// ID сервера 9, которого нет в конфиге
+	request := func() map[string]any {
+		return map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1,
+			"params": map[string]any{"hostids": []any{"10849"}}}
+	}
+	withHeader := func(value string) context.Context {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set(unknownIDsHeader, value)
+		ctx, _ := withUnknownIDs(context.Background(), r)
+		return ctx
+	}
+
+	// По умолчанию - ошибка
+	results, errors := testProxy.processAllServersWithMock(context.Background(), request(), "test-unknown-1")
+	assert.Nil(t, results)
+	require.Len(t, errors, 1)
+
+	// Заголовок запроса
+	results, errors = testProxy.processAllServersWithMock(withHeader("empty"), request(), "test-unknown-2")
+	assert.Equal(t, []any{}, results)
+	assert.Empty(t, errors)
+
+	// Настройка и ее переопределение заголовком
+	prx.global.UnknownIDs = unknownIDsEmpty
+	results, errors = testProxy.processAllServersWithMock(context.Background(), request(), "test-unknown-3")
+	assert.Equal(t, []any{}, results)
+	assert.Empty(t, errors)
+
+	_, errors = testProxy.processAllServersWithMock(withHeader("error"), request(), "test-unknown-4")
+	assert.Len(t, errors, 1)
+	assert.Zero(t, testProxy.GetMockClient().CallCount)
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Статистика клиентов хранится поминутно за последний час
+	usageMinutes = 60
+	// Количество значений метки client в метриках, остальные клиенты учитываются как other
+	maxClientLabels = 50
+	otherClient     = "other"
+
+	defaultTopMinutes = 5
+	defaultTopLimit   = 10
+)
+
+// usageKey клиент и метод запроса
+type usageKey struct {
+	client string
+	method string
+}
+
+// usageStat запросы клиента к методу
+type usageStat struct {
+	requests int
+	errors   int
+	duration time.Duration
+}
+
+// usageBucket статистика за минуту
+type usageBucket struct {
+	minute int64
+	stats  map[usageKey]*usageStat
+}
+
+// clientUsage учитывает запросы клиентов для GET /admin/top и ограничивает
+// количество значений метки client в метриках
+type clientUsage struct {
+	mu      sync.Mutex
+	buckets [usageMinutes]usageBucket
+	// Клиенты, получившие собственное значение метки
+	labels map[string]bool
+}
+
+func newClientUsage() *clientUsage {
+	return &clientUsage{labels: make(map[string]bool)}
+}
+
+// clientName возвращает имя клиента для метрик и статистики. Токены не раскрываются:
+// вместо токена используется начало его хеша
+func clientName(client string) string {
+	kind, value, _ := strings.Cut(client, ":")
+	switch kind {
+	case "":
+		return "unknown"
+	case "principal":
+		return value
+	case "token":
+		sum := sha256.Sum256([]byte(value))
+		return "token:" + hex.EncodeToString(sum[:4])
+	default:
+		return client
+	}
+}
+
+// label возвращает значение метки client для клиента запроса. Первые maxClientLabels
+// клиентов получают собственное значение, остальные - other
+func (u *clientUsage) label(client string) string {
+	name := clientName(client)
+	if u == nil {
+		return name
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.labels[name] {
+		return name
+	}
+	if len(u.labels) >= maxClientLabels {
+		return otherClient
+	}
+	u.labels[name] = true
+	return name
+}
+
+// add учитывает завершенный запрос клиента
+func (u *clientUsage) add(name, method string, failed bool, duration time.Duration) {
+	if u == nil {
+		return
+	}
+	minute := time.Now().Unix() / 60
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	b := &u.buckets[minute%usageMinutes]
+	if b.minute != minute || b.stats == nil {
+		*b = usageBucket{minute: minute, stats: make(map[usageKey]*usageStat)}
+	}
+	key := usageKey{client: name, method: method}
+	st, ok := b.stats[key]
+	if !ok {
+		st = &usageStat{}
+		b.stats[key] = st
+	}
+	st.requests++
+	if failed {
+		st.errors++
+	}
+	st.duration += duration
+}
+
+// TopEntry клиент или метод в ответе /admin/top
+type TopEntry struct {
+	Name     string `json:"name"`
+	Requests int    `json:"requests"`
+	Errors   int    `json:"errors"`
+	// Суммарное и среднее время обработки запросов
+	TotalMs float64 `json:"total_ms"`
+	AvgMs   float64 `json:"avg_ms"`
+	// Самый нагружающий метод клиента или клиент метода
+	Top string `json:"top"`
+}
+
+// top возвращает самых нагружающих клиентов и методы за последние minutes минут.
+// byRequests - сортировка по количеству запросов, иначе по суммарному времени
+func (u *clientUsage) top(minutes, limit int, byRequests bool) (clients, methods []TopEntry) {
+	if u == nil {
+		return nil, nil
+	}
+	now := time.Now().Unix() / 60
+	totals := make(map[usageKey]usageStat)
+	u.mu.Lock()
+	for _, b := range u.buckets {
+		if b.minute <= now-int64(minutes) || b.minute > now {
+			continue
+		}
+		for key, st := range b.stats {
+			t := totals[key]
+			t.requests += st.requests
+			t.errors += st.errors
+			t.duration += st.duration
+			totals[key] = t
+		}
+	}
+	u.mu.Unlock()
+
+	clients = aggregateUsage(totals, func(k usageKey) (string, string) { return k.client, k.method }, limit, byRequests)
+	methods = aggregateUsage(totals, func(k usageKey) (string, string) { return k.method, k.client }, limit, byRequests)
+	return clients, methods
+}
+
+// aggregateUsage суммирует статистику по имени из group и возвращает limit самых нагружающих.
+// Для каждого имени указывается самое нагружающее второе измерение
+func aggregateUsage(totals map[usageKey]usageStat, group func(usageKey) (string, string), limit int, byRequests bool) []TopEntry {
+	// Сравнение нагрузки: по запросам или по времени
+	heavier := func(a, b usageStat) int {
+		if byRequests {
+			return cmp.Or(cmp.Compare(a.requests, b.requests), cmp.Compare(a.duration, b.duration))
+		}
+		return cmp.Or(cmp.Compare(a.duration, b.duration), cmp.Compare(a.requests, b.requests))
+	}
+
+	sums := make(map[string]usageStat)
+	top := make(map[string]string)
+	topStat := make(map[string]usageStat)
+	for key, st := range totals {
+		name, other := group(key)
+		s := sums[name]
+		s.requests += st.requests
+		s.errors += st.errors
+		s.duration += st.duration
+		sums[name] = s
+		if c := heavier(st, topStat[name]); c > 0 || (c == 0 && other < top[name]) {
+			top[name], topStat[name] = other, st
+		}
+	}
+
+	entries := make([]TopEntry, 0, len(sums))
+	for name, s := range sums {
+		e := TopEntry{
+			Name:     name,
+			Requests: s.requests,
+			Errors:   s.errors,
+			TotalMs:  durationMs(s.duration),
+			Top:      top[name],
+		}
+		if s.requests > 0 {
+			e.AvgMs = durationMs(s.duration / time.Duration(s.requests))
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b TopEntry) int {
+		sa, sb := sums[a.Name], sums[b.Name]
+		return cmp.Or(heavier(sb, sa), strings.Compare(a.Name, b.Name))
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// AdminTopHandler обрабатывает GET /admin/top?minutes=5&limit=10&sort=time|requests и возвращает
+// самых нагружающих клиентов и методы за последние minutes минут (не более часа)
+func (prx *Proxy) AdminTopHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	minutes, err := queryInt(query.Get("minutes"), defaultTopMinutes, usageMinutes)
+	if err != nil {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": "invalid minutes: " + err.Error()})
+		return
+	}
+	limit, err := queryInt(query.Get("limit"), defaultTopLimit, 0)
+	if err != nil {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": "invalid limit: " + err.Error()})
+		return
+	}
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = "time"
+	}
+	if sortBy != "time" && sortBy != "requests" {
+		writeAdminResponse(w, http.StatusBadRequest, map[string]any{"status": "error", "error": "invalid sort: " + sortBy + ", expected time or requests"})
+		return
+	}
+
+	clients, methods := prx.usage.top(minutes, limit, sortBy == "requests")
+	writeAdminResponse(w, http.StatusOK, map[string]any{
+		"status":  "OK",
+		"minutes": minutes,
+		"sort":    sortBy,
+		"clients": clients,
+		"methods": methods,
+	})
+}
+
+// queryInt разбирает положительное число параметра запроса. Пустое значение - def,
+// max > 0 ограничивает значение сверху
+func queryInt(value string, def, max int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, strconv.ErrRange
+	}
+	if max > 0 && n > max {
+		n = max
+	}
+	return n, nil
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClientName тестирует имена клиентов для метрик: токены не раскрываются
+func TestClientName(t *testing.T) {
+	assert.Equal(t, "grafana", clientName("principal:grafana"))
+	assert.Equal(t, "login:admin", clientName("login:admin"))
+	assert.Equal(t, "addr:10.0.0.1", clientName("addr:10.0.0.1"))
+	assert.Equal(t, "unknown", clientName(""))
+
+	name := clientName("token:secret-token")
+	assert.True(t, strings.HasPrefix(name, "token:"))
+	assert.NotContains(t, name, "secret")
+	assert.Equal(t, name, clientName("token:secret-token"))
+	assert.NotEqual(t, name, clientName("token:other-token"))
+}
+
+// TestClientUsage_Label тестирует ограничение количества значений метки client
+func TestClientUsage_Label(t *testing.T) {
+	u := newClientUsage()
+	for i := 0; i < maxClientLabels; i++ {
+		assert.Equal(t, fmt.Sprintf("login:user%d", i), u.label(fmt.Sprintf("login:user%d", i)))
+	}
+	assert.Equal(t, otherClient, u.label("login:extra"))
+	// Известные клиенты сохраняют свое значение
+	assert.Equal(t, "login:user0", u.label("login:user0"))
+
+	var nilUsage *clientUsage
+	assert.Equal(t, "login:extra", nilUsage.label("login:extra"))
+}
+
+// TestClientUsage_Top тестирует выбор самых нагружающих клиентов и методов
+func TestClientUsage_Top(t *testing.T) {
+	u := newClientUsage()
+	for i := 0; i < 5; i++ {
+		u.add("dashboard", "item.get", false, 10*time.Millisecond)
+	}
+	u.add("dashboard", "history.get", true, 100*time.Millisecond)
+	u.add("script", "history.get", false, 500*time.Millisecond)
+
+	// По времени: script (500ms) тяжелее dashboard (150ms)
+	clients, methods := u.top(5, 10, false)
+	require.Len(t, clients, 2)
+	assert.Equal(t, "script", clients[0].Name)
+	assert.Equal(t, TopEntry{Name: "dashboard", Requests: 6, Errors: 1, TotalMs: 150, AvgMs: 25, Top: "history.get"}, clients[1])
+	require.Len(t, methods, 2)
+	assert.Equal(t, TopEntry{Name: "history.get", Requests: 2, Errors: 1, TotalMs: 600, AvgMs: 300, Top: "script"}, methods[0])
+
+	// По количеству запросов и с ограничением количества
+	clients, methods = u.top(5, 1, true)
+	require.Len(t, clients, 1)
+	assert.Equal(t, "dashboard", clients[0].Name)
+	assert.Equal(t, "item.get", clients[0].Top)
+	require.Len(t, methods, 1)
+	assert.Equal(t, "item.get", methods[0].Name)
+
+	// Статистика старше окна не учитывается
+	stale := time.Now().Unix()/60 + 1 - 2*usageMinutes
+	u.buckets[stale%usageMinutes] = usageBucket{minute: stale, stats: map[usageKey]*usageStat{{"old", "host.get"}: {requests: 100}}}
+	clients, _ = u.top(usageMinutes, 10, true)
+	assert.Len(t, clients, 2)
+}
+
+// TestAdminTopHandler тестирует эндпоинт GET /admin/top
+func TestAdminTopHandler(t *testing.T) {
+	prx := &Proxy{usage: newClientUsage()}
+	prx.usage.add("dashboard", "item.get", false, 20*time.Millisecond)
+	handler := prx.AdminReadMiddleware(prx.AdminTopHandler, "", "", "admin-token")
+
+	tests := []struct {
+		name           string
+		method         string
+		query          string
+		expectedStatus int
+	}{
+		{name: "get", method: http.MethodGet, expectedStatus: http.StatusOK},
+		{name: "post", method: http.MethodPost, query: "?minutes=60&limit=5&sort=requests", expectedStatus: http.StatusOK},
+		{name: "invalid minutes", method: http.MethodGet, query: "?minutes=abc", expectedStatus: http.StatusBadRequest},
+		{name: "invalid limit", method: http.MethodGet, query: "?limit=0", expectedStatus: http.StatusBadRequest},
+		{name: "invalid sort", method: http.MethodGet, query: "?sort=size", expectedStatus: http.StatusBadRequest},
+		{name: "method not allowed", method: http.MethodDelete, expectedStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/top"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer admin-token")
+			w := httptest.NewRecorder()
+			handler(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var body map[string]any
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			clients := body["clients"].([]any)
+			require.Len(t, clients, 1)
+			assert.Equal(t, "dashboard", clients[0].(map[string]any)["name"])
+			assert.Equal(t, float64(1), clients[0].(map[string]any)["requests"])
+		})
+	}
+}
+
+// TestHandler_ClientUsage тестирует учет запросов клиента в статистике и метрике
+func TestHandler_ClientUsage(t *testing.T) {
+	testProxy := NewTestProxy(t)
+	defer testProxy.Cleanup()
+	z := ZabbixConf{Servers: []zabbix.ZabbixServer{{URL: "http://server1.com", ID: 1, Token: "token1"}}}
+	prx := testProxy.Init(Global{MaxRequests: 5}, z, CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	prx.zbxClient = testProxy.GetMockClient()
+	prx.SetMetrics(testProxy.metrics)
+
+	body := []byte(`{"jsonrpc":"2.0","method":"host.get","params":{},"id":1}`)
+	req := httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer client-token")
+	req = req.WithContext(context.WithValue(req.Context(), bodyKey, body))
+	w := httptest.NewRecorder()
+	prx.Handler(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	name := clientName("token:client-token")
+	assert.Equal(t, 2, testProxy.metrics.clientRequests[name], "method and all counters are labeled with the client")
+	clients, _ := prx.usage.top(1, 10, true)
+	require.Len(t, clients, 1)
+	assert.Equal(t, name, clients[0].Name)
+	assert.Equal(t, "host.get", clients[0].Top)
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+)
+
+// Значения Circuit Breaker по умолчанию (совпадают со значениями библиотеки circuitbreaker)
+const (
+	defaultFailureThreshold = 5
+	defaultSuccessThreshold = 3
+	defaultHalfOpenPrc      = 20
+	// Меньшее время восстановления - вероятно, число без единиц (recovery_timeout: 30 - это 30ns)
+	minRecoveryTimeout = time.Second
+)
+
+// ValidateServers проверяет список серверов конфига: ID в допустимом диапазоне
+// и не повторяются, URL корректны и не повторяются (с учетом реплик), токены заданы.
+// Повтор ID или URL незаметно портит маппинг ProxyID, поэтому запуск с такой
+// конфигурацией должен завершаться ошибкой. Возвращает все найденные ошибки
+func ValidateServers(cfg ZabbixConf) error {
+	var errs []error
+	ids := make(map[int]int)
+	urls := make(map[string]string)
+
+	// checkURL проверяет адрес сервера или реплики where
+	checkURL := func(where, raw string) {
+		// Frontend на том же узле: unix:///path/to/socket:/api_jsonrpc.php
+		if socket, path, ok := zabbix.ParseUnixURL(raw); ok {
+			if !strings.HasPrefix(socket, "/") {
+				errs = append(errs, fmt.Errorf("%s: invalid url '%s', expected unix:///path/to/socket:/api_jsonrpc.php", where, raw))
+				return
+			}
+			key := "unix:" + socket + strings.TrimSuffix(path, "/")
+			if prev, ok := urls[key]; ok {
+				errs = append(errs, fmt.Errorf("%s: url %s is already used by %s", where, raw, prev))
+				return
+			}
+			urls[key] = where
+			return
+		}
+
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s: invalid url '%s', expected http(s)://host/api_jsonrpc.php", where, raw))
+			return
+		}
+		key := strings.ToLower(u.Scheme+"://"+u.Host) + strings.TrimSuffix(u.Path, "/")
+		if prev, ok := urls[key]; ok {
+			errs = append(errs, fmt.Errorf("%s: url %s is already used by %s", where, raw, prev))
+			return
+		}
+		urls[key] = where
+	}
+
+	for i, s := range cfg.Servers {
+		where := fmt.Sprintf("server[%d]", i)
+		switch prev, ok := ids[s.ID]; {
+		case s.ID < minServerID || s.ID > maxServerID:
+			errs = append(errs, fmt.Errorf("%s: id must be between %d and %d, got %d", where, minServerID, maxServerID, s.ID))
+		case ok:
+			errs = append(errs, fmt.Errorf("%s: id %d is already used by server[%d], ids must be unique", where, s.ID, prev))
+		default:
+			ids[s.ID] = i
+		}
+
+		checkURL(where, s.URL)
+		for j, r := range s.Replicas {
+			checkURL(fmt.Sprintf("%s.replicas[%d]", where, j), r.URL)
+		}
+
+		if strings.TrimSpace(s.Token) == "" {
+			errs = append(errs, fmt.Errorf("%s: token is empty, set the Zabbix API token of %s", where, s.URL))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetDefaults устанавливает значения Circuit Breaker по умолчанию вместо
+// незаданных и предупреждает о некорректных значениях
+func (c *CBConf) SetDefaults() {
+	if c.FailureThreshold <= 0 {
+		if c.FailureThreshold < 0 {
+			logger.Global.Warningf("'circuit_breaker.failure_threshold' must be positive, got %d: using %d", c.FailureThreshold, defaultFailureThreshold)
+		}
+		c.FailureThreshold = defaultFailureThreshold
+	}
+	if c.SuccessThreshold <= 0 {
+		if c.SuccessThreshold < 0 {
+			logger.Global.Warningf("'circuit_breaker.success_threshold' must be positive, got %d: using %d", c.SuccessThreshold, defaultSuccessThreshold)
+		}
+		c.SuccessThreshold = defaultSuccessThreshold
+	}
+	switch {
+	case c.RecoveryTimeout == 0:
+		c.RecoveryTimeout = defaultRecoveryTimeout
+	case c.RecoveryTimeout < minRecoveryTimeout:
+		logger.Global.Warningf("'circuit_breaker.recovery_timeout' %v is too short (set units, e.g. 30s): using %v", c.RecoveryTimeout, defaultRecoveryTimeout)
+		c.RecoveryTimeout = defaultRecoveryTimeout
+	}
+	switch {
+	case c.HalfOpenPrc == 0:
+		c.HalfOpenPrc = defaultHalfOpenPrc
+	case c.HalfOpenPrc < 0 || c.HalfOpenPrc > 100:
+		logger.Global.Warningf("'circuit_breaker.half_open_prc' must be between 1 and 100, got %d: using %d", c.HalfOpenPrc, defaultHalfOpenPrc)
+		c.HalfOpenPrc = defaultHalfOpenPrc
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateServers тестирует проверку списка серверов конфига
+func TestValidateServers(t *testing.T) {
+	valid := ZabbixConf{Servers: []zabbix.ZabbixServer{
+		{ID: 1, URL: "https://zbx1.example.com/api_jsonrpc.php", Token: "t1"},
+		{ID: 2, URL: "https://zbx2.example.com/api_jsonrpc.php", Token: "t2", Replicas: []zabbix.ZabbixReplica{
+			{URL: "https://zbx2-b.example.com/api_jsonrpc.php"},
+		}},
+	}}
+	assert.NoError(t, ValidateServers(valid))
+	assert.NoError(t, ValidateServers(ZabbixConf{}))
+
+	tests := []struct {
+		name   string
+		server zabbix.ZabbixServer
+		err    string
+	}{
+		{"duplicate id", zabbix.ZabbixServer{ID: 1, URL: "https://zbx3.example.com", Token: "t"}, "server[2]: id 1 is already used by server[0]"},
+		{"id out of range", zabbix.ZabbixServer{ID: 10, URL: "https://zbx3.example.com", Token: "t"}, "server[2]: id must be between 1 and 9, got 10"},
+		{"zero id", zabbix.ZabbixServer{URL: "https://zbx3.example.com", Token: "t"}, "got 0"},
+		{"duplicate url", zabbix.ZabbixServer{ID: 3, URL: "https://ZBX1.example.com/api_jsonrpc.php/", Token: "t"}, "already used by server[0]"},
+		{"duplicate replica url", zabbix.ZabbixServer{ID: 3, URL: "https://zbx3.example.com", Token: "t", Replicas: []zabbix.ZabbixReplica{
+			{URL: "https://zbx2-b.example.com/api_jsonrpc.php"},
+		}}, "server[2].replicas[0]: url https://zbx2-b.example.com/api_jsonrpc.php is already used by server[1].replicas[0]"},
+		{"invalid url", zabbix.ZabbixServer{ID: 3, URL: "zbx3.example.com", Token: "t"}, "server[2]: invalid url 'zbx3.example.com'"},
+		{"empty token", zabbix.ZabbixServer{ID: 3, URL: "https://zbx3.example.com", Token: " "}, "server[2]: token is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ZabbixConf{Servers: append(append([]zabbix.ZabbixServer{}, valid.Servers...), tt.server)}
+			assert.ErrorContains(t, ValidateServers(cfg), tt.err)
+		})
+	}
+
+	// Frontend на том же узле через unix сокет
+	unix := zabbix.ZabbixServer{ID: 3, URL: "unix:///run/zabbix/frontend.sock:/api_jsonrpc.php", Token: "t3"}
+	assert.NoError(t, ValidateServers(ZabbixConf{Servers: append(append([]zabbix.ZabbixServer{}, valid.Servers...), unix)}))
+	unixDuplicate := zabbix.ZabbixServer{ID: 4, URL: "unix:///run/zabbix/frontend.sock:/api_jsonrpc.php/", Token: "t4"}
+	assert.ErrorContains(t, ValidateServers(ZabbixConf{Servers: []zabbix.ZabbixServer{unix, unixDuplicate}}), "server[1]: url unix:///run/zabbix/frontend.sock:/api_jsonrpc.php/ is already used by server[0]")
+	unixRelative := zabbix.ZabbixServer{ID: 3, URL: "unix://frontend.sock:/api_jsonrpc.php", Token: "t3"}
+	assert.ErrorContains(t, ValidateServers(ZabbixConf{Servers: []zabbix.ZabbixServer{unixRelative}}), "expected unix:///path/to/socket:/api_jsonrpc.php")
+
+	// Все ошибки возвращаются сразу
+	err := ValidateServers(ZabbixConf{Servers: []zabbix.ZabbixServer{{ID: 0, URL: "", Token: ""}}})
+	assert.ErrorContains(t, err, "id must be")
+	assert.ErrorContains(t, err, "invalid url")
+	assert.ErrorContains(t, err, "token is empty")
+}
+
+// TestCBConfSetDefaults тестирует значения Circuit Breaker по умолчанию
+func TestCBConfSetDefaults(t *testing.T) {
+	var c CBConf
+	c.SetDefaults()
+	assert.Equal(t, CBConf{FailureThreshold: 5, SuccessThreshold: 3, RecoveryTimeout: 30 * time.Second, HalfOpenPrc: 20}, c)
+
+	// Некорректные значения заменяются значениями по умолчанию
+	c = CBConf{FailureThreshold: -1, SuccessThreshold: -2, RecoveryTimeout: 30, HalfOpenPrc: 150}
+	c.SetDefaults()
+	assert.Equal(t, CBConf{FailureThreshold: 5, SuccessThreshold: 3, RecoveryTimeout: 30 * time.Second, HalfOpenPrc: 20}, c)
+
+	// Заданные значения сохраняются
+	c = CBConf{FailureThreshold: 1, SuccessThreshold: 1, RecoveryTimeout: time.Minute, HalfOpenPrc: 100}
+	c.SetDefaults()
+	assert.Equal(t, CBConf{FailureThreshold: 1, SuccessThreshold: 1, RecoveryTimeout: time.Minute, HalfOpenPrc: 100}, c)
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"ZabbixAPIproxy/internal/zabbix"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/a3ak/suffix"
+)
+
+// Повтор прогрева по умолчанию: меньше минимального времени жизни idle соединения (10s)
+const defaultWarmUpInterval = 8 * time.Second
+
+// warmUpTarget адрес, с которым прогреваются соединения
+type warmUpTarget struct {
+	url       string
+	ignoreSSL bool
+}
+
+// warmUpTargets возвращает адреса серверов, их реплик и канареек
+func warmUpTargets(servers []zabbix.ZabbixServer) []warmUpTarget {
+	targets := make([]warmUpTarget, 0, len(servers))
+	for _, srv := range servers {
+		targets = append(targets, warmUpTarget{url: srv.URL, ignoreSSL: srv.IgnoreSSL})
+		for _, r := range srv.Replicas {
+			targets = append(targets, warmUpTarget{url: r.URL, ignoreSSL: srv.IgnoreSSL})
+		}
+		if srv.CanaryURL != "" {
+			targets = append(targets, warmUpTarget{url: srv.CanaryURL, ignoreSSL: srv.IgnoreSSL})
+		}
+	}
+	return targets
+}
+
+// warmUp прогревает соединения со всеми серверами одновременно
+func warmUp(ctx context.Context, client zabbix.ZabbixClient, servers []zabbix.ZabbixServer, conns int) {
+	var wg sync.WaitGroup
+	for _, t := range warmUpTargets(servers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			n, err := client.WarmUp(ctx, t.url, t.ignoreSSL, conns)
+			if err != nil && ctx.Err() == nil {
+				logger.Global.Warningf("Warm-up: %d connection(s) to %s established, error: %v", n, t.url, logger.Redact(err.Error()))
+				return
+			}
+			logger.Global.Debugf("Warm-up: %d connection(s) to %s established in %v", n, t.url, time.Since(start))
+		}()
+	}
+	wg.Wait()
+}
+
+// startWarmUp прогревает соединения с серверами в фоне сразу и затем с интервалом
+// warm_up.interval, чтобы в пуле оставались idle соединения. Возвращает nil, если прогрев отключен
+func (prx *Proxy) startWarmUp() context.CancelFunc {
+	cfg := prx.config.WarmUp
+	if cfg.Connections <= 0 || prx.zbxClient == nil {
+		return nil
+	}
+
+	interval := defaultWarmUpInterval
+	if cfg.Interval != "" {
+		if s, err := suffix.ToSeconds(cfg.Interval); err != nil {
+			logger.Global.Errorf("convert error 'warm_up.interval' to seconds: %v, using %v", err, defaultWarmUpInterval)
+		} else {
+			interval = time.Duration(s) * time.Second
+		}
+	}
+
+	client, servers := prx.zbxClient, prx.config.Servers
+	ctx, cancel := context.WithCancel(context.Background())
+	prx.background.start(func(bg context.Context) {
+		defer context.AfterFunc(bg, cancel)()
+		warmUp(ctx, client, servers, cfg.Connections)
+		if interval <= 0 {
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// Список серверов может измениться discovery
+				warmUp(ctx, client, prx.config.Servers, cfg.Connections)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	return cancel
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"ZabbixAPIproxy/internal/zabbix"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWarmUpTargets тестирует адреса прогрева: серверы, реплики и канарейки
+func TestWarmUpTargets(t *testing.T) {
+	servers := []zabbix.ZabbixServer{
+		{ID: 1, URL: "https://web1/api_jsonrpc.php", IgnoreSSL: true,
+			Replicas: []zabbix.ZabbixReplica{{URL: "https://web2/api_jsonrpc.php"}}},
+		{ID: 2, URL: "http://zbx2/api_jsonrpc.php", CanaryURL: "http://canary/api_jsonrpc.php"},
+	}
+	assert.Equal(t, []warmUpTarget{
+		{url: "https://web1/api_jsonrpc.php", ignoreSSL: true},
+		{url: "https://web2/api_jsonrpc.php", ignoreSSL: true},
+		{url: "http://zbx2/api_jsonrpc.php"},
+		{url: "http://canary/api_jsonrpc.php"},
+	}, warmUpTargets(servers))
+}
+
+// TestStartWarmUp тестирует прогрев соединений при инициализации и повтор по интервалу
+func TestStartWarmUp(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	client := &MockZabbixClient{WarmUpFunc: func(ctx context.Context, url string, ignoreSSL bool, conns int) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, 2, conns)
+		calls[url]++
+		return conns, nil
+	}}
+	count := func(url string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[url]
+	}
+
+	prx := &Proxy{zbxClient: client, config: routingServers()}
+	assert.Nil(t, prx.startWarmUp(), "warm-up is disabled by default")
+
+	prx.config.WarmUp = zabbix.WarmUpConf{Connections: 2, Interval: "1s"}
+	stop := prx.startWarmUp()
+	assert.NotNil(t, stop)
+	defer stop()
+
+	assert.Eventually(t, func() bool { return count("http://server1.com") >= 1 && count("http://server3.com") >= 1 },
+		time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return count("http://server2.com") >= 2 }, 3*time.Second, 50*time.Millisecond,
+		"warm-up is repeated to keep idle connections")
+}
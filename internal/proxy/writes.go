@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Заголовок, включающий согласованную запись на несколько серверов
+	writeModeHeader = "X-Proxy-Write-Mode"
+	writeModeCoord  = "coordinated"
+	// Заголовок со списком ID серверов согласованной записи, по умолчанию все серверы
+	writeServersHeader = "X-Proxy-Servers"
+	// для хранения серверов, которым адресован запрос
+	targetServersKey ctxKey = "target_servers"
+
+	// Статусы серверов согласованной записи
+	writeApplied       = "applied"        // Изменение применено
+	writeNotApplicable = "not_applicable" // На сервере нет сущностей запроса
+	writeFailed        = "failed"         // Ошибка сервера, запись остановлена
+	writeNotAttempted  = "not_attempted"  // Сервер после ошибки, изменение не отправлялось
+)
+
+// CoordinatedWritesConf настройки согласованной записи на несколько серверов
+type CoordinatedWritesConf struct {
+	Enabled bool `yaml:"enabled"`
+	// Разрешить методы .create в согласованном режиме (например окно обслуживания на всех серверах)
+	AllowCreate bool `yaml:"allow_create"`
+}
+
+// writeOutcome результат согласованной записи на одном сервере
+type writeOutcome struct {
+	ServerID int    `json:"server_id"`
+	URL      string `json:"url"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Result   any    `json:"result,omitempty"`
+}
+
+// coordinatedWrite согласованная запись: изменение применяется к серверам по одному
+// в порядке ID и останавливается на первой ошибке. Серверы, на которых изменение уже
+// применено, при частичной ошибке требуют ручного отката
+type coordinatedWrite struct {
+	servers []int
+	// Запрос к серверу, false - на сервере нет сущностей запроса. nil - запрос клиента без изменений
+	prepare  func(serverID int) (map[string]any, bool)
+	outcomes []writeOutcome
+}
+
+// parseCoordinatedWrite разбирает заголовки согласованной записи. Возвращает nil,
+// если режим не запрошен, отключен или метод читающий
+func (prx *Proxy) parseCoordinatedWrite(r *http.Request, request map[string]any, trace_id string) (*coordinatedWrite, error) {
+	method, _ := request["method"].(string)
+	createAll := method == maintenanceCreateAll
+	if !createAll && (!prx.global.CoordinatedWrites.Enabled || isReadMethod(method) || r.Header.Get(writeModeHeader) != writeModeCoord) {
+		return nil, nil
+	}
+	if createAll && !prx.createAllowed(r, method) {
+		return nil, fmt.Errorf("method %s requires coordinated_writes.allow_create", method)
+	}
+
+	all := prx.getAllServers()
+	servers := all
+	if header := r.Header.Get(writeServersHeader); header != "" {
+		servers = nil
+		for _, s := range strings.Split(header, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || !slices.Contains(all, id) {
+				return nil, fmt.Errorf("invalid %s: unknown server '%s'", writeServersHeader, strings.TrimSpace(s))
+			}
+			if !slices.Contains(servers, id) {
+				servers = append(servers, id)
+			}
+		}
+	}
+	// Запрещенные клиенту серверы отклоняют запись до ее начала
+	if p := principalFromContext(r.Context()); p.restricted() {
+		if allowed := p.filterServers(prx.config.Servers, servers); len(allowed) != len(servers) {
+			return nil, fmt.Errorf("servers %v are not allowed for client %s", slices.DeleteFunc(slices.Clone(servers), func(id int) bool { return slices.Contains(allowed, id) }), p.name)
+		}
+	}
+	slices.Sort(servers)
+	write := &coordinatedWrite{servers: servers}
+	if createAll {
+		write.prepare = prx.maintenanceForServer(request, trace_id)
+	}
+	return write, nil
+}
+
+// createAllowed сообщает, что метод .create разрешен в согласованном режиме.
+// proxy.maintenance.createAll всегда выполняется согласованной записью
+func (prx *Proxy) createAllowed(r *http.Request, method string) bool {
+	cfg := prx.global.CoordinatedWrites
+	return cfg.Enabled && cfg.AllowCreate && (method == maintenanceCreateAll || r.Header.Get(writeModeHeader) == writeModeCoord)
+}
+
+// withTargetServers ограничивает серверы запроса
+func withTargetServers(ctx context.Context, servers []int) context.Context {
+	return context.WithValue(ctx, targetServersKey, servers)
+}
+
+// targetServersFromContext возвращает серверы, которыми ограничен запрос
+func targetServersFromContext(ctx context.Context) ([]int, bool) {
+	servers, ok := ctx.Value(targetServersKey).([]int)
+	return servers, ok
+}
+
+// processCoordinatedWrite применяет изменение к серверам записи по одному. Результаты
+// серверов объединяются, ошибка сервера останавливает запись на остальных серверах
+func (prx *Proxy) processCoordinatedWrite(ctx context.Context, request map[string]any, trace_id string, write *coordinatedWrite) (any, []string) {
+	log := requestLogger(ctx, trace_id)
+	var results any
+	var errors []string
+	for _, id := range write.servers {
+		outcome := writeOutcome{ServerID: id, URL: prx.serverURL(id)}
+		if len(errors) > 0 {
+			outcome.Status = writeNotAttempted
+			write.outcomes = append(write.outcomes, outcome)
+			continue
+		}
+
+		serverRequest, ok := request, true
+		if write.prepare != nil {
+			serverRequest, ok = write.prepare(id)
+		}
+		if !ok {
+			outcome.Status = writeNotApplicable
+			write.outcomes = append(write.outcomes, outcome)
+			continue
+		}
+
+		result, errs := prx.processAllServers(withTargetServers(ctx, []int{id}), serverRequest, trace_id)
+		switch {
+		case len(errs) > 0:
+			outcome.Status = writeFailed
+			outcome.Error = strings.Join(errs, "; ")
+			errors = append(errors, errs...)
+			log.Errorf("Coordinated write failed on server %d, remaining servers are not attempted: %v", id, errs)
+		case isEmpty(result):
+			outcome.Status = writeNotApplicable
+		default:
+			outcome.Status = writeApplied
+			outcome.Result = result
+			results = mergeWriteResults(results, result)
+		}
+		write.outcomes = append(write.outcomes, outcome)
+	}
+	return results, errors
+}
+
+// serverURL возвращает URL сервера по ID
+func (prx *Proxy) serverURL(id int) string {
+	for _, srv := range prx.config.Servers {
+		if srv.ID == id {
+			return srv.URL
+		}
+	}
+	return ""
+}
+
+// mergeWriteResults объединяет результаты записи серверов: списки ID
+// ({"hostids": [...]}) складываются, списки результатов объединяются
+func mergeWriteResults(merged, result any) any {
+	switch r := result.(type) {
+	case map[string]any:
+		m, ok := merged.(map[string]any)
+		if !ok {
+			m = make(map[string]any, len(r))
+		}
+		for key, value := range r {
+			if list, ok := value.([]any); ok {
+				existing, _ := m[key].([]any)
+				m[key] = append(existing, list...)
+			} else {
+				m[key] = value
+			}
+		}
+		return m
+	case []any:
+		list, _ := merged.([]any)
+		return append(list, r...)
+	}
+	return result
+}
+
+// rollbackRequired возвращает серверы, на которых изменение применено до ошибки
+func (w *coordinatedWrite) rollbackRequired() []int {
+	failed := false
+	var applied []int
+	for _, o := range w.outcomes {
+		switch o.Status {
+		case writeFailed:
+			failed = true
+		case writeApplied:
+			applied = append(applied, o.ServerID)
+		}
+	}
+	if !failed {
+		return nil
+	}
+	return applied
+}
+
+// failed сообщает, что запись не применена хотя бы на одном сервере
+func (w *coordinatedWrite) failed() bool {
+	return w != nil && slices.ContainsFunc(w.outcomes, func(o writeOutcome) bool { return o.Status == writeFailed })
+}
+
+// meta возвращает отчет о записи для meta.write_report ответа
+func (w *coordinatedWrite) meta() map[string]any {
+	status := "complete"
+	rollback := w.rollbackRequired()
+	if w.failed() {
+		status = "failed"
+		if len(rollback) > 0 {
+			status = "partial"
+		}
+	}
+	report := map[string]any{"status": status, "servers": w.outcomes}
+	if len(rollback) > 0 {
+		report["rollback_required"] = rollback
+	}
+	return report
+}
+
+// rpcError возвращает ошибку JSON-RPC частично примененной записи
+func (w *coordinatedWrite) rpcError() map[string]any {
+	data := "Coordinated write failed"
+	for _, o := range w.outcomes {
+		if o.Status == writeFailed {
+			data += fmt.Sprintf(" on server %d: %s", o.ServerID, o.Error)
+		}
+	}
+	if rollback := w.rollbackRequired(); len(rollback) > 0 {
+		data += fmt.Sprintf(". Applied on servers %v, manual rollback required", rollback)
+	}
+	return map[string]any{"code": -32500, "message": "Application error.", "data": data}
+}
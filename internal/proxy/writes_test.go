@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCoordinatedWrite тестирует согласованную запись на несколько серверов и отчет об откате
+func TestCoordinatedWrite(t *testing.T) {
+	g := Global{MaxRequests: 5, CoordinatedWrites: CoordinatedWritesConf{Enabled: true, AllowCreate: true}}
+	prx := InitProxy(g, routingServers(), CBConf{}, CacheConf(initTestCache()), ExcludeMethods{})
+	defer cleanupTestProxy(prx)
+	prx.global.maxReqBodySizeInt64 = 1 << 20
+	prx.SetMetrics(NewMockMetricsCollector())
+
+	var called []string
+	failURL := ""
+	mock := &MockZabbixClient{SendFunc: func(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
+		called = append(called, url)
+		if url == failURL {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return map[string]any{"result": map[string]any{"maintenanceids": []any{"5"}}}, nil
+	}}
+	prx.zbxClient = mock
+
+	send := func(method, servers string) map[string]any {
+		called = nil
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","method":"%s","params":{"name":"mw"},"id":1}`, method)
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(writeModeHeader, writeModeCoord)
+		if servers != "" {
+			req.Header.Set(writeServersHeader, servers)
+		}
+		w := httptest.NewRecorder()
+		prx.AuthMiddleware(prx.Handler, "/metrics", "", "", "")(w, req)
+		var response map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+		return response
+	}
+
+	// Запись применена на всех серверах по одному в порядке ID
+	response := send("maintenance.create", "")
+	require.Nil(t, response["error"])
+	assert.Len(t, response["result"].(map[string]any)["maintenanceids"], 3)
+	assert.Equal(t, []string{"http://server1.com", "http://server2.com", "http://server3.com"}, called)
+	report := response["meta"].(map[string]any)["write_report"].(map[string]any)
+	assert.Equal(t, "complete", report["status"])
+	assert.Nil(t, report["rollback_required"])
+
+	// Ошибка второго сервера останавливает запись, первый сервер требует отката
+	failURL = "http://server2.com"
+	response = send("maintenance.update", "3, 1,2")
+	assert.Equal(t, []string{"http://server1.com", "http://server2.com"}, called)
+	require.NotNil(t, response["error"])
+	assert.Contains(t, response["error"].(map[string]any)["data"], "manual rollback required")
+	report = response["meta"].(map[string]any)["write_report"].(map[string]any)
+	assert.Equal(t, "partial", report["status"])
+	assert.Equal(t, []any{float64(1)}, report["rollback_required"])
+	statuses := []string{}
+	for _, s := range report["servers"].([]any) {
+		statuses = append(statuses, s.(map[string]any)["status"].(string))
+	}
+	assert.Equal(t, []string{writeApplied, writeFailed, writeNotAttempted}, statuses)
+
+	// Ошибка первого сервера: откат не требуется
+	failURL = "http://server1.com"
+	response = send("maintenance.update", "1,2")
+	report = response["meta"].(map[string]any)["write_report"].(map[string]any)
+	assert.Equal(t, "failed", report["status"])
+	assert.Len(t, called, 1)
+
+	// Неизвестный сервер отклоняется до начала записи
+	response = send("maintenance.update", "1,9")
+	assert.Empty(t, called)
+	assert.Contains(t, response["error"].(map[string]any)["data"], "unknown server '9'")
+}
+
+// TestCoordinatedWrite_CreateBlocked тестирует блокировку .create без согласованного режима
+func TestCoordinatedWrite_CreateBlocked(t *testing.T) {
+	prx := &Proxy{global: Global{maxReqBodySizeInt64: 1024, CoordinatedWrites: CoordinatedWritesConf{Enabled: true}}}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"maintenance.create","params":{},"id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(writeModeHeader, writeModeCoord)
+	w := httptest.NewRecorder()
+	prx.AuthMiddleware(prx.Handler, "/metrics", "", "", "")(w, req)
+	assert.Contains(t, w.Body.String(), "Create methods are not implemented")
+}
+
+// TestMergeWriteResults тестирует объединение результатов записи серверов
+func TestMergeWriteResults(t *testing.T) {
+	var merged any
+	merged = mergeWriteResults(merged, map[string]any{"hostids": []any{"1"}})
+	merged = mergeWriteResults(merged, map[string]any{"hostids": []any{"2", "3"}})
+	assert.Equal(t, map[string]any{"hostids": []any{"1", "2", "3"}}, merged)
+	assert.Equal(t, []any{"a", "b"}, mergeWriteResults([]any{"a"}, []any{"b"}))
+}
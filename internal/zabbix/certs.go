@@ -0,0 +1,93 @@
+package zabbix
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"ZabbixAPIproxy/internal/logger"
+
+	"github.com/a3ak/suffix"
+)
+
+// Предупреждение об истечении сертификата по умолчанию
+const defaultCertExpiryWarning = 14 * 24 * time.Hour
+
+// TLSConf контроль сертификатов серверов
+type TLSConf struct {
+	// Остаток срока сертификата, при котором в лог пишется предупреждение, по умолчанию 14d
+	CertExpiryWarning string `yaml:"cert_expiry_warning"`
+}
+
+// CertStats сертификат сервера, полученный при последнем соединении
+type CertStats struct {
+	Subject  string
+	NotAfter time.Time
+}
+
+// certTracker запоминает сроки сертификатов серверов по host:port
+type certTracker struct {
+	mu     sync.Mutex
+	certs  map[string]CertStats
+	warnAt time.Duration
+	now    func() time.Time
+	warned map[string]time.Time // NotAfter сертификата, о котором уже предупреждали
+}
+
+func newCertTracker(conf TLSConf) *certTracker {
+	warnAt := defaultCertExpiryWarning
+	if conf.CertExpiryWarning != "" {
+		if s, err := suffix.ToSeconds(conf.CertExpiryWarning); err != nil {
+			logger.Global.Errorf("convert error 'tls.cert_expiry_warning' to seconds: %v, using %v", err, defaultCertExpiryWarning)
+		} else {
+			warnAt = time.Duration(s) * time.Second
+		}
+	}
+	return &certTracker{
+		certs:  make(map[string]CertStats),
+		warned: make(map[string]time.Time),
+		warnAt: warnAt,
+		now:    time.Now,
+	}
+}
+
+// observe запоминает сертификат сервера host из состояния TLS соединения
+// и предупреждает (один раз для сертификата) о скором истечении срока
+func (t *certTracker) observe(ctx context.Context, host string, state *tls.ConnectionState) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+	cert := state.PeerCertificates[0]
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.certs[host] = CertStats{Subject: cert.Subject.CommonName, NotAfter: cert.NotAfter}
+
+	left := cert.NotAfter.Sub(t.now())
+	if left > t.warnAt || t.warned[host].Equal(cert.NotAfter) {
+		return
+	}
+	t.warned[host] = cert.NotAfter
+	if left <= 0 {
+		logger.WithContext(ctx).Warningf("TLS certificate of %s (%s) expired at %s", host, cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+		return
+	}
+	logger.WithContext(ctx).Warningf("TLS certificate of %s (%s) expires in %v at %s", host, cert.Subject.CommonName, left.Round(time.Hour), cert.NotAfter.Format(time.RFC3339))
+}
+
+// stats возвращает сертификаты серверов по host:port
+func (t *certTracker) stats() map[string]CertStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make(map[string]CertStats, len(t.certs))
+	for host, st := range t.certs {
+		stats[host] = st
+	}
+	return stats
+}
+
+// GetCertStats возвращает сертификаты серверов, полученные при последних соединениях, по host:port
+func (c *zabbixClient) GetCertStats() map[string]CertStats {
+	return c.certs.stats()
+}
@@ -0,0 +1,82 @@
+package zabbix
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestZabbixClient_CertStats(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": 1})
+	}))
+	defer server.Close()
+
+	client, err := Init(Zabbix{})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1}
+	if _, err := client.SendToZabbix(context.Background(), server.URL, true, request); err != nil {
+		t.Fatalf("SendToZabbix failed: %v", err)
+	}
+
+	u, _ := url.Parse(server.URL)
+	st, ok := client.GetCertStats()[u.Host]
+	if !ok {
+		t.Fatalf("Expected certificate of %s, got %v", u.Host, client.GetCertStats())
+	}
+	if !st.NotAfter.Equal(server.Certificate().NotAfter) {
+		t.Errorf("Expected NotAfter %v, got %v", server.Certificate().NotAfter, st.NotAfter)
+	}
+}
+
+func TestCertTracker_Warning(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newCertTracker(TLSConf{CertExpiryWarning: "7d"})
+	tracker.now = func() time.Time { return now }
+
+	state := func(notAfter time.Time) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+			{Subject: pkix.Name{CommonName: "zabbix.example"}, NotAfter: notAfter},
+		}}
+	}
+
+	// Сертификат с запасом срока - без предупреждения
+	tracker.observe(context.Background(), "zabbix.example:443", state(now.Add(30*24*time.Hour)))
+	if _, warned := tracker.warned["zabbix.example:443"]; warned {
+		t.Error("Expected no warning for a certificate valid for 30 days")
+	}
+
+	// Тот же сертификат предупреждает, когда остаток срока становится меньше порога
+	now = now.Add(25 * 24 * time.Hour)
+	tracker.observe(context.Background(), "zabbix.example:443", state(now.Add(5*24*time.Hour)))
+	if _, warned := tracker.warned["zabbix.example:443"]; !warned {
+		t.Error("Expected a warning once the certificate is within the threshold")
+	}
+
+	// Истекающий сертификат - предупреждение
+	expiring := now.Add(3 * 24 * time.Hour)
+	tracker.observe(context.Background(), "zabbix.example:443", state(expiring))
+	if !tracker.warned["zabbix.example:443"].Equal(expiring) {
+		t.Error("Expected a warning for a certificate expiring in 3 days")
+	}
+	if st := tracker.stats()["zabbix.example:443"]; !st.NotAfter.Equal(expiring) || st.Subject != "zabbix.example" {
+		t.Errorf("Unexpected certificate stats: %+v", st)
+	}
+
+	// Соединение без TLS не меняет статистику
+	tracker.observe(context.Background(), "plain:80", nil)
+	if len(tracker.stats()) != 1 {
+		t.Errorf("Expected 1 certificate, got %v", tracker.stats())
+	}
+}
@@ -0,0 +1,174 @@
+package zabbix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+)
+
+// DiscoveryConf настройки динамического получения списка серверов
+type DiscoveryConf struct {
+	Provider string `yaml:"provider"` // consul, srv или kubernetes, пусто - discovery отключен
+	Interval string `yaml:"interval"` // Период опроса, по умолчанию 30s
+
+	// consul: имя сервиса Consul, srv: DNS имя SRV записи (_zabbix._tcp.example.com)
+	Service     string `yaml:"service"`
+	Tag         string `yaml:"tag"`          // Фильтр сервисов Consul по тегу
+	ConsulAddr  string `yaml:"consul_addr"`  // По умолчанию http://127.0.0.1:8500
+	ConsulToken string `yaml:"consul_token"` // ACL токен Consul
+
+	// kubernetes: сервисы с меткой label_selector в namespace (по умолчанию namespace пода)
+	LabelSelector string `yaml:"label_selector"`
+	Namespace     string `yaml:"namespace"`
+	PortName      string `yaml:"port_name"` // Имя порта сервиса, по умолчанию первый порт
+	KubeAPI       string `yaml:"kube_api"`  // Адрес API, по умолчанию из окружения пода
+
+	// Параметры обнаруженных серверов
+	Scheme    string `yaml:"scheme"` // По умолчанию https
+	Path      string `yaml:"path"`   // По умолчанию /api_jsonrpc.php
+	Token     string `yaml:"token"`  // API токен серверов
+	IgnoreSSL bool   `yaml:"ignore_ssl"`
+
+	// Файл для сохранения назначенных ID между перезапусками (необязательно)
+	IDsFile string `yaml:"ids_file"`
+	// Сколько пропавший сервер остается в списке, по умолчанию 5m (0 - удаляется сразу)
+	RemovalGrace string `yaml:"removal_grace"`
+}
+
+// DiscoveredServer сервер, найденный через discovery
+type DiscoveredServer struct {
+	URL string
+	// ID из метаданных сервиса (consul meta или метка kubernetes zabbix_server_id), 0 - не задан
+	ID int
+}
+
+// consulMetaServerID - ключ метаданных сервиса Consul с явным ID сервера
+const consulMetaServerID = "zabbix_server_id"
+
+// Discoverer опрашивает провайдера discovery. Клиент API Kubernetes создается при
+// первом опросе и используется повторно, что бы не оставлять соединения каждого опроса
+type Discoverer struct {
+	cfg DiscoveryConf
+	k8s *k8sClient
+}
+
+// NewDiscoverer создает опрос провайдера discovery с настройками cfg
+func NewDiscoverer(cfg DiscoveryConf) *Discoverer {
+	return &Discoverer{cfg: cfg}
+}
+
+// Discover возвращает список серверов от провайдера discovery.
+// Не предназначен для одновременного вызова из нескольких горутин
+func (d *Discoverer) Discover(ctx context.Context) ([]DiscoveredServer, error) {
+	switch d.cfg.Provider {
+	case "consul":
+		return discoverConsul(ctx, d.cfg)
+	case "srv":
+		return discoverSRV(ctx, d.cfg)
+	case "kubernetes":
+		if d.k8s == nil {
+			k, err := newK8sClient(d.cfg)
+			if err != nil {
+				return nil, err
+			}
+			d.k8s = k
+		}
+		return d.k8s.discover(ctx, d.cfg)
+	default:
+		return nil, fmt.Errorf("unknown discovery provider '%s'", d.cfg.Provider)
+	}
+}
+
+// discoveredURL формирует URL API сервера из адреса и порта
+func discoveredURL(cfg DiscoveryConf, host string, port int) string {
+	scheme := cfg.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	path := cfg.Path
+	if path == "" {
+		path = "/api_jsonrpc.php"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port)) + path
+}
+
+// discoverConsul получает прошедшие health check экземпляры сервиса из Consul
+func discoverConsul(ctx context.Context, cfg DiscoveryConf) ([]DiscoveredServer, error) {
+	addr := cfg.ConsulAddr
+	if addr == "" {
+		addr = "http://127.0.0.1:8500"
+	}
+
+	query := neturl.Values{"passing": {"true"}}
+	if cfg.Tag != "" {
+		query.Set("tag", cfg.Tag)
+	}
+	reqURL := strings.TrimRight(addr, "/") + "/v1/health/service/" + neturl.PathEscape(cfg.Service) + "?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ConsulToken != "" {
+		req.Header.Set("X-Consul-Token", cfg.ConsulToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("consul HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var entries []struct {
+		Node struct {
+			Address string
+		}
+		Service struct {
+			Address string
+			Port    int
+			Meta    map[string]string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid consul response: %w", err)
+	}
+
+	servers := make([]DiscoveredServer, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		srv := DiscoveredServer{URL: discoveredURL(cfg, host, e.Service.Port)}
+		if id, err := strconv.Atoi(e.Service.Meta[consulMetaServerID]); err == nil {
+			srv.ID = id
+		}
+		servers = append(servers, srv)
+	}
+	return servers, nil
+}
+
+// discoverSRV получает серверы из DNS SRV записи
+func discoverSRV(ctx context.Context, cfg DiscoveryConf) ([]DiscoveredServer, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", cfg.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]DiscoveredServer, 0, len(records))
+	for _, r := range records {
+		servers = append(servers, DiscoveredServer{URL: discoveredURL(cfg, strings.TrimSuffix(r.Target, "."), int(r.Port))})
+	}
+	return servers, nil
+}
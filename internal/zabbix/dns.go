@@ -0,0 +1,241 @@
+package zabbix
+
+import (
+	"ZabbixAPIproxy/internal/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DNSConf настройки кеширования DNS для подключений к серверам Zabbix
+type DNSConf struct {
+	// Время жизни разрешенных адресов. По истечении адреса перезапрашиваются,
+	// и при их изменении keep-alive соединения с исчезнувшими адресами закрываются.
+	// Пусто или 0 - кеширование отключено (адрес разрешается при каждом соединении)
+	TTL string `yaml:"ttl"`
+}
+
+// DNSStats состояние разрешения имени сервера
+type DNSStats struct {
+	Addrs       int       // Количество адресов в кеше
+	Failures    int64     // Количество неудачных разрешений имени
+	LastResolve time.Time // Время последнего успешного разрешения
+}
+
+// dnsEntry запись кеша DNS для одного хоста
+type dnsEntry struct {
+	addrs      []string
+	resolvedAt time.Time
+	failures   int64
+}
+
+// errStaleAddress ошибка записи в соединение с адресом, исчезнувшим из DNS.
+// Запрос не отправлен, и транспорт повторяет его в новом соединении
+var errStaleAddress = errors.New("connection to a stale DNS address closed")
+
+// dnsConn соединение, установленное через кеш DNS. После исчезновения адреса
+// из DNS соединение помечается устаревшим и закрывается при следующей записи:
+// текущий запрос завершается, а следующий уходит в новое соединение
+type dnsConn struct {
+	net.Conn
+	cache *dnsCache
+	host  string
+	ip    string
+	stale atomic.Bool
+	once  sync.Once
+}
+
+func (c *dnsConn) Write(b []byte) (int, error) {
+	if c.stale.Load() {
+		c.Close()
+		return 0, errStaleAddress
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *dnsConn) Close() error {
+	c.once.Do(func() {
+		c.cache.mu.Lock()
+		delete(c.cache.conns, c)
+		c.cache.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// dnsCache кеширует адреса серверов Zabbix и периодически их перепроверяет,
+// чтобы после переключения upstream на новый IP не работать со старым через keep-alive
+type dnsCache struct {
+	ttl    time.Duration
+	lookup func(ctx context.Context, host string) ([]string, error)
+	// Вызывается при изменении адресов хоста (закрытие idle соединений)
+	onChange func(host string)
+
+	mu    sync.Mutex
+	hosts map[string]*dnsEntry
+	// Открытые соединения для пометки устаревших при изменении адресов
+	conns map[*dnsConn]struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newDNSCache(ttl time.Duration, onChange func(host string)) *dnsCache {
+	return &dnsCache{
+		ttl:      ttl,
+		lookup:   net.DefaultResolver.LookupHost,
+		onChange: onChange,
+		hosts:    make(map[string]*dnsEntry),
+		conns:    make(map[*dnsConn]struct{}),
+		stop:     make(chan struct{}),
+	}
+}
+
+// resolve возвращает адреса хоста из кеша или разрешает имя заново.
+// При ошибке разрешения используются устаревшие адреса, если они есть
+func (d *dnsCache) resolve(ctx context.Context, host string, force bool) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	d.mu.Lock()
+	entry, ok := d.hosts[host]
+	if ok && !force && time.Since(entry.resolvedAt) < d.ttl {
+		addrs := entry.addrs
+		d.mu.Unlock()
+		return addrs, nil
+	}
+	d.mu.Unlock()
+
+	addrs, err := d.lookup(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("no addresses for host %s", host)
+	}
+
+	d.mu.Lock()
+	entry, ok = d.hosts[host]
+	if !ok {
+		entry = &dnsEntry{}
+		d.hosts[host] = entry
+	}
+	if err != nil {
+		entry.failures++
+		stale := entry.addrs
+		d.mu.Unlock()
+		if len(stale) > 0 {
+			logger.WithContext(ctx).Warningf("DNS resolve error for %s, using cached addresses %v: %v", host, stale, err)
+			return stale, nil
+		}
+		return nil, err
+	}
+
+	slices.Sort(addrs)
+	changed := len(entry.addrs) > 0 && !slices.Equal(entry.addrs, addrs)
+	old := entry.addrs
+	entry.addrs = addrs
+	entry.resolvedAt = time.Now()
+	if changed {
+		for c := range d.conns {
+			if c.host == host && !slices.Contains(addrs, c.ip) {
+				c.stale.Store(true)
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	if changed {
+		logger.WithContext(ctx).Infof("DNS addresses of %s changed: %v -> %v", host, old, addrs)
+		if d.onChange != nil {
+			d.onChange(host)
+		}
+	}
+	return addrs, nil
+}
+
+// dialContext подключается к первому доступному адресу хоста из кеша
+func (d *dnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := d.resolve(ctx, host, false)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				if net.ParseIP(host) != nil {
+					return conn, nil
+				}
+				c := &dnsConn{Conn: conn, cache: d, host: host, ip: ip}
+				d.mu.Lock()
+				d.conns[c] = struct{}{}
+				d.mu.Unlock()
+				return c, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// refreshAll перезапрашивает адреса всех известных хостов
+func (d *dnsCache) refreshAll(ctx context.Context) {
+	d.mu.Lock()
+	hosts := make([]string, 0, len(d.hosts))
+	for host := range d.hosts {
+		hosts = append(hosts, host)
+	}
+	d.mu.Unlock()
+
+	for _, host := range hosts {
+		d.resolve(ctx, host, true)
+	}
+}
+
+// start запускает периодическую перепроверку адресов с интервалом ttl
+func (d *dnsCache) start() {
+	go func() {
+		ticker := time.NewTicker(d.ttl)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), d.ttl)
+				d.refreshAll(ctx)
+				cancel()
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close останавливает периодическую перепроверку
+func (d *dnsCache) close() {
+	d.stopOnce.Do(func() { close(d.stop) })
+}
+
+// stats возвращает состояние разрешения имен по хостам
+func (d *dnsCache) stats() map[string]DNSStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := make(map[string]DNSStats, len(d.hosts))
+	for host, e := range d.hosts {
+		stats[host] = DNSStats{
+			Addrs:       len(e.addrs),
+			Failures:    e.failures,
+			LastResolve: e.resolvedAt,
+		}
+	}
+	return stats
+}
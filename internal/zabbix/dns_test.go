@@ -0,0 +1,223 @@
+package zabbix
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver подменяет разрешение имен в тестах
+type fakeResolver struct {
+	mu    sync.Mutex
+	addrs []string
+	err   error
+	calls int
+}
+
+func (r *fakeResolver) set(addrs []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addrs, r.err = addrs, err
+}
+
+func (r *fakeResolver) lookup(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	return append([]string(nil), r.addrs...), r.err
+}
+
+// TestDNSCache_TTL проверяет, что адреса берутся из кеша до истечения TTL
+func TestDNSCache_TTL(t *testing.T) {
+	r := &fakeResolver{addrs: []string{"10.0.0.1"}}
+	d := newDNSCache(time.Hour, nil)
+	d.lookup = r.lookup
+
+	for i := 0; i < 3; i++ {
+		addrs, err := d.resolve(context.Background(), "zabbix.local", false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+			t.Errorf("Expected [10.0.0.1], got %v", addrs)
+		}
+	}
+	if r.calls != 1 {
+		t.Errorf("Expected 1 lookup, got %d", r.calls)
+	}
+
+	// IP адрес не разрешается и не кешируется
+	if addrs, _ := d.resolve(context.Background(), "127.0.0.1", false); len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Errorf("Expected IP to be returned as is, got %v", addrs)
+	}
+	if len(d.stats()) != 1 {
+		t.Errorf("Expected 1 cached host, got %d", len(d.stats()))
+	}
+}
+
+// TestDNSCache_Change проверяет вызов onChange при изменении адресов
+func TestDNSCache_Change(t *testing.T) {
+	r := &fakeResolver{addrs: []string{"10.0.0.1"}}
+	changed := 0
+	d := newDNSCache(time.Hour, func(host string) { changed++ })
+	d.lookup = r.lookup
+
+	d.resolve(context.Background(), "zabbix.local", false)
+	if changed != 0 {
+		t.Errorf("First resolve must not be reported as change")
+	}
+
+	d.refreshAll(context.Background())
+	if changed != 0 {
+		t.Errorf("Same addresses must not be reported as change")
+	}
+
+	r.set([]string{"10.0.0.2"}, nil)
+	d.refreshAll(context.Background())
+	if changed != 1 {
+		t.Errorf("Expected 1 change, got %d", changed)
+	}
+	if addrs, _ := d.resolve(context.Background(), "zabbix.local", false); addrs[0] != "10.0.0.2" {
+		t.Errorf("Expected new address 10.0.0.2, got %v", addrs)
+	}
+}
+
+// TestDNSCache_Failure проверяет использование устаревших адресов и счетчик ошибок
+func TestDNSCache_Failure(t *testing.T) {
+	r := &fakeResolver{err: errors.New("no such host")}
+	d := newDNSCache(time.Hour, nil)
+	d.lookup = r.lookup
+
+	if _, err := d.resolve(context.Background(), "zabbix.local", false); err == nil {
+		t.Error("Expected error without cached addresses")
+	}
+
+	r.set([]string{"10.0.0.1"}, nil)
+	d.resolve(context.Background(), "zabbix.local", true)
+
+	r.set(nil, errors.New("no such host"))
+	addrs, err := d.resolve(context.Background(), "zabbix.local", true)
+	if err != nil || len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+		t.Errorf("Expected stale address 10.0.0.1, got %v, %v", addrs, err)
+	}
+
+	st := d.stats()["zabbix.local"]
+	if st.Failures != 2 {
+		t.Errorf("Expected 2 failures, got %d", st.Failures)
+	}
+	if st.Addrs != 1 {
+		t.Errorf("Expected 1 cached address, got %d", st.Addrs)
+	}
+}
+
+// TestZabbixClient_DNSCache проверяет подключение к серверу через кеш DNS
+func TestZabbixClient_DNSCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","result":[],"id":1}`))
+	}))
+	defer server.Close()
+
+	cfg := Zabbix{DNS: DNSConf{TTL: "1h"}}
+	client, err := Init(cfg)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	r := &fakeResolver{addrs: []string{host}}
+	client.dns.lookup = r.lookup
+
+	url := "http://zabbix.local:" + port + "/api_jsonrpc.php"
+	if _, err := client.SendToZabbix(context.Background(), url, false, map[string]any{"method": "host.get"}); err != nil {
+		t.Fatalf("SendToZabbix failed: %v", err)
+	}
+
+	stats := client.GetDNSStats()
+	if st, ok := stats["zabbix.local"]; !ok || st.Addrs != 1 {
+		t.Errorf("Expected zabbix.local in DNS stats, got %v", stats)
+	}
+}
+
+// TestZabbixClient_DNSChangeBusyConn проверяет, что соединение, занятое запросом во время
+// смены адресов, завершает запрос и больше не используется для исчезнувшего адреса
+func TestZabbixClient_DNSChangeBusyConn(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	var (
+		mu     sync.Mutex
+		served []string // Локальный адрес сервера для каждого запроса
+	)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.Context().Value(http.LocalAddrContextKey).(net.Addr).String())
+		mu.Lock()
+		served = append(served, host)
+		wait := len(served) == 1
+		mu.Unlock()
+		if wait {
+			close(entered)
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","result":[],"id":1}`))
+	}))
+	l, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Skipf("listen on all interfaces: %v", err)
+	}
+	server.Listener.Close()
+	server.Listener = l
+	server.Start()
+	defer server.Close()
+
+	client, err := Init(Zabbix{DNS: DNSConf{TTL: "1h"}})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+	r := &fakeResolver{addrs: []string{"127.0.0.1"}}
+	client.dns.lookup = r.lookup
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	url := "http://zabbix.local:" + port + "/api_jsonrpc.php"
+	send := func() error {
+		_, err := client.SendToZabbix(context.Background(), url, false, map[string]any{"method": "host.get"})
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- send() }()
+	<-entered
+
+	// Адрес сменился, пока соединение занято запросом, и новые запросы
+	// идут на новый адрес до завершения занятого соединения
+	r.set([]string{"127.0.0.2"}, nil)
+	client.dns.refreshAll(context.Background())
+	if err := send(); err != nil {
+		t.Fatalf("Request after DNS change failed: %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("In-flight request failed: %v", err)
+	}
+
+	// Освободившееся соединение со старым адресом не используется повторно
+	for i := 0; i < 3; i++ {
+		if err := send(); err != nil {
+			t.Fatalf("Request after DNS change failed: %v", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, host := range served[1:] {
+		if host != "127.0.0.2" {
+			t.Errorf("Request %d after DNS change served via %s, all: %v", i+1, host, served)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package zabbix
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Параметры доступа к API Kubernetes изнутри пода
+const (
+	k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// k8sLabelServerID - метка сервиса с явным ID сервера Zabbix
+	k8sLabelServerID = "zabbix_server_id"
+	// k8sWatchRetry - пауза перед повторным подключением watch после ошибки
+	k8sWatchRetry = 5 * time.Second
+)
+
+// k8sEndpoints список объектов Endpoints
+type k8sEndpoints struct {
+	Items []k8sEndpointsItem `json:"items"`
+}
+
+type k8sEndpointsItem struct {
+	Metadata struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+// k8sClient выполняет запросы к API Kubernetes с токеном сервисного аккаунта
+type k8sClient struct {
+	baseURL   string
+	namespace string
+	client    *http.Client
+	tokenFile string
+}
+
+func newK8sClient(cfg DiscoveryConf) (*k8sClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	baseURL := cfg.KubeAPI
+	if baseURL == "" {
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in kubernetes: KUBERNETES_SERVICE_HOST is not set")
+		}
+		baseURL = "https://" + net.JoinHostPort(host, port)
+	}
+
+	namespace := cfg.Namespace
+	if namespace == "" {
+		ns, err := os.ReadFile(k8sServiceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("read namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+
+	tlsConfig := &tls.Config{}
+	if ca, err := os.ReadFile(k8sServiceAccountDir + "/ca.crt"); err == nil {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+
+	return &k8sClient{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		namespace: namespace,
+		client:    &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		tokenFile: k8sServiceAccountDir + "/token",
+	}, nil
+}
+
+// get выполняет GET запрос к API. Токен читается при каждом запросе, т.к. kubelet его ротирует
+func (k *k8sClient) get(ctx context.Context, path string, query neturl.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token, err := os.ReadFile(k.tokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("kubernetes API HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+func (k *k8sClient) endpointsPath() string {
+	return "/api/v1/namespaces/" + neturl.PathEscape(k.namespace) + "/endpoints"
+}
+
+// discover возвращает сервисы с меткой label_selector, у которых есть готовые поды.
+// Каждый сервис - один сервер Zabbix, запросы идут на DNS имя сервиса.
+// Сервис без готовых адресов (поды завершаются) исключается из списка
+func (k *k8sClient) discover(ctx context.Context, cfg DiscoveryConf) ([]DiscoveredServer, error) {
+	resp, err := k.get(ctx, k.endpointsPath(), neturl.Values{"labelSelector": {cfg.LabelSelector}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var list k8sEndpoints
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid kubernetes response: %w", err)
+	}
+	return k8sServers(cfg, list.Items), nil
+}
+
+// k8sServers формирует список серверов из объектов Endpoints
+func k8sServers(cfg DiscoveryConf, items []k8sEndpointsItem) []DiscoveredServer {
+	servers := make([]DiscoveredServer, 0, len(items))
+	for _, item := range items {
+		ready, port := false, 0
+		for _, subset := range item.Subsets {
+			if len(subset.Addresses) == 0 {
+				continue
+			}
+			for _, p := range subset.Ports {
+				if cfg.PortName == "" || p.Name == cfg.PortName {
+					ready, port = true, p.Port
+					break
+				}
+			}
+			if ready {
+				break
+			}
+		}
+		if !ready {
+			continue
+		}
+
+		host := item.Metadata.Name + "." + item.Metadata.Namespace + ".svc"
+		srv := DiscoveredServer{URL: discoveredURL(cfg, host, port)}
+		if id, err := strconv.Atoi(item.Metadata.Labels[k8sLabelServerID]); err == nil {
+			srv.ID = id
+		}
+		servers = append(servers, srv)
+	}
+	return servers
+}
+
+// WatchKubernetes следит за изменениями Endpoints с меткой label_selector и
+// сигнализирует в notify о необходимости обновить список серверов.
+// Работает до отмены ctx, при ошибках переподключается
+func WatchKubernetes(ctx context.Context, cfg DiscoveryConf, notify chan<- struct{}) error {
+	k, err := newK8sClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			if err := k.watch(ctx, cfg, notify); err != nil && ctx.Err() == nil {
+				select {
+				case <-time.After(k8sWatchRetry):
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// watch держит один watch запрос до его завершения сервером или ошибки
+func (k *k8sClient) watch(ctx context.Context, cfg DiscoveryConf, notify chan<- struct{}) error {
+	resp, err := k.get(ctx, k.endpointsPath(), neturl.Values{
+		"labelSelector":  {cfg.LabelSelector},
+		"watch":          {"true"},
+		"timeoutSeconds": {"300"},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type string `json:"type"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if event.Type == "ERROR" {
+			return fmt.Errorf("kubernetes watch error event")
+		}
+
+		// Неблокирующее уведомление: обновление уже запланировано
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
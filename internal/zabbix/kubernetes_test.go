@@ -0,0 +1,114 @@
+package zabbix
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// k8sTestEndpoints формирует объект Endpoints для тестов
+func k8sTestEndpoints(name string, ready bool, labels map[string]string) map[string]any {
+	subset := map[string]any{
+		"ports": []map[string]any{{"name": "http", "port": 8080}, {"name": "metrics", "port": 9090}},
+	}
+	if ready {
+		subset["addresses"] = []map[string]any{{"ip": "10.0.0.1"}}
+	} else {
+		subset["notReadyAddresses"] = []map[string]any{{"ip": "10.0.0.1"}}
+	}
+	return map[string]any{
+		"metadata": map[string]any{"name": name, "namespace": "monitoring", "labels": labels},
+		"subsets":  []map[string]any{subset},
+	}
+}
+
+// TestDiscoverKubernetes проверяет получение серверов из Endpoints
+func TestDiscoverKubernetes(t *testing.T) {
+	api := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/monitoring/endpoints" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("labelSelector") != "app=zabbix-web" {
+			t.Errorf("Unexpected labelSelector %s", r.URL.Query().Get("labelSelector"))
+		}
+		json.NewEncoder(w).Encode(map[string]any{"items": []any{
+			k8sTestEndpoints("zabbix-a", true, map[string]string{"zabbix_server_id": "5"}),
+			k8sTestEndpoints("zabbix-b", true, nil),
+			k8sTestEndpoints("zabbix-c", false, nil),
+		}})
+	}))
+	var conns atomic.Int32
+	api.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	api.Start()
+	defer api.Close()
+
+	cfg := DiscoveryConf{
+		Provider:      "kubernetes",
+		LabelSelector: "app=zabbix-web",
+		Namespace:     "monitoring",
+		PortName:      "http",
+		KubeAPI:       api.URL,
+		Scheme:        "http",
+	}
+	discoverer := NewDiscoverer(cfg)
+	servers, err := discoverer.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	// Сервис без готовых подов не попадает в список
+	if len(servers) != 2 {
+		t.Fatalf("Expected 2 servers, got %v", servers)
+	}
+	if servers[0].URL != "http://zabbix-a.monitoring.svc:8080/api_jsonrpc.php" || servers[0].ID != 5 {
+		t.Errorf("Unexpected first server %+v", servers[0])
+	}
+	if servers[1].URL != "http://zabbix-b.monitoring.svc:8080/api_jsonrpc.php" || servers[1].ID != 0 {
+		t.Errorf("Unexpected second server %+v", servers[1])
+	}
+
+	// Следующий опрос использует тот же клиент и его соединение
+	if _, err := discoverer.Discover(context.Background()); err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("Expected one connection for repeated discovery, got %d", n)
+	}
+}
+
+// TestWatchKubernetes проверяет уведомление об изменениях Endpoints
+func TestWatchKubernetes(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") != "true" {
+			t.Errorf("Expected watch request")
+		}
+		json.NewEncoder(w).Encode(map[string]any{"type": "MODIFIED", "object": k8sTestEndpoints("zabbix-a", true, nil)})
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer api.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notify := make(chan struct{}, 1)
+	cfg := DiscoveryConf{Provider: "kubernetes", Namespace: "monitoring", KubeAPI: api.URL}
+	if err := WatchKubernetes(ctx, cfg, notify); err != nil {
+		t.Fatalf("WatchKubernetes failed: %v", err)
+	}
+
+	select {
+	case <-notify:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected notification on endpoints change")
+	}
+}
@@ -0,0 +1,107 @@
+package zabbix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"ZabbixAPIproxy/internal/logger"
+)
+
+const defaultRedirectMaxHops = 3
+
+// RedirectConf следование перенаправлениям HTTP 301/302/303/307/308 frontend
+// (например балансировщик перенаправляет /api_jsonrpc.php на HTTPS или канонический хост)
+type RedirectConf struct {
+	Follow  *bool `yaml:"follow"`   // Следовать перенаправлениям, по умолчанию true
+	MaxHops int   `yaml:"max_hops"` // Максимум перенаправлений одного запроса, по умолчанию 3
+}
+
+// follow сообщает, что перенаправлениям нужно следовать
+func (c RedirectConf) follow() bool {
+	return c.Follow == nil || *c.Follow
+}
+
+// maxHops возвращает максимум перенаправлений одного запроса
+func (c RedirectConf) maxHops() int {
+	if c.MaxHops <= 0 {
+		return defaultRedirectMaxHops
+	}
+	return c.MaxHops
+}
+
+// isRedirect проверяет, что ответ - перенаправление с адресом
+func isRedirect(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return resp.Header.Get("Location") != ""
+	}
+	return false
+}
+
+// redirectTarget проверяет перенаправление запроса from и возвращает новый адрес.
+// Допускаются только перенаправления на тот же хост (порт может меняться) без перехода
+// с HTTPS на HTTP: токен запроса не должен уйти на чужой хост или по открытому каналу
+func redirectTarget(from *url.URL, location string) (*url.URL, error) {
+	to, err := from.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect location %q: %v", location, err)
+	}
+	if to.Hostname() != from.Hostname() {
+		return nil, fmt.Errorf("redirect to another host %s is not followed", to.Host)
+	}
+	if from.Scheme == "https" && to.Scheme != "https" {
+		return nil, fmt.Errorf("redirect from HTTPS to %s is not followed", to.Scheme)
+	}
+	return to, nil
+}
+
+// warnedRedirects адреса, о перенаправлении которых уже предупреждали
+var warnedRedirects sync.Map
+
+// doFollowingRedirects выполняет POST запрос с телом body, следуя перенаправлениям
+// на тот же хост. Метод и тело сохраняются для всех кодов перенаправления
+// (стандартный клиент превращает POST в GET без тела для 301/302/303)
+func (c *zabbixClient) doFollowingRedirects(ctx context.Context, client *http.Client, req *http.Request, body []byte) (*http.Response, error) {
+	cfg := c.conf.Redirects
+	for hop := 0; ; hop++ {
+		host := hostKey(req.URL)
+		traffic := c.traffic.host(host)
+		traffic.sent.Add(int64(len(body)))
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		c.certs.observe(ctx, host, resp.TLS)
+		if !isRedirect(resp) {
+			resp.Body = &countingReader{ReadCloser: resp.Body, counter: &traffic.received}
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		location := resp.Header.Get("Location")
+		if !cfg.follow() {
+			return nil, fmt.Errorf("HTTP %d redirect to %s: redirects are disabled, update the server url", resp.StatusCode, location)
+		}
+		if hop >= cfg.maxHops() {
+			return nil, fmt.Errorf("HTTP %d redirect to %s: too many redirects (max_hops %d)", resp.StatusCode, location, cfg.maxHops())
+		}
+		to, err := redirectTarget(req.URL, location)
+		if err != nil {
+			return nil, fmt.Errorf("HTTP %d: %v, update the server url", resp.StatusCode, err)
+		}
+
+		if _, warned := warnedRedirects.LoadOrStore(req.URL.String()+" "+to.String(), true); !warned {
+			logger.WithContext(ctx).Warningf("Server %s redirects (HTTP %d) to %s, consider updating the server url", req.URL, resp.StatusCode, to)
+		}
+
+		next, err := newJSONRequest(ctx, to.String(), body)
+		if err != nil {
+			return nil, err
+		}
+		req = next
+	}
+}
@@ -0,0 +1,105 @@
+package zabbix
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// redirectServer перенаправляет /old на /api_jsonrpc.php кодом status и отвечает на POST /api_jsonrpc.php
+func redirectServer(t *testing.T, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/api_jsonrpc.php", status)
+		case "/loop":
+			http.Redirect(w, r, "/loop", status)
+		case "/away":
+			http.Redirect(w, r, "http://other.example/api_jsonrpc.php", status)
+		case "/api_jsonrpc.php":
+			body, _ := io.ReadAll(r.Body)
+			if r.Method != http.MethodPost || !strings.Contains(string(body), "host.get") {
+				t.Errorf("Expected POST with original body, got %s %q", r.Method, body)
+			}
+			json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": 1})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestZabbixClient_Redirects(t *testing.T) {
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "params": map[string]any{}, "id": 1}
+
+	for _, status := range []int{http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect} {
+		server := redirectServer(t, status)
+		client, err := Init(Zabbix{})
+		if err != nil {
+			t.Fatalf("Init failed: %v", err)
+		}
+		if _, err := client.SendToZabbix(context.Background(), server.URL+"/old", false, request); err != nil {
+			t.Errorf("HTTP %d: expected redirect to be followed, got %v", status, err)
+		}
+		client.Close()
+		server.Close()
+	}
+
+	server := redirectServer(t, http.StatusMovedPermanently)
+	defer server.Close()
+
+	client, err := Init(Zabbix{})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.SendToZabbix(context.Background(), server.URL+"/loop", false, request)
+	if err == nil || !strings.Contains(err.Error(), "too many redirects") {
+		t.Errorf("Expected too many redirects error, got %v", err)
+	}
+	_, err = client.SendToZabbix(context.Background(), server.URL+"/away", false, request)
+	if err == nil || !strings.Contains(err.Error(), "another host") {
+		t.Errorf("Expected another host error, got %v", err)
+	}
+
+	disabled := false
+	noFollow, err := Init(Zabbix{Redirects: RedirectConf{Follow: &disabled}})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer noFollow.Close()
+	_, err = noFollow.SendToZabbix(context.Background(), server.URL+"/old", false, request)
+	if err == nil || !strings.Contains(err.Error(), "redirects are disabled") {
+		t.Errorf("Expected redirects disabled error, got %v", err)
+	}
+}
+
+func TestRedirectTarget(t *testing.T) {
+	from, _ := url.Parse("https://zabbix.example/api_jsonrpc.php")
+	tests := []struct {
+		location string
+		ok       bool
+	}{
+		{"/zabbix/api_jsonrpc.php", true},
+		{"https://zabbix.example:8443/api_jsonrpc.php", true},
+		{"http://zabbix.example/api_jsonrpc.php", false},
+		{"https://other.example/api_jsonrpc.php", false},
+	}
+	for _, tt := range tests {
+		_, err := redirectTarget(from, tt.location)
+		if (err == nil) != tt.ok {
+			t.Errorf("redirectTarget(%q): ok=%v, got err %v", tt.location, tt.ok, err)
+		}
+	}
+
+	// Переход с HTTP на HTTPS на том же хосте допускается
+	plain, _ := url.Parse("http://zabbix.example/api_jsonrpc.php")
+	if _, err := redirectTarget(plain, "https://zabbix.example/api_jsonrpc.php"); err != nil {
+		t.Errorf("Expected HTTP to HTTPS upgrade to be allowed, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package zabbix
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ThrottledError сервер ограничил частоту запросов: HTTP 429 или 503 с заголовком Retry-After.
+// Сервер исправен, поэтому это не ошибка для Circuit Breaker
+type ThrottledError struct {
+	StatusCode int
+	// Пауза из Retry-After, 0 - заголовок не задан или не разобран
+	RetryAfter time.Duration
+	Detail     string
+}
+
+func (e *ThrottledError) Error() string {
+	return e.Detail
+}
+
+// AsThrottledError возвращает ошибку ограничения частоты, если err ею является
+func AsThrottledError(err error) (*ThrottledError, bool) {
+	var throttled *ThrottledError
+	if errors.As(err, &throttled) {
+		return throttled, true
+	}
+	return nil, false
+}
+
+// throttledResponse проверяет, что ответ сервера - ограничение частоты запросов.
+// 503 без Retry-After считается неисправностью сервера
+func throttledResponse(resp *http.Response, body []byte) (*ThrottledError, bool) {
+	retryAfter, hasHeader := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+	case resp.StatusCode == http.StatusServiceUnavailable && hasHeader:
+	default:
+		return nil, false
+	}
+	return &ThrottledError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: retryAfter,
+		Detail:     fmt.Sprintf("HTTP %d: %s, retry after %v, body: %s", resp.StatusCode, resp.Status, retryAfter, string(body)),
+	}, true
+}
+
+// parseRetryAfter разбирает Retry-After: число секунд или дата HTTP
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(value); err == nil {
+		if s < 0 {
+			return 0, false
+		}
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d.Round(time.Second), true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,76 @@
+package zabbix
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"30", 30 * time.Second, true},
+		{"-5", 0, false},
+		{"Wed, 01 May 2024 12:02:00 GMT", 2 * time.Minute, true},
+		{"Wed, 01 May 2024 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestZabbixClient_Throttled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/429":
+			w.Header().Set("Retry-After", "20")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/503-retry":
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	client, err := Init(Zabbix{})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1}
+	tests := []struct {
+		path       string
+		throttled  bool
+		retryAfter time.Duration
+	}{
+		{"/429", true, 20 * time.Second},
+		{"/503-retry", true, 7 * time.Second},
+		// 503 без Retry-After - неисправность сервера
+		{"/503", false, 0},
+	}
+	for _, tt := range tests {
+		_, err := client.SendToZabbix(context.Background(), server.URL+tt.path, false, request)
+		throttled, ok := AsThrottledError(err)
+		if ok != tt.throttled {
+			t.Errorf("%s: expected throttled=%v, got %v", tt.path, tt.throttled, err)
+			continue
+		}
+		if ok && throttled.RetryAfter != tt.retryAfter {
+			t.Errorf("%s: expected retry after %v, got %v", tt.path, tt.retryAfter, throttled.RetryAfter)
+		}
+	}
+}
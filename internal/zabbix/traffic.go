@@ -0,0 +1,61 @@
+package zabbix
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// TrafficStats объем тел запросов к серверу и ответов сервера в байтах
+type TrafficStats struct {
+	Sent     int64
+	Received int64
+}
+
+// hostTraffic счетчики одного сервера
+type hostTraffic struct {
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+// trafficCounter считает трафик серверов по host:port
+type trafficCounter struct {
+	hosts sync.Map // host:port -> *hostTraffic
+}
+
+func (t *trafficCounter) host(host string) *hostTraffic {
+	if h, ok := t.hosts.Load(host); ok {
+		return h.(*hostTraffic)
+	}
+	h, _ := t.hosts.LoadOrStore(host, &hostTraffic{})
+	return h.(*hostTraffic)
+}
+
+// stats возвращает трафик серверов по host:port
+func (t *trafficCounter) stats() map[string]TrafficStats {
+	stats := map[string]TrafficStats{}
+	t.hosts.Range(func(key, value any) bool {
+		h := value.(*hostTraffic)
+		stats[key.(string)] = TrafficStats{Sent: h.sent.Load(), Received: h.received.Load()}
+		return true
+	})
+	return stats
+}
+
+// countingReader считает прочитанные байты тела ответа
+type countingReader struct {
+	io.ReadCloser
+	counter *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.counter.Add(int64(n))
+	return n, err
+}
+
+// GetTrafficStats возвращает объем тел запросов и ответов по host:port серверов
+// с момента создания клиента
+func (c *zabbixClient) GetTrafficStats() map[string]TrafficStats {
+	return c.traffic.stats()
+}
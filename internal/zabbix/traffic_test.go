@@ -0,0 +1,49 @@
+package zabbix
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestZabbixClient_TrafficStats(t *testing.T) {
+	response := []byte(`{"jsonrpc":"2.0","result":[],"id":1}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/api_jsonrpc.php", http.StatusMovedPermanently)
+			return
+		}
+		w.Write(response)
+	}))
+	defer server.Close()
+
+	client, err := Init(Zabbix{})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1}
+	body, _ := json.Marshal(request)
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendToZabbix(context.Background(), server.URL, false, request); err != nil {
+			t.Fatalf("SendToZabbix failed: %v", err)
+		}
+	}
+	// Тело запроса отправляется повторно после перенаправления
+	if _, err := client.SendToZabbix(context.Background(), server.URL+"/old", false, request); err != nil {
+		t.Fatalf("SendToZabbix failed: %v", err)
+	}
+
+	u, _ := url.Parse(server.URL)
+	st := client.GetTrafficStats()[u.Host]
+	if st.Sent != int64(4*len(body)) {
+		t.Errorf("Expected %d bytes sent, got %d", 4*len(body), st.Sent)
+	}
+	if st.Received != int64(3*len(response)) {
+		t.Errorf("Expected %d bytes received, got %d", 3*len(response), st.Received)
+	}
+}
@@ -0,0 +1,94 @@
+package zabbix
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Адрес frontend на том же узле, что и proxy: unix:///path/to/socket:/api_jsonrpc.php
+const unixScheme = "unix://"
+
+// Суффикс служебного хоста, под которым запрос к unix сокету идет через http.Transport.
+// Хост содержит путь к сокету в hex, чтобы у каждого сокета был свой пул соединений
+const unixHostSuffix = ".unix-socket"
+
+// ParseUnixURL разбирает адрес unix:///path/to/socket:/api_jsonrpc.php на путь к сокету и путь запроса
+func ParseUnixURL(raw string) (socket, path string, ok bool) {
+	rest, ok := strings.CutPrefix(raw, unixScheme)
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndex(rest, ":/")
+	if i <= 0 {
+		return rest, "/", rest != ""
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// requestURL возвращает URL HTTP запроса к серверу. Адрес unix сокета заменяется
+// служебным хостом, который распознает dialContext
+func requestURL(raw string) string {
+	socket, path, ok := ParseUnixURL(raw)
+	if !ok {
+		return raw
+	}
+	return "http://" + hex.EncodeToString([]byte(socket)) + unixHostSuffix + path
+}
+
+// unixSocketFromHost возвращает путь к сокету служебного хоста
+func unixSocketFromHost(host string) (string, bool) {
+	encoded, ok := strings.CutSuffix(host, unixHostSuffix)
+	if !ok {
+		return "", false
+	}
+	socket, err := hex.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(socket), true
+}
+
+// hostKey возвращает имя сервера запроса (host:port или unix:путь к сокету)
+// для статистики сертификатов и трафика
+func hostKey(u *url.URL) string {
+	if socket, ok := unixSocketFromHost(u.Hostname()); ok {
+		return "unix:" + socket
+	}
+	return u.Host
+}
+
+// HostName возвращает имя сервера по URL: host:port или unix:путь к сокету
+func HostName(raw string) string {
+	if socket, _, ok := ParseUnixURL(raw); ok {
+		return "unix:" + socket
+	}
+	if parts := strings.Split(raw, "/"); len(parts) > 2 {
+		return parts[2]
+	}
+	return raw
+}
+
+// setUnixHost задает заголовок Host запроса к unix сокету вместо служебного хоста
+func setUnixHost(req *http.Request) {
+	if _, ok := unixSocketFromHost(req.URL.Hostname()); ok {
+		req.Host = "localhost"
+	}
+}
+
+// unixDialContext соединяется с unix сокетом для служебного хоста, с остальными - через dial
+func unixDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err == nil {
+			if socket, ok := unixSocketFromHost(host); ok {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
@@ -0,0 +1,73 @@
+package zabbix
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseUnixURL(t *testing.T) {
+	tests := []struct {
+		raw    string
+		socket string
+		path   string
+		ok     bool
+	}{
+		{"unix:///run/zabbix/frontend.sock:/api_jsonrpc.php", "/run/zabbix/frontend.sock", "/api_jsonrpc.php", true},
+		{"unix:///run/zabbix/frontend.sock:/zabbix/api_jsonrpc.php", "/run/zabbix/frontend.sock", "/zabbix/api_jsonrpc.php", true},
+		{"unix:///run/zabbix/frontend.sock", "/run/zabbix/frontend.sock", "/", true},
+		{"https://zabbix.example/api_jsonrpc.php", "", "", false},
+	}
+	for _, tt := range tests {
+		socket, path, ok := ParseUnixURL(tt.raw)
+		if socket != tt.socket || path != tt.path || ok != tt.ok {
+			t.Errorf("ParseUnixURL(%q) = %q, %q, %v; want %q, %q, %v", tt.raw, socket, path, ok, tt.socket, tt.path, tt.ok)
+		}
+	}
+
+	if got := HostName("unix:///run/zabbix/frontend.sock:/api_jsonrpc.php"); got != "unix:/run/zabbix/frontend.sock" {
+		t.Errorf("Unexpected unix host name %q", got)
+	}
+	if got := HostName("https://zabbix.example:8443/api_jsonrpc.php"); got != "zabbix.example:8443" {
+		t.Errorf("Unexpected host name %q", got)
+	}
+}
+
+func TestZabbixClient_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "frontend.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api_jsonrpc.php" || r.Host != "localhost" {
+			t.Errorf("Unexpected request %s to host %s", r.URL.Path, r.Host)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "result": "7.0.0", "id": 1})
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client, err := Init(Zabbix{})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+
+	url := "unix://" + socket + ":/api_jsonrpc.php"
+	request := map[string]any{"jsonrpc": "2.0", "method": "apiinfo.version", "id": 1}
+	response, err := client.SendToZabbix(context.Background(), url, false, request)
+	if err != nil {
+		t.Fatalf("SendToZabbix over unix socket failed: %v", err)
+	}
+	if response["result"] != "7.0.0" {
+		t.Errorf("Unexpected response %v", response)
+	}
+
+	if _, ok := client.GetTrafficStats()["unix:"+socket]; !ok {
+		t.Errorf("Expected traffic of unix:%s, got %v", socket, client.GetTrafficStats())
+	}
+}
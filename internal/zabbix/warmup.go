@@ -0,0 +1,81 @@
+package zabbix
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// WarmUpConf прогрев соединений с серверами: соединения (с TLS рукопожатием) устанавливаются
+// заранее и остаются в пуле idle, первый запрос после запуска их не ждет
+type WarmUpConf struct {
+	Connections int    `yaml:"connections"` // Соединений на сервер, 0 - прогрев отключен
+	Interval    string `yaml:"interval"`    // Повтор прогрева, пусто - только при запуске и перезагрузке
+}
+
+// Запрос прогрева: apiinfo.version не требует авторизации и не нагружает сервер
+var warmUpBody = []byte(`{"jsonrpc":"2.0","method":"apiinfo.version","params":{},"id":1}`)
+
+// idleConnsPerHost возвращает размер пула idle соединений клиента на хост
+func (c *zabbixClient) idleConnsPerHost(client *http.Client) int {
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return 0
+	}
+	n := transport.MaxIdleConnsPerHost
+	if n == 0 {
+		n = http.DefaultMaxIdleConnsPerHost
+	}
+	if transport.MaxConnsPerHost > 0 && transport.MaxConnsPerHost < n {
+		n = transport.MaxConnsPerHost
+	}
+	return n
+}
+
+// WarmUp устанавливает до conns соединений с сервером url одновременными запросами
+// apiinfo.version и оставляет их в пуле. Число соединений ограничено пулом idle
+// соединений на хост. Возвращает число успешных запросов и первую ошибку
+func (c *zabbixClient) WarmUp(ctx context.Context, url string, ignoreSSL bool, conns int) (int, error) {
+	client := c.getHTTPClient(ignoreSSL)
+	conns = min(conns, c.idleConnsPerHost(client))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		ok       int
+		firstErr error
+	)
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.warmUpConn(ctx, client, url)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				ok++
+			} else if firstErr == nil {
+				firstErr = err
+			}
+		}()
+	}
+	wg.Wait()
+	return ok, firstErr
+}
+
+// warmUpConn выполняет запрос прогрева. Тело ответа дочитывается, чтобы соединение вернулось в пул
+func (c *zabbixClient) warmUpConn(ctx context.Context, client *http.Client, url string) error {
+	req, err := newJSONRequest(ctx, url, warmUpBody)
+	if err != nil {
+		return err
+	}
+	resp, err := c.doFollowingRedirects(ctx, client, req, warmUpBody)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return err
+}
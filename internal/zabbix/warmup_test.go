@@ -0,0 +1,85 @@
+package zabbix
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestZabbixClient_WarmUp(t *testing.T) {
+	// Запросы прогрева ждут друг друга, чтобы каждый занял отдельное соединение
+	var (
+		newConns atomic.Int32
+		arrived  sync.WaitGroup
+		warmUps  = 3
+	)
+	arrived.Add(warmUps)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]any
+		json.NewDecoder(r.Body).Decode(&request)
+		if request["method"] == "apiinfo.version" {
+			arrived.Done()
+			arrived.Wait()
+		}
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "result": "7.0.0", "id": request["id"]})
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	cfg := Zabbix{}
+	cfg.Limits.MaxRequestsByZBX = 20
+	client, err := Init(cfg)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n, err := client.WarmUp(ctx, server.URL, true, warmUps)
+	if err != nil || n != warmUps {
+		t.Fatalf("Expected %d warmed connections, got %d, %v", warmUps, n, err)
+	}
+	if got := newConns.Load(); got != int32(warmUps) {
+		t.Errorf("Expected %d new connections, got %d", warmUps, got)
+	}
+
+	// Запрос после прогрева использует соединение из пула
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "id": 1}
+	if _, err := client.SendToZabbix(ctx, server.URL, true, request); err != nil {
+		t.Fatalf("SendToZabbix failed: %v", err)
+	}
+	if got := newConns.Load(); got != int32(warmUps) {
+		t.Errorf("Expected request to reuse a warmed connection, got %d connections", got)
+	}
+}
+
+func TestZabbixClient_WarmUpLimitedByIdlePool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"7.0.0","id":1}`))
+	}))
+	defer server.Close()
+
+	// Без лимитов пул idle соединений на хост - http.DefaultMaxIdleConnsPerHost
+	client, err := Init(Zabbix{})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+
+	n, err := client.WarmUp(context.Background(), server.URL, false, 10)
+	if err != nil || n != http.DefaultMaxIdleConnsPerHost {
+		t.Errorf("Expected %d warmed connections, got %d, %v", http.DefaultMaxIdleConnsPerHost, n, err)
+	}
+}
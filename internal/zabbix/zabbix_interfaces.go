@@ -10,6 +10,10 @@ type ZabbixClient interface {
 	SendToZabbix(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error)
 	Close()
 	GetClientsCount() int
+	GetDNSStats() map[string]DNSStats
+	GetCertStats() map[string]CertStats
+	GetTrafficStats() map[string]TrafficStats
+	WarmUp(ctx context.Context, url string, ignoreSSL bool, conns int) (int, error)
 }
 
 // Убедитесь, что ZabbixClient реализует интерфейс
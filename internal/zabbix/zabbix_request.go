@@ -6,9 +6,12 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,6 +24,32 @@ type ZabbixServer struct {
 	Token     string `yaml:"token"`
 	IgnoreSSL bool   `yaml:"ignore_ssl"`
 	Name      string `yaml:"name"`
+
+	// Тестовый Zabbix, на который асинхронно дублируются читающие запросы
+	MirrorTo    string `yaml:"mirror_to"`
+	MirrorToken string `yaml:"mirror_token"`
+
+	// Альтернативный upstream, получающий canary_percent процентов трафика сервера
+	CanaryURL     string `yaml:"canary_url"`
+	CanaryToken   string `yaml:"canary_token"`
+	CanaryPercent int    `yaml:"canary_percent"`
+
+	// Дополнительные URL того же логического сервера (frontend одного Zabbix).
+	// Основной url участвует в балансировке с весом weight
+	Replicas []ZabbixReplica `yaml:"replicas"`
+	Weight   int             `yaml:"weight"`
+	Balance  string          `yaml:"balance"` // weighted (по умолчанию) или least_latency
+
+	// Ограничение частоты запросов к серверу (token bucket), 0 - без ограничения
+	RateLimit    float64 `yaml:"rate_limit"`     // Запросов в секунду
+	RateBurst    int     `yaml:"rate_burst"`     // Размер корзины, по умолчанию rate_limit
+	RateMaxDelay string  `yaml:"rate_max_delay"` // Максимальное ожидание в очереди, по умолчанию 1s
+}
+
+// ZabbixReplica реплика логического сервера
+type ZabbixReplica struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"` // По умолчанию 1
 }
 
 type Zabbix struct {
@@ -36,6 +65,21 @@ type Zabbix struct {
 
 	Servers    []ZabbixServer `yaml:"servers"`
 	APIversion string         `yaml:"api.version"`
+
+	// Кеширование и перепроверка DNS адресов серверов
+	DNS DNSConf `yaml:"dns"`
+
+	// Динамическое получение списка серверов (Consul, DNS SRV)
+	Discovery DiscoveryConf `yaml:"discovery"`
+
+	// Следование перенаправлениям frontend (HTTP 301/302)
+	Redirects RedirectConf `yaml:"redirects"`
+
+	// Прогрев соединений с серверами при запуске и перезагрузке
+	WarmUp WarmUpConf `yaml:"warm_up"`
+
+	// Контроль сроков сертификатов серверов
+	TLS TLSConf `yaml:"tls"`
 }
 
 type zabbixClient struct {
@@ -43,16 +87,36 @@ type zabbixClient struct {
 	clients    map[bool]*http.Client
 	clientsMux sync.RWMutex
 	conf       Zabbix
+	// Кеш DNS (nil, если кеширование отключено)
+	dns *dnsCache
+	// Сроки сертификатов серверов
+	certs *certTracker
+	// Трафик серверов
+	traffic trafficCounter
 }
 
+// SendToZabbix выполняет запрос к серверу. Текст ошибки не содержит токенов:
+// он попадает в логи и в ответ клиенту
 func (c *zabbixClient) SendToZabbix(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
-	return c.sendToZabbix(ctx, url, ignoreSSL, request)
+	response, err := c.sendToZabbix(ctx, url, ignoreSSL, request)
+	return response, logger.RedactError(err)
 }
 
 // Инициализирует клиент для полкоючения к Zabbix
 func Init(cfg Zabbix) (*zabbixClient, error) {
 	client := zabbixClient{clients: make(map[bool]*http.Client),
-		conf: cfg}
+		conf:  cfg,
+		certs: newCertTracker(cfg.TLS)}
+
+	// Кеширование DNS включается только при заданном TTL
+	if cfg.DNS.TTL != "" {
+		if s, err := suffix.ToSeconds(cfg.DNS.TTL); err != nil {
+			logger.Global.Errorf("convert error 'dns.ttl' to seconds: %v. DNS caching disabled", err)
+		} else if s > 0 {
+			client.dns = newDNSCache(time.Duration(s)*time.Second, func(string) { client.closeIdleConnections() })
+			client.dns.start()
+		}
+	}
 
 	// Проверяем переменную для лимита тела ответа
 	// Если пуста, задаем дефольное значение
@@ -74,6 +138,10 @@ func Init(cfg Zabbix) (*zabbixClient, error) {
 
 // Добавляем graceful shutdown для HTTP клиентов
 func (c *zabbixClient) Close() {
+	if c.dns != nil {
+		c.dns.close()
+	}
+
 	c.clientsMux.Lock()
 	defer c.clientsMux.Unlock()
 
@@ -88,6 +156,18 @@ func (c *zabbixClient) Close() {
 	c.clients = make(map[bool]*http.Client)
 }
 
+// closeIdleConnections закрывает idle соединения всех клиентов,
+// чтобы новые запросы установили соединения по актуальным адресам
+func (c *zabbixClient) closeIdleConnections() {
+	c.clientsMux.RLock()
+	defer c.clientsMux.RUnlock()
+	for _, client := range c.clients {
+		if transport, ok := client.Transport.(*http.Transport); ok {
+			transport.CloseIdleConnections()
+		}
+	}
+}
+
 // Выделение транспорта для подключения к серверу
 func (c *zabbixClient) getHTTPClient(ignoreSSL bool) *http.Client {
 	//Блокируем изменение
@@ -133,15 +213,36 @@ func (c *zabbixClient) getHTTPClient(ignoreSSL bool) *http.Client {
 		//TLSHandshakeTimeout:   10 * time.Second,
 	}
 
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dial := dialer.DialContext
+	if c.dns != nil {
+		dial = c.dns.dialContext(dialer)
+	}
+	// Адреса unix:///path/to/socket:/api_jsonrpc.php - соединение через unix сокет
+	transport.DialContext = unixDialContext(dial)
+
 	client = &http.Client{
 		Transport: transport,
 		Timeout:   time.Duration(maxTimeoutToZbx) * time.Second,
+		// Перенаправления обрабатываются в doFollowingRedirects
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
 	}
 
 	c.clients[ignoreSSL] = client
 	return client
 }
 
+// newJSONRequest создает POST запрос JSON-RPC к серверу
+func newJSONRequest(ctx context.Context, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", requestURL(url), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	setUnixHost(req)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
 // Делаем запрос к ZabbixServer
 func (c *zabbixClient) sendToZabbix(ctx context.Context, url string, ignoreSSL bool, request map[string]any) (map[string]any, error) {
 	client := c.getHTTPClient(ignoreSSL)
@@ -151,13 +252,12 @@ func (c *zabbixClient) sendToZabbix(ctx context.Context, url string, ignoreSSL b
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(requestBody))
+	req, err := newJSONRequest(ctx, url, requestBody)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(req)
+	resp, err := c.doFollowingRedirects(ctx, client, req, requestBody)
 	if err != nil {
 		return nil, err
 	}
@@ -166,6 +266,9 @@ func (c *zabbixClient) sendToZabbix(ctx context.Context, url string, ignoreSSL b
 	// Проверяем код и читаем тело ошибки
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if throttled, ok := throttledResponse(resp, body); ok {
+			return nil, throttled
+		}
 		return nil, fmt.Errorf("HTTP %d: %s, body: %s", resp.StatusCode, resp.Status, string(body))
 	}
 
@@ -181,20 +284,162 @@ func (c *zabbixClient) sendToZabbix(ctx context.Context, url string, ignoreSSL b
 		if len(preview) > 100 {
 			preview = string(body[:100]) + "..."
 		}
-		logger.Global.Warningf("Invalid JSON response from %s: %s", url, preview)
-		return nil, fmt.Errorf("invalid JSON response: %v", err)
+		logger.WithContext(ctx).Warningf("Invalid JSON response from %s: %s", url, preview)
+		return nil, &InvalidResponseError{Reason: InvalidJSON, Detail: fmt.Sprintf("invalid JSON response: %v", err)}
+	}
+
+	if err := validateEnvelope(request, response); err != nil {
+		logger.WithContext(ctx).Warningf("Invalid response from %s: %v", url, err)
+		return nil, err
 	}
 
 	if _, ok := response["error"]; ok {
+		if obj, ok := response["error"].(map[string]any); ok {
+			return nil, newAPIError(obj)
+		}
 		return nil, fmt.Errorf("%v", response["error"])
 	}
 
 	return response, nil
 }
 
+// Причины непригодности ответа сервера
+const (
+	InvalidJSON     = "json"     // Тело ответа не JSON (например HTML страница ошибки)
+	InvalidEnvelope = "envelope" // JSON без конверта JSON-RPC (нет result и error, неверный jsonrpc)
+	InvalidID       = "id"       // id ответа не совпадает с id запроса
+)
+
+// InvalidResponseError ответ сервера не является ответом JSON-RPC на запрос.
+// Так отвечает, например, frontend за сломанным PHP-FPM со статусом 200
+type InvalidResponseError struct {
+	Reason string
+	Detail string
+}
+
+func (e *InvalidResponseError) Error() string {
+	return e.Detail
+}
+
+// InvalidResponseReason возвращает причину, если ошибка - непригодный ответ сервера
+func InvalidResponseReason(err error) (string, bool) {
+	var invalid *InvalidResponseError
+	if errors.As(err, &invalid) {
+		return invalid.Reason, true
+	}
+	return "", false
+}
+
+// validateEnvelope проверяет конверт JSON-RPC ответа: наличие result или error,
+// версию протокола и совпадение id с id запроса (если он задан)
+func validateEnvelope(request, response map[string]any) error {
+	_, hasResult := response["result"]
+	_, hasError := response["error"]
+	if !hasResult && !hasError {
+		return &InvalidResponseError{Reason: InvalidEnvelope, Detail: "invalid JSON-RPC response: no result or error"}
+	}
+	if v, ok := response["jsonrpc"]; ok && v != "2.0" {
+		return &InvalidResponseError{Reason: InvalidEnvelope, Detail: fmt.Sprintf("invalid JSON-RPC response: jsonrpc %v", v)}
+	}
+
+	// Числовой id после разбора JSON - float64, поэтому сравниваем представление в JSON
+	if id, ok := request["id"]; ok && id != nil {
+		want, _ := json.Marshal(id)
+		got, _ := json.Marshal(response["id"])
+		if !bytes.Equal(want, got) {
+			return &InvalidResponseError{Reason: InvalidID, Detail: fmt.Sprintf("invalid JSON-RPC response: id %v, expected %v", response["id"], id)}
+		}
+	}
+	return nil
+}
+
+// Коды ошибок JSON-RPC, которыми отвечает Zabbix
+const (
+	codeParseError       = -32700
+	codeInvalidRequest   = -32600
+	codeMethodNotFound   = -32601
+	codeInvalidParams    = -32602
+	codeApplicationError = -32500
+)
+
+// Сообщения ошибки приложения (-32500), вызванной самим запросом, а не сбоем сервера
+var permanentErrorMessages = []string{
+	"no permissions",
+	"does not exist",
+	"not authorized",
+	"not authorised",
+	"session terminated",
+	"incorrect",
+	"invalid parameter",
+	"already exists",
+}
+
+// APIError ошибка, которой Zabbix ответил на запрос. Object - исходный объект
+// ошибки из ответа, он возвращается клиенту без изменений
+type APIError struct {
+	Code    int
+	Message string
+	Data    string
+	Object  map[string]any
+}
+
+func newAPIError(obj map[string]any) *APIError {
+	e := &APIError{Object: obj}
+	if code, ok := obj["code"].(float64); ok {
+		e.Code = int(code)
+	}
+	e.Message, _ = obj["message"].(string)
+	e.Data, _ = obj["data"].(string)
+	return e
+}
+
+// Error возвращает исходный объект ошибки в JSON
+func (e *APIError) Error() string {
+	data, err := json.Marshal(e.Object)
+	if err != nil {
+		return fmt.Sprintf("%v", e.Object)
+	}
+	return string(data)
+}
+
+// Permanent сообщает, что ошибка вызвана запросом клиента (неверные параметры,
+// нет прав) и повторится на исправном сервере. Такие ошибки не говорят о сбое сервера
+func (e *APIError) Permanent() bool {
+	switch e.Code {
+	case codeParseError, codeInvalidRequest, codeMethodNotFound, codeInvalidParams:
+		return true
+	case codeApplicationError:
+		// Ошибка приложения бывает и сбоем сервера (ошибка БД), различаем по тексту
+		text := strings.ToLower(e.Message + " " + e.Data)
+		for _, msg := range permanentErrorMessages {
+			if strings.Contains(text, msg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AsAPIError возвращает ошибку Zabbix, если запрос завершился ею
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
 // Мониторинг состояния
 func (c *zabbixClient) GetClientsCount() int {
 	c.clientsMux.RLock()
 	defer c.clientsMux.RUnlock()
 	return len(c.clients)
 }
+
+// Состояние разрешения имен серверов (nil, если кеширование DNS отключено)
+func (c *zabbixClient) GetDNSStats() map[string]DNSStats {
+	if c.dns == nil {
+		return nil
+	}
+	return c.dns.stats()
+}
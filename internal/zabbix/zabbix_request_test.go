@@ -12,6 +12,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"ZabbixAPIproxy/internal/logger"
 )
 
 // TestZabbixClient_SendToZabbix тестирует базовую функциональность с реальным HTTP сервером
@@ -58,6 +60,23 @@ func TestZabbixClient_SendToZabbix(t *testing.T) {
 			w.Header().Set("Content-Type", "application/json")
 			w.Write([]byte("invalid json"))
 
+		case "/html":
+			// Frontend за сломанным PHP-FPM отвечает страницей ошибки со статусом 200
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>502 Bad Gateway</body></html>"))
+
+		case "/no-envelope":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"ok"}`))
+
+		case "/wrong-id":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"jsonrpc":"2.0","result":[],"id":2}`))
+
+		case "/zabbix-error":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params.","data":"Incorrect API \"host.gett\"."},"id":1}`))
+
 		case "/large-response":
 			// Создаем большой ответ для тестирования лимитов
 			largeData := make([]map[string]any, 1000)
@@ -130,6 +149,50 @@ func TestZabbixClient_SendToZabbix(t *testing.T) {
 			expectError:   true,
 			errorContains: "invalid JSON",
 		},
+		{
+			name: "HTML response",
+			url:  server.URL + "/html",
+			request: map[string]any{
+				"method": "host.get",
+				"params": map[string]any{},
+			},
+			expectError:   true,
+			errorContains: "invalid JSON",
+		},
+		{
+			name: "no JSON-RPC envelope",
+			url:  server.URL + "/no-envelope",
+			request: map[string]any{
+				"method": "host.get",
+				"params": map[string]any{},
+			},
+			expectError:   true,
+			errorContains: "no result or error",
+		},
+		{
+			name: "id mismatch",
+			url:  server.URL + "/wrong-id",
+			request: map[string]any{
+				"jsonrpc": "2.0",
+				"method":  "host.get",
+				"params":  map[string]any{},
+				"id":      1,
+			},
+			expectError:   true,
+			errorContains: "expected 1",
+		},
+		{
+			name: "Zabbix error",
+			url:  server.URL + "/zabbix-error",
+			request: map[string]any{
+				"jsonrpc": "2.0",
+				"method":  "host.gett",
+				"params":  map[string]any{},
+				"id":      1,
+			},
+			expectError:   true,
+			errorContains: "Invalid params.",
+		},
 	}
 
 	for _, tt := range tests {
@@ -155,6 +218,92 @@ func TestZabbixClient_SendToZabbix(t *testing.T) {
 	}
 }
 
+// TestValidateEnvelope тестирует проверку конверта JSON-RPC ответа
+func TestValidateEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  map[string]any
+		response map[string]any
+		reason   string
+	}{
+		{"result", map[string]any{"id": 1}, map[string]any{"jsonrpc": "2.0", "result": []any{}, "id": 1.0}, ""},
+		{"error", map[string]any{"id": "a"}, map[string]any{"jsonrpc": "2.0", "error": map[string]any{}, "id": "a"}, ""},
+		{"large numeric id", map[string]any{"id": 12345678}, map[string]any{"result": []any{}, "id": 12345678.0}, ""},
+		{"request without id", map[string]any{}, map[string]any{"result": []any{}}, ""},
+		{"no result", map[string]any{"id": 1}, map[string]any{"jsonrpc": "2.0", "id": 1.0}, InvalidEnvelope},
+		{"wrong version", map[string]any{}, map[string]any{"jsonrpc": "1.0", "result": []any{}}, InvalidEnvelope},
+		{"wrong id", map[string]any{"id": 1}, map[string]any{"result": []any{}, "id": 2.0}, InvalidID},
+		{"missing id", map[string]any{"id": 1}, map[string]any{"result": []any{}}, InvalidID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, invalid := InvalidResponseReason(validateEnvelope(tt.request, tt.response))
+			if tt.reason == "" && invalid {
+				t.Errorf("Unexpected invalid response: %s", reason)
+			}
+			if tt.reason != "" && reason != tt.reason {
+				t.Errorf("Expected reason %q, got %q", tt.reason, reason)
+			}
+		})
+	}
+
+	if _, ok := InvalidResponseReason(fmt.Errorf("wrapped: %w", &InvalidResponseError{Reason: InvalidJSON})); !ok {
+		t.Error("Expected wrapped invalid response error to be recognized")
+	}
+}
+
+// TestAPIError тестирует разбор и классификацию ошибок Zabbix
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params.","data":"Incorrect API \"host.gett\"."},"id":1}`))
+	}))
+	defer server.Close()
+
+	client, err := Init(Zabbix{})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.SendToZabbix(context.Background(), server.URL, false, map[string]any{"jsonrpc": "2.0", "method": "host.gett", "id": 1})
+	apiErr, ok := AsAPIError(err)
+	if !ok {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+	if apiErr.Code != -32602 || apiErr.Message != "Invalid params." || apiErr.Data != `Incorrect API "host.gett".` {
+		t.Errorf("Unexpected APIError fields: %+v", apiErr)
+	}
+	// Текст ошибки - исходный объект в JSON
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(err.Error()), &obj); err != nil || obj["message"] != "Invalid params." {
+		t.Errorf("Expected error object in JSON, got %s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		code      float64
+		data      string
+		permanent bool
+	}{
+		{"invalid params", -32602, "Invalid parameter \"/1\": unexpected parameter \"foo\".", true},
+		{"method not found", -32601, "", true},
+		{"no permissions", -32500, "No permissions to referred object or it does not exist!", true},
+		{"session terminated", -32500, "Session terminated, re-login, please.", true},
+		{"database error", -32500, "SQL statement execution has failed.", false},
+		{"unknown code", -1, "Invalid params.", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newAPIError(map[string]any{"code": tt.code, "message": "Application error.", "data": tt.data})
+			if e.Permanent() != tt.permanent {
+				t.Errorf("Expected Permanent() = %v for %s", tt.permanent, tt.data)
+			}
+		})
+	}
+}
+
 // TestZabbixClient_Init тестирует инициализацию клиента
 func TestZabbixClient_Init(t *testing.T) {
 	tests := []struct {
@@ -461,3 +610,44 @@ func TestZabbixClient_Close(t *testing.T) {
 		t.Errorf("Expected 2 clients after close, got %d", client.GetClientsCount())
 	}
 }
+
+// TestZabbixClient_TokenRedacted тестирует, что токен сервера не попадает в текст ошибок
+func TestZabbixClient_TokenRedacted(t *testing.T) {
+	const token = "upstream-secret-token"
+	logger.SetSecrets(token)
+	defer logger.SetSecrets()
+
+	// Сервер возвращает в ошибке тело запроса, содержащее токен
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/zabbix-error" {
+			json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1,
+				"error": map[string]any{"code": -32602, "message": "Invalid params.", "data": string(body)}})
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client, err := Init(Zabbix{})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer client.Close()
+
+	request := map[string]any{"jsonrpc": "2.0", "method": "host.get", "auth": token, "id": 1}
+	_, err = client.SendToZabbix(context.Background(), server.URL, false, request)
+	if err == nil || strings.Contains(err.Error(), token) {
+		t.Errorf("Expected error without token, got %v", err)
+	}
+
+	// Тип ошибки Zabbix сохраняется
+	_, err = client.SendToZabbix(context.Background(), server.URL+"/zabbix-error", false, request)
+	if strings.Contains(err.Error(), token) {
+		t.Errorf("Expected error without token, got %v", err)
+	}
+	if apiErr, ok := AsAPIError(err); !ok || apiErr.Code != -32602 {
+		t.Errorf("Expected APIError, got %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+// Package zabbixmock - фиктивный сервер Zabbix API для интеграционных тестов
+// и нагрузочного тестирования прокси без реальных серверов Zabbix
+package zabbixmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Коды ошибок JSON-RPC, которыми отвечает Zabbix
+const (
+	codeInvalidParams  = -32602
+	codeMethodNotFound = -32601
+	codeParseError     = -32700
+)
+
+// Версия API по умолчанию
+const defaultVersion = "7.0.0"
+
+// Dataset данные и поведение фиктивного сервера
+type Dataset struct {
+	// ID сервера в прокси (для режима -mock)
+	ID int `yaml:"id" json:"id"`
+	// Ответ apiinfo.version, по умолчанию 7.0.0
+	Version string `yaml:"version" json:"version"`
+	// Токен, который должен быть в поле auth запроса, пусто - не проверяется
+	Token string `yaml:"token" json:"token"`
+	// Задержка каждого ответа и ее случайная добавка (0..jitter)
+	Latency time.Duration `yaml:"latency" json:"latency"`
+	Jitter  time.Duration `yaml:"jitter" json:"jitter"`
+
+	Hosts      []map[string]any `yaml:"hosts" json:"hosts"`
+	HostGroups []map[string]any `yaml:"hostgroups" json:"hostgroups"`
+	Items      []map[string]any `yaml:"items" json:"items"`
+	History    []map[string]any `yaml:"history" json:"history"`
+
+	// Сгенерировать данные в дополнение к заданным
+	Generate GenerateConf `yaml:"generate" json:"generate"`
+}
+
+// GenerateConf размер генерируемого набора данных
+type GenerateConf struct {
+	Hosts        int `yaml:"hosts" json:"hosts"`
+	ItemsPerHost int `yaml:"items_per_host" json:"items_per_host"`
+	// Значений истории на элемент данных, с шагом в минуту до текущего времени
+	HistoryPerItem int `yaml:"history_per_item" json:"history_per_item"`
+}
+
+// Server фиктивный сервер Zabbix API
+type Server struct {
+	data Dataset
+	// Количество обработанных запросов
+	requests atomic.Int64
+}
+
+// New создает сервер с набором данных. Генерируемые данные добавляются к заданным
+func New(data Dataset) *Server {
+	if data.Version == "" {
+		data.Version = defaultVersion
+	}
+	data.generate()
+	return &Server{data: data}
+}
+
+// Requests возвращает количество обработанных запросов
+func (s *Server) Requests() int64 {
+	return s.requests.Load()
+}
+
+// generate дополняет набор данных группой, узлами, элементами данных и историей.
+// Имена содержат ID сервера, поэтому не совпадают у разных серверов
+func (d *Dataset) generate() {
+	g := d.Generate
+	if g.Hosts <= 0 {
+		return
+	}
+	groupID := strconv.Itoa(100 + len(d.HostGroups))
+	d.HostGroups = append(d.HostGroups, map[string]any{"groupid": groupID, "name": "Mock servers"})
+
+	now := time.Now().Unix()
+	for h := range g.Hosts {
+		hostID := strconv.Itoa(10000 + len(d.Hosts))
+		name := fmt.Sprintf("mock-%d-host-%d", d.ID, h)
+		d.Hosts = append(d.Hosts, map[string]any{
+			"hostid": hostID, "host": name, "name": name, "status": "0",
+			"groups": []any{map[string]any{"groupid": groupID}},
+		})
+		for i := range g.ItemsPerHost {
+			itemID := strconv.Itoa(20000 + len(d.Items))
+			d.Items = append(d.Items, map[string]any{
+				"itemid": itemID, "hostid": hostID, "name": fmt.Sprintf("Metric %d", i),
+				"key_": fmt.Sprintf("mock.metric[%d]", i), "value_type": "0",
+			})
+			for v := range g.HistoryPerItem {
+				clock := now - int64(g.HistoryPerItem-v)*60
+				d.History = append(d.History, map[string]any{
+					"itemid": itemID, "clock": strconv.FormatInt(clock, 10),
+					"value": strconv.Itoa(v), "ns": "0",
+				})
+			}
+		}
+	}
+}
+
+// ServeHTTP обрабатывает запрос JSON-RPC
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+
+	var request map[string]any
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16<<20)).Decode(&request); err != nil {
+		writeResponse(w, map[string]any{"jsonrpc": "2.0", "error": rpcError(codeParseError, "Parse error.", "Invalid JSON."), "id": nil})
+		return
+	}
+
+	if delay := s.delay(); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	response := map[string]any{"jsonrpc": "2.0", "id": request["id"]}
+	if result, err := s.call(request); err != nil {
+		response["error"] = err
+	} else {
+		response["result"] = result
+	}
+	writeResponse(w, response)
+}
+
+// delay возвращает задержку ответа
+func (s *Server) delay() time.Duration {
+	d := s.data.Latency
+	if s.data.Jitter > 0 {
+		d += time.Duration(time.Now().UnixNano() % int64(s.data.Jitter))
+	}
+	return d
+}
+
+// call выполняет метод API. Возвращает результат или объект ошибки JSON-RPC
+func (s *Server) call(request map[string]any) (any, map[string]any) {
+	method, _ := request["method"].(string)
+	params, _ := request["params"].(map[string]any)
+
+	if method == "apiinfo.version" {
+		return s.data.Version, nil
+	}
+	if auth, _ := request["auth"].(string); s.data.Token != "" && auth != s.data.Token {
+		return nil, rpcError(codeInvalidParams, "Invalid params.", "Not authorized.")
+	}
+
+	var (
+		rows   []map[string]any
+		idKeys map[string]string
+	)
+	switch method {
+	case "host.get":
+		rows, idKeys = s.data.Hosts, map[string]string{"hostids": "hostid", "groupids": "groups.groupid"}
+	case "hostgroup.get":
+		rows, idKeys = s.data.HostGroups, map[string]string{"groupids": "groupid"}
+	case "item.get":
+		rows, idKeys = s.data.Items, map[string]string{"itemids": "itemid", "hostids": "hostid"}
+	case "history.get":
+		rows, idKeys = s.data.History, map[string]string{"itemids": "itemid"}
+		rows = filterTime(rows, params)
+	default:
+		return nil, rpcError(codeMethodNotFound, "Method not found.", "Incorrect API \""+method+"\".")
+	}
+	return selectRows(rows, params, idKeys), nil
+}
+
+// selectRows отбирает строки по параметрам *ids, filter и limit
+func selectRows(rows []map[string]any, params map[string]any, idKeys map[string]string) []any {
+	filter, _ := params["filter"].(map[string]any)
+	limit := intParam(params["limit"])
+
+	result := []any{}
+	for _, row := range rows {
+		if !matchIDs(row, params, idKeys) || !matchFilter(row, filter) {
+			continue
+		}
+		result = append(result, cloneRow(row))
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result
+}
+
+// matchIDs проверяет параметры вида hostids: строка соответствует, если ее поле
+// (или поле вложенного списка для "groups.groupid") входит в переданные ID
+func matchIDs(row, params map[string]any, idKeys map[string]string) bool {
+	for param, field := range idKeys {
+		ids := stringList(params[param])
+		if ids == nil {
+			continue
+		}
+		parent, child, nested := strings.Cut(field, ".")
+		if !nested {
+			if !slices.Contains(ids, fmt.Sprint(row[field])) {
+				return false
+			}
+			continue
+		}
+		list, _ := row[parent].([]any)
+		found := false
+		for _, item := range list {
+			if m, ok := item.(map[string]any); ok && slices.Contains(ids, fmt.Sprint(m[child])) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchFilter проверяет точное совпадение полей filter (значение или список значений)
+func matchFilter(row, filter map[string]any) bool {
+	for field, want := range filter {
+		values := stringList(want)
+		if values == nil {
+			continue
+		}
+		if !slices.Contains(values, fmt.Sprint(row[field])) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterTime отбирает значения истории по time_from и time_till и сортирует по времени
+func filterTime(rows []map[string]any, params map[string]any) []map[string]any {
+	from, till := intParam(params["time_from"]), intParam(params["time_till"])
+	var result []map[string]any
+	for _, row := range rows {
+		clock, _ := strconv.Atoi(fmt.Sprint(row["clock"]))
+		if (from > 0 && clock < from) || (till > 0 && clock > till) {
+			continue
+		}
+		result = append(result, row)
+	}
+	if params["sortorder"] == "DESC" {
+		slices.Reverse(result)
+	}
+	return result
+}
+
+// stringList приводит параметр (значение или список) к списку строк, nil - параметр не задан
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// intParam приводит числовой параметр (число или строка) к int
+func intParam(v any) int {
+	switch v := v.(type) {
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+// cloneRow копирует строку, что бы изменения ответа не затрагивали набор данных
+func cloneRow(row map[string]any) map[string]any {
+	data, _ := json.Marshal(row)
+	var clone map[string]any
+	json.Unmarshal(data, &clone)
+	return clone
+}
+
+func rpcError(code int, message, data string) map[string]any {
+	return map[string]any{"code": code, "message": message, "data": data}
+}
+
+func writeResponse(w http.ResponseWriter, response map[string]any) {
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf.Bytes())
+}
+
+// Start запускает сервер на свободном порту 127.0.0.1. Возвращает URL API
+// (http://127.0.0.1:port/api_jsonrpc.php) и функцию остановки
+func (s *Server) Start() (string, func(), error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	srv := &http.Server{Handler: s}
+	go srv.Serve(l)
+	return "http://" + l.Addr().String() + "/api_jsonrpc.php", func() { srv.Close() }, nil
+}
+
+// Load читает наборы данных фиктивных серверов из YAML (или JSON) файла вида
+// servers: [{id: 1, latency: 20ms, generate: {hosts: 10, items_per_host: 5}}]
+func Load(path string) ([]Dataset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Servers []Dataset `yaml:"servers"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if len(file.Servers) == 0 {
+		return nil, fmt.Errorf("%s: no servers", path)
+	}
+	for i := range file.Servers {
+		if file.Servers[i].ID == 0 {
+			file.Servers[i].ID = i + 1
+		}
+	}
+	return file.Servers, nil
+}
@@ -0,0 +1,159 @@
+package zabbixmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// call отправляет запрос JSON-RPC фиктивному серверу
+func call(t *testing.T, s *Server, request map[string]any) map[string]any {
+	t.Helper()
+	body, _ := json.Marshal(request)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api_jsonrpc.php", bytes.NewReader(body)))
+
+	var response map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+	if response["id"] != request["id"] {
+		t.Errorf("response id = %v, expected %v", response["id"], request["id"])
+	}
+	return response
+}
+
+// TestServer_Get проверяет отбор сущностей по ID, filter и limit
+func TestServer_Get(t *testing.T) {
+	s := New(Dataset{ID: 2, Generate: GenerateConf{Hosts: 3, ItemsPerHost: 2}})
+
+	tests := []struct {
+		name     string
+		method   string
+		params   map[string]any
+		expected int
+	}{
+		{"all hosts", "host.get", map[string]any{}, 3},
+		{"hostids", "host.get", map[string]any{"hostids": []any{"10000", 10002}}, 2},
+		{"groupids", "host.get", map[string]any{"groupids": "100"}, 3},
+		{"filter", "host.get", map[string]any{"filter": map[string]any{"host": "mock-2-host-1"}}, 1},
+		{"limit", "item.get", map[string]any{"limit": 4}, 4},
+		{"items by host", "item.get", map[string]any{"hostids": "10001"}, 2},
+		{"unknown id", "item.get", map[string]any{"itemids": []any{"1"}}, 0},
+		{"groups", "hostgroup.get", map[string]any{}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := call(t, s, map[string]any{"jsonrpc": "2.0", "method": tt.method, "params": tt.params, "id": float64(1)})
+			result, ok := response["result"].([]any)
+			if !ok {
+				t.Fatalf("result is not a list: %v", response)
+			}
+			if len(result) != tt.expected {
+				t.Errorf("%s returned %d entities, expected %d", tt.method, len(result), tt.expected)
+			}
+		})
+	}
+}
+
+// TestServer_History проверяет отбор истории по элементам данных и времени
+func TestServer_History(t *testing.T) {
+	s := New(Dataset{Generate: GenerateConf{Hosts: 1, ItemsPerHost: 2, HistoryPerItem: 5}})
+	now := time.Now().Unix()
+
+	response := call(t, s, map[string]any{"method": "history.get", "id": "a", "params": map[string]any{
+		"itemids": "20000", "time_from": float64(now - 150), "sortorder": "DESC",
+	}})
+	result := response["result"].([]any)
+	if len(result) != 2 {
+		t.Fatalf("history.get returned %d values, expected 2: %v", len(result), result)
+	}
+	if first := result[0].(map[string]any); first["value"] != "4" || first["itemid"] != "20000" {
+		t.Errorf("first value = %v, expected the latest value of item 20000", first)
+	}
+}
+
+// TestServer_Errors проверяет версию API, проверку токена и неизвестные методы
+func TestServer_Errors(t *testing.T) {
+	s := New(Dataset{Token: "secret"})
+
+	if v := call(t, s, map[string]any{"method": "apiinfo.version", "id": float64(1)})["result"]; v != defaultVersion {
+		t.Errorf("apiinfo.version = %v, expected %s", v, defaultVersion)
+	}
+
+	tests := []struct {
+		request map[string]any
+		code    float64
+	}{
+		{map[string]any{"method": "host.get", "id": float64(1)}, codeInvalidParams},
+		{map[string]any{"method": "host.get", "auth": "wrong", "id": float64(1)}, codeInvalidParams},
+		{map[string]any{"method": "host.create", "auth": "secret", "id": float64(1)}, codeMethodNotFound},
+	}
+	for _, tt := range tests {
+		rpcErr, ok := call(t, s, tt.request)["error"].(map[string]any)
+		if !ok || rpcErr["code"] != tt.code {
+			t.Errorf("%v: error = %v, expected code %v", tt.request, rpcErr, tt.code)
+		}
+	}
+
+	if _, ok := call(t, s, map[string]any{"method": "host.get", "auth": "secret", "id": float64(1)})["result"]; !ok {
+		t.Error("request with valid token failed")
+	}
+	if s.Requests() != 5 {
+		t.Errorf("Requests() = %d, expected 5", s.Requests())
+	}
+}
+
+// TestServer_Latency проверяет задержку ответа
+func TestServer_Latency(t *testing.T) {
+	s := New(Dataset{Latency: 50 * time.Millisecond})
+	url, stop, err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	start := time.Now()
+	resp, err := http.Post(url, "application/json", bytes.NewBufferString(`{"jsonrpc":"2.0","method":"apiinfo.version","id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("response in %v, expected latency of at least 50ms", elapsed)
+	}
+}
+
+// TestLoad проверяет чтение наборов данных из файла
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mock.yaml")
+	os.WriteFile(path, []byte(`
+servers:
+  - latency: 20ms
+    hosts:
+      - {hostid: "10084", host: "Zabbix server"}
+  - id: 5
+    generate: {hosts: 2}
+`), 0o600)
+
+	datasets, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datasets) != 2 || datasets[0].ID != 1 || datasets[1].ID != 5 {
+		t.Fatalf("unexpected datasets: %+v", datasets)
+	}
+	if datasets[0].Latency != 20*time.Millisecond || len(datasets[0].Hosts) != 1 {
+		t.Errorf("unexpected first dataset: %+v", datasets[0])
+	}
+
+	os.WriteFile(path, []byte("servers: []\n"), 0o600)
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for empty servers")
+	}
+}